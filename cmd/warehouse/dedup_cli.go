@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/pflag"
+	appservice "github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func runDedupCommand(args []string) error {
+	if len(args) == 0 {
+		printDedupHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runDedupMigrate(args[1:])
+	case "gc":
+		return runDedupGC(args[1:])
+	case "stats":
+		return runDedupStats(args[1:])
+	case "-h", "--help", "help":
+		printDedupHelp()
+		return nil
+	default:
+		return fmt.Errorf("unsupported dedup subcommand %q", args[0])
+	}
+}
+
+func printDedupHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  warehouse dedup migrate -c config.yaml [--dir DIRECTORY] [--dry-run]")
+	fmt.Println("  warehouse dedup gc -c config.yaml [--dry-run]")
+	fmt.Println("  warehouse dedup stats -c config.yaml")
+}
+
+// runDedupMigrate 把存量文件链接进去重存储；每个节点各自执行，不产生复制事件
+func runDedupMigrate(args []string) error {
+	flags := pflag.NewFlagSet("dedup-migrate", pflag.ContinueOnError)
+	flags.StringP("config", "c", "", "Config file path")
+	flags.BoolP("help", "h", false, "Show help")
+	dir := flags.String("dir", "", "Only migrate this directory (relative to webdav.directory)")
+	dryRun := flags.Bool("dry-run", false, "Only report how many bytes would be saved")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printDedupHelp()
+		return nil
+	}
+	dedup, err := buildDedupService(flags)
+	if err != nil {
+		return err
+	}
+	report, err := dedup.Migrate(context.Background(), appservice.DedupMigrateOptions{
+		DryRun: *dryRun,
+		Subdir: *dir,
+	})
+	if report != nil {
+		printPrettyJSONFromAny(report)
+	}
+	return err
+}
+
+// runDedupGC 回收不再被任何文件引用的 blob
+func runDedupGC(args []string) error {
+	flags := pflag.NewFlagSet("dedup-gc", pflag.ContinueOnError)
+	flags.StringP("config", "c", "", "Config file path")
+	flags.BoolP("help", "h", false, "Show help")
+	dryRun := flags.Bool("dry-run", false, "Only report unreferenced blobs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printDedupHelp()
+		return nil
+	}
+	dedup, err := buildDedupService(flags)
+	if err != nil {
+		return err
+	}
+	result, err := dedup.GCOnce(*dryRun)
+	if err != nil {
+		return err
+	}
+	printPrettyJSONFromAny(map[string]any{
+		"command":       "dedup gc",
+		"dry_run":       *dryRun,
+		"scanned":       result.Scanned,
+		"removed":       result.Removed,
+		"freed_bytes":   result.FreedBytes,
+		"temps_removed": result.TempsRemoved,
+	})
+	return nil
+}
+
+func runDedupStats(args []string) error {
+	flags := pflag.NewFlagSet("dedup-stats", pflag.ContinueOnError)
+	flags.StringP("config", "c", "", "Config file path")
+	flags.BoolP("help", "h", false, "Show help")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printDedupHelp()
+		return nil
+	}
+	dedup, err := buildDedupService(flags)
+	if err != nil {
+		return err
+	}
+	stats, err := dedup.Stats()
+	if err != nil {
+		return err
+	}
+	printPrettyJSONFromAny(map[string]any{
+		"command":       "dedup stats",
+		"blobs":         stats.Blobs,
+		"bytes":         stats.Bytes,
+		"references":    stats.References,
+		"logical_bytes": stats.LogicalBytes,
+		"saved_bytes":   stats.LogicalBytes - stats.Bytes,
+	})
+	return nil
+}
+
+func buildDedupService(flags *pflag.FlagSet) (*appservice.DedupService, error) {
+	configFile, _ := flags.GetString("config")
+	cfg, err := loadConfig(configFile, flags)
+	if err != nil {
+		return nil, err
+	}
+	return newDedupCLIService(cfg)
+}
+
+func newDedupCLIService(cfg *config.Config) (*appservice.DedupService, error) {
+	if !cfg.Dedup.Enabled {
+		return nil, fmt.Errorf("dedup.enabled is false; enable it before migrating so new writes stay deduplicated")
+	}
+	return appservice.NewDedupService(cfg, zap.NewNop()), nil
+}
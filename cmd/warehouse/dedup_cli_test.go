@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	appservice "github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+)
+
+func TestNewDedupCLIServiceRequiresEnabledDedup(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = t.TempDir()
+	if _, err := newDedupCLIService(cfg); err == nil {
+		t.Fatalf("expected disabled dedup to be rejected")
+	}
+}
+
+func TestDedupMigrateLinksDuplicateFiles(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = t.TempDir()
+	cfg.Dedup.Enabled = true
+	cfg.Dedup.MinSize = 1
+	content := strings.Repeat("dataset", 8)
+	for _, rel := range []string{"alice/data.csv", "bob/copy.csv", ".warehouse-uploads/tmp/part"} {
+		full := filepath.Join(cfg.WebDAV.Directory, rel)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dedup, err := newDedupCLIService(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dryRun, err := dedup.Migrate(context.Background(), appservice.DedupMigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dryRun.Scanned != 2 || dryRun.Shared != 1 || dryRun.SavedBytes != int64(len(content)) {
+		t.Fatalf("unexpected dry run report: %+v", dryRun)
+	}
+	if stats, _ := dedup.Stats(); stats.Blobs != 0 {
+		t.Fatalf("dry run must not create blobs: %+v", stats)
+	}
+
+	report, err := dedup.Migrate(context.Background(), appservice.DedupMigrateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Linked != 1 || report.Shared != 1 {
+		t.Fatalf("unexpected migrate report: %+v", report)
+	}
+	stats, err := dedup.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blobs != 1 || stats.References != 2 {
+		t.Fatalf("unexpected stats after migrate: %+v", stats)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+	appservice "github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/database"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+// jobsCLICreatedBy marks jobs queued from the command line.
+const jobsCLICreatedBy = "cli"
+
+func runJobsCommand(args []string) error {
+	if len(args) == 0 {
+		printJobsHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "list":
+		return runJobsList(args[1:])
+	case "get":
+		return runJobsAction("jobs-get", args[1:], (*appservice.JobService).AdminGet)
+	case "cancel":
+		return runJobsAction("jobs-cancel", args[1:], (*appservice.JobService).AdminCancel)
+	case "retry":
+		return runJobsAction("jobs-retry", args[1:], (*appservice.JobService).AdminRetry)
+	case "-h", "--help", "help":
+		printJobsHelp()
+		return nil
+	default:
+		return fmt.Errorf("unsupported jobs subcommand %q", args[0])
+	}
+}
+
+func printJobsHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  warehouse jobs list -c config.yaml [--username USERNAME] [--type TYPE] [--status STATUS] [--limit N] [--offset N]")
+	fmt.Println("  warehouse jobs get -c config.yaml --id JOB_ID")
+	fmt.Println("  warehouse jobs cancel -c config.yaml --id JOB_ID")
+	fmt.Println("  warehouse jobs retry -c config.yaml --id JOB_ID")
+}
+
+func newJobsFlags(name string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.StringP("config", "c", "", "Config file path")
+	flags.BoolP("help", "h", false, "Show help")
+	return flags
+}
+
+// openJobService 连接数据库并创建只用于排队与查询的任务服务，任务由服务端 worker 执行
+func openJobService(flags *pflag.FlagSet) (*appservice.JobService, user.Repository, *database.PostgresDB, error) {
+	configFile, _ := flags.GetString("config")
+	cfg, err := loadConfig(configFile, flags)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	db, err := database.NewPostgresDB(cfg.Database)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("connect database: %w", err)
+	}
+	userRepo, err := repository.NewPostgresUserRepository(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, nil, err
+	}
+	jobs := appservice.NewJobService(cfg, repository.NewPostgresJobRepository(db.DB), userRepo, zap.NewNop())
+	return jobs, userRepo, db, nil
+}
+
+// enqueueCLIJob 把任务交给服务端执行并打印任务，用于各命令的 --async
+func enqueueCLIJob(flags *pflag.FlagSet, jobType string, params any) error {
+	jobs, _, db, err := openJobService(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	job, err := jobs.Enqueue(context.Background(), jobType, "", jobsCLICreatedBy, raw)
+	if err != nil {
+		return err
+	}
+	printPrettyJSONFromAny(job)
+	return nil
+}
+
+func runJobsList(args []string) error {
+	flags := newJobsFlags("jobs-list")
+	username := flags.String("username", "", "Only list jobs owned by this user")
+	jobType := flags.String("type", "", "Only list jobs of this type")
+	status := flags.String("status", "", "Only list jobs in this status (queued, running, completed, failed, canceled)")
+	limit := flags.Int("limit", 50, "Maximum number of jobs")
+	offset := flags.Int("offset", 0, "Number of jobs to skip")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printJobsHelp()
+		return nil
+	}
+
+	jobs, userRepo, db, err := openJobService(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	query := appservice.JobListQuery{Type: *jobType, Status: *status, Limit: *limit, Offset: *offset}
+	if name := strings.TrimSpace(*username); name != "" {
+		u, err := userRepo.FindByUsername(ctx, name)
+		if err != nil {
+			return err
+		}
+		query.OwnerUserID = u.ID
+	}
+	page, err := jobs.AdminList(ctx, query)
+	if err != nil {
+		return err
+	}
+	printPrettyJSONFromAny(page)
+	return nil
+}
+
+func runJobsAction(name string, args []string, action func(*appservice.JobService, context.Context, string) (*appservice.Job, error)) error {
+	flags := newJobsFlags(name)
+	id := flags.String("id", "", "Job ID")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printJobsHelp()
+		return nil
+	}
+	if strings.TrimSpace(*id) == "" {
+		return fmt.Errorf("--id is required")
+	}
+
+	jobs, _, db, err := openJobService(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	job, err := action(jobs, context.Background(), *id)
+	if err != nil {
+		return err
+	}
+	printPrettyJSONFromAny(job)
+	return nil
+}
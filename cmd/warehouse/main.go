@@ -25,12 +25,30 @@ var (
 func main() {
 	if len(os.Args) > 1 {
 		switch os.Args[1] {
+		case "dedup":
+			if err := runDedupCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to run dedup command: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "ha":
 			if err := runHACommand(os.Args[2:]); err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to run HA command: %v\n", err)
 				os.Exit(1)
 			}
 			return
+		case "jobs":
+			if err := runJobsCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to run jobs command: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "names":
+			if err := runNamesCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to run names command: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "quota":
 			if err := runQuotaCommand(os.Args[2:]); err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to run quota command: %v\n", err)
@@ -43,12 +61,24 @@ func main() {
 				os.Exit(1)
 			}
 			return
+		case "search":
+			if err := runSearchCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to run search command: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "share":
 			if err := runShareCommand(os.Args[2:]); err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to run share command: %v\n", err)
 				os.Exit(1)
 			}
 			return
+		case "storage":
+			if err := runStorageCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to run storage command: %v\n", err)
+				os.Exit(1)
+			}
+			return
 		case "serve":
 			runServer(os.Args[2:])
 			return
@@ -128,15 +158,33 @@ func runServer(args []string) {
 	if c.QuotaReconciler != nil && c.QuotaReconciler.Enabled() {
 		startBackground(c.QuotaReconciler.Run)
 	}
+	if c.RecyclePurger != nil && c.RecyclePurger.Enabled() {
+		startBackground(c.RecyclePurger.Run)
+	}
+	if c.ShareExpiryNotifier != nil && c.ShareExpiryNotifier.Enabled() {
+		startBackground(c.ShareExpiryNotifier.Run)
+	}
 	if c.MultipartService != nil && c.Config.Node.Role != "standby" {
 		startBackground(c.MultipartService.Run)
 	}
 	if c.UploadSessionService != nil && c.Config.Node.Role != "standby" {
 		startBackground(c.UploadSessionService.Run)
 	}
+	if c.ExtractService != nil && c.Config.Node.Role != "standby" {
+		startBackground(c.ExtractService.Run)
+	}
 	if c.InternalReplicationHandler != nil {
 		startBackground(c.InternalReplicationHandler.RunAutoReconcile)
 	}
+	if c.DedupService != nil && c.DedupService.GCEnabled() {
+		startBackground(c.DedupService.Run)
+	}
+	if c.SearchService.ContentIndexerEnabled() {
+		startBackground(c.SearchService.RunContentIndexer)
+	}
+	if c.JobService.Enabled() {
+		startBackground(c.JobService.Run)
+	}
 	backgroundDone := make(chan struct{})
 	go func() {
 		backgroundWG.Wait()
@@ -274,9 +322,12 @@ func printHelp(flags *pflag.FlagSet) {
 	fmt.Println("Usage:")
 	fmt.Println("  warehouse [flags]")
 	fmt.Println("  warehouse serve [flags]")
+	fmt.Println("  warehouse dedup <subcommand> [flags]")
 	fmt.Println("  warehouse ha <subcommand> [flags]")
+	fmt.Println("  warehouse jobs <subcommand> [flags]")
 	fmt.Println("  warehouse quota <subcommand> [flags]")
 	fmt.Println("  warehouse recycle <subcommand> [flags]")
+	fmt.Println("  warehouse search <subcommand> [flags]")
 	fmt.Println()
 	fmt.Println("Flags:")
 	flags.PrintDefaults()
@@ -310,11 +361,21 @@ func printHelp(flags *pflag.FlagSet) {
 	fmt.Println("  # Check quota drift for one user")
 	fmt.Println("  warehouse quota check -c config.yaml --username alice")
 	fmt.Println()
+	fmt.Println("  # Rebuild quota for all users as a background job on the server")
+	fmt.Println("  warehouse quota rebuild -c config.yaml --async")
+	fmt.Println("  warehouse jobs list -c config.yaml --type quota.rebuild")
+	fmt.Println()
 	fmt.Println("  # Backfill recycle is_dir for historical rows")
 	fmt.Println("  warehouse recycle backfill-is-dir -c config.yaml --dry-run")
 	fmt.Println()
 	fmt.Println("  # Clean historical sync artifacts from recycle")
 	fmt.Println("  warehouse recycle clean-sync-artifacts -c config.yaml --dry-run")
+	fmt.Println()
+	fmt.Println("  # Estimate and run deduplication of existing files")
+	fmt.Println("  warehouse dedup migrate -c config.yaml --dry-run")
+	fmt.Println()
+	fmt.Println("  # Rebuild the search index")
+	fmt.Println("  warehouse search reindex -c config.yaml")
 }
 
 func runReadinessCheck(cfg *config.Config) error {
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	appservice "github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/database"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+)
+
+func runNamesCommand(args []string) error {
+	if len(args) == 0 {
+		printNamesHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "check":
+		return runNamesMigrate(args[1:], true)
+	case "normalize":
+		return runNamesMigrate(args[1:], false)
+	case "-h", "--help", "help":
+		printNamesHelp()
+		return nil
+	default:
+		return fmt.Errorf("unsupported names subcommand %q", args[0])
+	}
+}
+
+func printNamesHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  warehouse names check -c config.yaml [--dir USER_DIRECTORY] [--case-insensitive]")
+	fmt.Println("  warehouse names normalize -c config.yaml [--dir USER_DIRECTORY] [--case-insensitive] [--rename-conflicts] [--dry-run]")
+}
+
+// runNamesMigrate 检测（check）或迁移（normalize）存量文件名：
+// 非 NFC 名称改为 NFC，规范化或大小写折叠后重名的条目仅报告，或按 --rename-conflicts 改名
+func runNamesMigrate(args []string, checkOnly bool) error {
+	name := "names-normalize"
+	if checkOnly {
+		name = "names-check"
+	}
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.StringP("config", "c", "", "Config file path")
+	flags.BoolP("help", "h", false, "Show help")
+	dir := flags.String("dir", "", "Only scan this user directory (relative to webdav.directory)")
+	caseInsensitive := flags.Bool("case-insensitive", false, "Also detect case-only collisions (defaults to webdav.case_insensitive_guard)")
+	renameConflicts := flags.Bool("rename-conflicts", false, "Rename colliding entries to \"name (conflict N).ext\"")
+	dryRun := flags.Bool("dry-run", false, "Report planned renames without changing files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printNamesHelp()
+		return nil
+	}
+
+	configFile, _ := flags.GetString("config")
+	cfg, err := loadConfig(configFile, flags)
+	if err != nil {
+		return err
+	}
+	root, err := resolveNamesRoot(cfg, *dir)
+	if err != nil {
+		return err
+	}
+	opts := pathname.MigrateOptions{
+		DryRun:          checkOnly || *dryRun,
+		CaseInsensitive: cfg.WebDAV.CaseInsensitiveGuard,
+		RenameConflicts: *renameConflicts,
+		Skip:            skipInternalStores(strings.TrimSpace(*dir) == ""),
+	}
+	if flags.Changed("case-insensitive") {
+		opts.CaseInsensitive = *caseInsensitive
+	}
+
+	// 改名前先连接数据库，避免文件已改名而分享与回收站路径无法同步
+	var syncer *appservice.NamePathSyncer
+	if !opts.DryRun {
+		db, err := database.NewPostgresDB(cfg.Database)
+		if err != nil {
+			return fmt.Errorf("connect database: %w", err)
+		}
+		defer db.Close()
+		if syncer, err = buildNamePathSyncer(context.Background(), cfg, db); err != nil {
+			return err
+		}
+	}
+
+	report, err := pathname.Migrate(root, opts)
+	if report != nil {
+		printPrettyJSONFromAny(report)
+	}
+	if syncer != nil && report != nil {
+		// 父目录先于子项改名，按报告顺序同步即可得到最终路径
+		for _, rename := range report.Renames {
+			from := filepath.Join(root, filepath.FromSlash(rename.From))
+			to := filepath.Join(root, filepath.FromSlash(rename.To))
+			if syncErr := syncer.SyncRename(context.Background(), from, to); syncErr != nil {
+				return fmt.Errorf("sync database paths for %s: %w", rename.From, syncErr)
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if !opts.DryRun && len(report.Renames) > 0 {
+		fmt.Fprintln(os.Stderr, "Renamed entries are not replicated automatically; run \"warehouse ha reconcile start\" to resync standby nodes.")
+	}
+	return nil
+}
+
+// buildNamePathSyncer 加载全部用户与分享、回收站仓储，用于改名后同步数据库路径
+func buildNamePathSyncer(ctx context.Context, cfg *config.Config, db *database.PostgresDB) (*appservice.NamePathSyncer, error) {
+	userRepo, err := repository.NewPostgresUserRepository(db)
+	if err != nil {
+		return nil, err
+	}
+	users, err := userRepo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	return appservice.NewNamePathSyncer(
+		cfg,
+		users,
+		repository.NewPostgresUserShareRepository(db.DB),
+		repository.NewPostgresShareRepository(db.DB),
+		repository.NewPostgresRecycleRepository(db.DB),
+	), nil
+}
+
+// skipInternalStores 扫描 webdav.directory 根目录时跳过回收站与 .warehouse-* 内部目录：
+// 其中的文件按存储名索引，改名会使记录失效
+func skipInternalStores(scanningRoot bool) func(rel string) bool {
+	if !scanningRoot {
+		return nil
+	}
+	return func(rel string) bool {
+		if path.Dir(rel) != "/" {
+			return false
+		}
+		name := path.Base(rel)
+		return name == ".recycle" || strings.HasPrefix(name, ".warehouse-")
+	}
+}
+
+// resolveNamesRoot 返回扫描根目录，--dir 必须位于 webdav.directory 之下
+func resolveNamesRoot(cfg *config.Config, dir string) (string, error) {
+	root, err := filepath.Abs(cfg.WebDAV.Directory)
+	if err != nil {
+		return "", err
+	}
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return root, nil
+	}
+	target := filepath.Clean(filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(dir, "/"))))
+	rel, err := filepath.Rel(root, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("--dir must stay below webdav.directory")
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", target)
+	}
+	return target, nil
+}
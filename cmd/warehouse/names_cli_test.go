@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+)
+
+func TestResolveNamesRootStaysBelowWebDAVDirectory(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = t.TempDir()
+	if err := os.MkdirAll(filepath.Join(cfg.WebDAV.Directory, "alice"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := resolveNamesRoot(cfg, "alice")
+	if err != nil {
+		t.Fatalf("resolve user dir: %v", err)
+	}
+	if root != filepath.Join(cfg.WebDAV.Directory, "alice") {
+		t.Fatalf("unexpected root %q", root)
+	}
+	if _, err := resolveNamesRoot(cfg, "../outside"); err == nil {
+		t.Fatalf("expected --dir outside webdav.directory to be rejected")
+	}
+}
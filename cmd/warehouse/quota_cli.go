@@ -37,6 +37,7 @@ func printQuotaHelp() {
 	fmt.Println("Usage:")
 	fmt.Println("  warehouse quota check -c config.yaml --username USERNAME")
 	fmt.Println("  warehouse quota rebuild -c config.yaml --username USERNAME")
+	fmt.Println("  warehouse quota rebuild -c config.yaml [--username USERNAME] --async")
 }
 
 func runQuotaCheck(args []string) error {
@@ -78,6 +79,7 @@ func runQuotaCheck(args []string) error {
 		"recalculated_used":   snapshot.TotalUsed,
 		"active_used":         snapshot.ActiveUsed,
 		"recycle_used":        snapshot.RecycleUsed,
+		"version_used":        snapshot.VersionUsed,
 		"drift":               snapshot.TotalUsed - u.UsedSpace,
 		"matches":             snapshot.TotalUsed == u.UsedSpace,
 		"unlimited":           u.Quota == 0,
@@ -90,14 +92,19 @@ func runQuotaCheck(args []string) error {
 func runQuotaRebuild(args []string) error {
 	flags := newQuotaFlags("quota-rebuild")
 	username := flags.String("username", "", "Target username")
+	async := flags.Bool("async", false, "Queue the rebuild as a server job; all users when --username is empty")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
 	if help, _ := flags.GetBool("help"); help {
 		fmt.Println("Usage:")
 		fmt.Println("  warehouse quota rebuild -c config.yaml --username USERNAME")
+		fmt.Println("  warehouse quota rebuild -c config.yaml [--username USERNAME] --async")
 		return nil
 	}
+	if *async {
+		return enqueueCLIJob(flags, appservice.JobTypeQuotaRebuild, appservice.QuotaRebuildParams{Username: strings.TrimSpace(*username)})
+	}
 	if strings.TrimSpace(*username) == "" {
 		return fmt.Errorf("--username is required")
 	}
@@ -130,6 +137,7 @@ func runQuotaRebuild(args []string) error {
 		"after_used_space":  snapshot.TotalUsed,
 		"active_used":       snapshot.ActiveUsed,
 		"recycle_used":      snapshot.RecycleUsed,
+		"version_used":      snapshot.VersionUsed,
 		"delta":             snapshot.TotalUsed - before,
 		"unlimited":         u.Quota == 0,
 	}
@@ -16,6 +16,8 @@ import (
 	appservice "github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/database"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
 )
 
 type recycleBackfillItem struct {
@@ -42,6 +44,8 @@ func runRecycleCommand(args []string) error {
 		return runRecycleBackfillIsDir(args[1:])
 	case "clean-sync-artifacts":
 		return runRecycleCleanSyncArtifacts(args[1:])
+	case "purge":
+		return runRecyclePurge(args[1:])
 	case "-h", "--help", "help":
 		printRecycleHelp()
 		return nil
@@ -54,6 +58,7 @@ func printRecycleHelp() {
 	fmt.Println("Usage:")
 	fmt.Println("  warehouse recycle backfill-is-dir -c config.yaml [--dry-run] [--limit N]")
 	fmt.Println("  warehouse recycle clean-sync-artifacts -c config.yaml [--dry-run] [--limit N]")
+	fmt.Println("  warehouse recycle purge -c config.yaml [--dry-run] [--username USERNAME]")
 }
 
 func runRecycleBackfillIsDir(args []string) error {
@@ -223,6 +228,65 @@ func runRecycleCleanSyncArtifacts(args []string) error {
 	return nil
 }
 
+// runRecyclePurge 按 recycle.retention_days 与用户保留期执行一轮回收站清理，
+// 与后台清理逻辑一致：删除实际文件、释放额度、写入复制删除事件并提醒即将过期的项目
+func runRecyclePurge(args []string) error {
+	flags := pflag.NewFlagSet("recycle-purge", pflag.ContinueOnError)
+	flags.StringP("config", "c", "", "Config file path")
+	flags.BoolP("help", "h", false, "Show help")
+	dryRun := flags.Bool("dry-run", false, "Only list expired items without deleting them")
+	username := flags.String("username", "", "Only purge this user's recycle bin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		fmt.Println("Usage:")
+		fmt.Println("  warehouse recycle purge -c config.yaml [--dry-run] [--username USERNAME]")
+		return nil
+	}
+
+	cfg, db, err := buildRecycleDependencies(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if !*dryRun && strings.EqualFold(strings.TrimSpace(cfg.Node.Role), "standby") {
+		return fmt.Errorf("recycle purge must run on the active node")
+	}
+
+	userRepo, err := repository.NewPostgresUserRepository(db)
+	if err != nil {
+		return err
+	}
+	recycleRepo := repository.NewPostgresRecycleRepository(db.DB)
+	mutationRecorder := appservice.NewMutationRecorder(
+		cfg,
+		repository.NewPostgresReplicationOutboxRepository(db.DB),
+		appservice.NewReplicationPeerResolver(
+			cfg,
+			repository.NewPostgresClusterNodeRepository(db.DB),
+			repository.NewPostgresClusterReplicationAssignmentRepository(db.DB),
+		),
+		nil,
+	)
+	recycleSvc := appservice.NewRecycleService(recycleRepo, userRepo, mutationRecorder, cfg, zap.NewNop())
+	purger := appservice.NewRecyclePurger(cfg, userRepo, recycleRepo, recycleSvc, nil)
+	purger.SetNotificationService(appservice.NewNotificationService(
+		repository.NewPostgresNotificationRepository(db.DB),
+		userRepo,
+		nil,
+	))
+
+	report, err := purger.PurgeOnce(context.Background(), appservice.RecyclePurgeOptions{
+		DryRun:   *dryRun,
+		Username: *username,
+	})
+	if report != nil {
+		printPrettyJSONFromAny(report)
+	}
+	return err
+}
+
 func buildRecycleDependencies(flags *pflag.FlagSet) (*config.Config, *database.PostgresDB, error) {
 	configFile, _ := flags.GetString("config")
 	cfg, err := loadConfig(configFile, flags)
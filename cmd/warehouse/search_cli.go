@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+	appservice "github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/database"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+func runSearchCommand(args []string) error {
+	if len(args) == 0 {
+		printSearchHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "reindex":
+		return runSearchReindex(args[1:])
+	case "-h", "--help", "help":
+		printSearchHelp()
+		return nil
+	default:
+		return fmt.Errorf("unsupported search subcommand %q", args[0])
+	}
+}
+
+func printSearchHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  warehouse search reindex -c config.yaml [--username USERNAME]")
+}
+
+// runSearchReindex 重建搜索索引：遍历用户目录写入条目，并删除已不存在的文件记录；
+// 开启内容索引时同时把已开启空间内的文件排入抽取队列（未变化的文件由抽取任务跳过）；
+// 索引与主节点共享，备节点拒绝执行
+func runSearchReindex(args []string) error {
+	flags := pflag.NewFlagSet("search-reindex", pflag.ContinueOnError)
+	configFile := flags.StringP("config", "c", "", "Config file path")
+	username := flags.String("username", "", "Only reindex this user")
+	help := flags.BoolP("help", "h", false, "Show help")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *help {
+		printSearchHelp()
+		return nil
+	}
+
+	cfg, err := loadConfig(*configFile, flags)
+	if err != nil {
+		return err
+	}
+	if !cfg.Search.Enabled {
+		return fmt.Errorf("search is disabled (search.enabled=false)")
+	}
+
+	db, err := database.NewPostgresDB(cfg.Database)
+	if err != nil {
+		return fmt.Errorf("connect database: %w", err)
+	}
+	defer db.Close()
+
+	userRepo, err := repository.NewPostgresUserRepository(db)
+	if err != nil {
+		return err
+	}
+	search := appservice.NewSearchService(cfg, repository.NewPostgresSearchIndexRepository(db.DB), nil, userRepo, zap.NewNop())
+	search.SetContentRepository(repository.NewPostgresSearchContentRepository(db.DB))
+	if !search.IndexesWrites() {
+		return fmt.Errorf("the search index is maintained by the active node; run reindex there")
+	}
+
+	ctx := context.Background()
+	var users []*user.User
+	if name := strings.TrimSpace(*username); name != "" {
+		u, err := userRepo.FindByUsername(ctx, name)
+		if err != nil {
+			return fmt.Errorf("find user %s: %w", name, err)
+		}
+		users = []*user.User{u}
+	} else if users, err = userRepo.List(ctx); err != nil {
+		return fmt.Errorf("list users: %w", err)
+	}
+
+	reports := make([]*appservice.SearchReindexReport, 0, len(users))
+	for _, u := range users {
+		report, err := search.Reindex(ctx, u)
+		if errors.Is(err, appservice.ErrSearchInvalid) {
+			fmt.Fprintf(os.Stderr, "skip %s: %v\n", u.Username, err)
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("reindex %s: %w", u.Username, err)
+		}
+		reports = append(reports, report)
+	}
+	printPrettyJSONFromAny(map[string]any{
+		"command": "search reindex",
+		"users":   reports,
+	})
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"github.com/spf13/pflag"
+	appservice "github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/database"
 )
@@ -64,9 +65,9 @@ func runShareCommand(args []string) error {
 
 func printShareHelp() {
 	fmt.Println("Usage:")
-	fmt.Println("  warehouse share backfill-resources -c config.yaml [--dry-run]")
+	fmt.Println("  warehouse share backfill-resources -c config.yaml [--dry-run | --async]")
 	fmt.Println("  warehouse share verify-resources -c config.yaml")
-	fmt.Println("  warehouse share backfill-audiences -c config.yaml [--dry-run]")
+	fmt.Println("  warehouse share backfill-audiences -c config.yaml [--dry-run | --async]")
 	fmt.Println("  warehouse share verify-audiences -c config.yaml")
 }
 
@@ -75,6 +76,7 @@ func runShareBackfillResources(args []string) error {
 	flags.StringP("config", "c", "", "Config file path")
 	flags.BoolP("help", "h", false, "Show help")
 	dryRun := flags.Bool("dry-run", false, "Report the backfill plan without writing")
+	async := flags.Bool("async", false, "Queue the full share reconcile as a server job")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -82,6 +84,9 @@ func runShareBackfillResources(args []string) error {
 		printShareHelp()
 		return nil
 	}
+	if *async {
+		return enqueueShareReconcileJob(flags, *dryRun)
+	}
 	_, db, err := buildShareDependencies(flags)
 	if err != nil {
 		return err
@@ -136,6 +141,7 @@ func runShareBackfillAudiences(args []string) error {
 	flags.StringP("config", "c", "", "Config file path")
 	flags.BoolP("help", "h", false, "Show help")
 	dryRun := flags.Bool("dry-run", false, "Report the backfill plan without writing")
+	async := flags.Bool("async", false, "Queue the full share reconcile as a server job")
 	if err := flags.Parse(args); err != nil {
 		return err
 	}
@@ -143,6 +149,9 @@ func runShareBackfillAudiences(args []string) error {
 		printShareHelp()
 		return nil
 	}
+	if *async {
+		return enqueueShareReconcileJob(flags, *dryRun)
+	}
 	_, db, err := buildShareDependencies(flags)
 	if err != nil {
 		return err
@@ -189,6 +198,14 @@ func runShareVerifyAudiences(args []string) error {
 	return nil
 }
 
+// enqueueShareReconcileJob 两种回填都由同一个幂等的 share.reconcile 任务完成（资源、授权与受众关联）
+func enqueueShareReconcileJob(flags *pflag.FlagSet, dryRun bool) error {
+	if dryRun {
+		return fmt.Errorf("--async cannot be combined with --dry-run")
+	}
+	return enqueueCLIJob(flags, appservice.JobTypeShareReconcile, struct{}{})
+}
+
 func buildShareDependencies(flags *pflag.FlagSet) (*config.Config, *database.PostgresDB, error) {
 	configFile, _ := flags.GetString("config")
 	cfg, err := loadConfig(configFile, flags)
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+	appservice "github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/database"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+func runStorageCommand(args []string) error {
+	if len(args) == 0 {
+		printStorageHelp()
+		return nil
+	}
+
+	switch args[0] {
+	case "status":
+		return runStorageStatus(args[1:])
+	case "move-user":
+		return runStorageMoveUser(args[1:])
+	case "-h", "--help", "help":
+		printStorageHelp()
+		return nil
+	default:
+		return fmt.Errorf("unsupported storage subcommand %q", args[0])
+	}
+}
+
+func printStorageHelp() {
+	fmt.Println("Usage:")
+	fmt.Println("  warehouse storage status -c config.yaml")
+	fmt.Println("  warehouse storage move-user -c config.yaml --username USERNAME --to VOLUME [--settle 5s] [--dry-run]")
+}
+
+// runStorageStatus 列出所有数据卷及其用户数、已用空间与剩余空间
+func runStorageStatus(args []string) error {
+	flags := newStorageFlags("storage-status")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printStorageHelp()
+		return nil
+	}
+	cfg, db, volumes, err := buildStorageDependencies(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statuses, err := volumes.Status(context.Background())
+	if err != nil {
+		return err
+	}
+	printPrettyJSONFromAny(map[string]any{
+		"command":   "storage status",
+		"placement": cfg.Storage.Placement,
+		"volumes":   statuses,
+	})
+	return nil
+}
+
+// runStorageMoveUser 在线把用户目录迁移到另一个数据卷；
+// 备节点只迁移本地目录，不改写与主节点共享的 users.volume
+func runStorageMoveUser(args []string) error {
+	flags := newStorageFlags("storage-move-user")
+	username := flags.String("username", "", "Target username")
+	target := flags.String("to", "", "Destination volume name")
+	settle := flags.Duration("settle", 5*time.Second, "How long writes stay blocked before the final copy pass")
+	dryRun := flags.Bool("dry-run", false, "Only check the move and report its size")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if help, _ := flags.GetBool("help"); help {
+		printStorageHelp()
+		return nil
+	}
+	if strings.TrimSpace(*username) == "" {
+		return fmt.Errorf("--username is required")
+	}
+	if strings.TrimSpace(*target) == "" {
+		return fmt.Errorf("--to is required")
+	}
+
+	cfg, db, volumes, err := buildStorageDependencies(flags)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	report, err := volumes.MoveUser(context.Background(), strings.TrimSpace(*username),
+		storageMoveOptions(cfg, strings.TrimSpace(*target), *settle, *dryRun))
+	if report != nil {
+		printPrettyJSONFromAny(report)
+	}
+	return err
+}
+
+func storageMoveOptions(cfg *config.Config, target string, settle time.Duration, dryRun bool) appservice.VolumeMoveOptions {
+	return appservice.VolumeMoveOptions{
+		Target:     target,
+		Settle:     settle,
+		DryRun:     dryRun,
+		KeepRecord: cfg.Replication.Enabled && strings.EqualFold(strings.TrimSpace(cfg.Node.Role), "standby"),
+	}
+}
+
+func newStorageFlags(name string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.StringP("config", "c", "", "Config file path")
+	flags.BoolP("help", "h", false, "Show help")
+	return flags
+}
+
+func buildStorageDependencies(flags *pflag.FlagSet) (*config.Config, *database.PostgresDB, *appservice.VolumeService, error) {
+	configFile, _ := flags.GetString("config")
+	cfg, err := loadConfig(configFile, flags)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	db, err := database.NewPostgresDB(cfg.Database)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("connect database: %w", err)
+	}
+
+	userRepo, err := repository.NewPostgresUserRepository(db)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, nil, err
+	}
+	return cfg, db, appservice.NewVolumeService(cfg, userRepo, zap.NewNop()), nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+)
+
+func TestStorageMoveOptionsKeepRecordOnStandby(t *testing.T) {
+	cfg := config.DefaultConfig()
+	opts := storageMoveOptions(cfg, "hdd1", 3*time.Second, true)
+	if opts.Target != "hdd1" || opts.Settle != 3*time.Second || !opts.DryRun || opts.KeepRecord {
+		t.Fatalf("unexpected options on a single node: %+v", opts)
+	}
+
+	cfg.Replication.Enabled = true
+	cfg.Node.Role = "active"
+	if opts := storageMoveOptions(cfg, "hdd1", 0, false); opts.KeepRecord {
+		t.Fatalf("active node must record the new volume: %+v", opts)
+	}
+	cfg.Node.Role = "standby"
+	if opts := storageMoveOptions(cfg, "hdd1", 0, false); !opts.KeepRecord {
+		t.Fatalf("standby node must keep the shared record: %+v", opts)
+	}
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"go.uber.org/zap"
 )
 
@@ -19,6 +20,8 @@ const (
 	AppsSpaceKey = "apps"
 	// ServicesSpaceKey 服务资产空间 key
 	ServicesSpaceKey = "services"
+	// TeamsSpaceKey 团队空间 key，每个团队一个空间，路径为 /teams/<id>
+	TeamsSpaceKey = "teams"
 )
 
 // Space 资产空间元信息
@@ -31,6 +34,7 @@ type Space struct {
 // Manager 管理用户资产空间目录（personal/apps/services）
 type Manager struct {
 	webdavRoot   string
+	volumes      *storage.Volumes
 	appScopePath string
 	logger       *zap.Logger
 }
@@ -39,13 +43,18 @@ type Manager struct {
 func NewManager(cfg *config.Config, logger *zap.Logger) *Manager {
 	webdavRoot := ""
 	appScopePath := "/apps"
+	var volumes *storage.Volumes
 	if cfg != nil {
 		webdavRoot = strings.TrimSpace(cfg.WebDAV.Directory)
 		appScopePath = normalizeAppScopePath(cfg.Web3.UCAN.AppScope.PathPrefix)
+		if len(cfg.Storage.Volumes) > 0 {
+			volumes = storage.VolumesFromConfig(cfg)
+		}
 	}
 
 	return &Manager{
 		webdavRoot:   webdavRoot,
+		volumes:      volumes,
 		appScopePath: appScopePath,
 		logger:       logger,
 	}
@@ -136,6 +145,10 @@ func (m *Manager) resolveUserRoot(u *user.User) string {
 	if base == "" {
 		return filepath.Clean(userDir)
 	}
+	if m.volumes != nil {
+		// 用户目录可能位于其它数据卷
+		base = m.volumes.UserBase(u.Volume, userDir)
+	}
 	return filepath.Join(base, userDir)
 }
 
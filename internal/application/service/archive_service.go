@@ -0,0 +1,401 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	webdavfs "github.com/yeying-community/warehouse/internal/infrastructure/webdav"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrArchiveInvalid  = errors.New("invalid archive request")
+	ErrArchiveTooLarge = errors.New("archive exceeds size limit")
+)
+
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+// ArchiveSource is one top-level file or directory placed into an archive.
+type ArchiveSource struct {
+	FullPath string
+	// Name is the top-level entry name; defaults to the base name of FullPath.
+	Name string
+	// LogicalPath is the user-visible path handed to ArchiveRequest.Allow.
+	LogicalPath string
+}
+
+type ArchiveRequest struct {
+	Format  string
+	Sources []ArchiveSource
+	// Allow filters nested entries by logical path; nil includes everything.
+	Allow func(logicalPath string, isDir bool) bool
+}
+
+// ArchivePlan is the walked and size-checked entry list of an archive request.
+type ArchivePlan struct {
+	Format  string
+	Files   int
+	Bytes   int64
+	entries []archiveEntry
+}
+
+type archiveEntry struct {
+	fullPath string
+	name     string
+	isDir    bool
+	size     int64
+	mode     os.FileMode
+	modTime  time.Time
+}
+
+// ArchiveService streams directories and multi-path selections as ZIP (ZIP64
+// when needed) or tar.gz straight to the client, without temporary files.
+type ArchiveService struct {
+	config  *config.Config
+	storage storage.Backend
+	logger  *zap.Logger
+}
+
+func NewArchiveService(cfg *config.Config, logger *zap.Logger) *ArchiveService {
+	return &ArchiveService{config: cfg, storage: storage.NewLocal(), logger: logger}
+}
+
+// SetStorage sets the backend the archived files are read from.
+func (s *ArchiveService) SetStorage(backend storage.Backend) {
+	if s != nil && backend != nil {
+		s.storage = backend
+	}
+}
+
+// Plan walks the sources and enforces the configured size limit before any
+// byte is written, so callers can still answer with a proper error status.
+func (s *ArchiveService) Plan(ctx context.Context, req ArchiveRequest) (*ArchivePlan, error) {
+	format, err := ParseArchiveFormat(req.Format)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Sources) == 0 {
+		return nil, fmt.Errorf("%w: no source", ErrArchiveInvalid)
+	}
+	plan := &ArchivePlan{Format: format}
+	usedNames := make(map[string]int, len(req.Sources))
+	for _, source := range req.Sources {
+		name := strings.TrimSpace(source.Name)
+		if name == "" {
+			name = filepath.Base(source.FullPath)
+		}
+		name = uniqueArchiveName(usedNames, name)
+		if err := s.planSource(ctx, plan, req.Allow, source, name); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+func (s *ArchiveService) planSource(ctx context.Context, plan *ArchivePlan, allow func(string, bool) bool, source ArchiveSource, name string) error {
+	rootInfo, err := s.storage.Lstat(source.FullPath)
+	if err != nil {
+		return err
+	}
+	if rootInfo.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("%w: symlink source", ErrArchiveInvalid)
+	}
+	logicalRoot := path.Clean("/" + strings.TrimPrefix(filepath.ToSlash(source.LogicalPath), "/"))
+	if !rootInfo.IsDir() {
+		return s.addEntry(plan, source.FullPath, name, rootInfo)
+	}
+	return s.storage.WalkDir(source.FullPath, func(current string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source.FullPath, current)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && isSkippedArchiveName(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&os.ModeSymlink != 0 || (!d.IsDir() && !d.Type().IsRegular()) {
+			return nil
+		}
+		entryName := name
+		logicalPath := logicalRoot
+		if rel != "." {
+			entryName = name + "/" + rel
+			logicalPath = path.Join(logicalRoot, rel)
+		}
+		if allow != nil && !allow(logicalPath, d.IsDir()) {
+			// Keep walking: a deeper path may match a more specific allow rule.
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		return s.addEntry(plan, current, entryName, info)
+	})
+}
+
+func (s *ArchiveService) addEntry(plan *ArchivePlan, fullPath, name string, info os.FileInfo) error {
+	entry := archiveEntry{
+		fullPath: fullPath,
+		name:     name,
+		isDir:    info.IsDir(),
+		mode:     info.Mode().Perm(),
+		modTime:  info.ModTime(),
+	}
+	if !entry.isDir {
+		entry.size = info.Size()
+		plan.Files++
+		plan.Bytes += entry.size
+		if limit := s.maxSize(); limit > 0 && plan.Bytes > limit {
+			return ErrArchiveTooLarge
+		}
+	}
+	plan.entries = append(plan.entries, entry)
+	return nil
+}
+
+// Write streams the planned entries to w.
+func (s *ArchiveService) Write(ctx context.Context, w io.Writer, plan *ArchivePlan) error {
+	if plan == nil {
+		return ErrArchiveInvalid
+	}
+	if plan.Format == ArchiveFormatTarGz {
+		return writeTarGzArchive(ctx, s.storage, w, plan)
+	}
+	return writeZipArchive(ctx, s.storage, w, plan)
+}
+
+// Serve plans the request and streams the archive as an attachment. Errors
+// returned happen before the response is started; write failures after that
+// can only be logged.
+func (s *ArchiveService) Serve(w http.ResponseWriter, r *http.Request, req ArchiveRequest, baseName string) error {
+	plan, err := s.Plan(r.Context(), req)
+	if err != nil {
+		return err
+	}
+	s.ServePlan(w, r, plan, baseName)
+	return nil
+}
+
+// ServePlan streams an archive planned earlier, for callers that must act
+// between planning and the first byte (e.g. counting a limited download).
+func (s *ArchiveService) ServePlan(w http.ResponseWriter, r *http.Request, plan *ArchivePlan, baseName string) {
+	ClearUploadDeadlines(w, s.logger)
+	fileName := ArchiveFileName(baseName, plan.Format)
+	w.Header().Set("Content-Type", archiveContentType(plan.Format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("X-Warehouse-Archive-Files", strconv.Itoa(plan.Files))
+	w.Header().Set("X-Warehouse-Archive-Bytes", strconv.FormatInt(plan.Bytes, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := s.Write(r.Context(), w, plan); err != nil && s.logger != nil {
+		s.logger.Warn("archive stream interrupted",
+			zap.String("file", fileName),
+			zap.Int("files", plan.Files),
+			zap.Int64("bytes", plan.Bytes),
+			zap.Error(err))
+	}
+}
+
+func (s *ArchiveService) maxSize() int64 {
+	if s == nil || s.config == nil {
+		return 0
+	}
+	return s.config.WebDAV.ArchiveMaxSize
+}
+
+// UserArchiveFilter applies the user's path rules (User.CanAccess) to archive entries.
+func UserArchiveFilter(u *user.User) func(logicalPath string, isDir bool) bool {
+	root := ""
+	if u != nil {
+		root = u.Directory
+		if strings.TrimSpace(root) == "" {
+			root = u.Username
+		}
+	}
+	return func(logicalPath string, _ bool) bool {
+		if u == nil {
+			return false
+		}
+		permissionPath := "/" + strings.Trim(path.Join(filepath.ToSlash(root), logicalPath), "/")
+		return u.CanAccess(permissionPath, "read")
+	}
+}
+
+// ParseArchiveFormat accepts zip (default) and tar.gz/tgz.
+func ParseArchiveFormat(raw string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", "zip":
+		return ArchiveFormatZip, nil
+	case "tar.gz", "tgz", "targz":
+		return ArchiveFormatTarGz, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported format %q", ErrArchiveInvalid, raw)
+	}
+}
+
+func ArchiveFileName(baseName, format string) string {
+	baseName = strings.TrimSpace(baseName)
+	if baseName == "" || baseName == "/" || baseName == "." {
+		baseName = "download"
+	}
+	if format == ArchiveFormatTarGz {
+		return baseName + ".tar.gz"
+	}
+	return baseName + ".zip"
+}
+
+func archiveContentType(format string) string {
+	if format == ArchiveFormatTarGz {
+		return "application/gzip"
+	}
+	return "application/zip"
+}
+
+func writeZipArchive(ctx context.Context, b storage.Backend, w io.Writer, plan *ArchivePlan) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range plan.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header := &zip.FileHeader{Name: entry.name, Modified: entry.modTime}
+		if entry.isDir {
+			header.Name += "/"
+			header.Method = zip.Store
+			header.SetMode(os.ModeDir | entry.mode)
+			if _, err := zw.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+		header.Method = archiveCompressionMethod(entry.name)
+		header.SetMode(entry.mode)
+		// archive/zip switches to ZIP64 records once an entry or offset passes 4GiB.
+		dst, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		if err := copyArchiveFile(b, dst, entry, false); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGzArchive(ctx context.Context, b storage.Backend, w io.Writer, plan *ArchivePlan) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, entry := range plan.entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    entry.name,
+			Mode:    int64(entry.mode),
+			ModTime: entry.modTime,
+			Format:  tar.FormatPAX,
+		}
+		if entry.isDir {
+			header.Name += "/"
+			header.Typeflag = tar.TypeDir
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = entry.size
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if entry.isDir {
+			continue
+		}
+		if err := copyArchiveFile(b, tw, entry, true); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// copyArchiveFile copies a planned file; tar entries must match the planned size exactly.
+func copyArchiveFile(b storage.Backend, dst io.Writer, entry archiveEntry, exactSize bool) error {
+	file, err := b.Open(entry.fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if !exactSize {
+		_, err = io.Copy(dst, io.LimitReader(file, entry.size))
+		return err
+	}
+	if _, err := io.CopyN(dst, file, entry.size); err != nil {
+		return fmt.Errorf("copy %s: %w", entry.name, err)
+	}
+	return nil
+}
+
+func archiveCompressionMethod(name string) uint16 {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".zip", ".gz", ".tgz", ".bz2", ".xz", ".zst", ".7z", ".rar",
+		".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic",
+		".mp3", ".aac", ".flac", ".ogg", ".mp4", ".m4a", ".m4v", ".mov", ".mkv", ".webm", ".avi":
+		return zip.Store
+	default:
+		return zip.Deflate
+	}
+}
+
+func isSkippedArchiveName(name string) bool {
+	switch name {
+	case ".recycle", ".warehouse-uploads", ".s3-multipart":
+		return true
+	}
+	return webdavfs.IsIgnoredName(name) || strings.HasPrefix(name, ".warehouse-")
+}
+
+func uniqueArchiveName(used map[string]int, name string) string {
+	count := used[name]
+	used[name] = count + 1
+	if count == 0 {
+		return name
+	}
+	ext := path.Ext(name)
+	candidate := fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), count, ext)
+	if _, exists := used[candidate]; exists {
+		return uniqueArchiveName(used, candidate)
+	}
+	used[candidate] = 1
+	return candidate
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func TestArchiveServiceWritesZip(t *testing.T) {
+	t.Parallel()
+
+	root := newArchiveTestTree(t)
+	archives := NewArchiveService(config.DefaultConfig(), zap.NewNop())
+	plan, err := archives.Plan(context.Background(), ArchiveRequest{
+		Sources: []ArchiveSource{{FullPath: filepath.Join(root, "docs")}},
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if plan.Files != 2 || plan.Bytes != int64(len("hello")+len("nested")) {
+		t.Fatalf("unexpected plan totals: files=%d bytes=%d", plan.Files, plan.Bytes)
+	}
+
+	var buf bytes.Buffer
+	if err := archives.Write(context.Background(), &buf, plan); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	contents := map[string]string{}
+	for _, file := range reader.File {
+		if strings.HasSuffix(file.Name, "/") {
+			contents[file.Name] = ""
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", file.Name, err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		contents[file.Name] = string(data)
+	}
+	want := map[string]string{
+		"docs/":              "",
+		"docs/a.txt":         "hello",
+		"docs/sub/":          "",
+		"docs/sub/photo.jpg": "nested",
+	}
+	if len(contents) != len(want) {
+		t.Fatalf("unexpected entries: %v", sortedKeys(contents))
+	}
+	for name, body := range want {
+		if got, ok := contents[name]; !ok || got != body {
+			t.Fatalf("entry %s = %q (present=%v), want %q", name, got, ok, body)
+		}
+	}
+}
+
+func TestArchiveServiceWritesTarGzForMultipleSources(t *testing.T) {
+	t.Parallel()
+
+	root := newArchiveTestTree(t)
+	archives := NewArchiveService(config.DefaultConfig(), zap.NewNop())
+	plan, err := archives.Plan(context.Background(), ArchiveRequest{
+		Format: "tgz",
+		Sources: []ArchiveSource{
+			{FullPath: filepath.Join(root, "docs", "a.txt")},
+			{FullPath: filepath.Join(root, "other", "a.txt")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := archives.Write(context.Background(), &buf, plan); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("open gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read tar: %v", err)
+		}
+		names = append(names, header.Name)
+	}
+	if strings.Join(names, ",") != "a.txt,a (1).txt" {
+		t.Fatalf("unexpected tar entries: %v", names)
+	}
+}
+
+func TestArchiveServiceEnforcesSizeLimit(t *testing.T) {
+	t.Parallel()
+
+	root := newArchiveTestTree(t)
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.ArchiveMaxSize = 8
+	archives := NewArchiveService(cfg, zap.NewNop())
+	_, err := archives.Plan(context.Background(), ArchiveRequest{
+		Sources: []ArchiveSource{{FullPath: filepath.Join(root, "docs")}},
+	})
+	if !errors.Is(err, ErrArchiveTooLarge) {
+		t.Fatalf("expected ErrArchiveTooLarge, got %v", err)
+	}
+}
+
+func TestArchiveServiceAppliesUserRules(t *testing.T) {
+	t.Parallel()
+
+	root := newArchiveTestTree(t)
+	u := user.NewUser("alice", "alice")
+	u.Rules = []*user.Rule{{Path: "/alice/docs/sub", Permissions: user.ParsePermissions("")}}
+	archives := NewArchiveService(config.DefaultConfig(), zap.NewNop())
+	plan, err := archives.Plan(context.Background(), ArchiveRequest{
+		Sources: []ArchiveSource{{FullPath: filepath.Join(root, "docs"), LogicalPath: "/docs"}},
+		Allow:   UserArchiveFilter(u),
+	})
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	for _, entry := range plan.entries {
+		if strings.HasPrefix(entry.name, "docs/sub") {
+			t.Fatalf("denied entry %s was archived", entry.name)
+		}
+	}
+	if plan.Files != 1 {
+		t.Fatalf("expected 1 file, got %d", plan.Files)
+	}
+}
+
+func TestArchiveServiceServeRejectsUnknownFormat(t *testing.T) {
+	t.Parallel()
+
+	root := newArchiveTestTree(t)
+	archives := NewArchiveService(config.DefaultConfig(), zap.NewNop())
+	req := httptest.NewRequest(http.MethodGet, "/dav/docs/", nil)
+	rec := httptest.NewRecorder()
+	err := archives.Serve(rec, req, ArchiveRequest{
+		Format:  "rar",
+		Sources: []ArchiveSource{{FullPath: filepath.Join(root, "docs")}},
+	}, "docs")
+	if !errors.Is(err, ErrArchiveInvalid) {
+		t.Fatalf("expected ErrArchiveInvalid, got %v", err)
+	}
+	if rec.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("headers must not be written on plan errors")
+	}
+}
+
+// newArchiveTestTree creates docs/{a.txt,sub/photo.jpg}, other/a.txt and system entries to be skipped.
+func newArchiveTestTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"docs/a.txt":                      "hello",
+		"docs/sub/photo.jpg":              "nested",
+		"docs/.DS_Store":                  "junk",
+		"docs/.warehouse-uploads/s1/part": "partial",
+		"other/a.txt":                     "other",
+	}
+	for name, body := range files {
+		fullPath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(fullPath, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/blobstore"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	"go.uber.org/zap"
+)
+
+// dedupTempGrace keeps GC away from link temp files that are still in use.
+const dedupTempGrace = time.Hour
+
+// dedupSkippedDirs are top-level staging areas whose files are rewritten in
+// place or removed soon after, so linking them would save nothing.
+var dedupSkippedDirs = map[string]bool{
+	blobstore.DirName:    true,
+	".warehouse-uploads": true,
+	".warehouse-extract": true,
+	".s3-multipart":      true,
+	storage.MovingDir:    true,
+	ThumbnailsDirName:    true,
+}
+
+// DedupService stores identical file contents once in the content-addressed
+// blob store and collects blobs nothing references any more. Quota is not
+// affected: every owner is still charged the logical size of their files.
+type DedupService struct {
+	config *config.Config
+	store  *blobstore.Store
+	logger *zap.Logger
+}
+
+// DedupMigrateOptions controls one migration pass over existing data.
+type DedupMigrateOptions struct {
+	// DryRun hashes files and reports the savings without linking anything.
+	DryRun bool
+	// Subdir limits the pass to one directory below webdav.directory.
+	Subdir string
+}
+
+// DedupMigrateReport summarizes a migration pass.
+type DedupMigrateReport struct {
+	DryRun     bool  `json:"dry_run"`
+	Scanned    int   `json:"scanned"`
+	Linked     int   `json:"linked"`
+	Shared     int   `json:"shared"`
+	Skipped    int   `json:"skipped"`
+	Failed     int   `json:"failed"`
+	SavedBytes int64 `json:"saved_bytes"`
+}
+
+// NewDedupService returns nil when dedup is disabled.
+func NewDedupService(cfg *config.Config, logger *zap.Logger) *DedupService {
+	if cfg == nil || !cfg.Dedup.Enabled {
+		return nil
+	}
+	return &DedupService{
+		config: cfg,
+		store:  blobstore.New(cfg.WebDAV.Directory, cfg.Dedup.MinSize),
+		logger: logger,
+	}
+}
+
+// Enabled reports whether writes should be deduplicated.
+func (s *DedupService) Enabled() bool {
+	return s != nil && s.store != nil
+}
+
+// Store exposes the underlying blob store, or nil when disabled.
+func (s *DedupService) Store() *blobstore.Store {
+	if !s.Enabled() {
+		return nil
+	}
+	return s.store
+}
+
+// Ingest links a freshly written file to its blob. Failures only cost disk
+// space, so they are logged rather than failing the write.
+func (s *DedupService) Ingest(fullPath string) {
+	if !s.Enabled() {
+		return
+	}
+	if _, err := s.store.Ingest(fullPath); err != nil && s.logger != nil {
+		s.logger.Warn("failed to deduplicate file",
+			zap.String("path", fullPath),
+			zap.Error(err))
+	}
+}
+
+// IngestWithDigest is Ingest for a file whose SHA-256 was computed while writing.
+func (s *DedupService) IngestWithDigest(fullPath, sum string) {
+	if !s.Enabled() {
+		return
+	}
+	if _, err := s.store.IngestWithDigest(fullPath, sum); err != nil && s.logger != nil {
+		s.logger.Warn("failed to deduplicate file",
+			zap.String("path", fullPath),
+			zap.Error(err))
+	}
+}
+
+// IngestTree ingests every regular file below root, e.g. after a COPY.
+func (s *DedupService) IngestTree(root string) {
+	if !s.Enabled() {
+		return
+	}
+	if err := s.store.IngestTree(root); err != nil && s.logger != nil {
+		s.logger.Warn("failed to deduplicate directory",
+			zap.String("path", root),
+			zap.Error(err))
+	}
+}
+
+// Migrate links the existing files under webdav.directory into the store.
+func (s *DedupService) Migrate(ctx context.Context, opts DedupMigrateOptions) (*DedupMigrateReport, error) {
+	report := &DedupMigrateReport{DryRun: opts.DryRun}
+	root := filepath.Clean(s.config.WebDAV.Directory)
+	walkRoot := root
+	if subdir := strings.Trim(filepath.Clean("/"+opts.Subdir), "/"); subdir != "" {
+		walkRoot = filepath.Join(root, subdir)
+	}
+	// In dry runs, digests seen earlier in the pass count as stored blobs.
+	seen := make(map[string]bool)
+	err := filepath.WalkDir(walkRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if d.IsDir() {
+			if filepath.Dir(p) == root && dedupSkippedDirs[d.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), "._") {
+			return nil
+		}
+		report.Scanned++
+		info, err := d.Info()
+		if err != nil || info.Size() == 0 || info.Size() < s.store.MinSize() {
+			report.Skipped++
+			return nil
+		}
+		if opts.DryRun {
+			sum, err := blobstore.FileSHA256(p)
+			if err != nil {
+				report.Failed++
+				return nil
+			}
+			if seen[sum] || s.store.Has(sum, info.Size()) {
+				report.Shared++
+				report.SavedBytes += info.Size()
+			} else {
+				report.Linked++
+			}
+			seen[sum] = true
+			return nil
+		}
+		result, err := s.store.Ingest(p)
+		switch {
+		case err != nil:
+			report.Failed++
+			if s.logger != nil {
+				s.logger.Warn("failed to migrate file into blob store", zap.String("path", p), zap.Error(err))
+			}
+		case result.Shared:
+			report.Shared++
+			report.SavedBytes += result.Size
+		case result.Linked:
+			report.Linked++
+		default:
+			report.Skipped++
+		}
+		return nil
+	})
+	return report, err
+}
+
+// GCOnce removes blobs no file links to any more.
+func (s *DedupService) GCOnce(dryRun bool) (blobstore.GCResult, error) {
+	return s.store.GC(dryRun, dedupTempGrace)
+}
+
+// Stats reports blob and reference totals.
+func (s *DedupService) Stats() (blobstore.Stats, error) {
+	return s.store.Stats()
+}
+
+// GCEnabled reports whether the background GC loop should run. It runs on
+// standby nodes too, since each node keeps its own store.
+func (s *DedupService) GCEnabled() bool {
+	return s.Enabled() && s.config.Dedup.GCInterval > 0
+}
+
+// Run collects unreferenced blobs periodically until ctx is canceled.
+func (s *DedupService) Run(ctx context.Context) {
+	if !s.GCEnabled() {
+		return
+	}
+	ticker := time.NewTicker(s.config.Dedup.GCInterval)
+	defer ticker.Stop()
+	if s.logger != nil {
+		s.logger.Info("blob store gc started", zap.Duration("interval", s.config.Dedup.GCInterval))
+		defer s.logger.Info("blob store gc stopped")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := s.GCOnce(false)
+			if s.logger == nil {
+				continue
+			}
+			if err != nil {
+				s.logger.Error("blob store gc failed", zap.Error(err))
+				continue
+			}
+			if result.Removed > 0 || result.TempsRemoved > 0 {
+				s.logger.Info("blob store gc completed",
+					zap.Int("scanned", result.Scanned),
+					zap.Int("removed", result.Removed),
+					zap.Int64("freed_bytes", result.FreedBytes),
+					zap.Int("temps_removed", result.TempsRemoved))
+			}
+		}
+	}
+}
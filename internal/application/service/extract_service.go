@@ -0,0 +1,1086 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
+	"github.com/yeying-community/warehouse/internal/domain/permission"
+	"github.com/yeying-community/warehouse/internal/domain/quota"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrExtractJobNotFound = errors.New("extract job not found")
+	ErrExtractForbidden   = errors.New("extract forbidden")
+	ErrExtractInvalid     = errors.New("invalid extract request")
+	ErrExtractUnsafeEntry = errors.New("archive entry escapes target directory")
+)
+
+const (
+	ExtractJobStatusQueued    = "queued"
+	ExtractJobStatusScanning  = "scanning"
+	ExtractJobStatusRunning   = "running"
+	ExtractJobStatusCompleted = "completed"
+	ExtractJobStatusFailed    = "failed"
+	ExtractJobStatusCanceled  = "canceled"
+
+	ExtractConflictSkip      = "skip"
+	ExtractConflictOverwrite = "overwrite"
+	ExtractConflictRename    = "rename"
+
+	ExtractFormatZip   = "zip"
+	ExtractFormatTar   = "tar"
+	ExtractFormatTarGz = "tar.gz"
+
+	MaxExtractEntries = 100000
+	ExtractJobTTL     = 7 * 24 * time.Hour
+
+	extractConcurrency  = 2
+	extractSaveInterval = time.Second
+)
+
+type ExtractInput struct {
+	// SourcePath is the archive inside the user's space.
+	SourcePath string
+	// TargetPath defaults to a sibling folder named after the archive.
+	TargetPath string
+	Conflict   string
+}
+
+// ExtractJob is the persisted state and progress of one extraction.
+type ExtractJob struct {
+	ID               string    `json:"id"`
+	OwnerUserID      string    `json:"ownerUserId"`
+	SourcePath       string    `json:"sourcePath"`
+	TargetPath       string    `json:"targetPath"`
+	Format           string    `json:"format"`
+	Conflict         string    `json:"conflict"`
+	Status           string    `json:"status"`
+	TotalEntries     int       `json:"totalEntries"`
+	TotalBytes       int64     `json:"totalBytes"`
+	ProcessedEntries int       `json:"processedEntries"`
+	ProcessedBytes   int64     `json:"processedBytes"`
+	Created          int       `json:"created"`
+	Overwritten      int       `json:"overwritten"`
+	Renamed          int       `json:"renamed"`
+	Skipped          int       `json:"skipped"`
+	Error            string    `json:"error,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// Done reports whether the job reached a terminal status.
+func (j *ExtractJob) Done() bool {
+	switch j.Status {
+	case ExtractJobStatusCompleted, ExtractJobStatusFailed, ExtractJobStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// Progress returns the processed byte ratio in [0, 1].
+func (j *ExtractJob) Progress() float64 {
+	if j.Status == ExtractJobStatusCompleted {
+		return 1
+	}
+	if j.TotalBytes > 0 {
+		return math.Min(1, float64(j.ProcessedBytes)/float64(j.TotalBytes))
+	}
+	if j.TotalEntries > 0 {
+		return math.Min(1, float64(j.ProcessedEntries)/float64(j.TotalEntries))
+	}
+	return 0
+}
+
+type extractRun struct {
+	job        *ExtractJob
+	owner      *user.User
+	sourceFull string
+	targetFull string
+	ctx        context.Context
+	cancel     context.CancelFunc
+	dirs       map[string]extractDir
+	lastSave   time.Time
+}
+
+type extractDir struct {
+	fullPath string
+	skip     bool
+}
+
+type extractEntryKind int
+
+const (
+	extractEntryFile extractEntryKind = iota
+	extractEntryDir
+	extractEntryOther
+)
+
+type extractEntry struct {
+	name    string
+	kind    extractEntryKind
+	size    int64
+	modTime time.Time
+}
+
+// ExtractService unpacks ZIP and tar(.gz) archives stored in a user's space
+// into a target folder as background jobs.
+type ExtractService struct {
+	config           *config.Config
+	permissionCheck  permission.Checker
+	quotaService     quota.Service
+	userRepo         user.Repository
+	mutationRecorder MutationRecorder
+	versions         *VersionService
+	recycle          *RecycleService
+	uploadPolicy     *UploadPolicyEnforcer
+	storage          storage.Backend
+	logger           *zap.Logger
+
+	mu    sync.Mutex
+	runs  map[string]*extractRun
+	slots chan struct{}
+}
+
+func NewExtractService(
+	cfg *config.Config,
+	permissionCheck permission.Checker,
+	quotaService quota.Service,
+	userRepo user.Repository,
+	mutationRecorder MutationRecorder,
+	logger *zap.Logger,
+) *ExtractService {
+	if mutationRecorder == nil {
+		mutationRecorder = noopMutationRecorder{}
+	}
+	return &ExtractService{
+		config:           cfg,
+		permissionCheck:  permissionCheck,
+		quotaService:     quotaService,
+		userRepo:         userRepo,
+		mutationRecorder: mutationRecorder,
+		storage:          storage.NewLocal(),
+		logger:           logger,
+		runs:             make(map[string]*extractRun),
+		slots:            make(chan struct{}, extractConcurrency),
+	}
+}
+
+// SetStorage sets the backend holding archives, extracted files and job state.
+func (s *ExtractService) SetStorage(backend storage.Backend) {
+	if backend != nil {
+		s.storage = backend
+	}
+}
+
+// SetVersionService retains the previous content of files replaced by the
+// overwrite conflict mode as versions.
+func (s *ExtractService) SetVersionService(versions *VersionService) {
+	s.versions = versions
+}
+
+// SetRecycleService moves replaced entries to the recycle bin when versioning
+// is off. Without either, overwrite falls back to renaming.
+func (s *ExtractService) SetRecycleService(recycle *RecycleService) {
+	s.recycle = recycle
+}
+
+// SetUploadPolicyEnforcer applies the owner's upload policy to every
+// extracted entry; violating entries are skipped like forbidden ones.
+func (s *ExtractService) SetUploadPolicyEnforcer(enforcer *UploadPolicyEnforcer) {
+	s.uploadPolicy = enforcer
+}
+
+// Start validates the request synchronously and queues the extraction.
+func (s *ExtractService) Start(ctx context.Context, u *user.User, input ExtractInput) (*ExtractJob, error) {
+	if u == nil {
+		return nil, ErrExtractForbidden
+	}
+	conflict, err := parseExtractConflict(input.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	sourcePath, err := normalizeExtractPath(NamePolicy(s.config), input.SourcePath, false)
+	if err != nil {
+		return nil, err
+	}
+	format := detectExtractFormat(sourcePath)
+	if format == "" {
+		return nil, fmt.Errorf("%w: unsupported archive format", ErrExtractInvalid)
+	}
+	targetPath := strings.TrimSpace(input.TargetPath)
+	if targetPath == "" {
+		targetPath = path.Join(path.Dir(sourcePath), trimExtractExtension(path.Base(sourcePath)))
+	}
+	if targetPath, err = normalizeExtractPath(NamePolicy(s.config), targetPath, true); err != nil {
+		return nil, err
+	}
+	if isIgnoredUploadPath(targetPath) {
+		return nil, ErrExtractInvalid
+	}
+
+	userRoot := s.userRootDir(u)
+	sourceFull := NamePolicy(s.config).WithFS(s.storage).Resolve(userRoot, filepath.Join(userRoot, filepath.FromSlash(strings.TrimPrefix(sourcePath, "/"))))
+	targetFull := NamePolicy(s.config).WithFS(s.storage).Resolve(userRoot, filepath.Join(userRoot, filepath.FromSlash(strings.TrimPrefix(targetPath, "/"))))
+	if !isPathWithin(userRoot, sourceFull) || !isPathWithin(userRoot, targetFull) {
+		return nil, ErrExtractInvalid
+	}
+	if err := enforceAppScope(ctx, s.config, sourcePath, "read"); err != nil {
+		return nil, err
+	}
+	if err := enforceAppScope(ctx, s.config, targetPath, "create"); err != nil {
+		return nil, err
+	}
+	if !s.allowed(ctx, u, sourceFull, permission.OperationRead) || !s.allowed(ctx, u, targetFull, permission.OperationCreate) {
+		return nil, ErrExtractForbidden
+	}
+	info, err := s.storage.Stat(sourceFull)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%w: source is not a file", ErrExtractInvalid)
+	}
+	if info, err := s.storage.Lstat(targetFull); err == nil && !info.IsDir() {
+		return nil, fmt.Errorf("%w: target is not a directory", ErrExtractInvalid)
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	owner := u
+	if s.userRepo != nil {
+		if fresh, err := s.userRepo.FindByID(ctx, u.ID); err == nil {
+			owner = fresh
+		}
+	}
+	now := time.Now()
+	job := &ExtractJob{
+		ID:          uuid.NewString(),
+		OwnerUserID: u.ID,
+		SourcePath:  sourcePath,
+		TargetPath:  targetPath,
+		Format:      format,
+		Conflict:    conflict,
+		Status:      ExtractJobStatusQueued,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.saveJob(job); err != nil {
+		return nil, err
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	run := &extractRun{
+		job:        job,
+		owner:      owner,
+		sourceFull: sourceFull,
+		targetFull: targetFull,
+		ctx:        runCtx,
+		cancel:     cancel,
+		dirs:       make(map[string]extractDir),
+	}
+	s.mu.Lock()
+	s.runs[job.ID] = run
+	snapshot := *job
+	s.mu.Unlock()
+	go s.execute(run)
+	return &snapshot, nil
+}
+
+// Get returns a snapshot of the caller's job.
+func (s *ExtractService) Get(ctx context.Context, u *user.User, id string) (*ExtractJob, error) {
+	if u == nil {
+		return nil, ErrExtractForbidden
+	}
+	s.mu.Lock()
+	run, ok := s.runs[strings.TrimSpace(id)]
+	if ok {
+		snapshot := *run.job
+		s.mu.Unlock()
+		if snapshot.OwnerUserID != u.ID {
+			return nil, ErrExtractJobNotFound
+		}
+		return &snapshot, nil
+	}
+	s.mu.Unlock()
+	job, err := s.loadJob(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.OwnerUserID != u.ID {
+		return nil, ErrExtractJobNotFound
+	}
+	return job, nil
+}
+
+// List returns the caller's jobs, newest first.
+func (s *ExtractService) List(ctx context.Context, u *user.User) ([]*ExtractJob, error) {
+	if u == nil {
+		return nil, ErrExtractForbidden
+	}
+	entries, err := s.storage.ReadDir(s.jobRoot())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	jobs := make([]*ExtractJob, 0, len(entries))
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		job, err := s.Get(ctx, u, id)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	return jobs, nil
+}
+
+// Cancel stops a queued or running job; entries already written are kept.
+func (s *ExtractService) Cancel(ctx context.Context, u *user.User, id string) (*ExtractJob, error) {
+	job, err := s.Get(ctx, u, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	run, ok := s.runs[job.ID]
+	s.mu.Unlock()
+	if ok && !job.Done() {
+		run.cancel()
+	}
+	return job, nil
+}
+
+// Run removes expired job records and cancels running jobs on shutdown.
+func (s *ExtractService) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		_, _ = s.CleanupExpired(ctx, time.Now())
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for _, run := range s.runs {
+				run.cancel()
+			}
+			s.mu.Unlock()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *ExtractService) CleanupExpired(ctx context.Context, now time.Time) (int, error) {
+	entries, err := s.storage.ReadDir(s.jobRoot())
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	cleaned := 0
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return cleaned, err
+		}
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		job, err := s.loadJob(id)
+		if err != nil || !job.Done() || now.Sub(job.UpdatedAt) < ExtractJobTTL {
+			continue
+		}
+		s.mu.Lock()
+		delete(s.runs, id)
+		s.mu.Unlock()
+		if err := s.storage.Remove(s.jobFile(id)); err != nil && !os.IsNotExist(err) {
+			return cleaned, err
+		}
+		cleaned++
+	}
+	return cleaned, nil
+}
+
+func (s *ExtractService) execute(run *extractRun) {
+	defer run.cancel()
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-run.ctx.Done():
+		s.finish(run, run.ctx.Err())
+		return
+	}
+	s.setStatus(run, ExtractJobStatusScanning)
+	err := s.scan(run)
+	if err == nil && s.quotaService != nil && run.job.TotalBytes > 0 {
+		err = s.quotaService.CheckQuota(run.ctx, run.owner, run.job.TotalBytes)
+	}
+	if err == nil {
+		s.setStatus(run, ExtractJobStatusRunning)
+		err = s.extract(run)
+	}
+	s.finish(run, err)
+}
+
+// scan validates every entry name before anything is written and totals the
+// uncompressed size for the quota precheck.
+func (s *ExtractService) scan(run *extractRun) error {
+	var entries int
+	var bytes int64
+	err := walkExtractArchive(run.ctx, s.storage, run.sourceFull, run.job.Format, func(entry extractEntry, _ func() (io.ReadCloser, error)) error {
+		name, err := sanitizeExtractEntryName(NamePolicy(s.config), entry.name)
+		if err != nil {
+			return err
+		}
+		if name == "" || isSkippedExtractName(name) {
+			return nil
+		}
+		entries++
+		if entries > MaxExtractEntries {
+			return fmt.Errorf("%w: archive has more than %d entries", ErrExtractInvalid, MaxExtractEntries)
+		}
+		if entry.kind == extractEntryFile {
+			bytes += entry.size
+			if limit := s.maxSize(); limit > 0 && bytes > limit {
+				return ErrArchiveTooLarge
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.update(run, func(job *ExtractJob) {
+		job.TotalEntries = entries
+		job.TotalBytes = bytes
+	})
+	return nil
+}
+
+func (s *ExtractService) extract(run *extractRun) error {
+	if err := s.ensureTargetRoot(run); err != nil {
+		return err
+	}
+	return walkExtractArchive(run.ctx, s.storage, run.sourceFull, run.job.Format, func(entry extractEntry, open func() (io.ReadCloser, error)) error {
+		name, err := sanitizeExtractEntryName(NamePolicy(s.config), entry.name)
+		if err != nil {
+			return err
+		}
+		if name == "" || isSkippedExtractName(name) {
+			return nil
+		}
+		switch entry.kind {
+		case extractEntryDir:
+			_, err = s.resolveDir(run, name)
+		case extractEntryFile:
+			err = s.extractFile(run, name, entry, open)
+		default:
+			s.update(run, func(job *ExtractJob) { job.Skipped++ })
+		}
+		if err != nil {
+			return err
+		}
+		s.update(run, func(job *ExtractJob) {
+			job.ProcessedEntries++
+			if entry.kind == extractEntryFile {
+				job.ProcessedBytes += entry.size
+			}
+		})
+		return nil
+	})
+}
+
+func (s *ExtractService) ensureTargetRoot(run *extractRun) error {
+	if _, err := s.storage.Stat(run.targetFull); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.storage.MkdirAll(run.targetFull, 0o755); err != nil {
+		return err
+	}
+	return s.mutationRecorder.EnsureDir(run.ctx, run.targetFull)
+}
+
+// resolveDir maps an archive directory to its on-disk location, applying the
+// conflict policy once per directory and creating missing parents.
+func (s *ExtractService) resolveDir(run *extractRun, name string) (extractDir, error) {
+	if name == "." || name == "" {
+		return extractDir{fullPath: run.targetFull}, nil
+	}
+	if dir, ok := run.dirs[name]; ok {
+		return dir, nil
+	}
+	parent, err := s.resolveDir(run, path.Dir(name))
+	if err != nil {
+		return extractDir{}, err
+	}
+	if parent.skip {
+		run.dirs[name] = parent
+		return parent, nil
+	}
+	candidate := filepath.Join(parent.fullPath, path.Base(name))
+	if !isPathWithin(run.targetFull, candidate) {
+		return extractDir{}, ErrExtractUnsafeEntry
+	}
+	candidate = NamePolicy(s.config).WithFS(s.storage).Resolve(run.targetFull, candidate)
+	dir := extractDir{fullPath: candidate}
+	info, err := s.storage.Lstat(candidate)
+	switch {
+	case err == nil && info.IsDir():
+		run.dirs[name] = dir
+		return dir, nil
+	case err != nil && !os.IsNotExist(err):
+		return extractDir{}, err
+	}
+
+	outcome := func(job *ExtractJob) { job.Created++ }
+	if err != nil && NamePolicy(s.config).WithFS(s.storage).CheckCollision(candidate) != nil {
+		// A sibling differing only by case is never replaced; rename or skip.
+		if run.job.Conflict != ExtractConflictRename {
+			dir.skip = true
+			s.update(run, func(job *ExtractJob) { job.Skipped++ })
+			run.dirs[name] = dir
+			return dir, nil
+		}
+		dir.fullPath = uniqueExtractPath(s.storage, candidate)
+		outcome = func(job *ExtractJob) { job.Renamed++ }
+	}
+	if err == nil {
+		// A file or symlink occupies the directory name.
+		switch run.job.Conflict {
+		case ExtractConflictSkip:
+			dir.skip = true
+			s.update(run, func(job *ExtractJob) { job.Skipped++ })
+			run.dirs[name] = dir
+			return dir, nil
+		case ExtractConflictRename:
+			dir.fullPath = uniqueExtractPath(s.storage, candidate)
+			outcome = func(job *ExtractJob) { job.Renamed++ }
+		default:
+			if s.recycle == nil {
+				// Nowhere to keep the replaced file; keep both instead.
+				dir.fullPath = uniqueExtractPath(s.storage, candidate)
+				outcome = func(job *ExtractJob) { job.Renamed++ }
+				break
+			}
+			if err := s.removeConflictingFile(run, candidate); err != nil {
+				return extractDir{}, err
+			}
+			outcome = func(job *ExtractJob) { job.Overwritten++ }
+		}
+	}
+	if !s.allowed(run.ctx, run.owner, dir.fullPath, permission.OperationCreate) ||
+		s.uploadPolicy.CheckOwnerDirectory(run.owner, dir.fullPath) != nil {
+		dir.skip = true
+		s.update(run, func(job *ExtractJob) { job.Skipped++ })
+		run.dirs[name] = dir
+		return dir, nil
+	}
+	if err := s.storage.MkdirAll(dir.fullPath, 0o755); err != nil {
+		return extractDir{}, err
+	}
+	if err := s.mutationRecorder.EnsureDir(run.ctx, dir.fullPath); err != nil {
+		return extractDir{}, err
+	}
+	s.update(run, outcome)
+	run.dirs[name] = dir
+	return dir, nil
+}
+
+func (s *ExtractService) extractFile(run *extractRun, name string, entry extractEntry, open func() (io.ReadCloser, error)) error {
+	parent, err := s.resolveDir(run, path.Dir(name))
+	if err != nil {
+		return err
+	}
+	if parent.skip {
+		s.update(run, func(job *ExtractJob) { job.Skipped++ })
+		return nil
+	}
+	target := filepath.Join(parent.fullPath, path.Base(name))
+	if !isPathWithin(run.targetFull, target) {
+		return ErrExtractUnsafeEntry
+	}
+	target = NamePolicy(s.config).WithFS(s.storage).Resolve(run.targetFull, target)
+	op := permission.OperationCreate
+	var oldSize int64
+	replacing := false
+	outcome := func(job *ExtractJob) { job.Created++ }
+	if info, err := s.storage.Lstat(target); os.IsNotExist(err) && NamePolicy(s.config).WithFS(s.storage).CheckCollision(target) != nil {
+		// A sibling differing only by case is never replaced; rename or skip.
+		if run.job.Conflict != ExtractConflictRename {
+			s.update(run, func(job *ExtractJob) { job.Skipped++ })
+			return nil
+		}
+		target = uniqueExtractPath(s.storage, target)
+		outcome = func(job *ExtractJob) { job.Renamed++ }
+	} else if err == nil {
+		switch {
+		case run.job.Conflict == ExtractConflictSkip:
+			s.update(run, func(job *ExtractJob) { job.Skipped++ })
+			return nil
+		case run.job.Conflict == ExtractConflictRename || info.IsDir() || !s.canRetainReplaced():
+			target = uniqueExtractPath(s.storage, target)
+			outcome = func(job *ExtractJob) { job.Renamed++ }
+		default:
+			op = permission.OperationWrite
+			if info.Mode().IsRegular() {
+				oldSize = info.Size()
+			}
+			replacing = true
+			outcome = func(job *ExtractJob) { job.Overwritten++ }
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if !s.allowed(run.ctx, run.owner, target, op) || s.uploadPolicy.CheckOwnerPath(run.owner, target, entry.size, "") != nil {
+		s.update(run, func(job *ExtractJob) { job.Skipped++ })
+		return nil
+	}
+
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	out, err := s.storage.CreateAtomic(target, 0o644)
+	if err != nil {
+		return err
+	}
+	written, err := io.Copy(out, io.LimitReader(src, entry.size+1))
+	if err == nil && written != entry.size {
+		err = fmt.Errorf("%w: size mismatch for %s", ErrExtractInvalid, name)
+	}
+	if err != nil {
+		out.Abort()
+		return err
+	}
+	if replacing {
+		// The replaced content stays charged as a version or recycle item.
+		retainedSize, err := s.retainReplaced(run, target, oldSize)
+		if err != nil {
+			out.Abort()
+			return err
+		}
+		oldSize -= retainedSize
+	}
+	if err := s.commitFile(run, out, written-oldSize); err != nil {
+		return err
+	}
+	if !entry.modTime.IsZero() {
+		_ = s.storage.Chtimes(target, entry.modTime, entry.modTime)
+	}
+	if err := s.mutationRecorder.UpsertFile(run.ctx, target); err != nil {
+		return err
+	}
+	s.update(run, outcome)
+	return nil
+}
+
+// commitFile publishes the temp file and charges the size delta to the owner.
+func (s *ExtractService) commitFile(run *extractRun, out storage.AtomicFile, delta int64) error {
+	owner := run.owner
+	reserved := false
+	var reservedUsed int64
+	var err error
+	if reserveRepo, ok := s.userRepo.(quotaReserveRepository); ok && delta != 0 {
+		reservedUsed, err = reserveRepo.ReserveUsedSpaceDelta(run.ctx, owner.Username, delta)
+		if err != nil {
+			out.Abort()
+			return err
+		}
+		reserved = true
+	} else if s.quotaService != nil && delta > 0 {
+		if err := s.quotaService.CheckQuota(run.ctx, owner, delta); err != nil {
+			out.Abort()
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		if reserved {
+			_ = s.userRepo.(quotaReserveRepository).ReleaseUsedSpaceDelta(run.ctx, owner.Username, delta)
+		}
+		return err
+	}
+	if reserved {
+		_ = owner.UpdateUsedSpace(reservedUsed)
+	} else if s.userRepo != nil && delta != 0 {
+		used, err := s.userRepo.UpdateUsedSpaceDelta(run.ctx, owner.Username, delta)
+		if err != nil {
+			return err
+		}
+		_ = owner.UpdateUsedSpace(used)
+	}
+	return nil
+}
+
+// canRetainReplaced reports whether overwritten files can be kept as a
+// version or a recycle item; otherwise the overwrite mode renames instead.
+func (s *ExtractService) canRetainReplaced() bool {
+	return s.versions.Enabled() || s.recycle != nil
+}
+
+// retainReplaced keeps the file about to be replaced and returns how much of
+// its size moved out of the live tree (and must not be credited back).
+func (s *ExtractService) retainReplaced(run *extractRun, fullPath string, size int64) (int64, error) {
+	if s.versions.Enabled() {
+		// The live file is replaced in place; the version copy is charged by Capture.
+		_, err := s.versions.Capture(run.ctx, run.owner, fullPath, VersionSourceExtract)
+		return 0, err
+	}
+	if err := s.recycle.RecycleExisting(run.ctx, run.owner, fullPath); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// removeConflictingFile moves a file that occupies a directory name to the
+// recycle bin; it stays charged to the owner there.
+func (s *ExtractService) removeConflictingFile(run *extractRun, fullPath string) error {
+	if !s.allowed(run.ctx, run.owner, fullPath, permission.OperationDelete) {
+		return ErrExtractForbidden
+	}
+	return s.recycle.RecycleExisting(run.ctx, run.owner, fullPath)
+}
+
+func (s *ExtractService) finish(run *extractRun, err error) {
+	s.mu.Lock()
+	job := run.job
+	switch {
+	case err == nil:
+		job.Status = ExtractJobStatusCompleted
+	case errors.Is(err, context.Canceled):
+		job.Status = ExtractJobStatusCanceled
+	default:
+		job.Status = ExtractJobStatusFailed
+		job.Error = err.Error()
+	}
+	job.UpdatedAt = time.Now()
+	snapshot := *job
+	s.mu.Unlock()
+	if err := s.saveJob(&snapshot); err != nil && s.logger != nil {
+		s.logger.Warn("failed to save extract job", zap.String("id", snapshot.ID), zap.Error(err))
+	}
+	if s.logger != nil {
+		s.logger.Info("extract job finished",
+			zap.String("id", snapshot.ID),
+			zap.String("status", snapshot.Status),
+			zap.String("source", snapshot.SourcePath),
+			zap.String("target", snapshot.TargetPath),
+			zap.Int("entries", snapshot.ProcessedEntries),
+			zap.String("error", snapshot.Error))
+	}
+}
+
+func (s *ExtractService) setStatus(run *extractRun, status string) {
+	s.update(run, func(job *ExtractJob) { job.Status = status })
+	run.lastSave = time.Time{}
+	s.persistProgress(run)
+}
+
+// update mutates the job under the service lock so Get sees consistent snapshots.
+func (s *ExtractService) update(run *extractRun, fn func(job *ExtractJob)) {
+	s.mu.Lock()
+	fn(run.job)
+	run.job.UpdatedAt = time.Now()
+	s.mu.Unlock()
+	s.persistProgress(run)
+}
+
+func (s *ExtractService) persistProgress(run *extractRun) {
+	if time.Since(run.lastSave) < extractSaveInterval {
+		return
+	}
+	run.lastSave = time.Now()
+	s.mu.Lock()
+	snapshot := *run.job
+	s.mu.Unlock()
+	if err := s.saveJob(&snapshot); err != nil && s.logger != nil {
+		s.logger.Warn("failed to save extract job progress", zap.String("id", snapshot.ID), zap.Error(err))
+	}
+}
+
+func (s *ExtractService) allowed(ctx context.Context, u *user.User, fullPath string, op permission.Operation) bool {
+	if s.permissionCheck == nil {
+		return true
+	}
+	rel, err := filepath.Rel(s.userRootDir(u), fullPath)
+	if err != nil {
+		return false
+	}
+	permissionPath := filepath.Join(s.userPermissionRoot(u), rel)
+	return s.permissionCheck.Check(ctx, u, permissionPath, op) == nil
+}
+
+func (s *ExtractService) maxSize() int64 {
+	if s == nil || s.config == nil {
+		return 0
+	}
+	return s.config.WebDAV.ArchiveMaxSize
+}
+
+func (s *ExtractService) loadJob(id string) (*ExtractJob, error) {
+	id = strings.TrimSpace(id)
+	if !isValidUploadSessionID(id) {
+		return nil, ErrExtractJobNotFound
+	}
+	data, err := storage.ReadFile(s.storage, s.jobFile(id))
+	if os.IsNotExist(err) {
+		return nil, ErrExtractJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job ExtractJob
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, err
+	}
+	if !job.Done() {
+		// Only jobs of this process live in memory; anything else was interrupted by a restart.
+		job.Status = ExtractJobStatusFailed
+		job.Error = "interrupted"
+	}
+	return &job, nil
+}
+
+func (s *ExtractService) saveJob(job *ExtractJob) error {
+	if err := s.storage.MkdirAll(s.jobRoot(), 0o700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(s.storage, s.jobFile(job.ID), data, 0o600)
+}
+
+func (s *ExtractService) jobRoot() string {
+	root := "/data"
+	if s != nil && s.config != nil && strings.TrimSpace(s.config.WebDAV.Directory) != "" {
+		root = s.config.WebDAV.Directory
+	}
+	return filepath.Join(root, ".warehouse-extract")
+}
+
+func (s *ExtractService) jobFile(id string) string {
+	return filepath.Join(s.jobRoot(), id+".json")
+}
+
+func (s *ExtractService) userRootDir(u *user.User) string {
+	return ownerUserRootDir(s.config, u)
+}
+
+func (s *ExtractService) userPermissionRoot(u *user.User) string {
+	if u == nil {
+		return ""
+	}
+	if strings.TrimSpace(u.Directory) != "" {
+		return u.Directory
+	}
+	return u.Username
+}
+
+// walkExtractArchive visits archive entries in stored order. open is only
+// valid during the callback.
+func walkExtractArchive(ctx context.Context, b storage.Backend, fullPath, format string, fn func(entry extractEntry, open func() (io.ReadCloser, error)) error) error {
+	if format == ExtractFormatZip {
+		return walkZipArchive(ctx, b, fullPath, fn)
+	}
+	return walkTarArchive(ctx, b, fullPath, format == ExtractFormatTarGz, fn)
+}
+
+func walkZipArchive(ctx context.Context, b storage.Backend, fullPath string, fn func(extractEntry, func() (io.ReadCloser, error)) error) error {
+	file, err := b.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	reader, err := zip.NewReader(file, info.Size())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrExtractInvalid, err)
+	}
+	for _, file := range reader.File {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mode := file.Mode()
+		entry := extractEntry{name: file.Name, modTime: file.Modified}
+		switch {
+		case strings.HasSuffix(file.Name, "/") || mode.IsDir():
+			entry.kind = extractEntryDir
+		case mode.IsRegular():
+			if file.UncompressedSize64 > math.MaxInt64 {
+				return fmt.Errorf("%w: entry too large", ErrExtractInvalid)
+			}
+			entry.kind = extractEntryFile
+			entry.size = int64(file.UncompressedSize64)
+		default:
+			entry.kind = extractEntryOther
+		}
+		if err := fn(entry, file.Open); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func walkTarArchive(ctx context.Context, b storage.Backend, fullPath string, gzipped bool, fn func(extractEntry, func() (io.ReadCloser, error)) error) error {
+	file, err := b.Open(fullPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var src io.Reader = file
+	if gzipped {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrExtractInvalid, err)
+		}
+		defer gz.Close()
+		src = gz
+	}
+	tr := tar.NewReader(src)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrExtractInvalid, err)
+		}
+		entry := extractEntry{name: header.Name, modTime: header.ModTime}
+		switch {
+		case header.Typeflag == tar.TypeXGlobalHeader:
+			continue
+		case header.Typeflag == tar.TypeDir:
+			entry.kind = extractEntryDir
+		case header.FileInfo().Mode().IsRegular():
+			entry.kind = extractEntryFile
+			entry.size = header.Size
+		default:
+			entry.kind = extractEntryOther
+		}
+		open := func() (io.ReadCloser, error) { return io.NopCloser(tr), nil }
+		if err := fn(entry, open); err != nil {
+			return err
+		}
+	}
+}
+
+// sanitizeExtractEntryName rejects absolute and parent-escaping names
+// (zip-slip) and returns a clean relative slash path; "" means the root.
+func sanitizeExtractEntryName(names pathname.Policy, raw string) (string, error) {
+	name := names.Normalize(strings.ReplaceAll(raw, "\\", "/"))
+	if strings.ContainsRune(name, 0) || strings.HasPrefix(name, "/") || (len(name) >= 2 && name[1] == ':') {
+		return "", fmt.Errorf("%w: %q", ErrExtractUnsafeEntry, raw)
+	}
+	clean := path.Clean(name)
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("%w: %q", ErrExtractUnsafeEntry, raw)
+	}
+	if clean == "." {
+		return "", nil
+	}
+	return clean, nil
+}
+
+// isSkippedExtractName drops macOS resource forks and warehouse system names.
+func isSkippedExtractName(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == "__MACOSX" || isSkippedArchiveName(part) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseExtractConflict(raw string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(raw)) {
+	case "", ExtractConflictSkip:
+		return ExtractConflictSkip, nil
+	case ExtractConflictOverwrite:
+		return ExtractConflictOverwrite, nil
+	case ExtractConflictRename:
+		return ExtractConflictRename, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported conflict policy %q", ErrExtractInvalid, raw)
+	}
+}
+
+func normalizeExtractPath(names pathname.Policy, raw string, allowRoot bool) (string, error) {
+	raw = strings.TrimSpace(strings.ReplaceAll(raw, "\\", "/"))
+	if raw == "" {
+		return "", fmt.Errorf("%w: path is required", ErrExtractInvalid)
+	}
+	clean := path.Clean("/" + strings.TrimLeft(names.Normalize(raw), "/"))
+	if strings.HasPrefix(clean, "/..") || (clean == "/" && !allowRoot) {
+		return "", ErrExtractInvalid
+	}
+	return clean, nil
+}
+
+func detectExtractFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return ExtractFormatZip
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return ExtractFormatTarGz
+	case strings.HasSuffix(lower, ".tar"):
+		return ExtractFormatTar
+	default:
+		return ""
+	}
+}
+
+func trimExtractExtension(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tgz", ".tar", ".zip"} {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	return name + ".extracted"
+}
+
+// uniqueExtractPath returns "name (n).ext" for the first n that is free.
+func uniqueExtractPath(b storage.Backend, fullPath string) string {
+	dir := filepath.Dir(fullPath)
+	base := filepath.Base(fullPath)
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s (%d)%s", stem, i, ext))
+		if _, err := b.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
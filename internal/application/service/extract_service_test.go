@@ -0,0 +1,372 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
+	"github.com/yeying-community/warehouse/internal/domain/quota"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func TestExtractServiceExtractsZipWithRenamePolicy(t *testing.T) {
+	t.Parallel()
+
+	recorder := &testMutationRecorder{}
+	svc, u, userRoot := newExtractTestService(t, 0, recorder)
+	writeExtractTestZip(t, filepath.Join(userRoot, "project.zip"), map[string]string{
+		"src/":               "",
+		"src/main.go":        "package main",
+		"README.md":          "new readme",
+		"__MACOSX/._main.go": "junk",
+		"src/.DS_Store":      "junk",
+	})
+	if err := os.MkdirAll(filepath.Join(userRoot, "project"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(userRoot, "project", "README.md"), []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := svc.Start(context.Background(), u, ExtractInput{SourcePath: "/project.zip", Conflict: "rename"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if job.TargetPath != "/project" {
+		t.Fatalf("expected default target /project, got %s", job.TargetPath)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusCompleted {
+		t.Fatalf("expected completed job, got %s: %s", job.Status, job.Error)
+	}
+	if job.TotalEntries != 3 || job.ProcessedEntries != 3 || job.Renamed != 1 || job.Progress() != 1 {
+		t.Fatalf("unexpected job counters: %+v", job)
+	}
+	assertExtractedFile(t, filepath.Join(userRoot, "project", "README.md"), "old")
+	assertExtractedFile(t, filepath.Join(userRoot, "project", "README (1).md"), "new readme")
+	assertExtractedFile(t, filepath.Join(userRoot, "project", "src", "main.go"), "package main")
+	if _, err := os.Stat(filepath.Join(userRoot, "project", "__MACOSX")); !os.IsNotExist(err) {
+		t.Fatalf("expected __MACOSX to be skipped, got %v", err)
+	}
+	if recorder.upsertFileCalls != 2 || recorder.ensureDirCalls < 1 {
+		t.Fatalf("expected mutation events, got upserts=%d dirs=%d", recorder.upsertFileCalls, recorder.ensureDirCalls)
+	}
+	if used := storedUsedSpace(t, svc, u); used != int64(len("package main")+len("new readme")) {
+		t.Fatalf("unexpected used space %d", used)
+	}
+}
+
+func TestExtractServiceRejectsZipSlip(t *testing.T) {
+	t.Parallel()
+
+	svc, u, userRoot := newExtractTestService(t, 0, nil)
+	writeExtractTestZip(t, filepath.Join(userRoot, "evil.zip"), map[string]string{
+		"ok.txt":           "fine",
+		"../../escape.txt": "pwned",
+	})
+
+	job, err := svc.Start(context.Background(), u, ExtractInput{SourcePath: "/evil.zip", TargetPath: "/out"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusFailed || !strings.Contains(job.Error, "escapes") {
+		t.Fatalf("expected zip-slip failure, got %s: %s", job.Status, job.Error)
+	}
+	if _, err := os.Stat(filepath.Join(userRoot, "out", "ok.txt")); !os.IsNotExist(err) {
+		t.Fatalf("nothing must be written for unsafe archives, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(userRoot), "escape.txt")); !os.IsNotExist(err) {
+		t.Fatalf("escape.txt must not exist, got %v", err)
+	}
+}
+
+func TestExtractServiceQuotaPrecheck(t *testing.T) {
+	t.Parallel()
+
+	svc, u, userRoot := newExtractTestService(t, 8, nil)
+	writeExtractTestTarGz(t, filepath.Join(userRoot, "big.tar.gz"), map[string]string{
+		"a.txt": "0123456789",
+	})
+
+	job, err := svc.Start(context.Background(), u, ExtractInput{SourcePath: "/big.tar.gz"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusFailed || job.TotalBytes != 10 {
+		t.Fatalf("expected quota failure, got %+v", job)
+	}
+	if _, err := os.Stat(filepath.Join(userRoot, "big", "a.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected no extracted file, got %v", err)
+	}
+}
+
+func TestExtractServiceTarGzOverwriteAndSkip(t *testing.T) {
+	t.Parallel()
+
+	svc, u, userRoot := newExtractTestService(t, 0, nil)
+	writeExtractTestTarGz(t, filepath.Join(userRoot, "site.tgz"), map[string]string{
+		"index.html": "v2",
+		"css/a.css":  "body{}",
+	})
+	target := filepath.Join(userRoot, "www")
+	if err := os.MkdirAll(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(target, "index.html"), []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := svc.Start(context.Background(), u, ExtractInput{SourcePath: "/site.tgz", TargetPath: "/www"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusCompleted || job.Skipped != 1 {
+		t.Fatalf("expected skip policy by default, got %+v", job)
+	}
+	assertExtractedFile(t, filepath.Join(target, "index.html"), "v1")
+	assertExtractedFile(t, filepath.Join(target, "css", "a.css"), "body{}")
+
+	job, err = svc.Start(context.Background(), u, ExtractInput{SourcePath: "/site.tgz", TargetPath: "/www", Conflict: "overwrite"})
+	if err != nil {
+		t.Fatalf("start overwrite: %v", err)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusCompleted || job.Overwritten != 2 {
+		t.Fatalf("expected overwrite policy, got %+v", job)
+	}
+	assertExtractedFile(t, filepath.Join(target, "index.html"), "v2")
+	recycled, err := filepath.Glob(filepath.Join(filepath.Dir(userRoot), ".recycle", "*_index.html"))
+	if err != nil || len(recycled) != 1 {
+		t.Fatalf("expected the replaced file in the recycle bin, got %v (%v)", recycled, err)
+	}
+	assertExtractedFile(t, recycled[0], "v1")
+}
+
+func TestExtractServiceOverwriteRetainsVersions(t *testing.T) {
+	t.Parallel()
+
+	svc, u, userRoot := newExtractTestService(t, 0, nil)
+	svc.config.Versions.Enabled = true
+	svc.SetVersionService(NewVersionService(svc.config, allowPermissionChecker{}, svc.userRepo, nil, zap.NewNop()))
+	writeExtractTestZip(t, filepath.Join(userRoot, "site.zip"), map[string]string{"index.html": "v2"})
+	if err := os.WriteFile(filepath.Join(userRoot, "index.html"), []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := svc.Start(context.Background(), u, ExtractInput{SourcePath: "/site.zip", TargetPath: "/", Conflict: "overwrite"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusCompleted || job.Overwritten != 1 {
+		t.Fatalf("expected overwrite, got %+v", job)
+	}
+	assertExtractedFile(t, filepath.Join(userRoot, "index.html"), "v2")
+	versions, err := svc.versions.List(context.Background(), u, "/index.html")
+	if err != nil || len(versions) != 1 || versions[0].Source != VersionSourceExtract || versions[0].Size != 2 {
+		t.Fatalf("expected the replaced content as a version, got %+v (%v)", versions, err)
+	}
+	if used := storedUsedSpace(t, svc, u); used != 2 {
+		t.Fatalf("expected only the version copy to be charged, got %d", used)
+	}
+}
+
+func TestExtractServiceOverwriteRenamesWithoutRetention(t *testing.T) {
+	t.Parallel()
+
+	svc, u, userRoot := newExtractTestService(t, 0, nil)
+	svc.SetRecycleService(nil)
+	writeExtractTestZip(t, filepath.Join(userRoot, "site.zip"), map[string]string{"index.html": "v2"})
+	if err := os.WriteFile(filepath.Join(userRoot, "index.html"), []byte("v1"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := svc.Start(context.Background(), u, ExtractInput{SourcePath: "/site.zip", TargetPath: "/", Conflict: "overwrite"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusCompleted || job.Renamed != 1 || job.Overwritten != 0 {
+		t.Fatalf("expected rename fallback, got %+v", job)
+	}
+	assertExtractedFile(t, filepath.Join(userRoot, "index.html"), "v1")
+}
+
+func TestExtractServiceStartValidation(t *testing.T) {
+	t.Parallel()
+
+	svc, u, userRoot := newExtractTestService(t, 0, nil)
+	if err := os.WriteFile(filepath.Join(userRoot, "notes.txt"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		input ExtractInput
+		want  error
+	}{
+		{name: "unsupported format", input: ExtractInput{SourcePath: "/notes.txt"}, want: ErrExtractInvalid},
+		{name: "bad conflict", input: ExtractInput{SourcePath: "/a.zip", Conflict: "merge"}, want: ErrExtractInvalid},
+		{name: "missing source", input: ExtractInput{SourcePath: "/missing.zip"}, want: os.ErrNotExist},
+		{name: "root source", input: ExtractInput{SourcePath: "/"}, want: ErrExtractInvalid},
+	}
+	for _, tt := range tests {
+		if _, err := svc.Start(context.Background(), u, tt.input); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestSanitizeExtractEntryName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "a/b.txt", want: "a/b.txt"},
+		{raw: "./a//b/../c.txt", want: "a/c.txt"},
+		{raw: "dir\\file.txt", want: "dir/file.txt"},
+		{raw: "./", want: ""},
+		{raw: "../x", wantErr: true},
+		{raw: "a/../../x", wantErr: true},
+		{raw: "/etc/passwd", wantErr: true},
+		{raw: "C:\\Windows\\x", wantErr: true},
+		{raw: "..\\x", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sanitizeExtractEntryName(pathname.Policy{}, tt.raw)
+		if tt.wantErr {
+			if !errors.Is(err, ErrExtractUnsafeEntry) {
+				t.Fatalf("sanitizeExtractEntryName(%q): expected unsafe error, got %q, %v", tt.raw, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("sanitizeExtractEntryName(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func newExtractTestService(t *testing.T, quotaBytes int64, recorder MutationRecorder) (*ExtractService, *user.User, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	cfg := &config.Config{WebDAV: config.WebDAVConfig{Prefix: "/dav", Directory: root}}
+	userRepo := newTestUserRepo()
+	u := user.NewUser("alice", "alice")
+	u.Permissions = user.FullPermissions()
+	u.Quota = quotaBytes
+	if err := userRepo.Save(context.Background(), u); err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	userRoot := filepath.Join(root, "alice")
+	if err := os.MkdirAll(userRoot, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewExtractService(cfg, allowPermissionChecker{}, quota.NewService(userRepo), userRepo, recorder, zap.NewNop())
+	svc.SetRecycleService(NewRecycleService(&testRecycleRepo{}, userRepo, recorder, cfg, zap.NewNop()))
+	return svc, u, userRoot
+}
+
+func waitExtractJob(t *testing.T, svc *ExtractService, u *user.User, id string) *ExtractJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := svc.Get(context.Background(), u, id)
+		if err != nil {
+			t.Fatalf("get job: %v", err)
+		}
+		if job.Done() {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("extract job %s did not finish", id)
+	return nil
+}
+
+func storedUsedSpace(t *testing.T, svc *ExtractService, u *user.User) int64 {
+	t.Helper()
+
+	stored, err := svc.userRepo.FindByID(context.Background(), u.ID)
+	if err != nil {
+		t.Fatalf("find user: %v", err)
+	}
+	return stored.UsedSpace
+}
+
+func assertExtractedFile(t *testing.T, fullPath, want string) {
+	t.Helper()
+
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatalf("read %s: %v", fullPath, err)
+	}
+	if string(data) != want {
+		t.Fatalf("%s = %q, want %q", fullPath, string(data), want)
+	}
+}
+
+func writeExtractTestZip(t *testing.T, fullPath string, files map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range sortedKeys(files) {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeExtractTestTarGz(t *testing.T, fullPath string, files map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, name := range sortedKeys(files) {
+		body := files[name]
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(body)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fullPath, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/yeying-community/warehouse/internal/domain/group"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
@@ -51,6 +53,7 @@ func (s *GroupService) CreateGroup(ctx context.Context, u *user.User, name strin
 			return nil, err
 		}
 		ownerMember.Status = group.MemberStatusActive
+		ownerMember.Role = group.RoleOwner
 	}
 	if err := s.repo.CreateGroup(ctx, grp, ownerMember); err != nil {
 		return nil, err
@@ -66,8 +69,25 @@ func (s *GroupService) RenameGroup(ctx context.Context, u *user.User, groupID, n
 	return s.repo.UpdateGroupName(ctx, u.ID, groupID, name)
 }
 
+// DeleteGroup 删除分组；成员记录随分组级联删除，删除前记录成员以便清理邀请通知
 func (s *GroupService) DeleteGroup(ctx context.Context, u *user.User, groupID string) error {
-	return s.repo.DeleteGroup(ctx, u.ID, groupID)
+	grp, err := s.repo.GetGroupByID(ctx, u.ID, groupID)
+	if err != nil {
+		return err
+	}
+	members, err := s.groupMembers(ctx, u, grp.ID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteGroup(ctx, u.ID, grp.ID); err != nil {
+		return err
+	}
+	if s.notification != nil {
+		for _, member := range members {
+			s.notification.NotifyGroupMemberRemoved(ctx, u, member, grp, true)
+		}
+	}
+	return nil
 }
 
 func (s *GroupService) ListMembers(ctx context.Context, u *user.User) ([]*group.Member, error) {
@@ -243,8 +263,257 @@ func (s *GroupService) findVisibleMember(ctx context.Context, u *user.User, id s
 	return nil, group.ErrMemberNotFound
 }
 
+// DeleteMember 移除成员：owner 可移除任何非 owner 成员，admin 只能移除普通成员；
+// 移除自己等同于退出分组
 func (s *GroupService) DeleteMember(ctx context.Context, u *user.User, id string) error {
-	return s.repo.DeleteMember(ctx, u.ID, id)
+	member, err := s.findVisibleMember(ctx, u, strings.TrimSpace(id))
+	if err != nil {
+		return err
+	}
+	if isOwnMember(u, member) {
+		return s.LeaveGroup(ctx, u, member.GroupID)
+	}
+	grp, err := s.repo.GetVisibleGroupByID(ctx, u.ID, u.WalletAddress, member.GroupID)
+	if err != nil {
+		return err
+	}
+	if !group.CanRemove(grp.Role, member.Role) {
+		return group.ErrGroupPermissionDenied
+	}
+	if err := s.repo.RemoveGroupMember(ctx, grp.ID, member.ID); err != nil {
+		return err
+	}
+	if s.notification != nil {
+		s.notification.NotifyGroupMemberRemoved(ctx, u, member, grp, false)
+	}
+	return nil
+}
+
+// LeaveGroup 当前用户退出分组；owner 需先转让所有权
+func (s *GroupService) LeaveGroup(ctx context.Context, u *user.User, groupID string) error {
+	groupID = strings.TrimSpace(groupID)
+	if groupID == "" {
+		return fmt.Errorf("group id is required")
+	}
+	grp, err := s.repo.GetVisibleGroupByID(ctx, u.ID, u.WalletAddress, groupID)
+	if err != nil {
+		return err
+	}
+	if grp.UserID == u.ID {
+		return group.ErrOwnerCannotLeave
+	}
+	members, err := s.repo.ListVisibleMembers(ctx, u.ID, u.WalletAddress)
+	if err != nil {
+		return err
+	}
+	var self *group.Member
+	for _, member := range members {
+		if member.GroupID == grp.ID && isOwnMember(u, member) && group.NormalizeMemberStatus(member.Status) == group.MemberStatusActive {
+			self = member
+			break
+		}
+	}
+	if self == nil {
+		return group.ErrMemberNotFound
+	}
+	if err := s.repo.RemoveGroupMember(ctx, grp.ID, self.ID); err != nil {
+		return err
+	}
+	if s.notification != nil {
+		s.notification.NotifyGroupMemberLeft(ctx, u, grp)
+	}
+	return nil
+}
+
+// UpdateMemberRole 由 owner 设置 active 成员的角色（admin / member），可以有多个 admin
+func (s *GroupService) UpdateMemberRole(ctx context.Context, u *user.User, id, role string) (*group.Member, error) {
+	role, err := group.NormalizeMemberRole(role)
+	if err != nil {
+		return nil, err
+	}
+	if role == group.RoleOwner {
+		// owner 只能通过转让产生，保证分组始终只有一个 owner
+		return nil, group.ErrInvalidMemberRole
+	}
+	member, err := s.findVisibleMember(ctx, u, strings.TrimSpace(id))
+	if err != nil {
+		return nil, err
+	}
+	grp, err := s.repo.GetVisibleGroupByID(ctx, u.ID, u.WalletAddress, member.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if grp.Role != group.RoleOwner {
+		return nil, group.ErrGroupPermissionDenied
+	}
+	if member.Role == group.RoleOwner || group.NormalizeMemberStatus(member.Status) != group.MemberStatusActive {
+		return nil, group.ErrInvalidMemberRole
+	}
+	if member.Role == role {
+		return member, nil
+	}
+	if err := s.repo.UpdateMemberRole(ctx, grp.ID, member.ID, role); err != nil {
+		return nil, err
+	}
+	member.Role = role
+	if s.notification != nil {
+		s.notification.NotifyGroupRoleChanged(ctx, u, member, grp)
+	}
+	return member, nil
+}
+
+// TransferOwnership 把分组所有权转给另一位已注册的 active 成员，原所有者成为 admin
+func (s *GroupService) TransferOwnership(ctx context.Context, u *user.User, groupID, memberID string) (*group.Group, error) {
+	grp, err := s.repo.GetGroupByID(ctx, u.ID, strings.TrimSpace(groupID))
+	if err != nil {
+		return nil, err
+	}
+	member, err := s.findVisibleMember(ctx, u, strings.TrimSpace(memberID))
+	if err != nil {
+		return nil, err
+	}
+	if member.GroupID != grp.ID || member.Role == group.RoleOwner || group.NormalizeMemberStatus(member.Status) != group.MemberStatusActive {
+		return nil, group.ErrInvalidTransferTarget
+	}
+	if s.userRepo == nil {
+		return nil, fmt.Errorf("user repository is required")
+	}
+	target, err := s.userRepo.FindByWalletAddress(ctx, member.WalletAddress)
+	if err != nil {
+		if errors.Is(err, user.ErrUserNotFound) {
+			return nil, group.ErrInvalidTransferTarget
+		}
+		return nil, err
+	}
+	if target.ID == u.ID {
+		return nil, group.ErrInvalidTransferTarget
+	}
+	if err := s.repo.TransferGroupOwnership(ctx, grp.ID, u.ID, target.ID, member.ID); err != nil {
+		return nil, err
+	}
+	grp.UserID = target.ID
+	grp.Role = ""
+	if isOwnMemberWallet(u) {
+		grp.Role = group.RoleAdmin
+	}
+	if s.notification != nil {
+		s.notification.NotifyGroupOwnershipTransferred(ctx, u, target, grp)
+	}
+	return grp, nil
+}
+
+// CreateInviteLink 由 owner / admin 创建限时邀请码；有效期字段与分享一致，
+// 未指定时默认 7 天，最长 30 天；maxUses 为 0 表示不限次数
+func (s *GroupService) CreateInviteLink(ctx context.Context, u *user.User, groupID string, expiry ShareExpiryInput, maxUses int) (*group.InviteLink, error) {
+	grp, err := s.manageableGroup(ctx, u, groupID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	expiresAt, err := expiry.Resolve(now)
+	if err != nil {
+		return nil, err
+	}
+	var ttl time.Duration
+	if expiresAt != nil {
+		if ttl = expiresAt.Sub(now); ttl <= 0 {
+			return nil, group.ErrInvalidInviteLink
+		}
+	}
+	link, err := group.NewInviteLink(grp.ID, u.ID, ttl, maxUses)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.CreateInviteLink(ctx, link); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// ListInviteLinks 列出分组的邀请码（含已过期的记录）
+func (s *GroupService) ListInviteLinks(ctx context.Context, u *user.User, groupID string) ([]*group.InviteLink, error) {
+	grp, err := s.manageableGroup(ctx, u, groupID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListInviteLinks(ctx, grp.ID)
+}
+
+// RevokeInviteLink 撤销邀请码，已加入的成员不受影响
+func (s *GroupService) RevokeInviteLink(ctx context.Context, u *user.User, groupID, linkID string) error {
+	grp, err := s.manageableGroup(ctx, u, groupID)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteInviteLink(ctx, grp.ID, strings.TrimSpace(linkID))
+}
+
+// JoinByInvite 使用邀请码直接以 active 成员加入分组，无需再次确认；
+// 已有待确认的邀请时直接激活该邀请
+func (s *GroupService) JoinByInvite(ctx context.Context, u *user.User, code string) (*group.Group, *group.Member, error) {
+	code = group.NormalizeInviteCode(code)
+	if code == "" {
+		return nil, nil, group.ErrInviteLinkNotFound
+	}
+	if strings.TrimSpace(u.WalletAddress) == "" {
+		return nil, nil, fmt.Errorf("wallet address is required to join a group")
+	}
+	// 分组、所有者与最终的成员 ID 由仓储在兑换邀请码时填写
+	member := &group.Member{
+		ID:            uuid.NewString(),
+		Name:          defaultMemberName(u),
+		WalletAddress: strings.ToLower(strings.TrimSpace(u.WalletAddress)),
+		CreatedAt:     time.Now(),
+	}
+	grp, err := s.repo.RedeemInviteLink(ctx, code, member, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+	if s.notification != nil {
+		s.notification.DismissGroupInvite(ctx, u, member.ID)
+		s.notification.NotifyGroupMemberJoined(ctx, u, grp)
+	}
+	return grp, member, nil
+}
+
+func (s *GroupService) manageableGroup(ctx context.Context, u *user.User, groupID string) (*group.Group, error) {
+	groupID = strings.TrimSpace(groupID)
+	if groupID == "" {
+		return nil, fmt.Errorf("group id is required")
+	}
+	grp, err := s.repo.GetVisibleGroupByID(ctx, u.ID, u.WalletAddress, groupID)
+	if err != nil {
+		return nil, err
+	}
+	if !group.CanManageMembers(grp.Role) {
+		return nil, group.ErrGroupPermissionDenied
+	}
+	return grp, nil
+}
+
+func (s *GroupService) groupMembers(ctx context.Context, u *user.User, groupID string) ([]*group.Member, error) {
+	members, err := s.repo.ListVisibleMembers(ctx, u.ID, u.WalletAddress)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*group.Member, 0, len(members))
+	for _, member := range members {
+		if member.GroupID == groupID {
+			result = append(result, member)
+		}
+	}
+	return result, nil
+}
+
+func isOwnMember(u *user.User, member *group.Member) bool {
+	if !isOwnMemberWallet(u) || member == nil {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(u.WalletAddress), strings.TrimSpace(member.WalletAddress))
+}
+
+func isOwnMemberWallet(u *user.User) bool {
+	return u != nil && strings.TrimSpace(u.WalletAddress) != ""
 }
 
 func (s *GroupService) ApproveMember(ctx context.Context, u *user.User, id, name string) error {
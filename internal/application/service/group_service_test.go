@@ -5,6 +5,7 @@ import (
 	"errors"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/yeying-community/warehouse/internal/domain/group"
 	"github.com/yeying-community/warehouse/internal/domain/user"
@@ -457,6 +458,201 @@ func TestGroupServiceMemberAliasIsViewerPrivate(t *testing.T) {
 	}
 }
 
+func TestGroupServiceRolesControlMemberRemoval(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeGroupRepository()
+	svc := NewGroupService(repo, newTestUserRepo())
+	owner := &user.User{ID: "owner-user", WalletAddress: "0x1111111111111111111111111111111111111111"}
+	alice := &user.User{ID: "alice", WalletAddress: "0x2222222222222222222222222222222222222222"}
+	bob := &user.User{ID: "bob", WalletAddress: "0x3333333333333333333333333333333333333333"}
+	carol := &user.User{ID: "carol", WalletAddress: "0x4444444444444444444444444444444444444444"}
+
+	grp, err := svc.CreateGroup(ctx, owner, "team")
+	if err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	aliceMember := joinTestGroup(t, svc, owner, grp.ID, alice)
+	bobMember := joinTestGroup(t, svc, owner, grp.ID, bob)
+	carolMember := joinTestGroup(t, svc, owner, grp.ID, carol)
+
+	for _, id := range []string{aliceMember.ID, bobMember.ID} {
+		if _, err := svc.UpdateMemberRole(ctx, owner, id, group.RoleAdmin); err != nil {
+			t.Fatalf("UpdateMemberRole(admin) error = %v", err)
+		}
+	}
+	if _, err := svc.UpdateMemberRole(ctx, alice, carolMember.ID, group.RoleAdmin); err != group.ErrGroupPermissionDenied {
+		t.Fatalf("UpdateMemberRole(by admin) error = %v, want %v", err, group.ErrGroupPermissionDenied)
+	}
+	if _, err := svc.UpdateMemberRole(ctx, owner, carolMember.ID, group.RoleOwner); err != group.ErrInvalidMemberRole {
+		t.Fatalf("UpdateMemberRole(owner) error = %v, want %v", err, group.ErrInvalidMemberRole)
+	}
+
+	if err := svc.DeleteMember(ctx, carol, bobMember.ID); err != group.ErrGroupPermissionDenied {
+		t.Fatalf("DeleteMember(member removes admin) error = %v, want %v", err, group.ErrGroupPermissionDenied)
+	}
+	if err := svc.DeleteMember(ctx, alice, bobMember.ID); err != group.ErrGroupPermissionDenied {
+		t.Fatalf("DeleteMember(admin removes admin) error = %v, want %v", err, group.ErrGroupPermissionDenied)
+	}
+	if err := svc.DeleteMember(ctx, alice, carolMember.ID); err != nil {
+		t.Fatalf("DeleteMember(admin removes member) error = %v", err)
+	}
+	if _, ok := repo.members[carolMember.ID]; ok {
+		t.Fatal("removed member is still stored")
+	}
+	if err := svc.DeleteMember(ctx, owner, bobMember.ID); err != nil {
+		t.Fatalf("DeleteMember(owner removes admin) error = %v", err)
+	}
+	groups, err := svc.ListGroups(ctx, bob)
+	if err != nil {
+		t.Fatalf("ListGroups(bob) error = %v", err)
+	}
+	if len(groups) != 0 {
+		t.Fatalf("removed admin still sees %d groups", len(groups))
+	}
+}
+
+func TestGroupServiceLeaveAndTransferOwnership(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeGroupRepository()
+	userRepo := newTestUserRepo()
+	svc := NewGroupService(repo, userRepo)
+	owner := &user.User{ID: "owner-user", WalletAddress: "0x1111111111111111111111111111111111111111"}
+	alice := &user.User{ID: "alice", Username: "alice", WalletAddress: "0x2222222222222222222222222222222222222222"}
+	bob := &user.User{ID: "bob", Username: "bob", WalletAddress: "0x3333333333333333333333333333333333333333"}
+	if err := userRepo.Save(ctx, alice); err != nil {
+		t.Fatalf("Save(alice) error = %v", err)
+	}
+
+	grp, err := svc.CreateGroup(ctx, owner, "team")
+	if err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	aliceMember := joinTestGroup(t, svc, owner, grp.ID, alice)
+	bobMember := joinTestGroup(t, svc, owner, grp.ID, bob)
+
+	if err := svc.LeaveGroup(ctx, owner, grp.ID); err != group.ErrOwnerCannotLeave {
+		t.Fatalf("LeaveGroup(owner) error = %v, want %v", err, group.ErrOwnerCannotLeave)
+	}
+	if _, err := svc.TransferOwnership(ctx, owner, grp.ID, bobMember.ID); err != group.ErrInvalidTransferTarget {
+		t.Fatalf("TransferOwnership(unregistered) error = %v, want %v", err, group.ErrInvalidTransferTarget)
+	}
+	if _, err := svc.TransferOwnership(ctx, alice, grp.ID, aliceMember.ID); err != group.ErrGroupNotFound {
+		t.Fatalf("TransferOwnership(by member) error = %v, want %v", err, group.ErrGroupNotFound)
+	}
+
+	transferred, err := svc.TransferOwnership(ctx, owner, grp.ID, aliceMember.ID)
+	if err != nil {
+		t.Fatalf("TransferOwnership() error = %v", err)
+	}
+	if transferred.UserID != alice.ID || transferred.Role != group.RoleAdmin {
+		t.Fatalf("transferred group owner=%q role=%q, want alice/admin", transferred.UserID, transferred.Role)
+	}
+	visible, err := svc.repo.GetVisibleGroupByID(ctx, alice.ID, alice.WalletAddress, grp.ID)
+	if err != nil || visible.Role != group.RoleOwner {
+		t.Fatalf("new owner role = %v, %v; want owner", visible, err)
+	}
+	for _, member := range repo.members {
+		if member.UserID != alice.ID {
+			t.Fatalf("member %s still belongs to previous owner", member.ID)
+		}
+	}
+
+	if err := svc.LeaveGroup(ctx, owner, grp.ID); err != nil {
+		t.Fatalf("LeaveGroup(previous owner) error = %v", err)
+	}
+	if err := svc.LeaveGroup(ctx, bob, grp.ID); err != nil {
+		t.Fatalf("LeaveGroup(member) error = %v", err)
+	}
+	for _, member := range repo.members {
+		if member.ID != aliceMember.ID {
+			t.Fatalf("member %s remains after leaving", member.WalletAddress)
+		}
+	}
+}
+
+func TestGroupServiceJoinByInviteCode(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeGroupRepository()
+	svc := NewGroupService(repo, newTestUserRepo())
+	owner := &user.User{ID: "owner-user", WalletAddress: "0x1111111111111111111111111111111111111111"}
+	member := &user.User{ID: "member", WalletAddress: "0x2222222222222222222222222222222222222222"}
+	dave := &user.User{ID: "dave", Username: "dave", WalletAddress: "0x3333333333333333333333333333333333333333"}
+	erin := &user.User{ID: "erin", WalletAddress: "0x4444444444444444444444444444444444444444"}
+	frank := &user.User{ID: "frank", WalletAddress: "0x5555555555555555555555555555555555555555"}
+
+	grp, err := svc.CreateGroup(ctx, owner, "team")
+	if err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	joinTestGroup(t, svc, owner, grp.ID, member)
+	if _, err := svc.CreateInviteLink(ctx, member, grp.ID, ShareExpiryInput{}, 0); err != group.ErrGroupPermissionDenied {
+		t.Fatalf("CreateInviteLink(member) error = %v, want %v", err, group.ErrGroupPermissionDenied)
+	}
+	if _, err := svc.CreateInviteLink(ctx, owner, grp.ID, ShareExpiryInput{ExpiresValue: 31, ExpiresUnit: "day"}, 0); err != group.ErrInvalidInviteLink {
+		t.Fatalf("CreateInviteLink(too long) error = %v, want %v", err, group.ErrInvalidInviteLink)
+	}
+
+	link, err := svc.CreateInviteLink(ctx, owner, grp.ID, ShareExpiryInput{}, 1)
+	if err != nil {
+		t.Fatalf("CreateInviteLink() error = %v", err)
+	}
+	if ttl := time.Until(link.ExpiresAt); ttl <= 6*24*time.Hour || ttl > group.DefaultInviteLinkTTL {
+		t.Fatalf("default invite link ttl = %s, want about %s", ttl, group.DefaultInviteLinkTTL)
+	}
+	joinedGroup, joined, err := svc.JoinByInvite(ctx, dave, strings.ToLower(link.Code))
+	if err != nil {
+		t.Fatalf("JoinByInvite() error = %v", err)
+	}
+	if joinedGroup.ID != grp.ID || joined.Status != group.MemberStatusActive || joined.Name != "dave" {
+		t.Fatalf("joined = %+v in %s, want active dave in %s", joined, joinedGroup.ID, grp.ID)
+	}
+	if _, _, err := svc.JoinByInvite(ctx, erin, link.Code); err != group.ErrInviteLinkExpired {
+		t.Fatalf("JoinByInvite(used up) error = %v, want %v", err, group.ErrInviteLinkExpired)
+	}
+
+	pending, err := svc.CreateMember(ctx, owner, CreateMemberInput{Target: frank.WalletAddress, GroupID: grp.ID})
+	if err != nil {
+		t.Fatalf("CreateMember(frank) error = %v", err)
+	}
+	reusable, err := svc.CreateInviteLink(ctx, owner, grp.ID, ShareExpiryInput{ExpiresIn: 3600}, 0)
+	if err != nil {
+		t.Fatalf("CreateInviteLink(reusable) error = %v", err)
+	}
+	_, activated, err := svc.JoinByInvite(ctx, frank, reusable.Code)
+	if err != nil {
+		t.Fatalf("JoinByInvite(pending) error = %v", err)
+	}
+	if activated.ID != pending.ID || repo.members[pending.ID].Status != group.MemberStatusActive {
+		t.Fatalf("pending invite was not activated: %+v", repo.members[pending.ID])
+	}
+	if _, _, err := svc.JoinByInvite(ctx, frank, reusable.Code); err != group.ErrDuplicateMember {
+		t.Fatalf("JoinByInvite(again) error = %v, want %v", err, group.ErrDuplicateMember)
+	}
+
+	repo.links[reusable.ID].ExpiresAt = time.Now().Add(-time.Minute)
+	if _, _, err := svc.JoinByInvite(ctx, erin, reusable.Code); err != group.ErrInviteLinkExpired {
+		t.Fatalf("JoinByInvite(expired) error = %v, want %v", err, group.ErrInviteLinkExpired)
+	}
+	if err := svc.RevokeInviteLink(ctx, owner, grp.ID, reusable.ID); err != nil {
+		t.Fatalf("RevokeInviteLink() error = %v", err)
+	}
+	if _, _, err := svc.JoinByInvite(ctx, erin, reusable.Code); err != group.ErrInviteLinkNotFound {
+		t.Fatalf("JoinByInvite(revoked) error = %v, want %v", err, group.ErrInviteLinkNotFound)
+	}
+}
+
+func joinTestGroup(t *testing.T, svc *GroupService, owner *user.User, groupID string, target *user.User) *group.Member {
+	t.Helper()
+	member, err := svc.CreateMember(context.Background(), owner, CreateMemberInput{Target: target.WalletAddress, GroupID: groupID})
+	if err != nil {
+		t.Fatalf("CreateMember(%s) error = %v", target.ID, err)
+	}
+	if err := svc.ApproveMember(context.Background(), target, member.ID, target.ID); err != nil {
+		t.Fatalf("ApproveMember(%s) error = %v", target.ID, err)
+	}
+	return member
+}
+
 func findTestMemberAlias(members []*group.Member, id string) string {
 	for _, member := range members {
 		if member.ID == id {
@@ -470,6 +666,7 @@ type fakeGroupRepository struct {
 	groups  map[string]*group.Group
 	members map[string]*group.Member
 	aliases map[string]string
+	links   map[string]*group.InviteLink
 }
 
 func newFakeGroupRepository() *fakeGroupRepository {
@@ -477,6 +674,7 @@ func newFakeGroupRepository() *fakeGroupRepository {
 		groups:  make(map[string]*group.Group),
 		members: make(map[string]*group.Member),
 		aliases: make(map[string]string),
+		links:   make(map[string]*group.InviteLink),
 	}
 }
 
@@ -493,7 +691,10 @@ func (r *fakeGroupRepository) GetGroupByID(_ context.Context, userID, groupID st
 	if !ok || grp.UserID != userID {
 		return nil, group.ErrGroupNotFound
 	}
-	return cloneGroup(grp), nil
+	copied := cloneGroup(grp)
+	copied.CanInvite = true
+	copied.Role = group.RoleOwner
+	return copied, nil
 }
 
 func (r *fakeGroupRepository) GetVisibleGroupByID(_ context.Context, userID, walletAddress, groupID string) (*group.Group, error) {
@@ -504,12 +705,14 @@ func (r *fakeGroupRepository) GetVisibleGroupByID(_ context.Context, userID, wal
 	if grp.UserID == userID {
 		copied := cloneGroup(grp)
 		copied.CanInvite = true
+		copied.Role = group.RoleOwner
 		return copied, nil
 	}
 	for _, member := range r.members {
 		if member.GroupID == groupID && strings.EqualFold(member.WalletAddress, walletAddress) {
 			copied := cloneGroup(grp)
 			copied.CanInvite = r.isActiveGroupMember(groupID, walletAddress)
+			copied.Role = r.activeMemberRole(groupID, walletAddress)
 			return copied, nil
 		}
 	}
@@ -522,6 +725,7 @@ func (r *fakeGroupRepository) ListVisibleGroups(_ context.Context, userID, walle
 		if grp.UserID == userID {
 			copied := cloneGroup(grp)
 			copied.CanInvite = true
+			copied.Role = group.RoleOwner
 			groups = append(groups, copied)
 			continue
 		}
@@ -529,6 +733,7 @@ func (r *fakeGroupRepository) ListVisibleGroups(_ context.Context, userID, walle
 			if member.GroupID == grp.ID && member.Status == group.MemberStatusActive && strings.EqualFold(member.WalletAddress, walletAddress) {
 				copied := cloneGroup(grp)
 				copied.CanInvite = r.isActiveGroupMember(grp.ID, walletAddress)
+				copied.Role = r.activeMemberRole(grp.ID, walletAddress)
 				groups = append(groups, copied)
 				break
 			}
@@ -573,7 +778,8 @@ func (r *fakeGroupRepository) ListVisibleMembers(_ context.Context, userID, wall
 	for _, member := range r.members {
 		if member.UserID == userID ||
 			strings.EqualFold(member.WalletAddress, walletAddress) ||
-			(member.Status == group.MemberStatusActive && r.isActiveGroupMember(member.GroupID, walletAddress)) {
+			(member.Status == group.MemberStatusActive && r.isActiveGroupMember(member.GroupID, walletAddress)) ||
+			r.activeMemberRole(member.GroupID, walletAddress) == group.RoleAdmin {
 			copied := cloneMember(member)
 			copied.Alias = r.aliases[aliasKey(userID, member.ID)]
 			members = append(members, copied)
@@ -593,6 +799,20 @@ func (r *fakeGroupRepository) isActiveGroupMember(groupID, walletAddress string)
 	return false
 }
 
+func (r *fakeGroupRepository) activeMemberRole(groupID, walletAddress string) string {
+	for _, member := range r.members {
+		if member.GroupID == groupID &&
+			member.Status == group.MemberStatusActive &&
+			strings.EqualFold(member.WalletAddress, walletAddress) {
+			if member.Role == group.RoleAdmin || member.Role == group.RoleOwner {
+				return member.Role
+			}
+			return group.RoleMember
+		}
+	}
+	return ""
+}
+
 func (r *fakeGroupRepository) UpdateMember(_ context.Context, member *group.Member) error {
 	current, ok := r.members[member.ID]
 	if !ok || current.UserID != member.UserID {
@@ -655,6 +875,118 @@ func (r *fakeGroupRepository) DeleteMemberByWallet(_ context.Context, walletAddr
 	return nil
 }
 
+func (r *fakeGroupRepository) UpdateMemberRole(_ context.Context, groupID, memberID, role string) error {
+	member, ok := r.members[memberID]
+	if !ok || member.GroupID != groupID || member.Status != group.MemberStatusActive || member.Role == group.RoleOwner {
+		return group.ErrMemberNotFound
+	}
+	member.Role = role
+	return nil
+}
+
+func (r *fakeGroupRepository) RemoveGroupMember(_ context.Context, groupID, memberID string) error {
+	member, ok := r.members[memberID]
+	if !ok || member.GroupID != groupID {
+		return group.ErrMemberNotFound
+	}
+	delete(r.members, memberID)
+	return nil
+}
+
+func (r *fakeGroupRepository) TransferGroupOwnership(_ context.Context, groupID, fromUserID, toUserID, toMemberID string) error {
+	grp, ok := r.groups[groupID]
+	if !ok {
+		return group.ErrGroupNotFound
+	}
+	if grp.UserID != fromUserID {
+		return group.ErrGroupPermissionDenied
+	}
+	target, ok := r.members[toMemberID]
+	if !ok || target.GroupID != groupID || target.Status != group.MemberStatusActive {
+		return group.ErrInvalidTransferTarget
+	}
+	for _, member := range r.members {
+		if member.GroupID != groupID {
+			continue
+		}
+		if member.Role == group.RoleOwner {
+			member.Role = group.RoleAdmin
+		}
+		member.UserID = toUserID
+	}
+	target.Role = group.RoleOwner
+	grp.UserID = toUserID
+	return nil
+}
+
+func (r *fakeGroupRepository) CreateInviteLink(_ context.Context, link *group.InviteLink) error {
+	copied := *link
+	r.links[link.ID] = &copied
+	return nil
+}
+
+func (r *fakeGroupRepository) ListInviteLinks(_ context.Context, groupID string) ([]*group.InviteLink, error) {
+	links := make([]*group.InviteLink, 0, len(r.links))
+	for _, link := range r.links {
+		if link.GroupID == groupID {
+			copied := *link
+			links = append(links, &copied)
+		}
+	}
+	return links, nil
+}
+
+func (r *fakeGroupRepository) DeleteInviteLink(_ context.Context, groupID, linkID string) error {
+	link, ok := r.links[linkID]
+	if !ok || link.GroupID != groupID {
+		return group.ErrInviteLinkNotFound
+	}
+	delete(r.links, linkID)
+	return nil
+}
+
+func (r *fakeGroupRepository) RedeemInviteLink(_ context.Context, code string, member *group.Member, now time.Time) (*group.Group, error) {
+	var link *group.InviteLink
+	for _, item := range r.links {
+		if item.Code == group.NormalizeInviteCode(code) {
+			link = item
+			break
+		}
+	}
+	if link == nil {
+		return nil, group.ErrInviteLinkNotFound
+	}
+	if !link.Usable(now) {
+		return nil, group.ErrInviteLinkExpired
+	}
+	grp, ok := r.groups[link.GroupID]
+	if !ok {
+		return nil, group.ErrInviteLinkNotFound
+	}
+	member.UserID = grp.UserID
+	member.GroupID = grp.ID
+	member.Status = group.MemberStatusActive
+	member.Role = group.RoleMember
+	for _, existing := range r.members {
+		if existing.GroupID != grp.ID || !strings.EqualFold(existing.WalletAddress, member.WalletAddress) {
+			continue
+		}
+		if existing.Status == group.MemberStatusActive {
+			return nil, group.ErrDuplicateMember
+		}
+		existing.Status = group.MemberStatusActive
+		member.ID = existing.ID
+	}
+	if _, ok := r.members[member.ID]; !ok {
+		r.members[member.ID] = cloneMember(member)
+	}
+	link.UsedCount++
+	copied := cloneGroup(grp)
+	copied.CanInvite = true
+	copied.Role = group.RoleMember
+	return copied, nil
+}
+
 func cloneGroup(grp *group.Group) *group.Group {
 	if grp == nil {
 		return nil
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/recycle"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+)
+
+// Job types shipped with the server.
+const (
+	// JobTypeFilesDelete moves the owner's paths to the recycle bin.
+	JobTypeFilesDelete = "files.delete"
+	// JobTypeRecycleClear empties the owner's recycle bin.
+	JobTypeRecycleClear = "recycle.clear"
+	// JobTypeRecycleRemove permanently deletes recycle bin items by hash.
+	JobTypeRecycleRemove = "recycle.remove"
+	// JobTypeQuotaRebuild recalculates used_space for one or all users.
+	JobTypeQuotaRebuild = "quota.rebuild"
+	// JobTypeShareReconcile backfills shared resources, grants and
+	// audience links from the legacy share tables.
+	JobTypeShareReconcile = "share.reconcile"
+)
+
+// FilesDeleteParams are the params of a files.delete job. Paths are
+// relative to the owner's root.
+type FilesDeleteParams struct {
+	Paths []string `json:"paths"`
+}
+
+// RecycleRemoveParams are the params of a recycle.remove job.
+type RecycleRemoveParams struct {
+	Hashes []string `json:"hashes"`
+}
+
+// QuotaRebuildParams are the params of a quota.rebuild job; an empty
+// username rebuilds every user.
+type QuotaRebuildParams struct {
+	Username string `json:"username,omitempty"`
+}
+
+// SharedResourceReconciler is implemented by the database layer.
+type SharedResourceReconciler interface {
+	ReconcileSharedResources(ctx context.Context) error
+}
+
+// FilesDeleteJob moves paths to the recycle bin in one batch.
+func FilesDeleteJob(webdav *WebDAVService) JobDefinition {
+	return JobDefinition{
+		Prepare: func(ctx context.Context, owner *user.User, raw json.RawMessage) (json.RawMessage, error) {
+			if owner == nil {
+				return nil, fmt.Errorf("%w: files.delete needs an owner", ErrJobInvalid)
+			}
+			var params FilesDeleteParams
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrJobInvalid, err)
+			}
+			paths, err := NormalizeBulkDeletePaths(params.Paths)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrJobInvalid, err)
+			}
+			return json.Marshal(FilesDeleteParams{Paths: paths})
+		},
+		Run: func(ctx context.Context, run *JobRun) (any, error) {
+			if run.Owner == nil {
+				return nil, fmt.Errorf("%w: files.delete needs an owner", ErrJobInvalid)
+			}
+			var params FilesDeleteParams
+			if err := run.Decode(&params); err != nil {
+				return nil, err
+			}
+			run.SetTotal(int64(len(params.Paths)))
+			result, err := webdav.DeleteToRecycle(ctx, run.Owner, params.Paths, func() { run.Advance(1) })
+			if err != nil {
+				if result == nil {
+					return nil, fmt.Errorf("%w: %v", ErrJobInvalid, err)
+				}
+				return result, err
+			}
+			if len(result.Failed) > 0 {
+				// Retrying would only repeat permission and storage errors
+				// for the remaining paths; report them instead.
+				return result, fmt.Errorf("%w: %d of %d paths could not be deleted", ErrJobInvalid, len(result.Failed), len(params.Paths))
+			}
+			return result, nil
+		},
+	}
+}
+
+// RecycleClearJob empties the owner's recycle bin.
+func RecycleClearJob(recycleSvc *RecycleService) JobDefinition {
+	return JobDefinition{
+		Run: func(ctx context.Context, run *JobRun) (any, error) {
+			if run.Owner == nil {
+				return nil, fmt.Errorf("%w: recycle.clear needs an owner", ErrJobInvalid)
+			}
+			deleted, err := recycleSvc.ClearWithProgress(ctx, run.Owner, func(total, done int) {
+				run.SetProgress(int64(done), int64(total))
+			})
+			return map[string]int{"deleted": deleted}, err
+		},
+	}
+}
+
+// RecycleRemoveJob permanently deletes the given recycle bin items.
+func RecycleRemoveJob(recycleSvc *RecycleService) JobDefinition {
+	return JobDefinition{
+		Prepare: func(ctx context.Context, owner *user.User, raw json.RawMessage) (json.RawMessage, error) {
+			var params RecycleRemoveParams
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrJobInvalid, err)
+			}
+			hashes := make([]string, 0, len(params.Hashes))
+			for _, hash := range params.Hashes {
+				if hash = strings.TrimSpace(hash); hash != "" {
+					hashes = append(hashes, hash)
+				}
+			}
+			if len(hashes) == 0 {
+				return nil, fmt.Errorf("%w: hashes is required", ErrJobInvalid)
+			}
+			if len(hashes) > MaxBulkDeletePaths {
+				return nil, fmt.Errorf("%w: at most %d hashes per request", ErrJobInvalid, MaxBulkDeletePaths)
+			}
+			return json.Marshal(RecycleRemoveParams{Hashes: hashes})
+		},
+		Run: func(ctx context.Context, run *JobRun) (any, error) {
+			if run.Owner == nil {
+				return nil, fmt.Errorf("%w: recycle.remove needs an owner", ErrJobInvalid)
+			}
+			var params RecycleRemoveParams
+			if err := run.Decode(&params); err != nil {
+				return nil, err
+			}
+			run.SetTotal(int64(len(params.Hashes)))
+			result := &BulkDeleteResult{}
+			for _, hash := range params.Hashes {
+				if err := ctx.Err(); err != nil {
+					return result, err
+				}
+				// Items already purged by an earlier attempt are gone from
+				// the repository and count as missing.
+				if err := recycleSvc.Remove(ctx, run.Owner, hash); err != nil {
+					if errors.Is(err, recycle.ErrRecycleItemNotFound) {
+						result.Missing++
+					} else {
+						result.Failed = append(result.Failed, BulkDeleteFailure{Path: hash, Error: err.Error()})
+					}
+				} else {
+					result.Deleted++
+				}
+				run.Advance(1)
+			}
+			if len(result.Failed) > 0 {
+				return result, fmt.Errorf("%w: %d of %d items could not be deleted", ErrJobInvalid, len(result.Failed), len(params.Hashes))
+			}
+			return result, nil
+		},
+	}
+}
+
+// QuotaRebuildJob recalculates used_space. Administrators only.
+func QuotaRebuildJob(reconciler *QuotaReconciler) JobDefinition {
+	return JobDefinition{
+		Admin: true,
+		Prepare: func(ctx context.Context, owner *user.User, raw json.RawMessage) (json.RawMessage, error) {
+			var params QuotaRebuildParams
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrJobInvalid, err)
+			}
+			params.Username = strings.TrimSpace(params.Username)
+			return json.Marshal(params)
+		},
+		Run: func(ctx context.Context, run *JobRun) (any, error) {
+			var params QuotaRebuildParams
+			if err := run.Decode(&params); err != nil {
+				return nil, err
+			}
+			return reconciler.Rebuild(ctx, params.Username, func(total, done int) {
+				run.SetProgress(int64(done), int64(total))
+			})
+		},
+	}
+}
+
+// ShareReconcileJob runs the shared resource backfill. Administrators only.
+func ShareReconcileJob(reconciler SharedResourceReconciler) JobDefinition {
+	return JobDefinition{
+		Admin: true,
+		Run: func(ctx context.Context, run *JobRun) (any, error) {
+			run.SetTotal(1)
+			if err := reconciler.ReconcileSharedResources(ctx); err != nil {
+				return nil, err
+			}
+			run.Advance(1)
+			return nil, nil
+		},
+	}
+}
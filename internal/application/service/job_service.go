@@ -0,0 +1,714 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrJobNotFound  = errors.New("job not found")
+	ErrJobInvalid   = errors.New("invalid job request")
+	ErrJobForbidden = errors.New("job access forbidden")
+	// ErrJobConflict is returned when a job is not in a state that allows
+	// the requested change, such as retrying a job that did not fail.
+	ErrJobConflict = errors.New("job state conflict")
+)
+
+const (
+	// MaxJobListLimit bounds one page of a job listing.
+	MaxJobListLimit = 200
+
+	// jobLease is how long a claimed job stays hidden from other workers
+	// without a heartbeat; a crashed worker's jobs become due afterwards.
+	jobLease = 2 * time.Minute
+	// jobHeartbeatInterval is how often progress is stored, the lease is
+	// extended and cancellation requests are picked up.
+	jobHeartbeatInterval = 5 * time.Second
+	// jobRetryDelay is multiplied by the attempt count between retries.
+	jobRetryDelay = 30 * time.Second
+	// jobCleanupInterval is how often finished jobs past retention are
+	// deleted.
+	jobCleanupInterval = time.Hour
+)
+
+// JobDefinition describes one job type.
+type JobDefinition struct {
+	// Admin restricts submission to administrators and the CLI.
+	Admin bool
+	// Prepare validates params on submission and returns the params to
+	// store. owner is nil for jobs submitted by an administrator. A nil
+	// Prepare accepts the params unchanged.
+	Prepare func(ctx context.Context, owner *user.User, params json.RawMessage) (json.RawMessage, error)
+	// Run executes the job. Its value is stored as the job result, also
+	// when Run fails or is canceled, so partial results stay visible.
+	// Errors wrapping ErrJobInvalid are not retried.
+	Run func(ctx context.Context, run *JobRun) (any, error)
+}
+
+// JobRun is the execution state handed to JobDefinition.Run.
+type JobRun struct {
+	ID     string
+	Type   string
+	Params json.RawMessage
+	// Owner is the submitting user, nil for administrator jobs.
+	Owner *user.User
+	// Attempt counts executions, starting at 1.
+	Attempt int
+
+	done  atomic.Int64
+	total atomic.Int64
+}
+
+// Decode unmarshals the job params into v.
+func (r *JobRun) Decode(v any) error {
+	if len(r.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(r.Params, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrJobInvalid, err)
+	}
+	return nil
+}
+
+// SetTotal sets the amount of work the job will do.
+func (r *JobRun) SetTotal(total int64) {
+	r.total.Store(total)
+}
+
+// Advance records n more units of finished work.
+func (r *JobRun) Advance(n int64) {
+	r.done.Add(n)
+}
+
+// SetProgress replaces both counters.
+func (r *JobRun) SetProgress(done, total int64) {
+	r.total.Store(total)
+	r.done.Store(done)
+}
+
+// Job is the API view of a background job.
+type Job struct {
+	ID              string          `json:"id"`
+	Type            string          `json:"type"`
+	OwnerUserID     string          `json:"ownerUserId,omitempty"`
+	CreatedBy       string          `json:"createdBy,omitempty"`
+	Status          string          `json:"status"`
+	Params          json.RawMessage `json:"params,omitempty"`
+	Result          json.RawMessage `json:"result,omitempty"`
+	ProgressDone    int64           `json:"progressDone"`
+	ProgressTotal   int64           `json:"progressTotal"`
+	Progress        float64         `json:"progress"`
+	Attempts        int             `json:"attempts"`
+	MaxAttempts     int             `json:"maxAttempts"`
+	Error           string          `json:"error,omitempty"`
+	CancelRequested bool            `json:"cancelRequested,omitempty"`
+	CreatedAt       time.Time       `json:"createdAt"`
+	UpdatedAt       time.Time       `json:"updatedAt"`
+	StartedAt       *time.Time      `json:"startedAt,omitempty"`
+	FinishedAt      *time.Time      `json:"finishedAt,omitempty"`
+}
+
+// JobListQuery filters a job listing.
+type JobListQuery struct {
+	// OwnerUserID is only honored for administrator listings.
+	OwnerUserID string
+	Type        string
+	Status      string
+	Limit       int
+	Offset      int
+}
+
+// JobPage is a page of jobs, newest first.
+type JobPage struct {
+	Items      []*Job `json:"items"`
+	HasMore    bool   `json:"hasMore"`
+	NextOffset int    `json:"nextOffset,omitempty"`
+}
+
+// JobService runs long operations as persistent background jobs. Jobs are
+// stored in the jobs table and executed by workers on non-standby nodes,
+// which lease them, report progress through heartbeats and stop when
+// cancellation is requested. Failed runs are retried up to
+// jobs.max_attempts times.
+type JobService struct {
+	config   *config.Config
+	repo     repository.JobRepository
+	userRepo user.Repository
+	logger   *zap.Logger
+	worker   string
+	now      func() time.Time
+
+	lease      time.Duration
+	heartbeat  time.Duration
+	retryDelay time.Duration
+
+	mu          sync.RWMutex
+	definitions map[string]JobDefinition
+}
+
+func NewJobService(cfg *config.Config, repo repository.JobRepository, userRepo user.Repository, logger *zap.Logger) *JobService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	worker := strings.TrimSpace(cfg.Node.ID)
+	if worker == "" {
+		worker, _ = os.Hostname()
+	}
+	return &JobService{
+		config:      cfg,
+		repo:        repo,
+		userRepo:    userRepo,
+		logger:      logger,
+		worker:      fmt.Sprintf("%s/%d", worker, os.Getpid()),
+		now:         time.Now,
+		lease:       jobLease,
+		heartbeat:   jobHeartbeatInterval,
+		retryDelay:  jobRetryDelay,
+		definitions: make(map[string]JobDefinition),
+	}
+}
+
+// Register adds a job type. Registering a type twice replaces it.
+func (s *JobService) Register(jobType string, def JobDefinition) {
+	if s == nil || def.Run == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.definitions[jobType] = def
+}
+
+// Types lists the registered job types users may submit, or all of them
+// for administrators.
+func (s *JobService) Types(admin bool) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	types := make([]string, 0, len(s.definitions))
+	for jobType, def := range s.definitions {
+		if admin || !def.Admin {
+			types = append(types, jobType)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Enabled reports whether this node executes jobs.
+func (s *JobService) Enabled() bool {
+	if s == nil || s.repo == nil {
+		return false
+	}
+	return !strings.EqualFold(strings.TrimSpace(s.config.Node.Role), "standby")
+}
+
+// Submit queues a job owned by u. App scope tokens cannot submit jobs:
+// jobs run outside the request and could not honor the token's scope.
+func (s *JobService) Submit(ctx context.Context, u *user.User, jobType string, params json.RawMessage) (*Job, error) {
+	if u == nil {
+		return nil, ErrJobForbidden
+	}
+	scope, err := resolveAppScope(ctx, s.config)
+	if err != nil {
+		return nil, err
+	}
+	if scope.active {
+		return nil, auth.ErrAppScopeDenied
+	}
+	def, ok := s.definition(jobType)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown job type %q", ErrJobInvalid, jobType)
+	}
+	if def.Admin {
+		return nil, ErrJobForbidden
+	}
+	params, err = s.prepare(ctx, def, u, params)
+	if err != nil {
+		return nil, err
+	}
+	return s.Enqueue(ctx, jobType, u.ID, u.Username, params)
+}
+
+// SubmitAdmin queues a job on behalf of an administrator.
+func (s *JobService) SubmitAdmin(ctx context.Context, createdBy, jobType string, params json.RawMessage) (*Job, error) {
+	def, ok := s.definition(jobType)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown job type %q", ErrJobInvalid, jobType)
+	}
+	params, err := s.prepare(ctx, def, nil, params)
+	if err != nil {
+		return nil, err
+	}
+	return s.Enqueue(ctx, jobType, "", createdBy, params)
+}
+
+// Enqueue stores a job without validating it; the worker fails jobs of
+// unknown types. The CLI uses it to hand work to the server.
+func (s *JobService) Enqueue(ctx context.Context, jobType, ownerUserID, createdBy string, params json.RawMessage) (*Job, error) {
+	if strings.TrimSpace(jobType) == "" {
+		return nil, fmt.Errorf("%w: type is required", ErrJobInvalid)
+	}
+	if len(params) == 0 {
+		params = json.RawMessage(`{}`)
+	}
+	if !json.Valid(params) {
+		return nil, fmt.Errorf("%w: params must be JSON", ErrJobInvalid)
+	}
+	now := s.now()
+	job := &repository.Job{
+		ID:          uuid.NewString(),
+		Type:        jobType,
+		OwnerUserID: ownerUserID,
+		CreatedBy:   createdBy,
+		Status:      repository.JobStatusQueued,
+		Params:      params,
+		MaxAttempts: s.maxAttempts(),
+		AvailableAt: now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.repo.Create(ctx, job); err != nil {
+		return nil, err
+	}
+	return newJobView(job), nil
+}
+
+// Get returns one of u's jobs.
+func (s *JobService) Get(ctx context.Context, u *user.User, id string) (*Job, error) {
+	job, err := s.ownedJob(ctx, u, id)
+	if err != nil {
+		return nil, err
+	}
+	return newJobView(job), nil
+}
+
+// List returns a page of u's jobs.
+func (s *JobService) List(ctx context.Context, u *user.User, query JobListQuery) (*JobPage, error) {
+	if u == nil {
+		return nil, ErrJobForbidden
+	}
+	query.OwnerUserID = u.ID
+	return s.list(ctx, query)
+}
+
+// Cancel requests cancellation of one of u's jobs. Queued jobs are
+// canceled right away, running ones at the worker's next heartbeat.
+func (s *JobService) Cancel(ctx context.Context, u *user.User, id string) (*Job, error) {
+	if _, err := s.ownedJob(ctx, u, id); err != nil {
+		return nil, err
+	}
+	return s.AdminCancel(ctx, id)
+}
+
+// AdminGet returns any job.
+func (s *JobService) AdminGet(ctx context.Context, id string) (*Job, error) {
+	job, err := s.repo.Get(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return newJobView(job), nil
+}
+
+// AdminList returns a page of all jobs, optionally of one owner.
+func (s *JobService) AdminList(ctx context.Context, query JobListQuery) (*JobPage, error) {
+	return s.list(ctx, query)
+}
+
+// AdminCancel requests cancellation of any job.
+func (s *JobService) AdminCancel(ctx context.Context, id string) (*Job, error) {
+	job, err := s.repo.RequestCancel(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	return newJobView(job), nil
+}
+
+// AdminRetry queues a failed or canceled job again from scratch.
+func (s *JobService) AdminRetry(ctx context.Context, id string) (*Job, error) {
+	id = strings.TrimSpace(id)
+	job, err := s.repo.Requeue(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job != nil {
+		return newJobView(job), nil
+	}
+	if _, err := s.AdminGet(ctx, id); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("%w: only failed or canceled jobs can be retried", ErrJobConflict)
+}
+
+// Run executes due jobs with up to jobs.workers running at once until ctx
+// is canceled, and deletes finished jobs past jobs.retention.
+func (s *JobService) Run(ctx context.Context) {
+	if !s.Enabled() {
+		return
+	}
+	cfg := s.config.Jobs
+	workers := max(1, cfg.Workers)
+	s.logger.Info("job worker started",
+		zap.String("worker", s.worker),
+		zap.Int("workers", workers),
+		zap.Duration("poll_interval", cfg.PollInterval))
+	defer s.logger.Info("job worker stopped")
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	slots := make(chan struct{}, workers)
+	freed := make(chan struct{}, 1)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var lastCleanup time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-freed:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		if s.now().Sub(lastCleanup) >= jobCleanupInterval {
+			lastCleanup = s.now()
+			s.cleanup(ctx)
+		}
+
+		wait := cfg.PollInterval
+		if free := workers - len(slots); free > 0 {
+			jobs, err := s.repo.Claim(ctx, s.worker, free, s.lease)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					s.logger.Warn("failed to claim jobs", zap.Error(err))
+				}
+			} else if len(jobs) == free {
+				// The queue may hold more; look again once a slot frees up.
+				wait = 0
+			}
+			for _, job := range jobs {
+				slots <- struct{}{}
+				wg.Add(1)
+				go func(job *repository.Job) {
+					defer wg.Done()
+					defer func() {
+						<-slots
+						// One pending wake-up is enough; never block on
+						// shutdown when the loop has stopped reading.
+						select {
+						case freed <- struct{}{}:
+						default:
+						}
+					}()
+					s.execute(ctx, job)
+				}(job)
+			}
+		}
+		if wait > 0 || len(slots) < workers {
+			timer.Reset(wait)
+		}
+	}
+}
+
+// ProcessJobs claims up to limit due jobs and runs them to completion. It
+// returns the number of jobs claimed.
+func (s *JobService) ProcessJobs(ctx context.Context, limit int) (int, error) {
+	jobs, err := s.repo.Claim(ctx, s.worker, limit, s.lease)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *repository.Job) {
+			defer wg.Done()
+			s.execute(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+	return len(jobs), nil
+}
+
+func (s *JobService) execute(ctx context.Context, job *repository.Job) {
+	logger := s.logger.With(zap.String("job_id", job.ID), zap.String("job_type", job.Type))
+	def, ok := s.definition(job.Type)
+	switch {
+	case !ok:
+		s.finish(ctx, job, repository.JobStatusFailed, nil, fmt.Sprintf("unknown job type %q", job.Type))
+		return
+	case job.CancelRequested:
+		s.finish(ctx, job, repository.JobStatusCanceled, job.Result, job.LastError)
+		return
+	case job.Attempts > job.MaxAttempts:
+		// The last attempt's worker stopped without reporting back.
+		s.finish(ctx, job, repository.JobStatusFailed, job.Result, "job did not finish within max attempts")
+		return
+	}
+
+	run := &JobRun{ID: job.ID, Type: job.Type, Params: job.Params, Attempt: job.Attempts}
+	if job.OwnerUserID != "" {
+		owner, err := s.userRepo.FindByID(ctx, job.OwnerUserID)
+		if err != nil {
+			s.finish(ctx, job, repository.JobStatusFailed, nil, fmt.Sprintf("load job owner: %v", err))
+			return
+		}
+		run.Owner = owner
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var canceled, lost atomic.Bool
+	heartbeat := func() {
+		cancelRequested, held, err := s.repo.Heartbeat(ctx, job.ID, s.worker, run.done.Load(), run.total.Load(), s.lease)
+		switch {
+		case err != nil:
+			if ctx.Err() == nil {
+				logger.Warn("job heartbeat failed", zap.Error(err))
+			}
+		case !held:
+			lost.Store(true)
+			cancel()
+		case cancelRequested:
+			canceled.Store(true)
+			cancel()
+		}
+	}
+	stopHeartbeat := make(chan struct{})
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		ticker := time.NewTicker(s.heartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopHeartbeat:
+				return
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+				heartbeat()
+			}
+		}
+	}()
+
+	logger.Info("job started", zap.Int("attempt", job.Attempts))
+	value, runErr := def.Run(runCtx, run)
+	close(stopHeartbeat)
+	<-heartbeatDone
+
+	if lost.Load() {
+		logger.Warn("job lease lost to another worker")
+		return
+	}
+	if ctx.Err() != nil {
+		// Shutting down: hand the job back so the next worker starts over.
+		// A detached context is used because ctx is already canceled.
+		bg, stop := context.WithTimeout(context.Background(), 5*time.Second)
+		defer stop()
+		if err := s.repo.Retry(bg, job.ID, s.worker, "interrupted by shutdown", 0); err != nil {
+			logger.Warn("failed to release interrupted job", zap.Error(err))
+		}
+		return
+	}
+	// Store the final counters before the terminal status.
+	heartbeat()
+	if lost.Load() {
+		return
+	}
+
+	result, err := marshalJobResult(value)
+	if err != nil {
+		logger.Warn("failed to encode job result", zap.Error(err))
+	}
+	switch {
+	case canceled.Load():
+		logger.Info("job canceled")
+		s.finish(ctx, job, repository.JobStatusCanceled, result, "")
+	case runErr == nil:
+		logger.Info("job completed")
+		s.finish(ctx, job, repository.JobStatusCompleted, result, "")
+	case errors.Is(runErr, ErrJobInvalid) || job.Attempts >= job.MaxAttempts:
+		logger.Warn("job failed", zap.Int("attempt", job.Attempts), zap.Error(runErr))
+		s.finish(ctx, job, repository.JobStatusFailed, result, runErr.Error())
+	default:
+		delay := time.Duration(job.Attempts) * s.retryDelay
+		logger.Warn("job attempt failed, retrying",
+			zap.Int("attempt", job.Attempts),
+			zap.Duration("delay", delay),
+			zap.Error(runErr))
+		if err := s.repo.Retry(ctx, job.ID, s.worker, runErr.Error(), delay); err != nil {
+			logger.Warn("failed to reschedule job", zap.Error(err))
+		}
+	}
+}
+
+func (s *JobService) finish(ctx context.Context, job *repository.Job, status string, result json.RawMessage, lastError string) {
+	if err := s.repo.Finish(ctx, job.ID, s.worker, status, result, lastError); err != nil {
+		s.logger.Warn("failed to finish job", zap.String("job_id", job.ID), zap.String("status", status), zap.Error(err))
+	}
+}
+
+func (s *JobService) cleanup(ctx context.Context) {
+	retention := s.config.Jobs.Retention
+	if retention <= 0 {
+		return
+	}
+	deleted, err := s.repo.DeleteFinishedOlderThan(ctx, retention)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			s.logger.Warn("failed to delete finished jobs", zap.Error(err))
+		}
+		return
+	}
+	if deleted > 0 {
+		s.logger.Info("finished jobs deleted", zap.Int64("count", deleted))
+	}
+}
+
+func (s *JobService) definition(jobType string) (JobDefinition, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	def, ok := s.definitions[strings.TrimSpace(jobType)]
+	return def, ok
+}
+
+func (s *JobService) prepare(ctx context.Context, def JobDefinition, owner *user.User, params json.RawMessage) (json.RawMessage, error) {
+	if len(params) == 0 || string(params) == "null" {
+		params = json.RawMessage(`{}`)
+	}
+	if !json.Valid(params) {
+		return nil, fmt.Errorf("%w: params must be JSON", ErrJobInvalid)
+	}
+	if def.Prepare == nil {
+		return params, nil
+	}
+	return def.Prepare(ctx, owner, params)
+}
+
+func (s *JobService) ownedJob(ctx context.Context, u *user.User, id string) (*repository.Job, error) {
+	if u == nil {
+		return nil, ErrJobForbidden
+	}
+	job, err := s.repo.Get(ctx, strings.TrimSpace(id))
+	if err != nil {
+		return nil, err
+	}
+	// Other users' jobs are reported as missing.
+	if job == nil || job.OwnerUserID != u.ID {
+		return nil, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *JobService) list(ctx context.Context, query JobListQuery) (*JobPage, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	if limit > MaxJobListLimit {
+		limit = MaxJobListLimit
+	}
+	if query.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrJobInvalid)
+	}
+	filter := repository.JobFilter{
+		OwnerUserID: query.OwnerUserID,
+		Type:        strings.TrimSpace(query.Type),
+		Limit:       limit + 1,
+		Offset:      query.Offset,
+	}
+	if status := strings.TrimSpace(query.Status); status != "" {
+		switch status {
+		case repository.JobStatusQueued, repository.JobStatusRunning, repository.JobStatusCompleted,
+			repository.JobStatusFailed, repository.JobStatusCanceled:
+			filter.Statuses = []string{status}
+		default:
+			return nil, fmt.Errorf("%w: unknown status %q", ErrJobInvalid, status)
+		}
+	}
+	jobs, err := s.repo.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &JobPage{Items: make([]*Job, 0, len(jobs))}
+	if len(jobs) > limit {
+		jobs = jobs[:limit]
+		page.HasMore = true
+		page.NextOffset = query.Offset + limit
+	}
+	for _, job := range jobs {
+		page.Items = append(page.Items, newJobView(job))
+	}
+	return page, nil
+}
+
+func (s *JobService) maxAttempts() int {
+	if s.config.Jobs.MaxAttempts > 0 {
+		return s.config.Jobs.MaxAttempts
+	}
+	return 3
+}
+
+func marshalJobResult(value any) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func newJobView(job *repository.Job) *Job {
+	view := &Job{
+		ID:              job.ID,
+		Type:            job.Type,
+		OwnerUserID:     job.OwnerUserID,
+		CreatedBy:       job.CreatedBy,
+		Status:          job.Status,
+		Params:          job.Params,
+		Result:          job.Result,
+		ProgressDone:    job.ProgressDone,
+		ProgressTotal:   job.ProgressTotal,
+		Attempts:        job.Attempts,
+		MaxAttempts:     job.MaxAttempts,
+		Error:           job.LastError,
+		CancelRequested: job.CancelRequested && !job.Terminal(),
+		CreatedAt:       job.CreatedAt,
+		UpdatedAt:       job.UpdatedAt,
+		StartedAt:       job.StartedAt,
+		FinishedAt:      job.FinishedAt,
+	}
+	switch {
+	case job.Status == repository.JobStatusCompleted:
+		view.Progress = 1
+	case job.ProgressTotal > 0:
+		view.Progress = math.Min(1, float64(job.ProgressDone)/float64(job.ProgressTotal))
+	}
+	return view
+}
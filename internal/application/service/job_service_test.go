@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/quota"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// memoryJobRepo keeps jobs in memory with the same state transitions as the
+// Postgres repository. Delays are ignored so retries are due right away.
+type memoryJobRepo struct {
+	mu   sync.Mutex
+	jobs map[string]*repository.Job
+}
+
+func newMemoryJobRepo() *memoryJobRepo {
+	return &memoryJobRepo{jobs: make(map[string]*repository.Job)}
+}
+
+func (r *memoryJobRepo) copyJob(job *repository.Job) *repository.Job {
+	copy := *job
+	return &copy
+}
+
+func (r *memoryJobRepo) Create(_ context.Context, job *repository.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs[job.ID] = r.copyJob(job)
+	return nil
+}
+
+func (r *memoryJobRepo) Get(_ context.Context, id string) (*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if job, ok := r.jobs[id]; ok {
+		return r.copyJob(job), nil
+	}
+	return nil, nil
+}
+
+func (r *memoryJobRepo) List(_ context.Context, filter repository.JobFilter) ([]*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var jobs []*repository.Job
+	for _, job := range r.jobs {
+		if filter.OwnerUserID != "" && job.OwnerUserID != filter.OwnerUserID {
+			continue
+		}
+		if filter.Type != "" && job.Type != filter.Type {
+			continue
+		}
+		if len(filter.Statuses) > 0 && job.Status != filter.Statuses[0] {
+			continue
+		}
+		jobs = append(jobs, r.copyJob(job))
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].CreatedAt.After(jobs[j].CreatedAt) })
+	if filter.Offset < len(jobs) {
+		jobs = jobs[filter.Offset:]
+	} else {
+		jobs = nil
+	}
+	if len(jobs) > filter.Limit {
+		jobs = jobs[:filter.Limit]
+	}
+	return jobs, nil
+}
+
+func (r *memoryJobRepo) Claim(_ context.Context, worker string, limit int, lease time.Duration) ([]*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var claimed []*repository.Job
+	for _, job := range r.jobs {
+		if len(claimed) >= limit {
+			break
+		}
+		due := job.Status == repository.JobStatusQueued ||
+			(job.Status == repository.JobStatusRunning && job.LeaseUntil != nil && job.LeaseUntil.Before(now))
+		if !due {
+			continue
+		}
+		until := now.Add(lease)
+		job.Status = repository.JobStatusRunning
+		job.Worker = worker
+		job.Attempts++
+		job.LeaseUntil = &until
+		if job.StartedAt == nil {
+			job.StartedAt = &now
+		}
+		claimed = append(claimed, r.copyJob(job))
+	}
+	return claimed, nil
+}
+
+func (r *memoryJobRepo) Heartbeat(_ context.Context, id, worker string, done, total int64, lease time.Duration) (bool, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok || job.Worker != worker || job.Status != repository.JobStatusRunning {
+		return false, false, nil
+	}
+	until := time.Now().Add(lease)
+	job.ProgressDone, job.ProgressTotal, job.LeaseUntil = done, total, &until
+	return job.CancelRequested, true, nil
+}
+
+func (r *memoryJobRepo) Finish(_ context.Context, id, worker, status string, result json.RawMessage, lastError string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok || job.Worker != worker || job.Status != repository.JobStatusRunning {
+		return nil
+	}
+	now := time.Now()
+	job.Status, job.Result, job.LastError, job.LeaseUntil, job.FinishedAt = status, result, lastError, nil, &now
+	return nil
+}
+
+func (r *memoryJobRepo) Retry(_ context.Context, id, worker, lastError string, _ time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok || job.Worker != worker || job.Status != repository.JobStatusRunning {
+		return nil
+	}
+	job.Status, job.LastError, job.LeaseUntil = repository.JobStatusQueued, lastError, nil
+	return nil
+}
+
+func (r *memoryJobRepo) RequestCancel(_ context.Context, id string) (*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	switch job.Status {
+	case repository.JobStatusQueued:
+		now := time.Now()
+		job.Status, job.FinishedAt, job.CancelRequested = repository.JobStatusCanceled, &now, true
+	case repository.JobStatusRunning:
+		job.CancelRequested = true
+	}
+	return r.copyJob(job), nil
+}
+
+func (r *memoryJobRepo) Requeue(_ context.Context, id string) (*repository.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	job, ok := r.jobs[id]
+	if !ok || (job.Status != repository.JobStatusFailed && job.Status != repository.JobStatusCanceled) {
+		return nil, nil
+	}
+	job.Status, job.Attempts, job.LastError, job.Result = repository.JobStatusQueued, 0, "", nil
+	job.CancelRequested, job.Worker, job.StartedAt, job.FinishedAt = false, "", nil, nil
+	return r.copyJob(job), nil
+}
+
+func (r *memoryJobRepo) DeleteFinishedOlderThan(_ context.Context, age time.Duration) (int64, error) {
+	t := time.Now().Add(-age)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var deleted int64
+	for id, job := range r.jobs {
+		if job.Terminal() && job.FinishedAt != nil && job.FinishedAt.Before(t) {
+			delete(r.jobs, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func newTestJobService(t *testing.T) (*JobService, *memoryJobRepo, *testUserRepo, *user.User) {
+	t.Helper()
+	cfg := &config.Config{Jobs: config.JobsConfig{Workers: 2, PollInterval: 10 * time.Millisecond, MaxAttempts: 2}}
+	repo := newMemoryJobRepo()
+	users := newTestUserRepo()
+	alice := user.NewUser("alice", "alice")
+	if err := users.Save(context.Background(), alice); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewJobService(cfg, repo, users, zap.NewNop())
+	svc.heartbeat = 5 * time.Millisecond
+	return svc, repo, users, alice
+}
+
+func TestJobServiceRunsSubmittedJob(t *testing.T) {
+	svc, _, users, alice := newTestJobService(t)
+	svc.Register("count", JobDefinition{
+		Prepare: func(_ context.Context, owner *user.User, params json.RawMessage) (json.RawMessage, error) {
+			if owner == nil {
+				return nil, ErrJobInvalid
+			}
+			return params, nil
+		},
+		Run: func(_ context.Context, run *JobRun) (any, error) {
+			var params struct{ N int }
+			if err := run.Decode(&params); err != nil {
+				return nil, err
+			}
+			run.SetTotal(int64(params.N))
+			for i := 0; i < params.N; i++ {
+				run.Advance(1)
+			}
+			return map[string]string{"owner": run.Owner.Username}, nil
+		},
+	})
+	ctx := context.Background()
+
+	job, err := svc.Submit(ctx, alice, "count", json.RawMessage(`{"N":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != repository.JobStatusQueued || job.MaxAttempts != 2 {
+		t.Fatalf("submitted job = %+v", job)
+	}
+	if n, err := svc.ProcessJobs(ctx, 10); err != nil || n != 1 {
+		t.Fatalf("processed %d jobs, err %v", n, err)
+	}
+	done, err := svc.Get(ctx, alice, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != repository.JobStatusCompleted || done.ProgressDone != 3 || done.ProgressTotal != 3 || done.Progress != 1 {
+		t.Fatalf("finished job = %+v", done)
+	}
+	if string(done.Result) != `{"owner":"alice"}` {
+		t.Fatalf("result = %s", done.Result)
+	}
+
+	// The job is invisible to other users.
+	bob := user.NewUser("bob", "bob")
+	_ = users.Save(ctx, bob)
+	if _, err := svc.Get(ctx, bob, job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("other user get err = %v", err)
+	}
+	if page, err := svc.List(ctx, bob, JobListQuery{}); err != nil || len(page.Items) != 0 {
+		t.Fatalf("other user list = %+v, %v", page, err)
+	}
+	if page, err := svc.List(ctx, alice, JobListQuery{Status: "completed"}); err != nil || len(page.Items) != 1 {
+		t.Fatalf("owner list = %+v, %v", page, err)
+	}
+
+	if _, err := svc.Submit(ctx, alice, "missing", nil); !errors.Is(err, ErrJobInvalid) {
+		t.Fatalf("unknown type err = %v", err)
+	}
+	scoped := middleware.WithUcanContext(ctx, &middleware.UcanContext{HasAppCaps: true, AppCaps: map[string][]string{"app": {"write"}}})
+	if _, err := svc.Submit(scoped, alice, "count", nil); !errors.Is(err, auth.ErrAppScopeDenied) {
+		t.Fatalf("app scope err = %v", err)
+	}
+}
+
+func TestJobServiceRetriesThenFails(t *testing.T) {
+	svc, repo, _, _ := newTestJobService(t)
+	var mu sync.Mutex
+	attempts := []int{}
+	svc.Register("flaky", JobDefinition{
+		Admin: true,
+		Run: func(_ context.Context, run *JobRun) (any, error) {
+			mu.Lock()
+			attempts = append(attempts, run.Attempt)
+			mu.Unlock()
+			return map[string]int{"attempt": run.Attempt}, errors.New("disk unavailable")
+		},
+	})
+	ctx := context.Background()
+	if _, err := svc.Submit(ctx, user.NewUser("alice", "alice"), "flaky", nil); !errors.Is(err, ErrJobForbidden) {
+		t.Fatalf("user submit of admin type err = %v", err)
+	}
+	job, err := svc.SubmitAdmin(ctx, "root", "flaky", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.ProcessJobs(ctx, 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	failed, _ := svc.AdminGet(ctx, job.ID)
+	if failed.Status != repository.JobStatusFailed || failed.Attempts != 2 || failed.Error != "disk unavailable" {
+		t.Fatalf("failed job = %+v", failed)
+	}
+	if string(failed.Result) != `{"attempt":2}` {
+		t.Fatalf("partial result = %s", failed.Result)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("attempts = %v, want 2 runs", attempts)
+	}
+
+	retried, err := svc.AdminRetry(ctx, job.ID)
+	if err != nil || retried.Status != repository.JobStatusQueued || retried.Attempts != 0 {
+		t.Fatalf("retry = %+v, %v", retried, err)
+	}
+	if _, err := svc.AdminRetry(ctx, job.ID); !errors.Is(err, ErrJobConflict) {
+		t.Fatalf("retry of queued job err = %v", err)
+	}
+
+	// Finished jobs are deleted once past retention.
+	svc.config.Jobs.Retention = time.Minute
+	repo.jobs[job.ID].Status = repository.JobStatusCompleted
+	finished := time.Now().Add(-time.Hour)
+	repo.jobs[job.ID].FinishedAt = &finished
+	svc.cleanup(ctx)
+	if got, _ := repo.Get(ctx, job.ID); got != nil {
+		t.Fatalf("expired job not deleted: %+v", got)
+	}
+}
+
+func TestJobServiceCancelsQueuedAndRunningJobs(t *testing.T) {
+	svc, _, _, alice := newTestJobService(t)
+	started := make(chan struct{})
+	svc.Register("wait", JobDefinition{
+		Run: func(ctx context.Context, run *JobRun) (any, error) {
+			run.SetTotal(10)
+			run.Advance(4)
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	ctx := context.Background()
+
+	queued, err := svc.Submit(ctx, alice, "wait", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canceled, err := svc.Cancel(ctx, alice, queued.ID)
+	if err != nil || canceled.Status != repository.JobStatusCanceled {
+		t.Fatalf("cancel queued = %+v, %v", canceled, err)
+	}
+	if n, _ := svc.ProcessJobs(ctx, 10); n != 0 {
+		t.Fatalf("canceled job was claimed")
+	}
+
+	running, err := svc.Submit(ctx, alice, "wait", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go svc.Run(runCtx)
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("job did not start")
+	}
+	if job, err := svc.Cancel(ctx, alice, running.ID); err != nil || job.Status != repository.JobStatusRunning || !job.CancelRequested {
+		t.Fatalf("cancel running = %+v, %v", job, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := svc.Get(ctx, alice, running.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status == repository.JobStatusCanceled {
+			if job.ProgressDone != 4 || job.ProgressTotal != 10 {
+				t.Fatalf("canceled progress = %d/%d", job.ProgressDone, job.ProgressTotal)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job not canceled: %+v", job)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFilesDeleteJobMovesPathsToRecycle(t *testing.T) {
+	rootDir := t.TempDir()
+	cfg := &config.Config{WebDAV: config.WebDAVConfig{Directory: rootDir}}
+	users := newTestUserRepo()
+	alice := user.NewUser("alice", "alice")
+	_ = users.Save(context.Background(), alice)
+	recycleRepo := &testRecycleRepo{}
+	webdav := NewWebDAVService(cfg, allowPermissionChecker{}, quota.NewService(users), users, recycleRepo, nil, &testMutationRecorder{}, zap.NewNop())
+	writeRecoverTestFile(t, filepath.Join(rootDir, "alice", "docs", "a.txt"), "a")
+	writeRecoverTestFile(t, filepath.Join(rootDir, "alice", "b.txt"), "b")
+
+	svc := NewJobService(&config.Config{}, newMemoryJobRepo(), users, zap.NewNop())
+	svc.Register(JobTypeFilesDelete, FilesDeleteJob(webdav))
+	ctx := context.Background()
+	if _, err := svc.Submit(ctx, alice, JobTypeFilesDelete, json.RawMessage(`{"paths":["/"]}`)); !errors.Is(err, ErrJobInvalid) {
+		t.Fatalf("root delete err = %v", err)
+	}
+	job, err := svc.Submit(ctx, alice, JobTypeFilesDelete, json.RawMessage(`{"paths":["docs","/b.txt","b.txt","missing.txt"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(job.Params) != `{"paths":["/docs","/b.txt","/missing.txt"]}` {
+		t.Fatalf("normalized params = %s", job.Params)
+	}
+	if _, err := svc.ProcessJobs(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	done, _ := svc.Get(ctx, alice, job.ID)
+	if done.Status != repository.JobStatusCompleted || done.ProgressDone != 3 {
+		t.Fatalf("files.delete job = %+v", done)
+	}
+	var result BulkDeleteResult
+	if err := json.Unmarshal(done.Result, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Deleted != 2 || result.Missing != 1 || result.BatchID == "" {
+		t.Fatalf("result = %+v", result)
+	}
+	for _, gone := range []string{"docs", "b.txt"} {
+		if _, err := os.Stat(filepath.Join(rootDir, "alice", gone)); !os.IsNotExist(err) {
+			t.Fatalf("%s still exists: %v", gone, err)
+		}
+	}
+	if recycleRepo.createCalls != 2 {
+		t.Fatalf("recycle records = %d, want 2", recycleRepo.createCalls)
+	}
+}
@@ -19,6 +19,7 @@ import (
 	"github.com/yeying-community/warehouse/internal/domain/s3multipart"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 )
 
 type MultipartService struct {
@@ -26,6 +27,7 @@ type MultipartService struct {
 	repo         repository.S3MultipartRepository
 	objects      *ObjectService
 	quotaService quota.Service
+	storage      storage.Backend
 	uploadLocks  sync.Map
 }
 
@@ -49,22 +51,34 @@ func (s *MultipartService) lockUpload(id string) func() {
 }
 
 func NewMultipartService(root string, repo repository.S3MultipartRepository) *MultipartService {
-	return &MultipartService{root: filepath.Clean(root), repo: repo}
+	return &MultipartService{root: filepath.Clean(root), repo: repo, storage: storage.NewLocal()}
+}
+
+// SetStorage moves staged parts onto another backend.
+func (s *MultipartService) SetStorage(backend storage.Backend) {
+	if backend != nil {
+		s.storage = backend
+	}
 }
 
 func (s *MultipartService) Create(ctx context.Context, owner *user.User, bucket, key, contentType string) (*s3multipart.Upload, error) {
 	if owner == nil || s.repo == nil {
 		return nil, fmt.Errorf("multipart service is not configured")
 	}
+	if s.objects != nil {
+		if err := s.objects.CheckUploadPolicy(owner, bucket, key, -1, contentType); err != nil {
+			return nil, err
+		}
+	}
 	id := uuid.NewString()
 	staging := filepath.Join(s.root, ".s3-multipart", id)
-	if err := os.MkdirAll(staging, 0o700); err != nil {
+	if err := s.storage.MkdirAll(staging, 0o700); err != nil {
 		return nil, err
 	}
 	now := time.Now()
 	item := &s3multipart.Upload{ID: id, OwnerUserID: owner.ID, Bucket: bucket, ObjectKey: key, StagingPath: staging, Status: s3multipart.StatusActive, ContentType: contentType, InitiatedAt: now, ExpiresAt: now.Add(24 * time.Hour), UpdatedAt: now}
 	if err := s.repo.CreateUpload(ctx, item); err != nil {
-		_ = os.RemoveAll(staging)
+		_ = s.storage.RemoveAll(staging)
 		return nil, err
 	}
 	return item, nil
@@ -88,7 +102,7 @@ func (s *MultipartService) UploadPart(ctx context.Context, owner *user.User, upl
 	defer unlock()
 	partPath := filepath.Join(upload.StagingPath, fmt.Sprintf("part-%05d", partNumber))
 	tmpPath := partPath + ".tmp"
-	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	file, err := s.storage.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
 	if err != nil {
 		return nil, err
 	}
@@ -98,27 +112,27 @@ func (s *MultipartService) UploadPart(ctx context.Context, owner *user.User, upl
 	size, copyErr := io.Copy(io.MultiWriter(file, md5Hash, shaHash), limited)
 	closeErr := file.Close()
 	if copyErr != nil {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, copyErr
 	}
 	if closeErr != nil {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, closeErr
 	}
 	if size > maxMultipartPartSize {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, fmt.Errorf("multipart part exceeds 5 GiB limit")
 	}
 	if expectedChecksum != "" {
 		decoded, err := base64.StdEncoding.DecodeString(expectedChecksum)
 		if err != nil || hex.EncodeToString(decoded) != hex.EncodeToString(shaHash.Sum(nil)) {
-			_ = os.Remove(tmpPath)
+			_ = s.storage.Remove(tmpPath)
 			return nil, s3multipart.ErrChecksumMismatch
 		}
 	}
 	existing, err := s.repo.ListParts(ctx, uploadID)
 	if err != nil {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, err
 	}
 	var staged, oldSize int64
@@ -131,27 +145,27 @@ func (s *MultipartService) UploadPart(ctx context.Context, owner *user.User, upl
 	if s.quotaService != nil {
 		quotaInfo, err := s.quotaService.GetQuota(ctx, owner.ID)
 		if err != nil {
-			_ = os.Remove(tmpPath)
+			_ = s.storage.Remove(tmpPath)
 			return nil, err
 		}
 		delta := size - oldSize
 		if quotaRepo, ok := s.repo.(stagingQuotaRepository); ok {
 			if err := quotaRepo.ReserveStaging(ctx, owner.ID, quotaInfo.Used, quotaInfo.Quota, delta); err != nil {
-				_ = os.Remove(tmpPath)
+				_ = s.storage.Remove(tmpPath)
 				return nil, err
 			}
 		} else if quotaInfo.Available >= 0 && staged-oldSize+size > quotaInfo.Available {
-			_ = os.Remove(tmpPath)
+			_ = s.storage.Remove(tmpPath)
 			return nil, fmt.Errorf("multipart staging quota exceeded")
 		}
 	}
-	if err := os.Rename(tmpPath, partPath); err != nil {
+	if err := s.storage.Rename(tmpPath, partPath); err != nil {
 		if quotaRepo, ok := s.repo.(stagingQuotaRepository); ok && s.quotaService != nil {
 			if info, quotaErr := s.quotaService.GetQuota(ctx, owner.ID); quotaErr == nil {
 				_ = quotaRepo.ReserveStaging(ctx, owner.ID, info.Used, info.Quota, -(size - oldSize))
 			}
 		}
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, err
 	}
 	now := time.Now()
@@ -162,7 +176,7 @@ func (s *MultipartService) UploadPart(ctx context.Context, owner *user.User, upl
 				_ = quotaRepo.ReserveStaging(ctx, owner.ID, info.Used, info.Quota, -(size - oldSize))
 			}
 		}
-		_ = os.Remove(partPath)
+		_ = s.storage.Remove(partPath)
 		return nil, err
 	}
 	return part, nil
@@ -183,7 +197,7 @@ func (s *MultipartService) Abort(ctx context.Context, owner *user.User, uploadID
 		return err
 	}
 	s.releaseStaging(ctx, owner.ID, uploadID)
-	return os.RemoveAll(upload.StagingPath)
+	return s.storage.RemoveAll(upload.StagingPath)
 }
 
 func (s *MultipartService) releaseStaging(ctx context.Context, userID, uploadID string) {
@@ -218,7 +232,7 @@ func (s *MultipartService) CleanupExpired(ctx context.Context, now time.Time) (i
 			return cleaned, err
 		}
 		s.releaseStaging(ctx, item.OwnerUserID, item.ID)
-		if err := os.RemoveAll(item.StagingPath); err != nil {
+		if err := s.storage.RemoveAll(item.StagingPath); err != nil {
 			return cleaned, err
 		}
 		cleaned++
@@ -269,7 +283,10 @@ func (s *MultipartService) Complete(ctx context.Context, owner *user.User, uploa
 			return nil, fmt.Errorf("multipart object exceeds 100 GiB limit")
 		}
 	}
-	files := make([]*os.File, 0, len(parts))
+	if err := s.objects.CheckUploadPolicy(owner, upload.Bucket, upload.ObjectKey, totalSize, upload.ContentType); err != nil {
+		return nil, err
+	}
+	files := make([]storage.File, 0, len(parts))
 	readers := make([]io.Reader, 0, len(parts))
 	defer func() {
 		for _, file := range files {
@@ -284,7 +301,7 @@ func (s *MultipartService) Complete(ctx context.Context, owner *user.User, uploa
 		if index < len(parts)-1 && part.Size < minMultipartPartSize {
 			return nil, fmt.Errorf("non-final multipart part must be at least 5 MiB")
 		}
-		file, err := os.Open(part.StagingPath)
+		file, err := s.storage.Open(part.StagingPath)
 		if err != nil {
 			return nil, err
 		}
@@ -303,7 +320,7 @@ func (s *MultipartService) Complete(ctx context.Context, owner *user.User, uploa
 		return nil, err
 	}
 	s.releaseStaging(ctx, owner.ID, uploadID)
-	if err := os.RemoveAll(upload.StagingPath); err != nil {
+	if err := s.storage.RemoveAll(upload.StagingPath); err != nil {
 		return nil, err
 	}
 	return &info, nil
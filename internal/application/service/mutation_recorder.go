@@ -7,13 +7,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/yeying-community/warehouse/internal/domain/replication"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"go.uber.org/zap"
 )
 
@@ -40,6 +40,8 @@ type OutboxMutationRecorder struct {
 	peerResolver ReplicationPeerResolver
 	logger       *zap.Logger
 	webdavRoot   string
+	volumes      *storage.Volumes
+	storage      storage.Backend
 	sourceNodeID string
 }
 
@@ -70,10 +72,20 @@ func NewMutationRecorder(
 		peerResolver: peerResolver,
 		logger:       logger,
 		webdavRoot:   filepath.Clean(webdavRoot),
+		// Rebuilt on the absolute root so Logical lines up with webdavRoot.
+		volumes:      storage.NewVolumes(webdavRoot, storage.VolumesFromConfig(cfg).List()[1:]),
+		storage:      storage.NewLocal(),
 		sourceNodeID: cfg.Node.ID,
 	}
 }
 
+// SetStorage sets the backend recorded files are read from for digests.
+func (r *OutboxMutationRecorder) SetStorage(backend storage.Backend) {
+	if r != nil && backend != nil {
+		r.storage = backend
+	}
+}
+
 func (r *OutboxMutationRecorder) EnsureDir(ctx context.Context, fullPath string) error {
 	normalized, err := r.normalizeFullPath(fullPath)
 	if err != nil {
@@ -113,7 +125,7 @@ func (r *OutboxMutationRecorder) UpsertFile(ctx context.Context, fullPath string
 		return nil
 	}
 
-	size, sha256Hex, err := fileDigest(fullPath)
+	size, sha256Hex, err := fileDigest(r.storage, fullPath)
 	if err != nil {
 		return err
 	}
@@ -282,6 +294,10 @@ func (r *OutboxMutationRecorder) normalizeFullPath(fullPath string) (string, err
 		return "", fmt.Errorf("resolve absolute path %q: %w", fullPath, err)
 	}
 	absPath = filepath.Clean(absPath)
+	if r.volumes != nil {
+		// Files on other volumes are recorded under their logical path.
+		absPath = r.volumes.Logical(absPath)
+	}
 
 	rel, err := filepath.Rel(r.webdavRoot, absPath)
 	if err != nil {
@@ -297,8 +313,8 @@ func (r *OutboxMutationRecorder) normalizeFullPath(fullPath string) (string, err
 	return "/" + strings.TrimPrefix(rel, "/"), nil
 }
 
-func fileDigest(fullPath string) (int64, string, error) {
-	file, err := os.Open(fullPath)
+func fileDigest(b storage.Backend, fullPath string) (int64, string, error) {
+	file, err := b.Open(fullPath)
 	if err != nil {
 		return 0, "", fmt.Errorf("open file %q for digest: %w", fullPath, err)
 	}
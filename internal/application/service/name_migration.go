@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+)
+
+// NamePathSyncer 在存量文件名迁移（warehouse names normalize）改名后同步数据库中的路径：
+// 公开分享、定向分享与回收站记录的原始位置，避免改名后分享失效或恢复到旧名称
+type NamePathSyncer struct {
+	config          *config.Config
+	users           []*user.User
+	userShareRepo   repository.UserShareRepository
+	publicShareRepo repository.ShareRepository
+	recycleRepo     repository.RecycleRepository
+}
+
+// NewNamePathSyncer 创建路径同步器；users 为全部用户，用于按改名路径定位所有者
+func NewNamePathSyncer(
+	cfg *config.Config,
+	users []*user.User,
+	userShareRepo repository.UserShareRepository,
+	publicShareRepo repository.ShareRepository,
+	recycleRepo repository.RecycleRepository,
+) *NamePathSyncer {
+	return &NamePathSyncer{
+		config:          cfg,
+		users:           users,
+		userShareRepo:   userShareRepo,
+		publicShareRepo: publicShareRepo,
+		recycleRepo:     recycleRepo,
+	}
+}
+
+// SyncRename 把 fromFullPath 改名为 toFullPath 后的路径变更写入数据库；
+// 不属于任何用户目录的路径忽略
+func (s *NamePathSyncer) SyncRename(ctx context.Context, fromFullPath, toFullPath string) error {
+	owner := s.ownerOf(fromFullPath)
+	if owner == nil {
+		return nil
+	}
+	if err := SyncAllSharePathsForOwnerMove(ctx, s.userShareRepo, s.publicShareRepo, s.config, owner, fromFullPath, toFullPath); err != nil {
+		return err
+	}
+	return s.syncRecyclePaths(ctx, owner, fromFullPath, toFullPath)
+}
+
+// ownerOf returns the user whose root is the longest prefix of fullPath.
+func (s *NamePathSyncer) ownerOf(fullPath string) *user.User {
+	var owner *user.User
+	longest := -1
+	for _, u := range s.users {
+		root := ownerUserRootDir(s.config, u)
+		if !isPathWithin(root, fullPath) || filepath.Clean(fullPath) == root || len(root) <= longest {
+			continue
+		}
+		owner, longest = u, len(root)
+	}
+	return owner
+}
+
+// syncRecyclePaths rewrites the original location of recycle items that were
+// deleted from below the renamed path. Recycle item paths are stored with or
+// without a leading slash, so they are compared in rooted form.
+func (s *NamePathSyncer) syncRecyclePaths(ctx context.Context, owner *user.User, fromFullPath, toFullPath string) error {
+	pathRepo, ok := s.recycleRepo.(repository.RecyclePathRepository)
+	if !ok {
+		return nil
+	}
+	fromPath, err := ownerShareStoragePath(s.config, owner, fromFullPath)
+	if err != nil {
+		return err
+	}
+	toPath, err := ownerShareStoragePath(s.config, owner, toFullPath)
+	if err != nil || fromPath == toPath {
+		return err
+	}
+	items, err := s.recycleRepo.GetByUserID(ctx, owner.ID)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		rooted := "/" + strings.TrimLeft(filepath.ToSlash(item.Path), "/")
+		rest, ok := strings.CutPrefix(rooted, fromPath)
+		if !ok || (rest != "" && !strings.HasPrefix(rest, "/")) {
+			continue
+		}
+		newPath := toPath + rest
+		if !strings.HasPrefix(item.Path, "/") {
+			newPath = strings.TrimPrefix(newPath, "/")
+		}
+		newPath = filepath.FromSlash(newPath)
+		directory := filepath.Dir(newPath)
+		if directory == "." {
+			directory = item.Directory
+		}
+		if err := pathRepo.UpdateOriginalPath(ctx, item.Hash, directory, newPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/yeying-community/warehouse/internal/domain/group"
 	"github.com/yeying-community/warehouse/internal/domain/notification"
+	"github.com/yeying-community/warehouse/internal/domain/sharegrant"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
 	"go.uber.org/zap"
@@ -198,6 +200,106 @@ func (s *NotificationService) DismissGroupInvite(ctx context.Context, u *user.Us
 	}
 }
 
+// NotifyGroupMemberRemoved clears a removed member's pending invite and tells
+// active members they lost access to the group's shares and team spaces.
+func (s *NotificationService) NotifyGroupMemberRemoved(ctx context.Context, operator *user.User, member *group.Member, grp *group.Group, groupDeleted bool) {
+	target := s.groupMemberUser(ctx, member)
+	if target == nil || operator == nil || target.ID == operator.ID {
+		return
+	}
+	s.DismissGroupInvite(ctx, target, member.ID)
+	if group.NormalizeMemberStatus(member.Status) != group.MemberStatusActive {
+		return
+	}
+	title := "你已被移出分组"
+	content := fmt.Sprintf("%s 将你移出了分组「%s」，通过该分组获得的共享与团队空间已不可访问。", displayUserName(operator), displayGroupName(grp))
+	if groupDeleted {
+		title = "分组已解散"
+		content = fmt.Sprintf("%s 解散了分组「%s」，通过该分组获得的共享与团队空间已不可访问。", displayUserName(operator), displayGroupName(grp))
+	}
+	s.notifyGroup(ctx, target.ID, title, content, fmt.Sprintf("group:removed:%s:%s", grp.ID, target.ID))
+}
+
+// NotifyGroupMemberLeft tells the group owner that a member left.
+func (s *NotificationService) NotifyGroupMemberLeft(ctx context.Context, member *user.User, grp *group.Group) {
+	if member == nil || grp == nil || grp.UserID == member.ID {
+		return
+	}
+	s.notifyGroup(ctx, grp.UserID, "成员退出分组",
+		fmt.Sprintf("%s 退出了分组「%s」。", displayUserName(member), displayGroupName(grp)),
+		fmt.Sprintf("group:left:%s:%s", grp.ID, member.ID))
+}
+
+// NotifyGroupMemberJoined tells the group owner that someone joined with an
+// invite code.
+func (s *NotificationService) NotifyGroupMemberJoined(ctx context.Context, member *user.User, grp *group.Group) {
+	if member == nil || grp == nil || grp.UserID == member.ID {
+		return
+	}
+	s.notifyGroup(ctx, grp.UserID, "新成员加入分组",
+		fmt.Sprintf("%s 通过邀请码加入了分组「%s」。", displayUserName(member), displayGroupName(grp)),
+		fmt.Sprintf("group:joined:%s:%s", grp.ID, member.ID))
+}
+
+// NotifyGroupRoleChanged tells a member about their new role.
+func (s *NotificationService) NotifyGroupRoleChanged(ctx context.Context, operator *user.User, member *group.Member, grp *group.Group) {
+	target := s.groupMemberUser(ctx, member)
+	if target == nil || grp == nil || (operator != nil && target.ID == operator.ID) {
+		return
+	}
+	roleName := "普通成员"
+	if member.Role == group.RoleAdmin {
+		roleName = "管理员"
+	}
+	s.notifyGroup(ctx, target.ID, "分组角色已变更",
+		fmt.Sprintf("%s 将你在分组「%s」中的角色调整为%s。", displayUserName(operator), displayGroupName(grp), roleName),
+		fmt.Sprintf("group:role:%s:%s", grp.ID, target.ID))
+}
+
+// NotifyGroupOwnershipTransferred tells the new owner about the transfer.
+func (s *NotificationService) NotifyGroupOwnershipTransferred(ctx context.Context, operator, newOwner *user.User, grp *group.Group) {
+	if newOwner == nil || grp == nil {
+		return
+	}
+	s.notifyGroup(ctx, newOwner.ID, "你已成为分组所有者",
+		fmt.Sprintf("%s 将分组「%s」转让给了你。", displayUserName(operator), displayGroupName(grp)),
+		fmt.Sprintf("group:owner:%s:%s", grp.ID, newOwner.ID))
+}
+
+func (s *NotificationService) groupMemberUser(ctx context.Context, member *group.Member) *user.User {
+	if s == nil || s.repo == nil || s.userRepo == nil || member == nil || strings.TrimSpace(member.WalletAddress) == "" {
+		return nil
+	}
+	target, err := s.userRepo.FindByWalletAddress(ctx, member.WalletAddress)
+	if err != nil {
+		return nil
+	}
+	return target
+}
+
+func (s *NotificationService) notifyGroup(ctx context.Context, userID, title, content, dedupeKey string) {
+	if s == nil || s.repo == nil || strings.TrimSpace(userID) == "" {
+		return
+	}
+	_ = s.upsertForUserIfEnabled(ctx, userID, notification.CreateInput{
+		RecipientUserID: userID,
+		RecipientRole:   notification.RecipientRoleUser,
+		Type:            notification.TypeGroup,
+		Title:           title,
+		Content:         content,
+		Severity:        notification.SeverityInfo,
+		ActionURL:       "#groups",
+		DedupeKey:       dedupeKey,
+	})
+}
+
+func displayGroupName(grp *group.Group) string {
+	if grp == nil || strings.TrimSpace(grp.Name) == "" {
+		return "未命名分组"
+	}
+	return strings.TrimSpace(grp.Name)
+}
+
 func mergeNotificationsByCreatedAt(limit int, groups ...[]*notification.Notification) []*notification.Notification {
 	total := 0
 	for _, group := range groups {
@@ -419,6 +521,93 @@ func (s *NotificationService) NotifyShareCreated(ctx context.Context, owner *use
 	}
 }
 
+// NotifyShareUpload tells the owner that an anonymous upload arrived through
+// an upload-only share. Uploads of the same link on the same day share one
+// notification, refreshed with the latest file and running total.
+func (s *NotificationService) NotifyShareUpload(ctx context.Context, owner *user.User, shareID, shareName, fileName string, totalFiles int64) {
+	if s == nil || s.repo == nil || owner == nil {
+		return
+	}
+	_ = s.upsertForUserIfEnabled(ctx, owner.ID, notification.CreateInput{
+		RecipientUserID: owner.ID,
+		RecipientRole:   notification.RecipientRoleUser,
+		Type:            notification.TypeShare,
+		Title:           "文件收集链接收到新文件",
+		Content:         fmt.Sprintf("分享链接「%s」收到新文件 %s，累计 %d 个文件", displayShareName(shareName, ""), fileName, totalFiles),
+		Severity:        notification.SeverityInfo,
+		ActionURL:       "#shares",
+		DedupeKey:       fmt.Sprintf("share:upload:%s:%s", shareID, time.Now().UTC().Format("2006-01-02")),
+	})
+}
+
+// NotifyShareAccessRequested asks the owner to approve or deny an access
+// request. The action URL carries the request ID for the decision dialog.
+func (s *NotificationService) NotifyShareAccessRequested(ctx context.Context, requester *user.User, req *sharegrant.AccessRequest) {
+	if s == nil || s.repo == nil || requester == nil || req == nil {
+		return
+	}
+	content := fmt.Sprintf("%s 申请 %s 的 %s 权限", displayUserName(requester), displayShareName("", req.NormalizedPath), req.Permissions)
+	if req.Message != "" {
+		content += "：" + req.Message
+	}
+	_ = s.upsertForUserIfEnabled(ctx, req.OwnerUserID, notification.CreateInput{
+		RecipientUserID: req.OwnerUserID,
+		RecipientRole:   notification.RecipientRoleUser,
+		Type:            notification.TypeShare,
+		Title:           "收到共享访问申请",
+		Content:         content,
+		Severity:        notification.SeverityInfo,
+		ActionURL:       shareAccessRequestActionURL(req.ID),
+		DedupeKey:       "share:access-request:" + req.ID,
+	})
+}
+
+// NotifyShareAccessDecided tells the requester how the owner decided.
+func (s *NotificationService) NotifyShareAccessDecided(ctx context.Context, owner *user.User, req *sharegrant.AccessRequest) {
+	if s == nil || s.repo == nil || owner == nil || req == nil {
+		return
+	}
+	name := displayShareName("", req.NormalizedPath)
+	title := "共享访问申请已被拒绝"
+	content := fmt.Sprintf("%s 拒绝了你对 %s 的 %s 权限申请", displayUserName(owner), name, req.Permissions)
+	actionURL := shareAccessRequestActionURL(req.ID)
+	if req.Status == sharegrant.RequestStatusApproved {
+		title = "共享访问申请已通过"
+		content = fmt.Sprintf("%s 已授予你 %s 的 %s 权限", displayUserName(owner), name, req.Permissions)
+		actionURL = "#shared-with-me"
+	}
+	if req.DecisionNote != "" {
+		content += "：" + req.DecisionNote
+	}
+	_ = s.upsertForUserIfEnabled(ctx, req.RequesterUserID, notification.CreateInput{
+		RecipientUserID: req.RequesterUserID,
+		RecipientRole:   notification.RecipientRoleUser,
+		Type:            notification.TypeShare,
+		Title:           title,
+		Content:         content,
+		Severity:        notification.SeverityInfo,
+		ActionURL:       actionURL,
+		DedupeKey:       "share:access-request:" + req.ID + ":decision",
+	})
+}
+
+// DismissShareAccessRequest removes the owner's pending-request notification
+// once the request is decided or canceled.
+func (s *NotificationService) DismissShareAccessRequest(ctx context.Context, req *sharegrant.AccessRequest) {
+	if s == nil || s.repo == nil || req == nil {
+		return
+	}
+	if err := s.repo.DismissByActionURLForUser(ctx, req.OwnerUserID, shareAccessRequestActionURL(req.ID)); err != nil && s.logger != nil {
+		s.logger.Warn("failed to dismiss share access request notification",
+			zap.String("request_id", req.ID),
+			zap.Error(err))
+	}
+}
+
+func shareAccessRequestActionURL(requestID string) string {
+	return "#share-access-request:" + strings.TrimSpace(requestID)
+}
+
 func (s *NotificationService) upsertGroupInvite(ctx context.Context, userID, inviterName, groupName, memberID string) error {
 	inviterName = strings.TrimSpace(inviterName)
 	groupName = strings.TrimSpace(groupName)
@@ -531,6 +720,87 @@ func (s *NotificationService) EnsureAdminQuotaNotifications(ctx context.Context)
 	return nil
 }
 
+// NotifyRecyclePurge warns a user that count recycle items (size bytes in
+// total) will be purged at purgeAt. Items purged on the same day share one
+// notification, which is refreshed on every pass.
+func (s *NotificationService) NotifyRecyclePurge(ctx context.Context, u *user.User, count int, size int64, purgeAt time.Time) error {
+	if s == nil || s.repo == nil || u == nil || count <= 0 {
+		return nil
+	}
+	expiresAt := purgeAt
+	return s.upsertForUserIfEnabled(ctx, u.ID, notification.CreateInput{
+		RecipientUserID: u.ID,
+		RecipientRole:   notification.RecipientRoleUser,
+		Type:            notification.TypeRecycle,
+		Title:           "回收站文件即将被清理",
+		Content: fmt.Sprintf("回收站中有 %d 个项目（共 %d 字节）将于 %s 被永久删除，如需保留请及时恢复。",
+			count, size, purgeAt.Local().Format("2006-01-02 15:04")),
+		Severity:  notification.SeverityWarning,
+		ActionURL: "#recycle",
+		DedupeKey: fmt.Sprintf("recycle:purge:%s:%s", u.ID, purgeAt.UTC().Format("2006-01-02")),
+		ExpiresAt: &expiresAt,
+	})
+}
+
+// NotifyShareExpiring reminds the owner or a recipient of a share that it
+// expires soon. The notification itself expires together with the share.
+func (s *NotificationService) NotifyShareExpiring(ctx context.Context, item *repository.ExpiringShare, userID string) error {
+	if s == nil || s.repo == nil || item == nil || userID == "" {
+		return nil
+	}
+	name := displayShareName(item.Name, item.Path)
+	when := item.ExpiresAt.Local().Format("2006-01-02 15:04")
+	content := fmt.Sprintf("%s 分享给你的 %s 将于 %s 到期，如需继续使用请联系分享者续期。", item.OwnerUsername, name, when)
+	actionURL := "#shared-with-me"
+	if userID == item.OwnerUserID {
+		content = fmt.Sprintf("你的分享 %s 将于 %s 到期，可在分享列表中一键续期。", name, when)
+		actionURL = "#shares"
+	}
+	expiresAt := item.ExpiresAt
+	return s.upsertForUserIfEnabled(ctx, userID, notification.CreateInput{
+		RecipientUserID: userID,
+		RecipientRole:   notification.RecipientRoleUser,
+		Type:            notification.TypeShareExpiry,
+		Title:           "分享即将到期",
+		Content:         content,
+		Severity:        notification.SeverityWarning,
+		ActionURL:       actionURL,
+		DedupeKey:       shareExpiryDedupeKey(repository.ShareExpiryStageReminder, item, userID),
+		ExpiresAt:       &expiresAt,
+	})
+}
+
+// NotifyShareExpired tells the owner or a recipient that a share stopped
+// working because it reached its expiry.
+func (s *NotificationService) NotifyShareExpired(ctx context.Context, item *repository.ExpiringShare, userID string) error {
+	if s == nil || s.repo == nil || item == nil || userID == "" {
+		return nil
+	}
+	name := displayShareName(item.Name, item.Path)
+	content := fmt.Sprintf("%s 分享给你的 %s 已到期，无法继续访问。", item.OwnerUsername, name)
+	actionURL := "#shared-with-me"
+	if userID == item.OwnerUserID {
+		content = fmt.Sprintf("你的分享 %s 已到期，续期后可恢复访问。", name)
+		actionURL = "#shares"
+	}
+	return s.upsertForUserIfEnabled(ctx, userID, notification.CreateInput{
+		RecipientUserID: userID,
+		RecipientRole:   notification.RecipientRoleUser,
+		Type:            notification.TypeShareExpiry,
+		Title:           "分享已到期",
+		Content:         content,
+		Severity:        notification.SeverityInfo,
+		ActionURL:       actionURL,
+		DedupeKey:       shareExpiryDedupeKey(repository.ShareExpiryStageExpired, item, userID),
+	})
+}
+
+// shareExpiryDedupeKey includes the expiry so that an extended share is
+// reminded again for its new expiry.
+func shareExpiryDedupeKey(stage string, item *repository.ExpiringShare, userID string) string {
+	return fmt.Sprintf("share:expiry:%s:%s:%s:%d:%s", stage, item.Kind, item.ID, item.ExpiresAt.Unix(), userID)
+}
+
 func (s *NotificationService) createForUserIfEnabled(ctx context.Context, userID string, input notification.CreateInput) error {
 	if !s.preferenceEnabled(ctx, userID, input.Type) {
 		return nil
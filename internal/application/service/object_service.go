@@ -20,11 +20,12 @@ import (
 	"time"
 
 	objectpath "github.com/yeying-community/warehouse/internal/domain/object"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 	"github.com/yeying-community/warehouse/internal/domain/quota"
 	"github.com/yeying-community/warehouse/internal/domain/user"
-	"github.com/yeying-community/warehouse/internal/infrastructure/atomicfile"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 )
 
 type ObjectInfo struct {
@@ -43,6 +44,9 @@ type ObjectWriteOptions struct {
 	ExpectedCRC32  string
 	ETag           string
 	ContentType    string
+	// KeepVersion retains the replaced content as a file version when
+	// versioning is enabled.
+	KeepVersion bool
 }
 
 type ObjectMetadata struct {
@@ -66,6 +70,12 @@ type ObjectService struct {
 	userShareRepo    repository.UserShareRepository
 	publicShareRepo  repository.ShareRepository
 	metadataRepo     objectMetadataRepository
+	uploadPolicy     *UploadPolicyEnforcer
+	versionService   *VersionService
+	dedup            *DedupService
+	storage          storage.Backend
+	volumes          *storage.Volumes
+	names            pathname.Policy
 	locks            sync.Map
 }
 
@@ -95,7 +105,50 @@ func (s *ObjectService) lockPath(path string) func() {
 }
 
 func NewObjectService(webdavRoot string) *ObjectService {
-	return &ObjectService{webdavRoot: filepath.Clean(webdavRoot)}
+	return &ObjectService{webdavRoot: filepath.Clean(webdavRoot), storage: storage.NewLocal()}
+}
+
+// SetStorage moves object reads and writes onto another backend.
+func (s *ObjectService) SetStorage(backend storage.Backend) {
+	if backend != nil {
+		s.storage = backend
+	}
+}
+
+// SetNamePolicy normalizes object keys and guards case-only collisions the
+// same way as the WebDAV entry point.
+func (s *ObjectService) SetNamePolicy(policy pathname.Policy) {
+	s.names = policy
+}
+
+// SetVolumes resolves user roots on the volume each user lives on.
+func (s *ObjectService) SetVolumes(volumes *storage.Volumes) {
+	s.volumes = volumes
+}
+
+// userBase returns the directory a user directory is joined to.
+func (s *ObjectService) userBase(volume, userDirectory string) string {
+	if s.volumes == nil {
+		return s.webdavRoot
+	}
+	return s.volumes.UserBase(volume, userDirectory)
+}
+
+// CheckWritable reports whether the owner's tree currently accepts writes.
+func (s *ObjectService) CheckWritable(owner *user.User) error {
+	if owner == nil {
+		return nil
+	}
+	if owner.VolumeMoving {
+		return ErrVolumeMoving
+	}
+	if s.volumes == nil {
+		return nil
+	}
+	if volume, ok := s.volumes.Get(owner.Volume); ok && volume.ReadOnly {
+		return ErrVolumeReadOnly
+	}
+	return nil
 }
 
 func (s *ObjectService) SetGuards(quotaService quota.Service, userRepo user.Repository, mutationRecorder MutationRecorder) {
@@ -104,6 +157,40 @@ func (s *ObjectService) SetGuards(quotaService quota.Service, userRepo user.Repo
 	s.mutationRecorder = mutationRecorder
 }
 
+// SetUploadPolicyEnforcer enables upload policy checks on object writes.
+func (s *ObjectService) SetUploadPolicyEnforcer(enforcer *UploadPolicyEnforcer) {
+	s.uploadPolicy = enforcer
+}
+
+// SetVersionService enables version retention for writes with KeepVersion.
+func (s *ObjectService) SetVersionService(versions *VersionService) {
+	s.versionService = versions
+}
+
+// SetDedupService links stored objects into the content-addressed blob store.
+func (s *ObjectService) SetDedupService(dedup *DedupService) {
+	s.dedup = dedup
+}
+
+// CheckUploadPolicy validates an upload to bucket/key before any data is written.
+func (s *ObjectService) CheckUploadPolicy(owner *user.User, bucket, key string, size int64, contentType string) error {
+	if s.uploadPolicy == nil || owner == nil {
+		return nil
+	}
+	key = s.names.Normalize(key)
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase(owner.Volume, owner.Directory), owner.Directory, bucket, key)
+	if err != nil {
+		return err
+	}
+	return s.uploadPolicy.Check(UploadTarget{
+		Owner:          owner,
+		PermissionPath: objectPermissionPath(owner, bucket, key),
+		FullPath:       fullPath,
+		Size:           size,
+		ContentType:    contentType,
+	})
+}
+
 func (s *ObjectService) SetMetadataRepository(repo objectMetadataRepository) {
 	s.metadataRepo = repo
 }
@@ -128,22 +215,41 @@ func (s *ObjectService) putForUserWithOptions(ctx context.Context, owner *user.U
 	if owner == nil {
 		return ObjectInfo{}, fmt.Errorf("user is nil")
 	}
-	fullPath, err := objectpath.ResolvePath(s.webdavRoot, owner.Directory, bucket, key)
+	key = s.names.Normalize(key)
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase(owner.Volume, owner.Directory), owner.Directory, bucket, key)
 	if err != nil {
 		return ObjectInfo{}, err
 	}
 	unlock := s.lockPath(fullPath)
 	defer unlock()
 	var oldSize int64
-	if info, statErr := os.Stat(fullPath); statErr == nil && !info.IsDir() {
+	if info, statErr := s.storage.Stat(fullPath); statErr == nil && !info.IsDir() {
 		oldSize = info.Size()
 	} else if statErr != nil && !os.IsNotExist(statErr) {
 		return ObjectInfo{}, statErr
+	} else if statErr != nil {
+		if err := s.names.CheckCollision(fullPath); err != nil {
+			return ObjectInfo{}, err
+		}
 	}
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+	policyTarget := UploadTarget{
+		Owner:          owner,
+		PermissionPath: objectPermissionPath(owner, bucket, key),
+		FullPath:       fullPath,
+		Size:           -1,
+		ContentType:    options.ContentType,
+	}
+	if err := s.uploadPolicy.Check(policyTarget); err != nil {
 		return ObjectInfo{}, err
 	}
-	tmp, err := atomicfile.Open(fullPath, 0o644)
+	maxFileSize := s.uploadPolicy.MaxFileSize(owner, policyTarget.PermissionPath)
+	if maxFileSize > 0 {
+		src = io.LimitReader(src, maxFileSize+1)
+	}
+	if err := s.storage.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return ObjectInfo{}, err
+	}
+	tmp, err := s.storage.CreateAtomic(fullPath, 0o644)
 	if err != nil {
 		return ObjectInfo{}, err
 	}
@@ -156,6 +262,12 @@ func (s *ObjectService) putForUserWithOptions(ctx context.Context, owner *user.U
 		tmp.Abort()
 		return ObjectInfo{}, err
 	}
+	if maxFileSize > 0 && size > maxFileSize {
+		tmp.Abort()
+		policyTarget.FullPath = ""
+		policyTarget.Size = size
+		return ObjectInfo{}, s.uploadPolicy.Check(policyTarget)
+	}
 	if err := validateChecksum(options.ExpectedMD5, md5Hash, options.ExpectedSHA256, sha256Hash, options.ExpectedCRC32, crc32Hash); err != nil {
 		tmp.Abort()
 		return ObjectInfo{}, err
@@ -176,12 +288,26 @@ func (s *ObjectService) putForUserWithOptions(ctx context.Context, owner *user.U
 			return ObjectInfo{}, err
 		}
 	}
+	var pendingVersion *PendingVersion
+	if options.KeepVersion && oldSize > 0 {
+		pendingVersion, err = s.versionService.Prepare(ctx, owner, fullPath, VersionSourceAsset)
+		if err != nil {
+			tmp.Abort()
+			if reserved {
+				_ = s.userRepo.(quotaReserveRepository).ReleaseUsedSpaceDelta(ctx, owner.Username, delta)
+			}
+			return ObjectInfo{}, err
+		}
+	}
 	if err := tmp.Close(); err != nil {
+		_, _ = s.versionService.Finish(ctx, pendingVersion, false)
 		if reserved {
 			_ = s.userRepo.(quotaReserveRepository).ReleaseUsedSpaceDelta(ctx, owner.Username, delta)
 		}
 		return ObjectInfo{}, err
 	}
+	_, _ = s.versionService.Finish(ctx, pendingVersion, true)
+	s.dedup.IngestWithDigest(fullPath, hex.EncodeToString(sha256Hash.Sum(nil)))
 	if reserved {
 		owner.UpdateUsedSpace(reservedUsed)
 	} else if s.userRepo != nil && delta != 0 {
@@ -238,13 +364,13 @@ func (s *ObjectService) DeleteForUser(ctx context.Context, owner *user.User, buc
 	if owner == nil {
 		return fmt.Errorf("user is nil")
 	}
-	fullPath, err := objectpath.ResolvePath(s.webdavRoot, owner.Directory, bucket, key)
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase(owner.Volume, owner.Directory), owner.Directory, bucket, key)
 	if err != nil {
 		return err
 	}
 	unlock := s.lockPath(fullPath)
 	defer unlock()
-	info, err := os.Stat(fullPath)
+	info, err := s.storage.Stat(fullPath)
 	if os.IsNotExist(err) {
 		return nil
 	}
@@ -254,12 +380,15 @@ func (s *ObjectService) DeleteForUser(ctx context.Context, owner *user.User, buc
 	if info.IsDir() {
 		return fmt.Errorf("cannot delete directory object")
 	}
-	if err := os.Remove(fullPath); err != nil {
+	if err := s.storage.Remove(fullPath); err != nil {
 		return err
 	}
 	if err := RemoveAllShareReferencesForOwnerPath(ctx, s.userShareRepo, s.publicShareRepo, s.shareConfig, owner, fullPath); err != nil {
 		return err
 	}
+	if err := s.versionService.RemovePath(ctx, owner, fullPath, false); err != nil {
+		return err
+	}
 	if err := s.deleteMetadata(ctx, owner.Directory, bucket, key); err != nil {
 		return err
 	}
@@ -280,11 +409,11 @@ func (s *ObjectService) List(ctx context.Context, userDirectory, bucket, prefix
 	if err := ctx.Err(); err != nil {
 		return ObjectList{}, err
 	}
-	base, err := objectpath.ResolvePath(s.webdavRoot, userDirectory, bucket, "")
+	base, err := objectpath.ResolvePath(s.names, s.userBase("", userDirectory), userDirectory, bucket, "")
 	if err != nil {
 		return ObjectList{}, err
 	}
-	if _, statErr := os.Stat(base); os.IsNotExist(statErr) {
+	if _, statErr := s.storage.Stat(base); os.IsNotExist(statErr) {
 		return ObjectList{}, nil
 	} else if statErr != nil {
 		return ObjectList{}, statErr
@@ -299,7 +428,7 @@ func (s *ObjectService) List(ctx context.Context, userDirectory, bucket, prefix
 			return ObjectList{}, err
 		}
 	}
-	err = filepath.WalkDir(base, func(current string, entry os.DirEntry, walkErr error) error {
+	err = s.storage.WalkDir(base, func(current string, entry os.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
@@ -381,34 +510,39 @@ func (s *ObjectService) EnsureBucket(ctx context.Context, userDirectory, bucket
 	if err := ctx.Err(); err != nil {
 		return err
 	}
-	fullPath, err := objectpath.ResolvePath(s.webdavRoot, userDirectory, bucket, "")
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase("", userDirectory), userDirectory, bucket, "")
 	if err != nil {
 		return err
 	}
-	return os.MkdirAll(fullPath, 0o755)
+	return s.storage.MkdirAll(fullPath, 0o755)
 }
 
 func (s *ObjectService) Stat(ctx context.Context, userDirectory, bucket, key string) (ObjectInfo, error) {
 	if err := ctx.Err(); err != nil {
 		return ObjectInfo{}, err
 	}
-	fullPath, err := objectpath.ResolvePath(s.webdavRoot, userDirectory, bucket, key)
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase("", userDirectory), userDirectory, bucket, key)
 	if err != nil {
 		return ObjectInfo{}, err
 	}
 	return s.statObject(ctx, userDirectory, bucket, key, fullPath, nil)
 }
 
-func (s *ObjectService) Open(ctx context.Context, userDirectory, bucket, key string) (*os.File, ObjectInfo, error) {
+// ResolveFullPath maps a bucket/key pair to its on-disk path.
+func (s *ObjectService) ResolveFullPath(userDirectory, bucket, key string) (string, error) {
+	return objectpath.ResolvePath(s.names, s.userBase("", userDirectory), userDirectory, bucket, key)
+}
+
+func (s *ObjectService) Open(ctx context.Context, userDirectory, bucket, key string) (storage.File, ObjectInfo, error) {
 	info, err := s.Stat(ctx, userDirectory, bucket, key)
 	if err != nil {
 		return nil, ObjectInfo{}, err
 	}
-	fullPath, err := objectpath.ResolvePath(s.webdavRoot, userDirectory, bucket, key)
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase("", userDirectory), userDirectory, bucket, key)
 	if err != nil {
 		return nil, ObjectInfo{}, err
 	}
-	file, err := os.Open(fullPath)
+	file, err := s.storage.Open(fullPath)
 	if err != nil {
 		return nil, ObjectInfo{}, err
 	}
@@ -419,14 +553,14 @@ func (s *ObjectService) Put(ctx context.Context, userDirectory, bucket, key stri
 	if err := ctx.Err(); err != nil {
 		return ObjectInfo{}, err
 	}
-	fullPath, err := objectpath.ResolvePath(s.webdavRoot, userDirectory, bucket, key)
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase("", userDirectory), userDirectory, bucket, key)
 	if err != nil {
 		return ObjectInfo{}, err
 	}
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+	if err := s.storage.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
 		return ObjectInfo{}, err
 	}
-	if err := atomicfile.WriteAll(fullPath, src, 0o644); err != nil {
+	if err := storage.WriteAll(s.storage, fullPath, src, 0o644); err != nil {
 		return ObjectInfo{}, err
 	}
 	_ = s.deleteMetadata(ctx, userDirectory, bucket, key)
@@ -437,18 +571,18 @@ func (s *ObjectService) Delete(ctx context.Context, userDirectory, bucket, key s
 	if err := ctx.Err(); err != nil {
 		return err
 	}
-	fullPath, err := objectpath.ResolvePath(s.webdavRoot, userDirectory, bucket, key)
+	fullPath, err := objectpath.ResolvePath(s.names, s.userBase("", userDirectory), userDirectory, bucket, key)
 	if err != nil {
 		return err
 	}
-	if err := os.Remove(fullPath); err != nil && !os.IsNotExist(err) {
+	if err := s.storage.Remove(fullPath); err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	return s.deleteMetadata(ctx, userDirectory, bucket, key)
 }
 
 func (s *ObjectService) statObject(ctx context.Context, userDirectory, bucket, key, fullPath string, metadataByKey map[string]ObjectMetadata) (ObjectInfo, error) {
-	stat, err := os.Stat(fullPath)
+	stat, err := s.storage.Stat(fullPath)
 	if err != nil {
 		return ObjectInfo{}, err
 	}
@@ -471,7 +605,7 @@ func (s *ObjectService) statObject(ctx context.Context, userDirectory, bucket, k
 		}
 	}
 	if etag == "" {
-		etag, err = fallbackETag(fullPath, stat)
+		etag, err = fallbackETag(s.storage, fullPath, stat)
 		if err != nil {
 			return ObjectInfo{}, err
 		}
@@ -508,8 +642,8 @@ func (s *ObjectService) deleteMetadata(ctx context.Context, userDirectory, bucke
 	return s.metadataRepo.Delete(ctx, userDirectory, bucket, key)
 }
 
-func fallbackETag(path string, stat os.FileInfo) (string, error) {
-	file, err := os.Open(path)
+func fallbackETag(b storage.Backend, path string, stat os.FileInfo) (string, error) {
+	file, err := b.Open(path)
 	if err != nil {
 		return "", err
 	}
@@ -520,3 +654,12 @@ func fallbackETag(path string, stat os.FileInfo) (string, error) {
 	}
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
+
+// objectPermissionPath returns the rule-matching path of bucket/key below the owner's directory.
+func objectPermissionPath(owner *user.User, bucket, key string) string {
+	root := owner.Directory
+	if strings.TrimSpace(root) == "" {
+		root = owner.Username
+	}
+	return path.Join(filepath.ToSlash(root), bucket, key)
+}
@@ -3,12 +3,15 @@ package service
 import (
 	"context"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 )
 
 func TestObjectServicePutListOpenDelete(t *testing.T) {
@@ -50,6 +53,40 @@ func TestObjectServicePutListOpenDelete(t *testing.T) {
 	}
 }
 
+func TestObjectServiceRunsOnMemoryStorage(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "not-created")
+	backend := storage.NewMemory()
+	svc := NewObjectService(root)
+	svc.SetStorage(backend)
+	ctx := context.Background()
+
+	if _, err := svc.Put(ctx, "alice", "personal", "docs/note.txt", strings.NewReader("hello")); err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Fatalf("memory backend must not touch the host filesystem, got err=%v", err)
+	}
+	listed, err := svc.List(ctx, "alice", "personal", "", 0)
+	if err != nil || len(listed.Objects) != 1 || listed.Objects[0].Size != 5 {
+		t.Fatalf("unexpected list result: %+v err=%v", listed, err)
+	}
+	file, _, err := svc.Open(ctx, "alice", "personal", "docs/note.txt")
+	if err != nil {
+		t.Fatalf("open object: %v", err)
+	}
+	content, _ := io.ReadAll(file)
+	_ = file.Close()
+	if string(content) != "hello" {
+		t.Fatalf("unexpected content: %q", content)
+	}
+	if err := svc.Delete(ctx, "alice", "personal", "docs/note.txt"); err != nil {
+		t.Fatalf("delete object: %v", err)
+	}
+	if _, err := backend.Stat(filepath.Join(root, "alice", "personal", "docs", "note.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expected object to be deleted, got err=%v", err)
+	}
+}
+
 func TestObjectServiceListReturnsPrefixes(t *testing.T) {
 	root := t.TempDir()
 	svc := NewObjectService(root)
@@ -158,3 +195,32 @@ func (r *testObjectMetadataRepo) ListByPrefix(_ context.Context, userDirectory,
 func (r *testObjectMetadataRepo) key(userDirectory, bucket, key string) string {
 	return userDirectory + "|" + bucket + "|" + key
 }
+
+func TestObjectServicePutEnforcesUploadPolicy(t *testing.T) {
+	root := t.TempDir()
+	svc := NewObjectService(root)
+	cfg := &config.Config{}
+	cfg.WebDAV.Directory = root
+	cfg.Upload.MaxFileSize = 8
+	cfg.Upload.DenyExtensions = []string{".exe"}
+	svc.SetUploadPolicyEnforcer(NewUploadPolicyEnforcer(cfg))
+	owner := &user.User{Username: "alice", Directory: "alice"}
+	ctx := context.Background()
+
+	if _, err := svc.PutForUser(ctx, owner, "personal", "ok.txt", strings.NewReader("small")); err != nil {
+		t.Fatalf("put within policy: %v", err)
+	}
+
+	_, err := svc.PutForUser(ctx, owner, "personal", "big.txt", strings.NewReader("way too large"))
+	if status, code, ok := UploadPolicyStatus(err); !ok || status != http.StatusRequestEntityTooLarge || code != user.UploadPolicyFileTooLarge {
+		t.Fatalf("expected FILE_TOO_LARGE, got %v", err)
+	}
+	if _, statErr := os.Stat(filepath.Join(root, "alice", "personal", "big.txt")); !os.IsNotExist(statErr) {
+		t.Fatalf("rejected object must not be written, got err=%v", statErr)
+	}
+
+	_, err = svc.PutForUser(ctx, owner, "personal", "setup.exe", strings.NewReader("x"))
+	if status, _, ok := UploadPolicyStatus(err); !ok || status != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected FILE_TYPE_NOT_ALLOWED, got %v", err)
+	}
+}
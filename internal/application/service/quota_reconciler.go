@@ -176,6 +176,67 @@ func (r *QuotaReconciler) ReconcileOnce(ctx context.Context) error {
 	return nil
 }
 
+// QuotaRebuildResult summarizes an on-demand quota rebuild.
+type QuotaRebuildResult struct {
+	Checked  int      `json:"checked"`
+	Repaired int      `json:"repaired"`
+	Failed   []string `json:"failed,omitempty"`
+}
+
+// Rebuild recalculates used_space for username, or for every user when
+// username is empty, regardless of the auto reconcile settings. progress is
+// called before each user and once at the end with (total, done).
+func (r *QuotaReconciler) Rebuild(ctx context.Context, username string, progress func(total, done int)) (*QuotaRebuildResult, error) {
+	var users []*user.User
+	if username = strings.TrimSpace(username); username != "" {
+		u, err := r.users.FindByUsername(ctx, username)
+		if err != nil {
+			return nil, err
+		}
+		users = []*user.User{u}
+	} else {
+		all, err := r.users.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range all {
+			if u != nil {
+				users = append(users, u)
+			}
+		}
+	}
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+
+	result := &QuotaRebuildResult{}
+	for i, u := range users {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		progress(len(users), i)
+		result.Checked++
+		changed, err := r.reconcileUser(ctx, u)
+		if err != nil {
+			result.Failed = append(result.Failed, u.Username)
+			if r.logger != nil {
+				r.logger.Warn("quota rebuild user failed",
+					zap.String("username", u.Username),
+					zap.Error(err))
+			}
+			continue
+		}
+		if changed {
+			result.Repaired++
+		}
+	}
+	progress(len(users), len(users))
+	if len(result.Failed) > 0 {
+		return result, fmt.Errorf("quota rebuild failed for %d users", len(result.Failed))
+	}
+	return result, nil
+}
+
 func countQuotaReconcileUsers(users []*user.User) int {
 	var count int
 	for _, u := range users {
@@ -221,6 +282,7 @@ func (r *QuotaReconciler) reconcileUser(ctx context.Context, u *user.User) (bool
 			zap.Int64("after_used_space", snapshot.TotalUsed),
 			zap.Int64("active_used", snapshot.ActiveUsed),
 			zap.Int64("recycle_used", snapshot.RecycleUsed),
+			zap.Int64("version_used", snapshot.VersionUsed),
 			zap.String("quota_status", quotaUsageStatus(u, snapshot)),
 			zap.String("quota_usage_percent", quotaUsagePercentText(u, snapshot)))
 	}
@@ -243,6 +305,7 @@ func (r *QuotaReconciler) logQuotaRisk(u *user.User, snapshot *QuotaUsageSnapsho
 		zap.Int64("used_space", snapshot.TotalUsed),
 		zap.Int64("active_used", snapshot.ActiveUsed),
 		zap.Int64("recycle_used", snapshot.RecycleUsed),
+		zap.Int64("version_used", snapshot.VersionUsed),
 		zap.String("quota_status", status),
 		zap.String("quota_usage_percent", quotaUsagePercentText(u, snapshot)),
 	}
@@ -15,6 +15,7 @@ import (
 type QuotaUsageSnapshot struct {
 	ActiveUsed  int64
 	RecycleUsed int64
+	VersionUsed int64
 	TotalUsed   int64
 	UserDir     string
 }
@@ -59,21 +60,33 @@ func CalculateQuotaUsage(
 		recycleUsed += item.Size
 	}
 
+	versionUsed, err := VersionStorageUsage(cfg, u)
+	if err != nil {
+		return nil, fmt.Errorf("calculate version used space: %w", err)
+	}
+
 	return &QuotaUsageSnapshot{
 		ActiveUsed:  activeUsed,
 		RecycleUsed: recycleUsed,
-		TotalUsed:   activeUsed + recycleUsed,
+		VersionUsed: versionUsed,
+		TotalUsed:   activeUsed + recycleUsed + versionUsed,
 		UserDir:     userDir,
 	}, nil
 }
 
 // ResolveQuotaUserDirectory returns the user root directory used by quota scanning.
 func ResolveQuotaUserDirectory(cfg *config.Config, u *user.User) string {
+	return ResolveUserRoot(cfg, u)
+}
+
+// ResolveUserRoot returns the on-disk root of u's tree on the volume it lives
+// on; users without a directory see the whole webdav.directory.
+func ResolveUserRoot(cfg *config.Config, u *user.User) string {
 	if u.Directory != "" {
 		if filepath.IsAbs(u.Directory) {
 			return u.Directory
 		}
-		return filepath.Join(cfg.WebDAV.Directory, u.Directory)
+		return filepath.Join(userVolumeBase(cfg, u.Volume, u.Directory), u.Directory)
 	}
 	return cfg.WebDAV.Directory
 }
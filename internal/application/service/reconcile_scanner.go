@@ -8,11 +8,14 @@ import (
 	"strings"
 
 	"github.com/yeying-community/warehouse/internal/domain/replication"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 )
 
 // ReconcileScanner walks local webdav data and produces reconcile items.
 type ReconcileScanner struct {
 	root string
+	// extraRoots are additional volumes; their trees share root's namespace.
+	extraRoots []string
 }
 
 // NewReconcileScanner creates a scanner for one webdav root.
@@ -24,10 +27,37 @@ func NewReconcileScanner(root string) (*ReconcileScanner, error) {
 	return &ReconcileScanner{root: filepath.Clean(abs)}, nil
 }
 
-// Scan returns all paths under root as pending reconcile items.
+// SetVolumes adds the additional volumes to every scan.
+func (s *ReconcileScanner) SetVolumes(volumes *storage.Volumes) error {
+	s.extraRoots = nil
+	for _, volume := range volumes.List()[1:] {
+		abs, err := filepath.Abs(volume.Path)
+		if err != nil {
+			return fmt.Errorf("resolve volume %s: %w", volume.Name, err)
+		}
+		s.extraRoots = append(s.extraRoots, filepath.Clean(abs))
+	}
+	return nil
+}
+
+// Scan returns all paths under root and the additional volumes as pending
+// reconcile items, keyed by their logical path.
 func (s *ReconcileScanner) Scan(ctx context.Context) ([]*replication.ReconcileItem, error) {
 	items := make([]*replication.ReconcileItem, 0, 256)
-	err := filepath.WalkDir(s.root, func(path string, d fs.DirEntry, walkErr error) error {
+	seen := make(map[string]bool)
+	for _, root := range append([]string{s.root}, s.extraRoots...) {
+		scanned, err := s.scanRoot(ctx, root, seen)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, scanned...)
+	}
+	return items, nil
+}
+
+func (s *ReconcileScanner) scanRoot(ctx context.Context, root string, seen map[string]bool) ([]*replication.ReconcileItem, error) {
+	items := make([]*replication.ReconcileItem, 0, 256)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
@@ -37,7 +67,7 @@ func (s *ReconcileScanner) Scan(ctx context.Context) ([]*replication.ReconcileIt
 		default:
 		}
 
-		rel, err := filepath.Rel(s.root, path)
+		rel, err := filepath.Rel(root, path)
 		if err != nil {
 			return fmt.Errorf("compute relative path for %q: %w", path, err)
 		}
@@ -52,8 +82,13 @@ func (s *ReconcileScanner) Scan(ctx context.Context) ([]*replication.ReconcileIt
 			return nil
 		}
 
+		logicalPath := "/" + strings.TrimPrefix(rel, "/")
+		if seen[logicalPath] {
+			return nil
+		}
+		seen[logicalPath] = true
 		item := &replication.ReconcileItem{
-			Path:  "/" + strings.TrimPrefix(rel, "/"),
+			Path:  logicalPath,
 			IsDir: d.IsDir(),
 			State: replication.ReconcileItemStatePending,
 		}
@@ -71,7 +106,7 @@ func (s *ReconcileScanner) Scan(ctx context.Context) ([]*replication.ReconcileIt
 		return nil
 	})
 	if err != nil {
-		return nil, fmt.Errorf("scan reconcile root %q: %w", s.root, err)
+		return nil, fmt.Errorf("scan reconcile root %q: %w", root, err)
 	}
 
 	return items, nil
@@ -89,7 +124,7 @@ func shouldSkipReconcilePath(rel string, isDir bool) bool {
 	base := parts[len(parts)-1]
 
 	switch parts[0] {
-	case ".recycle", ".warehouse-uploads", ".s3-multipart":
+	case ".recycle", ".warehouse-uploads", ".s3-multipart", storage.MovingDir, ThumbnailsDirName:
 		return true
 	}
 	if strings.HasPrefix(base, "._upload-") ||
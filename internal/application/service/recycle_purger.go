@@ -0,0 +1,277 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+// RecyclePurger periodically purges recycle items whose retention expired and
+// warns their owners ahead of time.
+type RecyclePurger struct {
+	config          *config.Config
+	users           user.Repository
+	recycleRepo     repository.RecycleRepository
+	recycleSvc      *RecycleService
+	notificationSvc *NotificationService
+	logger          *zap.Logger
+	interval        time.Duration
+	now             func() time.Time
+}
+
+// RecyclePurgeOptions controls a single purge pass.
+type RecyclePurgeOptions struct {
+	// DryRun reports expired items without deleting anything or sending warnings.
+	DryRun bool
+	// Username limits the pass to one user.
+	Username string
+}
+
+// RecyclePurgeItem is an expired item reported by a dry run.
+type RecyclePurgeItem struct {
+	Username  string    `json:"username"`
+	Hash      string    `json:"hash"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// RecyclePurgeReport summarizes a purge pass.
+type RecyclePurgeReport struct {
+	DryRun        bool               `json:"dry_run"`
+	Users         int                `json:"users"`
+	Scanned       int                `json:"scanned"`
+	Expired       int                `json:"expired"`
+	Purged        int                `json:"purged"`
+	Failed        int                `json:"failed"`
+	ReleasedBytes int64              `json:"released_bytes"`
+	Warned        int                `json:"warned"`
+	Items         []RecyclePurgeItem `json:"items,omitempty"`
+}
+
+// NewRecyclePurger creates a background recycle retention worker.
+func NewRecyclePurger(
+	cfg *config.Config,
+	users user.Repository,
+	recycleRepo repository.RecycleRepository,
+	recycleSvc *RecycleService,
+	logger *zap.Logger,
+) *RecyclePurger {
+	if cfg == nil || users == nil || recycleRepo == nil || recycleSvc == nil {
+		return nil
+	}
+	return &RecyclePurger{
+		config:      cfg,
+		users:       users,
+		recycleRepo: recycleRepo,
+		recycleSvc:  recycleSvc,
+		logger:      logger,
+		interval:    cfg.Recycle.PurgeInterval,
+		now:         time.Now,
+	}
+}
+
+// SetNotificationService enables purge warnings.
+func (p *RecyclePurger) SetNotificationService(notificationSvc *NotificationService) {
+	if p == nil {
+		return
+	}
+	p.notificationSvc = notificationSvc
+}
+
+// Enabled reports whether automatic recycle purging should run on this node.
+func (p *RecyclePurger) Enabled() bool {
+	if p == nil || p.config == nil {
+		return false
+	}
+	if !p.config.Recycle.PurgeEnabled || p.config.Recycle.PurgeInterval <= 0 {
+		return false
+	}
+	return !strings.EqualFold(strings.TrimSpace(p.config.Node.Role), "standby")
+}
+
+// Run starts the periodic purge loop until ctx is canceled.
+func (p *RecyclePurger) Run(ctx context.Context) {
+	if !p.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	if p.logger != nil {
+		p.logger.Info("recycle purger started",
+			zap.Duration("interval", p.interval),
+			zap.Int("retention_days", p.config.Recycle.RetentionDays),
+			zap.Duration("warn_before", p.config.Recycle.WarnBefore))
+		defer p.logger.Info("recycle purger stopped")
+	}
+
+	p.runPass(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.runPass(ctx)
+		}
+	}
+}
+
+func (p *RecyclePurger) runPass(ctx context.Context) {
+	report, err := p.PurgeOnce(ctx, RecyclePurgeOptions{})
+	if err != nil {
+		if !errors.Is(err, context.Canceled) && p.logger != nil {
+			p.logger.Warn("recycle purge pass failed", zap.Error(err))
+		}
+		return
+	}
+	if p.logger != nil {
+		p.logger.Info("recycle purge pass finished",
+			zap.Int("user_count", report.Users),
+			zap.Int("scanned_count", report.Scanned),
+			zap.Int("purged_count", report.Purged),
+			zap.Int("failed_count", report.Failed),
+			zap.Int64("released_bytes", report.ReleasedBytes),
+			zap.Int("warned_count", report.Warned))
+	}
+}
+
+// PurgeOnce scans recycle items once, purging expired ones and warning users
+// about items that expire within recycle.warn_before.
+func (p *RecyclePurger) PurgeOnce(ctx context.Context, opts RecyclePurgeOptions) (*RecyclePurgeReport, error) {
+	report := &RecyclePurgeReport{DryRun: opts.DryRun}
+	users, err := p.listUsers(ctx, opts.Username)
+	if err != nil {
+		return report, err
+	}
+	now := p.now()
+	for _, u := range users {
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		default:
+		}
+		if u == nil {
+			continue
+		}
+		report.Users++
+		if err := p.purgeUser(ctx, u, now, opts, report); err != nil {
+			report.Failed++
+			if p.logger != nil {
+				p.logger.Warn("recycle purge user failed",
+					zap.String("username", u.Username),
+					zap.Error(err))
+			}
+		}
+	}
+	return report, nil
+}
+
+func (p *RecyclePurger) listUsers(ctx context.Context, username string) ([]*user.User, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return p.users.List(ctx)
+	}
+	u, err := p.users.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	return []*user.User{u}, nil
+}
+
+type recyclePurgeWarning struct {
+	count   int
+	size    int64
+	purgeAt time.Time
+}
+
+func (p *RecyclePurger) purgeUser(ctx context.Context, u *user.User, now time.Time, opts RecyclePurgeOptions, report *RecyclePurgeReport) error {
+	days := recycleRetentionDays(u, p.config.Recycle.RetentionDays)
+	if days <= 0 {
+		return nil
+	}
+	retention := time.Duration(days) * 24 * time.Hour
+	items, err := p.recycleRepo.GetByUserID(ctx, u.ID)
+	if err != nil {
+		return err
+	}
+
+	warnBefore := p.config.Recycle.WarnBefore
+	warnings := make(map[string]*recyclePurgeWarning)
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		report.Scanned++
+		purgeAt := item.DeletedAt.Add(retention)
+		if now.Before(purgeAt) {
+			if warnBefore > 0 && purgeAt.Sub(now) <= warnBefore {
+				// Group by purge day so one notification covers a day's batch.
+				day := purgeAt.UTC().Format("2006-01-02")
+				warning := warnings[day]
+				if warning == nil {
+					warning = &recyclePurgeWarning{purgeAt: purgeAt}
+					warnings[day] = warning
+				}
+				warning.count++
+				warning.size += item.Size
+				if purgeAt.Before(warning.purgeAt) {
+					warning.purgeAt = purgeAt
+				}
+			}
+			continue
+		}
+		report.Expired++
+		if opts.DryRun {
+			report.Items = append(report.Items, RecyclePurgeItem{
+				Username:  u.Username,
+				Hash:      item.Hash,
+				Path:      item.Path,
+				Size:      item.Size,
+				DeletedAt: item.DeletedAt,
+				PurgeAt:   purgeAt,
+			})
+			continue
+		}
+		if err := p.recycleSvc.PurgeItem(ctx, u, item); err != nil {
+			report.Failed++
+			if p.logger != nil {
+				p.logger.Warn("failed to purge recycle item",
+					zap.String("username", u.Username),
+					zap.String("hash", item.Hash),
+					zap.Error(err))
+			}
+			continue
+		}
+		report.Purged++
+		report.ReleasedBytes += item.Size
+	}
+
+	warningDays := make([]string, 0, len(warnings))
+	for day := range warnings {
+		warningDays = append(warningDays, day)
+	}
+	sort.Strings(warningDays)
+	for _, day := range warningDays {
+		warning := warnings[day]
+		report.Warned += warning.count
+		if opts.DryRun || p.notificationSvc == nil {
+			continue
+		}
+		if err := p.notificationSvc.NotifyRecyclePurge(ctx, u, warning.count, warning.size, warning.purgeAt); err != nil && p.logger != nil {
+			p.logger.Warn("failed to send recycle purge warning",
+				zap.String("username", u.Username),
+				zap.Error(err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/recycle"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func TestRecyclePurgerPurgesExpiredItems(t *testing.T) {
+	t.Parallel()
+
+	rootDir := t.TempDir()
+	cfg := &config.Config{
+		WebDAV: config.WebDAVConfig{Directory: rootDir},
+		Recycle: config.RecycleConfig{
+			RetentionDays: 30,
+			PurgeEnabled:  true,
+			PurgeInterval: time.Hour,
+			WarnBefore:    72 * time.Hour,
+		},
+	}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	userRepo := newTestUserRepo()
+	alice := user.NewUser("alice", "alice")
+	alice.UsedSpace = 100
+	bob := user.NewUser("bob", "bob")
+	bob.RecycleRetentionDays = -1
+	for _, u := range []*user.User{alice, bob} {
+		if err := userRepo.Save(context.Background(), u); err != nil {
+			t.Fatalf("save user: %v", err)
+		}
+	}
+
+	recycleDir := filepath.Join(rootDir, ".recycle")
+	if err := os.MkdirAll(recycleDir, 0o755); err != nil {
+		t.Fatalf("mkdir recycle dir: %v", err)
+	}
+	recycleRepo := &memoryRecycleRepo{items: map[string]*recycle.RecycleItem{}}
+	seed := func(u *user.User, name string, age time.Duration, size int64) *recycle.RecycleItem {
+		item := recycle.NewRecycleItem(u.ID, u.Username, u.Directory, name, "/personal/"+name, false, size)
+		item.DeletedAt = now.Add(-age)
+		recycleRepo.items[item.Hash] = item
+		if err := os.WriteFile(filepath.Join(recycleDir, item.Hash+"_"+name), make([]byte, size), 0o644); err != nil {
+			t.Fatalf("seed recycle file: %v", err)
+		}
+		return item
+	}
+	expired := seed(alice, "old.txt", 31*24*time.Hour, 10)
+	expiring := seed(alice, "soon.txt", 29*24*time.Hour, 5)
+	seed(alice, "fresh.txt", time.Hour, 5)
+	kept := seed(bob, "forever.txt", 400*24*time.Hour, 7)
+
+	recycleSvc := NewRecycleService(recycleRepo, userRepo, nil, cfg, zap.NewNop())
+	purger := NewRecyclePurger(cfg, userRepo, recycleRepo, recycleSvc, zap.NewNop())
+	purger.now = func() time.Time { return now }
+
+	report, err := purger.PurgeOnce(context.Background(), RecyclePurgeOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Expired != 1 || report.Purged != 0 || len(report.Items) != 1 || report.Items[0].Hash != expired.Hash {
+		t.Fatalf("unexpected dry-run report: %+v", report)
+	}
+	if _, ok := recycleRepo.items[expired.Hash]; !ok {
+		t.Fatalf("dry run must not delete records")
+	}
+
+	report, err = purger.PurgeOnce(context.Background(), RecyclePurgeOptions{})
+	if err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+	if report.Purged != 1 || report.ReleasedBytes != 10 || report.Warned != 1 {
+		t.Fatalf("unexpected purge report: %+v", report)
+	}
+	if _, ok := recycleRepo.items[expired.Hash]; ok {
+		t.Fatalf("expired record should be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(recycleDir, expired.Hash+"_old.txt")); !os.IsNotExist(err) {
+		t.Fatalf("expired payload should be deleted, got err=%v", err)
+	}
+	if _, ok := recycleRepo.items[expiring.Hash]; !ok {
+		t.Fatalf("item within retention must be kept")
+	}
+	if _, ok := recycleRepo.items[kept.Hash]; !ok {
+		t.Fatalf("user with unlimited retention must be skipped")
+	}
+	stored, _ := userRepo.FindByUsername(context.Background(), "alice")
+	if stored.UsedSpace != 90 {
+		t.Fatalf("expected used space 90 after purge, got %d", stored.UsedSpace)
+	}
+}
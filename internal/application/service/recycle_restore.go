@@ -0,0 +1,412 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
+	"github.com/yeying-community/warehouse/internal/domain/recycle"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+// 恢复冲突策略：目标路径已存在时的处理方式
+const (
+	RecoverConflictFail      = "fail"      // 报错（默认，兼容旧行为）
+	RecoverConflictRename    = "rename"    // 追加 " (1)" 等后缀后恢复
+	RecoverConflictOverwrite = "overwrite" // 先把已存在的目标移入回收站再恢复
+	RecoverConflictSkip      = "skip"      // 跳过，项目保留在回收站
+)
+
+// 恢复结果状态
+const (
+	RecoverStatusRestored    = "restored"
+	RecoverStatusRenamed     = "renamed"
+	RecoverStatusOverwritten = "overwritten"
+	RecoverStatusSkipped     = "skipped"
+	RecoverStatusFailed      = "failed"
+)
+
+var (
+	// ErrRecoverTargetExists 目标路径已存在且冲突策略为 fail
+	ErrRecoverTargetExists = errors.New("file already exists at target path")
+	// ErrRecoverParentNotDir 目标路径的某一级父路径已被文件占用
+	ErrRecoverParentNotDir = errors.New("target parent is not a directory")
+	// ErrInvalidRecoverOptions 恢复参数不合法
+	ErrInvalidRecoverOptions = errors.New("invalid recover options")
+)
+
+// RecoverOptions 恢复选项；均为空时恢复到原路径，目标已存在则报错
+type RecoverOptions struct {
+	// TargetPath 恢复后的完整路径（相对用户根目录），仅适用于单个项目
+	TargetPath string
+	// TargetDir 恢复到的目录（相对用户根目录），保留原名称
+	TargetDir string
+	// Conflict 冲突策略：fail / rename / overwrite / skip
+	Conflict string
+}
+
+// RecoverResult 单个项目的恢复结果
+type RecoverResult struct {
+	Hash           string   `json:"hash"`
+	OriginalPath   string   `json:"originalPath"`
+	Path           string   `json:"path,omitempty"`
+	Status         string   `json:"status"`
+	Error          string   `json:"error,omitempty"`
+	CreatedParents []string `json:"createdParents,omitempty"`
+}
+
+// NormalizeRecoverConflict 规范化冲突策略，空值视为 fail
+func NormalizeRecoverConflict(raw string) (string, error) {
+	switch value := strings.ToLower(strings.TrimSpace(raw)); value {
+	case "":
+		return RecoverConflictFail, nil
+	case RecoverConflictFail, RecoverConflictRename, RecoverConflictOverwrite, RecoverConflictSkip:
+		return value, nil
+	default:
+		return "", fmt.Errorf("%w: unknown conflict policy %q", ErrInvalidRecoverOptions, raw)
+	}
+}
+
+// RecoverWithOptions 按选项恢复单个项目；跳过时返回 skipped 结果且不报错
+func (s *RecycleService) RecoverWithOptions(ctx context.Context, u *user.User, hash string, opts RecoverOptions) (*RecoverResult, error) {
+	conflict, err := NormalizeRecoverConflict(opts.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	opts.Conflict = conflict
+
+	item, err := s.recycleRepo.GetByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	// 验证所有权
+	if item.UserID != u.ID {
+		return nil, fmt.Errorf("permission denied: not your file")
+	}
+	return s.recoverItem(ctx, u, item, opts)
+}
+
+// RecoverMany 批量恢复；单个项目失败不会中断其余项目，失败原因记录在结果中
+func (s *RecycleService) RecoverMany(ctx context.Context, u *user.User, hashes []string, opts RecoverOptions) ([]*RecoverResult, error) {
+	conflict, err := NormalizeRecoverConflict(opts.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	opts.Conflict = conflict
+	if len(hashes) == 0 {
+		return nil, fmt.Errorf("%w: no items to recover", ErrInvalidRecoverOptions)
+	}
+	if len(hashes) > 1 && strings.TrimSpace(opts.TargetPath) != "" {
+		return nil, fmt.Errorf("%w: targetPath only applies to a single item, use targetDir", ErrInvalidRecoverOptions)
+	}
+
+	items := make([]*recycle.RecycleItem, 0, len(hashes))
+	results := make([]*RecoverResult, 0, len(hashes))
+	seen := make(map[string]struct{}, len(hashes))
+	for _, hash := range hashes {
+		hash = strings.TrimSpace(hash)
+		if hash == "" {
+			continue
+		}
+		if _, ok := seen[hash]; ok {
+			continue
+		}
+		seen[hash] = struct{}{}
+		item, err := s.recycleRepo.GetByHash(ctx, hash)
+		if err == nil && item.UserID != u.ID {
+			err = recycle.ErrRecycleItemNotFound
+		}
+		if err != nil {
+			results = append(results, &RecoverResult{Hash: hash, Status: RecoverStatusFailed, Error: err.Error()})
+			continue
+		}
+		items = append(items, item)
+	}
+	return append(results, s.recoverItems(ctx, u, items, sameRecoverOptions(opts))...), nil
+}
+
+// RecoverBatch 恢复同一删除批次的全部项目（“恢复到删除时的状态”）；客户端逐项递归删除的
+// 目录树归入同一批次，指定 TargetDir 时保持项目之间的相对层级
+func (s *RecycleService) RecoverBatch(ctx context.Context, u *user.User, batchID string, opts RecoverOptions) ([]*RecoverResult, error) {
+	conflict, err := NormalizeRecoverConflict(opts.Conflict)
+	if err != nil {
+		return nil, err
+	}
+	opts.Conflict = conflict
+	batchID = strings.TrimSpace(batchID)
+	if batchID == "" {
+		return nil, fmt.Errorf("%w: batch id is required", ErrInvalidRecoverOptions)
+	}
+
+	all, err := s.recycleRepo.GetByUserID(ctx, u.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list recycle items: %w", err)
+	}
+	var items []*recycle.RecycleItem
+	for _, item := range all {
+		if item != nil && item.DeletionBatch() == batchID {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil, recycle.ErrRecycleItemNotFound
+	}
+	if len(items) > 1 && strings.TrimSpace(opts.TargetPath) != "" {
+		return nil, fmt.Errorf("%w: targetPath only applies to a single item, use targetDir", ErrInvalidRecoverOptions)
+	}
+	return s.recoverItems(ctx, u, items, batchRecoverOptions(items, opts)), nil
+}
+
+func sameRecoverOptions(opts RecoverOptions) func(*recycle.RecycleItem) RecoverOptions {
+	return func(*recycle.RecycleItem) RecoverOptions { return opts }
+}
+
+// batchRecoverOptions keeps the layout of a recursive delete when a batch is
+// restored into TargetDir: every item is placed relative to the directory the
+// batch was deleted from instead of being flattened into TargetDir.
+func batchRecoverOptions(items []*recycle.RecycleItem, opts RecoverOptions) func(*recycle.RecycleItem) RecoverOptions {
+	targetDir := strings.TrimSpace(opts.TargetDir)
+	if targetDir == "" || len(items) < 2 {
+		return sameRecoverOptions(opts)
+	}
+	var common []string
+	for i, item := range items {
+		parts := strings.Split(path.Dir(rootedRecyclePath(item.Path)), "/")
+		if i == 0 {
+			common = parts
+			continue
+		}
+		n := 0
+		for n < len(common) && n < len(parts) && common[n] == parts[n] {
+			n++
+		}
+		common = common[:n]
+	}
+	base := strings.Join(common, "/")
+	return func(item *recycle.RecycleItem) RecoverOptions {
+		itemOpts := opts
+		itemOpts.TargetDir = ""
+		rel := strings.TrimPrefix(strings.TrimPrefix(rootedRecyclePath(item.Path), base), "/")
+		itemOpts.TargetPath = strings.TrimSuffix(targetDir, "/") + "/" + rel
+		return itemOpts
+	}
+}
+
+func rootedRecyclePath(p string) string {
+	return path.Clean("/" + strings.TrimLeft(filepath.ToSlash(p), "/"))
+}
+
+// recoverItems 按路径深度升序恢复，保证目录先于其中的项目恢复
+func (s *RecycleService) recoverItems(ctx context.Context, u *user.User, items []*recycle.RecycleItem, optsFor func(*recycle.RecycleItem) RecoverOptions) []*RecoverResult {
+	sort.SliceStable(items, func(i, j int) bool {
+		return strings.Count(items[i].Path, "/") < strings.Count(items[j].Path, "/")
+	})
+	results := make([]*RecoverResult, 0, len(items))
+	for _, item := range items {
+		result, err := s.recoverItem(ctx, u, item, optsFor(item))
+		if err != nil {
+			result = &RecoverResult{
+				Hash:         item.Hash,
+				OriginalPath: item.Path,
+				Status:       RecoverStatusFailed,
+				Error:        err.Error(),
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+func (s *RecycleService) recoverItem(ctx context.Context, u *user.User, item *recycle.RecycleItem, opts RecoverOptions) (*RecoverResult, error) {
+	if err := enforceAppScope(ctx, s.config, item.Path, "update", "create"); err != nil {
+		return nil, err
+	}
+	relPath, err := recoverTargetRelPath(NamePolicy(s.config), item, opts)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.ToSlash(relPath) != item.Path {
+		if err := enforceAppScope(ctx, s.config, filepath.ToSlash(relPath), "update", "create"); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &RecoverResult{Hash: item.Hash, OriginalPath: item.Path, Status: RecoverStatusRestored}
+	userRoot := s.getUserRootDir(u)
+	fullPath := NamePolicy(s.config).WithFS(s.storage).Resolve(userRoot, filepath.Join(userRoot, relPath))
+
+	// 目标已存在时按冲突策略处理
+	if _, err := s.storage.Lstat(fullPath); err == nil {
+		switch opts.Conflict {
+		case RecoverConflictSkip:
+			result.Status = RecoverStatusSkipped
+			result.Path = item.Path
+			return result, nil
+		case RecoverConflictRename:
+			fullPath = uniqueExtractPath(s.storage, fullPath)
+			result.Status = RecoverStatusRenamed
+		case RecoverConflictOverwrite:
+			if err := s.recycleExisting(ctx, u, userRoot, fullPath); err != nil {
+				return nil, err
+			}
+			result.Status = RecoverStatusOverwritten
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrRecoverTargetExists, filepath.ToSlash(relPath))
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to stat target path: %w", err)
+	} else if err := NamePolicy(s.config).WithFS(s.storage).CheckCollision(fullPath); err != nil {
+		return nil, err
+	}
+
+	// 逐级重建缺失的父目录
+	created, err := s.ensureRecoverParents(ctx, userRoot, filepath.Dir(fullPath))
+	if err != nil {
+		return nil, err
+	}
+	result.CreatedParents = created
+
+	// 从回收站存储目录恢复
+	recyclePath, err := s.findRecyclePath(item)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate recycle file: %w", err)
+	}
+	recycleInfo, err := s.storage.Stat(recyclePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat recycle file: %w", err)
+	}
+	if err := s.storage.Rename(recyclePath, fullPath); err != nil {
+		return nil, fmt.Errorf("failed to restore file: %w", err)
+	}
+	if err := s.mutationRecorder.MovePath(ctx, recyclePath, fullPath, recycleInfo.IsDir()); err != nil {
+		return nil, fmt.Errorf("failed to record recycle recover event: %w", err)
+	}
+
+	restored, _ := filepath.Rel(userRoot, fullPath)
+	result.Path = filepath.ToSlash(restored)
+	s.logger.Info("recovering file",
+		zap.String("username", u.Username),
+		zap.String("file", item.Path),
+		zap.String("target", result.Path),
+		zap.String("status", result.Status),
+		zap.String("hash", item.Hash),
+	)
+
+	// 从数据库中删除记录（标记为已恢复）
+	if err := s.recycleRepo.DeleteByHash(ctx, item.Hash); err != nil {
+		return nil, fmt.Errorf("failed to remove from recycle bin: %w", err)
+	}
+	return result, nil
+}
+
+// recoverTargetRelPath 计算恢复目标相对路径：TargetPath > TargetDir/原名称 > 原路径
+func recoverTargetRelPath(names pathname.Policy, item *recycle.RecycleItem, opts RecoverOptions) (string, error) {
+	raw := item.Path
+	if target := strings.TrimSpace(opts.TargetPath); target != "" {
+		raw = target
+	} else if dir := strings.TrimSpace(opts.TargetDir); dir != "" {
+		raw = strings.TrimSuffix(dir, "/") + "/" + item.Name
+	}
+	relPath := filepath.Clean(filepath.FromSlash(strings.TrimPrefix(names.Normalize(raw), "/")))
+	if relPath == "." || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		if raw == item.Path {
+			return "", fmt.Errorf("invalid original path: %s", item.Path)
+		}
+		return "", fmt.Errorf("%w: invalid target path %q", ErrInvalidRecoverOptions, raw)
+	}
+	return relPath, nil
+}
+
+// ensureRecoverParents 从用户根目录逐级创建缺失的父目录并记录复制事件，
+// 返回新建的目录（相对用户根目录）；某一级已被文件占用时返回 ErrRecoverParentNotDir
+func (s *RecycleService) ensureRecoverParents(ctx context.Context, userRoot, dir string) ([]string, error) {
+	rel, err := filepath.Rel(userRoot, dir)
+	if err != nil || rel == "." {
+		if err := s.storage.MkdirAll(userRoot, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create target directory: %w", err)
+		}
+		return nil, nil
+	}
+	var created []string
+	current := userRoot
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		info, err := s.storage.Stat(current)
+		if err == nil {
+			if !info.IsDir() {
+				relCurrent, _ := filepath.Rel(userRoot, current)
+				return created, fmt.Errorf("%w: %s", ErrRecoverParentNotDir, filepath.ToSlash(relCurrent))
+			}
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return created, fmt.Errorf("failed to stat target directory: %w", err)
+		}
+		if err := s.storage.MkdirAll(current, 0755); err != nil {
+			return created, fmt.Errorf("failed to create target directory: %w", err)
+		}
+		if err := s.mutationRecorder.EnsureDir(ctx, current); err != nil {
+			return created, fmt.Errorf("failed to record target directory ensure event: %w", err)
+		}
+		relCurrent, _ := filepath.Rel(userRoot, current)
+		created = append(created, filepath.ToSlash(relCurrent))
+	}
+	return created, nil
+}
+
+// RecycleExisting 把用户目录内即将被覆盖的文件或目录移入回收站，避免直接丢弃数据；
+// 回收站中的内容仍计入配额
+func (s *RecycleService) RecycleExisting(ctx context.Context, u *user.User, fullPath string) error {
+	return s.recycleExisting(ctx, u, s.getUserRootDir(u), fullPath)
+}
+
+// recycleExisting 覆盖恢复前把已存在的目标移入回收站，避免直接丢弃数据
+func (s *RecycleService) recycleExisting(ctx context.Context, u *user.User, userRoot, fullPath string) error {
+	info, err := s.storage.Stat(fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat existing target: %w", err)
+	}
+	size := info.Size()
+	if info.IsDir() {
+		size = 0
+	}
+	relPath, err := filepath.Rel(userRoot, fullPath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve existing target: %w", err)
+	}
+	dirName := filepath.Dir(relPath)
+	if dirName == "." {
+		dirName = u.Directory
+		if dirName == "" {
+			dirName = u.Username
+		}
+	}
+	name := filepath.Base(relPath)
+	item := recycle.NewRecycleItem(u.ID, u.Username, dirName, name, relPath, info.IsDir(), size)
+
+	recycleDir := s.getRecycleDir()
+	if err := s.storage.MkdirAll(recycleDir, 0755); err != nil {
+		return fmt.Errorf("failed to create recycle dir: %w", err)
+	}
+	recyclePath := filepath.Join(recycleDir, fmt.Sprintf("%s_%s", item.Hash, name))
+	if err := s.storage.Rename(fullPath, recyclePath); err != nil {
+		return fmt.Errorf("failed to move existing target to recycle: %w", err)
+	}
+	if err := s.recycleRepo.Create(ctx, item); err != nil {
+		return fmt.Errorf("failed to save recycle item: %w", err)
+	}
+	if err := s.mutationRecorder.EnsureDir(ctx, recycleDir); err != nil {
+		return fmt.Errorf("failed to record recycle directory ensure event: %w", err)
+	}
+	if err := s.mutationRecorder.MovePath(ctx, fullPath, recyclePath, info.IsDir()); err != nil {
+		return fmt.Errorf("failed to record recycle move event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/domain/recycle"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func newRecoverTestService(t *testing.T) (*RecycleService, *memoryRecycleRepo, *user.User, string) {
+	t.Helper()
+	rootDir := t.TempDir()
+	cfg := &config.Config{WebDAV: config.WebDAVConfig{Directory: rootDir}}
+	userRepo := newTestUserRepo()
+	u := user.NewUser("alice", "alice")
+	u.Permissions = user.FullPermissions()
+	if err := userRepo.Save(context.Background(), u); err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	recycleRepo := &memoryRecycleRepo{items: map[string]*recycle.RecycleItem{}}
+	svc := NewRecycleService(recycleRepo, userRepo, nil, cfg, zap.NewNop())
+	return svc, recycleRepo, u, rootDir
+}
+
+func seedRecycleItem(t *testing.T, repo *memoryRecycleRepo, rootDir string, u *user.User, relPath, content string) *recycle.RecycleItem {
+	t.Helper()
+	item := recycle.NewRecycleItem(u.ID, u.Username, filepath.Dir(relPath), filepath.Base(relPath), relPath, false, int64(len(content)))
+	repo.items[item.Hash] = item
+	writeRecoverTestFile(t, filepath.Join(rootDir, ".recycle", item.Hash+"_"+item.Name), content)
+	return item
+}
+
+func writeRecoverTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readRecoverTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRecycleRecoverConflictPolicies(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, repo, u, rootDir := newRecoverTestService(t)
+	userRoot := filepath.Join(rootDir, "alice")
+	writeRecoverTestFile(t, filepath.Join(userRoot, "docs", "a.txt"), "current")
+	item := seedRecycleItem(t, repo, rootDir, u, "docs/a.txt", "deleted")
+
+	if err := svc.Recover(ctx, u, item.Hash); !errors.Is(err, ErrRecoverTargetExists) {
+		t.Fatalf("expected target exists error, got %v", err)
+	}
+
+	result, err := svc.RecoverWithOptions(ctx, u, item.Hash, RecoverOptions{Conflict: RecoverConflictSkip})
+	if err != nil || result.Status != RecoverStatusSkipped {
+		t.Fatalf("skip: result=%+v err=%v", result, err)
+	}
+	if _, ok := repo.items[item.Hash]; !ok {
+		t.Fatalf("skipped item must stay in the recycle bin")
+	}
+
+	result, err = svc.RecoverWithOptions(ctx, u, item.Hash, RecoverOptions{Conflict: RecoverConflictRename})
+	if err != nil || result.Status != RecoverStatusRenamed || result.Path != "docs/a (1).txt" {
+		t.Fatalf("rename: result=%+v err=%v", result, err)
+	}
+	if got := readRecoverTestFile(t, filepath.Join(userRoot, "docs", "a (1).txt")); got != "deleted" {
+		t.Fatalf("renamed content = %q", got)
+	}
+	if got := readRecoverTestFile(t, filepath.Join(userRoot, "docs", "a.txt")); got != "current" {
+		t.Fatalf("rename must keep the existing file, got %q", got)
+	}
+
+	second := seedRecycleItem(t, repo, rootDir, u, "docs/a.txt", "older")
+	result, err = svc.RecoverWithOptions(ctx, u, second.Hash, RecoverOptions{Conflict: RecoverConflictOverwrite})
+	if err != nil || result.Status != RecoverStatusOverwritten {
+		t.Fatalf("overwrite: result=%+v err=%v", result, err)
+	}
+	if got := readRecoverTestFile(t, filepath.Join(userRoot, "docs", "a.txt")); got != "older" {
+		t.Fatalf("overwritten content = %q", got)
+	}
+	if len(repo.items) != 1 {
+		t.Fatalf("overwritten file must move to the recycle bin, items=%d", len(repo.items))
+	}
+	for _, replaced := range repo.items {
+		path := filepath.Join(rootDir, ".recycle", replaced.Hash+"_"+replaced.Name)
+		if got := readRecoverTestFile(t, path); got != "current" || replaced.Path != filepath.Join("docs", "a.txt") {
+			t.Fatalf("unexpected replaced item %+v with content %q", replaced, got)
+		}
+	}
+}
+
+func TestRecycleRecoverBatchRecreatesParents(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, repo, u, rootDir := newRecoverTestService(t)
+	userRoot := filepath.Join(rootDir, "alice")
+	one := seedRecycleItem(t, repo, rootDir, u, "deep/x/one.txt", "1")
+	two := seedRecycleItem(t, repo, rootDir, u, "deep/two.txt", "2")
+	one.BatchID, two.BatchID = "batch-1", "batch-1"
+	other := seedRecycleItem(t, repo, rootDir, u, "other.txt", "3")
+
+	results, err := svc.RecoverBatch(ctx, u, "batch-1", RecoverOptions{})
+	if err != nil {
+		t.Fatalf("recover batch: %v", err)
+	}
+	if len(results) != 2 || results[0].Hash != two.Hash || results[1].Hash != one.Hash {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if len(results[0].CreatedParents) != 1 || results[0].CreatedParents[0] != "deep" ||
+		len(results[1].CreatedParents) != 1 || results[1].CreatedParents[0] != "deep/x" {
+		t.Fatalf("unexpected created parents %+v / %+v", results[0], results[1])
+	}
+	if got := readRecoverTestFile(t, filepath.Join(userRoot, "deep", "x", "one.txt")); got != "1" {
+		t.Fatalf("restored content = %q", got)
+	}
+	if _, ok := repo.items[other.Hash]; !ok {
+		t.Fatalf("items from other batches must stay in the recycle bin")
+	}
+
+	writeRecoverTestFile(t, filepath.Join(userRoot, "blocked"), "now a file")
+	blocked := seedRecycleItem(t, repo, rootDir, u, "blocked/b.txt", "b")
+	results, err = svc.RecoverMany(ctx, u, []string{blocked.Hash, other.Hash}, RecoverOptions{})
+	if err != nil {
+		t.Fatalf("recover many: %v", err)
+	}
+	if results[0].Status != RecoverStatusRestored || results[1].Status != RecoverStatusFailed {
+		t.Fatalf("unexpected bulk results %+v / %+v", results[0], results[1])
+	}
+
+	result, err := svc.RecoverWithOptions(ctx, u, blocked.Hash, RecoverOptions{TargetDir: "/restored/blocked"})
+	if err != nil || result.Path != "restored/blocked/b.txt" {
+		t.Fatalf("target dir: result=%+v err=%v", result, err)
+	}
+}
+
+func TestWebDAVRecursiveDeleteRestoresAsOneBatch(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	dav, u := newPartialUpdateTestService(t, 0, 0, nil)
+	repo := &memoryRecycleRepo{items: map[string]*recycle.RecycleItem{}}
+	dav.recycleRepo = repo
+	seedPartialUpdateFile(t, dav, u, "docs/a.txt", "a")
+	seedPartialUpdateFile(t, dav, u, "docs/sub/b.txt", "b")
+	seedPartialUpdateFile(t, dav, u, "other.txt", "o")
+
+	// Clients delete a folder entry by entry, then the emptied folder.
+	for _, target := range []string{"/dav/docs/sub/b.txt", "/dav/docs/sub", "/dav/docs/a.txt", "/dav/docs", "/dav/other.txt"} {
+		resp := httptest.NewRecorder()
+		dav.ServeHTTP(resp, newPartialUpdateRequest(http.MethodDelete, target, "", u))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("delete %s: status %d", target, resp.Code)
+		}
+	}
+	batches := map[string]string{}
+	for _, item := range repo.items {
+		batches[filepath.ToSlash(item.Path)] = item.BatchID
+	}
+	batchID := batches["docs"]
+	for _, p := range []string{"docs/sub/b.txt", "docs/sub", "docs/a.txt"} {
+		if batches[p] != batchID {
+			t.Fatalf("expected %s in batch %s, got %+v", p, batchID, batches)
+		}
+	}
+	if batches["other.txt"] == batchID {
+		t.Fatalf("unrelated delete must start a new batch")
+	}
+
+	svc := NewRecycleService(repo, dav.userRepo, nil, dav.config, zap.NewNop())
+	results, err := svc.RecoverBatch(ctx, u, batchID, RecoverOptions{TargetDir: "/restored"})
+	if err != nil || len(results) != 4 {
+		t.Fatalf("recover batch: results=%+v err=%v", results, err)
+	}
+	userRoot := dav.getUserDirectory(u)
+	if got := readRecoverTestFile(t, filepath.Join(userRoot, "restored", "docs", "sub", "b.txt")); got != "b" {
+		t.Fatalf("restored content = %q", got)
+	}
+	if got := readRecoverTestFile(t, filepath.Join(userRoot, "restored", "docs", "a.txt")); got != "a" {
+		t.Fatalf("restored content = %q", got)
+	}
+	if len(repo.items) != 1 {
+		t.Fatalf("only the unrelated item should remain, got %d", len(repo.items))
+	}
+}
+
+func TestWebDAVDeleteBatchHeaderOverridesGrouping(t *testing.T) {
+	t.Parallel()
+	dav, u := newPartialUpdateTestService(t, 0, 0, nil)
+	repo := &memoryRecycleRepo{items: map[string]*recycle.RecycleItem{}}
+	dav.recycleRepo = repo
+	seedPartialUpdateFile(t, dav, u, "x.txt", "x")
+	seedPartialUpdateFile(t, dav, u, "y.txt", "y")
+
+	for _, target := range []string{"/dav/x.txt", "/dav/y.txt"} {
+		req := newPartialUpdateRequest(http.MethodDelete, target, "", u)
+		req.Header.Set(deleteBatchHeader, "cleanup-1")
+		resp := httptest.NewRecorder()
+		dav.ServeHTTP(resp, req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("delete %s: status %d", target, resp.Code)
+		}
+	}
+	for _, item := range repo.items {
+		if item.BatchID != "cleanup-1" {
+			t.Fatalf("expected the client batch, got %+v", item)
+		}
+	}
+}
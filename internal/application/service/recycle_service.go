@@ -15,6 +15,7 @@ import (
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"go.uber.org/zap"
 )
 
@@ -24,9 +25,17 @@ type RecycleService struct {
 	userRepo         user.Repository
 	mutationRecorder MutationRecorder
 	config           *config.Config
+	storage          storage.Backend
 	logger           *zap.Logger
 }
 
+// SetStorage 设置回收站与用户文件所在的存储后端，默认为本地磁盘
+func (s *RecycleService) SetStorage(backend storage.Backend) {
+	if backend != nil {
+		s.storage = backend
+	}
+}
+
 // NewRecycleService 创建回收站服务
 func NewRecycleService(
 	recycleRepo repository.RecycleRepository,
@@ -43,6 +52,7 @@ func NewRecycleService(
 		userRepo:         userRepo,
 		mutationRecorder: mutationRecorder,
 		config:           cfg,
+		storage:          storage.NewLocal(),
 		logger:           logger,
 	}
 }
@@ -56,6 +66,7 @@ type RecycleItemResponse struct {
 	DeletedAt string `json:"deletedAt"`
 	Directory string `json:"directory"`
 	IsDir     bool   `json:"isDir"`
+	BatchID   string `json:"batchId"`
 }
 
 type ListOptions struct {
@@ -81,7 +92,7 @@ func (s *RecycleService) AddToRecycle(
 ) error {
 	// 获取文件信息
 	fullPath := filepath.Join(s.getUserRootDir(u), directory, filePath)
-	info, err := os.Stat(fullPath)
+	info, err := s.storage.Stat(fullPath)
 	if err != nil {
 		return fmt.Errorf("failed to stat file: %w", err)
 	}
@@ -152,76 +163,17 @@ func (s *RecycleService) List(ctx context.Context, u *user.User, opts ListOption
 			DeletedAt: item.DeletedAt.Format("2006-01-02T15:04:05Z07:00"),
 			Directory: item.Directory,
 			IsDir:     item.IsDir,
+			BatchID:   item.DeletionBatch(),
 		})
 	}
 
 	return response, nil
 }
 
-// Recover 恢复文件
+// Recover 恢复文件到原路径；原路径已存在时报错。更多选项见 RecoverWithOptions
 func (s *RecycleService) Recover(ctx context.Context, u *user.User, hash string) error {
-	// 获取回收站项目
-	item, err := s.recycleRepo.GetByHash(ctx, hash)
-	if err != nil {
-		return err
-	}
-
-	// 验证所有权
-	if item.UserID != u.ID {
-		return fmt.Errorf("permission denied: not your file")
-	}
-	if err := enforceAppScope(ctx, s.config, item.Path, "update", "create"); err != nil {
-		return err
-	}
-
-	// 检查原路径是否已存在文件
-	relPath := strings.TrimPrefix(item.Path, "/")
-	relPath = filepath.Clean(filepath.FromSlash(relPath))
-	if relPath == "." || strings.HasPrefix(relPath, "..") {
-		return fmt.Errorf("invalid original path: %s", item.Path)
-	}
-	fullPath := filepath.Join(s.getUserRootDir(u), relPath)
-	if _, err := os.Stat(fullPath); err == nil {
-		return fmt.Errorf("file already exists at original path: %s", item.Path)
-	}
-
-	// 确保目标目录存在
-	targetDir := filepath.Dir(fullPath)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("failed to create target directory: %w", err)
-	}
-
-	// 从回收站存储目录恢复
-	recyclePath, err := s.findRecyclePath(item)
-	if err != nil {
-		return fmt.Errorf("failed to locate recycle file: %w", err)
-	}
-	recycleInfo, err := os.Stat(recyclePath)
-	if err != nil {
-		return fmt.Errorf("failed to stat recycle file: %w", err)
-	}
-	if err := os.Rename(recyclePath, fullPath); err != nil {
-		return fmt.Errorf("failed to restore file: %w", err)
-	}
-	if err := s.mutationRecorder.EnsureDir(ctx, targetDir); err != nil {
-		return fmt.Errorf("failed to record target directory ensure event: %w", err)
-	}
-	if err := s.mutationRecorder.MovePath(ctx, recyclePath, fullPath, recycleInfo.IsDir()); err != nil {
-		return fmt.Errorf("failed to record recycle recover event: %w", err)
-	}
-
-	s.logger.Info("recovering file",
-		zap.String("username", u.Username),
-		zap.String("file", item.Path),
-		zap.String("hash", hash),
-	)
-
-	// 从数据库中删除记录（标记为已恢复）
-	if err := s.recycleRepo.DeleteByHash(ctx, hash); err != nil {
-		return fmt.Errorf("failed to remove from recycle bin: %w", err)
-	}
-
-	return nil
+	_, err := s.RecoverWithOptions(ctx, u, hash, RecoverOptions{})
+	return err
 }
 
 // Remove 永久删除
@@ -240,13 +192,19 @@ func (s *RecycleService) Remove(ctx context.Context, u *user.User, hash string)
 		return err
 	}
 
+	return s.PurgeItem(ctx, u, item)
+}
+
+// PurgeItem 永久删除回收站项目：删除实际文件、写入复制删除事件、删除记录并释放额度。
+// 不做归属与 app scope 校验，供 Remove 与后台清理复用
+func (s *RecycleService) PurgeItem(ctx context.Context, u *user.User, item *recycle.RecycleItem) error {
 	// 删除回收站中的实际文件
 	if recyclePath, err := s.findRecyclePath(item); err == nil {
 		isDir := false
-		if info, statErr := os.Stat(recyclePath); statErr == nil {
+		if info, statErr := s.storage.Stat(recyclePath); statErr == nil {
 			isDir = info.IsDir()
 		}
-		if err := os.RemoveAll(recyclePath); err != nil && !os.IsNotExist(err) {
+		if err := s.storage.RemoveAll(recyclePath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to delete recycle file: %w", err)
 		}
 		if err := s.mutationRecorder.RemovePath(ctx, recyclePath, isDir); err != nil {
@@ -257,14 +215,14 @@ func (s *RecycleService) Remove(ctx context.Context, u *user.User, hash string)
 	}
 
 	// 从数据库中删除
-	if err := s.recycleRepo.DeleteByHash(ctx, hash); err != nil {
+	if err := s.recycleRepo.DeleteByHash(ctx, item.Hash); err != nil {
 		return fmt.Errorf("failed to remove from recycle bin: %w", err)
 	}
 
 	s.logger.Info("file permanently deleted from recycle bin",
 		zap.String("username", u.Username),
 		zap.String("file", item.Path),
-		zap.String("hash", hash),
+		zap.String("hash", item.Hash),
 	)
 
 	s.applyUsedSpaceDelta(ctx, u, -item.Size)
@@ -274,6 +232,12 @@ func (s *RecycleService) Remove(ctx context.Context, u *user.User, hash string)
 
 // Clear 清空回收站
 func (s *RecycleService) Clear(ctx context.Context, u *user.User) (int, error) {
+	return s.ClearWithProgress(ctx, u, nil)
+}
+
+// ClearWithProgress 清空回收站，progress 在处理每一项前及结束时以 (总数, 已处理数) 调用；
+// ctx 取消时停止并返回已清理数量，供后台任务使用
+func (s *RecycleService) ClearWithProgress(ctx context.Context, u *user.User, progress func(total, done int)) (int, error) {
 	items, err := s.recycleRepo.GetByUserID(ctx, u.ID)
 	if err != nil {
 		return 0, fmt.Errorf("failed to list recycle items: %w", err)
@@ -282,19 +246,26 @@ func (s *RecycleService) Clear(ctx context.Context, u *user.User) (int, error) {
 	if err != nil {
 		return 0, err
 	}
+	if progress == nil {
+		progress = func(int, int) {}
+	}
 
 	cleared := 0
 	var firstErr error
-	for _, item := range items {
+	for i, item := range items {
+		if err := ctx.Err(); err != nil {
+			return cleared, err
+		}
+		progress(len(items), i)
 		if scope.active && !scope.allowsAny(item.Path, "delete") {
 			continue
 		}
 		if recyclePath, err := s.findRecyclePath(item); err == nil {
 			isDir := false
-			if info, statErr := os.Stat(recyclePath); statErr == nil {
+			if info, statErr := s.storage.Stat(recyclePath); statErr == nil {
 				isDir = info.IsDir()
 			}
-			if err := os.RemoveAll(recyclePath); err != nil && !os.IsNotExist(err) {
+			if err := s.storage.RemoveAll(recyclePath); err != nil && !os.IsNotExist(err) {
 				if firstErr == nil {
 					firstErr = err
 				}
@@ -319,6 +290,7 @@ func (s *RecycleService) Clear(ctx context.Context, u *user.User) (int, error) {
 		s.applyUsedSpaceDelta(ctx, u, -item.Size)
 		cleared += 1
 	}
+	progress(len(items), len(items))
 
 	if firstErr != nil {
 		return cleared, fmt.Errorf("failed to clear recycle items: %w", firstErr)
@@ -360,7 +332,7 @@ func (s *RecycleService) getUserRootDir(u *user.User) string {
 	if filepath.IsAbs(userDir) {
 		return userDir
 	}
-	return filepath.Join(s.config.WebDAV.Directory, userDir)
+	return filepath.Join(userVolumeBase(s.config, u.Volume, userDir), userDir)
 }
 
 func (s *RecycleService) getRecycleDir() string {
@@ -373,14 +345,14 @@ func (s *RecycleService) findRecyclePath(item *recycle.RecycleItem) (string, err
 
 	// 新命名规则：{hash}_{原文件名}
 	newPath := filepath.Join(recycleDir, fmt.Sprintf("%s_%s", item.Hash, item.Name))
-	if _, err := os.Stat(newPath); err == nil {
+	if _, err := s.storage.Stat(newPath); err == nil {
 		return newPath, nil
 	}
 
 	// 旧命名规则：{用户名}_{目录}_{原文件名}_{时间戳}
 	legacyPrefix := filepath.Join(recycleDir, fmt.Sprintf("%s_%s_%s_", item.Username, item.Directory, item.Name))
 	var matches []string
-	_ = filepath.WalkDir(recycleDir, func(path string, d fs.DirEntry, err error) error {
+	_ = s.storage.WalkDir(recycleDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return nil
 		}
@@ -398,7 +370,7 @@ func (s *RecycleService) findRecyclePath(item *recycle.RecycleItem) (string, err
 	best := matches[0]
 	bestDelta := time.Duration(math.MaxInt64)
 	for _, m := range matches {
-		info, err := os.Stat(m)
+		info, err := s.storage.Stat(m)
 		if err != nil {
 			continue
 		}
@@ -415,23 +387,63 @@ func (s *RecycleService) findRecyclePath(item *recycle.RecycleItem) (string, err
 	return best, nil
 }
 
-// CleanExpired 清理过期文件（可由定时任务调用）
+// CleanExpired 清理过期文件（可由定时任务调用）：按用户保留期（未设置时使用 retentionDays）
+// 永久删除过期项目，同时删除实际文件并释放额度；生效保留期小于等于 0 的用户永久保留，不做清理
 func (s *RecycleService) CleanExpired(ctx context.Context, retentionDays int) (int64, error) {
-	retentionPeriod := time.Duration(retentionDays) * 24 * time.Hour
-	if retentionDays <= 0 {
-		retentionPeriod = 30 * 24 * time.Hour // 默认30天
-	}
-	deleted, err := s.recycleRepo.DeleteExpiredItems(ctx, retentionPeriod)
+	users, err := s.userRepo.List(ctx)
 	if err != nil {
-		return 0, fmt.Errorf("failed to clean expired items: %w", err)
+		return 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	now := time.Now()
+	var deleted int64
+	var firstErr error
+	for _, u := range users {
+		if u == nil {
+			continue
+		}
+		days := recycleRetentionDays(u, retentionDays)
+		if days <= 0 {
+			continue
+		}
+		items, err := s.recycleRepo.GetByUserID(ctx, u.ID)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		cutoff := now.Add(-time.Duration(days) * 24 * time.Hour)
+		for _, item := range items {
+			if item.DeletedAt.After(cutoff) {
+				continue
+			}
+			if err := s.PurgeItem(ctx, u, item); err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			deleted++
+		}
 	}
 
 	if deleted > 0 {
 		s.logger.Info("cleaned expired recycle items",
 			zap.Int64("count", deleted),
-			zap.Duration("retention_period", retentionPeriod),
+			zap.Int("retention_days", retentionDays),
 		)
 	}
+	if firstErr != nil {
+		return deleted, fmt.Errorf("failed to clean expired items: %w", firstErr)
+	}
 
 	return deleted, nil
 }
+
+// recycleRetentionDays 返回用户生效的回收站保留天数；小于等于 0 表示永久保留
+func recycleRetentionDays(u *user.User, fallback int) int {
+	if u != nil && u.RecycleRetentionDays != 0 {
+		return u.RecycleRetentionDays
+	}
+	return fallback
+}
@@ -62,11 +62,50 @@ func TestRecycleRemoveReleasesUsedSpace(t *testing.T) {
 	}
 }
 
+func TestRecycleCleanExpiredKeepsItemsForeverWhenRetentionIsZero(t *testing.T) {
+	t.Parallel()
+
+	rootDir := t.TempDir()
+	cfg := &config.Config{WebDAV: config.WebDAVConfig{Directory: rootDir}}
+	userRepo := newTestUserRepo()
+	keeper := user.NewUser("alice", "alice")
+	expiring := user.NewUser("bob", "bob")
+	expiring.RecycleRetentionDays = 7
+	recycleRepo := &memoryRecycleRepo{items: map[string]*recycle.RecycleItem{}}
+	for _, u := range []*user.User{keeper, expiring} {
+		u.UsedSpace = 10
+		if err := userRepo.Save(context.Background(), u); err != nil {
+			t.Fatalf("save user: %v", err)
+		}
+		item := recycle.NewRecycleItem(u.ID, u.Username, u.Username, "old.txt", "/personal/old.txt", false, 10)
+		item.DeletedAt = time.Now().AddDate(0, 0, -100)
+		recycleRepo.items[item.Hash] = item
+	}
+
+	svc := NewRecycleService(recycleRepo, userRepo, nil, cfg, zap.NewNop())
+	deleted, err := svc.CleanExpired(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("clean expired: %v", err)
+	}
+	if deleted != 1 || len(recycleRepo.items) != 1 {
+		t.Fatalf("expected only the user with a retention override to be cleaned, deleted=%d left=%d", deleted, len(recycleRepo.items))
+	}
+	for _, item := range recycleRepo.items {
+		if item.UserID != keeper.ID {
+			t.Fatalf("item of %s must be kept forever", item.Username)
+		}
+	}
+}
+
 type memoryRecycleRepo struct {
 	items map[string]*recycle.RecycleItem
 }
 
-func (r *memoryRecycleRepo) Create(context.Context, *recycle.RecycleItem) error { return nil }
+func (r *memoryRecycleRepo) Create(_ context.Context, item *recycle.RecycleItem) error {
+	copy := *item
+	r.items[item.Hash] = &copy
+	return nil
+}
 
 func (r *memoryRecycleRepo) GetByHash(_ context.Context, hash string) (*recycle.RecycleItem, error) {
 	item, ok := r.items[hash]
@@ -111,6 +150,14 @@ func (r *memoryRecycleRepo) DeleteByUserID(_ context.Context, userID string) err
 	return nil
 }
 
+func (r *memoryRecycleRepo) UpdateOriginalPath(_ context.Context, hash, directory, path string) error {
+	if item, ok := r.items[hash]; ok {
+		item.Directory = directory
+		item.Path = path
+	}
+	return nil
+}
+
 func (r *memoryRecycleRepo) DeleteExpiredItems(context.Context, time.Duration) (int64, error) {
 	return 0, nil
 }
@@ -11,7 +11,6 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -20,6 +19,7 @@ import (
 	"github.com/yeying-community/warehouse/internal/domain/replication"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
 )
@@ -39,6 +39,7 @@ type ReplicationWorker struct {
 	outbox       repository.ReplicationOutboxRepository
 	peerResolver ReplicationPeerResolver
 	client       *http.Client
+	storage      storage.Backend
 	logger       *zap.Logger
 	now          func() time.Time
 }
@@ -53,11 +54,19 @@ func NewReplicationWorker(cfg *config.Config, outbox repository.ReplicationOutbo
 		outbox:       outbox,
 		peerResolver: peerResolver,
 		client:       &http.Client{Timeout: cfg.Replication.RequestTimeout},
+		storage:      storage.NewLocal(),
 		logger:       logger,
 		now:          time.Now,
 	}
 }
 
+// SetStorage reads replicated file contents from another backend.
+func (w *ReplicationWorker) SetStorage(backend storage.Backend) {
+	if w != nil && backend != nil {
+		w.storage = backend
+	}
+}
+
 // Enabled reports whether the worker should run for the current node.
 func (w *ReplicationWorker) Enabled() bool {
 	if w == nil || w.config == nil {
@@ -244,7 +253,7 @@ func (w *ReplicationWorker) dispatchFileApply(ctx context.Context, peer *Resolve
 	if err != nil {
 		return err
 	}
-	file, err := os.Open(fullPath)
+	file, err := w.storage.Open(fullPath)
 	if err != nil {
 		return fmt.Errorf("open replication source file %q: %w", fullPath, err)
 	}
@@ -253,29 +262,61 @@ func (w *ReplicationWorker) dispatchFileApply(ctx context.Context, peer *Resolve
 		return err
 	}
 
+	if w.shouldProbeBlob(*event.FileSize) {
+		// Let the standby link content it already stores before sending bytes.
+		req, err := w.newFileApplyRequest(ctx, peer, event, http.NoBody, 0)
+		if err != nil {
+			return err
+		}
+		req.Header.Set(middleware.InternalBlobLinkHeader, "1")
+		probeErr := w.doRequest(req)
+		if probeErr == nil {
+			return nil
+		}
+		if w.logger != nil {
+			w.logger.Debug("standby cannot link blob, sending file content",
+				zap.Int64("outbox_id", event.ID),
+				zap.String("peer_node_id", peerNodeID(peer)),
+				zap.Error(probeErr))
+		}
+	}
+
+	req, err := w.newFileApplyRequest(ctx, peer, event, file, *event.FileSize)
+	if err != nil {
+		return err
+	}
+	return w.doRequest(req)
+}
+
+func (w *ReplicationWorker) newFileApplyRequest(ctx context.Context, peer *ResolvedReplicationPeer, event *replication.OutboxEvent, body io.Reader, contentLength int64) (*http.Request, error) {
 	values := url.Values{}
 	values.Set("outboxId", fmt.Sprintf("%d", event.ID))
 	values.Set("path", *event.Path)
 	values.Set("fileSize", fmt.Sprintf("%d", *event.FileSize))
 	requestURL := strings.TrimRight(peer.BaseURL, "/") + "/api/v1/internal/replication/file?" + values.Encode()
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, requestURL, file)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, requestURL, body)
 	if err != nil {
-		return fmt.Errorf("create file apply request: %w", err)
+		return nil, fmt.Errorf("create file apply request: %w", err)
 	}
-	req.ContentLength = *event.FileSize
+	req.ContentLength = contentLength
 	if err := w.signRequest(req, *event.ContentSHA256); err != nil {
-		return err
+		return nil, err
 	}
 	assignmentGeneration, err := w.requiredAssignmentGeneration(peer, event)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Set(middleware.InternalAssignmentGenerationHeader, fmt.Sprintf("%d", assignmentGeneration))
+	return req, nil
+}
 
-	return w.doRequest(req)
+// shouldProbeBlob reports whether a file is large enough to be worth asking
+// the standby for a blob link first.
+func (w *ReplicationWorker) shouldProbeBlob(size int64) bool {
+	return w.config.Dedup.Enabled && size > 0 && size >= w.config.Dedup.MinSize
 }
 
-func validateReplicationFileSnapshot(file *os.File, fullPath string, event *replication.OutboxEvent) error {
+func validateReplicationFileSnapshot(file storage.File, fullPath string, event *replication.OutboxEvent) error {
 	info, err := file.Stat()
 	if err != nil {
 		return fmt.Errorf("stat replication source file %q: %w", fullPath, err)
@@ -369,7 +410,7 @@ func (w *ReplicationWorker) resolveLocalPath(storagePath string) (string, error)
 	if cleaned == "/" || strings.HasPrefix(cleaned, "/..") {
 		return "", fmt.Errorf("invalid storage path %q", storagePath)
 	}
-	return filepath.Join(filepath.Clean(w.config.WebDAV.Directory), filepath.FromSlash(strings.TrimPrefix(cleaned, "/"))), nil
+	return storage.VolumesFromConfig(w.config).Physical(filepath.Join(filepath.Clean(w.config.WebDAV.Directory), filepath.FromSlash(strings.TrimPrefix(cleaned, "/")))), nil
 }
 
 func (w *ReplicationWorker) retryDelay(attemptCount int) time.Duration {
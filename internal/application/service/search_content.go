@@ -0,0 +1,530 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/textextract"
+	"go.uber.org/zap"
+)
+
+var ErrContentSearchDisabled = errors.New("content search is disabled")
+
+const (
+	// contentJobLease is how long a claimed job stays hidden from other
+	// workers; a crashed worker's jobs become due again afterwards.
+	contentJobLease = 10 * time.Minute
+	// contentRetryDelay is multiplied by the attempt count between retries.
+	contentRetryDelay = time.Minute
+)
+
+// ContentSearchQuery is a full-text search. Query uses web search syntax:
+// words are ANDed, "quoted phrases" match adjacent words, -word excludes
+// and "or" between words matches either.
+type ContentSearchQuery struct {
+	Query      string
+	Path       string
+	Space      string
+	Extensions []string
+	Limit      int
+	Offset     int
+}
+
+// ContentSearchResult is a match with an HTML-escaped snippet in which the
+// matched words are wrapped in <mark>.
+type ContentSearchResult struct {
+	SearchResult
+	Snippet string `json:"snippet"`
+}
+
+// ContentSearchPage is a page of full-text results.
+type ContentSearchPage struct {
+	Items      []ContentSearchResult `json:"items"`
+	HasMore    bool                  `json:"hasMore"`
+	NextOffset int                   `json:"nextOffset,omitempty"`
+}
+
+// SearchContentSpace is the content indexing state of one asset space.
+type SearchContentSpace struct {
+	Key     string     `json:"key"`
+	Name    string     `json:"name"`
+	Path    string     `json:"path"`
+	Enabled bool       `json:"enabled"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// SearchContentSettings lists which of a user's spaces are content indexed.
+type SearchContentSettings struct {
+	Spaces []SearchContentSpace `json:"spaces"`
+}
+
+// SetContentRepository enables full-text content indexing when
+// search.content.enabled is set.
+func (s *SearchService) SetContentRepository(repo repository.SearchContentRepository) {
+	if s != nil && repo != nil && s.config.Search.Content.Enabled {
+		s.content = repo
+	}
+}
+
+// ContentEnabled reports whether full-text content search is configured.
+func (s *SearchService) ContentEnabled() bool {
+	return s != nil && s.content != nil
+}
+
+// ContentIndexerEnabled reports whether this node extracts queued content.
+func (s *SearchService) ContentIndexerEnabled() bool {
+	return s.ContentEnabled() && s.IndexesWrites()
+}
+
+// ContentSettings returns u's per-space opt-in state.
+func (s *SearchService) ContentSettings(ctx context.Context, u *user.User) (*SearchContentSettings, error) {
+	if !s.ContentEnabled() {
+		return nil, ErrContentSearchDisabled
+	}
+	if u == nil {
+		return nil, fmt.Errorf("%w: user is required", ErrSearchInvalid)
+	}
+	scopes, err := s.content.ListScopes(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	enabled := make(map[string]*repository.ContentScope, len(scopes))
+	for _, scope := range scopes {
+		enabled[scope.Space] = scope
+	}
+	settings := &SearchContentSettings{Spaces: []SearchContentSpace{}}
+	for _, space := range s.assetSpace.Spaces() {
+		item := SearchContentSpace{Key: space.Key, Name: space.Name, Path: path.Clean("/" + space.Path)}
+		if scope, ok := enabled[space.Key]; ok {
+			since := scope.CreatedAt
+			item.Enabled = true
+			item.Since = &since
+		}
+		settings.Spaces = append(settings.Spaces, item)
+	}
+	return settings, nil
+}
+
+// SetContentSpaces replaces the set of u's spaces whose file contents are
+// indexed. Newly enabled spaces are queued for extraction; disabled spaces
+// lose their extracted text right away.
+func (s *SearchService) SetContentSpaces(ctx context.Context, u *user.User, spaces []string) (*SearchContentSettings, error) {
+	if !s.ContentEnabled() {
+		return nil, ErrContentSearchDisabled
+	}
+	if u == nil {
+		return nil, fmt.Errorf("%w: user is required", ErrSearchInvalid)
+	}
+	// Opt-in is an account setting, not something an app token may change.
+	scope, err := resolveAppScope(ctx, s.config)
+	if err != nil {
+		return nil, err
+	}
+	if scope.active {
+		return nil, auth.ErrAppScopeDenied
+	}
+	rootPrefix, ok := s.logicalPath(ResolveUserRoot(s.config, u))
+	if !ok || rootPrefix == "/" {
+		return nil, fmt.Errorf("%w: user directory is outside webdav root", ErrSearchInvalid)
+	}
+
+	wanted := make(map[string]string, len(spaces))
+	for _, raw := range spaces {
+		key := strings.ToLower(strings.TrimSpace(raw))
+		if key == "" {
+			continue
+		}
+		spacePath, ok := s.spacePath(key)
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown space %q", ErrSearchInvalid, raw)
+		}
+		wanted[key] = joinSearchPath(rootPrefix, spacePath)
+	}
+
+	existing, err := s.content.ListScopes(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, current := range existing {
+		if _, keep := wanted[current.Space]; keep {
+			delete(wanted, current.Space)
+			continue
+		}
+		if err := s.content.RemoveScope(ctx, u.ID, current.Space); err != nil {
+			return nil, err
+		}
+		if err := s.content.DeleteDocuments(ctx, current.Prefix); err != nil {
+			return nil, err
+		}
+	}
+	for key, prefix := range wanted {
+		if err := s.content.AddScope(ctx, &repository.ContentScope{
+			UserID:    u.ID,
+			Space:     key,
+			Prefix:    prefix,
+			CreatedAt: s.now(),
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := s.content.EnqueueTree(ctx, prefix); err != nil {
+			return nil, err
+		}
+	}
+	return s.ContentSettings(ctx, u)
+}
+
+// SearchContent runs a full-text query over the extracted text of the trees
+// u may read, with the same share, app scope and permission rules as Search.
+func (s *SearchService) SearchContent(ctx context.Context, u *user.User, query ContentSearchQuery) (*ContentSearchPage, error) {
+	if !s.ContentEnabled() {
+		return nil, ErrContentSearchDisabled
+	}
+	if u == nil {
+		return nil, fmt.Errorf("%w: user is required", ErrSearchInvalid)
+	}
+	text := strings.TrimSpace(query.Query)
+	if text == "" {
+		return nil, fmt.Errorf("%w: query is required", ErrSearchInvalid)
+	}
+	limit, err := s.resolveLimit(query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if query.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrSearchInvalid)
+	}
+
+	scope, err := resolveAppScope(ctx, s.config)
+	if err != nil {
+		return nil, err
+	}
+	trees, err := s.resolveTrees(ctx, u, SearchQuery{Path: query.Path, Space: query.Space}, scope.active)
+	if err != nil {
+		return nil, err
+	}
+	page := &ContentSearchPage{Items: []ContentSearchResult{}}
+	if len(trees) == 0 {
+		return page, nil
+	}
+
+	filter := repository.ContentFilter{
+		SearchFilter: repository.SearchFilter{
+			Extensions: query.Extensions,
+			Limit:      limit + 1,
+			Offset:     query.Offset,
+		},
+		Query: contentSearchQuery(text),
+	}
+	for _, tree := range trees {
+		filter.Prefixes = append(filter.Prefixes, tree.prefix)
+	}
+	matches, err := s.content.Search(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) > limit {
+		matches = matches[:limit]
+		page.HasMore = true
+		page.NextOffset = query.Offset + limit
+	}
+	for _, match := range matches {
+		result, ok := s.visibleResult(ctx, u, scope, trees, match.Entry)
+		if !ok {
+			continue
+		}
+		page.Items = append(page.Items, ContentSearchResult{
+			SearchResult: result,
+			Snippet:      formatContentSnippet(match.Snippet),
+		})
+	}
+	return page, nil
+}
+
+// RunContentIndexer extracts queued files until ctx is canceled. It polls
+// the queue while idle and keeps draining it while jobs are available.
+func (s *SearchService) RunContentIndexer(ctx context.Context) {
+	if !s.ContentIndexerEnabled() {
+		return
+	}
+	cfg := s.config.Search.Content
+	s.logger.Info("content indexer started",
+		zap.Int("workers", cfg.Workers),
+		zap.Duration("poll_interval", cfg.PollInterval))
+	defer s.logger.Info("content indexer stopped")
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		wait := cfg.PollInterval
+		processed, err := s.ProcessContentJobs(ctx, cfg.Workers)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				s.logger.Warn("content indexing pass failed", zap.Error(err))
+			}
+		} else if processed > 0 {
+			wait = 0
+		}
+		timer.Reset(wait)
+	}
+}
+
+// ProcessContentJobs claims up to limit jobs and extracts them in parallel.
+// It returns the number of jobs claimed.
+func (s *SearchService) ProcessContentJobs(ctx context.Context, limit int) (int, error) {
+	if !s.ContentEnabled() {
+		return 0, ErrContentSearchDisabled
+	}
+	jobs, err := s.content.Claim(ctx, limit, contentJobLease)
+	if err != nil {
+		return 0, err
+	}
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *repository.ContentJob) {
+			defer wg.Done()
+			s.processContentJob(ctx, job)
+		}(job)
+	}
+	wg.Wait()
+	return len(jobs), nil
+}
+
+func (s *SearchService) processContentJob(ctx context.Context, job *repository.ContentJob) {
+	err := s.extractContent(ctx, job.Path)
+	if ctx.Err() != nil {
+		// The lease runs out and the job is picked up again.
+		return
+	}
+	if err == nil {
+		if err := s.content.Complete(ctx, job); err != nil {
+			s.logger.Warn("failed to complete content job", zap.String("path", job.Path), zap.Error(err))
+		}
+		return
+	}
+	if job.Attempts >= s.config.Search.Content.MaxAttempts {
+		s.logger.Warn("giving up content extraction",
+			zap.String("path", job.Path),
+			zap.Int("attempts", job.Attempts),
+			zap.Error(err))
+		if err := s.content.Complete(ctx, job); err != nil {
+			s.logger.Warn("failed to complete content job", zap.String("path", job.Path), zap.Error(err))
+		}
+		return
+	}
+	delay := time.Duration(job.Attempts) * contentRetryDelay
+	if err := s.content.Retry(ctx, job, err.Error(), delay); err != nil {
+		s.logger.Warn("failed to reschedule content job", zap.String("path", job.Path), zap.Error(err))
+	}
+}
+
+// extractContent brings the stored text of one logical path up to date.
+func (s *SearchService) extractContent(ctx context.Context, logical string) error {
+	covered, err := s.content.Covered(ctx, logical)
+	if err != nil {
+		return err
+	}
+	if !covered {
+		return s.content.DeleteDocuments(ctx, logical)
+	}
+	entry, err := s.repo.Get(ctx, logical)
+	if err != nil {
+		return err
+	}
+	if entry == nil || entry.IsDir {
+		// Removed since it was queued; its text went with the entry.
+		return nil
+	}
+	if !textextract.Supported(entry.Name) || entry.Size > s.config.Search.Content.MaxFileSize {
+		return s.content.DeleteDocuments(ctx, logical)
+	}
+	doc, err := s.content.GetDocument(ctx, logical)
+	if err != nil {
+		return err
+	}
+	if doc != nil && doc.SourceSize == entry.Size && doc.SourceModifiedAt.Equal(entry.ModifiedAt) {
+		return nil
+	}
+
+	fullPath := filepath.Join(s.webdavRoot, filepath.FromSlash(strings.TrimPrefix(logical, "/")))
+	file, err := s.storage.Open(s.volumes.Physical(fullPath))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	text, err := textextract.Extract(file, info.Size(), entry.Name, s.config.Search.Content.MaxTextBytes)
+	if errors.Is(err, textextract.ErrUnsupported) {
+		// Remember the version so it is not extracted again until it changes.
+		text, err = "", nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.content.UpsertDocument(ctx, &repository.ContentDocument{
+		Path:             logical,
+		SourceSize:       entry.Size,
+		SourceModifiedAt: entry.ModifiedAt,
+		Content:          segmentCJK(text),
+		ExtractedAt:      s.now(),
+	})
+}
+
+// enqueueContent queues a written file for extraction; the queue ignores
+// files outside opted-in spaces.
+func (s *SearchService) enqueueContent(ctx context.Context, fullPath string) {
+	if !s.ContentEnabled() {
+		return
+	}
+	logical, ok := s.indexablePath(fullPath)
+	if !ok || !textextract.Supported(logical) {
+		return
+	}
+	if _, err := s.content.Enqueue(ctx, []string{logical}); err != nil {
+		s.logger.Warn("failed to queue content extraction", zap.String("path", logical), zap.Error(err))
+	}
+}
+
+func (s *SearchService) enqueueContentTree(ctx context.Context, fullPath string) {
+	if !s.ContentEnabled() {
+		return
+	}
+	logical, ok := s.indexablePath(fullPath)
+	if !ok {
+		return
+	}
+	if _, err := s.content.EnqueueTree(ctx, logical); err != nil {
+		s.logger.Warn("failed to queue content extraction", zap.String("path", logical), zap.Error(err))
+	}
+}
+
+// The simple text search configuration splits words on spaces, which CJK
+// text does not use. Han and kana characters are therefore indexed one per
+// word and queried as phrases of adjacent characters.
+func isSegmentedRune(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana)
+}
+
+// segmentCJK separates every Han and kana character from neighbouring
+// letters and digits; punctuation already splits words.
+func segmentCJK(text string) string {
+	var b strings.Builder
+	b.Grow(len(text))
+	var prev rune
+	for _, r := range text {
+		if prev != 0 && ((isSegmentedRune(r) && isWordRune(prev)) || (isSegmentedRune(prev) && isWordRune(r))) {
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// unsegmentCJK drops the spaces segmentCJK added between two CJK
+// characters, looking through highlight markers.
+func unsegmentCJK(text string) string {
+	runes := []rune(text)
+	isMarker := func(r rune) bool {
+		return string(r) == repository.ContentHighlightStart || string(r) == repository.ContentHighlightStop
+	}
+	var b strings.Builder
+	b.Grow(len(text))
+	var last rune
+	for i, r := range runes {
+		if r == ' ' && isSegmentedRune(last) {
+			next := rune(0)
+			for _, candidate := range runes[i+1:] {
+				if !isMarker(candidate) {
+					next = candidate
+					break
+				}
+			}
+			if isSegmentedRune(next) {
+				continue
+			}
+		}
+		b.WriteRune(r)
+		if !isMarker(r) {
+			last = r
+		}
+	}
+	return b.String()
+}
+
+// contentSearchQuery turns each run of CJK characters outside quotes into a
+// quoted phrase of single characters, keeping a leading "-" attached.
+func contentSearchQuery(query string) string {
+	var b strings.Builder
+	inQuotes, inRun := false, false
+	var prev rune
+	for _, r := range query {
+		segmented := isSegmentedRune(r)
+		if inRun && !segmented {
+			b.WriteByte('"')
+			inRun = false
+			if isWordRune(r) {
+				b.WriteByte(' ')
+			}
+		}
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case segmented && inRun:
+			b.WriteByte(' ')
+		case segmented:
+			if isWordRune(prev) {
+				b.WriteByte(' ')
+			}
+			if !inQuotes {
+				b.WriteByte('"')
+				inRun = true
+			}
+		case inQuotes && isSegmentedRune(prev) && isWordRune(r):
+			b.WriteByte(' ')
+		}
+		b.WriteRune(r)
+		prev = r
+	}
+	if inRun {
+		b.WriteByte('"')
+	}
+	return b.String()
+}
+
+// formatContentSnippet escapes a snippet and turns the highlight markers
+// into <mark> elements, merging adjacent highlights.
+func formatContentSnippet(snippet string) string {
+	snippet = unsegmentCJK(snippet)
+	snippet = strings.ReplaceAll(snippet, repository.ContentHighlightStop+repository.ContentHighlightStart, "")
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, repository.ContentHighlightStart, "<mark>")
+	return strings.ReplaceAll(snippet, repository.ContentHighlightStop, "</mark>")
+}
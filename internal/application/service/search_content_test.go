@@ -0,0 +1,352 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+)
+
+// memoryContentRepo is an in-memory SearchContentRepository for tests. It
+// reads entries from the search repo the way the SQL version joins them.
+type memoryContentRepo struct {
+	mu      sync.Mutex
+	entries *memorySearchRepo
+	docs    map[string]*repository.ContentDocument
+	scopes  map[string]*repository.ContentScope
+	jobs    map[string]*repository.ContentJob
+}
+
+func newMemoryContentRepo(entries *memorySearchRepo) *memoryContentRepo {
+	return &memoryContentRepo{
+		entries: entries,
+		docs:    map[string]*repository.ContentDocument{},
+		scopes:  map[string]*repository.ContentScope{},
+		jobs:    map[string]*repository.ContentJob{},
+	}
+}
+
+func (r *memoryContentRepo) enqueueable(entry *repository.SearchEntry) bool {
+	if entry == nil || entry.IsDir {
+		return false
+	}
+	_, hasDoc := r.docs[entry.Path]
+	return r.covered(entry.Path) || hasDoc
+}
+
+func (r *memoryContentRepo) queue(p string) {
+	if job, ok := r.jobs[p]; ok {
+		job.Generation++
+		job.Attempts = 0
+		return
+	}
+	r.jobs[p] = &repository.ContentJob{Path: p, Generation: 1}
+}
+
+func (r *memoryContentRepo) Enqueue(_ context.Context, paths []string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var queued int64
+	for _, p := range paths {
+		if r.enqueueable(r.entries.entries[p]) {
+			r.queue(p)
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+func (r *memoryContentRepo) EnqueueTree(_ context.Context, prefix string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var queued int64
+	for p, entry := range r.entries.entries {
+		if inSearchTree(p, prefix) && r.enqueueable(entry) {
+			r.queue(p)
+			queued++
+		}
+	}
+	return queued, nil
+}
+
+func (r *memoryContentRepo) Claim(_ context.Context, limit int, _ time.Duration) ([]*repository.ContentJob, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	paths := make([]string, 0, len(r.jobs))
+	for p := range r.jobs {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	var claimed []*repository.ContentJob
+	for _, p := range paths {
+		if len(claimed) == limit {
+			break
+		}
+		job := r.jobs[p]
+		job.Attempts++
+		clone := *job
+		claimed = append(claimed, &clone)
+	}
+	return claimed, nil
+}
+
+func (r *memoryContentRepo) Complete(_ context.Context, job *repository.ContentJob) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if current, ok := r.jobs[job.Path]; ok && current.Generation == job.Generation {
+		delete(r.jobs, job.Path)
+	}
+	return nil
+}
+
+func (r *memoryContentRepo) Retry(context.Context, *repository.ContentJob, string, time.Duration) error {
+	return nil
+}
+
+func (r *memoryContentRepo) covered(p string) bool {
+	for _, scope := range r.scopes {
+		if inSearchTree(p, scope.Prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryContentRepo) Covered(_ context.Context, p string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.covered(p), nil
+}
+
+func (r *memoryContentRepo) GetDocument(_ context.Context, p string) (*repository.ContentDocument, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.docs[p], nil
+}
+
+func (r *memoryContentRepo) UpsertDocument(_ context.Context, doc *repository.ContentDocument) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clone := *doc
+	r.docs[doc.Path] = &clone
+	return nil
+}
+
+func (r *memoryContentRepo) DeleteDocuments(_ context.Context, p string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for key := range r.docs {
+		if inSearchTree(key, p) {
+			delete(r.docs, key)
+		}
+	}
+	return nil
+}
+
+func (r *memoryContentRepo) ListScopes(_ context.Context, userID string) ([]*repository.ContentScope, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var scopes []*repository.ContentScope
+	for _, scope := range r.scopes {
+		if scope.UserID == userID {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes, nil
+}
+
+func (r *memoryContentRepo) AddScope(_ context.Context, scope *repository.ContentScope) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clone := *scope
+	r.scopes[scope.UserID+"/"+scope.Space] = &clone
+	return nil
+}
+
+func (r *memoryContentRepo) RemoveScope(_ context.Context, userID, space string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.scopes, userID+"/"+space)
+	return nil
+}
+
+// Search matches quoted phrases and bare words as substrings and wraps each
+// matched word in the highlight markers, like ts_headline does.
+func (r *memoryContentRepo) Search(_ context.Context, filter repository.ContentFilter) ([]*repository.ContentMatch, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var terms []string
+	for i, part := range strings.Split(filter.Query, `"`) {
+		if i%2 == 1 {
+			terms = append(terms, strings.TrimSpace(part))
+			continue
+		}
+		terms = append(terms, strings.Fields(part)...)
+	}
+	var matches []*repository.ContentMatch
+	for p, doc := range r.docs {
+		entry := r.entries.entries[p]
+		if entry == nil {
+			continue
+		}
+		inTree := false
+		for _, prefix := range filter.Prefixes {
+			inTree = inTree || inSearchTree(p, prefix)
+		}
+		if !inTree {
+			continue
+		}
+		content := strings.ToLower(doc.Content)
+		snippet := doc.Content
+		matched := true
+		for _, term := range terms {
+			if !strings.Contains(content, strings.ToLower(term)) {
+				matched = false
+				break
+			}
+			for _, word := range strings.Fields(term) {
+				snippet = strings.ReplaceAll(snippet, word, repository.ContentHighlightStart+word+repository.ContentHighlightStop)
+			}
+		}
+		if matched {
+			clone := *entry
+			matches = append(matches, &repository.ContentMatch{Entry: &clone, Snippet: snippet})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Entry.Path < matches[j].Entry.Path })
+	return matches, nil
+}
+
+func newContentTestService(t *testing.T) (*SearchService, *memoryContentRepo, string) {
+	t.Helper()
+	svc, repo, cfg := newSearchTestService(t)
+	cfg.Search.Content.Enabled = true
+	content := newMemoryContentRepo(repo)
+	svc.SetContentRepository(content)
+	if !svc.ContentIndexerEnabled() {
+		t.Fatal("content indexer not enabled")
+	}
+	return svc, content, filepath.Join(cfg.WebDAV.Directory, "alice")
+}
+
+func TestSearchContentIndexesOptedInSpaces(t *testing.T) {
+	svc, content, root := newContentTestService(t)
+	ctx := context.Background()
+	alice := user.NewUser("alice", "alice")
+	recorder := svc.Recorder(nil)
+	plan := filepath.Join(root, "personal", "plan.md")
+	writeSearchTestFile(t, plan, "# 数据仓库 <规划>\n\nQuarterly budget review")
+	writeSearchTestFile(t, filepath.Join(root, "personal", "photo.jpg"), "jpg")
+	notes := filepath.Join(root, "apps", "notes", "todo.txt")
+	writeSearchTestFile(t, notes, "budget for apps")
+	if _, err := svc.Reindex(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	if len(content.jobs) != 0 {
+		t.Fatalf("jobs queued before opt-in: %v", content.jobs)
+	}
+
+	settings, err := svc.SetContentSpaces(ctx, alice, []string{"Personal"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, space := range settings.Spaces {
+		if space.Enabled != (space.Key == "personal") {
+			t.Fatalf("settings = %+v", settings.Spaces)
+		}
+	}
+	if _, err := svc.ProcessContentJobs(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if len(content.jobs) != 0 || len(content.docs) != 1 || content.docs["/alice/personal/plan.md"] == nil {
+		t.Fatalf("jobs = %v, docs = %v", content.jobs, content.docs)
+	}
+
+	page, err := svc.SearchContent(ctx, alice, ContentSearchQuery{Query: "budget"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Path != "/personal/plan.md" || page.Items[0].Space != "personal" {
+		t.Fatalf("budget results = %+v", page.Items)
+	}
+	if !strings.Contains(page.Items[0].Snippet, "<mark>budget</mark>") || !strings.Contains(page.Items[0].Snippet, "&lt;规划&gt;") {
+		t.Fatalf("snippet = %q", page.Items[0].Snippet)
+	}
+	page, err = svc.SearchContent(ctx, alice, ContentSearchQuery{Query: "仓库"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || !strings.Contains(page.Items[0].Snippet, "数据<mark>仓库</mark>") {
+		t.Fatalf("cjk results = %+v", page.Items)
+	}
+
+	// Writes outside opted-in spaces are not queued; overwrites are.
+	if err := recorder.UpsertFile(ctx, notes); err != nil {
+		t.Fatal(err)
+	}
+	if len(content.jobs) != 0 {
+		t.Fatalf("apps write queued: %v", content.jobs)
+	}
+	writeSearchTestFile(t, plan, "revised figures")
+	if err := recorder.UpsertFile(ctx, plan); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ProcessContentJobs(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ = svc.SearchContent(ctx, alice, ContentSearchQuery{Query: "budget"}); len(page.Items) != 0 {
+		t.Fatalf("stale text still matches: %+v", page.Items)
+	}
+	if page, _ = svc.SearchContent(ctx, alice, ContentSearchQuery{Query: "revised"}); len(page.Items) != 1 {
+		t.Fatalf("new text not indexed: %+v", page.Items)
+	}
+
+	if _, err := svc.SetContentSpaces(ctx, alice, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(content.docs) != 0 {
+		t.Fatalf("docs kept after opt-out: %v", content.docs)
+	}
+	if _, err := svc.SearchContent(ctx, alice, ContentSearchQuery{Query: " "}); !errors.Is(err, ErrSearchInvalid) {
+		t.Fatalf("empty query: err = %v", err)
+	}
+}
+
+func TestSearchContentSettingsRejectAppTokens(t *testing.T) {
+	svc, _, _ := newContentTestService(t)
+	ctx := middleware.WithUcanContext(context.Background(), &middleware.UcanContext{
+		AppCaps:    map[string][]string{"notes": {"read"}},
+		HasAppCaps: true,
+	})
+	if _, err := svc.SetContentSpaces(ctx, user.NewUser("alice", "alice"), []string{"personal"}); !errors.Is(err, auth.ErrAppScopeDenied) {
+		t.Fatalf("err = %v, want ErrAppScopeDenied", err)
+	}
+
+	var disabled *SearchService
+	if _, err := disabled.SearchContent(context.Background(), user.NewUser("alice", "alice"), ContentSearchQuery{Query: "x"}); !errors.Is(err, ErrContentSearchDisabled) {
+		t.Fatalf("disabled: err = %v", err)
+	}
+}
+
+func TestContentSearchSegmentation(t *testing.T) {
+	if got := segmentCJK("ab数据c 仓库"); got != "ab 数 据 c 仓 库" {
+		t.Fatalf("segmentCJK = %q", got)
+	}
+	if got := contentSearchQuery(`数据 -仓库 report "年度 计划"`); got != `"数 据" -"仓 库" report "年 度 计 划"` {
+		t.Fatalf("contentSearchQuery = %q", got)
+	}
+	snippet := "a <b> " + repository.ContentHighlightStart + "数" + repository.ContentHighlightStop + " " +
+		repository.ContentHighlightStart + "据" + repository.ContentHighlightStop + " c"
+	if got := formatContentSnippet(snippet); got != "a &lt;b&gt; <mark>数据</mark> c" {
+		t.Fatalf("formatContentSnippet = %q", got)
+	}
+}
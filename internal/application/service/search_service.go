@@ -0,0 +1,786 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/application/assetspace"
+	"github.com/yeying-community/warehouse/internal/domain/permission"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrSearchDisabled = errors.New("search is disabled")
+	ErrSearchInvalid  = errors.New("invalid search request")
+	ErrSearchNotFound = errors.New("search path not found")
+	ErrSearchDenied   = errors.New("search path access denied")
+)
+
+const (
+	SearchSpaceAll    = "all"
+	SearchSpaceShared = "shared"
+
+	defaultSearchLimit = 50
+	maxSearchTags      = 32
+	maxSearchTagLength = 64
+	searchIndexBatch   = 500
+)
+
+// SearchQuery describes one search request. Path and Space select the
+// caller's own trees; received shares are only searched when neither pins
+// the query to the caller's own tree.
+type SearchQuery struct {
+	Name string
+	// NamePattern is a raw SQL LIKE pattern matched case-insensitively.
+	NamePattern    string
+	Path           string
+	Space          string
+	Extensions     []string
+	ContentType    string
+	MinSize        *int64
+	MaxSize        *int64
+	ModifiedAfter  *time.Time
+	ModifiedBefore *time.Time
+	Tags           []string
+	IsDir          *bool
+	// ChildrenOnly limits results to the direct children of Path.
+	ChildrenOnly bool
+	Limit        int
+	Offset       int
+}
+
+// SearchResult is one match. Path is relative to the caller's root, or to
+// the shared resource for matches inside a received share.
+type SearchResult struct {
+	Path        string    `json:"path"`
+	Name        string    `json:"name"`
+	IsDir       bool      `json:"isDir"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"contentType,omitempty"`
+	ModifiedAt  time.Time `json:"modifiedAt"`
+	Tags        []string  `json:"tags"`
+	Space       string    `json:"space"`
+	ResourceID  string    `json:"resourceId,omitempty"`
+	Owner       string    `json:"owner,omitempty"`
+}
+
+// SearchPage is a page of results.
+type SearchPage struct {
+	Items      []SearchResult `json:"items"`
+	HasMore    bool           `json:"hasMore"`
+	NextOffset int            `json:"nextOffset,omitempty"`
+}
+
+// searchTree is one indexed tree a query may return results from.
+type searchTree struct {
+	prefix string
+	// root is the caller's own root prefix; empty for received shares.
+	root       string
+	resourceID string
+	owner      string
+}
+
+// SearchService keeps a filename and metadata index of user trees in
+// search_entries and answers searches against it. The index is fed by the
+// mutation pipeline (see Recorder) and can be rebuilt with Reindex.
+type SearchService struct {
+	config          *config.Config
+	repo            repository.SearchIndexRepository
+	content         repository.SearchContentRepository
+	permissionCheck permission.Checker
+	userRepo        user.Repository
+	sharedAccess    *SharedResourceAccessService
+	assetSpace      *assetspace.Manager
+	storage         storage.Backend
+	volumes         *storage.Volumes
+	webdavRoot      string
+	logger          *zap.Logger
+	now             func() time.Time
+}
+
+// NewSearchService returns nil when search is disabled.
+func NewSearchService(
+	cfg *config.Config,
+	repo repository.SearchIndexRepository,
+	permissionCheck permission.Checker,
+	userRepo user.Repository,
+	logger *zap.Logger,
+) *SearchService {
+	if cfg == nil || !cfg.Search.Enabled || repo == nil {
+		return nil
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	webdavRoot, err := filepath.Abs(strings.TrimSpace(cfg.WebDAV.Directory))
+	if err != nil {
+		logger.Warn("failed to resolve webdav root for search", zap.Error(err))
+		return nil
+	}
+	webdavRoot = filepath.Clean(webdavRoot)
+	return &SearchService{
+		config:          cfg,
+		repo:            repo,
+		permissionCheck: permissionCheck,
+		userRepo:        userRepo,
+		assetSpace:      assetspace.NewManager(cfg, logger),
+		storage:         storage.NewLocal(),
+		// Rebuilt on the absolute root so Logical lines up with webdavRoot.
+		volumes:    storage.NewVolumes(webdavRoot, storage.VolumesFromConfig(cfg).List()[1:]),
+		webdavRoot: webdavRoot,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// SetSharedResourceAccess enables searching inside received shares.
+func (s *SearchService) SetSharedResourceAccess(access *SharedResourceAccessService) {
+	if s != nil {
+		s.sharedAccess = access
+	}
+}
+
+// SetStorage sets the backend file metadata is read from.
+func (s *SearchService) SetStorage(backend storage.Backend) {
+	if s != nil && backend != nil {
+		s.storage = backend
+	}
+}
+
+// Enabled reports whether search is configured.
+func (s *SearchService) Enabled() bool {
+	return s != nil
+}
+
+// IndexesWrites reports whether this node maintains the shared index. Only
+// the active node writes it; a standby's replicated writes would otherwise
+// race the active node's entries.
+func (s *SearchService) IndexesWrites() bool {
+	if s == nil {
+		return false
+	}
+	if !s.config.Replication.Enabled {
+		return true
+	}
+	return strings.EqualFold(strings.TrimSpace(s.config.Node.Role), "active")
+}
+
+// Recorder wraps next so every recorded mutation also updates the index.
+func (s *SearchService) Recorder(next MutationRecorder) MutationRecorder {
+	if next == nil {
+		next = noopMutationRecorder{}
+	}
+	if !s.IndexesWrites() {
+		return next
+	}
+	return &searchIndexRecorder{next: next, search: s}
+}
+
+// Search runs query for u across the trees it may read.
+func (s *SearchService) Search(ctx context.Context, u *user.User, query SearchQuery) (*SearchPage, error) {
+	if s == nil {
+		return nil, ErrSearchDisabled
+	}
+	if u == nil {
+		return nil, fmt.Errorf("%w: user is required", ErrSearchInvalid)
+	}
+	limit, err := s.resolveLimit(query.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if query.Offset < 0 {
+		return nil, fmt.Errorf("%w: offset must not be negative", ErrSearchInvalid)
+	}
+
+	scope, err := resolveAppScope(ctx, s.config)
+	if err != nil {
+		return nil, err
+	}
+	trees, err := s.resolveTrees(ctx, u, query, scope.active)
+	if err != nil {
+		return nil, err
+	}
+	page := &SearchPage{Items: []SearchResult{}}
+	if len(trees) == 0 {
+		return page, nil
+	}
+
+	filter := repository.SearchFilter{
+		Name:           query.Name,
+		NamePattern:    query.NamePattern,
+		Extensions:     query.Extensions,
+		ContentType:    query.ContentType,
+		MinSize:        query.MinSize,
+		MaxSize:        query.MaxSize,
+		ModifiedAfter:  query.ModifiedAfter,
+		ModifiedBefore: query.ModifiedBefore,
+		Tags:           normalizeSearchTagList(query.Tags),
+		IsDir:          query.IsDir,
+		Limit:          limit + 1,
+		Offset:         query.Offset,
+	}
+	for _, tree := range trees {
+		filter.Prefixes = append(filter.Prefixes, tree.prefix)
+	}
+	if query.ChildrenOnly {
+		filter.ParentPath = trees[0].prefix
+	}
+
+	entries, err := s.repo.Search(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+		page.HasMore = true
+		page.NextOffset = query.Offset + limit
+	}
+
+	for _, entry := range entries {
+		if result, ok := s.visibleResult(ctx, u, scope, trees, entry); ok {
+			page.Items = append(page.Items, result)
+		}
+	}
+	return page, nil
+}
+
+// visibleResult maps an index entry onto the tree it was found in and
+// reports whether u may see it.
+func (s *SearchService) visibleResult(ctx context.Context, u *user.User, scope appScopeInfo, trees []searchTree, entry *repository.SearchEntry) (SearchResult, bool) {
+	tree, rel, ok := matchSearchTree(trees, entry.Path)
+	if !ok || rel == "/" {
+		return SearchResult{}, false
+	}
+	result := SearchResult{
+		Path:        rel,
+		Name:        entry.Name,
+		IsDir:       entry.IsDir,
+		Size:        entry.Size,
+		ContentType: entry.ContentType,
+		ModifiedAt:  entry.ModifiedAt,
+		Tags:        entry.Tags,
+		Space:       SearchSpaceShared,
+		ResourceID:  tree.resourceID,
+		Owner:       tree.owner,
+	}
+	if tree.resourceID != "" {
+		return result, true
+	}
+	result.Space = s.spaceOf(rel)
+	// Own results honour path rules and UCAN app scope like a read would.
+	if scope.active && !scope.allowsAny(rel, "read") {
+		return SearchResult{}, false
+	}
+	if s.permissionCheck != nil {
+		if err := s.permissionCheck.Check(ctx, u, filepath.Join(searchUserDirectory(u), strings.TrimPrefix(rel, "/")), permission.OperationRead); err != nil {
+			return SearchResult{}, false
+		}
+	}
+	return result, true
+}
+
+// SetTags replaces the tags of a path in u's own tree.
+func (s *SearchService) SetTags(ctx context.Context, u *user.User, rawPath string, tags []string) (*SearchResult, error) {
+	if s == nil {
+		return nil, ErrSearchDisabled
+	}
+	if u == nil {
+		return nil, fmt.Errorf("%w: user is required", ErrSearchInvalid)
+	}
+	rel := path.Clean("/" + strings.TrimSpace(rawPath))
+	if rel == "/" {
+		return nil, fmt.Errorf("%w: path is required", ErrSearchInvalid)
+	}
+	normalized, err := normalizeSearchTags(tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := enforceAppScope(ctx, s.config, rel, "update"); err != nil {
+		return nil, err
+	}
+	if s.permissionCheck != nil {
+		if err := s.permissionCheck.Check(ctx, u, filepath.Join(searchUserDirectory(u), strings.TrimPrefix(rel, "/")), permission.OperationWrite); err != nil {
+			return nil, ErrSearchDenied
+		}
+	}
+
+	fullPath := filepath.Join(ResolveUserRoot(s.config, u), filepath.FromSlash(strings.TrimPrefix(rel, "/")))
+	logical, ok := s.logicalPath(fullPath)
+	if !ok {
+		return nil, ErrSearchNotFound
+	}
+	entry, err := s.entryFor(fullPath, logical)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrSearchNotFound
+		}
+		return nil, err
+	}
+	// Tag writes are allowed on any node; the entry may not be indexed yet.
+	if err := s.repo.Upsert(ctx, []*repository.SearchEntry{entry}); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetTags(ctx, logical, normalized); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSearchNotFound
+		}
+		return nil, err
+	}
+	return &SearchResult{
+		Path:        rel,
+		Name:        entry.Name,
+		IsDir:       entry.IsDir,
+		Size:        entry.Size,
+		ContentType: entry.ContentType,
+		ModifiedAt:  entry.ModifiedAt,
+		Tags:        normalized,
+		Space:       s.spaceOf(rel),
+	}, nil
+}
+
+// SearchReindexReport summarizes a Reindex run.
+type SearchReindexReport struct {
+	Username string `json:"username"`
+	Indexed  int    `json:"indexed"`
+	Removed  int64  `json:"removed"`
+	// ContentQueued counts files queued for text extraction.
+	ContentQueued int64 `json:"contentQueued,omitempty"`
+}
+
+// Reindex walks u's tree, refreshes every entry and drops entries for files
+// that no longer exist.
+func (s *SearchService) Reindex(ctx context.Context, u *user.User) (*SearchReindexReport, error) {
+	if s == nil {
+		return nil, ErrSearchDisabled
+	}
+	root := ResolveUserRoot(s.config, u)
+	prefix, ok := s.logicalPath(root)
+	if !ok || prefix == "/" {
+		return nil, fmt.Errorf("%w: user %s has no indexable directory", ErrSearchInvalid, u.Username)
+	}
+	started := s.now()
+	indexed, err := s.indexTree(ctx, root, true)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := s.repo.DeleteStale(ctx, prefix, started)
+	if err != nil {
+		return nil, err
+	}
+	report := &SearchReindexReport{Username: u.Username, Indexed: indexed, Removed: removed}
+	if s.ContentEnabled() {
+		// Unchanged files are skipped by the extractor.
+		if report.ContentQueued, err = s.content.EnqueueTree(ctx, prefix); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+func (s *SearchService) resolveLimit(limit int) (int, error) {
+	if limit < 0 {
+		return 0, fmt.Errorf("%w: limit must not be negative", ErrSearchInvalid)
+	}
+	maxResults := s.config.Search.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultSearchLimit
+	}
+	if limit == 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxResults {
+		limit = maxResults
+	}
+	return limit, nil
+}
+
+// resolveTrees maps the query onto indexed prefixes. The caller's own tree
+// always comes first so ChildrenOnly can use it as the parent.
+func (s *SearchService) resolveTrees(ctx context.Context, u *user.User, query SearchQuery, appScoped bool) ([]searchTree, error) {
+	space := strings.ToLower(strings.TrimSpace(query.Space))
+	if space == "" {
+		space = SearchSpaceAll
+	}
+	rootPrefix, ok := s.logicalPath(ResolveUserRoot(s.config, u))
+	if !ok || rootPrefix == "/" {
+		return nil, fmt.Errorf("%w: user directory is outside webdav root", ErrSearchInvalid)
+	}
+
+	var trees []searchTree
+	if space != SearchSpaceShared {
+		rel := "/"
+		if space != SearchSpaceAll {
+			spacePath, ok := s.spacePath(space)
+			if !ok {
+				return nil, fmt.Errorf("%w: unknown space %q", ErrSearchInvalid, query.Space)
+			}
+			rel = spacePath
+		}
+		if raw := strings.TrimSpace(query.Path); raw != "" {
+			requested := path.Clean("/" + raw)
+			if space != SearchSpaceAll && requested != rel && !strings.HasPrefix(requested, strings.TrimSuffix(rel, "/")+"/") {
+				return nil, fmt.Errorf("%w: path is outside space %q", ErrSearchInvalid, space)
+			}
+			rel = requested
+		}
+		trees = append(trees, searchTree{
+			prefix: joinSearchPath(rootPrefix, rel),
+			root:   rootPrefix,
+		})
+	}
+	if query.ChildrenOnly && len(trees) == 0 {
+		return nil, fmt.Errorf("%w: children-only search needs a path", ErrSearchInvalid)
+	}
+
+	// Path pins the query to the caller's own tree; app-scoped tokens never
+	// reach into shares.
+	searchShares := strings.TrimSpace(query.Path) == "" && (space == SearchSpaceAll || space == SearchSpaceShared)
+	if !searchShares || appScoped || s.sharedAccess == nil || s.userRepo == nil {
+		return trees, nil
+	}
+	received, err := s.sharedAccess.ListReceivedResources(ctx, u.ID, s.now())
+	if err != nil {
+		return nil, err
+	}
+	for _, resource := range received {
+		if !user.ParsePermissions(resource.Permissions).Read {
+			continue
+		}
+		owner, err := s.userRepo.FindByID(ctx, resource.OwnerUserID)
+		if err != nil || owner == nil {
+			continue
+		}
+		ownerRoot, ok := s.logicalPath(ResolveUserRoot(s.config, owner))
+		if !ok || ownerRoot == "/" {
+			continue
+		}
+		trees = append(trees, searchTree{
+			prefix:     joinSearchPath(ownerRoot, resource.NormalizedPath),
+			resourceID: resource.ID,
+			owner:      resource.OwnerUsername,
+		})
+	}
+	return trees, nil
+}
+
+func (s *SearchService) spacePath(space string) (string, bool) {
+	for _, item := range s.assetSpace.Spaces() {
+		if item.Key == space {
+			return path.Clean("/" + item.Path), true
+		}
+	}
+	return "", false
+}
+
+// spaceOf names the asset space a path in the caller's own tree belongs to.
+func (s *SearchService) spaceOf(rel string) string {
+	for _, item := range s.assetSpace.Spaces() {
+		spacePath := path.Clean("/" + item.Path)
+		if rel == spacePath || strings.HasPrefix(rel, spacePath+"/") {
+			return item.Key
+		}
+	}
+	return ""
+}
+
+// indexPath refreshes the entry of a single path.
+func (s *SearchService) indexPath(ctx context.Context, fullPath string) {
+	logical, ok := s.indexablePath(fullPath)
+	if !ok {
+		return
+	}
+	entry, err := s.entryFor(fullPath, logical)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			s.logger.Warn("failed to stat path for search index", zap.String("path", logical), zap.Error(err))
+		}
+		return
+	}
+	if err := s.repo.Upsert(ctx, []*repository.SearchEntry{entry}); err != nil {
+		s.logger.Warn("failed to update search index", zap.String("path", logical), zap.Error(err))
+	}
+}
+
+// indexTree refreshes root and everything below it.
+func (s *SearchService) indexTree(ctx context.Context, root string, skipRoot bool) (int, error) {
+	batch := make([]*repository.SearchEntry, 0, searchIndexBatch)
+	indexed := 0
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.repo.Upsert(ctx, batch); err != nil {
+			return err
+		}
+		indexed += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	physicalRoot := s.volumes.Physical(root)
+	err := s.storage.WalkDir(physicalRoot, func(current string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			if current == physicalRoot {
+				return walkErr
+			}
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if skipRoot && current == physicalRoot {
+			return nil
+		}
+		logical, ok := s.indexablePath(current)
+		if !ok {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		batch = append(batch, s.newEntry(logical, info))
+		if len(batch) >= searchIndexBatch {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return indexed, err
+	}
+	if err := flush(); err != nil {
+		return indexed, err
+	}
+	return indexed, nil
+}
+
+func (s *SearchService) removeTree(ctx context.Context, fullPath string) {
+	logical, ok := s.indexablePath(fullPath)
+	if !ok {
+		return
+	}
+	if err := s.repo.DeleteTree(ctx, logical); err != nil {
+		s.logger.Warn("failed to remove search index entries", zap.String("path", logical), zap.Error(err))
+	}
+}
+
+func (s *SearchService) moveTree(ctx context.Context, fromFullPath, toFullPath string, isDir bool) {
+	fromPath, fromOK := s.indexablePath(fromFullPath)
+	_, toOK := s.indexablePath(toFullPath)
+	switch {
+	case fromOK && toOK:
+		toPath, _ := s.logicalPath(toFullPath)
+		if err := s.repo.MoveTree(ctx, fromPath, toPath); err != nil {
+			s.logger.Warn("failed to move search index entries",
+				zap.String("from", fromPath),
+				zap.String("to", toPath),
+				zap.Error(err))
+			return
+		}
+		// The moved root changes name and parent.
+		s.indexPath(ctx, toFullPath)
+		// Text moved along with the entries; the destination may be outside
+		// the opted-in spaces or have a different extension.
+		s.enqueueContentTree(ctx, toFullPath)
+	case fromOK:
+		// Moved into a hidden store such as the recycle bin.
+		s.removeTree(ctx, fromFullPath)
+	case toOK:
+		// Restored from a hidden store.
+		s.copyTree(ctx, toFullPath, isDir)
+	}
+}
+
+func (s *SearchService) copyTree(ctx context.Context, toFullPath string, isDir bool) {
+	if !isDir {
+		s.indexPath(ctx, toFullPath)
+		s.enqueueContent(ctx, toFullPath)
+		return
+	}
+	if _, err := s.indexTree(ctx, toFullPath, false); err != nil {
+		s.logger.Warn("failed to index copied tree", zap.String("path", toFullPath), zap.Error(err))
+		return
+	}
+	s.enqueueContentTree(ctx, toFullPath)
+}
+
+func (s *SearchService) entryFor(fullPath, logical string) (*repository.SearchEntry, error) {
+	info, err := s.storage.Stat(s.volumes.Physical(fullPath))
+	if err != nil {
+		return nil, err
+	}
+	return s.newEntry(logical, info), nil
+}
+
+func (s *SearchService) newEntry(logical string, info fs.FileInfo) *repository.SearchEntry {
+	name := path.Base(logical)
+	entry := &repository.SearchEntry{
+		Path:       logical,
+		ParentPath: path.Dir(logical),
+		Name:       name,
+		IsDir:      info.IsDir(),
+		ModifiedAt: info.ModTime().UTC(),
+		IndexedAt:  s.now(),
+	}
+	if !entry.IsDir {
+		entry.Size = info.Size()
+		entry.Extension = strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+		if entry.Extension != "" {
+			if contentType := mime.TypeByExtension("." + entry.Extension); contentType != "" {
+				if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+					contentType = mediaType
+				}
+				entry.ContentType = contentType
+			}
+		}
+	}
+	return entry
+}
+
+// indexablePath returns the logical path of fullPath when it belongs in the
+// index: inside a user tree, outside hidden stores and not a sync artifact.
+func (s *SearchService) indexablePath(fullPath string) (string, bool) {
+	logical, ok := s.logicalPath(fullPath)
+	if !ok {
+		return "", false
+	}
+	segments := strings.Split(strings.TrimPrefix(logical, "/"), "/")
+	if len(segments) < 2 || strings.HasPrefix(segments[0], ".") {
+		return "", false
+	}
+	if isEphemeralSyncArtifactPath(logical) {
+		return "", false
+	}
+	return logical, true
+}
+
+// logicalPath maps a full path to its slash-separated path relative to the
+// webdav root, resolving other volumes back onto the root.
+func (s *SearchService) logicalPath(fullPath string) (string, bool) {
+	trimmed := strings.TrimSpace(fullPath)
+	if trimmed == "" {
+		return "", false
+	}
+	absPath, err := filepath.Abs(trimmed)
+	if err != nil {
+		return "", false
+	}
+	absPath = s.volumes.Logical(filepath.Clean(absPath))
+	rel, err := filepath.Rel(s.webdavRoot, absPath)
+	if err != nil {
+		return "", false
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == "." {
+		return "/", true
+	}
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return "/" + rel, true
+}
+
+func searchUserDirectory(u *user.User) string {
+	if u.Directory != "" {
+		return u.Directory
+	}
+	return u.Username
+}
+
+func joinSearchPath(prefix, rel string) string {
+	return path.Join(prefix, path.Clean("/"+rel))
+}
+
+func matchSearchTree(trees []searchTree, logical string) (searchTree, string, bool) {
+	for _, tree := range trees {
+		if logical == tree.prefix {
+			// The searched directory itself is not a result.
+			return tree, "/", true
+		}
+		if strings.HasPrefix(logical, tree.prefix+"/") {
+			if tree.resourceID != "" {
+				return tree, strings.TrimPrefix(logical, tree.prefix), true
+			}
+			return tree, strings.TrimPrefix(logical, tree.root), true
+		}
+	}
+	return searchTree{}, "", false
+}
+
+func normalizeSearchTags(tags []string) ([]string, error) {
+	normalized := normalizeSearchTagList(tags)
+	if len(normalized) > maxSearchTags {
+		return nil, fmt.Errorf("%w: at most %d tags are allowed", ErrSearchInvalid, maxSearchTags)
+	}
+	for _, tag := range normalized {
+		if len(tag) > maxSearchTagLength {
+			return nil, fmt.Errorf("%w: tag %q is longer than %d bytes", ErrSearchInvalid, tag, maxSearchTagLength)
+		}
+	}
+	return normalized, nil
+}
+
+func normalizeSearchTagList(tags []string) []string {
+	normalized := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, raw := range tags {
+		tag := strings.ToLower(strings.TrimSpace(raw))
+		if tag == "" {
+			continue
+		}
+		if _, ok := seen[tag]; ok {
+			continue
+		}
+		seen[tag] = struct{}{}
+		normalized = append(normalized, tag)
+	}
+	return normalized
+}
+
+// searchIndexRecorder feeds the search index from the mutation pipeline.
+// Index failures are logged and never fail the write.
+type searchIndexRecorder struct {
+	next   MutationRecorder
+	search *SearchService
+}
+
+func (r *searchIndexRecorder) EnsureDir(ctx context.Context, fullPath string) error {
+	r.search.indexPath(ctx, fullPath)
+	return r.next.EnsureDir(ctx, fullPath)
+}
+
+func (r *searchIndexRecorder) UpsertFile(ctx context.Context, fullPath string) error {
+	r.search.indexPath(ctx, fullPath)
+	r.search.enqueueContent(ctx, fullPath)
+	return r.next.UpsertFile(ctx, fullPath)
+}
+
+func (r *searchIndexRecorder) MovePath(ctx context.Context, fromFullPath, toFullPath string, isDir bool) error {
+	r.search.moveTree(ctx, fromFullPath, toFullPath, isDir)
+	return r.next.MovePath(ctx, fromFullPath, toFullPath, isDir)
+}
+
+func (r *searchIndexRecorder) CopyPath(ctx context.Context, fromFullPath, toFullPath string, isDir bool) error {
+	r.search.copyTree(ctx, toFullPath, isDir)
+	return r.next.CopyPath(ctx, fromFullPath, toFullPath, isDir)
+}
+
+func (r *searchIndexRecorder) RemovePath(ctx context.Context, fullPath string, isDir bool) error {
+	r.search.removeTree(ctx, fullPath)
+	return r.next.RemovePath(ctx, fullPath, isDir)
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+)
+
+// memorySearchRepo is an in-memory SearchIndexRepository for tests.
+type memorySearchRepo struct {
+	entries map[string]*repository.SearchEntry
+}
+
+func newMemorySearchRepo() *memorySearchRepo {
+	return &memorySearchRepo{entries: map[string]*repository.SearchEntry{}}
+}
+
+func inSearchTree(p, root string) bool {
+	return p == root || strings.HasPrefix(p, strings.TrimSuffix(root, "/")+"/")
+}
+
+func (r *memorySearchRepo) Upsert(_ context.Context, entries []*repository.SearchEntry) error {
+	for _, entry := range entries {
+		clone := *entry
+		if existing, ok := r.entries[entry.Path]; ok {
+			clone.Tags = existing.Tags
+		}
+		r.entries[entry.Path] = &clone
+	}
+	return nil
+}
+
+func (r *memorySearchRepo) Get(_ context.Context, p string) (*repository.SearchEntry, error) {
+	return r.entries[p], nil
+}
+
+func (r *memorySearchRepo) DeleteTree(_ context.Context, p string) error {
+	for key := range r.entries {
+		if inSearchTree(key, p) {
+			delete(r.entries, key)
+		}
+	}
+	return nil
+}
+
+func (r *memorySearchRepo) MoveTree(ctx context.Context, fromPath, toPath string) error {
+	_ = r.DeleteTree(ctx, toPath)
+	for key, entry := range r.entries {
+		if !inSearchTree(key, fromPath) {
+			continue
+		}
+		delete(r.entries, key)
+		entry.Path = toPath + strings.TrimPrefix(key, fromPath)
+		if key != fromPath {
+			entry.ParentPath = toPath + strings.TrimPrefix(entry.ParentPath, fromPath)
+		}
+		r.entries[entry.Path] = entry
+	}
+	return nil
+}
+
+func (r *memorySearchRepo) SetTags(_ context.Context, p string, tags []string) error {
+	entry, ok := r.entries[p]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	entry.Tags = tags
+	return nil
+}
+
+func (r *memorySearchRepo) Search(_ context.Context, filter repository.SearchFilter) ([]*repository.SearchEntry, error) {
+	var matches []*repository.SearchEntry
+	for _, entry := range r.entries {
+		if len(filter.Prefixes) > 0 {
+			found := false
+			for _, prefix := range filter.Prefixes {
+				found = found || inSearchTree(entry.Path, prefix)
+			}
+			if !found {
+				continue
+			}
+		}
+		if filter.ParentPath != "" && entry.ParentPath != filter.ParentPath {
+			continue
+		}
+		if filter.Name != "" && !strings.Contains(strings.ToLower(entry.Name), strings.ToLower(filter.Name)) {
+			continue
+		}
+		if filter.IsDir != nil && entry.IsDir != *filter.IsDir {
+			continue
+		}
+		if filter.MinSize != nil && entry.Size < *filter.MinSize {
+			continue
+		}
+		if len(filter.Extensions) > 0 && !containsString(filter.Extensions, entry.Extension) {
+			continue
+		}
+		missingTag := false
+		for _, tag := range filter.Tags {
+			missingTag = missingTag || !containsString(entry.Tags, tag)
+		}
+		if missingTag {
+			continue
+		}
+		clone := *entry
+		matches = append(matches, &clone)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Name != matches[j].Name {
+			return strings.ToLower(matches[i].Name) < strings.ToLower(matches[j].Name)
+		}
+		return matches[i].Path < matches[j].Path
+	})
+	if filter.Offset >= len(matches) {
+		return nil, nil
+	}
+	matches = matches[filter.Offset:]
+	if filter.Limit > 0 && len(matches) > filter.Limit {
+		matches = matches[:filter.Limit]
+	}
+	return matches, nil
+}
+
+func (r *memorySearchRepo) DeleteStale(_ context.Context, prefix string, before time.Time) (int64, error) {
+	var removed int64
+	for key, entry := range r.entries {
+		if inSearchTree(key, prefix) && entry.IndexedAt.Before(before) {
+			delete(r.entries, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newSearchTestService(t *testing.T) (*SearchService, *memorySearchRepo, *config.Config) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = t.TempDir()
+	cfg.Search.Enabled = true
+	repo := newMemorySearchRepo()
+	svc := NewSearchService(cfg, repo, nil, nil, nil)
+	if svc == nil {
+		t.Fatal("search service not created")
+	}
+	return svc, repo, cfg
+}
+
+func writeSearchTestFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewSearchServiceDisabled(t *testing.T) {
+	cfg := config.DefaultConfig()
+	if svc := NewSearchService(cfg, newMemorySearchRepo(), nil, nil, nil); svc != nil {
+		t.Fatal("search service should be nil when disabled")
+	}
+	var svc *SearchService
+	if _, err := svc.Search(context.Background(), user.NewUser("alice", "alice"), SearchQuery{}); !errors.Is(err, ErrSearchDisabled) {
+		t.Fatalf("err = %v, want ErrSearchDisabled", err)
+	}
+	next := noopMutationRecorder{}
+	if got := svc.Recorder(next); got != next {
+		t.Fatal("disabled search must not wrap the recorder")
+	}
+}
+
+func TestSearchRecorderFollowsMutations(t *testing.T) {
+	svc, repo, cfg := newSearchTestService(t)
+	recorder := svc.Recorder(nil)
+	ctx := context.Background()
+	root := filepath.Join(cfg.WebDAV.Directory, "alice")
+	report := filepath.Join(root, "personal", "docs", "Report.PDF")
+	writeSearchTestFile(t, report, "pdf")
+
+	if err := recorder.EnsureDir(ctx, filepath.Dir(report)); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.UpsertFile(ctx, report); err != nil {
+		t.Fatal(err)
+	}
+	entry := repo.entries["/alice/personal/docs/Report.PDF"]
+	if entry == nil || entry.Extension != "pdf" || entry.ContentType != "application/pdf" || entry.Size != 3 || entry.ParentPath != "/alice/personal/docs" {
+		t.Fatalf("unexpected entry: %+v", entry)
+	}
+	if repo.entries["/alice/personal/docs"] == nil || !repo.entries["/alice/personal/docs"].IsDir {
+		t.Fatal("directory not indexed")
+	}
+
+	// Rename the directory: children follow.
+	renamed := filepath.Join(root, "personal", "papers")
+	if err := os.Rename(filepath.Dir(report), renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.MovePath(ctx, filepath.Dir(report), renamed, true); err != nil {
+		t.Fatal(err)
+	}
+	if repo.entries["/alice/personal/docs/Report.PDF"] != nil {
+		t.Fatal("old path still indexed")
+	}
+	moved := repo.entries["/alice/personal/papers/Report.PDF"]
+	if moved == nil || moved.ParentPath != "/alice/personal/papers" {
+		t.Fatalf("moved entry = %+v", moved)
+	}
+	if dir := repo.entries["/alice/personal/papers"]; dir == nil || dir.Name != "papers" {
+		t.Fatalf("moved root = %+v", dir)
+	}
+
+	// Deleting into the recycle bin drops the tree; restoring brings it back.
+	recycled := filepath.Join(cfg.WebDAV.Directory, ".recycle", "alice", "papers")
+	if err := os.MkdirAll(filepath.Dir(recycled), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(renamed, recycled); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.MovePath(ctx, renamed, recycled, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.entries) != 0 {
+		t.Fatalf("recycled entries still indexed: %v", repo.entries)
+	}
+	if err := os.Rename(recycled, renamed); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.MovePath(ctx, recycled, renamed, true); err != nil {
+		t.Fatal(err)
+	}
+	if repo.entries["/alice/personal/papers/Report.PDF"] == nil {
+		t.Fatal("restored tree not indexed")
+	}
+
+	if err := recorder.RemovePath(ctx, renamed, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.entries) != 0 {
+		t.Fatalf("removed entries still indexed: %v", repo.entries)
+	}
+}
+
+func TestSearchServiceIndexesOnlyOnActiveNode(t *testing.T) {
+	svc, _, cfg := newSearchTestService(t)
+	cfg.Replication.Enabled = true
+	cfg.Node.Role = "standby"
+	if svc.IndexesWrites() {
+		t.Fatal("standby must not write the shared index")
+	}
+	cfg.Node.Role = "active"
+	if !svc.IndexesWrites() {
+		t.Fatal("active node must write the index")
+	}
+}
+
+func TestSearchServiceSearchScopesAndPagination(t *testing.T) {
+	svc, repo, cfg := newSearchTestService(t)
+	ctx := context.Background()
+	alice := user.NewUser("alice", "alice")
+	for _, name := range []string{
+		"alice/personal/a-report.txt",
+		"alice/personal/b-report.txt",
+		"alice/apps/notes/c-report.txt",
+		"bob/personal/report.txt",
+	} {
+		writeSearchTestFile(t, filepath.Join(cfg.WebDAV.Directory, filepath.FromSlash(name)), "x")
+	}
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := svc.Reindex(ctx, user.NewUser(name, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := svc.Search(ctx, alice, SearchQuery{Name: "report", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 || !page.HasMore || page.NextOffset != 2 {
+		t.Fatalf("first page = %+v", page)
+	}
+	if page.Items[0].Path != "/personal/a-report.txt" || page.Items[0].Space != "personal" {
+		t.Fatalf("first item = %+v", page.Items[0])
+	}
+	page, err = svc.Search(ctx, alice, SearchQuery{Name: "report", Limit: 2, Offset: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.HasMore || page.Items[0].Path != "/apps/notes/c-report.txt" || page.Items[0].Space != "apps" {
+		t.Fatalf("second page = %+v", page)
+	}
+
+	page, err = svc.Search(ctx, alice, SearchQuery{Space: "apps"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range page.Items {
+		if !strings.HasPrefix(item.Path, "/apps/") {
+			t.Fatalf("space filter leaked %s", item.Path)
+		}
+	}
+	if _, err := svc.Search(ctx, alice, SearchQuery{Space: "apps", Path: "/personal"}); !errors.Is(err, ErrSearchInvalid) {
+		t.Fatalf("path outside space: err = %v", err)
+	}
+	if _, err := svc.Search(ctx, alice, SearchQuery{Space: "nope"}); !errors.Is(err, ErrSearchInvalid) {
+		t.Fatalf("unknown space: err = %v", err)
+	}
+
+	page, err = svc.Search(ctx, alice, SearchQuery{Path: "/personal", ChildrenOnly: true, IsDir: boolPointer(false)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 2 {
+		t.Fatalf("children of /personal = %+v", page.Items)
+	}
+
+	// Stale entries disappear on reindex.
+	if err := os.Remove(filepath.Join(cfg.WebDAV.Directory, "alice", "personal", "a-report.txt")); err != nil {
+		t.Fatal(err)
+	}
+	svc.now = func() time.Time { return time.Now().Add(time.Second) }
+	report, err := svc.Reindex(ctx, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Removed != 1 || repo.entries["/alice/personal/a-report.txt"] != nil {
+		t.Fatalf("reindex report = %+v", report)
+	}
+}
+
+func TestSearchServiceSetTags(t *testing.T) {
+	svc, _, cfg := newSearchTestService(t)
+	ctx := context.Background()
+	alice := user.NewUser("alice", "alice")
+	writeSearchTestFile(t, filepath.Join(cfg.WebDAV.Directory, "alice", "personal", "trip.jpg"), "jpg")
+
+	result, err := svc.SetTags(ctx, alice, "/personal/trip.jpg", []string{" Travel ", "travel", "2024"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Tags, ",") != "travel,2024" || result.ContentType != "image/jpeg" {
+		t.Fatalf("result = %+v", result)
+	}
+	page, err := svc.Search(ctx, alice, SearchQuery{Tags: []string{"TRAVEL"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Name != "trip.jpg" {
+		t.Fatalf("tag search = %+v", page.Items)
+	}
+	if _, err := svc.SetTags(ctx, alice, "/personal/missing.jpg", []string{"x"}); !errors.Is(err, ErrSearchNotFound) {
+		t.Fatalf("missing path: err = %v", err)
+	}
+	if _, err := svc.SetTags(ctx, alice, "/personal/trip.jpg", []string{strings.Repeat("x", 65)}); !errors.Is(err, ErrSearchInvalid) {
+		t.Fatalf("long tag: err = %v", err)
+	}
+}
+
+func boolPointer(value bool) *bool {
+	return &value
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultShareAccessLogPage and maxShareAccessLogPage size one page of
+	// access log queries.
+	defaultShareAccessLogPage = 50
+	maxShareAccessLogPage     = 200
+	// maxShareAccessUserAgent truncates user agents before they are stored.
+	maxShareAccessUserAgent = 512
+)
+
+// ShareAccessRecord describes one public share request for the access log.
+type ShareAccessRecord struct {
+	Action    string
+	Path      string
+	IP        string
+	UserAgent string
+	Bytes     int64
+	Status    int
+}
+
+// SetAccessLogRepository 启用公开分享的访问日志
+func (s *ShareService) SetAccessLogRepository(repo repository.ShareAccessLogRepository) {
+	s.accessLogs = repo
+}
+
+// RecordAccess 记录一次公开分享访问，token 不对应任何分享时不记录；写入失败只记日志
+func (s *ShareService) RecordAccess(ctx context.Context, token string, record ShareAccessRecord) {
+	if s.accessLogs == nil || strings.TrimSpace(token) == "" {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	item, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		if !errors.Is(err, share.ErrShareNotFound) {
+			s.logger.Warn("failed to load share for access log", zap.String("token", token), zap.Error(err))
+		}
+		return
+	}
+	userAgent := record.UserAgent
+	if len(userAgent) > maxShareAccessUserAgent {
+		userAgent = userAgent[:maxShareAccessUserAgent]
+	}
+	entry := &share.AccessLogEntry{
+		ShareID:       item.ID,
+		Token:         item.Token,
+		CreatorUserID: item.CreatorUserID,
+		Action:        record.Action,
+		Path:          record.Path,
+		IP:            record.IP,
+		UserAgent:     userAgent,
+		Bytes:         record.Bytes,
+		Status:        record.Status,
+		Result:        shareAccessResult(record.Status),
+		CreatedAt:     s.now(),
+	}
+	if err := s.accessLogs.Append(ctx, entry); err != nil {
+		s.logger.Warn("failed to record share access", zap.String("token", token), zap.Error(err))
+	}
+}
+
+// ShareAccessLogPage 一页访问日志
+type ShareAccessLogPage struct {
+	Items      []*share.AccessLogEntry
+	HasMore    bool
+	NextOffset int
+}
+
+// ListAccessLog 查询当前用户创建的公开分享的访问日志，token 为空时返回全部分享，
+// 已撤销的分享仍可查询
+func (s *ShareService) ListAccessLog(ctx context.Context, u *user.User, token string, limit, offset int) (*ShareAccessLogPage, error) {
+	return s.SearchAccessLog(ctx, repository.ShareAccessLogFilter{
+		Token:         strings.TrimSpace(token),
+		CreatorUserID: u.ID,
+		Limit:         limit,
+		Offset:        offset,
+	})
+}
+
+// SearchAccessLog 按条件查询所有公开分享的访问日志（管理员）
+func (s *ShareService) SearchAccessLog(ctx context.Context, filter repository.ShareAccessLogFilter) (*ShareAccessLogPage, error) {
+	page := &ShareAccessLogPage{Items: []*share.AccessLogEntry{}}
+	if s.accessLogs == nil {
+		return page, nil
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultShareAccessLogPage
+	}
+	if limit > maxShareAccessLogPage {
+		limit = maxShareAccessLogPage
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	// Fetch one extra row to tell whether another page exists.
+	filter.Limit = limit + 1
+	items, err := s.accessLogs.List(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) > limit {
+		page.HasMore = true
+		page.NextOffset = filter.Offset + limit
+		items = items[:limit]
+	}
+	page.Items = items
+	return page, nil
+}
+
+// shareAccessResult classifies a response status for the access log.
+func shareAccessResult(status int) string {
+	switch {
+	case status < http.StatusBadRequest:
+		return share.AccessResultOK
+	case status == http.StatusUnauthorized:
+		return share.AccessResultUnauthorized
+	case status == http.StatusForbidden:
+		return share.AccessResultForbidden
+	case status == http.StatusNotFound:
+		return share.AccessResultNotFound
+	case status == http.StatusGone:
+		return share.AccessResultExpired
+	case status == http.StatusTooManyRequests:
+		return share.AccessResultThrottled
+	case status >= http.StatusInternalServerError:
+		return share.AccessResultError
+	default:
+		return share.AccessResultRejected
+	}
+}
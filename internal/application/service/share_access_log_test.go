@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+type memoryShareAccessLogRepo struct {
+	mu      sync.Mutex
+	entries []*share.AccessLogEntry
+}
+
+func (r *memoryShareAccessLogRepo) Append(_ context.Context, entry *share.AccessLogEntry) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.ID = int64(len(r.entries) + 1)
+	copied := *entry
+	r.entries = append(r.entries, &copied)
+	return nil
+}
+
+func (r *memoryShareAccessLogRepo) List(_ context.Context, filter repository.ShareAccessLogFilter) ([]*share.AccessLogEntry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var matched []*share.AccessLogEntry
+	for i := len(r.entries) - 1; i >= 0; i-- {
+		entry := r.entries[i]
+		if (filter.Token != "" && entry.Token != filter.Token) ||
+			(filter.CreatorUserID != "" && entry.CreatorUserID != filter.CreatorUserID) ||
+			(filter.Result != "" && entry.Result != filter.Result) {
+			continue
+		}
+		matched = append(matched, entry)
+	}
+	if filter.Offset >= len(matched) {
+		return nil, nil
+	}
+	matched = matched[filter.Offset:]
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return matched, nil
+}
+
+func TestShareServiceAccessLimitsExpireLinkAndRecordAccess(t *testing.T) {
+	root := t.TempDir()
+	writeRecoverTestFile(t, filepath.Join(root, "alice", "report.pdf"), "report")
+	writeRecoverTestFile(t, filepath.Join(root, "alice", "inbox", "keep.txt"), "keep")
+
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = root
+	users := newTestUserRepo()
+	owner := &user.User{ID: "u1", Username: "alice", Directory: "alice"}
+	_ = users.Save(context.Background(), owner)
+	repo := newMemoryPublicShareRepo()
+	logs := &memoryShareAccessLogRepo{}
+	svc := NewShareService(repo, users, cfg, zap.NewNop())
+	svc.SetAccessLogRepository(logs)
+	ctx := context.Background()
+
+	if _, err := svc.Create(ctx, owner, "/report.pdf", ShareCreateInput{MaxDownloads: -1}); err == nil {
+		t.Fatal("negative limits must be rejected")
+	}
+	if _, err := svc.Create(ctx, owner, "/inbox", ShareCreateInput{Mode: share.ModeUpload, MaxViews: 3}); err == nil {
+		t.Fatal("view limits must be rejected for upload shares")
+	}
+	item, err := svc.Create(ctx, owner, "/report.pdf", ShareCreateInput{MaxDownloads: 2})
+	if err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := svc.IncrementDownload(ctx, item.Token); err != nil {
+			t.Fatalf("download %d: %v", i+1, err)
+		}
+		svc.RecordAccess(ctx, item.Token, ShareAccessRecord{Action: share.AccessDownload, IP: "203.0.113.7", Bytes: 6, Status: http.StatusOK})
+	}
+	if err := svc.IncrementDownload(ctx, item.Token); !errors.Is(err, share.ErrShareExpired) {
+		t.Fatalf("download above the limit should expire the link, got %v", err)
+	}
+	if _, _, err := svc.ResolvePath(ctx, item.Token); !errors.Is(err, share.ErrShareExpired) {
+		t.Fatalf("exhausted share should resolve as expired, got %v", err)
+	}
+	svc.RecordAccess(ctx, item.Token, ShareAccessRecord{Action: share.AccessDownload, IP: "203.0.113.8", Status: http.StatusGone})
+	svc.RecordAccess(ctx, "missing-token", ShareAccessRecord{Action: share.AccessView, Status: http.StatusNotFound})
+
+	page, err := svc.ListAccessLog(ctx, owner, item.Token, 2, 0)
+	if err != nil {
+		t.Fatalf("list access log: %v", err)
+	}
+	if len(page.Items) != 2 || !page.HasMore || page.NextOffset != 2 {
+		t.Fatalf("unexpected first page: %d items, hasMore=%v next=%d", len(page.Items), page.HasMore, page.NextOffset)
+	}
+	latest := page.Items[0]
+	if latest.Result != share.AccessResultExpired || latest.IP != "203.0.113.8" || latest.ShareID != item.ID {
+		t.Fatalf("unexpected latest entry: %+v", latest)
+	}
+	if page.Items[1].Result != share.AccessResultOK || page.Items[1].Bytes != 6 {
+		t.Fatalf("unexpected successful entry: %+v", page.Items[1])
+	}
+
+	stranger := &user.User{ID: "u2", Username: "bob"}
+	if page, err := svc.ListAccessLog(ctx, stranger, item.Token, 0, 0); err != nil || len(page.Items) != 0 {
+		t.Fatalf("other users must not see the log: %+v, %v", page, err)
+	}
+	page, err = svc.SearchAccessLog(ctx, repository.ShareAccessLogFilter{Result: share.AccessResultOK})
+	if err != nil || len(page.Items) != 2 || page.HasMore {
+		t.Fatalf("admin search by result: %+v, %v", page, err)
+	}
+	if time.Since(page.Items[0].CreatedAt) > time.Minute {
+		t.Fatalf("unexpected timestamp %v", page.Items[0].CreatedAt)
+	}
+}
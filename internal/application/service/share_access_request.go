@@ -0,0 +1,234 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/sharegrant"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+// maxShareAccessRequestMessage 申请说明与处理备注的最大字符数
+const maxShareAccessRequestMessage = 500
+
+// ShareAccessRequestInput 访问申请内容
+type ShareAccessRequestInput struct {
+	// Permissions 申请的完整权限（CRUD 子集），批准时与申请人现有个人授权合并
+	Permissions string
+	Expiry      ShareExpiryInput
+	Message     string
+}
+
+// ShareAccessRequestService 共享资源访问/升级申请：接收方或公开链接访问者发起，所有者批准或拒绝，
+// 批准时创建或扩展申请人的个人授权
+type ShareAccessRequestService struct {
+	repo          repository.ShareAccessRequestRepository
+	grants        repository.SharedResourceGrantRepository
+	shareRepo     repository.ShareRepository
+	notifications *NotificationService
+	config        *config.Config
+	logger        *zap.Logger
+	now           func() time.Time
+}
+
+// NewShareAccessRequestService 创建访问申请服务
+func NewShareAccessRequestService(
+	repo repository.ShareAccessRequestRepository,
+	grants repository.SharedResourceGrantRepository,
+	shareRepo repository.ShareRepository,
+	cfg *config.Config,
+	logger *zap.Logger,
+) *ShareAccessRequestService {
+	return &ShareAccessRequestService{
+		repo:      repo,
+		grants:    grants,
+		shareRepo: shareRepo,
+		config:    cfg,
+		logger:    logger,
+		now:       time.Now,
+	}
+}
+
+// SetNotificationService 启用申请与处理结果通知
+func (s *ShareAccessRequestService) SetNotificationService(notifications *NotificationService) {
+	s.notifications = notifications
+}
+
+// RequestForResource 接收方对已共享给自己的资源申请权限或续期，授权已过期时同样可以申请
+func (s *ShareAccessRequestService) RequestForResource(ctx context.Context, requester *user.User, resourceID string, input ShareAccessRequestInput) (*sharegrant.AccessRequest, error) {
+	resource, _, err := s.grants.GetAccessibleGrants(ctx, strings.TrimSpace(resourceID), requester.ID)
+	if err != nil {
+		return nil, err
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("shared resource not found or inaccessible")
+	}
+	return s.create(ctx, requester, *resource, "", input)
+}
+
+// RequestForPublicShare 已登录用户通过公开分享链接向所有者申请定向授权
+func (s *ShareAccessRequestService) RequestForPublicShare(ctx context.Context, requester *user.User, token string, input ShareAccessRequestInput) (*sharegrant.AccessRequest, error) {
+	item, err := s.shareRepo.GetByToken(ctx, strings.TrimSpace(token))
+	if err != nil {
+		return nil, err
+	}
+	if item.IsExpired() || item.LimitReached() {
+		return nil, share.ErrShareExpired
+	}
+	prefix := ""
+	if s.config != nil {
+		prefix = s.config.WebDAV.Prefix
+	}
+	cleanPath, err := normalizeSharePath(NamePolicy(s.config), item.Path, prefix)
+	if err != nil {
+		return nil, share.ErrInvalidShare
+	}
+	resource := sharegrant.Resource{
+		OwnerUserID:    item.UserID,
+		NormalizedPath: cleanPath,
+		IsDir:          item.IsDir,
+	}
+	return s.create(ctx, requester, resource, item.ID, input)
+}
+
+func (s *ShareAccessRequestService) create(ctx context.Context, requester *user.User, resource sharegrant.Resource, publicShareID string, input ShareAccessRequestInput) (*sharegrant.AccessRequest, error) {
+	if resource.OwnerUserID == requester.ID {
+		return nil, fmt.Errorf("cannot request access to your own files")
+	}
+	if sharegrant.UnionPermissions(input.Permissions) == "" {
+		return nil, fmt.Errorf("permissions is required")
+	}
+	message, err := normalizeShareAccessRequestNote(input.Message)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	expiresAt, err := input.Expiry.ResolveWithin(now, maxShareLifetime(s.config))
+	if err != nil {
+		return nil, err
+	}
+
+	req := sharegrant.NewAccessRequest(requester.ID, resource, input.Permissions, expiresAt, message)
+	req.PublicShareID = publicShareID
+	req.CreatedAt = now
+	if err := s.repo.Create(ctx, req); err != nil {
+		return nil, err
+	}
+	req.RequesterUsername = requester.Username
+	s.notifications.NotifyShareAccessRequested(ctx, requester, req)
+	s.logger.Info("share access requested",
+		zap.String("request_id", req.ID),
+		zap.String("requester", requester.Username),
+		zap.String("owner_id", req.OwnerUserID),
+		zap.String("path", req.NormalizedPath),
+		zap.String("permissions", req.Permissions))
+	return req, nil
+}
+
+// ListOutgoing 返回我发起的申请，status 为空时不过滤
+func (s *ShareAccessRequestService) ListOutgoing(ctx context.Context, requester *user.User, status string) ([]*sharegrant.AccessRequest, error) {
+	return s.repo.List(ctx, repository.ShareAccessRequestFilter{RequesterUserID: requester.ID, Status: status})
+}
+
+// ListIncoming 返回他人对我的文件发起的申请，status 为空时不过滤
+func (s *ShareAccessRequestService) ListIncoming(ctx context.Context, owner *user.User, status string) ([]*sharegrant.AccessRequest, error) {
+	return s.repo.List(ctx, repository.ShareAccessRequestFilter{OwnerUserID: owner.ID, Status: status})
+}
+
+// History 返回申请及其审计记录，仅申请人与所有者可见
+func (s *ShareAccessRequestService) History(ctx context.Context, u *user.User, id string) (*sharegrant.AccessRequest, []sharegrant.AccessRequestEvent, error) {
+	req, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req.RequesterUserID != u.ID && req.OwnerUserID != u.ID {
+		return nil, nil, sharegrant.ErrAccessRequestNotFound
+	}
+	events, err := s.repo.ListEvents(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return req, events, nil
+}
+
+// Approve 所有者批准申请，按申请的权限与有效期创建或扩展申请人的个人授权
+func (s *ShareAccessRequestService) Approve(ctx context.Context, owner *user.User, id, note string) (*sharegrant.AccessRequest, error) {
+	return s.decide(ctx, owner, id, note, true)
+}
+
+// Deny 所有者拒绝申请
+func (s *ShareAccessRequestService) Deny(ctx context.Context, owner *user.User, id, note string) (*sharegrant.AccessRequest, error) {
+	return s.decide(ctx, owner, id, note, false)
+}
+
+func (s *ShareAccessRequestService) decide(ctx context.Context, owner *user.User, id, note string, approve bool) (*sharegrant.AccessRequest, error) {
+	note, err := normalizeShareAccessRequestNote(note)
+	if err != nil {
+		return nil, err
+	}
+	req, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if req.OwnerUserID != owner.ID || !req.IsPending() {
+		return nil, sharegrant.ErrAccessRequestNotFound
+	}
+	decision := repository.ShareAccessRequestDecision{
+		RequestID:     id,
+		DeciderUserID: owner.ID,
+		Note:          note,
+		DecidedAt:     s.now(),
+	}
+	if approve {
+		if _, err := s.repo.Approve(ctx, decision); err != nil {
+			return nil, err
+		}
+	} else if err := s.repo.Deny(ctx, decision); err != nil {
+		return nil, err
+	}
+	if req, err = s.repo.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	s.notifications.DismissShareAccessRequest(ctx, req)
+	s.notifications.NotifyShareAccessDecided(ctx, owner, req)
+	s.logger.Info("share access request decided",
+		zap.String("request_id", id),
+		zap.String("owner", owner.Username),
+		zap.String("status", req.Status),
+		zap.String("grant_id", req.GrantID))
+	return req, nil
+}
+
+// Cancel 申请人撤回待处理的申请
+func (s *ShareAccessRequestService) Cancel(ctx context.Context, requester *user.User, id string) error {
+	req, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if req.RequesterUserID != requester.ID {
+		return sharegrant.ErrAccessRequestNotFound
+	}
+	if err := s.repo.Cancel(ctx, id, requester.ID, s.now()); err != nil {
+		return err
+	}
+	s.notifications.DismissShareAccessRequest(ctx, req)
+	s.logger.Info("share access request canceled",
+		zap.String("request_id", id),
+		zap.String("requester", requester.Username))
+	return nil
+}
+
+func normalizeShareAccessRequestNote(raw string) (string, error) {
+	note := strings.TrimSpace(raw)
+	if utf8.RuneCountInString(note) > maxShareAccessRequestMessage {
+		return "", fmt.Errorf("message is too long, at most %d characters", maxShareAccessRequestMessage)
+	}
+	return note, nil
+}
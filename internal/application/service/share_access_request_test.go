@@ -0,0 +1,297 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/notification"
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/sharegrant"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+// memoryAccessRequestRepo keeps one personal grant per requester and path,
+// mirroring how the Postgres approval widens an existing personal grant.
+type memoryAccessRequestRepo struct {
+	requests map[string]*sharegrant.AccessRequest
+	events   map[string][]sharegrant.AccessRequestEvent
+	grants   map[string]sharegrant.Grant
+}
+
+func newMemoryAccessRequestRepo() *memoryAccessRequestRepo {
+	return &memoryAccessRequestRepo{
+		requests: make(map[string]*sharegrant.AccessRequest),
+		events:   make(map[string][]sharegrant.AccessRequestEvent),
+		grants:   make(map[string]sharegrant.Grant),
+	}
+}
+
+func (r *memoryAccessRequestRepo) Create(_ context.Context, req *sharegrant.AccessRequest) error {
+	for _, current := range r.requests {
+		if current.IsPending() && current.RequesterUserID == req.RequesterUserID && current.OwnerUserID == req.OwnerUserID &&
+			current.NormalizedPath == req.NormalizedPath && current.IsDir == req.IsDir {
+			return sharegrant.ErrAccessRequestPending
+		}
+	}
+	copied := *req
+	r.requests[req.ID] = &copied
+	r.record(req.ID, req.RequesterUserID, sharegrant.RequestActionRequested, req.Permissions, req.ExpiresAt, req.Message, req.CreatedAt)
+	return nil
+}
+
+func (r *memoryAccessRequestRepo) GetByID(_ context.Context, id string) (*sharegrant.AccessRequest, error) {
+	req, ok := r.requests[id]
+	if !ok {
+		return nil, sharegrant.ErrAccessRequestNotFound
+	}
+	copied := *req
+	return &copied, nil
+}
+
+func (r *memoryAccessRequestRepo) List(_ context.Context, filter repository.ShareAccessRequestFilter) ([]*sharegrant.AccessRequest, error) {
+	var result []*sharegrant.AccessRequest
+	for _, req := range r.requests {
+		if (filter.RequesterUserID != "" && req.RequesterUserID != filter.RequesterUserID) ||
+			(filter.OwnerUserID != "" && req.OwnerUserID != filter.OwnerUserID) ||
+			(filter.Status != "" && req.Status != filter.Status) {
+			continue
+		}
+		copied := *req
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].CreatedAt.After(result[j].CreatedAt) })
+	return result, nil
+}
+
+func (r *memoryAccessRequestRepo) ListEvents(_ context.Context, requestID string) ([]sharegrant.AccessRequestEvent, error) {
+	return append([]sharegrant.AccessRequestEvent(nil), r.events[requestID]...), nil
+}
+
+func (r *memoryAccessRequestRepo) Approve(_ context.Context, decision repository.ShareAccessRequestDecision) (string, error) {
+	req, ok := r.requests[decision.RequestID]
+	if !ok || !req.IsPending() {
+		return "", sharegrant.ErrAccessRequestNotFound
+	}
+	key := req.RequesterUserID + ":" + req.NormalizedPath
+	grant, exists := r.grants[key]
+	if !exists {
+		grant = sharegrant.Grant{ID: "grant-" + req.ID, Status: sharegrant.StatusActive}
+	}
+	grant.Permissions = sharegrant.UnionPermissions(grant.Permissions, req.Permissions)
+	grant.ExpiresAt = req.ExpiresAt
+	r.grants[key] = grant
+
+	req.Status = sharegrant.RequestStatusApproved
+	req.DeciderUserID = decision.DeciderUserID
+	req.DecisionNote = decision.Note
+	req.DecidedAt = &decision.DecidedAt
+	req.GrantID = grant.ID
+	r.record(req.ID, decision.DeciderUserID, sharegrant.RequestActionApproved, grant.Permissions, grant.ExpiresAt, decision.Note, decision.DecidedAt)
+	return grant.ID, nil
+}
+
+func (r *memoryAccessRequestRepo) Deny(_ context.Context, decision repository.ShareAccessRequestDecision) error {
+	return r.finish(decision.RequestID, decision.DeciderUserID, sharegrant.RequestStatusDenied, sharegrant.RequestActionDenied, decision.Note, decision.DecidedAt)
+}
+
+func (r *memoryAccessRequestRepo) Cancel(_ context.Context, id, actorUserID string, canceledAt time.Time) error {
+	return r.finish(id, actorUserID, sharegrant.RequestStatusCanceled, sharegrant.RequestActionCanceled, "", canceledAt)
+}
+
+func (r *memoryAccessRequestRepo) finish(id, actorUserID, status, action, note string, at time.Time) error {
+	req, ok := r.requests[id]
+	if !ok || !req.IsPending() {
+		return sharegrant.ErrAccessRequestNotFound
+	}
+	req.Status = status
+	req.DeciderUserID = actorUserID
+	req.DecisionNote = note
+	req.DecidedAt = &at
+	r.record(id, actorUserID, action, "", nil, note, at)
+	return nil
+}
+
+func (r *memoryAccessRequestRepo) record(requestID, actorUserID, action, permissions string, expiresAt *time.Time, note string, at time.Time) {
+	r.events[requestID] = append(r.events[requestID], sharegrant.AccessRequestEvent{
+		ID:          int64(len(r.events[requestID]) + 1),
+		RequestID:   requestID,
+		ActorUserID: actorUserID,
+		Action:      action,
+		Permissions: permissions,
+		ExpiresAt:   expiresAt,
+		Note:        note,
+		CreatedAt:   at,
+	})
+}
+
+func TestShareAccessRequestApproveWidensGrantAndRecordsHistory(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 10, 1, 9, 0, 0, 0, time.UTC)
+	owner := newShareTestUser(t, "owner", "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	member := newShareTestUser(t, "member", "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	outsider := newShareTestUser(t, "outsider", "0xcccccccccccccccccccccccccccccccccccccccc")
+	userRepo := newTestUserRepo()
+	mustSaveUser(t, userRepo, owner)
+	mustSaveUser(t, userRepo, member)
+	mustSaveUser(t, userRepo, outsider)
+
+	repo := newMemoryAccessRequestRepo()
+	repo.grants[member.ID+":/reports"] = sharegrant.Grant{ID: "grant-existing", Permissions: "R", Status: sharegrant.StatusActive}
+	grants := fakeSharedResourceGrantRepository{
+		resource: &sharegrant.Resource{ID: "resource-1", OwnerUserID: owner.ID, NormalizedPath: "/reports", IsDir: true},
+		grants:   []sharegrant.Grant{{ID: "grant-existing", Permissions: "R", Status: sharegrant.StatusActive}},
+	}
+	notifyRepo := newFakeNotificationRepository()
+	notifications := NewNotificationService(notifyRepo, userRepo, zap.NewNop())
+	svc := NewShareAccessRequestService(repo, grants, newMemoryPublicShareRepo(), &config.Config{}, zap.NewNop())
+	svc.SetNotificationService(notifications)
+	svc.now = func() time.Time { return now }
+
+	input := ShareAccessRequestInput{Permissions: "CU", Expiry: ShareExpiryInput{ExpiresValue: 7, ExpiresUnit: "day"}, Message: "need to upload the Q3 files"}
+	req, err := svc.RequestForResource(ctx, member, "resource-1", input)
+	if err != nil {
+		t.Fatalf("RequestForResource: %v", err)
+	}
+	if req.OwnerUserID != owner.ID || req.ResourceID != "resource-1" || req.Permissions != "CU" || req.ExpiresAt == nil || !req.ExpiresAt.Equal(now.AddDate(0, 0, 7)) {
+		t.Fatalf("unexpected request: %#v", req)
+	}
+	if _, err := svc.RequestForResource(ctx, member, "resource-1", input); !errors.Is(err, sharegrant.ErrAccessRequestPending) {
+		t.Fatalf("duplicate pending request should be refused, got %v", err)
+	}
+	if _, err := svc.RequestForResource(ctx, owner, "resource-1", input); err == nil {
+		t.Fatal("owner must not request access to own resource")
+	}
+
+	ownerInbox, _ := notifications.ListForUser(ctx, owner, 10)
+	if len(ownerInbox) != 1 || ownerInbox[0].ActionURL != "#share-access-request:"+req.ID || !strings.Contains(ownerInbox[0].Content, "member") {
+		t.Fatalf("owner should be asked to decide: %#v", ownerInbox)
+	}
+
+	if _, err := svc.Approve(ctx, outsider, req.ID, ""); !errors.Is(err, sharegrant.ErrAccessRequestNotFound) {
+		t.Fatalf("only the owner can approve, got %v", err)
+	}
+	incoming, err := svc.ListIncoming(ctx, owner, sharegrant.RequestStatusPending)
+	if err != nil || len(incoming) != 1 || incoming[0].ID != req.ID {
+		t.Fatalf("unexpected incoming requests: %#v, %v", incoming, err)
+	}
+
+	approved, err := svc.Approve(ctx, owner, req.ID, "ok for this week")
+	if err != nil {
+		t.Fatalf("Approve: %v", err)
+	}
+	if approved.Status != sharegrant.RequestStatusApproved || approved.GrantID != "grant-existing" {
+		t.Fatalf("approval should widen the existing personal grant: %#v", approved)
+	}
+	if grant := repo.grants[member.ID+":/reports"]; grant.Permissions != "CRU" || grant.ExpiresAt == nil {
+		t.Fatalf("unexpected grant after approval: %#v", grant)
+	}
+	if _, err := svc.Deny(ctx, owner, req.ID, ""); !errors.Is(err, sharegrant.ErrAccessRequestNotFound) {
+		t.Fatalf("decided requests cannot be decided again, got %v", err)
+	}
+
+	ownerInbox, _ = notifications.ListForUser(ctx, owner, 10)
+	if len(ownerInbox) != 0 {
+		t.Fatalf("owner request notification should be dismissed after the decision: %#v", ownerInbox)
+	}
+	memberInbox, _ := notifications.ListForUser(ctx, member, 10)
+	if len(memberInbox) != 1 || memberInbox[0].Type != notification.TypeShare || memberInbox[0].ActionURL != "#shared-with-me" {
+		t.Fatalf("requester should be told about the approval: %#v", memberInbox)
+	}
+
+	for _, viewer := range []*user.User{owner, member} {
+		_, events, err := svc.History(ctx, viewer, req.ID)
+		if err != nil {
+			t.Fatalf("History(%s): %v", viewer.Username, err)
+		}
+		actions := make([]string, 0, len(events))
+		for _, event := range events {
+			actions = append(actions, event.Action+"="+event.Permissions)
+		}
+		if got := strings.Join(actions, ","); got != "requested=CU,approved=CRU" {
+			t.Fatalf("unexpected history for %s: %s", viewer.Username, got)
+		}
+	}
+	if _, _, err := svc.History(ctx, outsider, req.ID); !errors.Is(err, sharegrant.ErrAccessRequestNotFound) {
+		t.Fatalf("history must be hidden from other users, got %v", err)
+	}
+}
+
+func TestShareAccessRequestFromPublicLinkDenyAndCancel(t *testing.T) {
+	ctx := context.Background()
+	owner := newShareTestUser(t, "owner", "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	visitor := newShareTestUser(t, "visitor", "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	userRepo := newTestUserRepo()
+	mustSaveUser(t, userRepo, owner)
+	mustSaveUser(t, userRepo, visitor)
+
+	shares := newMemoryPublicShareRepo()
+	link := share.NewShareItem(owner.ID, owner.Username, "/dav/photos/trip.jpg", "trip.jpg", share.ModeDownload, nil)
+	if err := shares.Create(ctx, link); err != nil {
+		t.Fatalf("create link: %v", err)
+	}
+	expiredAt := time.Now().Add(-time.Hour)
+	expired := share.NewShareItem(owner.ID, owner.Username, "/photos/old.jpg", "old.jpg", share.ModeDownload, &expiredAt)
+	if err := shares.Create(ctx, expired); err != nil {
+		t.Fatalf("create expired link: %v", err)
+	}
+
+	repo := newMemoryAccessRequestRepo()
+	cfg := &config.Config{WebDAV: config.WebDAVConfig{Prefix: "/dav"}}
+	notifyRepo := newFakeNotificationRepository()
+	notifications := NewNotificationService(notifyRepo, userRepo, zap.NewNop())
+	svc := NewShareAccessRequestService(repo, fakeSharedResourceGrantRepository{}, shares, cfg, zap.NewNop())
+	svc.SetNotificationService(notifications)
+
+	if _, err := svc.RequestForPublicShare(ctx, visitor, expired.Token, ShareAccessRequestInput{Permissions: "R"}); !errors.Is(err, share.ErrShareExpired) {
+		t.Fatalf("expired links cannot be used to request access, got %v", err)
+	}
+	if _, err := svc.RequestForResource(ctx, visitor, "resource-unknown", ShareAccessRequestInput{Permissions: "R"}); err == nil {
+		t.Fatal("resources that were never shared with the requester must be refused")
+	}
+
+	req, err := svc.RequestForPublicShare(ctx, visitor, link.Token, ShareAccessRequestInput{Permissions: "RU"})
+	if err != nil {
+		t.Fatalf("RequestForPublicShare: %v", err)
+	}
+	if req.PublicShareID != link.ID || req.NormalizedPath != "/photos/trip.jpg" || req.ResourceID != "" || req.ExpiresAt != nil {
+		t.Fatalf("unexpected public link request: %#v", req)
+	}
+	denied, err := svc.Deny(ctx, owner, req.ID, "not this one")
+	if err != nil || denied.Status != sharegrant.RequestStatusDenied || denied.DecisionNote != "not this one" {
+		t.Fatalf("Deny = %#v, %v", denied, err)
+	}
+	if len(repo.grants) != 0 {
+		t.Fatalf("denied requests must not grant anything: %#v", repo.grants)
+	}
+	visitorInbox, _ := notifications.ListForUser(ctx, visitor, 10)
+	if len(visitorInbox) != 1 || !strings.Contains(visitorInbox[0].Content, "not this one") {
+		t.Fatalf("requester should see the denial note: %#v", visitorInbox)
+	}
+
+	again, err := svc.RequestForPublicShare(ctx, visitor, link.Token, ShareAccessRequestInput{Permissions: "R"})
+	if err != nil {
+		t.Fatalf("a new request is allowed after a denial: %v", err)
+	}
+	if err := svc.Cancel(ctx, owner, again.ID); !errors.Is(err, sharegrant.ErrAccessRequestNotFound) {
+		t.Fatalf("only the requester can cancel, got %v", err)
+	}
+	if err := svc.Cancel(ctx, visitor, again.ID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	outgoing, err := svc.ListOutgoing(ctx, visitor, "")
+	if err != nil || len(outgoing) != 2 {
+		t.Fatalf("unexpected outgoing requests: %#v, %v", outgoing, err)
+	}
+	statuses := []string{outgoing[0].Status, outgoing[1].Status}
+	sort.Strings(statuses)
+	if got := strings.Join(statuses, ","); got != "canceled,denied" {
+		t.Fatalf("unexpected request states: %s", got)
+	}
+}
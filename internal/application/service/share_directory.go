@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+)
+
+// ShareEntry is one entry of a public directory share listing. Path is
+// relative to the share root; directories end with "/".
+type ShareEntry struct {
+	Name       string
+	Path       string
+	IsDir      bool
+	Size       int64
+	ModifiedAt time.Time
+}
+
+// ResolveEntry 解析分享内的路径：relPath 相对分享根目录，为空表示分享本身；
+// 文件分享只接受空路径或文件名。路径不能离开分享根目录，系统目录、
+// 隐藏的内部文件与符号链接按不存在处理；上传模式分享返回 share.ErrShareUploadOnly
+func (s *ShareService) ResolveEntry(ctx context.Context, token, relPath string) (*share.ShareItem, string, os.FileInfo, error) {
+	item, rootFull, err := s.ResolvePath(ctx, token)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if item.IsUploadMode() {
+		return nil, "", nil, share.ErrShareUploadOnly
+	}
+	rootInfo, err := s.storage.Stat(rootFull)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	rel, err := cleanRelativePath(NamePolicy(s.config).Normalize(relPath))
+	if err != nil {
+		return nil, "", nil, share.ErrInvalidShare
+	}
+	if !rootInfo.IsDir() {
+		if rel != "" && rel != rootInfo.Name() {
+			return nil, "", nil, share.ErrShareNotFound
+		}
+		return item, rootFull, rootInfo, nil
+	}
+	if rel == "" {
+		return item, rootFull, rootInfo, nil
+	}
+	for _, segment := range strings.Split(rel, "/") {
+		if isSkippedArchiveName(segment) {
+			return nil, "", nil, share.ErrShareNotFound
+		}
+	}
+	fullPath := NamePolicy(s.config).WithFS(s.storage).Resolve(rootFull, filepath.Join(rootFull, filepath.FromSlash(rel)))
+	if !isPathWithin(rootFull, fullPath) {
+		return nil, "", nil, share.ErrInvalidShare
+	}
+	info, err := s.lstatWithoutSymlinks(rootFull, fullPath)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return nil, "", nil, share.ErrShareNotFound
+	}
+	return item, fullPath, info, nil
+}
+
+// lstatWithoutSymlinks stats fullPath below root one segment at a time and
+// refuses a symlink at any of them, so a linked intermediate directory cannot
+// lead outside the share.
+func (s *ShareService) lstatWithoutSymlinks(root, fullPath string) (os.FileInfo, error) {
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil {
+		return nil, share.ErrInvalidShare
+	}
+	current := root
+	var info os.FileInfo
+	for _, segment := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, segment)
+		if info, err = s.storage.Lstat(current); err != nil {
+			return nil, err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil, share.ErrShareNotFound
+		}
+	}
+	return info, nil
+}
+
+// ListEntries 列出目录分享内 relPath 目录的直接子项
+func (s *ShareService) ListEntries(ctx context.Context, token, relPath string) (*share.ShareItem, []ShareEntry, error) {
+	item, fullPath, info, err := s.ResolveEntry(ctx, token, relPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil, share.ErrInvalidShare
+	}
+	dirEntries, err := s.storage.ReadDir(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	prefix, _ := cleanRelativePath(NamePolicy(s.config).Normalize(relPath))
+	entries := make([]ShareEntry, 0, len(dirEntries))
+	for _, entry := range dirEntries {
+		if isSkippedArchiveName(entry.Name()) {
+			continue
+		}
+		entryInfo, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if entryInfo.Mode()&os.ModeSymlink != 0 || (!entryInfo.IsDir() && !entryInfo.Mode().IsRegular()) {
+			continue
+		}
+		entryPath := path.Join("/", prefix, entryInfo.Name())
+		size := entryInfo.Size()
+		if entryInfo.IsDir() {
+			entryPath += "/"
+			size = 0
+		}
+		entries = append(entries, ShareEntry{
+			Name:       entryInfo.Name(),
+			Path:       entryPath,
+			IsDir:      entryInfo.IsDir(),
+			Size:       size,
+			ModifiedAt: entryInfo.ModTime(),
+		})
+	}
+	return item, entries, nil
+}
+
+// Open 打开 ResolveEntry 返回的文件
+func (s *ShareService) Open(fullPath string) (storage.File, error) {
+	return s.storage.Open(fullPath)
+}
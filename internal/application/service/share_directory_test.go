@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func TestShareServiceDirectoryShareListsAndConfinesPaths(t *testing.T) {
+	root := t.TempDir()
+	userDir := filepath.Join(root, "alice")
+	writeRecoverTestFile(t, filepath.Join(userDir, "deliverables", "report.pdf"), "report")
+	writeRecoverTestFile(t, filepath.Join(userDir, "deliverables", "images", "a.png"), "png")
+	writeRecoverTestFile(t, filepath.Join(userDir, "deliverables", ".DS_Store"), "junk")
+	writeRecoverTestFile(t, filepath.Join(userDir, "secret.txt"), "secret")
+	if err := os.Symlink(filepath.Join(userDir, "secret.txt"), filepath.Join(userDir, "deliverables", "link.txt")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = root
+	users := newTestUserRepo()
+	owner := &user.User{ID: "u1", Username: "alice", Directory: "alice"}
+	_ = users.Save(context.Background(), owner)
+	repo := newMemoryPublicShareRepo()
+	svc := NewShareService(repo, users, cfg, zap.NewNop())
+	ctx := context.Background()
+
+	item, err := svc.Create(ctx, owner, "/deliverables", ShareCreateInput{})
+	if err != nil {
+		t.Fatalf("create directory share: %v", err)
+	}
+	if !item.IsDir || item.Name != "deliverables" {
+		t.Fatalf("unexpected share: %+v", item)
+	}
+
+	_, entries, err := svc.ListEntries(ctx, item.Token, "")
+	if err != nil {
+		t.Fatalf("list root: %v", err)
+	}
+	got := map[string]bool{}
+	for _, entry := range entries {
+		got[entry.Path] = entry.IsDir
+	}
+	if len(got) != 2 || !got["/images/"] || got["/report.pdf"] {
+		t.Fatalf("unexpected root entries: %+v", entries)
+	}
+
+	_, entries, err = svc.ListEntries(ctx, item.Token, "images")
+	if err != nil || len(entries) != 1 || entries[0].Path != "/images/a.png" {
+		t.Fatalf("unexpected nested entries: %+v, %v", entries, err)
+	}
+
+	_, fullPath, info, err := svc.ResolveEntry(ctx, item.Token, "/images/a.png")
+	if err != nil || info.IsDir() || fullPath != filepath.Join(userDir, "deliverables", "images", "a.png") {
+		t.Fatalf("resolve nested file: %q %v", fullPath, err)
+	}
+
+	for _, rel := range []string{"../secret.txt", "images/../../secret.txt", "link.txt", ".DS_Store", "missing.txt"} {
+		if _, _, _, err := svc.ResolveEntry(ctx, item.Token, rel); err == nil {
+			t.Fatalf("expected %q to be rejected", rel)
+		}
+	}
+	if _, _, err := svc.ListEntries(ctx, item.Token, "report.pdf"); !errors.Is(err, share.ErrInvalidShare) {
+		t.Fatalf("listing a file should fail, got %v", err)
+	}
+	if _, _, _, err := svc.Resolve(ctx, item.Token); !errors.Is(err, share.ErrInvalidShare) {
+		t.Fatalf("single-file resolve of a directory share should fail, got %v", err)
+	}
+
+	fileShare, err := svc.Create(ctx, owner, "/deliverables/report.pdf", ShareCreateInput{})
+	if err != nil {
+		t.Fatalf("create file share: %v", err)
+	}
+	if fileShare.IsDir {
+		t.Fatal("file share must not be a directory")
+	}
+	if _, _, _, err := svc.ResolveEntry(ctx, fileShare.Token, "report.pdf"); err != nil {
+		t.Fatalf("file share resolves its own name: %v", err)
+	}
+	if _, _, _, err := svc.ResolveEntry(ctx, fileShare.Token, "other.pdf"); err == nil {
+		t.Fatal("file share must not resolve other names")
+	}
+}
+
+func TestShareServiceDirectoryShareRejectsSymlinkedIntermediateDirectory(t *testing.T) {
+	root := t.TempDir()
+	userDir := filepath.Join(root, "alice")
+	writeRecoverTestFile(t, filepath.Join(userDir, "deliverables", "report.pdf"), "report")
+	writeRecoverTestFile(t, filepath.Join(userDir, "private", "secret.txt"), "secret")
+	if err := os.Symlink(filepath.Join(userDir, "private"), filepath.Join(userDir, "deliverables", "out")); err != nil {
+		t.Fatalf("symlink: %v", err)
+	}
+
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = root
+	users := newTestUserRepo()
+	owner := &user.User{ID: "u1", Username: "alice", Directory: "alice"}
+	_ = users.Save(context.Background(), owner)
+	svc := NewShareService(newMemoryPublicShareRepo(), users, cfg, zap.NewNop())
+	ctx := context.Background()
+
+	item, err := svc.Create(ctx, owner, "/deliverables", ShareCreateInput{})
+	if err != nil {
+		t.Fatalf("create directory share: %v", err)
+	}
+	if _, fullPath, _, err := svc.ResolveEntry(ctx, item.Token, "out/secret.txt"); err == nil {
+		t.Fatalf("file behind a symlinked directory resolved to %q", fullPath)
+	}
+	if _, entries, err := svc.ListEntries(ctx, item.Token, "out"); err == nil {
+		t.Fatalf("symlinked directory listed: %+v", entries)
+	}
+	if _, _, _, err := svc.ResolveEntry(ctx, item.Token, "report.pdf"); err != nil {
+		t.Fatalf("regular file should still resolve: %v", err)
+	}
+}
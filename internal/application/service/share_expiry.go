@@ -1,11 +1,22 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/shareuser"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
 )
 
+// ErrShareLifetimeExceeded 分享有效期超过管理员配置的 share.max_lifetime
+var ErrShareLifetimeExceeded = errors.New("share expiry exceeds the maximum share lifetime")
+
 type ShareExpiryInput struct {
 	ExpiresIn    int64
 	ExpiresValue int64
@@ -46,3 +57,131 @@ func (i ShareExpiryInput) Resolve(now time.Time) (*time.Time, error) {
 
 	return nil, nil
 }
+
+// ResolveWithin resolves the expiry of a new share under the max lifetime
+// policy: without an explicit expiry the share expires after maxLifetime, and
+// a longer expiry is rejected. maxLifetime <= 0 disables the policy.
+func (i ShareExpiryInput) ResolveWithin(now time.Time, maxLifetime time.Duration) (*time.Time, error) {
+	expiresAt, err := i.Resolve(now)
+	if err != nil || maxLifetime <= 0 {
+		return expiresAt, err
+	}
+	limit := now.Add(maxLifetime)
+	if expiresAt == nil {
+		return &limit, nil
+	}
+	if expiresAt.After(limit) {
+		return nil, fmt.Errorf("%w (%s)", ErrShareLifetimeExceeded, maxLifetime)
+	}
+	return expiresAt, nil
+}
+
+// ExtendFrom computes the expiry after a one-click extension. The requested
+// duration (or defaultExtension when none is given) is added to the current
+// expiry, or to now when the share already expired. The result is clamped to
+// now+maxLifetime; an extension that cannot move the expiry forward fails.
+func (i ShareExpiryInput) ExtendFrom(current *time.Time, now time.Time, defaultExtension, maxLifetime time.Duration) (*time.Time, error) {
+	if current == nil {
+		return nil, fmt.Errorf("share does not expire")
+	}
+	base := *current
+	if base.Before(now) {
+		base = now
+	}
+	extended, err := i.Resolve(base)
+	if err != nil {
+		return nil, err
+	}
+	if extended == nil {
+		if defaultExtension <= 0 {
+			return nil, fmt.Errorf("expiresValue or expiresIn is required")
+		}
+		next := base.Add(defaultExtension)
+		extended = &next
+	}
+	if maxLifetime > 0 {
+		if limit := now.Add(maxLifetime); extended.After(limit) {
+			extended = &limit
+		}
+	}
+	if !extended.After(base) {
+		return nil, fmt.Errorf("%w (%s)", ErrShareLifetimeExceeded, maxLifetime)
+	}
+	return extended, nil
+}
+
+// Extend 创建者一键续期公开分享链接；未指定时长时按 share.extend_by 延长，
+// 续期后到期提醒按新的有效期重新发送
+func (s *ShareService) Extend(ctx context.Context, u *user.User, token string, input ShareExpiryInput) (*share.ShareItem, error) {
+	item, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if item.CreatorUserID != u.ID {
+		return nil, fmt.Errorf("permission denied: not your share")
+	}
+	normalized, err := s.normalizeItemPath(item.Path)
+	if err != nil {
+		return nil, err
+	}
+	item.Path = normalized
+	if item.SourceShareID == "" && item.SourceResourceID == "" {
+		if err := enforceAppScope(ctx, s.config, normalized, "update"); err != nil {
+			return nil, err
+		}
+	}
+	expiresAt, err := input.ExtendFrom(item.ExpiresAt, s.now(), shareExtendBy(s.config), maxShareLifetime(s.config))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.shareRepo.UpdateExpiry(ctx, token, expiresAt); err != nil {
+		return nil, err
+	}
+	item.ExpiresAt = expiresAt
+	s.logger.Info("share extended",
+		zap.String("username", u.Username),
+		zap.String("token", token),
+		zap.Time("expires_at", *expiresAt))
+	return item, nil
+}
+
+// Extend 所有者一键续期定向分享，同步修改对应的 V3 授权
+func (s *ShareUserService) Extend(ctx context.Context, owner *user.User, id string, input ShareExpiryInput) (*shareuser.ShareUserItem, error) {
+	item, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if item.OwnerUserID != owner.ID {
+		return nil, fmt.Errorf("permission denied: not your share")
+	}
+	if err := enforceAppScope(ctx, s.config, item.Path, "update"); err != nil {
+		return nil, err
+	}
+	expiresAt, err := input.ExtendFrom(item.ExpiresAt, time.Now(), shareExtendBy(s.config), maxShareLifetime(s.config))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateExpiry(ctx, id, expiresAt); err != nil {
+		return nil, err
+	}
+	item.ExpiresAt = expiresAt
+	s.logger.Info("share user extended",
+		zap.String("owner", owner.Username),
+		zap.String("share_id", id),
+		zap.Time("expires_at", *expiresAt))
+	return item, nil
+}
+
+func maxShareLifetime(cfg *config.Config) time.Duration {
+	if cfg == nil {
+		return 0
+	}
+	return cfg.Share.MaxLifetime
+}
+
+func shareExtendBy(cfg *config.Config) time.Duration {
+	if cfg == nil {
+		return 0
+	}
+	return cfg.Share.ExtendBy
+}
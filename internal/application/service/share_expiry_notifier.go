@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+// shareExpiredNoticeWindow bounds how far back the notifier looks for expired
+// shares, so shares that expired long before the notifier was enabled do not
+// produce a burst of stale notices.
+const shareExpiredNoticeWindow = 7 * 24 * time.Hour
+
+// ShareExpiryNotifier periodically reminds owners and recipients of public
+// links and directed shares that are about to expire, and tells them once a
+// share has expired.
+type ShareExpiryNotifier struct {
+	config          *config.Config
+	repo            repository.ShareExpiryRepository
+	notificationSvc *NotificationService
+	logger          *zap.Logger
+	interval        time.Duration
+	now             func() time.Time
+}
+
+// ShareExpiryReport summarizes a notifier pass.
+type ShareExpiryReport struct {
+	Reminded int `json:"reminded"`
+	Expired  int `json:"expired"`
+	Notified int `json:"notified"`
+	Failed   int `json:"failed"`
+}
+
+// NewShareExpiryNotifier creates a background share expiry worker.
+func NewShareExpiryNotifier(cfg *config.Config, repo repository.ShareExpiryRepository, logger *zap.Logger) *ShareExpiryNotifier {
+	if cfg == nil || repo == nil {
+		return nil
+	}
+	return &ShareExpiryNotifier{
+		config:   cfg,
+		repo:     repo,
+		logger:   logger,
+		interval: cfg.Share.ExpiryNotifyInterval,
+		now:      time.Now,
+	}
+}
+
+// SetNotificationService sets where reminders and expiry notices are sent.
+func (n *ShareExpiryNotifier) SetNotificationService(notificationSvc *NotificationService) {
+	if n == nil {
+		return
+	}
+	n.notificationSvc = notificationSvc
+}
+
+// Enabled reports whether the notifier should run on this node.
+func (n *ShareExpiryNotifier) Enabled() bool {
+	if n == nil || n.config == nil || n.notificationSvc == nil {
+		return false
+	}
+	if !n.config.Share.ExpiryNotifyEnabled || n.config.Share.ExpiryNotifyInterval <= 0 {
+		return false
+	}
+	return !strings.EqualFold(strings.TrimSpace(n.config.Node.Role), "standby")
+}
+
+// Run starts the periodic scan loop until ctx is canceled.
+func (n *ShareExpiryNotifier) Run(ctx context.Context) {
+	if !n.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	if n.logger != nil {
+		n.logger.Info("share expiry notifier started",
+			zap.Duration("interval", n.interval),
+			zap.Duration("warn_before", n.config.Share.WarnBefore))
+		defer n.logger.Info("share expiry notifier stopped")
+	}
+
+	n.runPass(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n.runPass(ctx)
+		}
+	}
+}
+
+func (n *ShareExpiryNotifier) runPass(ctx context.Context) {
+	report, err := n.ScanOnce(ctx)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) && n.logger != nil {
+			n.logger.Warn("share expiry pass failed", zap.Error(err))
+		}
+		return
+	}
+	if n.logger != nil && (report.Reminded > 0 || report.Expired > 0 || report.Failed > 0) {
+		n.logger.Info("share expiry pass finished",
+			zap.Int("reminded_count", report.Reminded),
+			zap.Int("expired_count", report.Expired),
+			zap.Int("notified_count", report.Notified),
+			zap.Int("failed_count", report.Failed))
+	}
+}
+
+// ScanOnce sends reminders for shares expiring within share.warn_before and
+// expiry notices for shares that expired since the previous passes.
+func (n *ShareExpiryNotifier) ScanOnce(ctx context.Context) (*ShareExpiryReport, error) {
+	report := &ShareExpiryReport{}
+	now := n.now()
+	if warnBefore := n.config.Share.WarnBefore; warnBefore > 0 {
+		if err := n.notifyStage(ctx, repository.ShareExpiryStageReminder, now, now.Add(warnBefore), now, report); err != nil {
+			return report, err
+		}
+	}
+	if err := n.notifyStage(ctx, repository.ShareExpiryStageExpired, now.Add(-shareExpiredNoticeWindow), now, now, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func (n *ShareExpiryNotifier) notifyStage(ctx context.Context, stage string, from, to, now time.Time, report *ShareExpiryReport) error {
+	items, err := n.repo.ListPending(ctx, stage, from, to)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if item == nil {
+			continue
+		}
+		if stage == repository.ShareExpiryStageReminder {
+			report.Reminded++
+		} else {
+			report.Expired++
+		}
+		if !n.notifyAll(ctx, stage, item, report) {
+			// Leave the share unmarked so the next pass retries it.
+			continue
+		}
+		if err := n.repo.MarkNotified(ctx, stage, item, now); err != nil {
+			report.Failed++
+			if n.logger != nil {
+				n.logger.Warn("failed to mark share expiry notified",
+					zap.String("kind", item.Kind),
+					zap.String("share_id", item.ID),
+					zap.Error(err))
+			}
+		}
+	}
+	return nil
+}
+
+func (n *ShareExpiryNotifier) notifyAll(ctx context.Context, stage string, item *repository.ExpiringShare, report *ShareExpiryReport) bool {
+	ok := true
+	userIDs := append([]string{item.OwnerUserID}, item.RecipientUserIDs...)
+	for _, userID := range userIDs {
+		var err error
+		if stage == repository.ShareExpiryStageReminder {
+			err = n.notificationSvc.NotifyShareExpiring(ctx, item, userID)
+		} else {
+			err = n.notificationSvc.NotifyShareExpired(ctx, item, userID)
+		}
+		if err != nil {
+			ok = false
+			report.Failed++
+			if n.logger != nil {
+				n.logger.Warn("failed to send share expiry notification",
+					zap.String("stage", stage),
+					zap.String("share_id", item.ID),
+					zap.String("user_id", userID),
+					zap.Error(err))
+			}
+			continue
+		}
+		report.Notified++
+	}
+	return ok
+}
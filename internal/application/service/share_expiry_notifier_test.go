@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/notification"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+type memoryShareExpiryRepo struct {
+	items    []*repository.ExpiringShare
+	notified map[string]bool
+}
+
+func (r *memoryShareExpiryRepo) ListPending(_ context.Context, stage string, from, to time.Time) ([]*repository.ExpiringShare, error) {
+	var result []*repository.ExpiringShare
+	for _, item := range r.items {
+		if r.notified[stage+":"+item.ID] {
+			continue
+		}
+		if item.ExpiresAt.After(from) && !item.ExpiresAt.After(to) {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (r *memoryShareExpiryRepo) MarkNotified(_ context.Context, stage string, item *repository.ExpiringShare, _ time.Time) error {
+	r.notified[stage+":"+item.ID] = true
+	return nil
+}
+
+func TestShareExpiryNotifierRemindsThenReportsExpiry(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 10, 0, 0, 0, time.UTC)
+	cfg := config.DefaultConfig()
+	cfg.Share.WarnBefore = 72 * time.Hour
+	repo := &memoryShareExpiryRepo{
+		notified: make(map[string]bool),
+		items: []*repository.ExpiringShare{
+			{
+				Kind:             repository.ShareExpiryKindDirected,
+				ID:               "share-1",
+				OwnerUserID:      "owner",
+				OwnerUsername:    "alice",
+				Name:             "report.pdf",
+				ExpiresAt:        now.Add(24 * time.Hour),
+				RecipientUserIDs: []string{"bob", "carol"},
+			},
+			{
+				Kind:        repository.ShareExpiryKindPublic,
+				ID:          "link-1",
+				OwnerUserID: "owner",
+				Name:        "photos",
+				ExpiresAt:   now.Add(10 * 24 * time.Hour),
+			},
+		},
+	}
+	notifications := newFakeNotificationRepository()
+	notifier := NewShareExpiryNotifier(cfg, repo, zap.NewNop())
+	notifier.SetNotificationService(NewNotificationService(notifications, newTestUserRepo(), zap.NewNop()))
+	notifier.now = func() time.Time { return now }
+
+	report, err := notifier.ScanOnce(context.Background())
+	if err != nil {
+		t.Fatalf("ScanOnce() error = %v", err)
+	}
+	if report.Reminded != 1 || report.Notified != 3 || report.Expired != 0 {
+		t.Fatalf("unexpected first pass report: %+v", report)
+	}
+	recipients := make(map[string]string)
+	for _, item := range notifications.items {
+		if item.Type != notification.TypeShareExpiry {
+			t.Fatalf("unexpected notification type %q", item.Type)
+		}
+		recipients[item.RecipientUserID] = item.ActionURL
+	}
+	if recipients["owner"] != "#shares" || recipients["bob"] != "#shared-with-me" || recipients["carol"] != "#shared-with-me" {
+		t.Fatalf("unexpected reminder recipients: %v", recipients)
+	}
+
+	// A second pass in the same window must not remind again.
+	if report, err = notifier.ScanOnce(context.Background()); err != nil || report.Reminded != 0 {
+		t.Fatalf("expected no repeated reminders, got %+v, %v", report, err)
+	}
+
+	now = now.Add(25 * time.Hour)
+	if report, err = notifier.ScanOnce(context.Background()); err != nil {
+		t.Fatalf("ScanOnce() error = %v", err)
+	}
+	if report.Expired != 1 || report.Notified != 3 {
+		t.Fatalf("unexpected expiry pass report: %+v", report)
+	}
+	expired := 0
+	for _, item := range notifications.items {
+		if item.Title == "分享已到期" {
+			expired++
+		}
+	}
+	if expired != 3 || len(notifications.items) != 6 {
+		t.Fatalf("expected expiry notices for owner and both recipients, got %d of %d", expired, len(notifications.items))
+	}
+}
+
+func TestShareExpiryNotifierDisabledOnStandby(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Node.Role = "standby"
+	notifier := NewShareExpiryNotifier(cfg, &memoryShareExpiryRepo{}, zap.NewNop())
+	notifier.SetNotificationService(NewNotificationService(newFakeNotificationRepository(), newTestUserRepo(), zap.NewNop()))
+	if notifier.Enabled() {
+		t.Fatal("share expiry notifier must not run on standby nodes")
+	}
+}
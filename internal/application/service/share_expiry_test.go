@@ -1,8 +1,12 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"testing"
 	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
 )
 
 func TestShareExpiryInputResolve(t *testing.T) {
@@ -94,3 +98,103 @@ func timesEqual(got, want *time.Time) bool {
 	}
 	return got.Equal(*want)
 }
+
+func TestShareExpiryInputResolveWithinMaxLifetime(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 10, 0, 0, 0, time.UTC)
+	maxLifetime := 30 * 24 * time.Hour
+
+	got, err := ShareExpiryInput{}.ResolveWithin(now, maxLifetime)
+	if err != nil || !timesEqual(got, ptrTime(now.Add(maxLifetime))) {
+		t.Fatalf("share without expiry should default to the max lifetime, got %v, %v", got, err)
+	}
+	got, err = ShareExpiryInput{ExpiresValue: 7, ExpiresUnit: "day"}.ResolveWithin(now, maxLifetime)
+	if err != nil || !timesEqual(got, ptrTime(now.AddDate(0, 0, 7))) {
+		t.Fatalf("shorter expiry should be kept, got %v, %v", got, err)
+	}
+	if _, err := (ShareExpiryInput{ExpiresValue: 2, ExpiresUnit: "month"}).ResolveWithin(now, maxLifetime); !errors.Is(err, ErrShareLifetimeExceeded) {
+		t.Fatalf("expected ErrShareLifetimeExceeded, got %v", err)
+	}
+	got, err = ShareExpiryInput{}.ResolveWithin(now, 0)
+	if err != nil || got != nil {
+		t.Fatalf("disabled policy should keep shares permanent, got %v, %v", got, err)
+	}
+}
+
+func TestShareExpiryInputExtendFrom(t *testing.T) {
+	now := time.Date(2026, time.March, 15, 10, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+
+	tests := []struct {
+		name        string
+		input       ShareExpiryInput
+		current     *time.Time
+		maxLifetime time.Duration
+		want        *time.Time
+		wantErr     bool
+	}{
+		{
+			name:    "default extension from current expiry",
+			current: ptrTime(now.Add(48 * time.Hour)),
+			want:    ptrTime(now.Add(48*time.Hour + week)),
+		},
+		{
+			name:    "expired share extends from now",
+			input:   ShareExpiryInput{ExpiresValue: 1, ExpiresUnit: "day"},
+			current: ptrTime(now.Add(-time.Hour)),
+			want:    ptrTime(now.AddDate(0, 0, 1)),
+		},
+		{
+			name:        "clamped to max lifetime",
+			current:     ptrTime(now.Add(24 * time.Hour)),
+			maxLifetime: 3 * 24 * time.Hour,
+			want:        ptrTime(now.Add(3 * 24 * time.Hour)),
+		},
+		{
+			name:        "already at max lifetime",
+			current:     ptrTime(now.Add(3 * 24 * time.Hour)),
+			maxLifetime: 3 * 24 * time.Hour,
+			wantErr:     true,
+		},
+		{
+			name:    "share without expiry",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.input.ExtendFrom(tt.current, now, week, tt.maxLifetime)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ExtendFrom() error = %v", err)
+			}
+			if !timesEqual(got, tt.want) {
+				t.Fatalf("ExtendFrom() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShareServiceExtendOnlyByCreator(t *testing.T) {
+	svc, repo, owner, item := newPasswordTestShareService(t)
+	now := time.Date(2026, time.March, 15, 10, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+	repo.items[item.Token].ExpiresAt = ptrTime(now.Add(time.Hour))
+
+	if _, err := svc.Extend(context.Background(), &user.User{ID: "u2", Username: "bob"}, item.Token, ShareExpiryInput{}); err == nil {
+		t.Fatal("expected other users to be rejected")
+	}
+	extended, err := svc.Extend(context.Background(), owner, item.Token, ShareExpiryInput{})
+	if err != nil {
+		t.Fatalf("Extend() error = %v", err)
+	}
+	want := ptrTime(now.Add(time.Hour + svc.config.Share.ExtendBy))
+	if !timesEqual(extended.ExpiresAt, want) || !timesEqual(repo.items[item.Token].ExpiresAt, want) {
+		t.Fatalf("expires_at = %v, want %v", extended.ExpiresAt, want)
+	}
+}
@@ -0,0 +1,249 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/crypto"
+	"go.uber.org/zap"
+)
+
+const (
+	// SharePasswordMinLength / SharePasswordMaxLength bound share access
+	// passwords; bcrypt ignores bytes beyond 72.
+	SharePasswordMinLength = 4
+	SharePasswordMaxLength = 72
+
+	// shareAccessTTL is how long an unlocked share stays accessible
+	// without re-entering the password.
+	shareAccessTTL = time.Hour
+	// sharePasswordMaxFailures wrong passwords per share and client within
+	// sharePasswordFailureWindow lock that client out for the rest of the
+	// window.
+	sharePasswordMaxFailures   = 5
+	sharePasswordFailureWindow = 15 * time.Minute
+	// Once a share collects sharePasswordTokenDelayAfter wrong passwords
+	// across all clients within the window, every further wrong answer is
+	// delayed by sharePasswordTokenDelayStep per failure beyond it, up to
+	// sharePasswordMaxTokenDelay. This only slows guessing from many
+	// addresses; it never locks out a client that knows the password.
+	sharePasswordTokenDelayAfter = 50
+	sharePasswordTokenDelayStep  = 100 * time.Millisecond
+	sharePasswordMaxTokenDelay   = 3 * time.Second
+	// sharePasswordSweepSize triggers pruning of expired failure entries.
+	sharePasswordSweepSize = 10000
+
+	shareAccessCookiePrefix = "warehouse_share_"
+)
+
+// sharePasswordGuard counts failed password attempts per share token and
+// client. Counters are kept in memory like login challenges, so a cluster
+// throttles per node.
+type sharePasswordGuard struct {
+	mu       sync.Mutex
+	failures map[string]*sharePasswordFailures
+}
+
+type sharePasswordFailures struct {
+	count int
+	start time.Time
+}
+
+func newSharePasswordGuard() *sharePasswordGuard {
+	return &sharePasswordGuard{failures: make(map[string]*sharePasswordFailures)}
+}
+
+// blocked reports how long key must still wait after limit failures, or 0.
+func (g *sharePasswordGuard) blocked(key string, limit int, now time.Time) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, ok := g.failures[key]
+	if !ok {
+		return 0
+	}
+	until := entry.start.Add(sharePasswordFailureWindow)
+	if !now.Before(until) {
+		delete(g.failures, key)
+		return 0
+	}
+	if entry.count < limit {
+		return 0
+	}
+	return until.Sub(now)
+}
+
+// fail records a failure for key and returns the failures within the
+// current window, including this one.
+func (g *sharePasswordGuard) fail(key string, now time.Time) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.failures) >= sharePasswordSweepSize {
+		for k, entry := range g.failures {
+			if !now.Before(entry.start.Add(sharePasswordFailureWindow)) {
+				delete(g.failures, k)
+			}
+		}
+	}
+	entry, ok := g.failures[key]
+	if !ok || !now.Before(entry.start.Add(sharePasswordFailureWindow)) {
+		entry = &sharePasswordFailures{start: now}
+		g.failures[key] = entry
+	}
+	entry.count++
+	return entry.count
+}
+
+// sharePasswordTokenDelay is the delay added to a wrong answer once the share
+// has seen failures wrong passwords across all clients.
+func sharePasswordTokenDelay(failures int) time.Duration {
+	if failures < sharePasswordTokenDelayAfter {
+		return 0
+	}
+	delay := time.Duration(failures-sharePasswordTokenDelayAfter+1) * sharePasswordTokenDelayStep
+	if delay > sharePasswordMaxTokenDelay {
+		return sharePasswordMaxTokenDelay
+	}
+	return delay
+}
+
+func (g *sharePasswordGuard) reset(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.failures, key)
+}
+
+// newShareAccessKey derives the cookie signing key from the JWT secret so
+// every node accepts cookies issued by the others. Without a secret the key
+// is random and cookies only work on this process.
+func newShareAccessKey(secret string) []byte {
+	if secret == "" {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("share access key: %v", err))
+		}
+		return key
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("warehouse share access"))
+	return mac.Sum(nil)
+}
+
+// ShareAccessCookieName returns the cookie that carries the access grant
+// of the share token.
+func ShareAccessCookieName(token string) string {
+	return shareAccessCookiePrefix + token
+}
+
+// hashSharePassword validates and hashes a new share password. An empty
+// password yields an empty hash, meaning no password.
+func (s *ShareService) hashSharePassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	if len(password) < SharePasswordMinLength || len(password) > SharePasswordMaxLength {
+		return "", fmt.Errorf("share password must be %d-%d bytes", SharePasswordMinLength, SharePasswordMaxLength)
+	}
+	return s.passwordHasher.Hash(password)
+}
+
+// SetPassword 设置、修改或移除（password 为空）分享的访问密码，链接不变；
+// 修改后之前签发的访问凭证随即失效
+func (s *ShareService) SetPassword(ctx context.Context, u *user.User, token, password string) (*share.ShareItem, error) {
+	item, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if item.CreatorUserID != u.ID {
+		return nil, fmt.Errorf("permission denied: not your share")
+	}
+	normalized, err := s.normalizeItemPath(item.Path)
+	if err != nil {
+		return nil, err
+	}
+	item.Path = normalized
+	if item.SourceShareID == "" && item.SourceResourceID == "" {
+		if err := enforceAppScope(ctx, s.config, normalized, "update"); err != nil {
+			return nil, err
+		}
+	}
+	hash, err := s.hashSharePassword(password)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.shareRepo.UpdatePassword(ctx, token, hash); err != nil {
+		return nil, err
+	}
+	item.PasswordHash = hash
+	s.logger.Info("share password updated",
+		zap.String("username", u.Username),
+		zap.String("token", token),
+		zap.Bool("enabled", hash != ""))
+	return item, nil
+}
+
+// Unlock 校验分享访问密码，成功后返回签名的访问凭证（Cookie 值）与过期时间。
+// clientKey 标识来源（通常为客户端 IP），同一分享与来源连续输错过多时返回
+// share.ErrShareAccessThrottled 与需等待的时长；分享整体输错过多时只延迟
+// 错误答复，不拒绝正确的密码
+func (s *ShareService) Unlock(item *share.ShareItem, password, clientKey string) (string, time.Time, time.Duration, error) {
+	if !item.HasPassword() {
+		return "", time.Time{}, 0, share.ErrInvalidShare
+	}
+	now := s.now()
+	key := item.Token + "|" + clientKey
+	if wait := s.passwordGuard.blocked(key, sharePasswordMaxFailures, now); wait > 0 {
+		return "", time.Time{}, wait, share.ErrShareAccessThrottled
+	}
+	if err := s.passwordHasher.Verify(item.PasswordHash, password); err != nil {
+		if !errors.Is(err, crypto.ErrPasswordMismatch) {
+			return "", time.Time{}, 0, err
+		}
+		s.passwordGuard.fail(key, now)
+		if delay := sharePasswordTokenDelay(s.passwordGuard.fail(item.Token, now)); delay > 0 {
+			s.sleep(delay)
+		}
+		return "", time.Time{}, 0, share.ErrSharePasswordMismatch
+	}
+	s.passwordGuard.reset(key)
+	expiresAt := now.Add(shareAccessTTL)
+	return s.signShareAccess(item, expiresAt), expiresAt, 0, nil
+}
+
+// CheckAccess 校验访问凭证；未设置密码的分享总是放行
+func (s *ShareService) CheckAccess(item *share.ShareItem, cookieValue string) error {
+	if !item.HasPassword() {
+		return nil
+	}
+	expPart, _, ok := strings.Cut(cookieValue, ".")
+	if !ok {
+		return share.ErrSharePasswordRequired
+	}
+	exp, err := strconv.ParseInt(expPart, 10, 64)
+	if err != nil || !s.now().Before(time.Unix(exp, 0)) {
+		return share.ErrSharePasswordRequired
+	}
+	if !hmac.Equal([]byte(cookieValue), []byte(s.signShareAccess(item, time.Unix(exp, 0)))) {
+		return share.ErrSharePasswordRequired
+	}
+	return nil
+}
+
+// signShareAccess binds the grant to the token, expiry and current password
+// hash, so changing or removing the password revokes issued cookies.
+func (s *ShareService) signShareAccess(item *share.ShareItem, expiresAt time.Time) string {
+	exp := strconv.FormatInt(expiresAt.Unix(), 10)
+	mac := hmac.New(sha256.New, s.accessKey)
+	mac.Write([]byte(item.Token + "\n" + exp + "\n" + item.PasswordHash))
+	return exp + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
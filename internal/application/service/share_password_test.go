@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+type memoryPublicShareRepo struct {
+	mu    sync.Mutex
+	items map[string]*share.ShareItem
+}
+
+func newMemoryPublicShareRepo() *memoryPublicShareRepo {
+	return &memoryPublicShareRepo{items: make(map[string]*share.ShareItem)}
+}
+
+func (r *memoryPublicShareRepo) Create(_ context.Context, item *share.ShareItem) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *item
+	r.items[item.Token] = &copied
+	return nil
+}
+
+func (r *memoryPublicShareRepo) GetByToken(_ context.Context, token string) (*share.ShareItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[token]
+	if !ok {
+		return nil, share.ErrShareNotFound
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (r *memoryPublicShareRepo) GetByUserID(_ context.Context, userID string) ([]*share.ShareItem, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var items []*share.ShareItem
+	for _, item := range r.items {
+		if item.CreatorUserID == userID {
+			copied := *item
+			items = append(items, &copied)
+		}
+	}
+	return items, nil
+}
+
+func (r *memoryPublicShareRepo) DeleteByToken(_ context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.items[token]; !ok {
+		return share.ErrShareNotFound
+	}
+	delete(r.items, token)
+	return nil
+}
+
+func (r *memoryPublicShareRepo) UpdatePassword(_ context.Context, token, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[token]
+	if !ok {
+		return share.ErrShareNotFound
+	}
+	item.PasswordHash = passwordHash
+	return nil
+}
+
+func (r *memoryPublicShareRepo) UpdateExpiry(_ context.Context, token string, expiresAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[token]
+	if !ok {
+		return share.ErrShareNotFound
+	}
+	item.ExpiresAt = expiresAt
+	return nil
+}
+
+func (r *memoryPublicShareRepo) IncrementView(_ context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[token]
+	if !ok {
+		return share.ErrShareNotFound
+	}
+	if item.MaxViews > 0 && item.ViewCount >= item.MaxViews {
+		return share.ErrShareExpired
+	}
+	item.ViewCount++
+	return nil
+}
+
+func (r *memoryPublicShareRepo) IncrementDownload(_ context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[token]
+	if !ok {
+		return share.ErrShareNotFound
+	}
+	if item.MaxDownloads > 0 && item.DownloadCount >= item.MaxDownloads {
+		return share.ErrShareExpired
+	}
+	item.DownloadCount++
+	return nil
+}
+
+func (r *memoryPublicShareRepo) ReserveUpload(_ context.Context, token string, size int64, limits share.UploadLimits) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	item, ok := r.items[token]
+	if !ok {
+		return share.ErrShareNotFound
+	}
+	if (limits.MaxTotalBytes > 0 && item.UploadedBytes+size > limits.MaxTotalBytes) ||
+		(limits.MaxFiles > 0 && item.UploadedFiles+1 > limits.MaxFiles) {
+		return share.ErrShareUploadLimit
+	}
+	item.UploadedBytes += size
+	item.UploadedFiles++
+	return nil
+}
+
+func (r *memoryPublicShareRepo) ReleaseUpload(_ context.Context, token string, size int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if item, ok := r.items[token]; ok {
+		item.UploadedBytes -= size
+		item.UploadedFiles--
+	}
+	return nil
+}
+
+var _ repository.ShareRepository = (*memoryPublicShareRepo)(nil)
+
+func newPasswordTestShareService(t *testing.T) (*ShareService, *memoryPublicShareRepo, *user.User, *share.ShareItem) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Web3.JWTSecret = "0123456789abcdef0123456789abcdef"
+	repo := newMemoryPublicShareRepo()
+	svc := NewShareService(repo, newTestUserRepo(), cfg, zap.NewNop())
+	owner := &user.User{ID: "u1", Username: "alice"}
+	item := share.NewShareItem(owner.ID, owner.Username, "/docs/a.txt", "a.txt", share.ModeDownload, nil)
+	if err := repo.Create(context.Background(), item); err != nil {
+		t.Fatalf("create share: %v", err)
+	}
+	return svc, repo, owner, item
+}
+
+func TestShareServicePasswordUnlockAndCheckAccess(t *testing.T) {
+	svc, repo, owner, item := newPasswordTestShareService(t)
+	ctx := context.Background()
+
+	if err := svc.CheckAccess(item, ""); err != nil {
+		t.Fatalf("share without password should be open: %v", err)
+	}
+	if _, err := svc.SetPassword(ctx, owner, item.Token, "abc"); err == nil {
+		t.Fatal("expected short password to be rejected")
+	}
+	if _, err := svc.SetPassword(ctx, &user.User{ID: "u2", Username: "bob"}, item.Token, "secret-1"); err == nil {
+		t.Fatal("expected other users to be rejected")
+	}
+	updated, err := svc.SetPassword(ctx, owner, item.Token, "secret-1")
+	if err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	if !updated.HasPassword() || updated.Token != item.Token {
+		t.Fatalf("unexpected share after set password: %+v", updated)
+	}
+	stored, _ := repo.GetByToken(ctx, item.Token)
+
+	if err := svc.CheckAccess(stored, ""); !errors.Is(err, share.ErrSharePasswordRequired) {
+		t.Fatalf("expected password required, got %v", err)
+	}
+	if _, _, _, err := svc.Unlock(stored, "wrong", "10.0.0.1"); !errors.Is(err, share.ErrSharePasswordMismatch) {
+		t.Fatalf("expected mismatch, got %v", err)
+	}
+	cookie, expiresAt, _, err := svc.Unlock(stored, "secret-1", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("unlock: %v", err)
+	}
+	if !expiresAt.After(time.Now()) {
+		t.Fatalf("unexpected expiry %v", expiresAt)
+	}
+	if err := svc.CheckAccess(stored, cookie); err != nil {
+		t.Fatalf("cookie should grant access: %v", err)
+	}
+	if err := svc.CheckAccess(stored, cookie+"x"); err == nil {
+		t.Fatal("tampered cookie should be rejected")
+	}
+	other := *stored
+	other.Token = "other-token"
+	if err := svc.CheckAccess(&other, cookie); err == nil {
+		t.Fatal("cookie must not unlock another share")
+	}
+
+	svc.now = func() time.Time { return expiresAt.Add(time.Second) }
+	if err := svc.CheckAccess(stored, cookie); err == nil {
+		t.Fatal("expired cookie should be rejected")
+	}
+	svc.now = time.Now
+
+	// Changing the password revokes cookies issued for the old one.
+	if _, err := svc.SetPassword(ctx, owner, item.Token, "secret-2"); err != nil {
+		t.Fatalf("change password: %v", err)
+	}
+	stored, _ = repo.GetByToken(ctx, item.Token)
+	if err := svc.CheckAccess(stored, cookie); err == nil {
+		t.Fatal("cookie for the old password should be rejected")
+	}
+
+	if _, err := svc.SetPassword(ctx, owner, item.Token, ""); err != nil {
+		t.Fatalf("remove password: %v", err)
+	}
+	stored, _ = repo.GetByToken(ctx, item.Token)
+	if stored.HasPassword() || svc.CheckAccess(stored, "") != nil {
+		t.Fatal("removing the password should reopen the share")
+	}
+}
+
+func TestShareServicePasswordThrottlesPerTokenAndClient(t *testing.T) {
+	svc, repo, owner, item := newPasswordTestShareService(t)
+	ctx := context.Background()
+	if _, err := svc.SetPassword(ctx, owner, item.Token, "secret-1"); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	stored, _ := repo.GetByToken(ctx, item.Token)
+
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+	for i := 0; i < sharePasswordMaxFailures; i++ {
+		if _, _, _, err := svc.Unlock(stored, "wrong", "10.0.0.1"); !errors.Is(err, share.ErrSharePasswordMismatch) {
+			t.Fatalf("attempt %d: expected mismatch, got %v", i+1, err)
+		}
+	}
+	_, _, retryAfter, err := svc.Unlock(stored, "secret-1", "10.0.0.1")
+	if !errors.Is(err, share.ErrShareAccessThrottled) {
+		t.Fatalf("expected throttled, got %v", err)
+	}
+	if retryAfter <= 0 || retryAfter > sharePasswordFailureWindow {
+		t.Fatalf("unexpected retry after %v", retryAfter)
+	}
+
+	// Other clients are not affected.
+	if _, _, _, err := svc.Unlock(stored, "secret-1", "10.0.0.2"); err != nil {
+		t.Fatalf("other client should unlock: %v", err)
+	}
+
+	now = now.Add(sharePasswordFailureWindow)
+	if _, _, _, err := svc.Unlock(stored, "secret-1", "10.0.0.1"); err != nil {
+		t.Fatalf("client should unlock after the window: %v", err)
+	}
+}
+
+func TestShareServicePasswordDelaysFailuresPerTokenWithoutLockout(t *testing.T) {
+	svc, repo, owner, item := newPasswordTestShareService(t)
+	ctx := context.Background()
+	if _, err := svc.SetPassword(ctx, owner, item.Token, "secret-1"); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	stored, _ := repo.GetByToken(ctx, item.Token)
+
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+	var delays []time.Duration
+	svc.sleep = func(d time.Duration) { delays = append(delays, d) }
+	// Every guess comes from a new address, so the per-client limit never trips.
+	attempts := sharePasswordTokenDelayAfter + 2
+	for i := 0; i < attempts; i++ {
+		client := fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+		if _, _, _, err := svc.Unlock(stored, "wrong", client); !errors.Is(err, share.ErrSharePasswordMismatch) {
+			t.Fatalf("attempt %d: expected mismatch, got %v", i+1, err)
+		}
+	}
+	want := []time.Duration{sharePasswordTokenDelayStep, 2 * sharePasswordTokenDelayStep, 3 * sharePasswordTokenDelayStep}
+	if fmt.Sprint(delays) != fmt.Sprint(want) {
+		t.Fatalf("delays = %v, want %v", delays, want)
+	}
+
+	// A visitor with the right password is neither rejected nor delayed.
+	delays = nil
+	if _, _, _, err := svc.Unlock(stored, "secret-1", "192.168.0.1"); err != nil {
+		t.Fatalf("correct password must unlock during an attack: %v", err)
+	}
+	if len(delays) != 0 {
+		t.Fatalf("correct password was delayed: %v", delays)
+	}
+	if got := sharePasswordTokenDelay(1 << 20); got != sharePasswordMaxTokenDelay {
+		t.Fatalf("delay is not capped: %v", got)
+	}
+}
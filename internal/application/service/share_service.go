@@ -10,10 +10,13 @@ import (
 	"strings"
 	"time"
 
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 	"github.com/yeying-community/warehouse/internal/domain/share"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/crypto"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"go.uber.org/zap"
 )
 
@@ -25,6 +28,14 @@ type ShareService struct {
 	logger               *zap.Logger
 	shareUserService     *ShareUserService
 	sharedResourceAccess *SharedResourceAccessService
+	notifications        *NotificationService
+	accessLogs           repository.ShareAccessLogRepository
+	storage              storage.Backend
+	passwordHasher       *crypto.PasswordHasher
+	passwordGuard        *sharePasswordGuard
+	accessKey            []byte
+	now                  func() time.Time
+	sleep                func(time.Duration)
 }
 
 func (s *ShareService) SetShareUserService(service *ShareUserService) {
@@ -35,6 +46,18 @@ func (s *ShareService) SetSharedResourceAccess(access *SharedResourceAccessServi
 	s.sharedResourceAccess = access
 }
 
+// SetNotificationService 启用上传模式分享收到文件时的所有者通知
+func (s *ShareService) SetNotificationService(notifications *NotificationService) {
+	s.notifications = notifications
+}
+
+// SetStorage 设置分享文件所在的存储后端，默认为本地磁盘
+func (s *ShareService) SetStorage(backend storage.Backend) {
+	if backend != nil {
+		s.storage = backend
+	}
+}
+
 // NewShareService 创建分享服务
 func NewShareService(
 	shareRepo repository.ShareRepository,
@@ -42,20 +65,51 @@ func NewShareService(
 	cfg *config.Config,
 	logger *zap.Logger,
 ) *ShareService {
+	secret := ""
+	if cfg != nil {
+		secret = cfg.Web3.JWTSecret
+	}
 	return &ShareService{
-		shareRepo: shareRepo,
-		userRepo:  userRepo,
-		config:    cfg,
-		logger:    logger,
+		shareRepo:      shareRepo,
+		userRepo:       userRepo,
+		config:         cfg,
+		logger:         logger,
+		storage:        storage.NewLocal(),
+		passwordHasher: crypto.NewPasswordHasher(),
+		passwordGuard:  newSharePasswordGuard(),
+		accessKey:      newShareAccessKey(secret),
+		now:            time.Now,
+		sleep:          time.Sleep,
 	}
 }
 
 type ShareCreateInput struct {
 	Expiry ShareExpiryInput
 	Mode   string
+	// Password 可选的访问密码，为空表示无需密码
+	Password string
+	// Upload 上传模式（仅目录）的单链接限制
+	Upload share.UploadLimits
+	// MaxViews / MaxDownloads 访问与下载次数上限，达到后链接失效，0 表示不限制
+	MaxViews     int64
+	MaxDownloads int64
+}
+
+// applyAccessLimits validates the view and download caps and copies them
+// onto item; they only make sense for links that serve content.
+func (input ShareCreateInput) applyAccessLimits(item *share.ShareItem) error {
+	if input.MaxViews < 0 || input.MaxDownloads < 0 {
+		return fmt.Errorf("view and download limits must not be negative")
+	}
+	if item.IsUploadMode() && (input.MaxViews > 0 || input.MaxDownloads > 0) {
+		return fmt.Errorf("view and download limits do not apply to upload shares")
+	}
+	item.MaxViews = input.MaxViews
+	item.MaxDownloads = input.MaxDownloads
+	return nil
 }
 
-// CreateFromReceivedResource creates a public file link only while the
+// CreateFromReceivedResource creates a public file or folder link only while the
 // recipient retains effective read access to the V3 resource. The access is
 // rechecked whenever the public link is resolved.
 func (s *ShareService) CreateFromReceivedResource(ctx context.Context, creator *user.User, resourceID, relativePath string, input ShareCreateInput) (*share.ShareItem, error) {
@@ -72,18 +126,18 @@ func (s *ShareService) CreateFromReceivedResource(ctx context.Context, creator *
 	}
 	cleanRelative := ""
 	if strings.TrimSpace(relativePath) != "" {
-		cleanRelative, err = normalizeSharePath(relativePath, "")
+		cleanRelative, err = normalizeSharePath(NamePolicy(s.config), relativePath, "")
 		if err != nil {
 			return nil, err
 		}
 	}
 	resourcePath := path.Join("/", strings.TrimPrefix(resource.NormalizedPath, "/"), strings.TrimPrefix(cleanRelative, "/"))
 	fullPath := s.resolveFullPath(owner, resourcePath)
-	info, err := os.Stat(fullPath)
-	if err != nil || info.IsDir() {
+	info, err := s.storage.Stat(fullPath)
+	if err != nil {
 		return nil, fmt.Errorf("shared file not found")
 	}
-	expiresAt, err := input.Expiry.Resolve(time.Now())
+	expiresAt, err := input.Expiry.ResolveWithin(time.Now(), maxShareLifetime(s.config))
 	if err != nil {
 		return nil, err
 	}
@@ -91,7 +145,19 @@ func (s *ShareService) CreateFromReceivedResource(ctx context.Context, creator *
 	if err != nil {
 		return nil, err
 	}
+	if mode == share.ModeUpload {
+		return nil, fmt.Errorf("upload shares can only be created for your own folders")
+	}
+	passwordHash, err := s.hashSharePassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
 	item := share.NewResourceDerivedShareItem(owner.ID, owner.Username, creator.ID, resource.ID, resourcePath, info.Name(), mode, expiresAt)
+	item.IsDir = info.IsDir()
+	item.PasswordHash = passwordHash
+	if err := input.applyAccessLimits(item); err != nil {
+		return nil, err
+	}
 	if err := s.shareRepo.Create(ctx, item); err != nil {
 		return nil, err
 	}
@@ -100,7 +166,7 @@ func (s *ShareService) CreateFromReceivedResource(ctx context.Context, creator *
 
 // Create 创建分享链接
 func (s *ShareService) Create(ctx context.Context, u *user.User, rawPath string, input ShareCreateInput) (*share.ShareItem, error) {
-	cleanPath, err := normalizeSharePath(rawPath, s.webdavPrefix())
+	cleanPath, err := normalizeSharePath(NamePolicy(s.config), rawPath, s.webdavPrefix())
 	if err != nil {
 		return nil, err
 	}
@@ -109,16 +175,13 @@ func (s *ShareService) Create(ctx context.Context, u *user.User, rawPath string,
 	}
 
 	fullPath := s.resolveFullPath(u, cleanPath)
-	info, err := os.Stat(fullPath)
+	info, err := s.storage.Stat(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
-	if info.IsDir() {
-		return nil, fmt.Errorf("directory sharing not supported")
-	}
 
 	name := filepath.Base(fullPath)
-	expiresAt, err := input.Expiry.Resolve(time.Now())
+	expiresAt, err := input.Expiry.ResolveWithin(time.Now(), maxShareLifetime(s.config))
 	if err != nil {
 		return nil, err
 	}
@@ -126,8 +189,28 @@ func (s *ShareService) Create(ctx context.Context, u *user.User, rawPath string,
 	if err != nil {
 		return nil, err
 	}
+	var uploadLimits share.UploadLimits
+	if mode == share.ModeUpload {
+		if !info.IsDir() {
+			return nil, fmt.Errorf("upload shares require a folder")
+		}
+		if uploadLimits, err = input.Upload.Normalized(); err != nil {
+			return nil, err
+		}
+	}
+
+	passwordHash, err := s.hashSharePassword(input.Password)
+	if err != nil {
+		return nil, err
+	}
 
 	item := share.NewShareItem(u.ID, u.Username, cleanPath, name, mode, expiresAt)
+	item.IsDir = info.IsDir()
+	item.PasswordHash = passwordHash
+	item.Upload = uploadLimits
+	if err := input.applyAccessLimits(item); err != nil {
+		return nil, err
+	}
 	if err := s.shareRepo.Create(ctx, item); err != nil {
 		return nil, err
 	}
@@ -205,82 +288,95 @@ func (s *ShareService) Revoke(ctx context.Context, u *user.User, token string) e
 	return s.shareRepo.DeleteByToken(ctx, token)
 }
 
-// IncrementView 记录访问次数
+// IncrementView 记录访问次数，次数已达上限时返回 share.ErrShareExpired
 func (s *ShareService) IncrementView(ctx context.Context, token string) error {
 	return s.shareRepo.IncrementView(ctx, token)
 }
 
-// IncrementDownload 记录下载次数
+// IncrementDownload 记录下载次数，次数已达上限时返回 share.ErrShareExpired
 func (s *ShareService) IncrementDownload(ctx context.Context, token string) error {
 	return s.shareRepo.IncrementDownload(ctx, token)
 }
 
-// Resolve 根据 token 获取分享文件
-func (s *ShareService) Resolve(ctx context.Context, token string) (*share.ShareItem, *os.File, os.FileInfo, error) {
-	item, err := s.shareRepo.GetByToken(ctx, token)
+// Resolve 根据 token 获取单文件分享的文件，目录分享返回 share.ErrInvalidShare，
+// 上传模式分享返回 share.ErrShareUploadOnly
+func (s *ShareService) Resolve(ctx context.Context, token string) (*share.ShareItem, storage.File, os.FileInfo, error) {
+	item, fullPath, err := s.ResolvePath(ctx, token)
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	if item.IsExpired() {
-		return nil, nil, nil, share.ErrShareExpired
+	if item.IsUploadMode() {
+		return nil, nil, nil, share.ErrShareUploadOnly
+	}
+	f, err := s.storage.Open(fullPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, nil, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, nil, nil, share.ErrInvalidShare
+	}
+	return item, f, info, nil
+}
+
+// ResolvePath 根据 token 校验分享（过期、次数上限、来源分享与资源授权）并返回分享文件的完整路径
+func (s *ShareService) ResolvePath(ctx context.Context, token string) (*share.ShareItem, string, error) {
+	item, err := s.shareRepo.GetByToken(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+	if item.IsExpired() || item.LimitReached() {
+		return nil, "", share.ErrShareExpired
 	}
 	if item.SourceShareID != "" {
 		if s.shareUserService == nil {
-			return nil, nil, nil, share.ErrInvalidShare
+			return nil, "", share.ErrInvalidShare
 		}
 		creator, err := s.userRepo.FindByID(ctx, item.CreatorUserID)
 		if err != nil {
-			return nil, nil, nil, share.ErrInvalidShare
+			return nil, "", share.ErrInvalidShare
 		}
 		source, _, err := s.shareUserService.ResolveForTarget(ctx, creator, item.SourceShareID, "read")
 		if err != nil || !user.ParsePermissions(source.Permissions).Read {
-			return nil, nil, nil, share.ErrInvalidShare
+			return nil, "", share.ErrInvalidShare
 		}
 	}
 	if item.SourceResourceID != "" {
 		if s.sharedResourceAccess == nil {
-			return nil, nil, nil, share.ErrInvalidShare
+			return nil, "", share.ErrInvalidShare
 		}
 		creator, err := s.userRepo.FindByID(ctx, item.CreatorUserID)
 		if err != nil {
-			return nil, nil, nil, share.ErrInvalidShare
+			return nil, "", share.ErrInvalidShare
 		}
 		if _, err := s.sharedResourceAccess.Authorize(ctx, item.SourceResourceID, creator.ID, "read", time.Now()); err != nil {
-			return nil, nil, nil, share.ErrInvalidShare
+			return nil, "", share.ErrInvalidShare
 		}
 	}
 
 	u, err := s.userRepo.FindByID(ctx, item.UserID)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, "", fmt.Errorf("failed to get user: %w", err)
 	}
 
 	normalized, err := s.normalizeItemPath(item.Path)
 	if err != nil {
-		return nil, nil, nil, share.ErrInvalidShare
+		return nil, "", share.ErrInvalidShare
 	}
 	item.Path = normalized
-	fullPath := s.resolveFullPath(u, normalized)
-	f, err := os.Open(fullPath)
-	if err != nil {
-		return nil, nil, nil, err
-	}
-	info, err := f.Stat()
-	if err != nil {
-		f.Close()
-		return nil, nil, nil, err
-	}
-	if info.IsDir() {
-		f.Close()
-		return nil, nil, nil, share.ErrInvalidShare
-	}
-	return item, f, info, nil
+	return item, s.resolveFullPath(u, normalized), nil
 }
 
 func (s *ShareService) resolveFullPath(u *user.User, sharePath string) string {
-	rel := strings.TrimPrefix(sharePath, "/")
+	rel := strings.TrimPrefix(NamePolicy(s.config).Normalize(sharePath), "/")
 	rel = filepath.FromSlash(rel)
-	return filepath.Join(s.getUserRootDir(u), rel)
+	root := s.getUserRootDir(u)
+	return NamePolicy(s.config).WithFS(s.storage).Resolve(root, filepath.Join(root, rel))
 }
 
 func (s *ShareService) getUserRootDir(u *user.User) string {
@@ -291,7 +387,7 @@ func (s *ShareService) getUserRootDir(u *user.User) string {
 	if filepath.IsAbs(userDir) {
 		return userDir
 	}
-	return filepath.Join(s.config.WebDAV.Directory, userDir)
+	return filepath.Join(userVolumeBase(s.config, u.Volume, userDir), userDir)
 }
 
 func (s *ShareService) webdavPrefix() string {
@@ -302,12 +398,12 @@ func (s *ShareService) webdavPrefix() string {
 }
 
 func (s *ShareService) normalizeItemPath(raw string) (string, error) {
-	return normalizeSharePath(raw, s.webdavPrefix())
+	return normalizeSharePath(NamePolicy(s.config), raw, s.webdavPrefix())
 }
 
-func normalizeSharePath(raw string, prefix string) (string, error) {
+func normalizeSharePath(names pathname.Policy, raw string, prefix string) (string, error) {
 	raw = stripWebdavPrefix(raw, prefix)
-	raw = strings.TrimSpace(raw)
+	raw = strings.TrimSpace(names.Normalize(raw))
 	if raw == "" {
 		return "", fmt.Errorf("path is required")
 	}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+const (
+	// publicShareUploaderPrefix marks the synthetic uploader of anonymous
+	// file-drop uploads, so a session started through one link can only be
+	// continued through the same link.
+	publicShareUploaderPrefix = "public-share:"
+	// maxShareUploadRenames bounds the "name (n).ext" probing on collisions.
+	maxShareUploadRenames = 1000
+)
+
+// PublicShareUploader 返回通过上传模式分享匿名上传时使用的上传者身份
+func PublicShareUploader(token string) *user.User {
+	return &user.User{ID: publicShareUploaderPrefix + strings.TrimSpace(token), Username: "anonymous"}
+}
+
+// ResolveUpload 校验上传模式分享（过期、访问授权与目录存在），不暴露目录内容
+func (s *ShareService) ResolveUpload(ctx context.Context, token string) (*share.ShareItem, error) {
+	item, _, err := s.resolveUploadRoot(ctx, token)
+	return item, err
+}
+
+func (s *ShareService) resolveUploadRoot(ctx context.Context, token string) (*share.ShareItem, string, error) {
+	item, rootFull, err := s.ResolvePath(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+	if !item.IsUploadMode() {
+		return nil, "", share.ErrInvalidShare
+	}
+	info, err := s.storage.Stat(rootFull)
+	if err != nil {
+		return nil, "", err
+	}
+	if !info.IsDir() {
+		return nil, "", share.ErrInvalidShare
+	}
+	return item, rootFull, nil
+}
+
+// resolveUploadTarget picks where an anonymous upload named fileName lands:
+// directly below the share root, renamed to "name (n).ext" when the name is
+// taken, since drop uploads never overwrite existing files.
+func (s *ShareService) resolveUploadTarget(ctx context.Context, token, fileName string) (*share.ShareItem, *user.User, string, error) {
+	item, rootFull, err := s.resolveUploadRoot(ctx, token)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	owner, err := s.userRepo.FindByID(ctx, item.UserID)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to get user: %w", err)
+	}
+	name := path.Base(NamePolicy(s.config).Normalize(strings.ReplaceAll(strings.TrimSpace(fileName), "\\", "/")))
+	if name == "" || name == "." || name == ".." || name == "/" || isSkippedArchiveName(name) {
+		return nil, nil, "", fmt.Errorf("%w: invalid file name", ErrUploadSessionInvalid)
+	}
+	if err := checkShareUploadLimits(item, name, -1); err != nil {
+		return nil, nil, "", err
+	}
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 0; i <= maxShareUploadRenames; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+		fullPath := filepath.Join(rootFull, candidate)
+		if _, err := s.storage.Lstat(fullPath); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return nil, nil, "", err
+		}
+		if NamePolicy(s.config).WithFS(s.storage).CheckCollision(fullPath) != nil {
+			continue
+		}
+		return item, owner, fullPath, nil
+	}
+	return nil, nil, "", fmt.Errorf("%w: too many files named %q", ErrUploadSessionConflict, name)
+}
+
+// checkShareUploadLimits applies the per-link limits; size < 0 skips the
+// size checks. The total and count checks are advisory here, ReserveUpload
+// enforces them atomically on completion.
+func checkShareUploadLimits(item *share.ShareItem, name string, size int64) error {
+	policy := user.UploadPolicy{
+		MaxFileSize:     item.Upload.MaxFileSize,
+		AllowExtensions: item.Upload.AllowedExtensions,
+	}
+	if err := policy.Check(user.UploadCandidate{Name: name, Size: size, DirEntries: -1}); err != nil {
+		return err
+	}
+	if limit := item.Upload.MaxTotalBytes; limit > 0 && size > 0 && item.UploadedBytes+size > limit {
+		return share.ErrShareUploadLimit
+	}
+	if limit := item.Upload.MaxFiles; limit > 0 && item.UploadedFiles >= limit {
+		return share.ErrShareUploadLimit
+	}
+	return nil
+}
+
+// ReserveUpload 在写入文件前占用上传模式分享的总大小与文件数额度，
+// 返回的 release 用于写入失败时归还
+func (s *ShareService) ReserveUpload(ctx context.Context, item *share.ShareItem, size int64) (func(), error) {
+	if err := s.shareRepo.ReserveUpload(ctx, item.Token, size, item.Upload); err != nil {
+		return nil, err
+	}
+	item.UploadedBytes += size
+	item.UploadedFiles++
+	release := func() {
+		if err := s.shareRepo.ReleaseUpload(context.WithoutCancel(ctx), item.Token, size); err != nil {
+			s.logger.Warn("failed to release share upload", zap.String("token", item.Token), zap.Error(err))
+		}
+		item.UploadedBytes -= size
+		item.UploadedFiles--
+	}
+	return release, nil
+}
+
+// RecordUpload 记录一次完成的匿名上传并通知分享所有者
+func (s *ShareService) RecordUpload(ctx context.Context, item *share.ShareItem, owner *user.User, targetPath string, size int64) {
+	fileName := path.Base(targetPath)
+	s.logger.Info("share upload received",
+		zap.String("username", owner.Username),
+		zap.String("token", item.Token),
+		zap.String("file", fileName),
+		zap.Int64("size", size))
+	s.notifications.NotifyShareUpload(ctx, owner, item.ID, item.Name, fileName, item.UploadedFiles)
+}
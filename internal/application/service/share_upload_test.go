@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func uploadThroughShare(t *testing.T, svc *UploadSessionService, token, name, content string) (*UploadSession, error) {
+	t.Helper()
+	ctx := context.Background()
+	uploader := PublicShareUploader(token)
+	session, err := svc.Create(ctx, uploader, UploadSessionCreateInput{
+		ShareToken:    token,
+		FileName:      name,
+		Size:          int64(len(content)),
+		VariableParts: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, _, err := svc.UploadPart(ctx, uploader, session.ID, 1, "", strings.NewReader(content)); err != nil {
+		return nil, err
+	}
+	return svc.Complete(ctx, uploader, session.ID)
+}
+
+func TestShareServiceUploadModeAcceptsAnonymousUploadsWithinLimits(t *testing.T) {
+	root := t.TempDir()
+	userDir := filepath.Join(root, "alice")
+	writeRecoverTestFile(t, filepath.Join(userDir, "inbox", "report.pdf"), "existing")
+	writeRecoverTestFile(t, filepath.Join(userDir, "notes.txt"), "notes")
+
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = root
+	users := newTestUserRepo()
+	owner := &user.User{ID: "u1", Username: "alice", Directory: "alice", Quota: 1 << 20}
+	_ = users.Save(context.Background(), owner)
+	repo := newMemoryPublicShareRepo()
+	shares := NewShareService(repo, users, cfg, zap.NewNop())
+	uploads := NewUploadSessionService(cfg, nil, nil, users, nil, noopMutationRecorder{}, zap.NewNop())
+	uploads.SetShareService(shares)
+	ctx := context.Background()
+
+	if _, err := shares.Create(ctx, owner, "/notes.txt", ShareCreateInput{Mode: share.ModeUpload}); err == nil {
+		t.Fatal("upload mode must require a folder")
+	}
+	item, err := shares.Create(ctx, owner, "/inbox", ShareCreateInput{
+		Mode: share.ModeUpload,
+		Upload: share.UploadLimits{
+			MaxFileSize:       10,
+			MaxFiles:          2,
+			AllowedExtensions: []string{"PDF", ".txt"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("create upload share: %v", err)
+	}
+	if got := item.Upload.AllowedExtensions; len(got) != 2 || got[0] != ".pdf" {
+		t.Fatalf("extensions not normalized: %v", got)
+	}
+
+	// Upload-only shares never expose their content.
+	if _, _, err := shares.ListEntries(ctx, item.Token, ""); !errors.Is(err, share.ErrShareUploadOnly) {
+		t.Fatalf("listing should be refused, got %v", err)
+	}
+	if _, _, _, err := shares.ResolveEntry(ctx, item.Token, "report.pdf"); !errors.Is(err, share.ErrShareUploadOnly) {
+		t.Fatalf("reading should be refused, got %v", err)
+	}
+
+	session, err := uploadThroughShare(t, uploads, item.Token, "../report.pdf", "fresh")
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if session.TargetPath != "/report (1).pdf" {
+		t.Fatalf("expected rename on collision, got %q", session.TargetPath)
+	}
+	if data, _ := os.ReadFile(filepath.Join(userDir, "inbox", "report.pdf")); string(data) != "existing" {
+		t.Fatalf("existing file was overwritten: %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(userDir, "inbox", "report (1).pdf")); string(data) != "fresh" {
+		t.Fatalf("unexpected uploaded content: %q", data)
+	}
+
+	if _, err := uploadThroughShare(t, uploads, item.Token, "tool.exe", "x"); err == nil {
+		t.Fatal("disallowed extension should be rejected")
+	}
+	if _, err := uploadThroughShare(t, uploads, item.Token, "big.txt", "0123456789ab"); err == nil {
+		t.Fatal("file above the per-link size limit should be rejected")
+	}
+	if _, err := uploadThroughShare(t, uploads, item.Token, "b.txt", "second"); err != nil {
+		t.Fatalf("second upload: %v", err)
+	}
+	if _, err := uploadThroughShare(t, uploads, item.Token, "c.txt", "third"); !errors.Is(err, share.ErrShareUploadLimit) {
+		t.Fatalf("expected file count limit, got %v", err)
+	}
+
+	stored, _ := repo.GetByToken(ctx, item.Token)
+	if stored.UploadedFiles != 2 || stored.UploadedBytes != int64(len("fresh")+len("second")) {
+		t.Fatalf("unexpected usage: %d files, %d bytes", stored.UploadedFiles, stored.UploadedBytes)
+	}
+	charged, _ := users.FindByID(ctx, owner.ID)
+	if charged.UsedSpace != stored.UploadedBytes {
+		t.Fatalf("owner should be charged %d bytes, got %d", stored.UploadedBytes, charged.UsedSpace)
+	}
+
+	// Sessions of one link cannot be continued with another identity.
+	other, err := uploads.Create(ctx, PublicShareUploader("other-token"), UploadSessionCreateInput{ShareToken: item.Token, FileName: "d.txt"})
+	if !errors.Is(err, ErrUploadSessionForbidden) || other != nil {
+		t.Fatalf("expected forbidden for a foreign uploader, got %v", err)
+	}
+}
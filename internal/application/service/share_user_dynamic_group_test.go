@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/yeying-community/warehouse/internal/domain/shareuser"
 	"github.com/yeying-community/warehouse/internal/domain/user"
@@ -192,6 +193,15 @@ func (r *memoryShareRepo) DeleteByID(_ context.Context, id string) error {
 	return nil
 }
 
+func (r *memoryShareRepo) UpdateExpiry(_ context.Context, id string, expiresAt *time.Time) error {
+	item, ok := r.items[id]
+	if !ok {
+		return shareuser.ErrShareNotFound
+	}
+	item.ExpiresAt = expiresAt
+	return nil
+}
+
 func (r *memoryShareRepo) ListAudiencesByShareID(_ context.Context, shareID string) ([]repository.UserShareAudience, error) {
 	audiences, ok := r.audiences[shareID]
 	if !ok {
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/shareuser"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/email"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+const (
+	shareTargetEmails = "emails"
+	// maxShareInviteEmails 单次分享最多邀请的邮箱数
+	maxShareInviteEmails = 50
+)
+
+// ErrShareInvitesDisabled 未配置邮件发送时不能按邮箱分享
+var ErrShareInvitesDisabled = errors.New("email invites are not enabled")
+
+// ShareInviteMailer 发送定向分享邀请邮件
+type ShareInviteMailer interface {
+	SendShareInvite(to string, invite email.ShareInvite) error
+}
+
+// SetInviteRepository 设置邮箱邀请仓储
+func (s *ShareUserService) SetInviteRepository(repo repository.ShareInviteRepository) {
+	s.invites = repo
+}
+
+// SetInviteMailer 设置邀请邮件发送器
+func (s *ShareUserService) SetInviteMailer(mailer ShareInviteMailer) {
+	s.mailer = mailer
+}
+
+// CreateByEmails 按邮箱创建共享：已注册邮箱直接授权，其余邮箱发送邀请邮件并保持待生效，
+// 收件人以该邮箱通过验证码登录后生效。loginURL 为邮件中的登录入口
+func (s *ShareUserService) CreateByEmails(ctx context.Context, owner *user.User, emails []string, rawPath string, permissions string, expiry ShareExpiryInput, loginURL string) (*shareuser.ShareUserItem, []*shareuser.EmailInvite, error) {
+	if s.invites == nil || s.mailer == nil || s.config == nil || !s.config.Email.Enabled {
+		return nil, nil, ErrShareInvitesDisabled
+	}
+	addresses, err := normalizeInviteEmails(owner, emails)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targetUsers := make([]repository.UserShareAudience, 0, len(addresses))
+	pending := make([]string, 0, len(addresses))
+	seenUserID := make(map[string]struct{}, len(addresses))
+	for _, addr := range addresses {
+		target, err := s.userRepo.FindByEmail(ctx, addr)
+		if errors.Is(err, user.ErrUserNotFound) {
+			pending = append(pending, addr)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := seenUserID[target.ID]; ok || target.ID == owner.ID {
+			continue
+		}
+		seenUserID[target.ID] = struct{}{}
+		targetUsers = append(targetUsers, repository.UserShareAudience{
+			AudienceType: shareuser.AudienceTypeUser,
+			TargetUserID: target.ID,
+			TargetWallet: target.WalletAddress,
+		})
+	}
+	if len(targetUsers) == 0 && len(pending) == 0 {
+		return nil, nil, fmt.Errorf("no valid target emails found")
+	}
+
+	item, err := s.createWithAudiences(ctx, owner, rawPath, permissions, expiry, targetUsers, targetUsers, false, shareTargetEmails, len(pending) > 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	invites := make([]*shareuser.EmailInvite, 0, len(pending))
+	for _, addr := range pending {
+		invite := shareuser.NewEmailInvite(item.ID, owner.ID, addr)
+		if err := s.invites.Create(ctx, invite); err != nil {
+			if delErr := s.repo.DeleteByID(ctx, item.ID); delErr != nil {
+				s.logger.Warn("failed to roll back share after invite error",
+					zap.String("share_id", item.ID),
+					zap.Error(delErr))
+			}
+			return nil, nil, err
+		}
+		invite.ShareName = item.Name
+		invite.SharePath = item.Path
+		invites = append(invites, invite)
+	}
+	for _, invite := range invites {
+		s.sendInvite(owner, item, invite.Email, loginURL)
+	}
+	return item, invites, nil
+}
+
+// sendInvite delivers the invite mail. A failed delivery keeps the invite
+// pending: the recipient can still sign in with the address later.
+func (s *ShareUserService) sendInvite(owner *user.User, item *shareuser.ShareUserItem, to, loginURL string) {
+	err := s.mailer.SendShareInvite(to, email.ShareInvite{
+		OwnerName: owner.Username,
+		ShareName: displayShareName(item.Name, item.Path),
+		LoginURL:  loginURL,
+		ExpiresAt: item.ExpiresAt,
+	})
+	if err != nil {
+		s.logger.Warn("failed to send share invite",
+			zap.String("share_id", item.ID),
+			zap.String("email", to),
+			zap.Error(err))
+	}
+}
+
+func normalizeInviteEmails(owner *user.User, emails []string) ([]string, error) {
+	ownerEmail := strings.ToLower(strings.TrimSpace(owner.Email))
+	seen := make(map[string]struct{}, len(emails))
+	result := make([]string, 0, len(emails))
+	for _, raw := range emails {
+		addr := strings.ToLower(strings.TrimSpace(raw))
+		if addr == "" || addr == ownerEmail {
+			continue
+		}
+		if !user.IsValidEmail(addr) {
+			return nil, fmt.Errorf("invalid email: %s", addr)
+		}
+		if _, ok := seen[addr]; ok {
+			continue
+		}
+		seen[addr] = struct{}{}
+		result = append(result, addr)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no target emails provided")
+	}
+	if len(result) > maxShareInviteEmails {
+		return nil, fmt.Errorf("too many target emails, at most %d", maxShareInviteEmails)
+	}
+	return result, nil
+}
+
+// ActivateEmailInvites 将该用户邮箱上的待生效邀请转为定向授权，邮箱验证码登录成功后调用；
+// 返回生效的邀请数
+func (s *ShareUserService) ActivateEmailInvites(ctx context.Context, u *user.User) (int, error) {
+	if s == nil || s.invites == nil || u == nil || strings.TrimSpace(u.Email) == "" {
+		return 0, nil
+	}
+	pending, err := s.invites.ListPendingByEmail(ctx, u.Email)
+	if err != nil {
+		return 0, err
+	}
+	activated := 0
+	for _, invite := range pending {
+		if invite.OwnerUserID == u.ID {
+			continue
+		}
+		err := s.invites.Accept(ctx, invite.ID, u.ID, u.WalletAddress, time.Now())
+		if errors.Is(err, shareuser.ErrInviteNotFound) {
+			continue
+		}
+		if err != nil {
+			return activated, err
+		}
+		activated++
+		s.logger.Info("share invite accepted",
+			zap.String("share_id", invite.ShareID),
+			zap.String("invite_id", invite.ID),
+			zap.String("username", u.Username))
+
+		if s.notification == nil {
+			continue
+		}
+		owner, err := s.userRepo.FindByID(ctx, invite.OwnerUserID)
+		if err != nil {
+			continue
+		}
+		s.notification.NotifyShareCreated(ctx, owner, invite.ShareID, invite.ShareName, invite.SharePath, []repository.UserShareAudience{{
+			AudienceType: shareuser.AudienceTypeUser,
+			TargetUserID: u.ID,
+		}}, false)
+	}
+	return activated, nil
+}
+
+// ListInvites 返回 owner 发出的邮箱邀请，shareID 为空时返回全部分享的邀请，status 为空时不过滤状态
+func (s *ShareUserService) ListInvites(ctx context.Context, owner *user.User, shareID, status string) ([]*shareuser.EmailInvite, error) {
+	if s.invites == nil {
+		return []*shareuser.EmailInvite{}, nil
+	}
+	if shareID != "" {
+		item, err := s.repo.GetByID(ctx, shareID)
+		if err != nil {
+			return nil, err
+		}
+		if item.OwnerUserID != owner.ID {
+			return nil, fmt.Errorf("permission denied: not your share")
+		}
+	}
+	invites, err := s.invites.ListByOwner(ctx, owner.ID, shareID, status)
+	if err != nil {
+		return nil, err
+	}
+	for _, invite := range invites {
+		if normalized, err := s.normalizeItemPath(invite.SharePath); err == nil {
+			invite.SharePath = normalized
+		}
+	}
+	return invites, nil
+}
+
+// RevokeInvite 撤销待生效的邮箱邀请，已生效的授权需撤销整个分享
+func (s *ShareUserService) RevokeInvite(ctx context.Context, owner *user.User, id string) error {
+	if s.invites == nil {
+		return shareuser.ErrInviteNotFound
+	}
+	invite, err := s.invites.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if invite.OwnerUserID != owner.ID {
+		return shareuser.ErrInviteNotFound
+	}
+	if err := s.invites.Revoke(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Info("share invite revoked",
+		zap.String("owner", owner.Username),
+		zap.String("share_id", invite.ShareID),
+		zap.String("invite_id", id))
+	return nil
+}
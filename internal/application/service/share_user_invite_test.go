@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/shareuser"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/email"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"go.uber.org/zap"
+)
+
+type memoryShareInviteRepo struct {
+	shares  *memoryShareRepo
+	invites map[string]*shareuser.EmailInvite
+}
+
+func (r *memoryShareInviteRepo) Create(_ context.Context, invite *shareuser.EmailInvite) error {
+	copied := *invite
+	r.invites[invite.ID] = &copied
+	return nil
+}
+
+func (r *memoryShareInviteRepo) GetByID(_ context.Context, id string) (*shareuser.EmailInvite, error) {
+	invite, ok := r.invites[id]
+	if !ok {
+		return nil, shareuser.ErrInviteNotFound
+	}
+	return r.withShare(invite), nil
+}
+
+func (r *memoryShareInviteRepo) ListByOwner(_ context.Context, ownerUserID, shareID, status string) ([]*shareuser.EmailInvite, error) {
+	var result []*shareuser.EmailInvite
+	for _, invite := range r.invites {
+		if invite.OwnerUserID != ownerUserID || (shareID != "" && invite.ShareID != shareID) || (status != "" && invite.Status != status) {
+			continue
+		}
+		result = append(result, r.withShare(invite))
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Email < result[j].Email })
+	return result, nil
+}
+
+func (r *memoryShareInviteRepo) ListPendingByEmail(_ context.Context, email string) ([]*shareuser.EmailInvite, error) {
+	var result []*shareuser.EmailInvite
+	for _, invite := range r.invites {
+		if invite.Email == email && invite.IsPending() {
+			result = append(result, r.withShare(invite))
+		}
+	}
+	return result, nil
+}
+
+func (r *memoryShareInviteRepo) Accept(_ context.Context, id, targetUserID, targetWallet string, acceptedAt time.Time) error {
+	invite, ok := r.invites[id]
+	if !ok || !invite.IsPending() {
+		return shareuser.ErrInviteNotFound
+	}
+	invite.Status = shareuser.InviteStatusAccepted
+	invite.AcceptedUserID = targetUserID
+	invite.AcceptedAt = &acceptedAt
+	r.shares.audiences[invite.ShareID] = append(r.shares.audiences[invite.ShareID], repository.UserShareAudience{
+		AudienceType: shareuser.AudienceTypeUser,
+		TargetUserID: targetUserID,
+		TargetWallet: targetWallet,
+	})
+	return nil
+}
+
+func (r *memoryShareInviteRepo) Revoke(_ context.Context, id string) error {
+	invite, ok := r.invites[id]
+	if !ok || !invite.IsPending() {
+		return shareuser.ErrInviteNotFound
+	}
+	invite.Status = shareuser.InviteStatusRevoked
+	return nil
+}
+
+func (r *memoryShareInviteRepo) withShare(invite *shareuser.EmailInvite) *shareuser.EmailInvite {
+	copied := *invite
+	if item, ok := r.shares.items[invite.ShareID]; ok {
+		copied.ShareName = item.Name
+		copied.SharePath = item.Path
+	}
+	return &copied
+}
+
+type recordingInviteMailer struct {
+	sent map[string]email.ShareInvite
+}
+
+func (m *recordingInviteMailer) SendShareInvite(to string, invite email.ShareInvite) error {
+	m.sent[to] = invite
+	return nil
+}
+
+func TestShareUserServiceEmailInvitesActivateOnLogin(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	cfg := &config.Config{WebDAV: config.WebDAVConfig{Directory: root, Prefix: "/dav"}}
+
+	owner := newShareTestUser(t, "owner", "0xaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
+	_ = owner.SetEmail("owner@example.com")
+	member := newShareTestUser(t, "member", "0xbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	_ = member.SetEmail("member@example.com")
+	userRepo := newTestUserRepo()
+	mustSaveUser(t, userRepo, owner)
+	mustSaveUser(t, userRepo, member)
+	if err := os.MkdirAll(filepath.Join(root, owner.Directory, "reports"), 0o755); err != nil {
+		t.Fatalf("mkdir shared path: %v", err)
+	}
+
+	shareRepo := newMemoryShareRepo()
+	invites := &memoryShareInviteRepo{shares: shareRepo, invites: make(map[string]*shareuser.EmailInvite)}
+	mailer := &recordingInviteMailer{sent: make(map[string]email.ShareInvite)}
+	svc := NewShareUserService(shareRepo, userRepo, nil, nil, cfg, zap.NewNop())
+	svc.SetInviteRepository(invites)
+	svc.SetInviteMailer(mailer)
+
+	emails := []string{"member@example.com", " Guest@Example.com", "guest@example.com", "owner@example.com"}
+	if _, _, err := svc.CreateByEmails(ctx, owner, emails, "/reports", "R", ShareExpiryInput{}, "https://drive.example.com/"); !errors.Is(err, ErrShareInvitesDisabled) {
+		t.Fatalf("invites without email configured should be refused, got %v", err)
+	}
+	cfg.Email.Enabled = true
+	if _, _, err := svc.CreateByEmails(ctx, owner, []string{"not-an-email"}, "/reports", "R", ShareExpiryInput{}, ""); err == nil {
+		t.Fatal("invalid addresses must be rejected")
+	}
+
+	item, created, err := svc.CreateByEmails(ctx, owner, emails, "/reports", "R", ShareExpiryInput{}, "https://drive.example.com/")
+	if err != nil {
+		t.Fatalf("CreateByEmails: %v", err)
+	}
+	if item.AudienceType != "emails" || item.TargetCount != 1 {
+		t.Fatalf("unexpected item metadata: type=%q target=%d", item.AudienceType, item.TargetCount)
+	}
+	if audiences := shareRepo.audiences[item.ID]; len(audiences) != 1 || audiences[0].TargetUserID != member.ID {
+		t.Fatalf("registered email should be granted directly: %#v", audiences)
+	}
+	if len(created) != 1 || created[0].Email != "guest@example.com" || !created[0].IsPending() {
+		t.Fatalf("unexpected invites: %#v", created)
+	}
+	if mail, ok := mailer.sent["guest@example.com"]; !ok || len(mailer.sent) != 1 || mail.OwnerName != "owner" || mail.ShareName != "reports" || mail.LoginURL != "https://drive.example.com/" {
+		t.Fatalf("unexpected invite mails: %#v", mailer.sent)
+	}
+
+	guest := newShareTestUser(t, "guest", "0xcccccccccccccccccccccccccccccccccccccccc")
+	_ = guest.SetEmail("guest@example.com")
+	mustSaveUser(t, userRepo, guest)
+	if _, _, err := svc.ResolveForTarget(ctx, guest, item.ID, "read"); err == nil {
+		t.Fatal("pending invite must not grant access")
+	}
+
+	// A second invite is revoked before the recipient ever signs in.
+	other, err := svc.CreateForAllUsers(ctx, owner, "/reports", "R", ShareExpiryInput{})
+	if err != nil {
+		t.Fatalf("CreateForAllUsers: %v", err)
+	}
+	_, late, err := svc.CreateByEmails(ctx, owner, []string{"late@example.com"}, "/reports", "R", ShareExpiryInput{}, "")
+	if err != nil {
+		t.Fatalf("CreateByEmails late: %v", err)
+	}
+	if err := svc.RevokeInvite(ctx, member, late[0].ID); !errors.Is(err, shareuser.ErrInviteNotFound) {
+		t.Fatalf("other users must not revoke the invite, got %v", err)
+	}
+	if err := svc.RevokeInvite(ctx, owner, late[0].ID); err != nil {
+		t.Fatalf("RevokeInvite: %v", err)
+	}
+	pending, err := svc.ListInvites(ctx, owner, "", shareuser.InviteStatusPending)
+	if err != nil || len(pending) != 1 || pending[0].ShareID != item.ID || pending[0].SharePath != "/reports" {
+		t.Fatalf("unexpected pending invites: %#v, %v", pending, err)
+	}
+	if _, err := svc.ListInvites(ctx, member, item.ID, ""); err == nil {
+		t.Fatal("only the owner can list invites of a share")
+	}
+	if _, err := svc.ListInvites(ctx, owner, other.ID, ""); err != nil {
+		t.Fatalf("ListInvites for share without invites: %v", err)
+	}
+
+	activated, err := svc.ActivateEmailInvites(ctx, guest)
+	if err != nil || activated != 1 {
+		t.Fatalf("ActivateEmailInvites = %d, %v", activated, err)
+	}
+	if _, _, err := svc.ResolveForTarget(ctx, guest, item.ID, "read"); err != nil {
+		t.Fatalf("accepted invite should grant access: %v", err)
+	}
+	if activated, _ := svc.ActivateEmailInvites(ctx, guest); activated != 0 {
+		t.Fatalf("invites must only activate once, got %d", activated)
+	}
+	all, _ := svc.ListInvites(ctx, owner, "", "")
+	statuses := make([]string, 0, len(all))
+	for _, invite := range all {
+		statuses = append(statuses, invite.Email+"="+invite.Status)
+	}
+	if got := strings.Join(statuses, ","); got != "guest@example.com=accepted,late@example.com=revoked" {
+		t.Fatalf("unexpected invite states: %s", got)
+	}
+}
@@ -131,5 +131,5 @@ func ownerUserRootDir(cfg *config.Config, owner *user.User) string {
 	if filepath.IsAbs(userDir) {
 		return filepath.Clean(userDir)
 	}
-	return filepath.Join(cfg.WebDAV.Directory, userDir)
+	return filepath.Join(userVolumeBase(cfg, owner.Volume, userDir), userDir)
 }
@@ -6,9 +6,11 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/yeying-community/warehouse/internal/domain/permission"
 	"github.com/yeying-community/warehouse/internal/domain/quota"
+	"github.com/yeying-community/warehouse/internal/domain/recycle"
 	"github.com/yeying-community/warehouse/internal/domain/share"
 	"github.com/yeying-community/warehouse/internal/domain/shareuser"
 	"github.com/yeying-community/warehouse/internal/domain/user"
@@ -62,6 +64,57 @@ func TestSyncAllSharePathsForOwnerMoveUpdatesDirectedAndPublicShares(t *testing.
 	}
 }
 
+func TestNamePathSyncerUpdatesSharesAndRecycleItemsOfOwner(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = root
+	alice := user.NewUser("alice", "alice")
+	bob := user.NewUser("bob", "bob")
+	directedRepo := &captureUserShareRepo{}
+	publicRepo := &capturePublicShareRepo{}
+	recycleRepo := &memoryRecycleRepo{items: map[string]*recycle.RecycleItem{}}
+	nested := recycle.NewRecycleItem(alice.ID, alice.Username, "/personal/cafe\u0301", "a.txt", "/personal/cafe\u0301/a.txt", false, 1)
+	folder := recycle.NewRecycleItem(alice.ID, alice.Username, "personal", "cafe\u0301", "personal/cafe\u0301", true, 0)
+	sibling := recycle.NewRecycleItem(alice.ID, alice.Username, "/personal", "cafe\u0301s", "/personal/cafe\u0301s", false, 1)
+	other := recycle.NewRecycleItem(bob.ID, bob.Username, "/personal/cafe\u0301", "a.txt", "/personal/cafe\u0301/a.txt", false, 1)
+	for _, item := range []*recycle.RecycleItem{nested, folder, sibling, other} {
+		_ = recycleRepo.Create(context.Background(), item)
+	}
+
+	syncer := NewNamePathSyncer(cfg, []*user.User{alice, bob}, directedRepo, publicRepo, recycleRepo)
+	from := filepath.Join(root, "alice", "personal", "cafe\u0301")
+	to := filepath.Join(root, "alice", "personal", "caf\u00e9")
+	if err := syncer.SyncRename(context.Background(), from, to); err != nil {
+		t.Fatalf("SyncRename: %v", err)
+	}
+
+	if directedRepo.ownerID != alice.ID || directedRepo.toPath != "/personal/caf\u00e9" || publicRepo.toPath != "/personal/caf\u00e9" {
+		t.Fatalf("unexpected share sync: directed=%+v public=%+v", directedRepo, publicRepo)
+	}
+	want := map[string][2]string{
+		nested.Hash:  {"/personal/caf\u00e9", "/personal/caf\u00e9/a.txt"},
+		folder.Hash:  {"personal", "personal/caf\u00e9"},
+		sibling.Hash: {"/personal", "/personal/cafe\u0301s"},
+		other.Hash:   {"/personal/cafe\u0301", "/personal/cafe\u0301/a.txt"},
+	}
+	for hash, expected := range want {
+		item := recycleRepo.items[hash]
+		if item.Directory != expected[0] || item.Path != expected[1] {
+			t.Fatalf("recycle item %s: got dir=%q path=%q, want %q", item.Name, item.Directory, item.Path, expected)
+		}
+	}
+	if nested.Name != recycleRepo.items[nested.Hash].Name {
+		t.Fatalf("recycle item name must stay the storage key")
+	}
+
+	// Paths outside every user root are ignored.
+	if err := syncer.SyncRename(context.Background(), filepath.Join(root, ".teams"), filepath.Join(root, ".Teams")); err != nil {
+		t.Fatalf("SyncRename outside user roots: %v", err)
+	}
+}
+
 func TestRemoveAllShareReferencesForOwnerPathRemovesDirectedAndPublicShares(t *testing.T) {
 	t.Parallel()
 
@@ -205,6 +258,10 @@ func (*captureUserShareRepo) DeleteByID(context.Context, string) error {
 	return nil
 }
 
+func (*captureUserShareRepo) UpdateExpiry(context.Context, string, *time.Time) error {
+	return nil
+}
+
 func (*captureUserShareRepo) ListAudiencesByShareID(context.Context, string) ([]repository.UserShareAudience, error) {
 	return nil, nil
 }
@@ -226,9 +283,15 @@ func (*capturePublicShareRepo) GetByToken(context.Context, string) (*share.Share
 func (*capturePublicShareRepo) GetByUserID(context.Context, string) ([]*share.ShareItem, error) {
 	return nil, nil
 }
-func (*capturePublicShareRepo) DeleteByToken(context.Context, string) error     { return nil }
-func (*capturePublicShareRepo) IncrementView(context.Context, string) error     { return nil }
-func (*capturePublicShareRepo) IncrementDownload(context.Context, string) error { return nil }
+func (*capturePublicShareRepo) DeleteByToken(context.Context, string) error            { return nil }
+func (*capturePublicShareRepo) UpdatePassword(context.Context, string, string) error   { return nil }
+func (*capturePublicShareRepo) UpdateExpiry(context.Context, string, *time.Time) error { return nil }
+func (*capturePublicShareRepo) IncrementView(context.Context, string) error            { return nil }
+func (*capturePublicShareRepo) IncrementDownload(context.Context, string) error        { return nil }
+func (*capturePublicShareRepo) ReserveUpload(context.Context, string, int64, share.UploadLimits) error {
+	return nil
+}
+func (*capturePublicShareRepo) ReleaseUpload(context.Context, string, int64) error { return nil }
 func (r *capturePublicShareRepo) UpdatePathsForOwnerMove(_ context.Context, ownerID, fromPath, toPath string) error {
 	r.ownerID = ownerID
 	r.fromPath = fromPath
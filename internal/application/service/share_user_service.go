@@ -4,7 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"path"
 	"path/filepath"
 	"strings"
@@ -15,6 +14,7 @@ import (
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"go.uber.org/zap"
 )
 
@@ -26,6 +26,9 @@ type ShareUserService struct {
 	notification *NotificationService
 	config       *config.Config
 	logger       *zap.Logger
+	invites      repository.ShareInviteRepository
+	mailer       ShareInviteMailer
+	storage      storage.Backend
 }
 
 func (s *ShareUserService) Repository() repository.UserShareRepository {
@@ -58,6 +61,14 @@ func NewShareUserService(
 		notification: notificationService,
 		config:       cfg,
 		logger:       logger,
+		storage:      storage.NewLocal(),
+	}
+}
+
+// SetStorage 设置被分享文件所在的存储后端
+func (s *ShareUserService) SetStorage(backend storage.Backend) {
+	if s != nil && backend != nil {
+		s.storage = backend
 	}
 }
 
@@ -67,7 +78,7 @@ func (s *ShareUserService) CreateByGroups(ctx context.Context, owner *user.User,
 	if err != nil {
 		return nil, err
 	}
-	return s.createWithAudiences(ctx, owner, rawPath, permissions, expiry, targetGroups, notificationTargets, false, "groups")
+	return s.createWithAudiences(ctx, owner, rawPath, permissions, expiry, targetGroups, notificationTargets, false, "groups", false)
 }
 
 // CreateByWallets 按地址列表创建共享
@@ -76,12 +87,12 @@ func (s *ShareUserService) CreateByWallets(ctx context.Context, owner *user.User
 	if err != nil {
 		return nil, err
 	}
-	return s.createWithAudiences(ctx, owner, rawPath, permissions, expiry, targetUsers, targetUsers, false, "addresses")
+	return s.createWithAudiences(ctx, owner, rawPath, permissions, expiry, targetUsers, targetUsers, false, "addresses", false)
 }
 
 // CreateForAllUsers 创建全员共享
 func (s *ShareUserService) CreateForAllUsers(ctx context.Context, owner *user.User, rawPath string, permissions string, expiry ShareExpiryInput) (*shareuser.ShareUserItem, error) {
-	return s.createWithAudiences(ctx, owner, rawPath, permissions, expiry, nil, nil, true, shareuser.AudienceTypeAllUsers)
+	return s.createWithAudiences(ctx, owner, rawPath, permissions, expiry, nil, nil, true, shareuser.AudienceTypeAllUsers, false)
 }
 
 func (s *ShareUserService) createWithAudiences(
@@ -94,8 +105,9 @@ func (s *ShareUserService) createWithAudiences(
 	notificationTargets []repository.UserShareAudience,
 	allUsers bool,
 	targetType string,
+	hasPendingInvites bool,
 ) (*shareuser.ShareUserItem, error) {
-	cleanPath, err := normalizeSharePath(rawPath, s.webdavPrefix())
+	cleanPath, err := normalizeSharePath(NamePolicy(s.config), rawPath, s.webdavPrefix())
 	if err != nil {
 		return nil, err
 	}
@@ -104,14 +116,14 @@ func (s *ShareUserService) createWithAudiences(
 	}
 
 	fullPath := s.resolveFullPath(owner, cleanPath)
-	info, err := os.Stat(fullPath)
+	info, err := s.storage.Stat(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat path: %w", err)
 	}
 
 	name := filepath.Base(cleanPath)
 	isDir := info.IsDir()
-	expiresAt, err := expiry.Resolve(time.Now())
+	expiresAt, err := expiry.ResolveWithin(time.Now(), maxShareLifetime(s.config))
 	if err != nil {
 		return nil, err
 	}
@@ -133,7 +145,7 @@ func (s *ShareUserService) createWithAudiences(
 		})
 	}
 	audiences = append(audiences, targetAudiences...)
-	if len(audiences) == 0 {
+	if len(audiences) == 0 && !hasPendingInvites {
 		return nil, fmt.Errorf("at least one target audience is required")
 	}
 
@@ -148,6 +160,8 @@ func (s *ShareUserService) createWithAudiences(
 		item.AudienceType = "groups"
 	case "addresses":
 		item.AudienceType = "addresses"
+	case shareTargetEmails:
+		item.AudienceType = shareTargetEmails
 	case shareuser.AudienceTypeAllUsers:
 		item.AudienceType = shareuser.AudienceTypeAllUsers
 	default:
@@ -333,7 +347,7 @@ func (s *ShareUserService) webdavPrefix() string {
 }
 
 func (s *ShareUserService) normalizeItemPath(raw string) (string, error) {
-	return normalizeSharePath(raw, s.webdavPrefix())
+	return normalizeSharePath(NamePolicy(s.config), raw, s.webdavPrefix())
 }
 
 // ListByOwner 获取我分享的列表
@@ -483,9 +497,24 @@ func (s *ShareUserService) ResolveForTarget(ctx context.Context, target *user.Us
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to get owner: %w", err)
 	}
+	if requiresShareWrite(requiredActions) {
+		// 写入落在所有者目录，需按所有者所在卷的状态判断
+		if err := CheckVolumeWritable(s.config, owner); err != nil {
+			return nil, nil, err
+		}
+	}
 	return item, owner, nil
 }
 
+func requiresShareWrite(actions []string) bool {
+	for _, action := range actions {
+		if action != "read" {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *ShareUserService) targetHasAudienceAccess(ctx context.Context, target *user.User, audiences []repository.UserShareAudience) (bool, error) {
 	if target == nil {
 		return false, nil
@@ -550,11 +579,12 @@ func (s *ShareUserService) ResolveSharePath(owner *user.User, item *shareuser.Sh
 	if baseRel == "/" || strings.HasPrefix(baseRel, "/..") {
 		return "", "", fmt.Errorf("invalid share path")
 	}
-	baseRel = strings.TrimPrefix(baseRel, "/")
+	baseRel = NamePolicy(s.config).Normalize(strings.TrimPrefix(baseRel, "/"))
 
-	baseFull := filepath.Clean(filepath.Join(s.getUserRootDir(owner), filepath.FromSlash(baseRel)))
+	rootDir := s.getUserRootDir(owner)
+	baseFull := NamePolicy(s.config).WithFS(s.storage).Resolve(rootDir, filepath.Clean(filepath.Join(rootDir, filepath.FromSlash(baseRel))))
 
-	relClean, err := cleanRelativePath(relative)
+	relClean, err := cleanRelativePath(NamePolicy(s.config).Normalize(relative))
 	if err != nil {
 		return "", "", err
 	}
@@ -562,7 +592,7 @@ func (s *ShareUserService) ResolveSharePath(owner *user.User, item *shareuser.Sh
 	var targetFull string
 	if item.IsDir {
 		if relClean != "" {
-			targetFull = filepath.Clean(filepath.Join(baseFull, filepath.FromSlash(relClean)))
+			targetFull = NamePolicy(s.config).WithFS(s.storage).Resolve(baseFull, filepath.Clean(filepath.Join(baseFull, filepath.FromSlash(relClean))))
 		} else {
 			targetFull = baseFull
 		}
@@ -594,7 +624,7 @@ func (s *ShareUserService) getUserRootDir(u *user.User) string {
 	if filepath.IsAbs(userDir) {
 		return userDir
 	}
-	return filepath.Join(s.config.WebDAV.Directory, userDir)
+	return filepath.Join(userVolumeBase(s.config, u.Volume, userDir), userDir)
 }
 
 func cleanRelativePath(raw string) (string, error) {
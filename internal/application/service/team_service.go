@@ -0,0 +1,457 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/team"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// TeamService 管理分组所有的团队空间：成员角色、所有权转让，以及为文件访问解析团队存储账号
+type TeamService struct {
+	config       *config.Config
+	repo         repository.TeamRepository
+	groupRepo    repository.GroupRepository
+	userRepo     user.Repository
+	volumePlacer user.VolumePlacer
+	storage      storage.Backend
+	logger       *zap.Logger
+}
+
+// NewTeamService 创建团队空间服务
+func NewTeamService(cfg *config.Config, repo repository.TeamRepository, groupRepo repository.GroupRepository, userRepo user.Repository, logger *zap.Logger) *TeamService {
+	if cfg == nil || repo == nil || userRepo == nil {
+		return nil
+	}
+	return &TeamService{
+		config:    cfg,
+		repo:      repo,
+		groupRepo: groupRepo,
+		userRepo:  userRepo,
+		storage:   storage.NewLocal(),
+		logger:    logger,
+	}
+}
+
+// SetVolumePlacer 设置新建团队存储账号时的数据卷分配器
+func (s *TeamService) SetVolumePlacer(placer user.VolumePlacer) {
+	if s == nil {
+		return
+	}
+	s.volumePlacer = placer
+}
+
+// SetStorage 设置团队空间目录所在的存储后端
+func (s *TeamService) SetStorage(backend storage.Backend) {
+	if s == nil || backend == nil {
+		return
+	}
+	s.storage = backend
+}
+
+// Enabled 是否开启团队空间
+func (s *TeamService) Enabled() bool {
+	return s != nil && s.config != nil && s.config.Teams.Enabled
+}
+
+// List 列出用户参与或可管理的团队
+func (s *TeamService) List(ctx context.Context, u *user.User) ([]*team.Team, error) {
+	if !s.Enabled() {
+		return nil, team.ErrTeamsDisabled
+	}
+	return s.repo.ListForUser(ctx, u.ID)
+}
+
+// ListSpaces 列出可在资产/WebDAV 中打开的团队空间；app 授权与目录访问密钥不可见团队空间
+func (s *TeamService) ListSpaces(ctx context.Context, u *user.User) ([]*team.Team, error) {
+	if !s.Enabled() || u == nil {
+		return nil, nil
+	}
+	if _, isAccessKey := middleware.GetAccessKeyContext(ctx); isAccessKey {
+		return nil, nil
+	}
+	if scope, err := resolveAppScope(ctx, s.config); err != nil || scope.active {
+		return nil, nil
+	}
+	teams, err := s.repo.ListForUser(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	spaces := make([]*team.Team, 0, len(teams))
+	for _, item := range teams {
+		if item.Role != "" {
+			spaces = append(spaces, item)
+		}
+	}
+	return spaces, nil
+}
+
+// Create 为分组创建团队空间，仅分组所有者可以创建；创建者成为团队 owner
+func (s *TeamService) Create(ctx context.Context, u *user.User, groupID, name string) (*team.Team, error) {
+	if !s.Enabled() {
+		return nil, team.ErrTeamsDisabled
+	}
+	if s.groupRepo == nil {
+		return nil, fmt.Errorf("group repository is required")
+	}
+	item, err := team.NewTeam(groupID, name, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	grp, err := s.groupRepo.GetVisibleGroupByID(ctx, u.ID, u.WalletAddress, item.GroupID)
+	if err != nil {
+		return nil, err
+	}
+	if grp.UserID != u.ID {
+		return nil, team.ErrPermissionDenied
+	}
+	item.GroupName = grp.Name
+	item.GroupOwnerID = grp.UserID
+
+	account := user.NewUser(team.AccountUsername(item.ID), team.Directory(item.ID))
+	account.Permissions = team.Permissions(team.RoleOwner)
+	account.Quota = s.config.Teams.DefaultQuota
+	if s.volumePlacer != nil {
+		if err := s.volumePlacer.Place(ctx, account); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.userRepo.Save(ctx, account); err != nil {
+		return nil, fmt.Errorf("failed to create team account: %w", err)
+	}
+	if err := s.storage.MkdirAll(ResolveUserRoot(s.config, account), 0755); err != nil {
+		s.discardAccount(ctx, account)
+		return nil, fmt.Errorf("failed to create team directory: %w", err)
+	}
+
+	item.AccountUserID = account.ID
+	item.Quota = account.Quota
+	owner := &team.Member{
+		TeamID:    item.ID,
+		UserID:    u.ID,
+		Role:      team.RoleOwner,
+		CreatedAt: item.CreatedAt,
+		UpdatedAt: item.CreatedAt,
+	}
+	if err := s.repo.Create(ctx, item, owner); err != nil {
+		s.discardAccount(ctx, account)
+		return nil, err
+	}
+	if s.logger != nil {
+		s.logger.Info("team space created",
+			zap.String("team_id", item.ID),
+			zap.String("group_id", item.GroupID),
+			zap.String("owner", u.Username))
+	}
+	return item, nil
+}
+
+func (s *TeamService) discardAccount(ctx context.Context, account *user.User) {
+	if err := s.userRepo.Delete(ctx, account.Username); err != nil && s.logger != nil {
+		s.logger.Warn("failed to discard team account", zap.String("username", account.Username), zap.Error(err))
+	}
+}
+
+// Get 返回团队详情，Role 为当前用户的角色；分组所有者未加入团队时 Role 为空
+func (s *TeamService) Get(ctx context.Context, u *user.User, teamID string) (*team.Team, error) {
+	item, _, err := s.access(ctx, u, teamID)
+	return item, err
+}
+
+// Rename 修改团队名称（owner 或分组所有者）
+func (s *TeamService) Rename(ctx context.Context, u *user.User, teamID, name string) (*team.Team, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("team name is required")
+	}
+	item, err := s.manage(ctx, u, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Rename(ctx, item.ID, name); err != nil {
+		return nil, err
+	}
+	item.Name = name
+	return item, nil
+}
+
+// Delete 删除团队空间；空间内仍有文件（含回收站与历史版本）时拒绝删除
+func (s *TeamService) Delete(ctx context.Context, u *user.User, teamID string) error {
+	item, err := s.manage(ctx, u, teamID)
+	if err != nil {
+		return err
+	}
+	account, err := s.userRepo.FindByID(ctx, item.AccountUserID)
+	if err != nil {
+		return err
+	}
+	root := ResolveUserRoot(s.config, account)
+	entries, err := s.storage.ReadDir(root)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read team directory: %w", err)
+	}
+	if account.UsedSpace > 0 || len(entries) > 0 {
+		return team.ErrTeamNotEmpty
+	}
+	if err := s.repo.Delete(ctx, item.ID); err != nil {
+		return err
+	}
+	if err := s.storage.Remove(root); err != nil && !os.IsNotExist(err) && s.logger != nil {
+		s.logger.Warn("failed to remove team directory", zap.String("team_id", item.ID), zap.Error(err))
+	}
+	if s.logger != nil {
+		s.logger.Info("team space deleted", zap.String("team_id", item.ID), zap.String("operator", u.Username))
+	}
+	return nil
+}
+
+// ListMembers 列出团队成员（团队成员或分组所有者可见）
+func (s *TeamService) ListMembers(ctx context.Context, u *user.User, teamID string) ([]*team.Member, error) {
+	item, _, err := s.access(ctx, u, teamID)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.ListMembers(ctx, item.ID)
+}
+
+// AddMember 添加成员；target 为用户名或钱包地址，成员必须属于团队所在分组
+func (s *TeamService) AddMember(ctx context.Context, u *user.User, teamID, target, role string) (*team.Member, error) {
+	item, err := s.manage(ctx, u, teamID)
+	if err != nil {
+		return nil, err
+	}
+	role, err = team.NormalizeRole(role)
+	if err != nil {
+		return nil, err
+	}
+	if role == team.RoleOwner {
+		// 所有者只能通过转让产生，保证团队始终只有一个 owner
+		return nil, team.ErrInvalidRole
+	}
+	targetUser, err := s.resolveTarget(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireGroupMember(ctx, item, targetUser.ID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	member := &team.Member{
+		TeamID:        item.ID,
+		UserID:        targetUser.ID,
+		Username:      targetUser.Username,
+		WalletAddress: targetUser.WalletAddress,
+		Role:          role,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.repo.AddMember(ctx, member); err != nil {
+		return nil, err
+	}
+	return member, nil
+}
+
+// UpdateMemberRole 调整成员角色为 editor 或 viewer
+func (s *TeamService) UpdateMemberRole(ctx context.Context, u *user.User, teamID, userID, role string) error {
+	item, err := s.manage(ctx, u, teamID)
+	if err != nil {
+		return err
+	}
+	role, err = team.NormalizeRole(role)
+	if err != nil {
+		return err
+	}
+	if role == team.RoleOwner {
+		return team.ErrInvalidRole
+	}
+	return s.repo.UpdateMemberRole(ctx, item.ID, strings.TrimSpace(userID), role)
+}
+
+// RemoveMember 移除成员；成员也可以移除自己（退出团队），owner 需先转让所有权
+func (s *TeamService) RemoveMember(ctx context.Context, u *user.User, teamID, userID string) error {
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		userID = u.ID
+	}
+	var item *team.Team
+	var err error
+	if userID == u.ID {
+		item, _, err = s.access(ctx, u, teamID)
+	} else {
+		item, err = s.manage(ctx, u, teamID)
+	}
+	if err != nil {
+		return err
+	}
+	members, err := s.repo.ListMembers(ctx, item.ID)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.UserID == userID && member.Role == team.RoleOwner {
+			return team.ErrOwnerCannotLeave
+		}
+	}
+	return s.repo.RemoveMember(ctx, item.ID, userID)
+}
+
+// TransferOwnership 将 owner 转让给分组内的另一位用户，原 owner 保留 editor 角色
+func (s *TeamService) TransferOwnership(ctx context.Context, u *user.User, teamID, target string) (*team.Team, error) {
+	item, err := s.manage(ctx, u, teamID)
+	if err != nil {
+		return nil, err
+	}
+	targetUser, err := s.resolveTarget(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.repo.ListMembers(ctx, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	currentOwner := ""
+	for _, member := range members {
+		if member.Role == team.RoleOwner {
+			currentOwner = member.UserID
+			break
+		}
+	}
+	if currentOwner == "" || currentOwner == targetUser.ID {
+		return nil, team.ErrInvalidTransferOwner
+	}
+	if err := s.requireGroupMember(ctx, item, targetUser.ID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.TransferOwnership(ctx, item.ID, currentOwner, targetUser.ID); err != nil {
+		return nil, err
+	}
+	if s.logger != nil {
+		s.logger.Info("team ownership transferred",
+			zap.String("team_id", item.ID),
+			zap.String("from_user_id", currentOwner),
+			zap.String("to_user_id", targetUser.ID),
+			zap.String("operator", u.Username))
+	}
+	if u.ID == targetUser.ID {
+		item.Role = team.RoleOwner
+	} else if u.ID == currentOwner {
+		item.Role = team.RoleEditor
+	}
+	return item, nil
+}
+
+// ResolvePrincipal 解析访问团队空间时使用的存储账号：目录与配额属于团队，
+// 文件权限按成员角色收敛（viewer 只读）。app 授权与目录访问密钥不能进入团队空间。
+func (s *TeamService) ResolvePrincipal(ctx context.Context, u *user.User, teamID string) (*user.User, *team.Team, error) {
+	if !s.Enabled() {
+		return nil, nil, team.ErrTeamsDisabled
+	}
+	if u == nil {
+		return nil, nil, team.ErrPermissionDenied
+	}
+	if _, isAccessKey := middleware.GetAccessKeyContext(ctx); isAccessKey {
+		return nil, nil, team.ErrPermissionDenied
+	}
+	scope, err := resolveAppScope(ctx, s.config)
+	if err != nil {
+		return nil, nil, err
+	}
+	if scope.active {
+		return nil, nil, auth.ErrAppScopeDenied
+	}
+	item, role, err := s.access(ctx, u, teamID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if role == "" {
+		return nil, nil, team.ErrPermissionDenied
+	}
+	account, err := s.userRepo.FindByID(ctx, item.AccountUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	principal := *account
+	principal.Permissions = team.Permissions(role)
+	principal.Rules = nil
+	return &principal, item, nil
+}
+
+// access 返回团队与用户的有效角色；非成员的分组所有者角色为空但仍可管理
+func (s *TeamService) access(ctx context.Context, u *user.User, teamID string) (*team.Team, string, error) {
+	if !s.Enabled() {
+		return nil, "", team.ErrTeamsDisabled
+	}
+	teamID = strings.TrimSpace(teamID)
+	if teamID == "" {
+		return nil, "", team.ErrTeamNotFound
+	}
+	item, err := s.repo.GetByID(ctx, teamID)
+	if err != nil {
+		return nil, "", err
+	}
+	role, err := s.repo.FindRole(ctx, item.ID, u.ID)
+	if err != nil {
+		if !errors.Is(err, team.ErrMemberNotFound) {
+			return nil, "", err
+		}
+		if item.GroupOwnerID != u.ID {
+			// 对非成员隐藏团队是否存在
+			return nil, "", team.ErrTeamNotFound
+		}
+		role = ""
+	}
+	item.Role = role
+	return item, role, nil
+}
+
+func (s *TeamService) manage(ctx context.Context, u *user.User, teamID string) (*team.Team, error) {
+	item, role, err := s.access(ctx, u, teamID)
+	if err != nil {
+		return nil, err
+	}
+	if role != team.RoleOwner && item.GroupOwnerID != u.ID {
+		return nil, team.ErrPermissionDenied
+	}
+	return item, nil
+}
+
+func (s *TeamService) requireGroupMember(ctx context.Context, item *team.Team, userID string) error {
+	if item.GroupID == "" {
+		return nil
+	}
+	ok, err := s.repo.IsGroupMember(ctx, item.GroupID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return team.ErrNotGroupMember
+	}
+	return nil
+}
+
+func (s *TeamService) resolveTarget(ctx context.Context, target string) (*user.User, error) {
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil, fmt.Errorf("username or wallet address is required")
+	}
+	if isWalletAddress(target) {
+		return s.userRepo.FindByWalletAddress(ctx, strings.ToLower(target))
+	}
+	if found, err := s.userRepo.FindByUsername(ctx, target); err == nil {
+		return found, nil
+	} else if !errors.Is(err, user.ErrUserNotFound) {
+		return nil, err
+	}
+	return s.userRepo.FindByID(ctx, target)
+}
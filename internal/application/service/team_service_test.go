@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/domain/group"
+	"github.com/yeying-community/warehouse/internal/domain/team"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+)
+
+type memoryTeamRepo struct {
+	teams   map[string]*team.Team
+	members map[string]map[string]*team.Member
+	// groupMembers 模拟分组所有者与 active 成员
+	groupMembers map[string]map[string]bool
+}
+
+func newMemoryTeamRepo() *memoryTeamRepo {
+	return &memoryTeamRepo{
+		teams:        make(map[string]*team.Team),
+		members:      make(map[string]map[string]*team.Member),
+		groupMembers: make(map[string]map[string]bool),
+	}
+}
+
+func (r *memoryTeamRepo) joinGroup(groupID, userID string) {
+	if r.groupMembers[groupID] == nil {
+		r.groupMembers[groupID] = make(map[string]bool)
+	}
+	r.groupMembers[groupID][userID] = true
+}
+
+func (r *memoryTeamRepo) Create(_ context.Context, t *team.Team, owner *team.Member) error {
+	copied := *t
+	r.teams[t.ID] = &copied
+	r.members[t.ID] = map[string]*team.Member{}
+	ownerCopy := *owner
+	r.members[t.ID][owner.UserID] = &ownerCopy
+	return nil
+}
+
+func (r *memoryTeamRepo) GetByID(_ context.Context, teamID string) (*team.Team, error) {
+	item, ok := r.teams[teamID]
+	if !ok {
+		return nil, team.ErrTeamNotFound
+	}
+	copied := *item
+	return &copied, nil
+}
+
+func (r *memoryTeamRepo) ListForUser(ctx context.Context, userID string) ([]*team.Team, error) {
+	items := make([]*team.Team, 0)
+	for _, item := range r.teams {
+		role, err := r.FindRole(ctx, item.ID, userID)
+		if err != nil && item.GroupOwnerID != userID {
+			continue
+		}
+		copied := *item
+		copied.Role = role
+		items = append(items, &copied)
+	}
+	return items, nil
+}
+
+func (r *memoryTeamRepo) Rename(_ context.Context, teamID, name string) error {
+	item, ok := r.teams[teamID]
+	if !ok {
+		return team.ErrTeamNotFound
+	}
+	item.Name = name
+	return nil
+}
+
+func (r *memoryTeamRepo) Delete(_ context.Context, teamID string) error {
+	if _, ok := r.teams[teamID]; !ok {
+		return team.ErrTeamNotFound
+	}
+	delete(r.teams, teamID)
+	delete(r.members, teamID)
+	return nil
+}
+
+func (r *memoryTeamRepo) FindRole(_ context.Context, teamID, userID string) (string, error) {
+	item, ok := r.teams[teamID]
+	if !ok {
+		return "", team.ErrTeamNotFound
+	}
+	member, ok := r.members[teamID][userID]
+	if !ok || (item.GroupID != "" && !r.groupMembers[item.GroupID][userID]) {
+		return "", team.ErrMemberNotFound
+	}
+	return member.Role, nil
+}
+
+func (r *memoryTeamRepo) IsGroupMember(_ context.Context, groupID, userID string) (bool, error) {
+	return r.groupMembers[groupID][userID], nil
+}
+
+func (r *memoryTeamRepo) ListMembers(_ context.Context, teamID string) ([]*team.Member, error) {
+	members := make([]*team.Member, 0, len(r.members[teamID]))
+	for _, member := range r.members[teamID] {
+		copied := *member
+		members = append(members, &copied)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Role == team.RoleOwner && members[j].Role != team.RoleOwner
+	})
+	return members, nil
+}
+
+func (r *memoryTeamRepo) AddMember(_ context.Context, member *team.Member) error {
+	if _, ok := r.members[member.TeamID][member.UserID]; ok {
+		return team.ErrDuplicateMember
+	}
+	copied := *member
+	r.members[member.TeamID][member.UserID] = &copied
+	return nil
+}
+
+func (r *memoryTeamRepo) UpdateMemberRole(_ context.Context, teamID, userID, role string) error {
+	member, ok := r.members[teamID][userID]
+	if !ok || member.Role == team.RoleOwner {
+		return team.ErrMemberNotFound
+	}
+	member.Role = role
+	return nil
+}
+
+func (r *memoryTeamRepo) RemoveMember(_ context.Context, teamID, userID string) error {
+	member, ok := r.members[teamID][userID]
+	if !ok || member.Role == team.RoleOwner {
+		return team.ErrMemberNotFound
+	}
+	delete(r.members[teamID], userID)
+	return nil
+}
+
+func (r *memoryTeamRepo) TransferOwnership(_ context.Context, teamID, fromUserID, toUserID string) error {
+	from, ok := r.members[teamID][fromUserID]
+	if !ok || from.Role != team.RoleOwner {
+		return team.ErrMemberNotFound
+	}
+	from.Role = team.RoleEditor
+	if to, ok := r.members[teamID][toUserID]; ok {
+		to.Role = team.RoleOwner
+		return nil
+	}
+	r.members[teamID][toUserID] = &team.Member{TeamID: teamID, UserID: toUserID, Role: team.RoleOwner}
+	return nil
+}
+
+type teamTestEnv struct {
+	service *TeamService
+	repo    *memoryTeamRepo
+	users   *testUserRepo
+	groups  *fakeGroupRepository
+	owner   *user.User
+	groupID string
+}
+
+func newTeamTestEnv(t *testing.T) *teamTestEnv {
+	t.Helper()
+	cfg := &config.Config{
+		WebDAV: config.WebDAVConfig{Directory: t.TempDir()},
+		Teams:  config.TeamsConfig{Enabled: true, DefaultQuota: 1 << 20},
+	}
+	users := newTestUserRepo()
+	owner := newShareTestUser(t, "alice", "0x1111111111111111111111111111111111111111")
+	mustSaveUser(t, users, owner)
+	groups := newFakeGroupRepository()
+	grp, err := group.NewGroup(owner.ID, "design")
+	if err != nil {
+		t.Fatalf("NewGroup: %v", err)
+	}
+	if err := groups.CreateGroup(context.Background(), grp, nil); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+	repo := newMemoryTeamRepo()
+	repo.joinGroup(grp.ID, owner.ID)
+	return &teamTestEnv{
+		service: NewTeamService(cfg, repo, groups, users, nil),
+		repo:    repo,
+		users:   users,
+		groups:  groups,
+		owner:   owner,
+		groupID: grp.ID,
+	}
+}
+
+func (e *teamTestEnv) addGroupUser(t *testing.T, name, wallet string) *user.User {
+	t.Helper()
+	u := newShareTestUser(t, name, wallet)
+	mustSaveUser(t, e.users, u)
+	member, err := group.NewMember(e.owner.ID, e.groupID, name, wallet)
+	if err != nil {
+		t.Fatalf("NewMember: %v", err)
+	}
+	if err := e.groups.CreateMember(context.Background(), member); err != nil {
+		t.Fatalf("CreateMember: %v", err)
+	}
+	e.repo.joinGroup(e.groupID, u.ID)
+	return u
+}
+
+func TestTeamServiceCreateProvisionsAccount(t *testing.T) {
+	env := newTeamTestEnv(t)
+	ctx := context.Background()
+
+	created, err := env.service.Create(ctx, env.owner, env.groupID, " Design Team ")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if created.Name != "Design Team" || created.Role != team.RoleOwner {
+		t.Fatalf("unexpected team: %+v", created)
+	}
+	account, err := env.users.FindByID(ctx, created.AccountUserID)
+	if err != nil {
+		t.Fatalf("team account not saved: %v", err)
+	}
+	if account.Username != team.AccountUsername(created.ID) || account.Quota != 1<<20 {
+		t.Fatalf("unexpected team account: %+v", account)
+	}
+	if info, err := os.Stat(ResolveUserRoot(env.service.config, account)); err != nil || !info.IsDir() {
+		t.Fatalf("team directory not created: %v", err)
+	}
+
+	member := env.addGroupUser(t, "bob", "0x2222222222222222222222222222222222222222")
+	if _, err := env.service.Create(ctx, member, env.groupID, "other"); !errors.Is(err, team.ErrPermissionDenied) {
+		t.Fatalf("expected non-owner create to be denied, got %v", err)
+	}
+}
+
+func TestTeamServiceResolvePrincipalFollowsRole(t *testing.T) {
+	env := newTeamTestEnv(t)
+	ctx := context.Background()
+	created, err := env.service.Create(ctx, env.owner, env.groupID, "docs")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	viewer := env.addGroupUser(t, "bob", "0x2222222222222222222222222222222222222222")
+	if _, err := env.service.AddMember(ctx, env.owner, created.ID, "bob", team.RoleViewer); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	principal, _, err := env.service.ResolvePrincipal(ctx, viewer, created.ID)
+	if err != nil {
+		t.Fatalf("ResolvePrincipal: %v", err)
+	}
+	if principal.ID != created.AccountUserID {
+		t.Fatalf("principal should be the team account, got %s", principal.ID)
+	}
+	if !principal.CanAccess("/docs", "read") || principal.CanAccess("/docs", "create") {
+		t.Fatalf("viewer principal should be read-only: %+v", principal.Permissions)
+	}
+
+	if err := env.service.UpdateMemberRole(ctx, env.owner, created.ID, viewer.ID, team.RoleEditor); err != nil {
+		t.Fatalf("UpdateMemberRole: %v", err)
+	}
+	principal, _, err = env.service.ResolvePrincipal(ctx, viewer, created.ID)
+	if err != nil {
+		t.Fatalf("ResolvePrincipal after promotion: %v", err)
+	}
+	if !principal.CanAccess("/docs", "create") {
+		t.Fatal("editor principal should be writable")
+	}
+
+	outsider := newShareTestUser(t, "carol", "0x3333333333333333333333333333333333333333")
+	mustSaveUser(t, env.users, outsider)
+	if _, _, err := env.service.ResolvePrincipal(ctx, outsider, created.ID); !errors.Is(err, team.ErrTeamNotFound) {
+		t.Fatalf("expected outsider to see not found, got %v", err)
+	}
+	if _, err := env.service.AddMember(ctx, env.owner, created.ID, "carol", team.RoleViewer); !errors.Is(err, team.ErrNotGroupMember) {
+		t.Fatalf("expected non-group member to be rejected, got %v", err)
+	}
+}
+
+func TestTeamServiceTransferAndLeave(t *testing.T) {
+	env := newTeamTestEnv(t)
+	ctx := context.Background()
+	created, err := env.service.Create(ctx, env.owner, env.groupID, "ops")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	bob := env.addGroupUser(t, "bob", "0x2222222222222222222222222222222222222222")
+	if _, err := env.service.AddMember(ctx, env.owner, created.ID, "bob", team.RoleEditor); err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+
+	if err := env.service.RemoveMember(ctx, env.owner, created.ID, ""); !errors.Is(err, team.ErrOwnerCannotLeave) {
+		t.Fatalf("expected owner leave to be rejected, got %v", err)
+	}
+	if _, err := env.service.TransferOwnership(ctx, bob, created.ID, "alice"); !errors.Is(err, team.ErrPermissionDenied) {
+		t.Fatalf("expected editor transfer to be denied, got %v", err)
+	}
+	updated, err := env.service.TransferOwnership(ctx, env.owner, created.ID, "bob")
+	if err != nil {
+		t.Fatalf("TransferOwnership: %v", err)
+	}
+	if updated.Role != team.RoleEditor {
+		t.Fatalf("previous owner should become editor, got %q", updated.Role)
+	}
+	if role, _ := env.repo.FindRole(ctx, created.ID, bob.ID); role != team.RoleOwner {
+		t.Fatalf("bob should own the team, got %q", role)
+	}
+
+	if err := env.service.RemoveMember(ctx, env.owner, created.ID, ""); err != nil {
+		t.Fatalf("previous owner should be able to leave: %v", err)
+	}
+	if _, err := env.repo.FindRole(ctx, created.ID, env.owner.ID); !errors.Is(err, team.ErrMemberNotFound) {
+		t.Fatalf("expected previous owner to be removed, got %v", err)
+	}
+}
+
+func TestTeamServiceDeleteRequiresEmptySpace(t *testing.T) {
+	env := newTeamTestEnv(t)
+	ctx := context.Background()
+	created, err := env.service.Create(ctx, env.owner, env.groupID, "archive")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	account, _ := env.users.FindByID(ctx, created.AccountUserID)
+	root := ResolveUserRoot(env.service.config, account)
+	if err := os.WriteFile(root+"/notes.txt", []byte("x"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	if err := env.service.Delete(ctx, env.owner, created.ID); !errors.Is(err, team.ErrTeamNotEmpty) {
+		t.Fatalf("expected non-empty delete to fail, got %v", err)
+	}
+	if err := os.Remove(root + "/notes.txt"); err != nil {
+		t.Fatalf("remove file: %v", err)
+	}
+	if err := env.service.Delete(ctx, env.owner, created.ID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := env.repo.GetByID(ctx, created.ID); !errors.Is(err, team.ErrTeamNotFound) {
+		t.Fatalf("expected team to be deleted, got %v", err)
+	}
+}
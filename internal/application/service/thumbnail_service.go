@@ -0,0 +1,429 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/permission"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	"github.com/yeying-community/warehouse/internal/infrastructure/thumbnail"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrThumbnailDisabled  = errors.New("thumbnails are disabled")
+	ErrThumbnailInvalid   = errors.New("invalid thumbnail request")
+	ErrThumbnailNotFound  = errors.New("thumbnail source not found")
+	ErrThumbnailForbidden = errors.New("thumbnail access forbidden")
+	// ErrThumbnailUnavailable is returned for files no thumbnail can be made
+	// of: directories, non-images, oversized or corrupt images.
+	ErrThumbnailUnavailable = errors.New("thumbnail unavailable")
+)
+
+const (
+	// ThumbnailsDirName is the hidden store under webdav.directory that
+	// caches thumbnails. It is outside every user directory, so cached
+	// thumbnails are never charged to a quota.
+	ThumbnailsDirName = ".warehouse-thumbnails"
+	// DefaultThumbnailSize is the edge used when a request names none.
+	DefaultThumbnailSize = 256
+
+	// thumbnailExternalDir caches files of users whose directory is an
+	// absolute path outside webdav.directory.
+	thumbnailExternalDir = ".external"
+	// thumbnailNoneExt marks sources that cannot be thumbnailed, so they are
+	// not decoded again until they change.
+	thumbnailNoneExt = ".none"
+)
+
+// thumbnailFormats lists the cached file extension of each output type.
+var thumbnailFormats = []struct {
+	ext         string
+	contentType string
+}{
+	{".jpg", thumbnail.ContentTypeJPEG},
+	{".png", thumbnail.ContentTypePNG},
+}
+
+// Thumbnail describes a cached thumbnail.
+type Thumbnail struct {
+	// Size is the edge of the box the thumbnail fits in.
+	Size        int
+	ContentType string
+	// ModTime is the modification time of the source file.
+	ModTime time.Time
+	ETag    string
+}
+
+// ThumbnailService renders and caches image thumbnails at a fixed set of
+// sizes. The cache mirrors the logical tree under
+// webdav.directory/.warehouse-thumbnails: each source file gets a folder
+// holding one thumbnail per size, named after the source size and
+// modification time, so a changed source is never served a stale
+// thumbnail. Recorder drops cached thumbnails eagerly when files change.
+type ThumbnailService struct {
+	config          *config.Config
+	permissionCheck permission.Checker
+	storage         storage.Backend
+	volumes         *storage.Volumes
+	webdavRoot      string
+	cacheRoot       string
+	sizes           []int
+	slots           chan struct{}
+	logger          *zap.Logger
+	// locks serialize rendering per source; striped so the set stays fixed.
+	locks [64]sync.Mutex
+}
+
+// NewThumbnailService returns nil when thumbnails are disabled.
+func NewThumbnailService(cfg *config.Config, permissionCheck permission.Checker, logger *zap.Logger) *ThumbnailService {
+	if cfg == nil || !cfg.Thumbnails.Enabled {
+		return nil
+	}
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	webdavRoot, err := filepath.Abs(strings.TrimSpace(cfg.WebDAV.Directory))
+	if err != nil {
+		logger.Warn("failed to resolve webdav root for thumbnails", zap.Error(err))
+		return nil
+	}
+	webdavRoot = filepath.Clean(webdavRoot)
+
+	sizes := append([]int(nil), cfg.Thumbnails.Sizes...)
+	if len(sizes) == 0 {
+		sizes = []int{DefaultThumbnailSize}
+	}
+	sort.Ints(sizes)
+	workers := cfg.Thumbnails.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	return &ThumbnailService{
+		config:          cfg,
+		permissionCheck: permissionCheck,
+		storage:         storage.NewLocal(),
+		// Rebuilt on the absolute root so Logical lines up with webdavRoot.
+		volumes:    storage.NewVolumes(webdavRoot, storage.VolumesFromConfig(cfg).List()[1:]),
+		webdavRoot: webdavRoot,
+		cacheRoot:  filepath.Join(webdavRoot, ThumbnailsDirName),
+		sizes:      sizes,
+		slots:      make(chan struct{}, workers),
+		logger:     logger,
+	}
+}
+
+// SetStorage sets the backend source images are read from.
+func (s *ThumbnailService) SetStorage(backend storage.Backend) {
+	if s != nil && backend != nil {
+		s.storage = backend
+	}
+}
+
+// Enabled reports whether thumbnails are configured.
+func (s *ThumbnailService) Enabled() bool {
+	return s != nil
+}
+
+// Sizes returns the configured edges in ascending order.
+func (s *ThumbnailService) Sizes() []int {
+	if s == nil {
+		return nil
+	}
+	return append([]int(nil), s.sizes...)
+}
+
+// Recorder wraps next so every recorded mutation also drops the cached
+// thumbnails of the paths it touches.
+func (s *ThumbnailService) Recorder(next MutationRecorder) MutationRecorder {
+	if next == nil {
+		next = noopMutationRecorder{}
+	}
+	if s == nil {
+		return next
+	}
+	return &thumbnailRecorder{next: next, thumbnails: s}
+}
+
+// Open returns the thumbnail of rawPath, relative to u's root, after
+// checking app scope and path rules.
+func (s *ThumbnailService) Open(ctx context.Context, u *user.User, rawPath string, size int) (storage.File, *Thumbnail, error) {
+	if s == nil {
+		return nil, nil, ErrThumbnailDisabled
+	}
+	if u == nil {
+		return nil, nil, ErrThumbnailForbidden
+	}
+	raw := strings.TrimSpace(strings.ReplaceAll(rawPath, "\\", "/"))
+	if raw == "" {
+		return nil, nil, fmt.Errorf("%w: path is required", ErrThumbnailInvalid)
+	}
+	clean := path.Clean("/" + strings.TrimLeft(NamePolicy(s.config).Normalize(raw), "/"))
+	if clean == "/" || strings.HasPrefix(clean, "/..") {
+		return nil, nil, ErrThumbnailInvalid
+	}
+	if err := enforceAppScope(ctx, s.config, clean, "read"); err != nil {
+		return nil, nil, err
+	}
+	relPath := filepath.FromSlash(strings.TrimPrefix(clean, "/"))
+	if s.permissionCheck != nil {
+		if err := s.permissionCheck.Check(ctx, u, filepath.Join(userPermissionRoot(u), relPath), permission.OperationRead); err != nil {
+			return nil, nil, ErrThumbnailForbidden
+		}
+	}
+	root := ResolveUserRoot(s.config, u)
+	return s.OpenFile(ctx, NamePolicy(s.config).WithFS(s.storage).Resolve(root, filepath.Join(root, relPath)), size)
+}
+
+// OpenFile returns the thumbnail of fullPath, generating it on a cache
+// miss. Callers must have authorized read access to fullPath.
+func (s *ThumbnailService) OpenFile(ctx context.Context, fullPath string, size int) (storage.File, *Thumbnail, error) {
+	if s == nil {
+		return nil, nil, ErrThumbnailDisabled
+	}
+	edge, err := s.resolveSize(size)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !thumbnail.Supported(fullPath) {
+		return nil, nil, ErrThumbnailUnavailable
+	}
+	info, err := s.storage.Stat(fullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, ErrThumbnailNotFound
+		}
+		return nil, nil, err
+	}
+	maxSource := s.config.Thumbnails.MaxSourceSize
+	if info.IsDir() || (maxSource > 0 && info.Size() > maxSource) {
+		return nil, nil, ErrThumbnailUnavailable
+	}
+
+	dir, err := s.cacheDir(fullPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	stamp := fmt.Sprintf("%d-%x-%x", edge, info.Size(), info.ModTime().UnixNano())
+	meta := &Thumbnail{Size: edge, ModTime: info.ModTime(), ETag: `"` + stamp + `"`}
+	f, contentType, err := s.lookup(dir, stamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f != nil {
+		meta.ContentType = contentType
+		return f, meta, nil
+	}
+
+	unlock := s.lock(dir)
+	defer unlock()
+	// Another request may have rendered it while this one waited.
+	f, contentType, err = s.lookup(dir, stamp)
+	if err != nil {
+		return nil, nil, err
+	}
+	if f != nil {
+		meta.ContentType = contentType
+		return f, meta, nil
+	}
+	contentType, err = s.render(ctx, fullPath, dir, stamp, edge)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err = s.storage.Open(filepath.Join(dir, stamp+thumbnailExtension(contentType)))
+	if err != nil {
+		return nil, nil, err
+	}
+	meta.ContentType = contentType
+	return f, meta, nil
+}
+
+// resolveSize rounds size up to the nearest configured edge; 0 selects
+// DefaultThumbnailSize.
+func (s *ThumbnailService) resolveSize(size int) (int, error) {
+	if size < 0 {
+		return 0, fmt.Errorf("%w: size must be positive", ErrThumbnailInvalid)
+	}
+	if size == 0 {
+		size = DefaultThumbnailSize
+	}
+	for _, edge := range s.sizes {
+		if edge >= size {
+			return edge, nil
+		}
+	}
+	return s.sizes[len(s.sizes)-1], nil
+}
+
+// lookup opens the cached thumbnail named stamp. It returns a nil file on a
+// miss and ErrThumbnailUnavailable when the source is known to be unusable.
+func (s *ThumbnailService) lookup(dir, stamp string) (storage.File, string, error) {
+	for _, format := range thumbnailFormats {
+		f, err := s.storage.Open(filepath.Join(dir, stamp+format.ext))
+		if err == nil {
+			return f, format.contentType, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, "", err
+		}
+	}
+	if _, err := s.storage.Stat(filepath.Join(dir, stamp+thumbnailNoneExt)); err == nil {
+		return nil, "", ErrThumbnailUnavailable
+	}
+	return nil, "", nil
+}
+
+// render decodes fullPath into a new cached thumbnail and removes the ones
+// it replaces.
+func (s *ThumbnailService) render(ctx context.Context, fullPath, dir, stamp string, edge int) (string, error) {
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	src, err := s.storage.Open(fullPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return "", ErrThumbnailNotFound
+		}
+		return "", err
+	}
+	defer src.Close()
+
+	if err := s.storage.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	contentType, err := thumbnail.Render(&buf, src, fullPath, edge, thumbnail.Options{
+		MaxPixels: s.config.Thumbnails.MaxPixels,
+		Quality:   s.config.Thumbnails.Quality,
+	})
+	unusable := errors.Is(err, thumbnail.ErrUnsupported) || errors.Is(err, thumbnail.ErrTooLarge)
+	if err != nil && !unusable {
+		return "", err
+	}
+	name := stamp + thumbnailExtension(contentType)
+	if unusable {
+		s.logger.Debug("image cannot be thumbnailed", zap.String("path", fullPath), zap.Error(err))
+		name = stamp + thumbnailNoneExt
+		buf.Reset()
+	}
+	if err := storage.WriteAll(s.storage, filepath.Join(dir, name), &buf, 0o644); err != nil {
+		return "", err
+	}
+	s.pruneStale(dir, edge, name)
+	if unusable {
+		return "", ErrThumbnailUnavailable
+	}
+	return contentType, nil
+}
+
+// pruneStale removes thumbnails of the same edge rendered from earlier
+// contents of the source.
+func (s *ThumbnailService) pruneStale(dir string, edge int, keep string) {
+	entries, err := s.storage.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	prefix := fmt.Sprintf("%d-", edge)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == keep || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if err := s.storage.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			s.logger.Debug("failed to remove stale thumbnail", zap.String("path", filepath.Join(dir, name)), zap.Error(err))
+		}
+	}
+}
+
+// invalidate drops the cached thumbnails of fullPath and, for directories,
+// of everything below it.
+func (s *ThumbnailService) invalidate(fullPath string) {
+	dir, err := s.cacheDir(fullPath)
+	if err != nil || dir == s.cacheRoot {
+		return
+	}
+	if err := s.storage.RemoveAll(dir); err != nil {
+		s.logger.Warn("failed to drop cached thumbnails", zap.String("path", fullPath), zap.Error(err))
+	}
+}
+
+// cacheDir maps a source path to its cache folder.
+func (s *ThumbnailService) cacheDir(fullPath string) (string, error) {
+	absPath, err := filepath.Abs(strings.TrimSpace(fullPath))
+	if err != nil {
+		return "", err
+	}
+	absPath = s.volumes.Logical(filepath.Clean(absPath))
+	rel, err := filepath.Rel(s.webdavRoot, absPath)
+	if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Join(s.cacheRoot, rel), nil
+	}
+	external := strings.TrimPrefix(absPath, filepath.VolumeName(absPath))
+	return filepath.Join(s.cacheRoot, thumbnailExternalDir, external), nil
+}
+
+func (s *ThumbnailService) lock(dir string) func() {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(dir))
+	mu := &s.locks[hash.Sum32()%uint32(len(s.locks))]
+	mu.Lock()
+	return mu.Unlock
+}
+
+func thumbnailExtension(contentType string) string {
+	for _, format := range thumbnailFormats {
+		if format.contentType == contentType {
+			return format.ext
+		}
+	}
+	return thumbnailNoneExt
+}
+
+// thumbnailRecorder drops cached thumbnails from the mutation pipeline.
+// Cache failures are logged and never fail the write.
+type thumbnailRecorder struct {
+	next       MutationRecorder
+	thumbnails *ThumbnailService
+}
+
+func (r *thumbnailRecorder) EnsureDir(ctx context.Context, fullPath string) error {
+	return r.next.EnsureDir(ctx, fullPath)
+}
+
+func (r *thumbnailRecorder) UpsertFile(ctx context.Context, fullPath string) error {
+	r.thumbnails.invalidate(fullPath)
+	return r.next.UpsertFile(ctx, fullPath)
+}
+
+func (r *thumbnailRecorder) MovePath(ctx context.Context, fromFullPath, toFullPath string, isDir bool) error {
+	r.thumbnails.invalidate(fromFullPath)
+	r.thumbnails.invalidate(toFullPath)
+	return r.next.MovePath(ctx, fromFullPath, toFullPath, isDir)
+}
+
+func (r *thumbnailRecorder) CopyPath(ctx context.Context, fromFullPath, toFullPath string, isDir bool) error {
+	r.thumbnails.invalidate(toFullPath)
+	return r.next.CopyPath(ctx, fromFullPath, toFullPath, isDir)
+}
+
+func (r *thumbnailRecorder) RemovePath(ctx context.Context, fullPath string, isDir bool) error {
+	r.thumbnails.invalidate(fullPath)
+	return r.next.RemovePath(ctx, fullPath, isDir)
+}
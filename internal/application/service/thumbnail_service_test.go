@@ -0,0 +1,191 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+)
+
+func newTestThumbnailService(t *testing.T) (*ThumbnailService, string, *user.User) {
+	t.Helper()
+	rootDir := t.TempDir()
+	cfg := &config.Config{
+		WebDAV: config.WebDAVConfig{Directory: rootDir},
+		Thumbnails: config.ThumbnailsConfig{
+			Enabled: true,
+			Sizes:   []int{64, 256},
+			Workers: 1,
+		},
+	}
+	svc := NewThumbnailService(cfg, allowPermissionChecker{}, nil)
+	if svc == nil {
+		t.Fatal("thumbnail service not created")
+	}
+	return svc, rootDir, user.NewUser("alice", "alice")
+}
+
+func writeTestPNG(t *testing.T, path string, width, height int, fill color.NRGBA) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	writeRecoverTestFile(t, path, buf.String())
+}
+
+func openTestThumbnail(t *testing.T, svc *ThumbnailService, u *user.User, rawPath string, size int) (image.Image, *Thumbnail) {
+	t.Helper()
+	f, meta, err := svc.Open(context.Background(), u, rawPath, size)
+	if err != nil {
+		t.Fatalf("open thumbnail %s: %v", rawPath, err)
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("decode thumbnail: %v", err)
+	}
+	return img, meta
+}
+
+func TestThumbnailServiceCachesOutsideUserDirectory(t *testing.T) {
+	svc, rootDir, u := newTestThumbnailService(t)
+	writeTestPNG(t, filepath.Join(rootDir, "alice", "photos", "a.png"), 400, 200, color.NRGBA{R: 200, A: 255})
+
+	img, meta := openTestThumbnail(t, svc, u, "/photos/a.png", 100)
+	if meta.Size != 256 {
+		t.Fatalf("size = %d, want rounded up to 256", meta.Size)
+	}
+	if meta.ContentType != "image/jpeg" {
+		t.Fatalf("content type = %s, want jpeg for opaque image", meta.ContentType)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(256, 128) {
+		t.Fatalf("thumbnail size = %v, want 256x128", got)
+	}
+
+	cached, err := filepath.Glob(filepath.Join(rootDir, ThumbnailsDirName, "alice", "photos", "a.png", "256-*"))
+	if err != nil || len(cached) != 1 {
+		t.Fatalf("cached thumbnails = %v, %v", cached, err)
+	}
+	userFiles, _ := filepath.Glob(filepath.Join(rootDir, "alice", "photos", "*"))
+	if len(userFiles) != 1 {
+		t.Fatalf("user directory files = %v, want only the source", userFiles)
+	}
+
+	// A second request is served from the cache without rendering again.
+	before, _ := os.Stat(cached[0])
+	_, again := openTestThumbnail(t, svc, u, "/photos/a.png", 256)
+	after, _ := os.Stat(cached[0])
+	if again.ETag != meta.ETag || !after.ModTime().Equal(before.ModTime()) {
+		t.Fatalf("cache miss on second request: %s vs %s", again.ETag, meta.ETag)
+	}
+
+	if _, meta := openTestThumbnail(t, svc, u, "/photos/a.png", 5000); meta.Size != 256 {
+		t.Fatalf("oversized request size = %d, want largest edge", meta.Size)
+	}
+	if _, meta := openTestThumbnail(t, svc, u, "/photos/a.png", 0); meta.Size != DefaultThumbnailSize {
+		t.Fatalf("default size = %d", meta.Size)
+	}
+}
+
+func TestThumbnailServiceRefreshesChangedSource(t *testing.T) {
+	svc, rootDir, u := newTestThumbnailService(t)
+	source := filepath.Join(rootDir, "alice", "a.png")
+	writeTestPNG(t, source, 100, 100, color.NRGBA{R: 255, A: 255})
+	img, meta := openTestThumbnail(t, svc, u, "/a.png", 64)
+	if r, _, _, _ := img.At(10, 10).RGBA(); r>>8 < 200 {
+		t.Fatalf("first thumbnail is not red")
+	}
+
+	// Overwrite without going through the recorder, as a replicated write
+	// on a standby would.
+	writeTestPNG(t, source, 80, 100, color.NRGBA{B: 255, A: 255})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(source, later, later); err != nil {
+		t.Fatal(err)
+	}
+	img, changed := openTestThumbnail(t, svc, u, "/a.png", 64)
+	if changed.ETag == meta.ETag {
+		t.Fatal("etag did not change after overwrite")
+	}
+	if _, _, b, _ := img.At(10, 10).RGBA(); b>>8 < 200 {
+		t.Fatalf("thumbnail was not refreshed")
+	}
+	cached, _ := filepath.Glob(filepath.Join(rootDir, ThumbnailsDirName, "alice", "a.png", "64-*"))
+	if len(cached) != 1 {
+		t.Fatalf("cached thumbnails = %v, want stale one pruned", cached)
+	}
+}
+
+func TestThumbnailRecorderDropsCache(t *testing.T) {
+	svc, rootDir, u := newTestThumbnailService(t)
+	source := filepath.Join(rootDir, "alice", "album", "a.png")
+	writeTestPNG(t, source, 50, 50, color.NRGBA{G: 255, A: 255})
+	openTestThumbnail(t, svc, u, "/album/a.png", 64)
+
+	next := &testMutationRecorder{}
+	recorder := svc.Recorder(next)
+	cacheDir := filepath.Join(rootDir, ThumbnailsDirName, "alice", "album")
+	if err := recorder.RemovePath(context.Background(), filepath.Join(rootDir, "alice", "album"), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cacheDir); !os.IsNotExist(err) {
+		t.Fatalf("cache dir still exists: %v", err)
+	}
+	if next.removePathCalls != 1 {
+		t.Fatalf("next recorder calls = %d, want 1", next.removePathCalls)
+	}
+}
+
+func TestThumbnailServiceRejectsUnusableFiles(t *testing.T) {
+	svc, rootDir, u := newTestThumbnailService(t)
+	writeRecoverTestFile(t, filepath.Join(rootDir, "alice", "notes.txt"), "hello")
+	writeRecoverTestFile(t, filepath.Join(rootDir, "alice", "broken.png"), "not a png")
+
+	ctx := context.Background()
+	if _, _, err := svc.Open(ctx, u, "/notes.txt", 64); !errors.Is(err, ErrThumbnailUnavailable) {
+		t.Fatalf("txt err = %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, _, err := svc.Open(ctx, u, "/broken.png", 64); !errors.Is(err, ErrThumbnailUnavailable) {
+			t.Fatalf("broken png err = %v", err)
+		}
+	}
+	markers, _ := filepath.Glob(filepath.Join(rootDir, ThumbnailsDirName, "alice", "broken.png", "*"+thumbnailNoneExt))
+	if len(markers) != 1 {
+		t.Fatalf("markers = %v, want one", markers)
+	}
+	if _, _, err := svc.Open(ctx, u, "/missing.png", 64); !errors.Is(err, ErrThumbnailNotFound) {
+		t.Fatalf("missing err = %v", err)
+	}
+	// Paths are clamped to the user's root, so another user's file is not reachable.
+	writeTestPNG(t, filepath.Join(rootDir, "bob", "a.png"), 10, 10, color.NRGBA{A: 255})
+	if _, _, err := svc.Open(ctx, u, "/../bob/a.png", 64); !errors.Is(err, ErrThumbnailNotFound) {
+		t.Fatalf("escape err = %v", err)
+	}
+
+	var disabled *ThumbnailService
+	if _, _, err := disabled.Open(ctx, u, "/a.png", 64); !errors.Is(err, ErrThumbnailDisabled) {
+		t.Fatalf("disabled err = %v", err)
+	}
+}
@@ -0,0 +1,318 @@
+package service
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+)
+
+// UploadPolicyEnforcer resolves the effective upload policy (global, user,
+// path rule) for a target and checks uploads against it. A nil enforcer
+// allows everything, so services work without one being injected.
+type UploadPolicyEnforcer struct {
+	global  *user.UploadPolicy
+	config  *config.Config
+	storage storage.Backend
+}
+
+// UploadTarget describes a file about to be written.
+type UploadTarget struct {
+	Owner *user.User
+	// PermissionPath is the path rules match against, e.g. "alice/apps/demo/a.png".
+	PermissionPath string
+	// FullPath is the on-disk destination, used to count sibling entries.
+	FullPath    string
+	Size        int64 // -1 when unknown
+	ContentType string
+}
+
+func NewUploadPolicyEnforcer(cfg *config.Config) *UploadPolicyEnforcer {
+	enforcer := &UploadPolicyEnforcer{storage: storage.NewLocal()}
+	if cfg == nil {
+		return enforcer
+	}
+	enforcer.config = cfg
+	global := &user.UploadPolicy{
+		MaxFileSize:     cfg.Upload.MaxFileSize,
+		AllowExtensions: cfg.Upload.AllowExtensions,
+		DenyExtensions:  cfg.Upload.DenyExtensions,
+		AllowMIMETypes:  cfg.Upload.AllowMIMETypes,
+		DenyMIMETypes:   cfg.Upload.DenyMIMETypes,
+		MaxFilesPerDir:  cfg.Upload.MaxFilesPerDir,
+	}
+	if normalized, err := global.Normalized(); err == nil {
+		enforcer.global = normalized
+	}
+	return enforcer
+}
+
+// SetStorage sets the backend whose entries count against per-directory limits.
+func (e *UploadPolicyEnforcer) SetStorage(backend storage.Backend) {
+	if e != nil && backend != nil {
+		e.storage = backend
+	}
+}
+
+// Policy returns the effective policy for a permission path.
+func (e *UploadPolicyEnforcer) Policy(owner *user.User, permissionPath string) user.UploadPolicy {
+	if e == nil {
+		return user.UploadPolicy{}
+	}
+	return owner.EffectiveUploadPolicy(e.global, uploadPolicyPath(permissionPath))
+}
+
+// Check returns a *user.UploadPolicyViolation when the target breaks the policy.
+func (e *UploadPolicyEnforcer) Check(target UploadTarget) error {
+	if e == nil {
+		return nil
+	}
+	policy := e.Policy(target.Owner, target.PermissionPath)
+	if policy.IsZero() {
+		return nil
+	}
+	candidate := user.UploadCandidate{
+		Name:        filepath.Base(target.FullPath),
+		Size:        target.Size,
+		ContentType: target.ContentType,
+		DirEntries:  -1,
+	}
+	if policy.MaxFilesPerDir > 0 && target.FullPath != "" {
+		if _, err := e.storage.Lstat(target.FullPath); os.IsNotExist(err) {
+			candidate.DirEntries = e.countDirEntries(filepath.Dir(target.FullPath))
+		}
+	}
+	return policy.Check(candidate)
+}
+
+// CheckDirectory checks a directory about to be created at fullPath against
+// the per-directory entry limit of its parent; names and sizes do not apply.
+func (e *UploadPolicyEnforcer) CheckDirectory(owner *user.User, permissionPath, fullPath string) error {
+	if e == nil || !e.applies(owner) {
+		return nil
+	}
+	if _, err := e.storage.Lstat(fullPath); !os.IsNotExist(err) {
+		return nil
+	}
+	return e.checkDirEntries(owner, permissionPath, e.countDirEntries(filepath.Dir(fullPath)))
+}
+
+// CheckOwnerDirectory is CheckDirectory for callers that only know the
+// on-disk path below owner's root.
+func (e *UploadPolicyEnforcer) CheckOwnerDirectory(owner *user.User, fullPath string) error {
+	if e == nil || owner == nil {
+		return nil
+	}
+	return e.CheckDirectory(owner, e.ownerPermissionPath(owner, fullPath), fullPath)
+}
+
+// CheckTransfer checks a MOVE or COPY of srcFull to dstFull (permissionPath
+// is the destination's). Every file that lands below the destination is
+// checked like an upload of the same name and size, and each directory of a
+// copied tree must fit the destination's per-directory limit. A rename within
+// one directory adds no entry there, so that directory is not counted.
+func (e *UploadPolicyEnforcer) CheckTransfer(owner *user.User, permissionPath, srcFull, dstFull string) error {
+	if e == nil || !e.applies(owner) {
+		return nil
+	}
+	info, err := e.storage.Lstat(srcFull)
+	if err != nil {
+		// The WebDAV handler reports the missing source.
+		return nil
+	}
+	dirEntries := -1
+	if filepath.Dir(filepath.Clean(srcFull)) != filepath.Dir(filepath.Clean(dstFull)) {
+		if _, err := e.storage.Lstat(dstFull); os.IsNotExist(err) {
+			dirEntries = e.countDirEntries(filepath.Dir(dstFull))
+		}
+	}
+	if !info.IsDir() {
+		return e.checkFile(owner, permissionPath, dstFull, info.Size(), dirEntries)
+	}
+	if err := e.checkDirEntries(owner, permissionPath, dirEntries); err != nil {
+		return err
+	}
+	return e.storage.WalkDir(srcFull, func(current string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcFull, current)
+		if err != nil {
+			return err
+		}
+		entryPermissionPath := filepath.Join(permissionPath, rel)
+		if entry.IsDir() {
+			// The copied directory ends up with as many entries as the source;
+			// the directory's own policy stands in for that of its children.
+			if count := e.countDirEntries(current); count > 0 {
+				return e.checkDirEntries(owner, entryPermissionPath, count-1)
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		entryInfo, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return e.checkFile(owner, entryPermissionPath, filepath.Join(dstFull, rel), entryInfo.Size(), -1)
+	})
+}
+
+func (e *UploadPolicyEnforcer) checkFile(owner *user.User, permissionPath, fullPath string, size int64, dirEntries int) error {
+	policy := e.Policy(owner, permissionPath)
+	if policy.IsZero() {
+		return nil
+	}
+	return policy.Check(user.UploadCandidate{
+		Name:       filepath.Base(fullPath),
+		Size:       size,
+		DirEntries: dirEntries,
+	})
+}
+
+// checkDirEntries applies only the per-directory limit of the policy in
+// effect at permissionPath to a directory that already holds existing entries.
+func (e *UploadPolicyEnforcer) checkDirEntries(owner *user.User, permissionPath string, existing int) error {
+	if existing < 0 {
+		return nil
+	}
+	limit := e.Policy(owner, permissionPath).MaxFilesPerDir
+	if limit <= 0 {
+		return nil
+	}
+	return user.UploadPolicy{MaxFilesPerDir: limit}.Check(user.UploadCandidate{Size: -1, DirEntries: existing})
+}
+
+// applies reports whether any policy level is configured for owner, so tree
+// walks are skipped when nothing can be violated.
+func (e *UploadPolicyEnforcer) applies(owner *user.User) bool {
+	if e.global != nil && !e.global.IsZero() {
+		return true
+	}
+	if owner == nil {
+		return false
+	}
+	if owner.UploadPolicy != nil && !owner.UploadPolicy.IsZero() {
+		return true
+	}
+	for _, rule := range owner.Rules {
+		if rule.UploadPolicy != nil && !rule.UploadPolicy.IsZero() {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckOwnerPath checks a file written into owner's space by its on-disk
+// path, for callers (shares, upload sessions) that do not track the
+// permission path themselves.
+func (e *UploadPolicyEnforcer) CheckOwnerPath(owner *user.User, fullPath string, size int64, contentType string) error {
+	if e == nil || owner == nil {
+		return nil
+	}
+	return e.Check(UploadTarget{
+		Owner:          owner,
+		PermissionPath: e.ownerPermissionPath(owner, fullPath),
+		FullPath:       fullPath,
+		Size:           size,
+		ContentType:    contentType,
+	})
+}
+
+// CheckOwnerRequest checks a raw PUT body written to fullPath in owner's
+// space. Bodies of unknown length are capped at the effective size limit.
+func (e *UploadPolicyEnforcer) CheckOwnerRequest(w http.ResponseWriter, r *http.Request, owner *user.User, fullPath string) error {
+	if e == nil || owner == nil {
+		return nil
+	}
+	if err := e.CheckOwnerPath(owner, fullPath, r.ContentLength, r.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+	if r.ContentLength < 0 && r.Body != nil {
+		if limit := e.MaxFileSize(owner, e.ownerPermissionPath(owner, fullPath)); limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+	}
+	return nil
+}
+
+// ownerPermissionPath maps an on-disk path below the owner's root back to
+// the "directory/rel" form used by the owner's rules.
+func (e *UploadPolicyEnforcer) ownerPermissionPath(owner *user.User, fullPath string) string {
+	userDir := owner.Directory
+	if strings.TrimSpace(userDir) == "" {
+		userDir = owner.Username
+	}
+	rootDir := userDir
+	if !filepath.IsAbs(rootDir) && e.config != nil {
+		rootDir = filepath.Join(userVolumeBase(e.config, owner.Volume, userDir), userDir)
+	}
+	rel, err := filepath.Rel(filepath.Clean(rootDir), filepath.Clean(fullPath))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return userDir
+	}
+	return filepath.Join(userDir, rel)
+}
+
+// MaxFileSize returns the effective single-file limit (0 = unlimited).
+func (e *UploadPolicyEnforcer) MaxFileSize(owner *user.User, permissionPath string) int64 {
+	return e.Policy(owner, permissionPath).MaxFileSize
+}
+
+// uploadPolicyPath matches the "/dir/rel" form used by the permission checker.
+func uploadPolicyPath(permissionPath string) string {
+	return "/" + strings.Trim(filepath.ToSlash(permissionPath), "/")
+}
+
+func (e *UploadPolicyEnforcer) countDirEntries(dir string) int {
+	entries, err := e.storage.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		if isSkippedArchiveName(entry.Name()) {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// UploadPolicyStatus maps a policy violation to an HTTP status and violation
+// code: 413 for size, 415 for file type and 409 for the per-directory limit.
+func UploadPolicyStatus(err error) (int, string, bool) {
+	var violation *user.UploadPolicyViolation
+	if !errors.As(err, &violation) {
+		return 0, "", false
+	}
+	switch violation.Code {
+	case user.UploadPolicyFileTooLarge:
+		return http.StatusRequestEntityTooLarge, violation.Code, true
+	case user.UploadPolicyFileTypeNotAllowed:
+		return http.StatusUnsupportedMediaType, violation.Code, true
+	default:
+		return http.StatusConflict, violation.Code, true
+	}
+}
+
+// WriteUploadPolicyError writes a plain-text policy error with the violation
+// code in the X-Warehouse-Upload-Policy header. It reports false when err is
+// not a policy violation.
+func WriteUploadPolicyError(w http.ResponseWriter, err error) bool {
+	status, code, ok := UploadPolicyStatus(err)
+	if !ok {
+		return false
+	}
+	w.Header().Set("X-Warehouse-Upload-Policy", code)
+	http.Error(w, err.Error(), status)
+	return true
+}
@@ -19,11 +19,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 	"github.com/yeying-community/warehouse/internal/domain/permission"
 	"github.com/yeying-community/warehouse/internal/domain/quota"
+	"github.com/yeying-community/warehouse/internal/domain/share"
 	"github.com/yeying-community/warehouse/internal/domain/user"
-	"github.com/yeying-community/warehouse/internal/infrastructure/atomicfile"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	webdavfs "github.com/yeying-community/warehouse/internal/infrastructure/webdav"
 	"go.uber.org/zap"
 )
@@ -34,6 +36,8 @@ var (
 	ErrUploadSessionInvalid   = errors.New("invalid upload session")
 	ErrUploadSessionTooLarge  = errors.New("upload exceeds size limit")
 	ErrUploadSessionChecksum  = errors.New("upload session checksum mismatch")
+	ErrUploadSessionExists    = errors.New("upload session already exists")
+	ErrUploadSessionConflict  = errors.New("upload target conflicts with an existing entry")
 )
 
 const (
@@ -43,14 +47,24 @@ const (
 
 	UploadSessionScopeWebDAV = "webdav"
 	UploadSessionScopeShare  = "share"
+	// UploadSessionScopePublicShare anonymous uploads into an upload-only public share.
+	UploadSessionScopePublicShare = "public_share"
 
 	DefaultUploadChunkSize int64 = 8 * 1024 * 1024
 	MaxUploadChunkSize     int64 = 64 * 1024 * 1024
 	MaxUploadObjectSize    int64 = 10 * 1024 * 1024 * 1024
 	UploadSessionTTL             = 24 * time.Hour
+
+	// Variable-part sessions accept client-sized chunks (e.g. Nextcloud chunking v2)
+	// and are assembled in part-number order on completion.
+	MaxUploadVariablePartSize int64 = 1024 * 1024 * 1024
+	MaxUploadPartNumber             = 10000
+	maxUploadSessionIDLength        = 128
 )
 
 type UploadSessionCreateInput struct {
+	// ID optionally pins the session id; it must be unused and URL-safe.
+	ID           string
 	Path         string
 	ShareID      string
 	ResourceID   string
@@ -59,6 +73,19 @@ type UploadSessionCreateInput struct {
 	FileName     string
 	ContentType  string
 	LastModified int64
+	// VariableParts lets every part have its own size. Size may then be 0 when
+	// the client does not announce the total length up front.
+	VariableParts bool
+	// ShareToken targets an upload-only public share; the file lands below
+	// the share root as FileName, renamed on collisions, and Path is ignored.
+	ShareToken string
+}
+
+// UploadSessionCompleteOptions carries client-provided metadata for Complete.
+type UploadSessionCompleteOptions struct {
+	// Size is the expected final size; 0 keeps the size declared at creation.
+	Size    int64
+	ModTime time.Time
 }
 
 type UploadSessionPart struct {
@@ -79,11 +106,13 @@ type UploadSession struct {
 	TargetFullPath string                    `json:"targetFullPath"`
 	ShareID        string                    `json:"shareId,omitempty"`
 	ResourceID     string                    `json:"resourceId,omitempty"`
+	ShareToken     string                    `json:"shareToken,omitempty"`
 	Size           int64                     `json:"size"`
 	ChunkSize      int64                     `json:"chunkSize"`
 	FileName       string                    `json:"fileName"`
 	ContentType    string                    `json:"contentType,omitempty"`
 	LastModified   int64                     `json:"lastModified,omitempty"`
+	VariableParts  bool                      `json:"variableParts,omitempty"`
 	Status         string                    `json:"status"`
 	CreatedAt      time.Time                 `json:"createdAt"`
 	UpdatedAt      time.Time                 `json:"updatedAt"`
@@ -96,6 +125,8 @@ type UploadSessionTarget struct {
 	FullPath   string
 	TargetPath string
 	Operation  permission.Operation
+	// PublicShare is set for uploads through an upload-only public share.
+	PublicShare *share.ShareItem
 }
 
 type UploadSessionService struct {
@@ -105,7 +136,10 @@ type UploadSessionService struct {
 	userRepo             user.Repository
 	shareUserService     *ShareUserService
 	sharedResourceAccess *SharedResourceAccessService
+	shareService         *ShareService
 	mutationRecorder     MutationRecorder
+	uploadPolicy         *UploadPolicyEnforcer
+	storage              storage.Backend
 	logger               *zap.Logger
 	locks                sync.Map
 }
@@ -117,6 +151,27 @@ func (s *UploadSessionService) SetSharedResourceAccess(access *SharedResourceAcc
 	}
 }
 
+// SetShareService enables anonymous uploads through upload-only public shares.
+func (s *UploadSessionService) SetShareService(shareService *ShareService) {
+	if s != nil {
+		s.shareService = shareService
+	}
+}
+
+// SetUploadPolicyEnforcer enables upload policy checks on session create and complete.
+func (s *UploadSessionService) SetUploadPolicyEnforcer(enforcer *UploadPolicyEnforcer) {
+	if s != nil {
+		s.uploadPolicy = enforcer
+	}
+}
+
+// SetStorage moves staged parts and assembled files onto another backend.
+func (s *UploadSessionService) SetStorage(backend storage.Backend) {
+	if s != nil && backend != nil {
+		s.storage = backend
+	}
+}
+
 func NewUploadSessionService(
 	cfg *config.Config,
 	permissionCheck permission.Checker,
@@ -136,6 +191,7 @@ func NewUploadSessionService(
 		userRepo:         userRepo,
 		shareUserService: shareUserService,
 		mutationRecorder: mutationRecorder,
+		storage:          storage.NewLocal(),
 		logger:           logger,
 	}
 }
@@ -148,21 +204,55 @@ func (s *UploadSessionService) Create(ctx context.Context, uploader *user.User,
 		return nil, ErrUploadSessionTooLarge
 	}
 	chunkSize := input.ChunkSize
+	maxChunkSize := MaxUploadChunkSize
+	if input.VariableParts {
+		maxChunkSize = MaxUploadVariablePartSize
+		if chunkSize <= 0 {
+			chunkSize = MaxUploadVariablePartSize
+		}
+	}
 	if chunkSize <= 0 {
 		chunkSize = DefaultUploadChunkSize
 	}
-	if chunkSize > MaxUploadChunkSize {
+	if chunkSize > maxChunkSize {
 		return nil, fmt.Errorf("%w: chunk size exceeds limit", ErrUploadSessionTooLarge)
 	}
+	id := strings.TrimSpace(input.ID)
+	if id == "" {
+		id = uuid.NewString()
+	} else if !isValidUploadSessionID(id) {
+		return nil, fmt.Errorf("%w: invalid session id", ErrUploadSessionInvalid)
+	} else {
+		unlock := s.lockSession(id)
+		defer unlock()
+		if _, err := s.loadActiveSession(id); err == nil {
+			return nil, ErrUploadSessionExists
+		} else if !errors.Is(err, ErrUploadSessionNotFound) {
+			return nil, err
+		}
+		_ = s.storage.RemoveAll(s.sessionDir(id))
+	}
 	target, scope, err := s.resolveTarget(ctx, uploader, input)
 	if err != nil {
 		return nil, err
 	}
-	if err := os.MkdirAll(filepath.Dir(target.FullPath), 0o755); err != nil {
+	declaredSize := input.Size
+	if input.VariableParts && declaredSize == 0 {
+		declaredSize = -1
+	}
+	if err := s.checkUploadPolicy(target, declaredSize, input.ContentType); err != nil {
+		return nil, err
+	}
+	if target.PublicShare != nil {
+		if err := checkShareUploadLimits(target.PublicShare, filepath.Base(target.FullPath), declaredSize); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.storage.MkdirAll(filepath.Dir(target.FullPath), 0o755); err != nil {
 		return nil, err
 	}
 	if s.quotaService != nil && target.Owner != nil {
-		oldSize, err := getExistingFileSize(target.FullPath)
+		oldSize, err := getExistingFileSize(s.storage, target.FullPath)
 		if err != nil {
 			return nil, err
 		}
@@ -175,7 +265,7 @@ func (s *UploadSessionService) Create(ctx context.Context, uploader *user.User,
 	}
 	now := time.Now()
 	session := &UploadSession{
-		ID:             uuid.NewString(),
+		ID:             id,
 		UploaderUserID: uploader.ID,
 		OwnerUserID:    target.Owner.ID,
 		OwnerUsername:  target.Owner.Username,
@@ -183,11 +273,13 @@ func (s *UploadSessionService) Create(ctx context.Context, uploader *user.User,
 		TargetPath:     target.TargetPath,
 		TargetFullPath: target.FullPath,
 		ShareID:        strings.TrimSpace(input.ShareID),
+		ShareToken:     strings.TrimSpace(input.ShareToken),
 		Size:           input.Size,
 		ChunkSize:      chunkSize,
 		FileName:       strings.TrimSpace(input.FileName),
 		ContentType:    strings.TrimSpace(input.ContentType),
 		LastModified:   input.LastModified,
+		VariableParts:  input.VariableParts,
 		Status:         UploadSessionStatusActive,
 		CreatedAt:      now,
 		UpdatedAt:      now,
@@ -198,7 +290,7 @@ func (s *UploadSessionService) Create(ctx context.Context, uploader *user.User,
 		session.FileName = path.Base(session.TargetPath)
 	}
 	if err := s.saveSession(session); err != nil {
-		_ = os.RemoveAll(s.sessionDir(session.ID))
+		_ = s.storage.RemoveAll(s.sessionDir(session.ID))
 		return nil, err
 	}
 	return session, nil
@@ -233,45 +325,56 @@ func (s *UploadSessionService) UploadPart(ctx context.Context, uploader *user.Us
 		return nil, UploadSessionPart{}, err
 	}
 	maxPartNumber := expectedPartCount(session.Size, session.ChunkSize)
+	if session.VariableParts {
+		maxPartNumber = MaxUploadPartNumber
+	}
 	if partNumber > maxPartNumber {
 		return nil, UploadSessionPart{}, ErrUploadSessionInvalid
 	}
 	partPath := s.partPath(session.ID, partNumber)
 	tmpPath := partPath + ".tmp"
-	if err := os.MkdirAll(filepath.Dir(partPath), 0o700); err != nil {
+	if err := s.storage.MkdirAll(filepath.Dir(partPath), 0o700); err != nil {
 		return nil, UploadSessionPart{}, err
 	}
-	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	file, err := s.storage.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
 	if err != nil {
 		return nil, UploadSessionPart{}, err
 	}
 	md5Hash := md5.New()
 	sha256Hash := sha256.New()
 	limit := session.ChunkSize
-	if limit <= 0 || limit > MaxUploadChunkSize {
-		limit = MaxUploadChunkSize
+	maxLimit := MaxUploadChunkSize
+	if session.VariableParts {
+		maxLimit = MaxUploadVariablePartSize
+	}
+	if limit <= 0 || limit > maxLimit {
+		limit = maxLimit
 	}
 	size, copyErr := io.Copy(io.MultiWriter(file, md5Hash, sha256Hash), io.LimitReader(src, limit+1))
 	closeErr := file.Close()
 	if copyErr != nil {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, UploadSessionPart{}, copyErr
 	}
 	if closeErr != nil {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, UploadSessionPart{}, closeErr
 	}
 	if size > limit {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
+		return nil, UploadSessionPart{}, ErrUploadSessionTooLarge
+	}
+	if session.VariableParts && uploadedSizeWithPart(session, partNumber, size) > MaxUploadObjectSize {
+		_ = s.storage.Remove(tmpPath)
 		return nil, UploadSessionPart{}, ErrUploadSessionTooLarge
 	}
 	checksumSHA256 := hex.EncodeToString(sha256Hash.Sum(nil))
 	if expectedChecksumSHA256 != "" && expectedChecksumSHA256 != checksumSHA256 {
-		_ = os.Remove(tmpPath)
+		_ = s.storage.Remove(tmpPath)
 		return nil, UploadSessionPart{}, ErrUploadSessionChecksum
 	}
-	if err := os.Rename(tmpPath, partPath); err != nil {
-		_ = os.Remove(tmpPath)
+	if err := s.storage.Rename(tmpPath, partPath); err != nil {
+		_ = s.storage.Remove(tmpPath)
 		return nil, UploadSessionPart{}, err
 	}
 	now := time.Now()
@@ -294,20 +397,58 @@ func (s *UploadSessionService) UploadPart(ctx context.Context, uploader *user.Us
 }
 
 func (s *UploadSessionService) Complete(ctx context.Context, uploader *user.User, id string) (*UploadSession, error) {
+	return s.CompleteWithOptions(ctx, uploader, id, UploadSessionCompleteOptions{})
+}
+
+// CompleteWithOptions assembles the staged parts into the target file.
+func (s *UploadSessionService) CompleteWithOptions(ctx context.Context, uploader *user.User, id string, opts UploadSessionCompleteOptions) (*UploadSession, error) {
 	unlock := s.lockSession(id)
 	defer unlock()
 	session, err := s.loadActiveSession(id)
 	if err != nil {
 		return nil, err
 	}
+	if session.ShareToken != "" {
+		// Serialize completions into one drop folder so renames on collision
+		// cannot pick the same free name twice.
+		unlockShare := s.lockSession(publicShareUploaderPrefix + session.ShareToken)
+		defer unlockShare()
+	}
 	target, err := s.authorizeSession(ctx, uploader, session)
 	if err != nil {
 		return nil, err
 	}
+	if opts.Size < 0 || opts.Size > MaxUploadObjectSize {
+		return nil, ErrUploadSessionTooLarge
+	}
+	if opts.Size > 0 {
+		if !session.VariableParts && opts.Size != session.Size {
+			return nil, fmt.Errorf("%w: size mismatch", ErrUploadSessionInvalid)
+		}
+		session.Size = opts.Size
+	}
 	if err := s.validateCompleteParts(session); err != nil {
 		return nil, err
 	}
-	oldSize, err := getExistingFileSize(target.FullPath)
+	if err := s.checkUploadPolicy(target, session.Size, session.ContentType); err != nil {
+		return nil, err
+	}
+	written := false
+	if target.PublicShare != nil {
+		if err := checkShareUploadLimits(target.PublicShare, filepath.Base(target.FullPath), session.Size); err != nil {
+			return nil, err
+		}
+		release, err := s.shareService.ReserveUpload(ctx, target.PublicShare, session.Size)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			if !written {
+				release()
+			}
+		}()
+	}
+	oldSize, err := getExistingFileSize(s.storage, target.FullPath)
 	if err != nil {
 		return nil, err
 	}
@@ -325,21 +466,21 @@ func (s *UploadSessionService) Complete(ctx context.Context, uploader *user.User
 			return nil, err
 		}
 	}
-	if err := os.MkdirAll(filepath.Dir(target.FullPath), 0o755); err != nil {
+	if err := s.storage.MkdirAll(filepath.Dir(target.FullPath), 0o755); err != nil {
 		if reserved {
 			_ = s.userRepo.(quotaReserveRepository).ReleaseUsedSpaceDelta(ctx, target.Owner.Username, delta)
 		}
 		return nil, err
 	}
-	out, err := atomicfile.Open(target.FullPath, 0o644)
+	out, err := s.storage.CreateAtomic(target.FullPath, 0o644)
 	if err != nil {
 		if reserved {
 			_ = s.userRepo.(quotaReserveRepository).ReleaseUsedSpaceDelta(ctx, target.Owner.Username, delta)
 		}
 		return nil, err
 	}
-	for partNumber := 1; partNumber <= expectedPartCount(session.Size, session.ChunkSize); partNumber++ {
-		if err := copyPartFile(out, s.partPath(session.ID, partNumber)); err != nil {
+	for _, partNumber := range completePartNumbers(session) {
+		if err := copyPartFile(s.storage, out, s.partPath(session.ID, partNumber)); err != nil {
 			out.Abort()
 			if reserved {
 				_ = s.userRepo.(quotaReserveRepository).ReleaseUsedSpaceDelta(ctx, target.Owner.Username, delta)
@@ -353,6 +494,12 @@ func (s *UploadSessionService) Complete(ctx context.Context, uploader *user.User
 		}
 		return nil, err
 	}
+	written = true
+	if !opts.ModTime.IsZero() {
+		if err := s.storage.Chtimes(target.FullPath, opts.ModTime, opts.ModTime); err != nil && s.logger != nil {
+			s.logger.Warn("failed to apply upload modification time", zap.String("path", target.FullPath), zap.Error(err))
+		}
+	}
 	if reserved {
 		_ = target.Owner.UpdateUsedSpace(reservedUsed)
 	} else if s.userRepo != nil && delta != 0 {
@@ -375,9 +522,12 @@ func (s *UploadSessionService) Complete(ctx context.Context, uploader *user.User
 	if err := s.saveSession(session); err != nil {
 		return nil, err
 	}
-	if err := os.RemoveAll(s.sessionDir(session.ID)); err != nil && s.logger != nil {
+	if err := s.storage.RemoveAll(s.sessionDir(session.ID)); err != nil && s.logger != nil {
 		s.logger.Warn("failed to remove completed upload session", zap.String("id", session.ID), zap.Error(err))
 	}
+	if target.PublicShare != nil {
+		s.shareService.RecordUpload(ctx, target.PublicShare, target.Owner, target.TargetPath, session.Size)
+	}
 	return session, nil
 }
 
@@ -394,11 +544,11 @@ func (s *UploadSessionService) Abort(ctx context.Context, uploader *user.User, i
 	session.Status = UploadSessionStatusAborted
 	session.UpdatedAt = time.Now()
 	_ = s.saveSession(session)
-	return os.RemoveAll(s.sessionDir(id))
+	return s.storage.RemoveAll(s.sessionDir(id))
 }
 
 func (s *UploadSessionService) CleanupExpired(ctx context.Context, now time.Time) (int, error) {
-	entries, err := os.ReadDir(s.sessionRoot())
+	entries, err := s.storage.ReadDir(s.sessionRoot())
 	if os.IsNotExist(err) {
 		return 0, nil
 	}
@@ -426,7 +576,7 @@ func (s *UploadSessionService) CleanupExpired(ctx context.Context, now time.Time
 		if session.Status == UploadSessionStatusActive && now.Before(session.ExpiresAt) {
 			continue
 		}
-		if err := os.RemoveAll(s.sessionDir(entry.Name())); err != nil {
+		if err := s.storage.RemoveAll(s.sessionDir(entry.Name())); err != nil {
 			return cleaned, err
 		}
 		cleaned++
@@ -455,6 +605,7 @@ func (s *UploadSessionService) authorizeSession(ctx context.Context, uploader *u
 		Path:       session.TargetPath,
 		ShareID:    session.ShareID,
 		ResourceID: session.ResourceID,
+		ShareToken: session.ShareToken,
 		Size:       session.Size,
 		ChunkSize:  session.ChunkSize,
 		FileName:   session.FileName,
@@ -469,6 +620,10 @@ func (s *UploadSessionService) authorizeSession(ctx context.Context, uploader *u
 }
 
 func (s *UploadSessionService) resolveTarget(ctx context.Context, uploader *user.User, input UploadSessionCreateInput) (*UploadSessionTarget, string, error) {
+	if strings.TrimSpace(input.ShareToken) != "" {
+		target, err := s.resolvePublicShareTarget(ctx, uploader, input)
+		return target, UploadSessionScopePublicShare, err
+	}
 	if strings.TrimSpace(input.ResourceID) != "" {
 		target, err := s.resolveSharedResourceTarget(ctx, uploader, input)
 		return target, UploadSessionScopeShare, err
@@ -493,20 +648,24 @@ func (s *UploadSessionService) resolveSharedResourceTarget(ctx context.Context,
 	if err != nil {
 		return nil, err
 	}
-	targetPath, err := normalizeUploadTargetPath(input.Path)
+	targetPath, err := normalizeUploadTargetPath(NamePolicy(s.config), input.Path)
 	if err != nil {
 		return nil, err
 	}
-	fullPath := filepath.Clean(filepath.Join(s.config.WebDAV.Directory, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/")), filepath.FromSlash(strings.TrimPrefix(targetPath, "/"))))
-	root := filepath.Clean(filepath.Join(s.config.WebDAV.Directory, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
+	ownerBase := userVolumeBase(s.config, owner.Volume, owner.Directory)
+	fullPath := filepath.Clean(filepath.Join(ownerBase, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/")), filepath.FromSlash(strings.TrimPrefix(targetPath, "/"))))
+	root := filepath.Clean(filepath.Join(ownerBase, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
 	if fullPath != root && !isPathWithin(root, fullPath) {
 		return nil, ErrUploadSessionInvalid
 	}
+	fullPath = NamePolicy(s.config).WithFS(s.storage).Resolve(root, fullPath)
 	op := permission.OperationCreate
-	if _, err := os.Stat(fullPath); err == nil {
+	if _, err := s.storage.Stat(fullPath); err == nil {
 		op = permission.OperationWrite
 	} else if !os.IsNotExist(err) {
 		return nil, err
+	} else if err := NamePolicy(s.config).WithFS(s.storage).CheckCollision(fullPath); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadSessionConflict, err)
 	}
 	if _, err := s.sharedResourceAccess.Authorize(ctx, strings.TrimSpace(input.ResourceID), uploader.ID, permission.MapOperationToPermission(op), time.Now()); err != nil {
 		return nil, ErrUploadSessionForbidden
@@ -515,7 +674,7 @@ func (s *UploadSessionService) resolveSharedResourceTarget(ctx context.Context,
 }
 
 func (s *UploadSessionService) resolveWebDAVTarget(ctx context.Context, uploader *user.User, rawPath string) (*UploadSessionTarget, error) {
-	targetPath, err := normalizeUploadTargetPath(rawPath)
+	targetPath, err := normalizeUploadTargetPath(NamePolicy(s.config), rawPath)
 	if err != nil {
 		return nil, err
 	}
@@ -528,11 +687,14 @@ func (s *UploadSessionService) resolveWebDAVTarget(ctx context.Context, uploader
 	if !isPathWithin(userRoot, fullPath) {
 		return nil, ErrUploadSessionInvalid
 	}
+	fullPath = NamePolicy(s.config).WithFS(s.storage).Resolve(userRoot, fullPath)
 	op := permission.OperationCreate
-	if _, err := os.Stat(fullPath); err == nil {
+	if _, err := s.storage.Stat(fullPath); err == nil {
 		op = permission.OperationWrite
 	} else if err != nil && !os.IsNotExist(err) {
 		return nil, err
+	} else if err := NamePolicy(s.config).WithFS(s.storage).CheckCollision(fullPath); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUploadSessionConflict, err)
 	}
 	if err := enforceAppScope(ctx, s.config, targetPath, requiredActionForUploadOperation(op)); err != nil {
 		return nil, err
@@ -561,7 +723,7 @@ func (s *UploadSessionService) resolveShareTarget(ctx context.Context, uploader
 	if err != nil {
 		return nil, err
 	}
-	targetPath, err := normalizeUploadTargetPath(input.Path)
+	targetPath, err := normalizeUploadTargetPath(NamePolicy(s.config), input.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -569,7 +731,7 @@ func (s *UploadSessionService) resolveShareTarget(ctx context.Context, uploader
 		return nil, ErrUploadSessionInvalid
 	}
 	op := permission.OperationCreate
-	if _, err := os.Stat(fullPath); err == nil {
+	if _, err := s.storage.Stat(fullPath); err == nil {
 		op = permission.OperationWrite
 	} else if err != nil && !os.IsNotExist(err) {
 		return nil, err
@@ -586,10 +748,34 @@ func (s *UploadSessionService) resolveShareTarget(ctx context.Context, uploader
 	return &UploadSessionTarget{Owner: owner, FullPath: fullPath, TargetPath: targetPath, Operation: op}, nil
 }
 
+// resolvePublicShareTarget places an anonymous upload below the root of an
+// upload-only share. Only the synthetic uploader of that share may use it,
+// and the owner is charged for the file.
+func (s *UploadSessionService) resolvePublicShareTarget(ctx context.Context, uploader *user.User, input UploadSessionCreateInput) (*UploadSessionTarget, error) {
+	token := strings.TrimSpace(input.ShareToken)
+	if s.shareService == nil || uploader.ID != publicShareUploaderPrefix+token {
+		return nil, ErrUploadSessionForbidden
+	}
+	item, owner, fullPath, err := s.shareService.resolveUploadTarget(ctx, token, input.FileName)
+	if err != nil {
+		return nil, err
+	}
+	return &UploadSessionTarget{
+		Owner:       owner,
+		FullPath:    fullPath,
+		TargetPath:  "/" + filepath.Base(fullPath),
+		Operation:   permission.OperationCreate,
+		PublicShare: item,
+	}, nil
+}
+
 func (s *UploadSessionService) validateCompleteParts(session *UploadSession) error {
 	if session == nil || session.Status != UploadSessionStatusActive {
 		return ErrUploadSessionNotFound
 	}
+	if session.VariableParts {
+		return validateVariableParts(session)
+	}
 	expected := expectedPartCount(session.Size, session.ChunkSize)
 	if expected == 0 {
 		return nil
@@ -617,13 +803,70 @@ func (s *UploadSessionService) validateCompleteParts(session *UploadSession) err
 	return nil
 }
 
+// validateVariableParts follows Nextcloud semantics: parts are concatenated in
+// part-number order and the result must match the announced size, if any.
+func validateVariableParts(session *UploadSession) error {
+	var total int64
+	for _, part := range session.Parts {
+		total += part.Size
+	}
+	if total > MaxUploadObjectSize {
+		return ErrUploadSessionTooLarge
+	}
+	if session.Size > 0 && total != session.Size {
+		return fmt.Errorf("%w: size mismatch", ErrUploadSessionInvalid)
+	}
+	session.Size = total
+	return nil
+}
+
+func completePartNumbers(session *UploadSession) []int {
+	if session.VariableParts {
+		numbers := make([]int, 0, len(session.Parts))
+		for _, part := range UploadSessionParts(session) {
+			numbers = append(numbers, part.PartNumber)
+		}
+		return numbers
+	}
+	expected := expectedPartCount(session.Size, session.ChunkSize)
+	numbers := make([]int, 0, expected)
+	for partNumber := 1; partNumber <= expected; partNumber++ {
+		numbers = append(numbers, partNumber)
+	}
+	return numbers
+}
+
+func uploadedSizeWithPart(session *UploadSession, partNumber int, size int64) int64 {
+	total := size
+	for number, part := range session.Parts {
+		if number != partNumber {
+			total += part.Size
+		}
+	}
+	return total
+}
+
+func isValidUploadSessionID(id string) bool {
+	if id == "" || len(id) > maxUploadSessionIDLength || id == "." || id == ".." {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
 func (s *UploadSessionService) loadActiveSession(id string) (*UploadSession, error) {
 	session, err := s.loadSession(id)
 	if err != nil {
 		return nil, err
 	}
 	if session.Status != UploadSessionStatusActive || time.Now().After(session.ExpiresAt) {
-		_ = os.RemoveAll(s.sessionDir(id))
+		_ = s.storage.RemoveAll(s.sessionDir(id))
 		return nil, ErrUploadSessionNotFound
 	}
 	return session, nil
@@ -634,7 +877,7 @@ func (s *UploadSessionService) loadSession(id string) (*UploadSession, error) {
 	if id == "" || strings.Contains(id, "/") || strings.Contains(id, string(filepath.Separator)) {
 		return nil, ErrUploadSessionNotFound
 	}
-	data, err := os.ReadFile(s.sessionFile(id))
+	data, err := storage.ReadFile(s.storage, s.sessionFile(id))
 	if os.IsNotExist(err) {
 		return nil, ErrUploadSessionNotFound
 	}
@@ -656,18 +899,14 @@ func (s *UploadSessionService) saveSession(session *UploadSession) error {
 		return ErrUploadSessionInvalid
 	}
 	dir := s.sessionDir(session.ID)
-	if err := os.MkdirAll(filepath.Join(dir, "parts"), 0o700); err != nil {
+	if err := s.storage.MkdirAll(filepath.Join(dir, "parts"), 0o700); err != nil {
 		return err
 	}
 	data, err := json.MarshalIndent(session, "", "  ")
 	if err != nil {
 		return err
 	}
-	tmp := filepath.Join(dir, "session.json.tmp")
-	if err := os.WriteFile(tmp, data, 0o600); err != nil {
-		return err
-	}
-	return os.Rename(tmp, s.sessionFile(session.ID))
+	return storage.WriteFile(s.storage, s.sessionFile(session.ID), data, 0o600)
 }
 
 func (s *UploadSessionService) lockSession(id string) func() {
@@ -698,15 +937,16 @@ func (s *UploadSessionService) partPath(id string, partNumber int) string {
 }
 
 func (s *UploadSessionService) userRootDir(u *user.User) string {
-	userDir := s.userPermissionRoot(u)
-	if filepath.IsAbs(userDir) {
-		return filepath.Clean(userDir)
-	}
-	root := "/data"
-	if s != nil && s.config != nil && strings.TrimSpace(s.config.WebDAV.Directory) != "" {
-		root = s.config.WebDAV.Directory
+	return ownerUserRootDir(s.config, u)
+}
+
+// checkUploadPolicy applies the target owner's upload policy; files land in
+// the owner's space, so share uploads follow the owner's rules.
+func (s *UploadSessionService) checkUploadPolicy(target *UploadSessionTarget, size int64, contentType string) error {
+	if s.uploadPolicy == nil || target == nil {
+		return nil
 	}
-	return filepath.Clean(filepath.Join(root, userDir))
+	return s.uploadPolicy.CheckOwnerPath(target.Owner, target.FullPath, size, contentType)
 }
 
 func (s *UploadSessionService) userPermissionRoot(u *user.User) string {
@@ -719,12 +959,12 @@ func (s *UploadSessionService) userPermissionRoot(u *user.User) string {
 	return u.Username
 }
 
-func normalizeUploadTargetPath(raw string) (string, error) {
+func normalizeUploadTargetPath(names pathname.Policy, raw string) (string, error) {
 	raw = strings.TrimSpace(strings.ReplaceAll(raw, "\\", "/"))
 	if raw == "" {
 		return "", fmt.Errorf("%w: path is required", ErrUploadSessionInvalid)
 	}
-	clean := path.Clean("/" + strings.TrimLeft(raw, "/"))
+	clean := path.Clean("/" + strings.TrimLeft(names.Normalize(raw), "/"))
 	if clean == "." || clean == "/" || strings.HasPrefix(clean, "/..") {
 		return "", ErrUploadSessionInvalid
 	}
@@ -774,8 +1014,8 @@ func normalizeUploadChecksumSHA256(value string) (string, error) {
 	return value, nil
 }
 
-func copyPartFile(dst io.Writer, partPath string) error {
-	file, err := os.Open(partPath)
+func copyPartFile(b storage.Backend, dst io.Writer, partPath string) error {
+	file, err := b.Open(partPath)
 	if err != nil {
 		return err
 	}
@@ -241,6 +241,75 @@ func TestUploadSessionServiceRejectsPartChecksumMismatch(t *testing.T) {
 	}
 }
 
+func TestUploadSessionServiceVariablePartsAssembleInOrder(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	owner := user.NewUser("alice", "alice")
+	owner.ID = "user-alice"
+	if err := os.MkdirAll(filepath.Join(root, "alice", "personal"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	svc := NewUploadSessionService(uploadSessionTestConfig(root), nil, nil, nil, nil, noopMutationRecorder{}, zap.NewNop())
+
+	session, err := svc.Create(context.Background(), owner, UploadSessionCreateInput{ID: "nc-transfer", Path: "/personal/file.txt", VariableParts: true})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if session.ID != "nc-transfer" {
+		t.Fatalf("expected pinned session id, got %q", session.ID)
+	}
+	if _, err := svc.Create(context.Background(), owner, UploadSessionCreateInput{ID: "nc-transfer", Path: "/personal/file.txt", VariableParts: true}); !errors.Is(err, ErrUploadSessionExists) {
+		t.Fatalf("expected ErrUploadSessionExists, got %v", err)
+	}
+	for partNumber, content := range map[int]string{10: "world", 2: "hello ", 3: "big "} {
+		if _, _, err := svc.UploadPart(context.Background(), owner, session.ID, partNumber, "", strings.NewReader(content)); err != nil {
+			t.Fatalf("UploadPart %d: %v", partNumber, err)
+		}
+	}
+	if _, err := svc.CompleteWithOptions(context.Background(), owner, session.ID, UploadSessionCompleteOptions{Size: 99}); !errors.Is(err, ErrUploadSessionInvalid) {
+		t.Fatalf("expected size mismatch, got %v", err)
+	}
+	modTime := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	completed, err := svc.CompleteWithOptions(context.Background(), owner, session.ID, UploadSessionCompleteOptions{Size: 15, ModTime: modTime})
+	if err != nil {
+		t.Fatalf("CompleteWithOptions: %v", err)
+	}
+	if completed.Size != 15 {
+		t.Fatalf("expected size 15, got %d", completed.Size)
+	}
+	fullPath := filepath.Join(root, "alice", "personal", "file.txt")
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello big world" {
+		t.Fatalf("unexpected content %q", string(data))
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(modTime) {
+		t.Fatalf("expected mtime %v, got %v", modTime, info.ModTime())
+	}
+}
+
+func TestUploadSessionServiceRejectsUnsafeSessionID(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	owner := user.NewUser("alice", "alice")
+	owner.ID = "user-alice"
+	svc := NewUploadSessionService(uploadSessionTestConfig(root), nil, nil, nil, nil, noopMutationRecorder{}, zap.NewNop())
+
+	for _, id := range []string{"../escape", "a/b", ".."} {
+		if _, err := svc.Create(context.Background(), owner, UploadSessionCreateInput{ID: id, Path: "/personal/file.txt", VariableParts: true}); !errors.Is(err, ErrUploadSessionInvalid) {
+			t.Fatalf("id %q: expected ErrUploadSessionInvalid, got %v", id, err)
+		}
+	}
+}
+
 func uploadSessionTestConfig(root string) *config.Config {
 	cfg := config.DefaultConfig()
 	cfg.WebDAV.Directory = root
@@ -0,0 +1,997 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/domain/permission"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	webdavfs "github.com/yeying-community/warehouse/internal/infrastructure/webdav"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrVersionNotFound  = errors.New("version not found")
+	ErrVersionForbidden = errors.New("version access forbidden")
+	ErrVersionInvalid   = errors.New("invalid version request")
+)
+
+const (
+	// VersionsVirtualRoot is the read-only WebDAV tree that exposes versions.
+	VersionsVirtualRoot = "/.versions"
+	// VersionCurrent names the live file in diffs.
+	VersionCurrent = "current"
+
+	VersionSourceWebDAV  = "webdav"
+	VersionSourceAsset   = "asset"
+	VersionSourceRestore = "restore"
+	VersionSourceExtract = "extract"
+
+	// versionStoreDir holds the versions of a volume's users next to their
+	// directories.
+	versionStoreDir      = ".warehouse-versions"
+	versionIndexFile     = "index.json"
+	versionPendingSuffix = ".pending"
+	// versionTreeTTL bounds how stale the cached /.versions listing may get
+	// when versions change on another node.
+	versionTreeTTL = 30 * time.Second
+)
+
+// FileVersion is one retained previous content of a file.
+type FileVersion struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	// ModTime is the modification time of the replaced content.
+	ModTime time.Time `json:"modTime"`
+	// CreatedAt is when the content was replaced and retained.
+	CreatedAt time.Time `json:"createdAt"`
+	Source    string    `json:"source,omitempty"`
+}
+
+// VersionDiff compares the metadata of two versions (or a version and the live file).
+type VersionDiff struct {
+	Path        string       `json:"path"`
+	From        *FileVersion `json:"from"`
+	To          *FileVersion `json:"to"`
+	SizeDelta   int64        `json:"sizeDelta"`
+	SameContent bool         `json:"sameContent"`
+}
+
+// versionIndex is persisted per file; versions are kept oldest first.
+type versionIndex struct {
+	Path     string         `json:"path"`
+	Versions []*FileVersion `json:"versions"`
+}
+
+// VersionService retains previous file contents on overwrite and serves them
+// back. Versions live under .warehouse-versions/<user id> on the volume of
+// the owner's directory, one folder per file path, and are charged to the
+// owner's quota.
+type VersionService struct {
+	config           *config.Config
+	permissionCheck  permission.Checker
+	userRepo         user.Repository
+	mutationRecorder MutationRecorder
+	logger           *zap.Logger
+	storage          storage.Backend
+	locks            sync.Map
+	trees            sync.Map
+	now              func() time.Time
+}
+
+func NewVersionService(
+	cfg *config.Config,
+	permissionCheck permission.Checker,
+	userRepo user.Repository,
+	mutationRecorder MutationRecorder,
+	logger *zap.Logger,
+) *VersionService {
+	if mutationRecorder == nil {
+		mutationRecorder = noopMutationRecorder{}
+	}
+	return &VersionService{
+		config:           cfg,
+		permissionCheck:  permissionCheck,
+		userRepo:         userRepo,
+		mutationRecorder: mutationRecorder,
+		logger:           logger,
+		storage:          storage.NewLocal(),
+		now:              time.Now,
+	}
+}
+
+// SetStorage sets the backend holding user files and retained versions.
+func (s *VersionService) SetStorage(backend storage.Backend) {
+	if s != nil && backend != nil {
+		s.storage = backend
+	}
+}
+
+// Enabled reports whether overwrites retain versions.
+func (s *VersionService) Enabled() bool {
+	return s != nil && s.config != nil && s.config.Versions.Enabled
+}
+
+// Capture retains the current content of fullPath before it is overwritten.
+// It returns nil when versioning is off, the file does not exist, or the
+// content equals the latest retained version.
+func (s *VersionService) Capture(ctx context.Context, u *user.User, fullPath, source string) (*FileVersion, error) {
+	pending, err := s.Prepare(ctx, u, fullPath, source)
+	if err != nil || pending == nil {
+		return nil, err
+	}
+	return s.Finish(ctx, pending, true)
+}
+
+// PendingVersion is the content of a file staged before an overwrite. It
+// becomes a version only once Finish confirms the overwrite.
+type PendingVersion struct {
+	user     *user.User
+	fullPath string
+	relPath  string
+	dir      string
+	staged   string
+	info     os.FileInfo
+	version  *FileVersion
+}
+
+// Prepare stages the current content of fullPath before a write that may
+// replace it. It returns nil when versioning is off or there is nothing to
+// retain; the caller must pass a non-nil result to Finish.
+func (s *VersionService) Prepare(ctx context.Context, u *user.User, fullPath, source string) (*PendingVersion, error) {
+	if !s.Enabled() || u == nil {
+		return nil, nil
+	}
+	return s.prepare(u, fullPath, source)
+}
+
+func (s *VersionService) prepare(u *user.User, fullPath, source string) (*PendingVersion, error) {
+	info, err := s.storage.Lstat(fullPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() || webdavfs.IsIgnoredName(info.Name()) {
+		return nil, nil
+	}
+	relPath, ok := s.relPath(u, fullPath)
+	if !ok {
+		return nil, nil
+	}
+
+	dir := s.fileDir(u, relPath)
+	if err := s.storage.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	version := &FileVersion{
+		ID:      uuid.NewString(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Source:  source,
+	}
+	staged := filepath.Join(dir, version.ID+versionPendingSuffix)
+	sum, err := s.copyContent(fullPath, staged)
+	if err != nil {
+		return nil, fmt.Errorf("retain version: %w", err)
+	}
+	version.SHA256 = sum
+	return &PendingVersion{
+		user:     u,
+		fullPath: fullPath,
+		relPath:  relPath,
+		dir:      dir,
+		staged:   staged,
+		info:     info,
+		version:  version,
+	}, nil
+}
+
+// Finish settles a staged version after the write. The content is retained
+// when the write succeeded, or when it failed after already changing the
+// file; otherwise the staged copy is dropped. A nil pending is a no-op.
+// Failures are logged here, since the write they follow cannot be undone.
+func (s *VersionService) Finish(ctx context.Context, pending *PendingVersion, succeeded bool) (*FileVersion, error) {
+	if pending == nil {
+		return nil, nil
+	}
+	if !succeeded && !s.fileChanged(pending) {
+		_ = s.storage.Remove(pending.staged)
+		return nil, nil
+	}
+	version, err := s.commit(ctx, pending)
+	if err != nil && s.logger != nil {
+		// The write itself has already happened; callers only lose the version.
+		s.logger.Error("failed to retain file version",
+			zap.String("username", pending.user.Username),
+			zap.String("path", pending.relPath),
+			zap.Error(err))
+	}
+	return version, err
+}
+
+// fileChanged reports whether the live file differs from the staged snapshot.
+func (s *VersionService) fileChanged(p *PendingVersion) bool {
+	info, err := s.storage.Lstat(p.fullPath)
+	if err != nil {
+		return true
+	}
+	return info.Size() != p.info.Size() || !info.ModTime().Equal(p.info.ModTime())
+}
+
+func (s *VersionService) commit(ctx context.Context, pending *PendingVersion) (*FileVersion, error) {
+	u, dir, version := pending.user, pending.dir, pending.version
+	version.CreatedAt = s.now()
+	blobPath := filepath.Join(dir, version.ID)
+
+	unlock := s.lock(dir)
+	defer unlock()
+	if err := s.storage.Rename(pending.staged, blobPath); err != nil {
+		_ = s.storage.Remove(pending.staged)
+		return nil, fmt.Errorf("retain version: %w", err)
+	}
+	index, err := s.loadIndex(dir)
+	if err != nil {
+		_ = s.storage.Remove(blobPath)
+		return nil, err
+	}
+	if n := len(index.Versions); n > 0 && index.Versions[n-1].SHA256 == version.SHA256 {
+		// Identical to the latest version, e.g. a failed overwrite retried.
+		_ = s.storage.Remove(blobPath)
+		return nil, nil
+	}
+	index.Path = pending.relPath
+	index.Versions = append(index.Versions, version)
+	pruned := s.prune(index)
+	if err := s.saveIndex(dir, index); err != nil {
+		_ = s.storage.Remove(blobPath)
+		return nil, err
+	}
+	s.invalidateTree(u)
+
+	delta := version.Size
+	if err := s.mutationRecorder.UpsertFile(ctx, blobPath); err != nil {
+		return nil, fmt.Errorf("record version event: %w", err)
+	}
+	for _, old := range pruned {
+		delta -= old.Size
+		if err := s.removeBlob(ctx, dir, old.ID); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.mutationRecorder.UpsertFile(ctx, filepath.Join(dir, versionIndexFile)); err != nil {
+		return nil, fmt.Errorf("record version index event: %w", err)
+	}
+	s.applyUsedSpaceDelta(ctx, u, delta)
+	if s.logger != nil {
+		s.logger.Info("file version retained",
+			zap.String("username", u.Username),
+			zap.String("path", pending.relPath),
+			zap.String("version_id", version.ID),
+			zap.Int64("size", version.Size),
+			zap.Int("pruned_count", len(pruned)))
+	}
+	return version, nil
+}
+
+// MovePath carries the version history of a moved file, or of every file
+// below a moved directory, over to the new path. History already kept for
+// the destination is merged, oldest first.
+func (s *VersionService) MovePath(ctx context.Context, u *user.User, fromFullPath, toFullPath string, isDir bool) error {
+	if s == nil || s.config == nil || u == nil {
+		return nil
+	}
+	fromRel, ok := s.relPath(u, fromFullPath)
+	if !ok {
+		return nil
+	}
+	toRel, ok := s.relPath(u, toFullPath)
+	if !ok {
+		return s.RemovePath(ctx, u, fromFullPath, isDir)
+	}
+	if fromRel == toRel {
+		return nil
+	}
+	histories, err := s.histories(u, fromRel, isDir)
+	if err != nil {
+		return err
+	}
+	defer s.invalidateTree(u)
+	for _, history := range histories {
+		newRel := toRel + strings.TrimPrefix(history.index.Path, fromRel)
+		if err := s.rekey(ctx, u, history.dir, newRel); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemovePath drops the version history of a deleted file, or of every file
+// below a deleted directory, and releases the space it was charged.
+func (s *VersionService) RemovePath(ctx context.Context, u *user.User, fullPath string, isDir bool) error {
+	if s == nil || s.config == nil || u == nil {
+		return nil
+	}
+	relPath, ok := s.relPath(u, fullPath)
+	if !ok {
+		return nil
+	}
+	histories, err := s.histories(u, relPath, isDir)
+	if err != nil {
+		return err
+	}
+	defer s.invalidateTree(u)
+	var delta int64
+	for _, history := range histories {
+		unlock := s.lock(history.dir)
+		index, err := s.loadIndex(history.dir)
+		if err == nil {
+			err = s.storage.RemoveAll(history.dir)
+		}
+		unlock()
+		if err != nil {
+			return err
+		}
+		for _, version := range index.Versions {
+			delta -= version.Size
+		}
+		if err := s.mutationRecorder.RemovePath(ctx, history.dir, true); err != nil {
+			return fmt.Errorf("record version remove event: %w", err)
+		}
+	}
+	s.applyUsedSpaceDelta(ctx, u, delta)
+	return nil
+}
+
+type versionHistory struct {
+	dir   string
+	index *versionIndex
+}
+
+// histories returns the non-empty histories of relPath, or of every file
+// below it when it is a directory.
+func (s *VersionService) histories(u *user.User, relPath string, isDir bool) ([]versionHistory, error) {
+	if !isDir {
+		dir := s.fileDir(u, relPath)
+		index, err := s.loadIndex(dir)
+		if err != nil || len(index.Versions) == 0 {
+			return nil, err
+		}
+		return []versionHistory{{dir: dir, index: index}}, nil
+	}
+	all, err := s.loadHistories(u)
+	if err != nil {
+		return nil, err
+	}
+	var matched []versionHistory
+	for _, history := range all {
+		if history.index.Path == relPath || strings.HasPrefix(history.index.Path, relPath+string(filepath.Separator)) {
+			matched = append(matched, history)
+		}
+	}
+	return matched, nil
+}
+
+// loadHistories reads every history index of the user.
+func (s *VersionService) loadHistories(u *user.User) ([]versionHistory, error) {
+	userDir := s.userDir(u)
+	entries, err := s.storage.ReadDir(userDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var histories []versionHistory
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(userDir, entry.Name())
+		index, err := s.loadIndex(dir)
+		if err != nil || index.Path == "" || len(index.Versions) == 0 {
+			continue
+		}
+		histories = append(histories, versionHistory{dir: dir, index: index})
+	}
+	return histories, nil
+}
+
+// rekey moves the history stored in oldDir to the folder of newRel.
+func (s *VersionService) rekey(ctx context.Context, u *user.User, oldDir, newRel string) error {
+	newDir := s.fileDir(u, newRel)
+	if oldDir == newDir {
+		return nil
+	}
+	unlock := s.lockPair(oldDir, newDir)
+	defer unlock()
+	index, err := s.loadIndex(oldDir)
+	if err != nil || len(index.Versions) == 0 {
+		return err
+	}
+	target, err := s.loadIndex(newDir)
+	if err != nil {
+		return err
+	}
+
+	if len(target.Versions) == 0 {
+		if err := s.storage.RemoveAll(newDir); err != nil {
+			return err
+		}
+		if err := s.storage.Rename(oldDir, newDir); err != nil {
+			return err
+		}
+		index.Path = newRel
+		if err := s.saveIndex(newDir, index); err != nil {
+			return err
+		}
+		if err := s.mutationRecorder.MovePath(ctx, oldDir, newDir, true); err != nil {
+			return fmt.Errorf("record version move event: %w", err)
+		}
+		if err := s.mutationRecorder.UpsertFile(ctx, filepath.Join(newDir, versionIndexFile)); err != nil {
+			return fmt.Errorf("record version index event: %w", err)
+		}
+		return nil
+	}
+
+	for _, version := range index.Versions {
+		from, to := filepath.Join(oldDir, version.ID), filepath.Join(newDir, version.ID)
+		if err := s.storage.Rename(from, to); err != nil {
+			return err
+		}
+		if err := s.mutationRecorder.MovePath(ctx, from, to, false); err != nil {
+			return fmt.Errorf("record version move event: %w", err)
+		}
+	}
+	target.Path = newRel
+	target.Versions = append(target.Versions, index.Versions...)
+	sort.SliceStable(target.Versions, func(i, j int) bool {
+		return target.Versions[i].CreatedAt.Before(target.Versions[j].CreatedAt)
+	})
+	pruned := s.prune(target)
+	if err := s.saveIndex(newDir, target); err != nil {
+		return err
+	}
+	var delta int64
+	for _, old := range pruned {
+		delta -= old.Size
+		if err := s.removeBlob(ctx, newDir, old.ID); err != nil {
+			return err
+		}
+	}
+	if err := s.storage.RemoveAll(oldDir); err != nil {
+		return err
+	}
+	if err := s.mutationRecorder.RemovePath(ctx, oldDir, true); err != nil {
+		return fmt.Errorf("record version remove event: %w", err)
+	}
+	if err := s.mutationRecorder.UpsertFile(ctx, filepath.Join(newDir, versionIndexFile)); err != nil {
+		return fmt.Errorf("record version index event: %w", err)
+	}
+	s.applyUsedSpaceDelta(ctx, u, delta)
+	return nil
+}
+
+// List returns the versions of rawPath (relative to the user root), newest first.
+func (s *VersionService) List(ctx context.Context, u *user.User, rawPath string) ([]*FileVersion, error) {
+	relPath, err := s.authorize(ctx, u, rawPath, permission.OperationRead, "read")
+	if err != nil {
+		return nil, err
+	}
+	dir := s.fileDir(u, relPath)
+	unlock := s.lock(dir)
+	index, err := s.loadIndex(dir)
+	if err == nil {
+		err = s.pruneExpired(ctx, u, dir, index)
+	}
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]*FileVersion, 0, len(index.Versions))
+	for i := len(index.Versions) - 1; i >= 0; i-- {
+		versions = append(versions, index.Versions[i])
+	}
+	return versions, nil
+}
+
+// Open opens the stored content of one version.
+func (s *VersionService) Open(ctx context.Context, u *user.User, rawPath, id string) (storage.File, *FileVersion, error) {
+	relPath, err := s.authorize(ctx, u, rawPath, permission.OperationRead, "read")
+	if err != nil {
+		return nil, nil, err
+	}
+	dir := s.fileDir(u, relPath)
+	version, err := s.find(dir, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := s.storage.Open(filepath.Join(dir, version.ID))
+	if os.IsNotExist(err) {
+		return nil, nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, version, nil
+}
+
+// Diff compares the metadata of version fromID with toID, which defaults to
+// the live file.
+func (s *VersionService) Diff(ctx context.Context, u *user.User, rawPath, fromID, toID string) (*VersionDiff, error) {
+	relPath, err := s.authorize(ctx, u, rawPath, permission.OperationRead, "read")
+	if err != nil {
+		return nil, err
+	}
+	dir := s.fileDir(u, relPath)
+	from, err := s.resolveDiffSide(u, dir, relPath, fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.resolveDiffSide(u, dir, relPath, toID)
+	if err != nil {
+		return nil, err
+	}
+	return &VersionDiff{
+		Path:        "/" + filepath.ToSlash(relPath),
+		From:        from,
+		To:          to,
+		SizeDelta:   to.Size - from.Size,
+		SameContent: from.SHA256 == to.SHA256,
+	}, nil
+}
+
+// Restore replaces the live file with version id. The replaced content is
+// retained as a new version first, so a restore can itself be undone.
+func (s *VersionService) Restore(ctx context.Context, u *user.User, rawPath, id string) (*FileVersion, error) {
+	relPath, err := s.authorize(ctx, u, rawPath, permission.OperationWrite, "update", "create")
+	if err != nil {
+		return nil, err
+	}
+	dir := s.fileDir(u, relPath)
+	version, err := s.find(dir, id)
+	if err != nil {
+		return nil, err
+	}
+	fullPath := filepath.Join(s.userRootDir(u), relPath)
+	if info, err := s.storage.Lstat(fullPath); err == nil && !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%w: target is not a file", ErrVersionInvalid)
+	}
+	pending, err := s.prepare(u, fullPath, VersionSourceRestore)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := s.Finish(ctx, pending, true)
+	if err != nil {
+		return nil, err
+	}
+	var oldSize int64
+	if info, err := s.storage.Stat(fullPath); err == nil {
+		oldSize = info.Size()
+	}
+
+	src, err := s.storage.Open(filepath.Join(dir, version.ID))
+	if os.IsNotExist(err) {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if err := s.storage.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		return nil, err
+	}
+	if err := storage.WriteAll(s.storage, fullPath, src, 0o644); err != nil {
+		return nil, err
+	}
+	if err := s.mutationRecorder.UpsertFile(ctx, fullPath); err != nil {
+		return nil, fmt.Errorf("record restore event: %w", err)
+	}
+	s.applyUsedSpaceDelta(ctx, u, version.Size-oldSize)
+	if s.logger != nil {
+		s.logger.Info("file version restored",
+			zap.String("username", u.Username),
+			zap.String("path", relPath),
+			zap.String("version_id", version.ID))
+	}
+	return previous, nil
+}
+
+// HasVersions reports whether the user has any retained history, without
+// reading the indexes; it decides whether / lists the /.versions folder.
+func (s *VersionService) HasVersions(u *user.User) bool {
+	if s == nil || s.config == nil || u == nil {
+		return false
+	}
+	dir, err := s.storage.Open(s.userDir(u))
+	if err != nil {
+		return false
+	}
+	defer dir.Close()
+	entries, _ := dir.Readdir(1)
+	return len(entries) > 0
+}
+
+// VirtualFiles builds the read-only /.versions tree for WebDAV: each file
+// with versions becomes a folder holding one entry per version. The indexes
+// are cached per user and refreshed after changes or versionTreeTTL.
+func (s *VersionService) VirtualFiles(ctx context.Context, u *user.User) []webdavfs.VirtualFile {
+	if s == nil || u == nil {
+		return nil
+	}
+	histories := s.tree(u)
+	cutoff := s.ageCutoff()
+	var files []webdavfs.VirtualFile
+	for _, history := range histories {
+		index := history.index
+		if !s.allowed(ctx, u, index.Path, permission.OperationRead) {
+			continue
+		}
+		base := path.Join(VersionsVirtualRoot, filepath.ToSlash(index.Path))
+		for _, version := range index.Versions {
+			if !cutoff.IsZero() && version.CreatedAt.Before(cutoff) {
+				continue
+			}
+			files = append(files, webdavfs.VirtualFile{
+				Path:       path.Join(base, versionEntryName(index.Path, version)),
+				SourcePath: filepath.Join(history.dir, version.ID),
+				Size:       version.Size,
+				ModTime:    version.CreatedAt,
+			})
+		}
+	}
+	return files
+}
+
+// versionTree is a cached snapshot of one user's history indexes.
+type versionTree struct {
+	builtAt   time.Time
+	histories []versionHistory
+}
+
+func (s *VersionService) tree(u *user.User) []versionHistory {
+	now := s.now()
+	if value, ok := s.trees.Load(u.ID); ok {
+		cached := value.(*versionTree)
+		if now.Sub(cached.builtAt) < versionTreeTTL {
+			return cached.histories
+		}
+	}
+	histories, err := s.loadHistories(u)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Warn("failed to list file versions", zap.String("username", u.Username), zap.Error(err))
+		}
+		return nil
+	}
+	s.trees.Store(u.ID, &versionTree{builtAt: now, histories: histories})
+	return histories
+}
+
+func (s *VersionService) invalidateTree(u *user.User) {
+	s.trees.Delete(u.ID)
+}
+
+// versionEntryName is "<replaced at>_<short id>_<name>", sortable by time.
+func versionEntryName(relPath string, version *FileVersion) string {
+	shortID := version.ID
+	if len(shortID) > 8 {
+		shortID = shortID[:8]
+	}
+	return fmt.Sprintf("%s_%s_%s", version.CreatedAt.UTC().Format("20060102T150405Z"), shortID, filepath.Base(relPath))
+}
+
+// VersionStorageUsage sums the retained version bytes of one user for quota
+// recalculation.
+func VersionStorageUsage(cfg *config.Config, u *user.User) (int64, error) {
+	if cfg == nil || u == nil {
+		return 0, nil
+	}
+	var total int64
+	err := filepath.WalkDir(filepath.Join(versionRoot(cfg, u), u.ID), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || d.Name() == versionIndexFile || strings.HasSuffix(d.Name(), ".tmp") || strings.HasSuffix(d.Name(), versionPendingSuffix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+func (s *VersionService) resolveDiffSide(u *user.User, dir, relPath, id string) (*FileVersion, error) {
+	id = strings.TrimSpace(id)
+	if id != "" && id != VersionCurrent {
+		return s.find(dir, id)
+	}
+	fullPath := filepath.Join(s.userRootDir(u), relPath)
+	info, err := s.storage.Stat(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	sum, err := s.fileSHA256(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return &FileVersion{ID: VersionCurrent, Size: info.Size(), SHA256: sum, ModTime: info.ModTime()}, nil
+}
+
+func (s *VersionService) find(dir, id string) (*FileVersion, error) {
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, fmt.Errorf("%w: version id is required", ErrVersionInvalid)
+	}
+	index, err := s.loadIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range index.Versions {
+		if version.ID == id {
+			return version, nil
+		}
+	}
+	return nil, ErrVersionNotFound
+}
+
+// prune drops versions beyond max_count or older than max_age and returns them.
+func (s *VersionService) prune(index *versionIndex) []*FileVersion {
+	var pruned []*FileVersion
+	if cutoff := s.ageCutoff(); !cutoff.IsZero() {
+		kept := index.Versions[:0]
+		for _, version := range index.Versions {
+			if version.CreatedAt.Before(cutoff) {
+				pruned = append(pruned, version)
+				continue
+			}
+			kept = append(kept, version)
+		}
+		index.Versions = kept
+	}
+	if maxCount := s.config.Versions.MaxCount; maxCount > 0 && len(index.Versions) > maxCount {
+		excess := len(index.Versions) - maxCount
+		pruned = append(pruned, index.Versions[:excess]...)
+		index.Versions = append([]*FileVersion(nil), index.Versions[excess:]...)
+	}
+	return pruned
+}
+
+func (s *VersionService) pruneExpired(ctx context.Context, u *user.User, dir string, index *versionIndex) error {
+	pruned := s.prune(index)
+	if len(pruned) == 0 {
+		return nil
+	}
+	if err := s.saveIndex(dir, index); err != nil {
+		return err
+	}
+	s.invalidateTree(u)
+	var delta int64
+	for _, old := range pruned {
+		delta -= old.Size
+		if err := s.removeBlob(ctx, dir, old.ID); err != nil {
+			return err
+		}
+	}
+	if err := s.mutationRecorder.UpsertFile(ctx, filepath.Join(dir, versionIndexFile)); err != nil {
+		return fmt.Errorf("record version index event: %w", err)
+	}
+	s.applyUsedSpaceDelta(ctx, u, delta)
+	return nil
+}
+
+func (s *VersionService) ageCutoff() time.Time {
+	if s.config == nil || s.config.Versions.MaxAge <= 0 {
+		return time.Time{}
+	}
+	return s.now().Add(-s.config.Versions.MaxAge)
+}
+
+func (s *VersionService) removeBlob(ctx context.Context, dir, id string) error {
+	blobPath := filepath.Join(dir, id)
+	if err := s.storage.Remove(blobPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := s.mutationRecorder.RemovePath(ctx, blobPath, false); err != nil {
+		return fmt.Errorf("record version remove event: %w", err)
+	}
+	return nil
+}
+
+// authorize validates rawPath and checks app scope and path rules, returning
+// the path relative to the user root.
+func (s *VersionService) authorize(ctx context.Context, u *user.User, rawPath string, op permission.Operation, actions ...string) (string, error) {
+	if u == nil {
+		return "", ErrVersionForbidden
+	}
+	raw := strings.TrimSpace(strings.ReplaceAll(rawPath, "\\", "/"))
+	if raw == "" {
+		return "", fmt.Errorf("%w: path is required", ErrVersionInvalid)
+	}
+	clean := path.Clean("/" + strings.TrimLeft(NamePolicy(s.config).Normalize(raw), "/"))
+	if clean == "/" || strings.HasPrefix(clean, "/..") {
+		return "", ErrVersionInvalid
+	}
+	if err := enforceAppScope(ctx, s.config, clean, actions...); err != nil {
+		return "", err
+	}
+	relPath := filepath.FromSlash(strings.TrimPrefix(clean, "/"))
+	if !s.allowed(ctx, u, relPath, op) {
+		return "", ErrVersionForbidden
+	}
+	return relPath, nil
+}
+
+func (s *VersionService) allowed(ctx context.Context, u *user.User, relPath string, op permission.Operation) bool {
+	if s.permissionCheck == nil {
+		return true
+	}
+	return s.permissionCheck.Check(ctx, u, filepath.Join(userPermissionRoot(u), relPath), op) == nil
+}
+
+func (s *VersionService) relPath(u *user.User, fullPath string) (string, bool) {
+	rel, err := filepath.Rel(s.userRootDir(u), filepath.Clean(fullPath))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+func (s *VersionService) userRootDir(u *user.User) string {
+	userDir := userPermissionRoot(u)
+	if filepath.IsAbs(userDir) {
+		return filepath.Clean(userDir)
+	}
+	return filepath.Clean(filepath.Join(userVolumeBase(s.config, u.Volume, userDir), userDir))
+}
+
+func (s *VersionService) userDir(u *user.User) string {
+	return filepath.Join(versionRoot(s.config, u), u.ID)
+}
+
+// fileDir keys the per-file folder by a hash of the path so deep or long
+// names never hit path length limits.
+func (s *VersionService) fileDir(u *user.User, relPath string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(relPath)))
+	return filepath.Join(s.userDir(u), hex.EncodeToString(sum[:]))
+}
+
+func (s *VersionService) lock(dir string) func() {
+	value, _ := s.locks.LoadOrStore(dir, &sync.Mutex{})
+	mu := value.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// lockPair locks two history folders in a fixed order.
+func (s *VersionService) lockPair(a, b string) func() {
+	if b < a {
+		a, b = b, a
+	}
+	unlockA := s.lock(a)
+	unlockB := s.lock(b)
+	return func() {
+		unlockB()
+		unlockA()
+	}
+}
+
+func (s *VersionService) loadIndex(dir string) (*versionIndex, error) {
+	data, err := storage.ReadFile(s.storage, filepath.Join(dir, versionIndexFile))
+	if os.IsNotExist(err) {
+		return &versionIndex{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var index versionIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(index.Versions, func(i, j int) bool {
+		return index.Versions[i].CreatedAt.Before(index.Versions[j].CreatedAt)
+	})
+	return &index, nil
+}
+
+func (s *VersionService) saveIndex(dir string, index *versionIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return storage.WriteFile(s.storage, filepath.Join(dir, versionIndexFile), data, 0o600)
+}
+
+func (s *VersionService) applyUsedSpaceDelta(ctx context.Context, u *user.User, delta int64) {
+	if s.userRepo == nil || u == nil || delta == 0 {
+		return
+	}
+	used, err := s.userRepo.UpdateUsedSpaceDelta(ctx, u.Username, delta)
+	if err != nil {
+		if s.logger != nil {
+			s.logger.Error("failed to update version used space delta",
+				zap.String("username", u.Username),
+				zap.Int64("delta", delta),
+				zap.Error(err))
+		}
+		return
+	}
+	_ = u.UpdateUsedSpace(used)
+}
+
+// versionRoot is the version store on the volume holding u's directory, so
+// retained copies stay on the same filesystem as the files they come from.
+func versionRoot(cfg *config.Config, u *user.User) string {
+	return filepath.Join(userVolumeBase(cfg, u.Volume, userPermissionRoot(u)), versionStoreDir)
+}
+
+func userPermissionRoot(u *user.User) string {
+	if u == nil {
+		return ""
+	}
+	if strings.TrimSpace(u.Directory) != "" {
+		return u.Directory
+	}
+	return u.Username
+}
+
+// copyContent copies src to dst atomically and returns the SHA-256 of the
+// copied bytes.
+func (s *VersionService) copyContent(src, dst string) (string, error) {
+	in, err := s.storage.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := s.storage.CreateAtomic(dst, 0o600)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		out.Abort()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (s *VersionService) fileSHA256(fullPath string) (string, error) {
+	f, err := s.storage.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func newVersionTestService(t *testing.T, maxCount int) (*VersionService, *testUserRepo, *user.User, string) {
+	t.Helper()
+	rootDir := t.TempDir()
+	cfg := &config.Config{
+		WebDAV:   config.WebDAVConfig{Directory: rootDir},
+		Versions: config.VersionsConfig{Enabled: true, MaxCount: maxCount},
+	}
+	userRepo := newTestUserRepo()
+	u := user.NewUser("alice", "alice")
+	u.Permissions = user.FullPermissions()
+	if err := userRepo.Save(context.Background(), u); err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+	svc := NewVersionService(cfg, allowPermissionChecker{}, userRepo, nil, zap.NewNop())
+	return svc, userRepo, u, filepath.Join(rootDir, "alice")
+}
+
+// overwriteWithVersion mimics a PUT: capture the current content, then replace it.
+func overwriteWithVersion(t *testing.T, svc *VersionService, u *user.User, fullPath, content string) *FileVersion {
+	t.Helper()
+	version, err := svc.Capture(context.Background(), u, fullPath, VersionSourceWebDAV)
+	if err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	writeRecoverTestFile(t, fullPath, content)
+	return version
+}
+
+func TestVersionCaptureDedupesAndPrunesByCount(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, userRepo, u, userRoot := newVersionTestService(t, 2)
+	fullPath := filepath.Join(userRoot, "docs", "a.txt")
+
+	if v := overwriteWithVersion(t, svc, u, fullPath, "v1"); v != nil {
+		t.Fatalf("creating a file must not retain a version, got %+v", v)
+	}
+	if v := overwriteWithVersion(t, svc, u, fullPath, "v2"); v == nil || v.Size != 2 {
+		t.Fatalf("expected v1 to be retained, got %+v", v)
+	}
+	// A retried overwrite must not retain the same content twice.
+	if v, err := svc.Capture(ctx, u, fullPath, VersionSourceWebDAV); err != nil || v == nil {
+		t.Fatalf("expected v2 to be retained, got %+v err=%v", v, err)
+	}
+	if v := overwriteWithVersion(t, svc, u, fullPath, "v3"); v != nil {
+		t.Fatalf("expected no version for identical content, got %+v", v)
+	}
+	overwriteWithVersion(t, svc, u, fullPath, "v4-longer")
+
+	versions, err := svc.List(ctx, u, "/docs/a.txt")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions after pruning, got %d", len(versions))
+	}
+	if got := readVersionContent(t, svc, u, "/docs/a.txt", versions[0].ID); got != "v3" {
+		t.Fatalf("newest version content = %q", got)
+	}
+	if got := readVersionContent(t, svc, u, "/docs/a.txt", versions[1].ID); got != "v2" {
+		t.Fatalf("oldest kept version content = %q", got)
+	}
+
+	stored, _ := userRepo.FindByUsername(ctx, "alice")
+	if stored.UsedSpace != 4 {
+		t.Fatalf("expected 4 bytes of versions charged to quota, got %d", stored.UsedSpace)
+	}
+	usage, err := VersionStorageUsage(svc.config, u)
+	if err != nil || usage != 4 {
+		t.Fatalf("version storage usage = %d, err=%v", usage, err)
+	}
+}
+
+func TestVersionDiffAndRestore(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, _, u, userRoot := newVersionTestService(t, 10)
+	fullPath := filepath.Join(userRoot, "a.txt")
+	writeRecoverTestFile(t, fullPath, "old")
+	old := overwriteWithVersion(t, svc, u, fullPath, "newer")
+
+	diff, err := svc.Diff(ctx, u, "/a.txt", old.ID, "")
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if diff.To.ID != VersionCurrent || diff.SizeDelta != 2 || diff.SameContent {
+		t.Fatalf("unexpected diff: %+v", diff)
+	}
+
+	previous, err := svc.Restore(ctx, u, "/a.txt", old.ID)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if got := readRecoverTestFile(t, fullPath); got != "old" {
+		t.Fatalf("restored content = %q", got)
+	}
+	if previous == nil || previous.Source != VersionSourceRestore {
+		t.Fatalf("restore must retain the replaced content, got %+v", previous)
+	}
+	if got := readVersionContent(t, svc, u, "/a.txt", previous.ID); got != "newer" {
+		t.Fatalf("retained content = %q", got)
+	}
+
+	if _, err := svc.Restore(ctx, u, "/a.txt", "missing"); !errors.Is(err, ErrVersionNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestVersionListDropsExpiredAndVirtualFilesNameEntries(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, _, u, userRoot := newVersionTestService(t, 10)
+	svc.config.Versions.MaxAge = time.Hour
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	svc.now = func() time.Time { return now.Add(-2 * time.Hour) }
+	fullPath := filepath.Join(userRoot, "docs", "a.txt")
+	writeRecoverTestFile(t, fullPath, "v1")
+	overwriteWithVersion(t, svc, u, fullPath, "v2")
+	svc.now = func() time.Time { return now }
+	kept := overwriteWithVersion(t, svc, u, fullPath, "v3")
+
+	versions, err := svc.List(ctx, u, "docs/a.txt")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(versions) != 1 || versions[0].ID != kept.ID {
+		t.Fatalf("expected only the recent version, got %+v", versions)
+	}
+
+	files := svc.VirtualFiles(ctx, u)
+	if len(files) != 1 {
+		t.Fatalf("expected one virtual file, got %+v", files)
+	}
+	want := "/.versions/docs/a.txt/20260102T030405Z_" + kept.ID[:8] + "_a.txt"
+	if files[0].Path != want || files[0].Size != 2 {
+		t.Fatalf("virtual file = %+v, want path %s", files[0], want)
+	}
+}
+
+func readVersionContent(t *testing.T, svc *VersionService, u *user.User, rawPath, id string) string {
+	t.Helper()
+	f, _, err := svc.Open(context.Background(), u, rawPath, id)
+	if err != nil {
+		t.Fatalf("open version %s: %v", id, err)
+	}
+	defer f.Close()
+	var b strings.Builder
+	if _, err := io.Copy(&b, f); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestVersionHistoryFollowsMoveAndDelete(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, userRepo, u, userRoot := newVersionTestService(t, 10)
+	fullPath := filepath.Join(userRoot, "docs", "a.txt")
+	writeRecoverTestFile(t, fullPath, "v1")
+	overwriteWithVersion(t, svc, u, fullPath, "v2")
+	if files := svc.VirtualFiles(ctx, u); len(files) != 1 {
+		t.Fatalf("expected one virtual file, got %+v", files)
+	}
+
+	if err := svc.MovePath(ctx, u, filepath.Join(userRoot, "docs"), filepath.Join(userRoot, "archive"), true); err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if versions, err := svc.List(ctx, u, "/docs/a.txt"); err != nil || len(versions) != 0 {
+		t.Fatalf("old path must have no history, got %+v err=%v", versions, err)
+	}
+	versions, err := svc.List(ctx, u, "/archive/a.txt")
+	if err != nil || len(versions) != 1 {
+		t.Fatalf("expected history at the new path, got %+v err=%v", versions, err)
+	}
+	if got := readVersionContent(t, svc, u, "/archive/a.txt", versions[0].ID); got != "v1" {
+		t.Fatalf("moved version content = %q", got)
+	}
+	if files := svc.VirtualFiles(ctx, u); len(files) != 1 || !strings.HasPrefix(files[0].Path, "/.versions/archive/a.txt/") {
+		t.Fatalf("virtual tree must follow the move, got %+v", files)
+	}
+
+	if err := svc.RemovePath(ctx, u, filepath.Join(userRoot, "archive", "a.txt"), false); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if versions, err := svc.List(ctx, u, "/archive/a.txt"); err != nil || len(versions) != 0 {
+		t.Fatalf("deleted file must have no history, got %+v err=%v", versions, err)
+	}
+	if stored, _ := userRepo.FindByUsername(ctx, "alice"); stored.UsedSpace != 0 {
+		t.Fatalf("removed versions must release their space, used %d", stored.UsedSpace)
+	}
+}
+
+func TestVersionFinishDropsUnchangedFailedWrite(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	svc, _, u, userRoot := newVersionTestService(t, 10)
+	fullPath := filepath.Join(userRoot, "a.txt")
+	writeRecoverTestFile(t, fullPath, "v1")
+
+	pending, err := svc.Prepare(ctx, u, fullPath, VersionSourceWebDAV)
+	if err != nil || pending == nil {
+		t.Fatalf("prepare: %+v err=%v", pending, err)
+	}
+	if v, err := svc.Finish(ctx, pending, false); err != nil || v != nil {
+		t.Fatalf("failed write without changes must not retain, got %+v err=%v", v, err)
+	}
+	if versions, _ := svc.List(ctx, u, "/a.txt"); len(versions) != 0 {
+		t.Fatalf("expected no versions, got %+v", versions)
+	}
+
+	// A write that fails after changing the file still keeps the old content.
+	pending, err = svc.Prepare(ctx, u, fullPath, VersionSourceWebDAV)
+	if err != nil {
+		t.Fatalf("prepare: %v", err)
+	}
+	writeRecoverTestFile(t, fullPath, "v1-partial")
+	if v, err := svc.Finish(ctx, pending, false); err != nil || v == nil {
+		t.Fatalf("changed file must retain, got %+v err=%v", v, err)
+	}
+}
+
+func TestWebDAVVersionsRangeWritesAndFailedPut(t *testing.T) {
+	t.Parallel()
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+	svc.config.Versions.Enabled = true
+	versions := NewVersionService(svc.config, allowPermissionChecker{}, svc.userRepo, nil, zap.NewNop())
+	svc.SetVersionService(versions)
+	seedPartialUpdateFile(t, svc, u, "a.txt", "hello world")
+
+	req := newPartialUpdateRequest(http.MethodPatch, "/dav/a.txt", "HEL", u)
+	req.Header.Set("Content-Type", PartialUpdateContentType)
+	req.Header.Set("X-Update-Range", "bytes=0-2")
+	resp := httptest.NewRecorder()
+	svc.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("patch: status %d", resp.Code)
+	}
+	list, err := versions.List(context.Background(), u, "/a.txt")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("expected the patched content to be retained, got %+v err=%v", list, err)
+	}
+
+	// A PUT refused by the lock check leaves the file and its history alone.
+	req = newPartialUpdateRequest("LOCK", "/dav/a.txt", `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`, u)
+	resp = httptest.NewRecorder()
+	svc.ServeHTTP(resp, req)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("lock: status %d", resp.Code)
+	}
+	resp = httptest.NewRecorder()
+	svc.ServeHTTP(resp, newPartialUpdateRequest(http.MethodPut, "/dav/a.txt", "replaced", u))
+	if resp.Code != http.StatusLocked {
+		t.Fatalf("expected locked PUT to fail, got %d", resp.Code)
+	}
+	if list, _ := versions.List(context.Background(), u, "/a.txt"); len(list) != 1 {
+		t.Fatalf("failed PUT must not retain a version, got %d", len(list))
+	}
+}
@@ -0,0 +1,492 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrVolumeNotFound means the named volume is not configured.
+	ErrVolumeNotFound = errors.New("storage volume not found")
+	// ErrVolumeReadOnly means the volume accepts no new data.
+	ErrVolumeReadOnly = errors.New("storage volume is read-only")
+	// ErrNoWritableVolume means every volume is read-only or full.
+	ErrNoWritableVolume = errors.New("no writable storage volume has free space")
+	// ErrVolumeMoving means the user's tree is being moved to another volume
+	// and writes are blocked until the move finishes.
+	ErrVolumeMoving = errors.New("user directory is moving to another volume")
+)
+
+// volumeMoveRetryAfter is the Retry-After hint sent while a move blocks writes.
+const volumeMoveRetryAfter = "30"
+
+// VolumeUserRepository is the part of the user repository volume placement
+// and moves need.
+type VolumeUserRepository interface {
+	FindByUsername(ctx context.Context, username string) (*user.User, error)
+	List(ctx context.Context) ([]*user.User, error)
+	UpdateVolume(ctx context.Context, username, volume string, moving bool) error
+}
+
+// VolumeService places new users on a volume and moves existing user trees
+// between volumes.
+type VolumeService struct {
+	config  *config.Config
+	volumes *storage.Volumes
+	users   VolumeUserRepository
+	logger  *zap.Logger
+	rand    func(n int) int
+	sleep   func(ctx context.Context, d time.Duration) error
+}
+
+// VolumeStatus describes one volume for operators.
+type VolumeStatus struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Capacity  int64  `json:"capacity"`
+	Weight    int    `json:"weight"`
+	ReadOnly  bool   `json:"read_only"`
+	Users     int    `json:"users"`
+	UsedSpace int64  `json:"used_space"`
+	DiskTotal int64  `json:"disk_total"`
+	DiskFree  int64  `json:"disk_free"`
+	// Available is the room left for new data: the smaller of the disk's free
+	// space and the unused part of the configured capacity.
+	Available int64 `json:"available"`
+}
+
+// VolumeMoveOptions controls one move-user run.
+type VolumeMoveOptions struct {
+	Target string
+	// Settle is how long writes stay blocked before the final copy pass, so
+	// requests that started before the block can finish.
+	Settle time.Duration
+	// DryRun only checks the move and reports its size.
+	DryRun bool
+	// KeepRecord moves the local tree without touching users.volume. Standby
+	// nodes share the database with the active node, so they must not rewrite
+	// its placement.
+	KeepRecord bool
+}
+
+// VolumeMoveReport summarizes a move-user run.
+type VolumeMoveReport struct {
+	Username string `json:"username"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	DryRun   bool   `json:"dry_run"`
+	Files    int64  `json:"files"`
+	Bytes    int64  `json:"bytes"`
+	Passes   int    `json:"passes"`
+	Copied   int64  `json:"copied"`
+}
+
+// NewVolumeService creates the volume service.
+func NewVolumeService(cfg *config.Config, users VolumeUserRepository, logger *zap.Logger) *VolumeService {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &VolumeService{
+		config:  cfg,
+		volumes: storage.VolumesFromConfig(cfg),
+		users:   users,
+		logger:  logger,
+		rand:    rng.Intn,
+		sleep:   sleepContext,
+	}
+}
+
+// Volumes returns the configured volume set.
+func (s *VolumeService) Volumes() *storage.Volumes {
+	return s.volumes
+}
+
+// Place picks a volume for a user that is about to be created and creates the
+// user directory there. With a single volume nothing is recorded.
+func (s *VolumeService) Place(ctx context.Context, u *user.User) error {
+	if s == nil || u == nil || len(s.volumes.List()) == 1 {
+		return nil
+	}
+	rel, ok := volumeUserDir(u)
+	if !ok {
+		return nil
+	}
+	if located, ok := s.volumes.Locate(rel); ok {
+		// A directory left behind by an earlier account keeps its volume.
+		u.Volume = located.Name
+		return nil
+	}
+	statuses, err := s.Status(ctx)
+	if err != nil {
+		return err
+	}
+	volume, err := s.pick(statuses)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Join(volume.Path, rel), 0o755); err != nil {
+		return fmt.Errorf("create user directory on volume %s: %w", volume.Name, err)
+	}
+	u.Volume = volume.Name
+	s.logger.Info("user placed on volume",
+		zap.String("username", u.Username),
+		zap.String("volume", volume.Name))
+	return nil
+}
+
+// Status reports every volume with its usage. Used space is the logical size
+// recorded for the users placed on it.
+func (s *VolumeService) Status(ctx context.Context) ([]VolumeStatus, error) {
+	users, err := s.users.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list users: %w", err)
+	}
+	counts := map[string]int{}
+	used := map[string]int64{}
+	for _, u := range users {
+		volume, ok := s.volumes.Get(u.Volume)
+		if !ok {
+			volume = s.volumes.Default()
+		}
+		counts[volume.Name]++
+		used[volume.Name] += u.UsedSpace
+	}
+	list := s.volumes.List()
+	statuses := make([]VolumeStatus, 0, len(list))
+	for _, volume := range list {
+		status := VolumeStatus{
+			Name:      volume.Name,
+			Path:      volume.Path,
+			Capacity:  volume.Capacity,
+			Weight:    volume.Weight,
+			ReadOnly:  volume.ReadOnly,
+			Users:     counts[volume.Name],
+			UsedSpace: used[volume.Name],
+			Available: math.MaxInt64,
+		}
+		if total, free, err := storage.DiskUsage(volume.Path); err == nil {
+			status.DiskTotal = total
+			status.DiskFree = free
+			status.Available = free
+		} else if !errors.Is(err, errors.ErrUnsupported) {
+			return nil, fmt.Errorf("stat volume %s: %w", volume.Name, err)
+		}
+		if volume.Capacity > 0 {
+			status.Available = min(status.Available, max(volume.Capacity-status.UsedSpace, 0))
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// pick applies storage.placement to the writable volumes that have room.
+func (s *VolumeService) pick(statuses []VolumeStatus) (storage.Volume, error) {
+	candidates := make([]VolumeStatus, 0, len(statuses))
+	for _, status := range statuses {
+		if !status.ReadOnly && status.Available > 0 {
+			candidates = append(candidates, status)
+		}
+	}
+	if len(candidates) == 0 {
+		return storage.Volume{}, ErrNoWritableVolume
+	}
+	chosen := candidates[0]
+	switch s.config.Storage.Placement {
+	case "weighted":
+		total := 0
+		for _, candidate := range candidates {
+			total += candidate.Weight
+		}
+		n := s.rand(total)
+		for _, candidate := range candidates {
+			if n < candidate.Weight {
+				chosen = candidate
+				break
+			}
+			n -= candidate.Weight
+		}
+	default:
+		for _, candidate := range candidates[1:] {
+			if candidate.Available > chosen.Available {
+				chosen = candidate
+			}
+		}
+	}
+	volume, _ := s.volumes.Get(chosen.Name)
+	return volume, nil
+}
+
+// MoveUser copies a user's tree to another volume while the user keeps
+// working, then blocks writes for a short final pass and switches over. Paths
+// seen by clients, shares, recycle records and replication do not change, and
+// used_space stays as it is because the content is identical.
+func (s *VolumeService) MoveUser(ctx context.Context, username string, opts VolumeMoveOptions) (*VolumeMoveReport, error) {
+	u, err := s.users.FindByUsername(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	rel, ok := volumeUserDir(u)
+	if !ok {
+		return nil, fmt.Errorf("user %s has an absolute directory and cannot be moved", u.Username)
+	}
+	source, ok := s.volumes.Locate(rel)
+	if !ok {
+		return nil, fmt.Errorf("directory of user %s not found on any volume", u.Username)
+	}
+	target, ok := s.volumes.Get(opts.Target)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrVolumeNotFound, opts.Target)
+	}
+	if target.ReadOnly {
+		return nil, fmt.Errorf("%w: %s", ErrVolumeReadOnly, target.Name)
+	}
+	report := &VolumeMoveReport{Username: u.Username, From: source.Name, To: target.Name, DryRun: opts.DryRun}
+	if source.Name == target.Name {
+		return nil, fmt.Errorf("user %s already lives on volume %s", u.Username, target.Name)
+	}
+	finalPath := filepath.Join(target.Path, rel)
+	if _, err := os.Lstat(finalPath); err == nil {
+		return nil, fmt.Errorf("%s already exists on volume %s", rel, target.Name)
+	}
+
+	sourcePath := filepath.Join(source.Path, rel)
+	files, bytes, err := treeSize(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("scan user directory: %w", err)
+	}
+	report.Files, report.Bytes = files, bytes
+	statuses, err := s.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range statuses {
+		if status.Name == target.Name && status.Available < bytes {
+			return nil, fmt.Errorf("volume %s has %d bytes available, %d needed", target.Name, status.Available, bytes)
+		}
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	staging := filepath.Join(target.Path, storage.MovingDir, rel)
+	if err := os.MkdirAll(filepath.Dir(staging), 0o755); err != nil {
+		return nil, err
+	}
+	// Two passes while the user keeps writing; the second one only picks up
+	// what changed during the first.
+	for pass := 0; pass < 2; pass++ {
+		if err := s.syncPass(ctx, report, sourcePath, staging); err != nil {
+			_ = os.RemoveAll(staging)
+			return report, err
+		}
+	}
+
+	if !opts.KeepRecord {
+		if err := s.users.UpdateVolume(ctx, u.Username, source.Name, true); err != nil {
+			_ = os.RemoveAll(staging)
+			return report, fmt.Errorf("block writes: %w", err)
+		}
+	}
+	unblock := func(volume string) {
+		if opts.KeepRecord {
+			return
+		}
+		if err := s.users.UpdateVolume(context.WithoutCancel(ctx), u.Username, volume, false); err != nil {
+			s.logger.Error("failed to unblock user after volume move",
+				zap.String("username", u.Username),
+				zap.String("volume", volume),
+				zap.Error(err))
+		}
+	}
+	fail := func(err error) (*VolumeMoveReport, error) {
+		_ = os.RemoveAll(staging)
+		unblock(source.Name)
+		return report, err
+	}
+
+	if err := s.sleep(ctx, opts.Settle); err != nil {
+		return fail(err)
+	}
+	if err := s.syncPass(ctx, report, sourcePath, staging); err != nil {
+		return fail(err)
+	}
+	stagedFiles, stagedBytes, err := treeSize(staging)
+	if err != nil {
+		return fail(err)
+	}
+	if stagedFiles != report.Files || stagedBytes != report.Bytes {
+		return fail(fmt.Errorf("copy verification failed: %d files / %d bytes staged, %d / %d expected",
+			stagedFiles, stagedBytes, report.Files, report.Bytes))
+	}
+	if err := os.MkdirAll(filepath.Dir(finalPath), 0o755); err != nil {
+		return fail(err)
+	}
+	if err := os.Rename(staging, finalPath); err != nil {
+		return fail(err)
+	}
+	if !opts.KeepRecord {
+		if err := s.users.UpdateVolume(ctx, u.Username, target.Name, true); err != nil {
+			// Both copies are identical and writes are still blocked, so put
+			// the new one back aside and keep the user where it was.
+			_ = os.Rename(finalPath, staging)
+			return fail(fmt.Errorf("record volume: %w", err))
+		}
+	}
+
+	retired := filepath.Join(source.Path, storage.MovingDir, fmt.Sprintf("%s.retired-%d", rel, time.Now().UnixNano()))
+	if err := os.MkdirAll(filepath.Dir(retired), 0o755); err == nil {
+		if err := os.Rename(sourcePath, retired); err == nil {
+			sourcePath = retired
+		}
+	}
+	s.moveVersions(u, source, target)
+	unblock(target.Name)
+	if err := os.RemoveAll(sourcePath); err != nil {
+		s.logger.Warn("failed to remove old user directory after volume move",
+			zap.String("username", u.Username),
+			zap.String("path", sourcePath),
+			zap.Error(err))
+	}
+	s.logger.Info("user moved to volume",
+		zap.String("username", u.Username),
+		zap.String("from", source.Name),
+		zap.String("to", target.Name),
+		zap.Int64("bytes", report.Bytes))
+	return report, nil
+}
+
+// moveVersions carries u's version history to the target volume; the
+// version store sits next to the user directories of each volume.
+func (s *VolumeService) moveVersions(u *user.User, source, target storage.Volume) {
+	from := filepath.Join(source.Path, versionStoreDir, u.ID)
+	if _, err := os.Lstat(from); err != nil {
+		return
+	}
+	to := filepath.Join(target.Path, versionStoreDir, u.ID)
+	err := os.MkdirAll(filepath.Dir(to), 0o755)
+	if err == nil {
+		err = storage.NewLocal().Rename(from, to)
+	}
+	if err != nil {
+		s.logger.Warn("failed to move version history after volume move",
+			zap.String("username", u.Username),
+			zap.String("path", from),
+			zap.Error(err))
+	}
+}
+
+// CheckVolumeWritable reports whether u's tree currently accepts writes.
+func CheckVolumeWritable(cfg *config.Config, u *user.User) error {
+	if u == nil {
+		return nil
+	}
+	if u.VolumeMoving {
+		return ErrVolumeMoving
+	}
+	if cfg == nil || len(cfg.Storage.Volumes) == 0 || filepath.IsAbs(u.Directory) {
+		return nil
+	}
+	if volume, ok := storage.VolumesFromConfig(cfg).Get(u.Volume); ok && volume.ReadOnly {
+		return ErrVolumeReadOnly
+	}
+	return nil
+}
+
+// WriteVolumeError writes the response for a CheckVolumeWritable error and
+// reports whether it did.
+func WriteVolumeError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrVolumeMoving):
+		w.Header().Set("Retry-After", volumeMoveRetryAfter)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, ErrVolumeReadOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		return false
+	}
+	return true
+}
+
+func (s *VolumeService) syncPass(ctx context.Context, report *VolumeMoveReport, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stats, err := storage.SyncTree(src, dst)
+	report.Passes++
+	report.Copied += stats.Copied
+	if err != nil {
+		return fmt.Errorf("copy pass %d: %w", report.Passes, err)
+	}
+	report.Files, report.Bytes = stats.Files, stats.Bytes
+	return nil
+}
+
+// userVolumeBase returns the directory userDir is joined to: webdav.directory
+// unless additional volumes are configured and the user lives on one of them.
+func userVolumeBase(cfg *config.Config, volume, userDir string) string {
+	if len(cfg.Storage.Volumes) == 0 || filepath.IsAbs(userDir) {
+		return cfg.WebDAV.Directory
+	}
+	return storage.VolumesFromConfig(cfg).UserBase(volume, userDir)
+}
+
+func volumeUserDir(u *user.User) (string, bool) {
+	dir := strings.TrimSpace(u.Directory)
+	if dir == "" {
+		dir = strings.TrimSpace(u.Username)
+	}
+	if dir == "" || filepath.IsAbs(dir) {
+		return "", false
+	}
+	rel := filepath.Clean(filepath.FromSlash(dir))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+func treeSize(root string) (files, bytes int64, err error) {
+	err = filepath.WalkDir(root, func(_ string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			files++
+			bytes += info.Size()
+		}
+		return nil
+	})
+	return files, bytes, err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
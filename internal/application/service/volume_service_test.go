@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+)
+
+type volumeTestUserRepo struct {
+	users   map[string]*user.User
+	updates []string
+}
+
+func (r *volumeTestUserRepo) FindByUsername(_ context.Context, username string) (*user.User, error) {
+	u, ok := r.users[username]
+	if !ok {
+		return nil, user.ErrUserNotFound
+	}
+	clone := *u
+	return &clone, nil
+}
+
+func (r *volumeTestUserRepo) List(context.Context) ([]*user.User, error) {
+	list := make([]*user.User, 0, len(r.users))
+	for _, u := range r.users {
+		list = append(list, u)
+	}
+	return list, nil
+}
+
+func (r *volumeTestUserRepo) UpdateVolume(_ context.Context, username, volume string, moving bool) error {
+	u, ok := r.users[username]
+	if !ok {
+		return user.ErrUserNotFound
+	}
+	u.Volume = volume
+	u.VolumeMoving = moving
+	state := volume
+	if moving {
+		state += "+moving"
+	}
+	r.updates = append(r.updates, state)
+	return nil
+}
+
+func newVolumeTestService(t *testing.T, volumes ...config.VolumeConfig) (*VolumeService, *volumeTestUserRepo, *config.Config) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = t.TempDir()
+	cfg.Storage.Volumes = volumes
+	repo := &volumeTestUserRepo{users: map[string]*user.User{}}
+	svc := NewVolumeService(cfg, repo, nil)
+	svc.sleep = func(context.Context, time.Duration) error { return nil }
+	return svc, repo, cfg
+}
+
+func TestVolumeServicePlaceMostFree(t *testing.T) {
+	t.Parallel()
+
+	extra := t.TempDir()
+	svc, _, _ := newVolumeTestService(t,
+		config.VolumeConfig{Name: storage.DefaultVolume, Capacity: 10},
+		config.VolumeConfig{Name: "hdd1", Path: extra, Capacity: 1 << 30},
+	)
+
+	u := user.NewUser("alice", "alice")
+	if err := svc.Place(context.Background(), u); err != nil {
+		t.Fatalf("place: %v", err)
+	}
+	if u.Volume != "hdd1" {
+		t.Fatalf("volume = %q, want hdd1", u.Volume)
+	}
+	if info, err := os.Stat(filepath.Join(extra, "alice")); err != nil || !info.IsDir() {
+		t.Fatalf("user directory not created on hdd1: %v", err)
+	}
+}
+
+func TestVolumeServicePlaceWeightedSkipsReadOnly(t *testing.T) {
+	t.Parallel()
+
+	svc, _, cfg := newVolumeTestService(t,
+		config.VolumeConfig{Name: "hdd1", Path: t.TempDir(), Weight: 1},
+		config.VolumeConfig{Name: "hdd2", Path: t.TempDir(), Weight: 5},
+		config.VolumeConfig{Name: "archive", Path: t.TempDir(), Weight: 100, ReadOnly: true},
+	)
+	cfg.Storage.Placement = "weighted"
+	var total int
+	svc.rand = func(n int) int {
+		total = n
+		return n - 1
+	}
+
+	u := user.NewUser("bob", "bob")
+	if err := svc.Place(context.Background(), u); err != nil {
+		t.Fatalf("place: %v", err)
+	}
+	if total != 7 {
+		t.Fatalf("weight total = %d, want 7 (read-only volume excluded)", total)
+	}
+	if u.Volume != "hdd2" {
+		t.Fatalf("volume = %q, want hdd2", u.Volume)
+	}
+}
+
+func TestVolumeServiceMoveUser(t *testing.T) {
+	t.Parallel()
+
+	extra := t.TempDir()
+	svc, repo, cfg := newVolumeTestService(t, config.VolumeConfig{Name: "hdd1", Path: extra})
+	u := user.NewUser("alice", "alice")
+	repo.users["alice"] = u
+	source := filepath.Join(cfg.WebDAV.Directory, "alice")
+	if err := os.MkdirAll(filepath.Join(source, "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "docs", "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	versionIndex := filepath.Join(versionRoot(cfg, u), u.ID, "docs", versionIndexFile)
+	if err := os.MkdirAll(filepath.Dir(versionIndex), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(versionIndex, []byte("{}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := svc.MoveUser(context.Background(), "alice", VolumeMoveOptions{Target: "hdd1", DryRun: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if report.Files != 1 || report.Bytes != 5 || len(repo.updates) != 0 {
+		t.Fatalf("dry run report = %+v updates=%v", report, repo.updates)
+	}
+
+	report, err = svc.MoveUser(context.Background(), "alice", VolumeMoveOptions{Target: "hdd1"})
+	if err != nil {
+		t.Fatalf("move: %v", err)
+	}
+	if report.From != storage.DefaultVolume || report.To != "hdd1" || report.Passes != 3 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	data, err := os.ReadFile(filepath.Join(extra, "alice", "docs", "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("moved content = %q err=%v", data, err)
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Fatalf("source directory still present: %v", err)
+	}
+	if u.Volume != "hdd1" || u.VolumeMoving {
+		t.Fatalf("record = %q moving=%v", u.Volume, u.VolumeMoving)
+	}
+	want := []string{"default+moving", "hdd1+moving", "hdd1"}
+	if len(repo.updates) != len(want) {
+		t.Fatalf("updates = %v, want %v", repo.updates, want)
+	}
+	for i := range want {
+		if repo.updates[i] != want[i] {
+			t.Fatalf("updates = %v, want %v", repo.updates, want)
+		}
+	}
+	if got := ResolveUserRoot(cfg, u); got != filepath.Join(extra, "alice") {
+		t.Fatalf("user root = %s", got)
+	}
+	if got := ownerUserRootDir(cfg, u); got != filepath.Join(extra, "alice") {
+		t.Fatalf("owner root = %s", got)
+	}
+	if got := versionRoot(cfg, u); got != filepath.Join(extra, versionStoreDir) {
+		t.Fatalf("version root = %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(extra, versionStoreDir, u.ID, "docs", versionIndexFile)); err != nil {
+		t.Fatalf("version history not moved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.WebDAV.Directory, versionStoreDir, u.ID)); !os.IsNotExist(err) {
+		t.Fatalf("version history left on the source volume: %v", err)
+	}
+}
+
+func TestVolumeServiceMoveUserRejectsReadOnlyTarget(t *testing.T) {
+	t.Parallel()
+
+	svc, repo, cfg := newVolumeTestService(t, config.VolumeConfig{Name: "archive", Path: t.TempDir(), ReadOnly: true})
+	repo.users["alice"] = user.NewUser("alice", "alice")
+	if err := os.MkdirAll(filepath.Join(cfg.WebDAV.Directory, "alice"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.MoveUser(context.Background(), "alice", VolumeMoveOptions{Target: "archive"}); !errors.Is(err, ErrVolumeReadOnly) {
+		t.Fatalf("err = %v, want ErrVolumeReadOnly", err)
+	}
+	if _, err := svc.MoveUser(context.Background(), "alice", VolumeMoveOptions{Target: "missing"}); !errors.Is(err, ErrVolumeNotFound) {
+		t.Fatalf("err = %v, want ErrVolumeNotFound", err)
+	}
+}
+
+func TestCheckVolumeWritable(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = t.TempDir()
+	cfg.Storage.Volumes = []config.VolumeConfig{{Name: "archive", Path: t.TempDir(), ReadOnly: true}}
+
+	u := user.NewUser("alice", "alice")
+	if err := CheckVolumeWritable(cfg, u); err != nil {
+		t.Fatalf("default volume: %v", err)
+	}
+	u.Volume = "archive"
+	if err := CheckVolumeWritable(cfg, u); !errors.Is(err, ErrVolumeReadOnly) {
+		t.Fatalf("read-only volume: %v", err)
+	}
+	u.VolumeMoving = true
+	if err := CheckVolumeWritable(cfg, u); !errors.Is(err, ErrVolumeMoving) {
+		t.Fatalf("moving user: %v", err)
+	}
+}
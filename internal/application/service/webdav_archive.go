@@ -0,0 +1,86 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+// isCollectionArchiveRequest reports whether a GET targets a directory, which
+// plain WebDAV answers with 405; those requests are streamed as an archive.
+func (s *WebDAVService) isCollectionArchiveRequest(userDir string, r *http.Request) bool {
+	if s.archiveService == nil || r.Method != http.MethodGet {
+		return false
+	}
+	info, err := s.backend().Stat(s.resolveUserFullPath(userDir, r.URL.Path))
+	return err == nil && info.IsDir()
+}
+
+// handleCollectionArchive streams the collection, or the children selected
+// with repeated ?path= values, honoring the user's path rules per entry.
+func (s *WebDAVService) handleCollectionArchive(w http.ResponseWriter, r *http.Request, u *user.User, userDir string) {
+	collectionPath := path.Clean("/" + strings.TrimPrefix(s.normalizeWebdavRequestPath(r.URL.Path), "/"))
+	collectionFull := s.resolveUserFullPath(userDir, r.URL.Path)
+	allow := UserArchiveFilter(u)
+
+	var sources []ArchiveSource
+	selected := r.URL.Query()["path"]
+	if len(selected) == 0 {
+		sources = append(sources, ArchiveSource{FullPath: collectionFull, Name: archiveBaseName(collectionPath, u), LogicalPath: collectionPath})
+	}
+	for _, raw := range selected {
+		rel := strings.TrimPrefix(path.Clean("/"+strings.TrimLeft(strings.ReplaceAll(raw, "\\", "/"), "/")), "/")
+		if rel == "" || isIgnoredWebDAVPath(rel) {
+			http.Error(w, "Invalid path", http.StatusBadRequest)
+			return
+		}
+		logicalPath := path.Join(collectionPath, rel)
+		if !allow(logicalPath, false) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		sources = append(sources, ArchiveSource{
+			FullPath:    filepath.Join(collectionFull, filepath.FromSlash(rel)),
+			LogicalPath: logicalPath,
+		})
+	}
+	baseName := archiveBaseName(collectionPath, u)
+	if len(sources) == 1 {
+		baseName = path.Base(sources[0].LogicalPath)
+	}
+	err := s.archiveService.Serve(w, r, ArchiveRequest{
+		Format:  r.URL.Query().Get("format"),
+		Sources: sources,
+		Allow:   allow,
+	}, baseName)
+	if err == nil {
+		return
+	}
+	switch {
+	case errors.Is(err, ErrArchiveTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrArchiveInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, os.ErrNotExist):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	default:
+		s.logger.Error("failed to build collection archive",
+			zap.String("username", u.Username),
+			zap.String("path", collectionPath),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+func archiveBaseName(collectionPath string, u *user.User) string {
+	if collectionPath == "/" && u != nil {
+		return u.Username
+	}
+	return path.Base(collectionPath)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/permission"
+	"github.com/yeying-community/warehouse/internal/domain/recycle"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+// MaxBulkDeletePaths bounds one bulk delete job.
+const MaxBulkDeletePaths = 10000
+
+// BulkDeleteFailure is one path a bulk delete could not remove.
+type BulkDeleteFailure struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// BulkDeleteResult summarizes a bulk delete. All moved entries share one
+// recycle batch so they can be restored together.
+type BulkDeleteResult struct {
+	BatchID string              `json:"batchId"`
+	Deleted int                 `json:"deleted"`
+	Missing int                 `json:"missing"`
+	Failed  []BulkDeleteFailure `json:"failed,omitempty"`
+}
+
+// NormalizeBulkDeletePaths cleans user-relative paths for DeleteToRecycle,
+// dropping duplicates and rejecting the root.
+func NormalizeBulkDeletePaths(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("paths is required")
+	}
+	if len(paths) > MaxBulkDeletePaths {
+		return nil, fmt.Errorf("at most %d paths per request", MaxBulkDeletePaths)
+	}
+	seen := make(map[string]struct{}, len(paths))
+	normalized := make([]string, 0, len(paths))
+	for _, raw := range paths {
+		rel := strings.TrimPrefix(path.Clean("/"+strings.TrimLeft(strings.ReplaceAll(strings.TrimSpace(raw), "\\", "/"), "/")), "/")
+		if rel == "" {
+			return nil, errors.New("the root directory cannot be deleted")
+		}
+		if _, ok := seen[rel]; ok {
+			continue
+		}
+		seen[rel] = struct{}{}
+		normalized = append(normalized, "/"+rel)
+	}
+	return normalized, nil
+}
+
+// DeleteToRecycle moves each of u's paths to the recycle bin like a WebDAV
+// DELETE, checking path permissions per entry. Missing paths are counted,
+// not failed. progress is called after every path; the loop stops when
+// ctx is canceled and returns what was done so far.
+func (s *WebDAVService) DeleteToRecycle(ctx context.Context, u *user.User, paths []string, progress func()) (*BulkDeleteResult, error) {
+	paths, err := NormalizeBulkDeletePaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	userDir := s.getUserDirectory(u)
+	dirName := u.Directory
+	if dirName == "" {
+		dirName = u.Username
+	}
+	result := &BulkDeleteResult{BatchID: recycle.NewBatchID()}
+	for _, logical := range paths {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		rel := strings.TrimPrefix(logical, "/")
+		fullPath := NamePolicy(s.config).WithFS(s.backend()).Resolve(userDir, filepath.Join(userDir, filepath.FromSlash(rel)))
+		deleted, err := s.deleteOneToRecycle(ctx, u, dirName, rel, fullPath, result.BatchID)
+		switch {
+		case err != nil:
+			result.Failed = append(result.Failed, BulkDeleteFailure{Path: logical, Error: err.Error()})
+		case deleted:
+			result.Deleted++
+		default:
+			result.Missing++
+		}
+		if progress != nil {
+			progress()
+		}
+	}
+	return result, nil
+}
+
+func (s *WebDAVService) deleteOneToRecycle(ctx context.Context, u *user.User, dirName, rel, fullPath, batchID string) (bool, error) {
+	if err := s.permissionCheck.Check(ctx, u, filepath.Join(dirName, rel), permission.OperationDelete); err != nil {
+		return false, err
+	}
+	info, err := s.backend().Stat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if _, err := s.moveToRecycle(ctx, u, rel, fullPath, info.IsDir(), batchID); err != nil {
+		s.logger.Error("failed to move file to recycle", zap.String("path", rel), zap.Error(err))
+		return false, err
+	}
+	if err := s.removePathReferences(ctx, u, fullPath, info.IsDir()); err != nil {
+		return true, err
+	}
+	return true, nil
+}
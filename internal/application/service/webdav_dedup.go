@@ -0,0 +1,22 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ingestAfterWrite 把成功写入或复制的内容链接到 blob 存储；
+// COPY 由 webdav.Handler 完成（锁、覆盖与目标路径校验与普通复制一致），之后再逐个链接
+func (s *WebDAVService) ingestAfterWrite(userDir string, r *http.Request) {
+	if !s.dedup.Enabled() {
+		return
+	}
+	switch r.Method {
+	case "PUT":
+		s.dedup.Ingest(s.resolveUserFullPath(userDir, r.URL.Path))
+	case "COPY":
+		if destination := strings.TrimSpace(r.Header.Get("Destination")); destination != "" {
+			s.dedup.IngestTree(s.resolveUserFullPath(userDir, destination))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func newDedupTestService(t *testing.T) (*WebDAVService, *DedupService) {
+	t.Helper()
+	svc, _ := newPartialUpdateTestService(t, 0, 0, &testMutationRecorder{})
+	svc.config.Dedup.Enabled = true
+	svc.config.Dedup.MinSize = 1
+	dedup := NewDedupService(svc.config, nil)
+	svc.SetDedupService(dedup)
+	return svc, dedup
+}
+
+func sameInode(t *testing.T, a, b string) bool {
+	t.Helper()
+	ai, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(ai, bi)
+}
+
+func TestWebDAVDedupCopyLinksAndPatchDetaches(t *testing.T) {
+	t.Parallel()
+	svc, dedup := newDedupTestService(t)
+	u, err := svc.userRepo.FindByUsername(t.Context(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	put := newPartialUpdateRequest(http.MethodPut, "/dav/personal/a.bin", "0123456789", u)
+	resp := newBufferedStatusRecorder()
+	svc.ServeHTTP(resp, put)
+	if resp.status < 200 || resp.status >= 300 {
+		t.Fatalf("PUT status = %d", resp.status)
+	}
+
+	copyReq := newPartialUpdateRequest("COPY", "/dav/personal/a.bin", "", u)
+	copyReq.Header.Set("Destination", "/dav/personal/b.bin")
+	resp = newBufferedStatusRecorder()
+	svc.ServeHTTP(resp, copyReq)
+	if resp.status != http.StatusCreated {
+		t.Fatalf("COPY status = %d", resp.status)
+	}
+
+	userDir := svc.getUserDirectory(u)
+	aPath := svc.resolveUserFullPath(userDir, "/dav/personal/a.bin")
+	bPath := svc.resolveUserFullPath(userDir, "/dav/personal/b.bin")
+	if !sameInode(t, aPath, bPath) {
+		t.Fatalf("COPY must link the existing blob instead of copying bytes")
+	}
+	if stats, err := dedup.Stats(); err != nil || stats.Blobs != 1 || stats.References != 2 {
+		t.Fatalf("unexpected blob stats: %+v err=%v", stats, err)
+	}
+	if stored, _ := svc.userRepo.FindByUsername(t.Context(), "alice"); stored.UsedSpace != 20 {
+		t.Fatalf("quota must charge logical size, got %d", stored.UsedSpace)
+	}
+
+	patch := newPartialUpdateRequest(http.MethodPatch, "/dav/personal/b.bin", "ab", u)
+	patch.Header.Set("Content-Type", PartialUpdateContentType)
+	patch.Header.Set("X-Update-Range", "bytes=0-1")
+	resp = newBufferedStatusRecorder()
+	svc.ServeHTTP(resp, patch)
+	if resp.status < 200 || resp.status >= 300 {
+		t.Fatalf("PATCH status = %d", resp.status)
+	}
+	assertPartialUpdateFile(t, bPath, "ab23456789")
+	assertPartialUpdateFile(t, aPath, "0123456789")
+}
+
+func TestWebDAVDedupCopyHonoursDestinationLock(t *testing.T) {
+	t.Parallel()
+	svc, _ := newDedupTestService(t)
+	u, err := svc.userRepo.FindByUsername(t.Context(), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seedPartialUpdateFile(t, svc, u, "personal/a.bin", "0123456789")
+	target := seedPartialUpdateFile(t, svc, u, "personal/b.bin", "locked")
+
+	lock := newPartialUpdateRequest("LOCK", "/dav/personal/b.bin", `<?xml version="1.0"?><D:lockinfo xmlns:D="DAV:"><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockinfo>`, u)
+	resp := newBufferedStatusRecorder()
+	svc.ServeHTTP(resp, lock)
+	if resp.status != http.StatusOK {
+		t.Fatalf("LOCK status = %d", resp.status)
+	}
+
+	copyReq := newPartialUpdateRequest("COPY", "/dav/personal/a.bin", "", u)
+	copyReq.Header.Set("Destination", "/dav/personal/b.bin")
+	resp = newBufferedStatusRecorder()
+	svc.ServeHTTP(resp, copyReq)
+	if resp.status != http.StatusLocked {
+		t.Fatalf("COPY onto a locked file must be refused, got %d", resp.status)
+	}
+	assertPartialUpdateFile(t, target, "locked")
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/recycle"
+)
+
+const (
+	// deleteBatchHeader 客户端显式指定的删除批次（操作 ID），同一 ID 的 DELETE 归入同一批次
+	deleteBatchHeader = "X-Warehouse-Delete-Batch"
+	// deleteBatchWindow 客户端逐项递归删除目录时，相邻两次 DELETE 的最大间隔
+	deleteBatchWindow = 30 * time.Second
+	// maxDeleteBatchScopes bounds the directories tracked per batch.
+	maxDeleteBatchScopes = 256
+	// maxDeleteBatchUsers triggers pruning of expired batches.
+	maxDeleteBatchUsers = 1024
+	maxDeleteBatchIDLen = 64
+)
+
+// deleteBatches groups the DELETE requests that make up one recursive delete.
+// Most WebDAV clients (Finder, Explorer, davfs) delete a folder entry by entry
+// and finally the emptied folder itself; each request would otherwise land in
+// its own recycle batch and the folder could not be restored as a whole.
+type deleteBatches struct {
+	mu      sync.Mutex
+	entries map[string]*deleteBatch
+}
+
+type deleteBatch struct {
+	id     string
+	scopes []string
+	lastAt time.Time
+}
+
+// requestDeleteBatchID returns the client supplied delete batch, if valid.
+func requestDeleteBatchID(r *http.Request) string {
+	id := strings.TrimSpace(r.Header.Get(deleteBatchHeader))
+	if id == "" || len(id) > maxDeleteBatchIDLen {
+		return ""
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return ""
+		}
+	}
+	return id
+}
+
+// assign returns the batch of a DELETE of relPath. The request joins the
+// user's current batch when it follows the previous DELETE within
+// deleteBatchWindow and stays inside a directory the batch already touched;
+// otherwise a new batch starts.
+func (b *deleteBatches) assign(userID, relPath string, now time.Time) string {
+	relPath = "/" + strings.Trim(path.Clean("/"+relPath), "/")
+	scope := deleteBatchScope(relPath)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.entries == nil {
+		b.entries = make(map[string]*deleteBatch)
+	}
+	entry := b.entries[userID]
+	if entry != nil && now.Sub(entry.lastAt) <= deleteBatchWindow && entry.covers(relPath) {
+		entry.lastAt = now
+		entry.addScope(scope)
+		return entry.id
+	}
+
+	if len(b.entries) >= maxDeleteBatchUsers {
+		for key, other := range b.entries {
+			if now.Sub(other.lastAt) > deleteBatchWindow {
+				delete(b.entries, key)
+			}
+		}
+	}
+	entry = &deleteBatch{id: recycle.NewBatchID(), scopes: []string{scope}, lastAt: now}
+	b.entries[userID] = entry
+	return entry.id
+}
+
+// deleteBatchScope is the directory whose entries are expected to be deleted
+// next: the parent, or the path itself for top-level entries so unrelated
+// deletes in the user root do not merge.
+func deleteBatchScope(relPath string) string {
+	parent := path.Dir(relPath)
+	if parent == "/" {
+		return relPath
+	}
+	return parent
+}
+
+func (e *deleteBatch) covers(relPath string) bool {
+	for _, scope := range e.scopes {
+		if relPath == scope || strings.HasPrefix(relPath, scope+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *deleteBatch) addScope(scope string) {
+	for _, existing := range e.scopes {
+		if existing == scope {
+			return
+		}
+	}
+	if len(e.scopes) < maxDeleteBatchScopes {
+		e.scopes = append(e.scopes, scope)
+	}
+}
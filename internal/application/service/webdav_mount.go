@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+type webdavMountKey struct{}
+
+type webdavMount struct {
+	prefix string
+	owner  string
+}
+
+// WithWebDAVMount 标记请求经由兼容前缀（如 Nextcloud 的 /remote.php/webdav）访问 WebDAV。
+// 调用方已把请求路径与 Destination 改写为 webdav.prefix 形式，服务内部照常处理；
+// 只有 webdav.Handler 看到外部路径，使 PROPFIND 返回的 href 与客户端请求的地址一致。
+// owner 非空时必须与认证用户一致。
+func WithWebDAVMount(ctx context.Context, prefix, owner string) context.Context {
+	return context.WithValue(ctx, webdavMountKey{}, webdavMount{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		owner:  owner,
+	})
+}
+
+func webdavMountFromContext(ctx context.Context) (webdavMount, bool) {
+	mount, ok := ctx.Value(webdavMountKey{}).(webdavMount)
+	return mount, ok
+}
+
+// newDAVHandler 创建处理当前请求的 webdav.Handler；挂载在兼容前缀下时，
+// 交给 Handler 的请求恢复为外部路径
+func (s *WebDAVService) newDAVHandler(r *http.Request, fs webdav.FileSystem, username string) http.Handler {
+	handler := &webdav.Handler{
+		Prefix:     s.davHandlerPrefix(r),
+		FileSystem: fs,
+		LockSystem: s.lockSystem,
+		Logger:     s.createLogger(username),
+	}
+	mount, ok := webdavMountFromContext(r.Context())
+	if !ok {
+		return handler
+	}
+	return &mountedDAVHandler{handler: handler, internal: s.webdavBasePrefix(), external: mount.prefix}
+}
+
+// davHandlerPrefix 返回 webdav.Handler 视角下的路径前缀，也用于解析 If 头中的资源 URL
+func (s *WebDAVService) davHandlerPrefix(r *http.Request) string {
+	prefix := s.handlerPrefix(r)
+	if mount, ok := webdavMountFromContext(r.Context()); ok {
+		return mount.prefix + strings.TrimSuffix(strings.TrimPrefix(prefix, s.webdavBasePrefix()), "/")
+	}
+	return prefix
+}
+
+func (s *WebDAVService) webdavBasePrefix() string {
+	return strings.TrimSuffix(s.config.WebDAV.Prefix, "/")
+}
+
+// mountedDAVHandler maps the rewritten internal request path back to the
+// external mount before the stock handler builds hrefs from it.
+type mountedDAVHandler struct {
+	handler  *webdav.Handler
+	internal string
+	external string
+}
+
+func (h *mountedDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	outer := r.Clone(r.Context())
+	outer.URL.Path = h.externalPath(r.URL.Path)
+	outer.URL.RawPath = ""
+	if destination := r.Header.Get("Destination"); destination != "" {
+		outer.Header.Set("Destination", h.externalPath(destination))
+	}
+	h.handler.ServeHTTP(w, outer)
+}
+
+func (h *mountedDAVHandler) externalPath(p string) string {
+	if rest, ok := strings.CutPrefix(p, h.internal); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+		return h.external + rest
+	}
+	return p
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebDAVServeHTTPMountedPrefixKeepsExternalHrefs(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+	seedPartialUpdateFile(t, svc, u, "personal/doc.txt", "hello")
+
+	req := newPartialUpdateRequest("PROPFIND", "/dav/personal/", "", u)
+	req = req.WithContext(WithWebDAVMount(req.Context(), "/remote.php/dav/files/alice", "alice"))
+	req.Header.Set("Depth", "1")
+	resp := httptest.NewRecorder()
+	svc.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusMultiStatus {
+		t.Fatalf("expected 207, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	body := resp.Body.String()
+	if !strings.Contains(body, "/remote.php/dav/files/alice/personal/doc.txt") || strings.Contains(body, "/dav/personal/") {
+		t.Fatalf("expected hrefs under the mount prefix, got %s", body)
+	}
+
+	req = newPartialUpdateRequest(http.MethodPut, "/dav/personal/copy.txt", "x", u)
+	req = req.WithContext(WithWebDAVMount(req.Context(), "/remote.php/dav/files/bob", "bob"))
+	resp = httptest.NewRecorder()
+	svc.ServeHTTP(resp, req)
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user's mount, got %d", resp.Code)
+	}
+}
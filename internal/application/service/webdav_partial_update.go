@@ -0,0 +1,520 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	webdavfs "github.com/yeying-community/warehouse/internal/infrastructure/webdav"
+	"go.uber.org/zap"
+)
+
+const (
+	// PartialUpdateContentType is the sabre/dav content type required on PATCH bodies.
+	PartialUpdateContentType = "application/x-sabredav-partialupdate"
+
+	partialUpdateRangeHeader  = "X-Update-Range"
+	partialUpdateOffsetHeader = "X-Warehouse-Upload-Offset"
+	webdavChecksumHeader      = "X-Warehouse-Checksum-SHA256"
+)
+
+var (
+	errPartialUpdateInvalid       = errors.New("invalid partial update range")
+	errPartialUpdateUnsatisfiable = errors.New("partial update range not satisfiable")
+	errPartialUpdateLength        = errors.New("partial update requires Content-Length")
+)
+
+// partialUpdate is one byte-range write parsed from either a sabre/dav style
+// PATCH (X-Update-Range) or a resumable PUT (Content-Range).
+type partialUpdate struct {
+	method string
+	append bool
+	// start is the first byte offset; -1 together with suffix > 0 means
+	// "the last suffix bytes of the current file".
+	start  int64
+	end    int64 // inclusive; -1 when the range is open ended
+	suffix int64
+	total  int64 // complete length from Content-Range; -1 when unknown
+}
+
+// isPartialUpdateRequest reports whether r must bypass the stock webdav
+// handler and be served as an in-place byte-range write.
+func isPartialUpdateRequest(r *http.Request) bool {
+	if r == nil {
+		return false
+	}
+	switch r.Method {
+	case http.MethodPatch:
+		return true
+	case http.MethodPut:
+		return strings.TrimSpace(r.Header.Get("Content-Range")) != ""
+	default:
+		return false
+	}
+}
+
+func parsePartialUpdate(r *http.Request) (*partialUpdate, error) {
+	switch r.Method {
+	case http.MethodPatch:
+		return parseUpdateRangeHeader(r.Header.Get(partialUpdateRangeHeader))
+	case http.MethodPut:
+		return parseContentRangeHeader(r.Header.Get("Content-Range"))
+	default:
+		return nil, errPartialUpdateInvalid
+	}
+}
+
+// parseUpdateRangeHeader parses sabre/dav X-Update-Range values:
+// "bytes=start-end", "bytes=start-", "bytes=-N" and "append".
+func parseUpdateRangeHeader(raw string) (*partialUpdate, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, fmt.Errorf("%w: %s header is required", errPartialUpdateInvalid, partialUpdateRangeHeader)
+	}
+	update := &partialUpdate{method: http.MethodPatch, start: -1, end: -1, total: -1}
+	if strings.EqualFold(raw, "append") {
+		update.append = true
+		return update, nil
+	}
+	spec, ok := cutPrefixFold(raw, "bytes=")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	first = strings.TrimSpace(first)
+	last = strings.TrimSpace(last)
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+		}
+		update.suffix = suffix
+		return update, nil
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	update.start = start
+	if last == "" {
+		return update, nil
+	}
+	end, err := strconv.ParseInt(last, 10, 64)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	update.end = end
+	return update, nil
+}
+
+// parseContentRangeHeader parses "bytes start-end/total" and "bytes start-end/*".
+func parseContentRangeHeader(raw string) (*partialUpdate, error) {
+	raw = strings.TrimSpace(raw)
+	spec, ok := cutPrefixFold(raw, "bytes ")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	rangePart, totalPart, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(rangePart), "-")
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil || start < 0 {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	end, err := strconv.ParseInt(strings.TrimSpace(last), 10, 64)
+	if err != nil || end < start {
+		return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+	}
+	update := &partialUpdate{method: http.MethodPut, start: start, end: end, total: -1}
+	totalPart = strings.TrimSpace(totalPart)
+	if totalPart != "*" {
+		total, err := strconv.ParseInt(totalPart, 10, 64)
+		if err != nil || total <= end {
+			return nil, fmt.Errorf("%w: %q", errPartialUpdateInvalid, raw)
+		}
+		update.total = total
+	}
+	return update, nil
+}
+
+// resolve turns the parsed range into an absolute offset and body length
+// against the current file size. Writes may extend the file but never leave holes.
+func (p *partialUpdate) resolve(currentSize, contentLength int64) (int64, int64, error) {
+	var start, length int64
+	switch {
+	case p.append:
+		start = currentSize
+		length = contentLength
+	case p.suffix > 0:
+		start = currentSize - p.suffix
+		length = p.suffix
+		if start < 0 {
+			return 0, 0, errPartialUpdateUnsatisfiable
+		}
+	case p.end >= 0:
+		start = p.start
+		length = p.end - p.start + 1
+	default:
+		start = p.start
+		length = contentLength
+	}
+	if length < 0 {
+		return 0, 0, errPartialUpdateLength
+	}
+	if contentLength >= 0 && contentLength != length {
+		return 0, 0, fmt.Errorf("%w: Content-Length %d does not match range length %d", errPartialUpdateInvalid, contentLength, length)
+	}
+	if start > currentSize {
+		return 0, 0, errPartialUpdateUnsatisfiable
+	}
+	return start, length, nil
+}
+
+// completes reports whether writing [start, start+length) finishes the upload.
+// A PATCH is self contained; a Content-Range PUT completes on its final range.
+func (p *partialUpdate) completes(start, length int64) bool {
+	if p.method == http.MethodPatch {
+		return true
+	}
+	return p.total >= 0 && start+length == p.total
+}
+
+// estimatePartialUpdateAdditionalSize 估算区间写入带来的新增占用
+func (s *WebDAVService) estimatePartialUpdateAdditionalSize(u *user.User, r *http.Request) (int64, error) {
+	update, err := parsePartialUpdate(r)
+	if err != nil {
+		// 交由实际处理流程返回 400
+		return 0, nil
+	}
+	targetPath := s.resolveUserFullPath(s.getUserDirectory(u), r.URL.Path)
+	oldSize, err := getExistingFileSize(s.backend(), targetPath)
+	if err != nil {
+		return 0, err
+	}
+	start, length, err := update.resolve(oldSize, r.ContentLength)
+	if err != nil {
+		return 0, nil
+	}
+	var additional int64
+	if start+length > oldSize {
+		additional = start + length - oldSize
+	}
+	if s.versionService.Enabled() && update.retainsVersion(start, oldSize) {
+		// 被覆盖的旧内容作为历史版本保留并继续计入额度
+		additional += oldSize
+	}
+	return additional, nil
+}
+
+// retainsVersion reports whether a range write replaces existing content, so
+// the previous content is kept as a version. Appends keep the old bytes as a
+// prefix, and follow-up chunks of a resumable PUT continue the upload that
+// started at offset 0 and already retained it.
+func (u partialUpdate) retainsVersion(start, oldSize int64) bool {
+	if oldSize == 0 {
+		return false
+	}
+	if u.method == http.MethodPut {
+		return start == 0
+	}
+	return start < oldSize || (u.total >= 0 && u.total < oldSize)
+}
+
+// pathLocks serialises writers per path. Entries are reference counted and
+// dropped when the last holder unlocks, so the map only tracks paths with
+// writes in flight.
+type pathLocks struct {
+	mu      sync.Mutex
+	entries map[string]*pathLockEntry
+}
+
+type pathLockEntry struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (l *pathLocks) lock(key string) func() {
+	l.mu.Lock()
+	if l.entries == nil {
+		l.entries = make(map[string]*pathLockEntry)
+	}
+	entry := l.entries[key]
+	if entry == nil {
+		entry = &pathLockEntry{}
+		l.entries[key] = entry
+	}
+	entry.refs++
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+		l.mu.Lock()
+		entry.refs--
+		if entry.refs == 0 {
+			delete(l.entries, key)
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *pathLocks) len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+func (s *WebDAVService) lockPartialUpdatePath(fullPath string) func() {
+	return s.partialUpdateLocks.lock(fullPath)
+}
+
+// handlePartialUpdate 处理断点续传的区间写入（PATCH + X-Update-Range / PUT + Content-Range）
+func (s *WebDAVService) handlePartialUpdate(w http.ResponseWriter, r *http.Request, u *user.User, userDir string) {
+	if r.Body != nil {
+		defer r.Body.Close()
+	}
+	if r.Method == http.MethodPatch {
+		contentType := strings.TrimSpace(strings.Split(r.Header.Get("Content-Type"), ";")[0])
+		if !strings.EqualFold(contentType, PartialUpdateContentType) {
+			http.Error(w, "PATCH requires Content-Type "+PartialUpdateContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+	update, err := parsePartialUpdate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// 与 webdav.Handler 一致：目标被他人 LOCK 时，必须携带匹配的锁令牌才能写入
+	name := strings.TrimPrefix(r.URL.Path, s.handlerPrefix(r))
+	release, status, err := webdavfs.ConfirmLocks(s.lockSystem, r, s.davHandlerPrefix(r), name, "")
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	defer release()
+
+	fullPath := s.resolveUserFullPath(userDir, r.URL.Path)
+	unlock := s.lockPartialUpdatePath(fullPath)
+	defer unlock()
+
+	created := false
+	info, err := s.backend().Stat(fullPath)
+	switch {
+	case err == nil && info.IsDir():
+		http.Error(w, "Conflict", http.StatusConflict)
+		return
+	case errors.Is(err, os.ErrNotExist):
+		// 只有从 0 开始的 Content-Range PUT 可以创建文件，其余区间写入必须针对已有文件
+		if update.method != http.MethodPut || update.start != 0 {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		created = true
+	case err != nil:
+		s.logger.Error("failed to stat partial update target",
+			zap.String("username", u.Username),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	oldSize := calculateFileSizeOrZero(info)
+
+	start, length, err := update.resolve(oldSize, r.ContentLength)
+	switch {
+	case errors.Is(err, errPartialUpdateUnsatisfiable):
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", oldSize))
+		http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+		return
+	case errors.Is(err, errPartialUpdateLength):
+		http.Error(w, err.Error(), http.StatusLengthRequired)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	finalSize := max(oldSize, start+length)
+	if update.total >= 0 {
+		finalSize = update.total
+	}
+	if err := s.checkUploadPolicy(w, r, u, userDir, finalSize); err != nil {
+		s.logger.Warn("upload policy violation",
+			zap.String("username", u.Username),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		WriteUploadPolicyError(w, err)
+		return
+	}
+
+	// 覆盖已有内容前暂存旧内容；写入中途失败但文件已被改动时同样保留
+	var pendingVersion *PendingVersion
+	if !created && update.retainsVersion(start, oldSize) {
+		pendingVersion, err = s.versionService.Prepare(r.Context(), u, fullPath, VersionSourceWebDAV)
+		if err != nil {
+			s.logger.Error("failed to retain file version",
+				zap.String("username", u.Username),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+	}
+	writeSucceeded := false
+	defer func() {
+		_, _ = s.versionService.Finish(r.Context(), pendingVersion, writeSucceeded)
+	}()
+
+	flags := os.O_WRONLY
+	if created {
+		flags |= os.O_CREATE
+	} else if err := storage.Detach(s.backend(), fullPath); err != nil {
+		// 区间写入是原地修改，先与去重存储中的其他引用断开
+		s.logger.Error("failed to detach partial update target",
+			zap.String("username", u.Username),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	file, err := s.backend().OpenFile(fullPath, flags, 0o644)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "Conflict", http.StatusConflict)
+			return
+		}
+		s.logger.Error("failed to open partial update target",
+			zap.String("username", u.Username),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	complete := update.completes(start, length)
+	var body io.Reader = http.NoBody
+	if r.Body != nil {
+		body = r.Body
+	}
+	written, writeErr := io.Copy(io.NewOffsetWriter(file, start), io.LimitReader(body, length))
+	if writeErr == nil && written != length {
+		writeErr = io.ErrUnexpectedEOF
+	}
+	if writeErr == nil && complete && update.total >= 0 {
+		writeErr = file.Truncate(update.total)
+	}
+	if closeErr := file.Close(); writeErr == nil {
+		writeErr = closeErr
+	}
+	writeSucceeded = writeErr == nil
+
+	newSize, err := getExistingFileSize(s.backend(), fullPath)
+	if err != nil {
+		s.logger.Error("failed to stat partial update result",
+			zap.String("username", u.Username),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+	} else {
+		// 即使写入中断，已落盘的字节也需要计入配额
+		s.applyUsedSpaceDelta(r.Context(), u, newSize-oldSize)
+	}
+	if writeErr != nil {
+		s.logger.Warn("partial update interrupted",
+			zap.String("username", u.Username),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Int64("start", start),
+			zap.Int64("expected", length),
+			zap.Int64("written", written),
+			zap.Error(writeErr))
+		http.Error(w, "incomplete range body", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set(partialUpdateOffsetHeader, strconv.FormatInt(newSize, 10))
+	if complete {
+		if err := verifyPartialUpdateChecksum(s.backend(), fullPath, r.Header.Get(webdavChecksumHeader)); err != nil {
+			s.logger.Warn("partial update checksum verification failed",
+				zap.String("username", u.Username),
+				zap.String("path", r.URL.Path),
+				zap.Error(err))
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.recordPartialUpdate(r, fullPath); err != nil {
+			if s.handleMutationRecordError("write mutation skipped because no standby is currently available",
+				err,
+				zap.String("username", u.Username),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+			) {
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *WebDAVService) recordPartialUpdate(r *http.Request, fullPath string) error {
+	if err := s.mutationRecorder.EnsureDir(r.Context(), filepath.Dir(fullPath)); err != nil {
+		return err
+	}
+	return s.mutationRecorder.UpsertFile(r.Context(), fullPath)
+}
+
+// verifyPartialUpdateChecksum compares the whole file against the hex or
+// base64 SHA-256 sent with the completing request. An empty header skips the check.
+func verifyPartialUpdateChecksum(b storage.Backend, fullPath, expected string) error {
+	expected = strings.TrimSpace(expected)
+	if expected == "" {
+		return nil
+	}
+	decoded, err := hex.DecodeString(expected)
+	if err != nil || len(decoded) != sha256.Size {
+		decoded, err = base64.StdEncoding.DecodeString(expected)
+		if err != nil || len(decoded) != sha256.Size {
+			return fmt.Errorf("%s must be hex or base64 encoded", webdavChecksumHeader)
+		}
+	}
+	_, actual, err := fileDigest(b, fullPath)
+	if err != nil {
+		return err
+	}
+	if actual != hex.EncodeToString(decoded) {
+		return fmt.Errorf("%s mismatch", webdavChecksumHeader)
+	}
+	return nil
+}
+
+func cutPrefixFold(value, prefix string) (string, bool) {
+	if len(value) < len(prefix) || !strings.EqualFold(value[:len(prefix)], prefix) {
+		return "", false
+	}
+	return value[len(prefix):], true
+}
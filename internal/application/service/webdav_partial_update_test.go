@@ -0,0 +1,403 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/quota"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+	"golang.org/x/net/webdav"
+)
+
+func TestParseUpdateRangeHeader(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		raw         string
+		currentSize int64
+		bodyLength  int64
+		wantStart   int64
+		wantLength  int64
+		wantErr     bool
+	}{
+		{raw: "bytes=2-4", currentSize: 10, bodyLength: 3, wantStart: 2, wantLength: 3},
+		{raw: "bytes=8-", currentSize: 10, bodyLength: 5, wantStart: 8, wantLength: 5},
+		{raw: "bytes=-3", currentSize: 10, bodyLength: 3, wantStart: 7, wantLength: 3},
+		{raw: "append", currentSize: 10, bodyLength: 4, wantStart: 10, wantLength: 4},
+		{raw: "bytes=11-12", currentSize: 10, bodyLength: 2, wantErr: true},
+		{raw: "bytes=-11", currentSize: 10, bodyLength: 11, wantErr: true},
+		{raw: "bytes=2-4", currentSize: 10, bodyLength: 4, wantErr: true},
+		{raw: "bytes=4-2", currentSize: 10, bodyLength: 3, wantErr: true},
+		{raw: "lines=1-2", currentSize: 10, bodyLength: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			t.Parallel()
+			update, err := parseUpdateRangeHeader(tt.raw)
+			if err == nil {
+				var start, length int64
+				start, length, err = update.resolve(tt.currentSize, tt.bodyLength)
+				if err == nil && (start != tt.wantStart || length != tt.wantLength) {
+					t.Fatalf("resolve() = (%d, %d), want (%d, %d)", start, length, tt.wantStart, tt.wantLength)
+				}
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error state: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseContentRangeHeader(t *testing.T) {
+	t.Parallel()
+
+	update, err := parseContentRangeHeader("bytes 5-9/10")
+	if err != nil {
+		t.Fatalf("parse content range: %v", err)
+	}
+	if update.start != 5 || update.end != 9 || update.total != 10 || !update.completes(5, 5) {
+		t.Fatalf("unexpected update: %+v", update)
+	}
+
+	update, err = parseContentRangeHeader("bytes 0-4/*")
+	if err != nil {
+		t.Fatalf("parse content range with unknown total: %v", err)
+	}
+	if update.total != -1 || update.completes(0, 5) {
+		t.Fatalf("expected open ended upload to stay incomplete: %+v", update)
+	}
+
+	for _, raw := range []string{"bytes 5-9/9", "bytes 9-5/10", "bytes */10", "5-9/10"} {
+		if _, err := parseContentRangeHeader(raw); err == nil {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
+
+func TestWebDAVServeHTTPPatchUpdatesRangeInPlace(t *testing.T) {
+	t.Parallel()
+
+	recorder := &testMutationRecorder{}
+	svc, u := newPartialUpdateTestService(t, 100, 10, recorder)
+	targetPath := seedPartialUpdateFile(t, svc, u, "personal/doc.txt", "0123456789")
+
+	req := newPartialUpdateRequest(http.MethodPatch, "/dav/personal/doc.txt", "abc", u)
+	req.Header.Set("Content-Type", PartialUpdateContentType)
+	req.Header.Set("X-Update-Range", "bytes=2-4")
+	resp := httptest.NewRecorder()
+
+	svc.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	assertPartialUpdateFile(t, targetPath, "01abc56789")
+	if u.UsedSpace != 10 {
+		t.Fatalf("expected used space to stay 10, got %d", u.UsedSpace)
+	}
+	if recorder.upsertFileCalls != 1 {
+		t.Fatalf("expected one upsert after PATCH, got %d", recorder.upsertFileCalls)
+	}
+}
+
+func TestWebDAVServeHTTPPatchRespectsWebDAVLocks(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 100, 10, nil)
+	targetPath := seedPartialUpdateFile(t, svc, u, "personal/doc.txt", "0123456789")
+	token, err := svc.lockSystem.Create(time.Now(), webdav.LockDetails{
+		Root:      "/personal/doc.txt",
+		Duration:  time.Minute,
+		OwnerXML:  "<owner>bob</owner>",
+		ZeroDepth: true,
+	})
+	if err != nil {
+		t.Fatalf("create lock: %v", err)
+	}
+
+	req := newPartialUpdateRequest(http.MethodPatch, "/dav/personal/doc.txt", "abc", u)
+	req.Header.Set("Content-Type", PartialUpdateContentType)
+	req.Header.Set("X-Update-Range", "bytes=2-4")
+	resp := httptest.NewRecorder()
+	svc.ServeHTTP(resp, req)
+	if resp.Code != webdav.StatusLocked {
+		t.Fatalf("expected 423 without lock token, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	assertPartialUpdateFile(t, targetPath, "0123456789")
+
+	req = newPartialUpdateRequest(http.MethodPut, "/dav/personal/doc.txt", "abc", u)
+	req.Header.Set("Content-Range", "bytes 0-2/3")
+	req.Header.Set("If", "(<opaquelocktoken:wrong>)")
+	resp = httptest.NewRecorder()
+	svc.ServeHTTP(resp, req)
+	if resp.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 with a foreign lock token, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+
+	req = newPartialUpdateRequest(http.MethodPatch, "/dav/personal/doc.txt", "abc", u)
+	req.Header.Set("Content-Type", PartialUpdateContentType)
+	req.Header.Set("X-Update-Range", "bytes=2-4")
+	req.Header.Set("If", "(<"+token+">)")
+	resp = httptest.NewRecorder()
+	svc.ServeHTTP(resp, req)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 with the lock token, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	assertPartialUpdateFile(t, targetPath, "01abc56789")
+	if n := svc.partialUpdateLocks.len(); n != 0 {
+		t.Fatalf("expected path locks to be released, %d left", n)
+	}
+}
+
+func TestWebDAVServeHTTPPatchAppendChargesDelta(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 100, 10, nil)
+	targetPath := seedPartialUpdateFile(t, svc, u, "personal/log.txt", "0123456789")
+
+	req := newPartialUpdateRequest(http.MethodPatch, "/dav/personal/log.txt", "abcd", u)
+	req.Header.Set("Content-Type", PartialUpdateContentType)
+	req.Header.Set("X-Update-Range", "append")
+	resp := httptest.NewRecorder()
+
+	svc.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	assertPartialUpdateFile(t, targetPath, "0123456789abcd")
+	if u.UsedSpace != 14 {
+		t.Fatalf("expected used space to become 14, got %d", u.UsedSpace)
+	}
+	if got := resp.Header().Get("X-Warehouse-Upload-Offset"); got != "14" {
+		t.Fatalf("unexpected upload offset header: %q", got)
+	}
+}
+
+func TestWebDAVServeHTTPPatchRejectsWhenQuotaExceeded(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 12, 10, nil)
+	targetPath := seedPartialUpdateFile(t, svc, u, "personal/log.txt", "0123456789")
+
+	req := newPartialUpdateRequest(http.MethodPatch, "/dav/personal/log.txt", "abcd", u)
+	req.Header.Set("Content-Type", PartialUpdateContentType)
+	req.Header.Set("X-Update-Range", "append")
+	resp := httptest.NewRecorder()
+
+	svc.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusInsufficientStorage {
+		t.Fatalf("expected 507, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	assertPartialUpdateFile(t, targetPath, "0123456789")
+}
+
+func TestWebDAVServeHTTPPatchRequiresSabreContentType(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+	seedPartialUpdateFile(t, svc, u, "personal/doc.txt", "0123456789")
+
+	req := newPartialUpdateRequest(http.MethodPatch, "/dav/personal/doc.txt", "abc", u)
+	req.Header.Set("X-Update-Range", "bytes=2-4")
+	resp := httptest.NewRecorder()
+
+	svc.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected 415, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+}
+
+func TestWebDAVServeHTTPContentRangeResumesUpload(t *testing.T) {
+	t.Parallel()
+
+	recorder := &testMutationRecorder{}
+	svc, u := newPartialUpdateTestService(t, 100, 0, recorder)
+	payload := "hello resumable world"
+	sum := sha256.Sum256([]byte(payload))
+
+	first := newPartialUpdateRequest(http.MethodPut, "/dav/personal/big.bin", payload[:10], u)
+	first.Header.Set("Content-Range", "bytes 0-9/21")
+	resp := httptest.NewRecorder()
+	svc.ServeHTTP(resp, first)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("expected first range to create file, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	if recorder.upsertFileCalls != 0 {
+		t.Fatalf("expected no upsert before the final range, got %d", recorder.upsertFileCalls)
+	}
+	if u.UsedSpace != 10 {
+		t.Fatalf("expected used space 10 after first range, got %d", u.UsedSpace)
+	}
+
+	second := newPartialUpdateRequest(http.MethodPut, "/dav/personal/big.bin", payload[10:], u)
+	second.Header.Set("Content-Range", "bytes 10-20/21")
+	second.Header.Set("X-Warehouse-Checksum-SHA256", hex.EncodeToString(sum[:]))
+	resp = httptest.NewRecorder()
+	svc.ServeHTTP(resp, second)
+	if resp.Code != http.StatusNoContent {
+		t.Fatalf("expected final range to succeed, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+
+	targetPath := svc.resolveUserFullPath(svc.getUserDirectory(u), "/dav/personal/big.bin")
+	assertPartialUpdateFile(t, targetPath, payload)
+	if u.UsedSpace != 21 {
+		t.Fatalf("expected used space 21 after final range, got %d", u.UsedSpace)
+	}
+	if recorder.upsertFileCalls != 1 {
+		t.Fatalf("expected one upsert after the final range, got %d", recorder.upsertFileCalls)
+	}
+}
+
+func TestWebDAVServeHTTPContentRangeRejectsChecksumMismatch(t *testing.T) {
+	t.Parallel()
+
+	recorder := &testMutationRecorder{}
+	svc, u := newPartialUpdateTestService(t, 0, 0, recorder)
+	seedPartialUpdateFile(t, svc, u, "personal/big.bin", "hello")
+
+	req := newPartialUpdateRequest(http.MethodPut, "/dav/personal/big.bin", "world", u)
+	req.Header.Set("Content-Range", "bytes 5-9/10")
+	req.Header.Set("X-Warehouse-Checksum-SHA256", strings.Repeat("0", 64))
+	resp := httptest.NewRecorder()
+
+	svc.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("expected checksum mismatch to return 400, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	if recorder.upsertFileCalls != 0 {
+		t.Fatalf("expected no upsert for mismatched checksum, got %d", recorder.upsertFileCalls)
+	}
+}
+
+func TestWebDAVServeHTTPContentRangeRejectsGap(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+	seedPartialUpdateFile(t, svc, u, "personal/big.bin", "hello")
+
+	req := newPartialUpdateRequest(http.MethodPut, "/dav/personal/big.bin", "world", u)
+	req.Header.Set("Content-Range", "bytes 8-12/13")
+	resp := httptest.NewRecorder()
+
+	svc.ServeHTTP(resp, req)
+
+	if resp.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected 416, got status=%d body=%q", resp.Code, resp.Body.String())
+	}
+	if got := resp.Header().Get("Content-Range"); got != "bytes */5" {
+		t.Fatalf("unexpected Content-Range on 416: %q", got)
+	}
+}
+
+func TestEstimateQuotaAdditionalSizeDoesNotReadBody(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newQuotaTestService(t, 100, 0)
+	body := &countingReader{Reader: strings.NewReader("1234567890")}
+	req := httptest.NewRequest(http.MethodPut, "/dav/personal/new.txt", nil)
+	req.Body = io.NopCloser(body)
+	req.ContentLength = -1
+
+	size, err := svc.estimateQuotaAdditionalSize(u, req)
+	if err != nil {
+		t.Fatalf("estimate quota: %v", err)
+	}
+	if size != 0 {
+		t.Fatalf("expected unknown length to estimate 0, got %d", size)
+	}
+	if body.read != 0 {
+		t.Fatalf("expected body to stay unread, got %d bytes consumed", body.read)
+	}
+}
+
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.read += n
+	return n, err
+}
+
+func newPartialUpdateTestService(t *testing.T, quotaBytes, usedBytes int64, recorder MutationRecorder) (*WebDAVService, *user.User) {
+	t.Helper()
+
+	cfg := &config.Config{
+		WebDAV: config.WebDAVConfig{
+			Prefix:              "/dav",
+			Directory:           t.TempDir(),
+			AutoCreateDirectory: true,
+			NoSniff:             true,
+		},
+	}
+
+	userRepo := newTestUserRepo()
+	u := user.NewUser("alice", "alice")
+	u.Permissions = user.FullPermissions()
+	u.Quota = quotaBytes
+	u.UsedSpace = usedBytes
+	if err := userRepo.Save(context.Background(), u); err != nil {
+		t.Fatalf("save user: %v", err)
+	}
+
+	svc := NewWebDAVService(
+		cfg,
+		allowPermissionChecker{},
+		quota.NewService(userRepo),
+		userRepo,
+		&testRecycleRepo{},
+		nil,
+		recorder,
+		zap.NewNop(),
+	)
+	return svc, u
+}
+
+func seedPartialUpdateFile(t *testing.T, svc *WebDAVService, u *user.User, relativePath, content string) string {
+	t.Helper()
+
+	fullPath := filepath.Join(svc.getUserDirectory(u), filepath.FromSlash(relativePath))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+		t.Fatalf("mkdir seed dir: %v", err)
+	}
+	if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+		t.Fatalf("seed file: %v", err)
+	}
+	return fullPath
+}
+
+func newPartialUpdateRequest(method, target, body string, u *user.User) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	return req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, u))
+}
+
+func assertPartialUpdateFile(t *testing.T, fullPath, want string) {
+	t.Helper()
+
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatalf("read updated file: %v", err)
+	}
+	if string(data) != want {
+		t.Fatalf("unexpected file content: got %q, want %q", string(data), want)
+	}
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+// maxSearchRequestBody 限制 SEARCH 请求体大小
+const maxSearchRequestBody = 64 << 10
+
+// errSearchUnsupported 表示查询使用了 basicsearch 中尚未支持的运算或属性
+var errSearchUnsupported = errors.New("unsupported search expression")
+
+// SetSearchService 启用 WebDAV SEARCH（RFC 5323 basicsearch），与搜索 API 共用索引
+func (s *WebDAVService) SetSearchService(search *SearchService) {
+	s.search = search
+}
+
+// SearchEnabled 返回是否支持 WebDAV SEARCH
+func (s *WebDAVService) SearchEnabled() bool {
+	return s.search.Enabled()
+}
+
+// davSearchNode 是 basicsearch 请求体的通用 XML 节点
+type davSearchNode struct {
+	XMLName xml.Name
+	Text    string          `xml:",chardata"`
+	Nodes   []davSearchNode `xml:",any"`
+}
+
+func (n davSearchNode) child(local string) (davSearchNode, bool) {
+	for _, node := range n.Nodes {
+		if node.XMLName.Local == local {
+			return node, true
+		}
+	}
+	return davSearchNode{}, false
+}
+
+func (n davSearchNode) text() string {
+	return strings.TrimSpace(n.Text)
+}
+
+// handleSearch 处理 SEARCH 请求：解析 basicsearch，查询索引并返回 207 multistatus
+func (s *WebDAVService) handleSearch(w http.ResponseWriter, r *http.Request, u *user.User) {
+	if !s.search.Enabled() {
+		http.Error(w, "Not Implemented", http.StatusNotImplemented)
+		return
+	}
+	query, err := s.parseSearchRequest(r)
+	if err != nil {
+		s.logger.Debug("invalid search request",
+			zap.String("username", u.Username),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		status := http.StatusBadRequest
+		if errors.Is(err, errSearchUnsupported) {
+			status = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	page, err := s.search.Search(r.Context(), u, query)
+	if err != nil {
+		if errors.Is(err, ErrSearchInvalid) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.logger.Error("webdav search failed",
+			zap.String("username", u.Username),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	prefix := s.handlerPrefix(r)
+	var body strings.Builder
+	body.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	body.WriteString(`<D:multistatus xmlns:D="DAV:">`)
+	for _, item := range page.Items {
+		s.writeSearchResponse(&body, prefix, item)
+	}
+	body.WriteString(`</D:multistatus>`)
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	if _, err := io.WriteString(w, body.String()); err != nil {
+		s.logger.Debug("failed to write search response", zap.Error(err))
+	}
+}
+
+func (s *WebDAVService) writeSearchResponse(body *strings.Builder, prefix string, item SearchResult) {
+	href := path.Join("/", prefix, item.Path)
+	if item.IsDir {
+		href += "/"
+	}
+	body.WriteString(`<D:response><D:href>`)
+	body.WriteString(html.EscapeString((&url.URL{Path: href}).EscapedPath()))
+	body.WriteString(`</D:href><D:propstat><D:prop>`)
+	body.WriteString(`<D:displayname>` + html.EscapeString(item.Name) + `</D:displayname>`)
+	if item.IsDir {
+		body.WriteString(`<D:resourcetype><D:collection/></D:resourcetype>`)
+	} else {
+		body.WriteString(`<D:resourcetype/>`)
+		body.WriteString(`<D:getcontentlength>` + strconv.FormatInt(item.Size, 10) + `</D:getcontentlength>`)
+		if item.ContentType != "" {
+			body.WriteString(`<D:getcontenttype>` + html.EscapeString(item.ContentType) + `</D:getcontenttype>`)
+		}
+	}
+	body.WriteString(`<D:getlastmodified>` + item.ModifiedAt.UTC().Format(http.TimeFormat) + `</D:getlastmodified>`)
+	body.WriteString(`</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>`)
+}
+
+// parseSearchRequest 把 basicsearch 请求体转换为 SearchQuery。
+// 支持 and / like / eq / gt / gte / lt / lte / is-collection / not(is-collection)，
+// 范围为 scope 指定的目录（未指定时为请求路径），depth 支持 1 与 infinity
+func (s *WebDAVService) parseSearchRequest(r *http.Request) (SearchQuery, error) {
+	var root davSearchNode
+	if err := xml.NewDecoder(io.LimitReader(r.Body, maxSearchRequestBody)).Decode(&root); err != nil {
+		return SearchQuery{}, fmt.Errorf("invalid search body: %w", err)
+	}
+	if root.XMLName.Local != "searchrequest" {
+		return SearchQuery{}, fmt.Errorf("expected searchrequest, got %s", root.XMLName.Local)
+	}
+	basic, ok := root.child("basicsearch")
+	if !ok {
+		return SearchQuery{}, fmt.Errorf("%w: only DAV:basicsearch is supported", errSearchUnsupported)
+	}
+
+	query := SearchQuery{Path: s.normalizeWebdavRequestPath(r.URL.Path)}
+	if from, ok := basic.child("from"); ok {
+		if scope, ok := from.child("scope"); ok {
+			if href, ok := scope.child("href"); ok && href.text() != "" {
+				query.Path = s.normalizeWebdavRequestPath(href.text())
+			}
+			if depth, ok := scope.child("depth"); ok {
+				switch strings.ToLower(depth.text()) {
+				case "", "infinity":
+				case "1":
+					query.ChildrenOnly = true
+				default:
+					return SearchQuery{}, fmt.Errorf("%w: depth %q", errSearchUnsupported, depth.text())
+				}
+			}
+		}
+	}
+	if where, ok := basic.child("where"); ok {
+		for _, node := range where.Nodes {
+			if err := applySearchCondition(&query, node); err != nil {
+				return SearchQuery{}, err
+			}
+		}
+	}
+	if limit, ok := basic.child("limit"); ok {
+		if nresults, ok := limit.child("nresults"); ok {
+			n, err := strconv.Atoi(nresults.text())
+			if err != nil || n <= 0 {
+				return SearchQuery{}, fmt.Errorf("invalid nresults %q", nresults.text())
+			}
+			query.Limit = n
+		}
+	}
+	return query, nil
+}
+
+func applySearchCondition(query *SearchQuery, node davSearchNode) error {
+	op := node.XMLName.Local
+	switch op {
+	case "and":
+		for _, child := range node.Nodes {
+			if err := applySearchCondition(query, child); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "is-collection":
+		isDir := true
+		query.IsDir = &isDir
+		return nil
+	case "not":
+		if len(node.Nodes) == 1 && node.Nodes[0].XMLName.Local == "is-collection" {
+			isDir := false
+			query.IsDir = &isDir
+			return nil
+		}
+		return fmt.Errorf("%w: not is only supported around is-collection", errSearchUnsupported)
+	case "like", "eq", "gt", "gte", "lt", "lte":
+	default:
+		return fmt.Errorf("%w: operator %s", errSearchUnsupported, op)
+	}
+
+	prop, literal, err := searchComparison(node)
+	if err != nil {
+		return err
+	}
+	switch prop {
+	case "displayname":
+		switch op {
+		case "like":
+			query.NamePattern = literal
+		case "eq":
+			query.NamePattern = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(literal)
+		default:
+			return fmt.Errorf("%w: %s on displayname", errSearchUnsupported, op)
+		}
+	case "getcontenttype":
+		contentType := literal
+		if op == "like" {
+			contentType = strings.TrimSuffix(contentType, "%")
+			if strings.ContainsAny(contentType, "%_") {
+				return fmt.Errorf("%w: getcontenttype only supports prefix patterns", errSearchUnsupported)
+			}
+		} else if op != "eq" {
+			return fmt.Errorf("%w: %s on getcontenttype", errSearchUnsupported, op)
+		}
+		query.ContentType = contentType
+	case "getcontentlength":
+		if op == "like" {
+			return fmt.Errorf("%w: like on getcontentlength", errSearchUnsupported)
+		}
+		size, err := strconv.ParseInt(literal, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid getcontentlength literal %q", literal)
+		}
+		minSize, maxSize := searchBounds(op, size)
+		if minSize != nil {
+			query.MinSize = minSize
+		}
+		if maxSize != nil {
+			query.MaxSize = maxSize
+		}
+	case "getlastmodified":
+		if op == "like" {
+			return fmt.Errorf("%w: like on getlastmodified", errSearchUnsupported)
+		}
+		at, err := parseSearchTime(literal)
+		if err != nil {
+			return err
+		}
+		// 时间比较按秒对齐：ModifiedBefore 为开区间
+		switch op {
+		case "gt":
+			after := at.Add(time.Second)
+			query.ModifiedAfter = &after
+		case "gte":
+			query.ModifiedAfter = &at
+		case "lt":
+			query.ModifiedBefore = &at
+		case "lte":
+			before := at.Add(time.Second)
+			query.ModifiedBefore = &before
+		case "eq":
+			before := at.Add(time.Second)
+			query.ModifiedAfter = &at
+			query.ModifiedBefore = &before
+		}
+	default:
+		return fmt.Errorf("%w: property %s", errSearchUnsupported, prop)
+	}
+	return nil
+}
+
+// searchComparison 取出比较运算中的属性名与字面量
+func searchComparison(node davSearchNode) (string, string, error) {
+	prop, ok := node.child("prop")
+	if !ok || len(prop.Nodes) != 1 {
+		return "", "", fmt.Errorf("%s requires exactly one prop", node.XMLName.Local)
+	}
+	literal, ok := node.child("literal")
+	if !ok {
+		return "", "", fmt.Errorf("%s requires a literal", node.XMLName.Local)
+	}
+	return prop.Nodes[0].XMLName.Local, literal.text(), nil
+}
+
+// searchBounds 把整数比较转换为闭区间上下界
+func searchBounds(op string, value int64) (*int64, *int64) {
+	switch op {
+	case "gt":
+		return int64Pointer(value + 1), nil
+	case "gte":
+		return int64Pointer(value), nil
+	case "lt":
+		return nil, int64Pointer(value - 1)
+	case "lte":
+		return nil, int64Pointer(value)
+	case "eq":
+		return int64Pointer(value), int64Pointer(value)
+	}
+	return nil, nil
+}
+
+func parseSearchTime(literal string) (time.Time, error) {
+	if at, err := http.ParseTime(literal); err == nil {
+		return at.UTC(), nil
+	}
+	if at, err := time.Parse(time.RFC3339, literal); err == nil {
+		return at.UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid getlastmodified literal %q", literal)
+}
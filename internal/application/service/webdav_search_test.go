@@ -0,0 +1,78 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const basicSearchBody = `<?xml version="1.0"?>
+<d:searchrequest xmlns:d="DAV:">
+  <d:basicsearch>
+    <d:select><d:prop><d:displayname/></d:prop></d:select>
+    <d:from><d:scope><d:href>/dav/personal</d:href><d:depth>infinity</d:depth></d:scope></d:from>
+    <d:where>
+      <d:and>
+        <d:like><d:prop><d:displayname/></d:prop><d:literal>%report%</d:literal></d:like>
+        <d:gt><d:prop><d:getcontentlength/></d:prop><d:literal>2</d:literal></d:gt>
+        <d:not><d:is-collection/></d:not>
+      </d:and>
+    </d:where>
+    <d:limit><d:nresults>10</d:nresults></d:limit>
+  </d:basicsearch>
+</d:searchrequest>`
+
+func TestParseSearchRequest(t *testing.T) {
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+
+	query, err := svc.parseSearchRequest(newPartialUpdateRequest("SEARCH", "/dav/", basicSearchBody, u))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if query.Path != "/personal" || query.ChildrenOnly || query.Limit != 10 || query.NamePattern != "%report%" {
+		t.Fatalf("unexpected query: %+v", query)
+	}
+	if query.MinSize == nil || *query.MinSize != 3 || query.IsDir == nil || *query.IsDir {
+		t.Fatalf("unexpected filters: %+v", query)
+	}
+
+	unsupported := strings.Replace(basicSearchBody, "<d:and>", "<d:or>", 1)
+	unsupported = strings.Replace(unsupported, "</d:and>", "</d:or>", 1)
+	if _, err := svc.parseSearchRequest(newPartialUpdateRequest("SEARCH", "/dav/", unsupported, u)); !errors.Is(err, errSearchUnsupported) {
+		t.Fatalf("or: err = %v, want errSearchUnsupported", err)
+	}
+}
+
+func TestWebDAVSearchReturnsMultistatus(t *testing.T) {
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+
+	resp := newBufferedStatusRecorder()
+	svc.ServeHTTP(resp, newPartialUpdateRequest("SEARCH", "/dav/", basicSearchBody, u))
+	if resp.status != http.StatusNotImplemented {
+		t.Fatalf("status without search = %d, want 501", resp.status)
+	}
+
+	svc.config.Search.Enabled = true
+	search := NewSearchService(svc.config, newMemorySearchRepo(), allowPermissionChecker{}, svc.userRepo, nil)
+	svc.SetSearchService(search)
+	seedPartialUpdateFile(t, svc, u, "personal/q1 report.txt", "quarter")
+	seedPartialUpdateFile(t, svc, u, "personal/tiny report.txt", "x")
+	seedPartialUpdateFile(t, svc, u, "apps/other report.txt", "elsewhere")
+	if _, err := search.Reindex(t.Context(), u); err != nil {
+		t.Fatal(err)
+	}
+
+	resp = newBufferedStatusRecorder()
+	svc.ServeHTTP(resp, newPartialUpdateRequest("SEARCH", "/dav/", basicSearchBody, u))
+	if resp.status != http.StatusMultiStatus {
+		t.Fatalf("status = %d, body = %s", resp.status, resp.body.String())
+	}
+	body := resp.body.String()
+	if !strings.Contains(body, "<D:href>/dav/personal/q1%20report.txt</D:href>") {
+		t.Fatalf("missing match in %s", body)
+	}
+	if strings.Contains(body, "tiny") || strings.Contains(body, "other") {
+		t.Fatalf("size or scope filter ignored: %s", body)
+	}
+}
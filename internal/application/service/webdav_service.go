@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
@@ -17,12 +18,14 @@ import (
 	warehousedocs "github.com/yeying-community/warehouse/docs"
 	"github.com/yeying-community/warehouse/internal/application/assetspace"
 	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 	"github.com/yeying-community/warehouse/internal/domain/permission"
 	"github.com/yeying-community/warehouse/internal/domain/quota"
 	"github.com/yeying-community/warehouse/internal/domain/recycle"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	webdavfs "github.com/yeying-community/warehouse/internal/infrastructure/webdav"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
@@ -43,12 +46,57 @@ type WebDAVService struct {
 	logger           *zap.Logger
 	lockSystem       webdav.LockSystem
 	recycleDir       string // 回收站目录
+	archiveService   *ArchiveService
+	uploadPolicy     *UploadPolicyEnforcer
+	versionService   *VersionService
+	dedup            *DedupService
+	search           *SearchService
+	teams            *TeamService
+	storage          storage.Backend
+
+	partialUpdateLocks pathLocks
+	deleteBatches      deleteBatches
 }
 
 func (s *WebDAVService) SetPublicShareRepository(repo repository.ShareRepository) {
 	s.publicShareRepo = repo
 }
 
+// SetArchiveService 启用目录 GET 打包下载
+func (s *WebDAVService) SetArchiveService(archives *ArchiveService) {
+	s.archiveService = archives
+}
+
+// SetUploadPolicyEnforcer 启用上传策略（大小 / 类型 / 单目录条目数）校验
+func (s *WebDAVService) SetUploadPolicyEnforcer(enforcer *UploadPolicyEnforcer) {
+	s.uploadPolicy = enforcer
+}
+
+// SetVersionService 启用覆盖写入前的历史版本保留与只读 /.versions 目录
+func (s *WebDAVService) SetVersionService(versions *VersionService) {
+	s.versionService = versions
+}
+
+// SetDedupService 启用内容寻址去重：PUT 与 COPY 成功后把内容链接到 blob
+func (s *WebDAVService) SetDedupService(dedup *DedupService) {
+	s.dedup = dedup
+}
+
+// SetStorage 设置文件内容所在的存储后端，默认为本地磁盘
+func (s *WebDAVService) SetStorage(backend storage.Backend) {
+	if backend != nil {
+		s.storage = backend
+	}
+}
+
+// backend 返回存储后端；未经构造函数创建的实例回退到本地磁盘
+func (s *WebDAVService) backend() storage.Backend {
+	if s.storage == nil {
+		return storage.NewLocal()
+	}
+	return s.storage
+}
+
 const userGuideWebDAVFileName = "Warehouse 用户使用指南.md"
 
 type usedSpaceMutation struct {
@@ -109,6 +157,7 @@ func NewWebDAVService(
 		logger:           logger,
 		lockSystem:       webdav.NewMemLS(),
 		recycleDir:       recycleDir,
+		storage:          storage.NewLocal(),
 	}
 }
 
@@ -122,6 +171,12 @@ func (s *WebDAVService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 经 Nextcloud 等兼容路径访问时，路径中的用户名必须是当前用户
+	if mount, mounted := webdavMountFromContext(r.Context()); mounted && mount.owner != "" && !strings.EqualFold(mount.owner, u.Username) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	// WebDAV 可能包含大文件上传/下载。清空当前请求的连接 deadline，
 	// 避免被全局 ReadTimeout/WriteTimeout（默认 30s）中途截断。
 	s.clearWebDAVDeadlines(w)
@@ -139,6 +194,13 @@ func (s *WebDAVService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 团队空间：/teams/<id>/... 以团队存储账号身份处理，目录、配额、回收站与版本都属于团队
+	u, ok = s.resolveTeamSpacePrincipal(w, r, u)
+	if !ok {
+		return
+	}
+	_, teamSpace := s.teamSpaceID(r.URL.Path)
+
 	// 获取用户目录
 	userDir := s.getUserDirectory(u)
 	s.logger.Debug("user directory", zap.String("username", u.Username), zap.String("directory", userDir))
@@ -152,19 +214,23 @@ func (s *WebDAVService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 确保资产空间目录存在（personal + apps + services）
-	if err := s.ensureAssetSpaces(userDir); err != nil {
-		s.logger.Error("failed to ensure asset spaces",
-			zap.String("directory", userDir),
-			zap.Error(err))
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-		return
+	// 确保资产空间目录存在（personal + apps + services）；团队空间根目录不划分资产空间
+	if !teamSpace {
+		if err := s.ensureAssetSpaces(userDir); err != nil {
+			s.logger.Error("failed to ensure asset spaces",
+				zap.String("directory", userDir),
+				zap.Error(err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
 	}
 
 	// 规范化 MOVE/COPY 的 Destination 头，避免编码或代理导致的路径异常
 	if r.Method == "MOVE" || r.Method == "COPY" {
 		normalizeDestinationHeader(r)
 	}
+	// 统一路径名的 Unicode 形式（macOS 客户端发送 NFD），避免同名文件存成两份
+	NormalizeRequestPathNames(NamePolicy(s.config), r)
 
 	// UCAN app scope 校验
 	if err := s.checkAppScope(r.Context(), r); err != nil {
@@ -203,20 +269,58 @@ func (s *WebDAVService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 创建 WebDAV 处理器（使用自定义的 Unicode FileSystem）
-	unicodeFS := webdavfs.NewUnicodeFileSystemWithVirtualFiles(userDir, s.userGuideVirtualFiles())
-	handler := &webdav.Handler{
-		Prefix:     s.config.WebDAV.Prefix,
-		FileSystem: unicodeFS,
-		LockSystem: s.lockSystem,
-		Logger:     s.createLogger(u.Username),
+	// 大小写 / Unicode 形式冲突保护：目标与同目录已有条目仅大小写不同时返回 409
+	if err := s.checkNameCollision(userDir, r); err != nil {
+		s.logger.Warn("path name collision",
+			zap.String("username", u.Username),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	// 上传策略：单文件大小、扩展名 / MIME 与单目录条目数；MOVE / COPY 按目标路径、
+	// MKCOL 按父目录条目数校验，避免借改名或复制绕过
+	if err := s.checkUploadPolicyForMethod(w, r, u, userDir); err != nil {
+		s.logger.Warn("upload policy violation",
+			zap.String("username", u.Username),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Error(err))
+		WriteUploadPolicyError(w, err)
+		return
+	}
+
+	// SEARCH：按文件名与元数据查询搜索索引
+	if r.Method == "SEARCH" {
+		s.handleSearch(w, r, u)
+		return
 	}
 
+	// 创建 WebDAV 处理器（使用自定义的 Unicode FileSystem）
+	unicodeFS := webdavfs.NewUnicodeFileSystemWithVirtualFiles(userDir, s.virtualFiles(r.Context(), u, r))
+	unicodeFS.SetBackend(s.backend())
+	unicodeFS.SetNamePolicy(NamePolicy(s.config))
+	handler := s.newDAVHandler(r, unicodeFS, u.Username)
+
 	// 设置响应头
 	if s.config.WebDAV.NoSniff {
 		w.Header().Set("X-Content-Type-Options", "nosniff")
 	}
 
+	// 断点续传：PATCH + X-Update-Range 或 PUT + Content-Range 直接按区间写入
+	if isPartialUpdateRequest(r) {
+		s.handlePartialUpdate(w, r, u, userDir)
+		return
+	}
+
+	// 目录 GET：按 ZIP / tar.gz 流式打包下载
+	if s.isCollectionArchiveRequest(userDir, r) {
+		s.handleCollectionArchive(w, r, u, userDir)
+		return
+	}
+
 	// 处理 DELETE 请求：将文件移动到回收站
 	if r.Method == http.MethodDelete {
 		s.handleDeleteWithRecycle(w, r, u, userDir, handler)
@@ -235,12 +339,28 @@ func (s *WebDAVService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// 覆盖写入前暂存旧内容，写入成功后才保留为历史版本
+		var pendingVersion *PendingVersion
+		if r.Method == http.MethodPut {
+			pendingVersion, err = s.versionService.Prepare(r.Context(), u, s.resolveUserFullPath(userDir, r.URL.Path), VersionSourceWebDAV)
+			if err != nil {
+				s.logger.Error("failed to retain file version",
+					zap.String("username", u.Username),
+					zap.String("path", r.URL.Path),
+					zap.Error(err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
 		rec := newBufferedStatusRecorder()
 		handler.ServeHTTP(rec, r)
+		_, _ = s.versionService.Finish(r.Context(), pendingVersion, rec.status >= 200 && rec.status < 300)
 
 		if rec.status >= 200 && rec.status < 300 {
-			if err := s.syncUserSharePathsForMove(r.Context(), u, userDir, r); err != nil {
-				s.logger.Error("failed to sync share paths after move",
+			s.ingestAfterWrite(userDir, r)
+			if err := s.syncPathsForMove(r.Context(), u, userDir, r); err != nil {
+				s.logger.Error("failed to sync share and version paths after move",
 					zap.String("username", u.Username),
 					zap.String("method", r.Method),
 					zap.String("path", r.URL.Path),
@@ -274,8 +394,9 @@ func (s *WebDAVService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 }
 
-func (s *WebDAVService) syncUserSharePathsForMove(ctx context.Context, u *user.User, userDir string, r *http.Request) error {
-	if (s.userShareRepo == nil && s.publicShareRepo == nil) || u == nil || r == nil || strings.ToUpper(strings.TrimSpace(r.Method)) != "MOVE" {
+// syncPathsForMove MOVE 成功后同步分享路径，并把历史版本迁移到新路径
+func (s *WebDAVService) syncPathsForMove(ctx context.Context, u *user.User, userDir string, r *http.Request) error {
+	if u == nil || r == nil || strings.ToUpper(strings.TrimSpace(r.Method)) != "MOVE" {
 		return nil
 	}
 	destination := strings.TrimSpace(r.Header.Get("Destination"))
@@ -284,7 +405,38 @@ func (s *WebDAVService) syncUserSharePathsForMove(ctx context.Context, u *user.U
 	}
 	fromPath := s.resolveUserFullPath(userDir, r.URL.Path)
 	toPath := s.resolveUserFullPath(userDir, destination)
-	return SyncAllSharePathsForOwnerMove(ctx, s.userShareRepo, s.publicShareRepo, s.config, u, fromPath, toPath)
+	if s.userShareRepo != nil || s.publicShareRepo != nil {
+		if err := SyncAllSharePathsForOwnerMove(ctx, s.userShareRepo, s.publicShareRepo, s.config, u, fromPath, toPath); err != nil {
+			return err
+		}
+	}
+	// 历史版本按路径存放，随文件一起迁移
+	info, err := s.backend().Stat(toPath)
+	if err != nil {
+		return nil
+	}
+	return s.versionService.MovePath(ctx, u, fromPath, toPath, info.IsDir())
+}
+
+// virtualFiles 返回本次请求可见的虚拟文件；/.versions 树仅在访问其内部时构建，根目录只列出入口
+func (s *WebDAVService) virtualFiles(ctx context.Context, u *user.User, r *http.Request) []webdavfs.VirtualFile {
+	var files []webdavfs.VirtualFile
+	if _, teamSpace := s.teamSpaceID(r.URL.Path); !teamSpace {
+		files = s.userGuideVirtualFiles()
+	}
+	if s.versionService == nil {
+		return files
+	}
+	requestPath := path.Clean("/" + strings.TrimLeft(s.normalizeWebdavRequestPath(r.URL.Path), "/"))
+	switch {
+	case requestPath == VersionsVirtualRoot || strings.HasPrefix(requestPath, VersionsVirtualRoot+"/"):
+		files = append(files, webdavfs.VirtualFile{Path: VersionsVirtualRoot, Dir: true})
+		files = append(files, s.versionService.VirtualFiles(ctx, u)...)
+	case requestPath == "/" && s.versionService.HasVersions(u):
+		// 根目录只需展示 /.versions 入口，不读取各文件的版本索引
+		files = append(files, webdavfs.VirtualFile{Path: VersionsVirtualRoot, Dir: true})
+	}
+	return files
 }
 
 func (s *WebDAVService) userGuideVirtualFiles() []webdavfs.VirtualFile {
@@ -344,7 +496,7 @@ func isIgnoredWebDAVPath(rawPath string) bool {
 }
 
 // handleDeleteWithRecycle 处理删除请求（带回收站功能）
-func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.Request, u *user.User, userDir string, handler *webdav.Handler) {
+func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.Request, u *user.User, userDir string, handler http.Handler) {
 	// 获取文件相对路径（剥离 WebDAV 前缀）
 	normalizedPath := s.normalizeWebdavRequestPath(r.URL.Path)
 	filePath := strings.TrimPrefix(normalizedPath, "/")
@@ -353,7 +505,7 @@ func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.R
 	fullPath := filepath.Join(userDir, filePath)
 
 	// 检查是否存在
-	if _, err := os.Stat(fullPath); err != nil {
+	if _, err := s.backend().Stat(fullPath); err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
@@ -363,7 +515,7 @@ func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	info, err := os.Stat(fullPath)
+	info, err := s.backend().Stat(fullPath)
 	if err != nil {
 		s.logger.Error("failed to stat file before recycle", zap.Error(err))
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -375,8 +527,12 @@ func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	// 文件/目录移动到回收站目录
-	moved, err := s.moveToRecycle(r.Context(), u, filePath, fullPath, info.IsDir())
+	// 文件/目录移动到回收站目录；客户端逐项递归删除同一目录树的 DELETE 共享删除批次，便于整体恢复
+	batchID := requestDeleteBatchID(r)
+	if batchID == "" {
+		batchID = s.deleteBatches.assign(u.ID, filePath, time.Now())
+	}
+	moved, err := s.moveToRecycle(r.Context(), u, filePath, fullPath, info.IsDir(), batchID)
 	if err != nil {
 		s.logger.Error("failed to move file to recycle", zap.Error(err))
 		if moved {
@@ -387,7 +543,7 @@ func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.R
 		rec := newBufferedStatusRecorder()
 		handler.ServeHTTP(rec, r)
 		if rec.status >= 200 && rec.status < 300 {
-			if err := RemoveAllShareReferencesForOwnerPath(r.Context(), s.userShareRepo, s.publicShareRepo, s.config, u, fullPath); err != nil {
+			if err := s.removePathReferences(r.Context(), u, fullPath, info.IsDir()); err != nil {
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
@@ -409,7 +565,7 @@ func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.R
 		}
 		return
 	}
-	if err := RemoveAllShareReferencesForOwnerPath(r.Context(), s.userShareRepo, s.publicShareRepo, s.config, u, fullPath); err != nil {
+	if err := s.removePathReferences(r.Context(), u, fullPath, info.IsDir()); err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
@@ -418,6 +574,14 @@ func (s *WebDAVService) handleDeleteWithRecycle(w http.ResponseWriter, r *http.R
 	w.WriteHeader(http.StatusOK)
 }
 
+// removePathReferences 删除文件或目录后清理指向它的分享与历史版本
+func (s *WebDAVService) removePathReferences(ctx context.Context, u *user.User, fullPath string, isDir bool) error {
+	if err := RemoveAllShareReferencesForOwnerPath(ctx, s.userShareRepo, s.publicShareRepo, s.config, u, fullPath); err != nil {
+		return err
+	}
+	return s.versionService.RemovePath(ctx, u, fullPath, isDir)
+}
+
 func (s *WebDAVService) handleDirectDelete(
 	w http.ResponseWriter,
 	r *http.Request,
@@ -425,11 +589,11 @@ func (s *WebDAVService) handleDirectDelete(
 	fullPath string,
 	isDir bool,
 	sizeHint int64,
-	handler *webdav.Handler,
+	handler http.Handler,
 ) {
 	sizeDelta := sizeHint
 	if isDir {
-		totalSize, err := calculatePathSize(fullPath)
+		totalSize, err := calculatePathSize(s.backend(), fullPath)
 		if err != nil && !errors.Is(err, os.ErrNotExist) {
 			s.logger.Error("failed to calculate path size before hard delete",
 				zap.String("path", fullPath),
@@ -443,7 +607,7 @@ func (s *WebDAVService) handleDirectDelete(
 	rec := newBufferedStatusRecorder()
 	handler.ServeHTTP(rec, r)
 	if rec.status >= 200 && rec.status < 300 {
-		if err := RemoveAllShareReferencesForOwnerPath(r.Context(), s.userShareRepo, s.publicShareRepo, s.config, u, fullPath); err != nil {
+		if err := s.removePathReferences(r.Context(), u, fullPath, isDir); err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -514,9 +678,9 @@ func IsEphemeralSyncArtifactPath(normalizedPath string) bool {
 }
 
 // moveToRecycle 将文件移动到回收站并保存记录
-func (s *WebDAVService) moveToRecycle(ctx context.Context, u *user.User, relativePath, fullPath string, isDir bool) (bool, error) {
+func (s *WebDAVService) moveToRecycle(ctx context.Context, u *user.User, relativePath, fullPath string, isDir bool, batchID string) (bool, error) {
 	// 获取文件信息
-	info, err := os.Stat(fullPath)
+	info, err := s.backend().Stat(fullPath)
 	if err != nil {
 		return false, fmt.Errorf("failed to stat file: %w", err)
 	}
@@ -526,7 +690,7 @@ func (s *WebDAVService) moveToRecycle(ctx context.Context, u *user.User, relativ
 	}
 
 	// 确保回收站目录存在
-	if err := os.MkdirAll(s.recycleDir, 0755); err != nil {
+	if err := s.backend().MkdirAll(s.recycleDir, 0755); err != nil {
 		return false, fmt.Errorf("failed to create recycle dir: %w", err)
 	}
 
@@ -547,13 +711,16 @@ func (s *WebDAVService) moveToRecycle(ctx context.Context, u *user.User, relativ
 
 	// 创建回收站记录（先生成 hash，便于文件命名）
 	item := recycle.NewRecycleItem(u.ID, u.Username, dirName, fileName, cleanRelative, isDir, fileSize)
+	if batchID != "" {
+		item.BatchID = batchID
+	}
 
 	// 生成唯一的回收站文件名：{hash}_{原文件名}
 	recycleFileName := fmt.Sprintf("%s_%s", item.Hash, fileName)
 	recyclePath := filepath.Join(s.recycleDir, recycleFileName)
 
 	// 移动文件
-	if err := os.Rename(fullPath, recyclePath); err != nil {
+	if err := s.backend().Rename(fullPath, recyclePath); err != nil {
 		return false, fmt.Errorf("failed to move file to recycle: %w", err)
 	}
 
@@ -595,7 +762,7 @@ func (s *WebDAVService) moveToRecycle(ctx context.Context, u *user.User, relativ
 
 // isUploadMethod 判断是否为上传方法
 func isUploadMethod(method string) bool {
-	return method == "PUT" || method == "POST" || method == "MKCOL" || method == "COPY"
+	return method == "PUT" || method == "PATCH" || method == "POST" || method == "MKCOL" || method == "COPY"
 }
 
 // isMutatingMethod 判断是否为可能改变存储的 WebDAV 方法
@@ -629,21 +796,25 @@ func (s *WebDAVService) checkQuota(ctx context.Context, u *user.User, r *http.Re
 }
 
 func (s *WebDAVService) estimateQuotaAdditionalSize(u *user.User, r *http.Request) (int64, error) {
+	if isPartialUpdateRequest(r) {
+		return s.estimatePartialUpdateAdditionalSize(u, r)
+	}
 	switch r.Method {
 	case "MKCOL":
 		return 0, nil
 	case "PUT", "POST":
-		newSize, err := s.readRequestBodySize(r)
-		if err != nil {
-			return 0, err
-		}
+		newSize := requestBodySize(r)
 
 		userDir := s.getUserDirectory(u)
 		targetPath := s.resolveUserFullPath(userDir, r.URL.Path)
-		oldSize, err := getExistingFileSize(targetPath)
+		oldSize, err := getExistingFileSize(s.backend(), targetPath)
 		if err != nil {
 			return 0, err
 		}
+		if s.versionService.Enabled() {
+			// 旧内容作为历史版本保留并继续计入额度
+			oldSize = 0
+		}
 
 		if newSize <= oldSize {
 			return 0, nil
@@ -657,48 +828,28 @@ func (s *WebDAVService) estimateQuotaAdditionalSize(u *user.User, r *http.Reques
 			return 0, fmt.Errorf("missing Destination header for COPY")
 		}
 		targetPath := s.resolveUserFullPath(userDir, destination)
-		return estimateCopyQuotaDelta(sourcePath, targetPath)
+		return estimateCopyQuotaDelta(s.backend(), sourcePath, targetPath)
 	default:
 		return 0, nil
 	}
 }
 
-func (s *WebDAVService) readRequestBodySize(r *http.Request) (int64, error) {
-	var fileSize int64
-
-	// 从 Content-Length 头获取大小
-	if contentLength := r.Header.Get("Content-Length"); contentLength != "" {
-		size, err := strconv.ParseInt(contentLength, 10, 64)
-		if err == nil {
-			fileSize = size
-		}
+// requestBodySize 返回声明的请求体大小，不读取 body。
+// 未声明长度（chunked）时返回 0，实际占用在写入完成后按增量记账。
+func requestBodySize(r *http.Request) int64 {
+	if r.ContentLength > 0 {
+		return r.ContentLength
 	}
-
-	// 如果没有 Content-Length，尝试读取 body
-	if fileSize == 0 && r.Body != nil {
-		// 注意：这会消耗 body，需要重新设置
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			return 0, fmt.Errorf("failed to read body: %w", err)
+	if contentLength := r.Header.Get("Content-Length"); contentLength != "" {
+		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil && size > 0 {
+			return size
 		}
-		fileSize = int64(len(body))
-		// 重新设置 body
-		r.Body = io.NopCloser(io.NewSectionReader(
-			io.NewSectionReader(
-				&bodyReader{data: body},
-				0,
-				int64(len(body)),
-			),
-			0,
-			int64(len(body)),
-		))
 	}
-
-	return fileSize, nil
+	return 0
 }
 
-func getExistingFileSize(targetPath string) (int64, error) {
-	info, err := os.Stat(targetPath)
+func getExistingFileSize(b storage.Backend, targetPath string) (int64, error) {
+	info, err := b.Stat(targetPath)
 	if err == nil {
 		if info.IsDir() {
 			return 0, nil
@@ -718,8 +869,8 @@ func calculateFileSizeOrZero(info os.FileInfo) int64 {
 	return info.Size()
 }
 
-func getExistingPathSize(targetPath string) (int64, error) {
-	size, err := calculatePathSize(targetPath)
+func getExistingPathSize(b storage.Backend, targetPath string) (int64, error) {
+	size, err := calculatePathSize(b, targetPath)
 	if err == nil {
 		return size, nil
 	}
@@ -729,8 +880,8 @@ func getExistingPathSize(targetPath string) (int64, error) {
 	return 0, fmt.Errorf("stat existing path: %w", err)
 }
 
-func calculatePathSize(targetPath string) (int64, error) {
-	info, err := os.Stat(targetPath)
+func calculatePathSize(b storage.Backend, targetPath string) (int64, error) {
+	info, err := b.Stat(targetPath)
 	if err != nil {
 		return 0, err
 	}
@@ -739,15 +890,16 @@ func calculatePathSize(targetPath string) (int64, error) {
 	}
 
 	var totalSize int64
-	err = filepath.Walk(targetPath, func(path string, info os.FileInfo, walkErr error) error {
+	err = b.WalkDir(targetPath, func(path string, entry fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
-		if path == targetPath {
+		if path == targetPath || entry.IsDir() {
 			return nil
 		}
-		if info == nil || info.IsDir() {
-			return nil
+		info, err := entry.Info()
+		if err != nil {
+			return err
 		}
 		totalSize += info.Size()
 		return nil
@@ -758,13 +910,13 @@ func calculatePathSize(targetPath string) (int64, error) {
 	return totalSize, nil
 }
 
-func estimateCopyQuotaDelta(sourcePath, targetPath string) (int64, error) {
-	sourceInfo, err := os.Stat(sourcePath)
+func estimateCopyQuotaDelta(b storage.Backend, sourcePath, targetPath string) (int64, error) {
+	sourceInfo, err := b.Stat(sourcePath)
 	if err != nil {
 		return 0, err
 	}
 	if !sourceInfo.IsDir() {
-		targetSize, err := getExistingFileSize(targetPath)
+		targetSize, err := getExistingFileSize(b, targetPath)
 		if err != nil {
 			return 0, err
 		}
@@ -774,8 +926,8 @@ func estimateCopyQuotaDelta(sourcePath, targetPath string) (int64, error) {
 		return sourceInfo.Size() - targetSize, nil
 	}
 
-	if targetInfo, err := os.Stat(targetPath); err == nil && !targetInfo.IsDir() {
-		sourceSize, err := calculatePathSize(sourcePath)
+	if targetInfo, err := b.Stat(targetPath); err == nil && !targetInfo.IsDir() {
+		sourceSize, err := calculatePathSize(b, sourcePath)
 		if err != nil {
 			return 0, err
 		}
@@ -788,7 +940,7 @@ func estimateCopyQuotaDelta(sourcePath, targetPath string) (int64, error) {
 	}
 
 	var delta int64
-	err = filepath.WalkDir(sourcePath, func(current string, entry os.DirEntry, walkErr error) error {
+	err = b.WalkDir(sourcePath, func(current string, entry fs.DirEntry, walkErr error) error {
 		if walkErr != nil {
 			return walkErr
 		}
@@ -804,7 +956,7 @@ func estimateCopyQuotaDelta(sourcePath, targetPath string) (int64, error) {
 			return err
 		}
 		targetFile := filepath.Join(targetPath, rel)
-		targetSize, err := getExistingFileSize(targetFile)
+		targetSize, err := getExistingFileSize(b, targetFile)
 		if err != nil {
 			return err
 		}
@@ -819,32 +971,6 @@ func estimateCopyQuotaDelta(sourcePath, targetPath string) (int64, error) {
 	return delta, nil
 }
 
-// bodyReader 用于重新读取 body
-type bodyReader struct {
-	data []byte
-	pos  int
-}
-
-func (b *bodyReader) Read(p []byte) (n int, err error) {
-	if b.pos >= len(b.data) {
-		return 0, io.EOF
-	}
-	n = copy(p, b.data[b.pos:])
-	b.pos += n
-	return n, nil
-}
-
-func (b *bodyReader) ReadAt(p []byte, off int64) (n int, err error) {
-	if off >= int64(len(b.data)) {
-		return 0, io.EOF
-	}
-	n = copy(p, b.data[off:])
-	if n < len(p) {
-		err = io.EOF
-	}
-	return n, err
-}
-
 // normalizeDestinationHeader 规范化 Destination 头，处理编码和代理前缀差异
 func normalizeDestinationHeader(r *http.Request) {
 	dest := r.Header.Get("Destination")
@@ -870,6 +996,103 @@ func normalizeDestinationHeader(r *http.Request) {
 	r.Header.Set("Destination", path)
 }
 
+// NormalizeRequestPathNames 按配置将请求路径与 Destination 规范化为 NFC
+func NormalizeRequestPathNames(names pathname.Policy, r *http.Request) {
+	if normalized := names.Normalize(r.URL.Path); normalized != r.URL.Path {
+		r.URL.Path = normalized
+		r.URL.RawPath = ""
+	}
+	if dest := r.Header.Get("Destination"); dest != "" {
+		r.Header.Set("Destination", names.Normalize(dest))
+	}
+}
+
+// checkUploadPolicyForMethod 按请求方法选择上传策略校验：PUT 校验请求体，
+// MOVE / COPY 校验落到目标位置的每个文件，MKCOL 校验父目录条目数
+func (s *WebDAVService) checkUploadPolicyForMethod(w http.ResponseWriter, r *http.Request, u *user.User, userDir string) error {
+	if s.uploadPolicy == nil {
+		return nil
+	}
+	switch r.Method {
+	case http.MethodPut:
+		if isPartialUpdateRequest(r) {
+			return nil
+		}
+		return s.checkUploadPolicy(w, r, u, userDir, r.ContentLength)
+	case "MOVE", "COPY":
+		destination := r.Header.Get("Destination")
+		if destination == "" {
+			return nil
+		}
+		return s.uploadPolicy.CheckTransfer(u, s.permissionPath(u, destination),
+			s.resolveUserFullPath(userDir, r.URL.Path), s.resolveUserFullPath(userDir, destination))
+	case "MKCOL":
+		return s.uploadPolicy.CheckDirectory(u, s.permissionPath(u, r.URL.Path), s.resolveUserFullPath(userDir, r.URL.Path))
+	default:
+		return nil
+	}
+}
+
+// checkUploadPolicy 按目标路径生效的上传策略校验 PUT；Content-Length 未知时
+// 用 MaxBytesReader 限制请求体不超过单文件上限
+func (s *WebDAVService) checkUploadPolicy(w http.ResponseWriter, r *http.Request, u *user.User, userDir string, size int64) error {
+	if s.uploadPolicy == nil {
+		return nil
+	}
+	permissionPath := s.permissionPath(u, r.URL.Path)
+	contentType := r.Header.Get("Content-Type")
+	if r.Method == http.MethodPatch {
+		contentType = ""
+	}
+	if err := s.uploadPolicy.Check(UploadTarget{
+		Owner:          u,
+		PermissionPath: permissionPath,
+		FullPath:       s.resolveUserFullPath(userDir, r.URL.Path),
+		Size:           size,
+		ContentType:    contentType,
+	}); err != nil {
+		return err
+	}
+	if size < 0 && r.Body != nil {
+		if limit := s.uploadPolicy.MaxFileSize(u, permissionPath); limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+	}
+	return nil
+}
+
+// permissionPath 返回规则匹配使用的路径（用户目录 + 请求路径）
+func (s *WebDAVService) permissionPath(u *user.User, rawPath string) string {
+	userDir := u.Directory
+	if userDir == "" {
+		userDir = u.Username
+	}
+	return filepath.Join(userDir, strings.TrimPrefix(s.normalizeWebdavRequestPath(rawPath), "/"))
+}
+
+// checkNameCollision 检查会新建条目的请求是否与已有条目仅大小写不同
+func (s *WebDAVService) checkNameCollision(userDir string, r *http.Request) error {
+	switch r.Method {
+	case http.MethodPut, "MKCOL":
+		return NamePolicy(s.config).WithFS(s.backend()).CheckCollision(s.resolveUserFullPath(userDir, r.URL.Path))
+	case "MOVE", "COPY":
+		destination := strings.TrimSpace(r.Header.Get("Destination"))
+		if destination == "" {
+			return nil
+		}
+		err := NamePolicy(s.config).WithFS(s.backend()).CheckCollision(s.resolveUserFullPath(userDir, destination))
+		var collision *pathname.CollisionError
+		if r.Method == "MOVE" && errors.As(err, &collision) &&
+			collision.Existing == s.resolveUserFullPath(userDir, r.URL.Path) {
+			// 仅修改大小写的重命名命中的是源文件自身
+			return nil
+		}
+		return err
+	default:
+		return nil
+	}
+}
+
 // createLogger 创建 WebDAV 日志记录器
 func (s *WebDAVService) createLogger(username string) func(*http.Request, error) {
 	return func(r *http.Request, err error) {
@@ -1026,8 +1249,8 @@ func (s *WebDAVService) getUserDirectory(u *user.User) string {
 		if filepath.IsAbs(u.Directory) {
 			return u.Directory
 		}
-		// 否则拼接到基础目录
-		return filepath.Join(s.config.WebDAV.Directory, u.Directory)
+		// 否则拼接到用户所在卷
+		return filepath.Join(userVolumeBase(s.config, u.Volume, u.Directory), u.Directory)
 	}
 
 	// 使用基础目录
@@ -1036,11 +1259,11 @@ func (s *WebDAVService) getUserDirectory(u *user.User) string {
 
 // ensureDirectory 确保目录存在
 func (s *WebDAVService) ensureDirectory(dir string) error {
-	info, err := os.Stat(dir)
+	info, err := s.backend().Stat(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// 创建目录
-			if err := os.MkdirAll(dir, 0755); err != nil {
+			if err := s.backend().MkdirAll(dir, 0755); err != nil {
 				return fmt.Errorf("failed to create directory: %w", err)
 			}
 			s.logger.Info("directory created", zap.String("directory", dir))
@@ -1070,7 +1293,7 @@ func (s *WebDAVService) recordMutation(ctx context.Context, userDir string, r *h
 	case "MKCOL":
 		return s.mutationRecorder.EnsureDir(ctx, fullPath)
 	case "PUT", "POST":
-		info, err := os.Stat(fullPath)
+		info, err := s.backend().Stat(fullPath)
 		if err != nil {
 			return fmt.Errorf("stat mutated path: %w", err)
 		}
@@ -1087,7 +1310,7 @@ func (s *WebDAVService) recordMutation(ctx context.Context, userDir string, r *h
 			return fmt.Errorf("missing Destination header for MOVE")
 		}
 		toPath := s.resolveUserFullPath(userDir, destination)
-		info, err := os.Stat(toPath)
+		info, err := s.backend().Stat(toPath)
 		if err != nil {
 			return fmt.Errorf("stat destination after MOVE: %w", err)
 		}
@@ -1101,7 +1324,7 @@ func (s *WebDAVService) recordMutation(ctx context.Context, userDir string, r *h
 			return fmt.Errorf("missing Destination header for COPY")
 		}
 		toPath := s.resolveUserFullPath(userDir, destination)
-		info, err := os.Stat(toPath)
+		info, err := s.backend().Stat(toPath)
 		if err != nil {
 			return fmt.Errorf("stat destination after COPY: %w", err)
 		}
@@ -1114,10 +1337,22 @@ func (s *WebDAVService) recordMutation(ctx context.Context, userDir string, r *h
 	}
 }
 
+// NamePolicy 返回配置中的文件名规范化策略（NFC / 大小写冲突保护），
+// 由各入口显式持有，不再依赖进程级全局状态
+func NamePolicy(cfg *config.Config) pathname.Policy {
+	if cfg == nil {
+		return pathname.Policy{}
+	}
+	return pathname.Policy{
+		NFC:             cfg.WebDAV.UnicodeNFC,
+		CaseInsensitive: cfg.WebDAV.CaseInsensitiveGuard,
+	}
+}
+
 func (s *WebDAVService) resolveUserFullPath(userDir, rawPath string) string {
 	normalizedPath := s.normalizeWebdavRequestPath(rawPath)
 	relativePath := strings.TrimPrefix(normalizedPath, "/")
-	return filepath.Join(userDir, filepath.FromSlash(relativePath))
+	return NamePolicy(s.config).WithFS(s.backend()).Resolve(userDir, filepath.Join(userDir, filepath.FromSlash(relativePath)))
 }
 
 func (s *WebDAVService) prepareUsedSpaceMutation(u *user.User, userDir string, r *http.Request) (*usedSpaceMutation, error) {
@@ -1128,7 +1363,7 @@ func (s *WebDAVService) prepareUsedSpaceMutation(u *user.User, userDir string, r
 	switch r.Method {
 	case "PUT", "POST":
 		mutation.targetPath = s.resolveUserFullPath(userDir, r.URL.Path)
-		size, err := getExistingPathSize(mutation.targetPath)
+		size, err := getExistingPathSize(s.backend(), mutation.targetPath)
 		if err != nil {
 			return nil, err
 		}
@@ -1140,7 +1375,7 @@ func (s *WebDAVService) prepareUsedSpaceMutation(u *user.User, userDir string, r
 			return nil, fmt.Errorf("missing Destination header for COPY")
 		}
 		mutation.targetPath = s.resolveUserFullPath(userDir, destination)
-		delta, err := estimateCopyQuotaDelta(mutation.sourcePath, mutation.targetPath)
+		delta, err := estimateCopyQuotaDelta(s.backend(), mutation.sourcePath, mutation.targetPath)
 		if err != nil {
 			return nil, err
 		}
@@ -1160,7 +1395,7 @@ func (s *WebDAVService) applyUsedSpaceMutation(ctx context.Context, u *user.User
 
 	switch mutation.method {
 	case "PUT", "POST":
-		newSize, calcErr := getExistingPathSize(mutation.targetPath)
+		newSize, calcErr := getExistingPathSize(s.backend(), mutation.targetPath)
 		if calcErr != nil {
 			err = calcErr
 			break
@@ -1275,7 +1510,7 @@ func (s *WebDAVService) resolvePermissionOperation(u *user.User, r *http.Request
 
 	userDir := s.getUserDirectory(u)
 	fullPath := s.resolveUserFullPath(userDir, r.URL.Path)
-	if _, err := os.Stat(fullPath); err == nil {
+	if _, err := s.backend().Stat(fullPath); err == nil {
 		return permission.OperationWrite
 	} else if os.IsNotExist(err) {
 		return permission.OperationCreate
@@ -1363,6 +1598,15 @@ func requiredActionsForWebdavMethod(method string) []string {
 }
 
 func (s *WebDAVService) normalizeWebdavRequestPath(rawPath string) string {
+	rawPath = s.stripWebdavPrefix(rawPath)
+	if teamID, rest, ok := s.splitTeamSpacePath(rawPath); ok && teamID != "" {
+		// 团队空间请求以团队目录为根
+		return rest
+	}
+	return rawPath
+}
+
+func (s *WebDAVService) stripWebdavPrefix(rawPath string) string {
 	rawPath = strings.TrimSpace(rawPath)
 	if rawPath == "" {
 		return "/"
@@ -398,10 +398,22 @@ func (r *testUserRepo) FindByUsername(_ context.Context, username string) (*user
 	}
 	return nil, user.ErrUserNotFound
 }
-func (r *testUserRepo) FindByWalletAddress(context.Context, string) (*user.User, error) {
+func (r *testUserRepo) FindByWalletAddress(_ context.Context, walletAddress string) (*user.User, error) {
+	for _, u := range r.byID {
+		if walletAddress != "" && strings.EqualFold(u.WalletAddress, walletAddress) {
+			copy := *u
+			return &copy, nil
+		}
+	}
 	return nil, user.ErrUserNotFound
 }
-func (r *testUserRepo) FindByEmail(context.Context, string) (*user.User, error) {
+func (r *testUserRepo) FindByEmail(_ context.Context, email string) (*user.User, error) {
+	for _, u := range r.byID {
+		if email != "" && u.Email == email {
+			copy := *u
+			return &copy, nil
+		}
+	}
 	return nil, user.ErrUserNotFound
 }
 func (r *testUserRepo) FindByID(_ context.Context, id string) (*user.User, error) {
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
+	"go.uber.org/zap"
+)
+
+func TestWebDAVServiceRunsOnMemoryStorage(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 0, 0, &testMutationRecorder{})
+	backend := storage.NewMemory()
+	svc.SetStorage(backend)
+	userDir := svc.getUserDirectory(u)
+
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		svc.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve(newPartialUpdateRequest("MKCOL", "/dav/docs", "", u)); rec.Code != http.StatusCreated {
+		t.Fatalf("MKCOL status = %d", rec.Code)
+	}
+	if rec := serve(newPartialUpdateRequest(http.MethodPut, "/dav/docs/a.txt", "hello world", u)); rec.Code != http.StatusCreated {
+		t.Fatalf("PUT status = %d", rec.Code)
+	}
+	patch := newPartialUpdateRequest(http.MethodPatch, "/dav/docs/a.txt", "HELLO", u)
+	patch.Header.Set("Content-Type", PartialUpdateContentType)
+	patch.Header.Set("X-Update-Range", "bytes=0-4")
+	if rec := serve(patch); rec.Code >= 300 {
+		t.Fatalf("PATCH status = %d", rec.Code)
+	}
+	move := newPartialUpdateRequest("MOVE", "/dav/docs/a.txt", "", u)
+	move.Header.Set("Destination", "/dav/docs/b.txt")
+	if rec := serve(move); rec.Code != http.StatusCreated {
+		t.Fatalf("MOVE status = %d", rec.Code)
+	}
+
+	rec := serve(newPartialUpdateRequest(http.MethodGet, "/dav/docs/b.txt", "", u))
+	if rec.Code != http.StatusOK || rec.Body.String() != "HELLO world" {
+		t.Fatalf("GET = %d %q", rec.Code, rec.Body.String())
+	}
+	data, err := storage.ReadFile(backend, filepath.Join(userDir, "docs", "b.txt"))
+	if err != nil || string(data) != "HELLO world" {
+		t.Fatalf("backend content = %q err=%v", data, err)
+	}
+	if stored, _ := svc.userRepo.FindByUsername(t.Context(), "alice"); stored.UsedSpace != 11 {
+		t.Fatalf("used space = %d, want 11", stored.UsedSpace)
+	}
+
+	if rec := serve(newPartialUpdateRequest(http.MethodDelete, "/dav/docs/b.txt", "", u)); rec.Code >= 300 {
+		t.Fatalf("DELETE status = %d", rec.Code)
+	}
+	if exists, err := storage.Exists(backend, filepath.Join(userDir, "docs", "b.txt")); err != nil || exists {
+		t.Fatalf("deleted file still present: exists=%v err=%v", exists, err)
+	}
+	entries, err := backend.ReadDir(svc.recycleDir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected deleted file in recycle dir, got %v err=%v", entries, err)
+	}
+}
+
+func TestUploadPolicyCountsEntriesOnMemoryStorage(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+	svc.config.Upload.MaxFilesPerDir = 2
+	backend := storage.NewMemory()
+	enforcer := NewUploadPolicyEnforcer(svc.config)
+	enforcer.SetStorage(backend)
+	full := filepath.Join(svc.getUserDirectory(u), "full")
+	if err := backend.MkdirAll(full, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for _, name := range []string{"one.txt", "two.txt"} {
+		if err := storage.WriteFile(backend, filepath.Join(full, name), []byte(name), 0o644); err != nil {
+			t.Fatalf("seed %s: %v", name, err)
+		}
+	}
+	source := filepath.Join(svc.getUserDirectory(u), "a.txt")
+	if err := storage.WriteFile(backend, source, []byte("a"), 0o644); err != nil {
+		t.Fatalf("seed source: %v", err)
+	}
+
+	// The directory only exists in memory, so a full directory proves the
+	// enforcer never looked at the local disk.
+	if err := enforcer.Check(UploadTarget{Owner: u, PermissionPath: "alice/full/three.txt", FullPath: filepath.Join(full, "three.txt"), Size: 1}); err == nil {
+		t.Fatal("expected an upload into a full directory to be rejected")
+	}
+	if err := enforcer.Check(UploadTarget{Owner: u, PermissionPath: "alice/full/one.txt", FullPath: filepath.Join(full, "one.txt"), Size: 1}); err != nil {
+		t.Fatalf("overwriting an existing entry adds none: %v", err)
+	}
+	if err := enforcer.CheckDirectory(u, "alice/full/sub", filepath.Join(full, "sub")); err == nil {
+		t.Fatal("expected a directory in a full directory to be rejected")
+	}
+	if err := enforcer.CheckTransfer(u, "alice/full/a.txt", source, filepath.Join(full, "a.txt")); err == nil {
+		t.Fatal("expected a copy into a full directory to be rejected")
+	}
+}
+
+func TestCollectionArchiveCheckStatsMemoryStorage(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+	backend := storage.NewMemory()
+	svc.SetStorage(backend)
+	archives := NewArchiveService(svc.config, zap.NewNop())
+	archives.SetStorage(backend)
+	svc.SetArchiveService(archives)
+	userDir := svc.getUserDirectory(u)
+	if err := backend.MkdirAll(filepath.Join(userDir, "docs"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := storage.WriteFile(backend, filepath.Join(userDir, "docs", "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+
+	if !svc.isCollectionArchiveRequest(userDir, newPartialUpdateRequest(http.MethodGet, "/dav/docs", "", u)) {
+		t.Fatal("expected a GET on an in-memory directory to be served as an archive")
+	}
+	if svc.isCollectionArchiveRequest(userDir, newPartialUpdateRequest(http.MethodGet, "/dav/docs/a.txt", "", u)) {
+		t.Fatal("a GET on a file is not an archive request")
+	}
+	if svc.isCollectionArchiveRequest(userDir, newPartialUpdateRequest(http.MethodGet, "/dav/missing", "", u)) {
+		t.Fatal("a GET on a missing path is not an archive request")
+	}
+}
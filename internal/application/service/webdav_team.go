@@ -0,0 +1,100 @@
+package service
+
+import (
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/team"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+// SetTeamService 启用 /teams/<id> 团队空间
+func (s *WebDAVService) SetTeamService(teams *TeamService) {
+	s.teams = teams
+}
+
+// splitTeamSpacePath splits a prefix-stripped path into team id and the path
+// inside the team root. It never matches while team spaces are disabled so
+// existing directories named "teams" keep working.
+func (s *WebDAVService) splitTeamSpacePath(rawPath string) (string, string, bool) {
+	if !s.teams.Enabled() {
+		return "", "", false
+	}
+	return team.SplitSpacePath(rawPath)
+}
+
+// teamSpaceID reports whether a request path or Destination header addresses
+// the team namespace; the id is empty for the bare /teams collection.
+func (s *WebDAVService) teamSpaceID(rawPath string) (string, bool) {
+	teamID, _, ok := s.splitTeamSpacePath(s.stripWebdavPrefix(rawPath))
+	return teamID, ok
+}
+
+// handlerPrefix returns the prefix the webdav handler strips from request
+// paths; team requests are rooted at /teams/<id>.
+func (s *WebDAVService) handlerPrefix(r *http.Request) string {
+	if teamID, ok := s.teamSpaceID(r.URL.Path); ok && teamID != "" {
+		return path.Join("/", s.config.WebDAV.Prefix, team.SpacePrefix, teamID)
+	}
+	return s.config.WebDAV.Prefix
+}
+
+// resolveTeamSpacePrincipal swaps the acting user for the team storage account
+// when the request targets /teams/<id>. MOVE/COPY across spaces is rejected
+// because quota, recycle bin and versions are kept per account.
+func (s *WebDAVService) resolveTeamSpacePrincipal(w http.ResponseWriter, r *http.Request, u *user.User) (*user.User, bool) {
+	teamID, isTeam := s.teamSpaceID(r.URL.Path)
+	if r.Method == "MOVE" || r.Method == "COPY" {
+		if dest := strings.TrimSpace(r.Header.Get("Destination")); dest != "" {
+			destTeamID, destIsTeam := s.teamSpaceID(dest)
+			if destIsTeam != isTeam || destTeamID != teamID {
+				s.logger.Warn("cross-space move denied",
+					zap.String("username", u.Username),
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.String("destination", dest))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return nil, false
+			}
+		}
+	}
+	if !isTeam {
+		return u, true
+	}
+	if teamID == "" {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return nil, false
+	}
+
+	principal, _, err := s.teams.ResolvePrincipal(r.Context(), u, teamID)
+	if err != nil {
+		switch {
+		case errors.Is(err, team.ErrTeamNotFound), errors.Is(err, team.ErrTeamsDisabled):
+			http.Error(w, "Not Found", http.StatusNotFound)
+		case errors.Is(err, team.ErrPermissionDenied), errors.Is(err, auth.ErrAppScopeDenied), errors.Is(err, auth.ErrAppScopeRequired):
+			s.logger.Warn("team space access denied",
+				zap.String("username", u.Username),
+				zap.String("team_id", teamID),
+				zap.String("method", r.Method),
+				zap.Error(err))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+		default:
+			s.logger.Error("failed to resolve team space",
+				zap.String("username", u.Username),
+				zap.String("team_id", teamID),
+				zap.Error(err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	s.logger.Debug("team space request",
+		zap.String("username", u.Username),
+		zap.String("team_id", teamID),
+		zap.String("account", principal.Username),
+		zap.String("method", r.Method))
+	return principal, true
+}
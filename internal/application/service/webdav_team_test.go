@@ -0,0 +1,82 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"go.uber.org/zap"
+)
+
+func newTeamWebDAVService(t *testing.T, enabled bool) *WebDAVService {
+	t.Helper()
+	cfg := &config.Config{
+		WebDAV: config.WebDAVConfig{Prefix: "/dav", Directory: t.TempDir()},
+		Teams:  config.TeamsConfig{Enabled: enabled},
+	}
+	teams := NewTeamService(cfg, newMemoryTeamRepo(), newFakeGroupRepository(), newTestUserRepo(), nil)
+	return &WebDAVService{config: cfg, teams: teams, logger: zap.NewNop()}
+}
+
+func TestWebDAVTeamSpacePaths(t *testing.T) {
+	s := newTeamWebDAVService(t, true)
+
+	if got := s.normalizeWebdavRequestPath("/dav/teams/t1/docs/a.txt"); got != "/docs/a.txt" {
+		t.Fatalf("team path should be rooted at the team directory, got %q", got)
+	}
+	if got := s.normalizeWebdavRequestPath("/dav/personal/a.txt"); got != "/personal/a.txt" {
+		t.Fatalf("personal path changed: %q", got)
+	}
+	req := httptest.NewRequest("PROPFIND", "/dav/teams/t1/docs/", nil)
+	if got := s.handlerPrefix(req); got != "/dav/teams/t1" {
+		t.Fatalf("unexpected handler prefix %q", got)
+	}
+
+	disabled := newTeamWebDAVService(t, false)
+	if got := disabled.normalizeWebdavRequestPath("/dav/teams/t1/a.txt"); got != "/teams/t1/a.txt" {
+		t.Fatalf("disabled team spaces must not rewrite paths, got %q", got)
+	}
+	if got := disabled.handlerPrefix(req); got != "/dav" {
+		t.Fatalf("disabled team spaces must keep the default prefix, got %q", got)
+	}
+}
+
+func TestWebDAVTeamSpaceRejectsCrossSpaceMove(t *testing.T) {
+	s := newTeamWebDAVService(t, true)
+	owner := newShareTestUser(t, "alice", "0x1111111111111111111111111111111111111111")
+
+	tests := []struct {
+		name        string
+		path        string
+		destination string
+		status      int
+	}{
+		{name: "personal to team", path: "/dav/personal/a.txt", destination: "http://example.com/dav/teams/t1/a.txt", status: http.StatusForbidden},
+		{name: "team to personal", path: "/dav/teams/t1/a.txt", destination: "/dav/personal/a.txt", status: http.StatusForbidden},
+		{name: "team to other team", path: "/dav/teams/t1/a.txt", destination: "/dav/teams/t2/a.txt", status: http.StatusForbidden},
+		{name: "bare teams collection", path: "/dav/teams/", status: http.StatusNotFound},
+		{name: "unknown team", path: "/dav/teams/t1/a.txt", destination: "/dav/teams/t1/b.txt", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("MOVE", tt.path, nil)
+			if tt.destination != "" {
+				req.Header.Set("Destination", tt.destination)
+			}
+			rec := httptest.NewRecorder()
+			if _, ok := s.resolveTeamSpacePrincipal(rec, req, owner); ok {
+				t.Fatal("expected request to be rejected")
+			}
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("MOVE", "/dav/personal/a.txt", nil)
+	req.Header.Set("Destination", "/dav/personal/b.txt")
+	if principal, ok := s.resolveTeamSpacePrincipal(httptest.NewRecorder(), req, owner); !ok || principal != owner {
+		t.Fatal("personal move should keep the caller as principal")
+	}
+}
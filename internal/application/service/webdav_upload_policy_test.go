@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebDAVServeHTTPAppliesUploadPolicyToMoveCopyAndMkcol(t *testing.T) {
+	t.Parallel()
+
+	svc, u := newPartialUpdateTestService(t, 0, 0, nil)
+	svc.config.Upload.DenyExtensions = []string{".exe"}
+	svc.config.Upload.MaxFilesPerDir = 2
+	svc.SetUploadPolicyEnforcer(NewUploadPolicyEnforcer(svc.config))
+	source := seedPartialUpdateFile(t, svc, u, "personal/a.txt", "a")
+	seedPartialUpdateFile(t, svc, u, "personal/tree/tool.exe", "x")
+	seedPartialUpdateFile(t, svc, u, "full/one.txt", "1")
+	seedPartialUpdateFile(t, svc, u, "full/two.txt", "2")
+
+	serve := func(method, target, destination string) int {
+		req := newPartialUpdateRequest(method, target, "", u)
+		if destination != "" {
+			req.Header.Set("Destination", destination)
+		}
+		resp := httptest.NewRecorder()
+		svc.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	if code := serve("MOVE", "/dav/personal/a.txt", "/dav/personal/a.exe"); code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected rename to a denied extension to be rejected, got %d", code)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Fatalf("rejected move must keep the source: %v", err)
+	}
+	if code := serve("COPY", "/dav/personal/tree", "/dav/personal/copy"); code != http.StatusUnsupportedMediaType {
+		t.Fatalf("expected copy of a tree holding a denied file to be rejected, got %d", code)
+	}
+	if code := serve("MKCOL", "/dav/full/three", ""); code != http.StatusConflict {
+		t.Fatalf("expected MKCOL in a full directory to be rejected, got %d", code)
+	}
+	if code := serve("COPY", "/dav/personal/a.txt", "/dav/full/a.txt"); code != http.StatusConflict {
+		t.Fatalf("expected copy into a full directory to be rejected, got %d", code)
+	}
+	// A rename inside the full directory adds no entry.
+	if code := serve("MOVE", "/dav/full/one.txt", "/dav/full/first.txt"); code != http.StatusCreated {
+		t.Fatalf("expected rename within a full directory to succeed, got %d", code)
+	}
+}
+
+func TestExtractServiceSkipsEntriesViolatingUploadPolicy(t *testing.T) {
+	t.Parallel()
+
+	svc, u, userRoot := newExtractTestService(t, 0, nil)
+	svc.config.Upload.DenyExtensions = []string{".exe"}
+	svc.SetUploadPolicyEnforcer(NewUploadPolicyEnforcer(svc.config))
+	writeExtractTestZip(t, filepath.Join(userRoot, "bundle.zip"), map[string]string{
+		"readme.txt": "hi",
+		"setup.exe":  "x",
+	})
+
+	job, err := svc.Start(context.Background(), u, ExtractInput{SourcePath: "/bundle.zip", TargetPath: "/bundle"})
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	job = waitExtractJob(t, svc, u, job.ID)
+	if job.Status != ExtractJobStatusCompleted || job.Skipped != 1 || job.Created != 1 {
+		t.Fatalf("expected the denied entry to be skipped, got %+v", job)
+	}
+	assertExtractedFile(t, filepath.Join(userRoot, "bundle", "readme.txt"), "hi")
+	if _, err := os.Stat(filepath.Join(userRoot, "bundle", "setup.exe")); !os.IsNotExist(err) {
+		t.Fatalf("denied entry must not be extracted, got %v", err)
+	}
+}
@@ -19,8 +19,10 @@ import (
 	"github.com/yeying-community/warehouse/internal/infrastructure/logger"
 	"github.com/yeying-community/warehouse/internal/infrastructure/permission"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"github.com/yeying-community/warehouse/internal/interface/http"
 	"github.com/yeying-community/warehouse/internal/interface/http/handler"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"github.com/yeying-community/warehouse/internal/interface/s3"
 	"go.uber.org/zap"
 	"golang.org/x/net/webdav"
@@ -41,20 +43,31 @@ type Container struct {
 	UserShareRepository           repository.UserShareRepository
 	SharedResourceGrantRepository repository.SharedResourceGrantRepository
 	GroupRepository               repository.GroupRepository
+	TeamRepository                repository.TeamRepository
 	WebDAVAccessKeyRepo           repository.WebDAVAccessKeyRepository
 	S3CredentialRepo              repository.S3CredentialRepository
 	S3MultipartRepo               repository.S3MultipartRepository
 	S3ObjectMetadataRepo          repository.S3ObjectMetadataRepository
+	SearchIndexRepo               repository.SearchIndexRepository
+	SearchContentRepo             repository.SearchContentRepository
 	NotificationRepo              repository.NotificationRepository
 	ReplicationOutboxRepo         repository.ReplicationOutboxRepository
 	ReplicationOffsetRepo         repository.ReplicationOffsetRepository
 	ReconcileRepo                 repository.ReplicationReconcileRepository
 	ClusterNodeRepo               repository.ClusterNodeRepository
 	ClusterAssignmentRepo         repository.ClusterReplicationAssignmentRepository
+	JobRepo                       repository.JobRepository
+	ShareAccessLogRepo            repository.ShareAccessLogRepository
+	ShareInviteRepo               repository.ShareInviteRepository
+	ShareAccessRequestRepo        repository.ShareAccessRequestRepository
+	ShareExpiryRepo               repository.ShareExpiryRepository
 
 	// Services
+	Storage                     storage.Backend
 	QuotaService                quota.Service
 	QuotaReconciler             *service.QuotaReconciler
+	RecyclePurger               *service.RecyclePurger
+	ShareExpiryNotifier         *service.ShareExpiryNotifier
 	AssetSpaceManager           *assetspace.Manager
 	MutationRecorder            service.MutationRecorder
 	NodeHeartbeat               *service.NodeHeartbeatRegistrar
@@ -68,10 +81,19 @@ type Container struct {
 	ShareService                *service.ShareService
 	ShareUserService            *service.ShareUserService
 	SharedResourceAccessService *service.SharedResourceAccessService
+	ShareAccessRequestService   *service.ShareAccessRequestService
 	GroupService                *service.GroupService
+	TeamService                 *service.TeamService
 	WebDAVAccessKeyService      *service.WebDAVAccessKeyService
 	NotificationService         *service.NotificationService
 	UploadSessionService        *service.UploadSessionService
+	ExtractService              *service.ExtractService
+	VersionService              *service.VersionService
+	SearchService               *service.SearchService
+	ThumbnailService            *service.ThumbnailService
+	DedupService                *service.DedupService
+	VolumeService               *service.VolumeService
+	JobService                  *service.JobService
 
 	// Authenticators
 	Authenticators       []auth.Authenticator
@@ -82,6 +104,8 @@ type Container struct {
 	MultipartService     *service.MultipartService
 	S3CredentialResolver s3.CredentialResolver
 	ObjectService        *service.ObjectService
+	ArchiveService       *service.ArchiveService
+	UploadPolicy         *service.UploadPolicyEnforcer
 
 	// Handlers
 	HealthHandler              *handler.HealthHandler
@@ -99,9 +123,16 @@ type Container struct {
 	ShareUserHandler           *handler.ShareUserHandler
 	WebDAVAccessKeyHandler     *handler.WebDAVAccessKeyHandler
 	GroupHandler               *handler.GroupHandler
+	TeamHandler                *handler.TeamHandler
 	NotificationHandler        *handler.NotificationHandler
 	S3CredentialHandler        *handler.S3CredentialHandler
 	UploadSessionHandler       *handler.UploadSessionHandler
+	NextcloudHandler           *handler.NextcloudHandler
+	ExtractHandler             *handler.ExtractHandler
+	VersionHandler             *handler.VersionHandler
+	SearchHandler              *handler.SearchHandler
+	ThumbnailHandler           *handler.ThumbnailHandler
+	JobHandler                 *handler.JobHandler
 
 	// HTTP
 	Router   *http.Router
@@ -268,15 +299,23 @@ func (c *Container) initRepositories() error {
 	c.RecycleRepository = repository.NewPostgresRecycleRepository(c.DB.DB)
 	// 分享仓储
 	c.ShareRepository = repository.NewPostgresShareRepository(c.DB.DB)
+	c.ShareAccessLogRepo = repository.NewPostgresShareAccessLogRepository(c.DB.DB)
 	// 定向分享仓储
 	c.UserShareRepository = repository.NewPostgresUserShareRepository(c.DB.DB)
+	c.ShareInviteRepo = repository.NewPostgresShareInviteRepository(c.DB.DB)
+	c.ShareAccessRequestRepo = repository.NewPostgresShareAccessRequestRepository(c.DB.DB)
+	c.ShareExpiryRepo = repository.NewPostgresShareExpiryRepository(c.DB.DB)
 	c.SharedResourceGrantRepository = repository.NewPostgresSharedResourceGrantRepository(c.DB.DB)
 	// 分组管理仓储
 	c.GroupRepository = repository.NewPostgresGroupRepository(c.DB.DB)
+	c.TeamRepository = repository.NewPostgresTeamRepository(c.DB.DB)
 	// WebDAV 访问密钥仓储
 	c.WebDAVAccessKeyRepo = repository.NewPostgresWebDAVAccessKeyRepository(c.DB.DB)
 	c.S3MultipartRepo = repository.NewPostgresS3MultipartRepository(c.DB.DB)
 	c.S3ObjectMetadataRepo = repository.NewPostgresS3ObjectMetadataRepository(c.DB.DB)
+	// 搜索索引仓储
+	c.SearchIndexRepo = repository.NewPostgresSearchIndexRepository(c.DB.DB)
+	c.SearchContentRepo = repository.NewPostgresSearchContentRepository(c.DB.DB)
 	if c.Config.S3.Enabled {
 		secretBox, err := infraCrypto.NewSecretBoxBase64(c.Config.S3.CredentialMasterKey)
 		if err != nil {
@@ -294,6 +333,8 @@ func (c *Container) initRepositories() error {
 	c.ReconcileRepo = repository.NewPostgresReplicationReconcileRepository(c.DB.DB)
 	c.ClusterNodeRepo = repository.NewPostgresClusterNodeRepository(c.DB.DB)
 	c.ClusterAssignmentRepo = repository.NewPostgresClusterReplicationAssignmentRepository(c.DB.DB)
+	// 后台任务仓储
+	c.JobRepo = repository.NewPostgresJobRepository(c.DB.DB)
 
 	c.Logger.Info("using PostgreSQL user repository")
 	c.Logger.Info("repositories initialized")
@@ -303,8 +344,24 @@ func (c *Container) initRepositories() error {
 // initServices 初始化服务
 func (c *Container) initServices() error {
 	c.AssetSpaceManager = assetspace.NewManager(c.Config, c.Logger)
+	// 存储后端：WebDAV、S3 与资产 API 共用，当前为本地磁盘
+	c.Storage = storage.NewLocal()
 	c.ObjectService = service.NewObjectService(c.Config.WebDAV.Directory)
+	c.ObjectService.SetStorage(c.Storage)
+	// 路径名规范化策略（NFC / 大小写冲突保护）与 WebDAV 入口一致
+	c.ObjectService.SetNamePolicy(service.NamePolicy(c.Config).WithFS(c.Storage))
 	c.ObjectService.SetMetadataRepository(s3ObjectMetadataRepoAdapter{repo: c.S3ObjectMetadataRepo})
+	// 多卷存储：新用户选卷与 move-user 迁移
+	if volumeUsers, ok := c.UserRepository.(service.VolumeUserRepository); ok {
+		c.VolumeService = service.NewVolumeService(c.Config, volumeUsers, c.Logger)
+	}
+	if len(c.Config.Storage.Volumes) > 0 {
+		c.ObjectService.SetVolumes(storage.VolumesFromConfig(c.Config))
+	}
+	// 上传策略（全局 / 用户 / 路径规则），各上传入口共用
+	c.UploadPolicy = service.NewUploadPolicyEnforcer(c.Config)
+	c.UploadPolicy.SetStorage(c.Storage)
+	c.ObjectService.SetUploadPolicyEnforcer(c.UploadPolicy)
 	// 配额服务
 	c.QuotaService = quota.NewService(c.UserRepository)
 	c.QuotaReconciler = service.NewQuotaReconciler(
@@ -317,24 +374,40 @@ func (c *Container) initServices() error {
 	c.PeerResolver = service.NewReplicationPeerResolver(c.Config, c.ClusterNodeRepo, c.ClusterAssignmentRepo)
 	c.NodeHeartbeat = service.NewNodeHeartbeatRegistrar(c.Config, c.ClusterNodeRepo, c.Logger)
 	c.AssignmentAllocator = service.NewReplicationAssignmentAllocator(c.Config, c.ClusterNodeRepo, c.ClusterAssignmentRepo, c.Logger)
-	c.MutationRecorder = service.NewMutationRecorder(c.Config, c.ReplicationOutboxRepo, c.PeerResolver, c.Logger)
+	fileSystem := webdav.Dir(c.Config.WebDAV.Directory)
+	permissionChecker := permission.NewWebDAVChecker(fileSystem, c.Logger)
+	// 文件名与元数据搜索（未开启时为 nil）：索引随写入事件更新
+	c.SearchService = service.NewSearchService(c.Config, c.SearchIndexRepo, permissionChecker, c.UserRepository, c.Logger)
+	c.SearchService.SetStorage(c.Storage)
+	// 全文内容索引（search.content.enabled）：写入后排队抽取文本
+	c.SearchService.SetContentRepository(c.SearchContentRepo)
+	// 图片缩略图（未开启时为 nil）：写入、移动、删除时清理对应缓存
+	c.ThumbnailService = service.NewThumbnailService(c.Config, permissionChecker, c.Logger)
+	c.ThumbnailService.SetStorage(c.Storage)
+	outboxRecorder := service.NewMutationRecorder(c.Config, c.ReplicationOutboxRepo, c.PeerResolver, c.Logger)
+	if recorder, ok := outboxRecorder.(*service.OutboxMutationRecorder); ok {
+		recorder.SetStorage(c.Storage)
+	}
+	c.MutationRecorder = c.ThumbnailService.Recorder(c.SearchService.Recorder(outboxRecorder))
 	c.ObjectService.SetGuards(c.QuotaService, c.UserRepository, c.MutationRecorder)
 	c.ObjectService.SetShareReferences(c.Config, c.UserShareRepository, c.ShareRepository)
 	c.MultipartService = service.NewMultipartService(c.Config.WebDAV.Directory, c.S3MultipartRepo)
 	c.MultipartService.SetObjectService(c.ObjectService)
 	c.MultipartService.SetQuotaService(c.QuotaService)
+	c.MultipartService.SetStorage(c.Storage)
 	c.ReplicationWorker = service.NewReplicationWorker(c.Config, c.ReplicationOutboxRepo, c.PeerResolver, c.Logger)
+	c.ReplicationWorker.SetStorage(c.Storage)
 	reconcileScanner, err := service.NewReconcileScanner(c.Config.WebDAV.Directory)
 	if err != nil {
 		return fmt.Errorf("failed to create reconcile scanner: %w", err)
 	}
+	if err := reconcileScanner.SetVolumes(storage.VolumesFromConfig(c.Config)); err != nil {
+		return fmt.Errorf("failed to configure reconcile scanner volumes: %w", err)
+	}
 	c.ReconcileScanner = reconcileScanner
 	c.ReplicationCleaner = service.NewReplicationLifecycleCleaner(c.Config, c.ReconcileRepo, c.Logger)
 
 	// WebDAV 服务
-	fileSystem := webdav.Dir(c.Config.WebDAV.Directory)
-	permissionChecker := permission.NewWebDAVChecker(fileSystem, c.Logger)
-
 	c.WebDAVService = service.NewWebDAVService(
 		c.Config,
 		permissionChecker,
@@ -345,6 +418,28 @@ func (c *Container) initServices() error {
 		c.MutationRecorder,
 		c.Logger,
 	)
+	c.WebDAVService.SetStorage(c.Storage)
+	// 目录打包下载服务
+	c.ArchiveService = service.NewArchiveService(c.Config, c.Logger)
+	c.ArchiveService.SetStorage(c.Storage)
+	c.WebDAVService.SetArchiveService(c.ArchiveService)
+	c.WebDAVService.SetUploadPolicyEnforcer(c.UploadPolicy)
+	// 文件历史版本服务
+	c.VersionService = service.NewVersionService(
+		c.Config,
+		permissionChecker,
+		c.UserRepository,
+		c.MutationRecorder,
+		c.Logger,
+	)
+	c.VersionService.SetStorage(c.Storage)
+	c.WebDAVService.SetVersionService(c.VersionService)
+	c.WebDAVService.SetSearchService(c.SearchService)
+	c.ObjectService.SetVersionService(c.VersionService)
+	// 内容寻址去重存储（未开启时为 nil）
+	c.DedupService = service.NewDedupService(c.Config, c.Logger)
+	c.WebDAVService.SetDedupService(c.DedupService)
+	c.ObjectService.SetDedupService(c.DedupService)
 
 	// 回收站服务
 	c.RecycleService = service.NewRecycleService(
@@ -354,6 +449,16 @@ func (c *Container) initServices() error {
 		c.Config,
 		c.Logger,
 	)
+	c.RecycleService.SetStorage(c.Storage)
+
+	// 回收站过期清理
+	c.RecyclePurger = service.NewRecyclePurger(
+		c.Config,
+		c.UserRepository,
+		c.RecycleRepository,
+		c.RecycleService,
+		c.Logger,
+	)
 
 	// 分享服务
 	c.ShareService = service.NewShareService(
@@ -362,8 +467,17 @@ func (c *Container) initServices() error {
 		c.Config,
 		c.Logger,
 	)
+	c.ShareService.SetStorage(c.Storage)
+	c.ShareService.SetAccessLogRepository(c.ShareAccessLogRepo)
 	// 分组管理服务
 	c.GroupService = service.NewGroupService(c.GroupRepository, c.UserRepository)
+	// 团队空间服务
+	c.TeamService = service.NewTeamService(c.Config, c.TeamRepository, c.GroupRepository, c.UserRepository, c.Logger)
+	if c.VolumeService != nil {
+		c.TeamService.SetVolumePlacer(c.VolumeService)
+	}
+	c.TeamService.SetStorage(c.Storage)
+	c.WebDAVService.SetTeamService(c.TeamService)
 	// WebDAV 访问密钥服务
 	c.WebDAVAccessKeyService = service.NewWebDAVAccessKeyService(c.WebDAVAccessKeyRepo)
 	// 站内消息服务
@@ -373,6 +487,12 @@ func (c *Container) initServices() error {
 	if c.QuotaReconciler != nil {
 		c.QuotaReconciler.SetNotificationService(c.NotificationService)
 	}
+	if c.RecyclePurger != nil {
+		c.RecyclePurger.SetNotificationService(c.NotificationService)
+	}
+	// 分享到期提醒与过期通知
+	c.ShareExpiryNotifier = service.NewShareExpiryNotifier(c.Config, c.ShareExpiryRepo, c.Logger)
+	c.ShareExpiryNotifier.SetNotificationService(c.NotificationService)
 	// 定向分享服务
 	c.ShareUserService = service.NewShareUserService(
 		c.UserShareRepository,
@@ -382,6 +502,8 @@ func (c *Container) initServices() error {
 		c.Config,
 		c.Logger,
 	)
+	c.ShareUserService.SetInviteRepository(c.ShareInviteRepo)
+	c.ShareUserService.SetStorage(c.Storage)
 	c.ShareService.SetShareUserService(c.ShareUserService)
 	c.UploadSessionService = service.NewUploadSessionService(
 		c.Config,
@@ -395,6 +517,44 @@ func (c *Container) initServices() error {
 	c.SharedResourceAccessService = service.NewSharedResourceAccessService(c.SharedResourceGrantRepository)
 	c.ShareService.SetSharedResourceAccess(c.SharedResourceAccessService)
 	c.UploadSessionService.SetSharedResourceAccess(c.SharedResourceAccessService)
+	c.SearchService.SetSharedResourceAccess(c.SharedResourceAccessService)
+	c.UploadSessionService.SetUploadPolicyEnforcer(c.UploadPolicy)
+	c.UploadSessionService.SetStorage(c.Storage)
+	// 上传模式分享：匿名上传走分片上传会话，收到文件时通知所有者
+	c.UploadSessionService.SetShareService(c.ShareService)
+	c.ShareService.SetNotificationService(c.NotificationService)
+	// 共享资源访问/升级申请，处理结果写入 V3 授权
+	c.ShareAccessRequestService = service.NewShareAccessRequestService(
+		c.ShareAccessRequestRepo,
+		c.SharedResourceGrantRepository,
+		c.ShareRepository,
+		c.Config,
+		c.Logger,
+	)
+	c.ShareAccessRequestService.SetNotificationService(c.NotificationService)
+	// 在线解压服务
+	c.ExtractService = service.NewExtractService(
+		c.Config,
+		permissionChecker,
+		c.QuotaService,
+		c.UserRepository,
+		c.MutationRecorder,
+		c.Logger,
+	)
+	// 覆盖解压时旧文件保留为历史版本，未开启版本时移入回收站
+	c.ExtractService.SetStorage(c.Storage)
+	c.ExtractService.SetVersionService(c.VersionService)
+	c.ExtractService.SetRecycleService(c.RecycleService)
+	c.ExtractService.SetUploadPolicyEnforcer(c.UploadPolicy)
+	// 后台任务：批量删除、回收站清理等用户任务，额度重建、分享回填等管理员任务
+	c.JobService = service.NewJobService(c.Config, c.JobRepo, c.UserRepository, c.Logger)
+	c.JobService.Register(service.JobTypeFilesDelete, service.FilesDeleteJob(c.WebDAVService))
+	c.JobService.Register(service.JobTypeRecycleClear, service.RecycleClearJob(c.RecycleService))
+	c.JobService.Register(service.JobTypeRecycleRemove, service.RecycleRemoveJob(c.RecycleService))
+	if c.QuotaReconciler != nil {
+		c.JobService.Register(service.JobTypeQuotaRebuild, service.QuotaRebuildJob(c.QuotaReconciler))
+	}
+	c.JobService.Register(service.JobTypeShareReconcile, service.ShareReconcileJob(c.DB))
 
 	c.Logger.Info("services initialized", zap.Bool("quota_enabled", true))
 
@@ -461,6 +621,9 @@ func (c *Container) initAuthenticators() error {
 		c.Logger,
 		c.Config.Web3.AutoCreateOnUCAN,
 	)
+	if c.VolumeService != nil {
+		c.Web3Auth.SetVolumePlacer(c.VolumeService)
+	}
 	c.Authenticators = append(c.Authenticators, c.Web3Auth)
 
 	c.Logger.Info("authenticators initialized", zap.Int("count", len(c.Authenticators)))
@@ -484,6 +647,7 @@ func (c *Container) initHandlers() error {
 			c.PeerResolver,
 			c.ClusterAssignmentRepo,
 		)
+		c.InternalReplicationHandler.SetBlobStore(c.DedupService.Store())
 	}
 
 	// 创建配额处理器
@@ -493,6 +657,9 @@ func (c *Container) initHandlers() error {
 	c.UserHandler = handler.NewUserHandler(c.Logger, c.UserRepository, c.Config.Security.AdminAddresses)
 	// 管理员用户处理器
 	c.AdminUserHandler = handler.NewAdminUserHandler(c.Logger, c.UserRepository, c.AssetSpaceManager)
+	if c.VolumeService != nil {
+		c.AdminUserHandler.SetVolumePlacer(c.VolumeService)
+	}
 
 	// Web3 处理器
 	if c.Web3Auth != nil {
@@ -517,9 +684,18 @@ func (c *Container) initHandlers() error {
 		c.Config.Email,
 		c.Logger,
 	)
+	if c.VolumeService != nil {
+		c.EmailAuthHandler.SetVolumePlacer(c.VolumeService)
+	}
+	// 定向分享邮箱邀请复用验证码邮件的 SMTP 配置
+	c.ShareUserService.SetInviteMailer(emailSender)
+	c.EmailAuthHandler.SetShareUserService(c.ShareUserService)
 
 	c.AssetsHandler = handler.NewAssetsHandler(c.AssetSpaceManager, c.Logger)
 	c.AssetObjectHandler = handler.NewAssetObjectHandler(c.Config, c.ObjectService, c.Logger)
+	c.AssetObjectHandler.SetArchiveService(c.ArchiveService)
+	c.AssetObjectHandler.SetTeamService(c.TeamService)
+	c.AssetsHandler.SetTeamService(c.TeamService)
 
 	// WebDAV 处理器
 	c.WebDAVHandler = handler.NewWebDAVHandler(
@@ -536,12 +712,17 @@ func (c *Container) initHandlers() error {
 		c.UserRepository,
 		c.Logger,
 	)
+	c.RecycleHandler.SetJobService(c.JobService)
 
 	// 分享处理器
 	c.ShareHandler = handler.NewShareHandler(
 		c.ShareService,
 		c.Logger,
 	)
+	c.ShareHandler.SetClientIPResolver(middleware.NewClientIPResolver(c.Config.Security.BehindProxy, c.Config.Security.TrustedProxies))
+	c.ShareHandler.SetNamePolicy(service.NamePolicy(c.Config).WithFS(c.Storage))
+	c.ShareHandler.SetArchiveService(c.ArchiveService)
+	c.ShareHandler.SetUploadSessionService(c.UploadSessionService)
 	// 定向分享处理器
 	c.ShareUserHandler = handler.NewShareUserHandler(
 		c.ShareUserService,
@@ -551,11 +732,21 @@ func (c *Container) initHandlers() error {
 	)
 	c.ShareUserHandler.SetSharedResourceAccess(c.SharedResourceAccessService)
 	c.ShareUserHandler.SetPublicShareRepository(c.ShareRepository)
+	c.ShareUserHandler.SetStorage(c.Storage)
+	c.ShareUserHandler.SetArchiveService(c.ArchiveService)
+	c.ShareUserHandler.SetUploadPolicyEnforcer(c.UploadPolicy)
+	c.ShareUserHandler.SetVersionService(c.VersionService)
+	c.ShareUserHandler.SetAccessRequestService(c.ShareAccessRequestService)
+	c.ShareUserHandler.SetNamePolicy(service.NamePolicy(c.Config).WithFS(c.Storage))
+	c.ShareHandler.SetThumbnailService(c.ThumbnailService)
+	c.ShareUserHandler.SetThumbnailService(c.ThumbnailService)
 	// 分组管理处理器
 	c.GroupHandler = handler.NewGroupHandler(
 		c.GroupService,
 		c.Logger,
 	)
+	// 团队空间处理器
+	c.TeamHandler = handler.NewTeamHandler(c.TeamService, c.Logger)
 	// WebDAV 访问密钥处理器
 	c.WebDAVAccessKeyHandler = handler.NewWebDAVAccessKeyHandler(
 		c.WebDAVAccessKeyService,
@@ -568,8 +759,22 @@ func (c *Container) initHandlers() error {
 	)
 	if c.S3CredentialRepo != nil {
 		c.S3CredentialHandler = handler.NewS3CredentialHandler(c.S3CredentialRepo, c.Logger)
+		c.S3CredentialHandler.SetTeamService(c.TeamService)
 	}
 	c.UploadSessionHandler = handler.NewUploadSessionHandler(c.UploadSessionService, c.Logger)
+	c.ExtractHandler = handler.NewExtractHandler(c.ExtractService, c.Logger)
+	c.VersionHandler = handler.NewVersionHandler(c.VersionService, c.Logger)
+	if c.SearchService != nil {
+		c.SearchHandler = handler.NewSearchHandler(c.SearchService, c.Logger)
+	}
+	if c.ThumbnailService != nil {
+		c.ThumbnailHandler = handler.NewThumbnailHandler(c.ThumbnailService, c.Logger)
+	}
+	c.JobHandler = handler.NewJobHandler(c.JobService, c.Logger)
+	if c.Config.WebDAV.NextcloudCompat {
+		c.NextcloudHandler = handler.NewNextcloudHandler(c.Config, c.UploadSessionService, c.Logger)
+		c.NextcloudHandler.SetStorage(c.Storage)
+	}
 
 	c.Logger.Info("handlers initialized")
 
@@ -597,9 +802,16 @@ func (c *Container) initHTTP() error {
 		c.ShareUserHandler,
 		c.WebDAVAccessKeyHandler,
 		c.GroupHandler,
+		c.TeamHandler,
 		c.NotificationHandler,
 		c.S3CredentialHandler,
 		c.UploadSessionHandler,
+		c.NextcloudHandler,
+		c.ExtractHandler,
+		c.VersionHandler,
+		c.SearchHandler,
+		c.ThumbnailHandler,
+		c.JobHandler,
 		c.Logger,
 	)
 
@@ -607,6 +819,7 @@ func (c *Container) initHTTP() error {
 	c.Server = http.NewServer(c.Config, c.Router, c.Logger)
 	if c.Config.S3.Enabled {
 		c.S3Server = s3.NewServer(c.Config.S3, c.S3CredentialResolver, c.ObjectService, c.UserRepository, c.MultipartService, c.Logger)
+		c.S3Server.SetTeamResolver(c.TeamService)
 	}
 	c.Logger.Info("http components initialized")
 
@@ -1,6 +1,7 @@
 package group
 
 import (
+	"crypto/rand"
 	"errors"
 	"strings"
 	"time"
@@ -14,6 +15,12 @@ var (
 	ErrDuplicateGroupName    = errors.New("group name already exists")
 	ErrDuplicateMember       = errors.New("member already exists in group")
 	ErrGroupPermissionDenied = errors.New("group permission denied")
+	ErrInvalidMemberRole     = errors.New("invalid group member role")
+	ErrOwnerCannotLeave      = errors.New("group owner must transfer ownership before leaving")
+	ErrInvalidTransferTarget = errors.New("ownership can only be transferred to another active member")
+	ErrInviteLinkNotFound    = errors.New("invite link not found")
+	ErrInviteLinkExpired     = errors.New("invite link has expired or reached its usage limit")
+	ErrInvalidInviteLink     = errors.New("invalid invite link settings")
 )
 
 const (
@@ -21,11 +28,26 @@ const (
 	MemberStatusPending = "pending"
 )
 
+// 成员角色：owner 唯一且由 address_groups.user_id 决定；admin 可管理成员与邀请链接
+const (
+	RoleOwner  = "owner"
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+// 邀请链接默认与最长有效期
+const (
+	DefaultInviteLinkTTL = 7 * 24 * time.Hour
+	MaxInviteLinkTTL     = 30 * 24 * time.Hour
+)
+
 type Group struct {
 	ID        string
 	UserID    string
 	Name      string
 	CanInvite bool
+	// Role 当前用户在分组中的角色，不可见或 pending 时为空
+	Role      string
 	CreatedAt time.Time
 }
 
@@ -38,10 +60,23 @@ type Member struct {
 	Username      string
 	WalletAddress string
 	Status        string
+	Role          string
 	IsOwner       bool
 	CreatedAt     time.Time
 }
 
+// InviteLink 分组邀请链接/邀请码，持有者在有效期内可直接加入分组
+type InviteLink struct {
+	ID        string
+	GroupID   string
+	Code      string
+	CreatedBy string
+	MaxUses   int
+	UsedCount int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
 func NewGroup(userID, name string) (*Group, error) {
 	name = strings.TrimSpace(name)
 	if name == "" {
@@ -74,10 +109,99 @@ func NewMember(userID, groupID, name, walletAddress string) (*Member, error) {
 		Name:          name,
 		WalletAddress: strings.ToLower(walletAddress),
 		Status:        MemberStatusActive,
+		Role:          RoleMember,
 		CreatedAt:     now,
 	}, nil
 }
 
+// NewInviteLink 创建邀请链接；ttl 为 0 时使用默认有效期，maxUses 为 0 表示不限次数
+func NewInviteLink(groupID, createdBy string, ttl time.Duration, maxUses int) (*InviteLink, error) {
+	groupID = strings.TrimSpace(groupID)
+	if groupID == "" {
+		return nil, errors.New("group id is required")
+	}
+	if ttl == 0 {
+		ttl = DefaultInviteLinkTTL
+	}
+	if ttl < 0 || ttl > MaxInviteLinkTTL || maxUses < 0 {
+		return nil, ErrInvalidInviteLink
+	}
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &InviteLink{
+		ID:        uuid.NewString(),
+		GroupID:   groupID,
+		Code:      code,
+		CreatedBy: createdBy,
+		MaxUses:   maxUses,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}, nil
+}
+
+// Usable 判断邀请链接在 now 时刻是否仍可使用
+func (l *InviteLink) Usable(now time.Time) bool {
+	if l == nil || !now.Before(l.ExpiresAt) {
+		return false
+	}
+	return l.MaxUses == 0 || l.UsedCount < l.MaxUses
+}
+
+// inviteCodeAlphabet leaves out 0/O and 1/I so codes can be typed by hand; its
+// 32 symbols keep the byte-to-symbol mapping unbiased.
+const inviteCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func newInviteCode() (string, error) {
+	buf := make([]byte, 10)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = inviteCodeAlphabet[int(b)%len(inviteCodeAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// NormalizeInviteCode 统一邀请码大小写与空白
+func NormalizeInviteCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// NormalizeMemberRole 规范化成员角色，空值视为 member；owner 只能通过转让产生
+func NormalizeMemberRole(role string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(role)) {
+	case "", RoleMember:
+		return RoleMember, nil
+	case RoleAdmin:
+		return RoleAdmin, nil
+	case RoleOwner:
+		return RoleOwner, nil
+	default:
+		return "", ErrInvalidMemberRole
+	}
+}
+
+// CanManageMembers 判断角色是否可以移除成员、管理邀请链接
+func CanManageMembers(role string) bool {
+	return role == RoleOwner || role == RoleAdmin
+}
+
+// CanRemove 判断 actorRole 能否移除 targetRole 的成员：owner 可移除任何非 owner，
+// admin 只能移除普通成员
+func CanRemove(actorRole, targetRole string) bool {
+	switch actorRole {
+	case RoleOwner:
+		return targetRole != RoleOwner
+	case RoleAdmin:
+		return targetRole == RoleMember
+	default:
+		return false
+	}
+}
+
 func NormalizeMemberStatus(status string) string {
 	status = strings.ToLower(strings.TrimSpace(status))
 	switch status {
@@ -21,6 +21,9 @@ const (
 	TypeGroupInvite = "group_invite"
 	TypeSystem      = "system"
 	TypeAdminNotice = "admin_notice"
+	TypeRecycle     = "recycle"
+	TypeShareExpiry = "share_expiry"
+	TypeGroup       = "group"
 )
 
 var PreferenceTypes = []string{
@@ -29,6 +32,9 @@ var PreferenceTypes = []string{
 	TypeGroupInvite,
 	TypeSystem,
 	TypeAdminNotice,
+	TypeRecycle,
+	TypeShareExpiry,
+	TypeGroup,
 }
 
 type Notification struct {
@@ -6,6 +6,8 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 )
 
 var (
@@ -14,7 +16,12 @@ var (
 	ErrPathEscape    = errors.New("object path escapes user root")
 )
 
+// RootBucket addresses the account root itself. Team storage accounts have no
+// personal/apps/services split, so their keys are resolved from the root.
+const RootBucket = ""
+
 var supportedBuckets = map[string]struct{}{
+	RootBucket: {},
 	"personal": {},
 	"apps":     {},
 	"services": {},
@@ -23,7 +30,8 @@ var supportedBuckets = map[string]struct{}{
 // ResolvePath maps an S3 bucket/key to a path below one user's asset root.
 // The returned path is lexical-safe; callers must still reject symlinks when
 // opening paths if the underlying filesystem permits user-created symlinks.
-func ResolvePath(webdavRoot, userDirectory, bucket, key string) (string, error) {
+// names decides how keys are normalized and matched against legacy entries.
+func ResolvePath(names pathname.Policy, webdavRoot, userDirectory, bucket, key string) (string, error) {
 	root, err := resolveUserRoot(webdavRoot, userDirectory)
 	if err != nil {
 		return "", err
@@ -34,7 +42,7 @@ func ResolvePath(webdavRoot, userDirectory, bucket, key string) (string, error)
 	if strings.ContainsRune(key, '\x00') {
 		return "", ErrInvalidKey
 	}
-	key = strings.ReplaceAll(key, "\\", "/")
+	key = names.Normalize(strings.ReplaceAll(key, "\\", "/"))
 	for _, segment := range strings.Split(key, "/") {
 		if segment == ".." {
 			return "", fmt.Errorf("%w: %q", ErrPathEscape, key)
@@ -56,7 +64,8 @@ func ResolvePath(webdavRoot, userDirectory, bucket, key string) (string, error)
 	if !isWithin(root, target) {
 		return "", fmt.Errorf("%w: %q", ErrPathEscape, key)
 	}
-	return target, nil
+	// Keep legacy NFD entries reachable when keys are normalized to NFC.
+	return names.Resolve(filepath.Join(root, bucket), target), nil
 }
 
 func resolveUserRoot(webdavRoot, userDirectory string) (string, error) {
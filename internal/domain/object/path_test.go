@@ -4,11 +4,13 @@ import (
 	"errors"
 	"path/filepath"
 	"testing"
+
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 )
 
 func TestResolvePath(t *testing.T) {
 	root := filepath.Join("/srv", "warehouse")
-	got, err := ResolvePath(root, "alice", "personal", "folder/中文.txt")
+	got, err := ResolvePath(pathname.Policy{}, root, "alice", "personal", "folder/中文.txt")
 	if err != nil {
 		t.Fatalf("resolve path: %v", err)
 	}
@@ -33,7 +35,7 @@ func TestResolvePathRejectsEscape(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := ResolvePath("/srv/warehouse", tt.userDir, tt.bucket, tt.key)
+			_, err := ResolvePath(pathname.Policy{}, "/srv/warehouse", tt.userDir, tt.bucket, tt.key)
 			if !errors.Is(err, tt.wantError) {
 				t.Fatalf("unexpected error: got=%v want=%v", err, tt.wantError)
 			}
@@ -42,7 +44,7 @@ func TestResolvePathRejectsEscape(t *testing.T) {
 }
 
 func TestResolvePathAllowsEmptyKeyForBucketOperations(t *testing.T) {
-	got, err := ResolvePath("/srv/warehouse", "alice", "services", "")
+	got, err := ResolvePath(pathname.Policy{}, "/srv/warehouse", "alice", "services", "")
 	if err != nil {
 		t.Fatalf("resolve bucket path: %v", err)
 	}
@@ -51,3 +53,17 @@ func TestResolvePathAllowsEmptyKeyForBucketOperations(t *testing.T) {
 		t.Fatalf("unexpected path: got=%q want=%q", got, want)
 	}
 }
+
+func TestResolvePathRootBucket(t *testing.T) {
+	got, err := ResolvePath(pathname.Policy{}, "/srv/warehouse", ".teams/t1", RootBucket, "docs/plan.md")
+	if err != nil {
+		t.Fatalf("resolve root bucket path: %v", err)
+	}
+	want := filepath.Join("/srv/warehouse", ".teams", "t1", "docs", "plan.md")
+	if got != want {
+		t.Fatalf("unexpected path: got=%q want=%q", got, want)
+	}
+	if _, err := ResolvePath(pathname.Policy{}, "/srv/warehouse", ".teams/t1", RootBucket, "../t2/secret"); !errors.Is(err, ErrPathEscape) {
+		t.Fatalf("expected escape error, got %v", err)
+	}
+}
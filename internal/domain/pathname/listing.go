@@ -0,0 +1,88 @@
+package pathname
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// maxCachedListings bounds the listing cache; it is dropped as a whole
+	// when full, which keeps the bookkeeping trivial.
+	maxCachedListings = 1024
+	// listingSettleTime keeps directories modified within the last moment
+	// out of the cache: filesystems with coarse timestamps may not bump the
+	// modification time again for a change that follows in the same tick.
+	listingSettleTime = 2 * time.Second
+)
+
+// listings indexes directory entries by their comparison keys so repeated
+// lookup misses in one directory do not re-read it. Entries are validated
+// against the directory's modification time on every lookup.
+var listings = &listingCache{dirs: make(map[string]*listing)}
+
+type listingCache struct {
+	mu   sync.Mutex
+	dirs map[string]*listing
+}
+
+type listing struct {
+	modTime time.Time
+	names   []string
+	byNFC   map[string][]string
+	byFold  map[string][]string
+}
+
+// lookup returns the entries of dir whose NFC (or, with fold, case-folded)
+// key equals key.
+func (c *listingCache) lookup(fsys FS, dir, key string, fold bool) []string {
+	info, err := fsys.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return nil
+	}
+	modTime := info.ModTime()
+
+	c.mu.Lock()
+	entry, ok := c.dirs[dir]
+	if ok && entry.modTime.Equal(modTime) {
+		matches := entry.index(fold)[key]
+		c.mu.Unlock()
+		return matches
+	}
+	c.mu.Unlock()
+
+	entries, err := fsys.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	entry = &listing{modTime: modTime, names: make([]string, 0, len(entries))}
+	for _, e := range entries {
+		entry.names = append(entry.names, e.Name())
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	matches := entry.index(fold)[key]
+	if time.Since(modTime) < listingSettleTime {
+		delete(c.dirs, dir)
+		return matches
+	}
+	if len(c.dirs) >= maxCachedListings {
+		c.dirs = make(map[string]*listing)
+	}
+	c.dirs[dir] = entry
+	return matches
+}
+
+// index builds the requested key map on first use; callers hold the cache lock.
+func (l *listing) index(fold bool) map[string][]string {
+	if fold {
+		if l.byFold == nil {
+			l.byFold = groupNames(l.names, FoldKey)
+		}
+		return l.byFold
+	}
+	if l.byNFC == nil {
+		l.byNFC = groupNames(l.names, NFC)
+	}
+	return l.byNFC
+}
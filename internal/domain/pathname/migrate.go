@@ -0,0 +1,278 @@
+package pathname
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// IssueNotNFC marks an entry whose name is not in NFC and can be renamed in place.
+	IssueNotNFC = "not_nfc"
+	// IssueNormalization marks siblings that are equal after NFC normalization.
+	IssueNormalization = "normalization_conflict"
+	// IssueCase marks siblings that only differ by letter case.
+	IssueCase = "case_conflict"
+)
+
+// MigrateOptions controls Migrate.
+type MigrateOptions struct {
+	// DryRun reports what would change without touching the tree.
+	DryRun bool
+	// CaseInsensitive also reports (and with RenameConflicts renames) case-only collisions.
+	CaseInsensitive bool
+	// RenameConflicts renames colliding entries to unique names instead of only reporting them.
+	RenameConflicts bool
+	// Skip leaves an entry (given by its path relative to root) and everything
+	// below it untouched, e.g. internal stores keyed by the stored file name.
+	Skip func(rel string) bool
+	// FS holds the tree; nil uses the host filesystem.
+	FS MigrateFS
+}
+
+// MigrateFS is the part of a storage backend Migrate needs. storage.Backend
+// satisfies it.
+type MigrateFS interface {
+	FS
+	Rename(oldName, newName string) error
+}
+
+// Issue is one conflicting group of entries in a directory.
+type Issue struct {
+	Dir   string   `json:"dir"`
+	Kind  string   `json:"kind"`
+	Names []string `json:"names"`
+}
+
+// Rename records an applied (or, in dry-run mode, planned) rename.
+type Rename struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Reason string `json:"reason"`
+}
+
+// MigrateReport summarizes a migration run.
+type MigrateReport struct {
+	Root        string   `json:"root"`
+	DryRun      bool     `json:"dryRun"`
+	Directories int      `json:"directories"`
+	Entries     int      `json:"entries"`
+	Renames     []Rename `json:"renames"`
+	Conflicts   []Issue  `json:"conflicts"`
+}
+
+// Migrate walks root, renames non-NFC names to NFC and reports (or renames)
+// entries that collide after normalization or case folding. Symlinks are
+// neither followed nor renamed.
+func Migrate(root string, opts MigrateOptions) (*MigrateReport, error) {
+	if opts.FS == nil {
+		opts.FS = osFS{}
+	}
+	report := &MigrateReport{Root: root, DryRun: opts.DryRun, Renames: []Rename{}, Conflicts: []Issue{}}
+	if err := migrateDir(root, root, opts, report); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+func migrateDir(root, dir string, opts MigrateOptions, report *MigrateReport) error {
+	entries, err := opts.FS.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	rel := relDir(root, dir)
+	if opts.Skip != nil {
+		kept := entries[:0]
+		for _, entry := range entries {
+			if !opts.Skip(joinRel(rel, entry.Name())) {
+				kept = append(kept, entry)
+			}
+		}
+		entries = kept
+	}
+	report.Directories++
+	report.Entries += len(entries)
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	taken := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		taken[name] = struct{}{}
+	}
+	// final maps each original name to its name after this pass.
+	final := make(map[string]string, len(names))
+	for _, name := range names {
+		final[name] = name
+	}
+
+	byNFC := groupNames(names, NFC)
+	for _, key := range sortedGroupKeys(byNFC) {
+		group := byNFC[key]
+		if len(group) == 1 {
+			if group[0] != key {
+				if _, exists := taken[key]; exists {
+					continue
+				}
+				if err := applyRename(dir, rel, group[0], key, IssueNotNFC, opts, report, taken); err != nil {
+					return err
+				}
+				final[group[0]] = key
+			}
+			continue
+		}
+		report.Conflicts = append(report.Conflicts, Issue{Dir: rel, Kind: IssueNormalization, Names: group})
+		if !opts.RenameConflicts {
+			continue
+		}
+		// Keep the NFC spelling (or the first name) and move the others aside.
+		keep := group[0]
+		for _, name := range group {
+			if name == key {
+				keep = name
+			}
+		}
+		for _, name := range group {
+			if name == keep {
+				continue
+			}
+			target := uniqueName(key, taken)
+			if err := applyRename(dir, rel, name, target, IssueNormalization, opts, report, taken); err != nil {
+				return err
+			}
+			final[name] = target
+		}
+	}
+
+	if opts.CaseInsensitive {
+		current := make([]string, 0, len(final))
+		for _, name := range final {
+			current = append(current, name)
+		}
+		sort.Strings(current)
+		byFold := groupNames(current, FoldKey)
+		for _, key := range sortedGroupKeys(byFold) {
+			group := byFold[key]
+			if len(group) < 2 || len(groupNames(group, NFC)) < 2 {
+				// Normalization-only duplicates were reported above.
+				continue
+			}
+			report.Conflicts = append(report.Conflicts, Issue{Dir: rel, Kind: IssueCase, Names: group})
+			if !opts.RenameConflicts {
+				continue
+			}
+			for _, name := range group[1:] {
+				target := uniqueFoldName(NFC(name), taken)
+				if err := applyRename(dir, rel, name, target, IssueCase, opts, report, taken); err != nil {
+					return err
+				}
+				for original, renamed := range final {
+					if renamed == name {
+						final[original] = target
+					}
+				}
+			}
+		}
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || entry.Type()&os.ModeSymlink != 0 {
+			continue
+		}
+		next := final[entry.Name()]
+		if opts.DryRun {
+			// Nothing was renamed on disk; walk the original path.
+			next = entry.Name()
+		}
+		if err := migrateDir(root, filepath.Join(dir, next), opts, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyRename(dir, rel, from, to, reason string, opts MigrateOptions, report *MigrateReport, taken map[string]struct{}) error {
+	if !opts.DryRun {
+		if err := opts.FS.Rename(filepath.Join(dir, from), filepath.Join(dir, to)); err != nil {
+			return fmt.Errorf("rename %s: %w", filepath.Join(dir, from), err)
+		}
+	}
+	taken[to] = struct{}{}
+	report.Renames = append(report.Renames, Rename{
+		From:   joinRel(rel, from),
+		To:     joinRel(rel, to),
+		Reason: reason,
+	})
+	return nil
+}
+
+func groupNames(names []string, keyFn func(string) string) map[string][]string {
+	groups := make(map[string][]string, len(names))
+	for _, name := range names {
+		key := keyFn(name)
+		groups[key] = append(groups[key], name)
+	}
+	return groups
+}
+
+func sortedGroupKeys(groups map[string][]string) []string {
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// uniqueName returns "name (conflict N).ext" that is not taken yet.
+func uniqueName(name string, taken map[string]struct{}) string {
+	return nextConflictName(name, func(candidate string) bool {
+		_, exists := taken[candidate]
+		return exists
+	})
+}
+
+// uniqueFoldName is like uniqueName but also avoids case-only matches.
+func uniqueFoldName(name string, taken map[string]struct{}) string {
+	folded := make(map[string]struct{}, len(taken))
+	for existing := range taken {
+		folded[FoldKey(existing)] = struct{}{}
+	}
+	return nextConflictName(name, func(candidate string) bool {
+		_, exists := folded[FoldKey(candidate)]
+		return exists
+	})
+}
+
+func nextConflictName(name string, exists func(string) bool) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (conflict %d)%s", base, i, ext)
+		if !exists(candidate) {
+			return candidate
+		}
+	}
+}
+
+func relDir(root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return "/"
+	}
+	return "/" + filepath.ToSlash(rel)
+}
+
+func joinRel(rel, name string) string {
+	if rel == "/" {
+		return "/" + name
+	}
+	return rel + "/" + name
+}
@@ -0,0 +1,162 @@
+// Package pathname normalizes user-supplied path names so that the same file
+// name sent by different clients (macOS sends NFD, Windows/Linux send NFC)
+// maps to one entry on disk, and optionally guards case-only collisions.
+package pathname
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrCaseCollision is returned when a new entry differs from an existing
+// sibling only by letter case (or Unicode normalization form).
+var ErrCaseCollision = errors.New("name collides with an existing entry")
+
+// Policy controls how path names are normalized. The zero value keeps names
+// byte-for-byte as received. Callers build it from configuration and hand it
+// to every component that maps request paths to disk paths.
+type Policy struct {
+	// NFC converts every incoming path to Unicode Normalization Form C.
+	NFC bool
+	// CaseInsensitive rejects new entries whose name only differs by case
+	// from an existing sibling.
+	CaseInsensitive bool
+	// FS looks up existing entries; nil uses the host filesystem.
+	FS FS
+}
+
+// FS is the part of a storage backend the policy needs to find existing
+// entries. storage.Backend satisfies it.
+type FS interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// WithFS returns a copy of the policy that looks up entries in fsys.
+func (p Policy) WithFS(fsys FS) Policy {
+	p.FS = fsys
+	return p
+}
+
+func (p Policy) fs() FS {
+	if p.FS == nil {
+		return osFS{}
+	}
+	return p.FS
+}
+
+// osFS is the host filesystem.
+type osFS struct{}
+
+func (osFS) Stat(name string) (fs.FileInfo, error)      { return os.Stat(name) }
+func (osFS) Lstat(name string) (fs.FileInfo, error)     { return os.Lstat(name) }
+func (osFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+func (osFS) Rename(oldName, newName string) error       { return os.Rename(oldName, newName) }
+
+// Normalize converts name (a single segment or a whole path) to NFC when the
+// policy enables it.
+func (p Policy) Normalize(name string) string {
+	if !p.NFC {
+		return name
+	}
+	return NFC(name)
+}
+
+// NFC converts name to NFC regardless of the policy.
+func NFC(name string) string {
+	if norm.NFC.IsNormalString(name) {
+		return name
+	}
+	return norm.NFC.String(name)
+}
+
+// FoldKey returns the comparison key used for case-insensitive matching.
+func FoldKey(name string) string {
+	return cases.Fold().String(NFC(name))
+}
+
+// Resolve maps fullPath (below root) to the entry that already exists on
+// disk when the path only differs from it by normalization form, so legacy
+// NFD entries stay reachable through NFC requests. When nothing matches, the
+// normalized path is returned unchanged.
+func (p Policy) Resolve(root, fullPath string) string {
+	if !p.NFC {
+		return fullPath
+	}
+	fsys := p.fs()
+	if _, err := fsys.Lstat(fullPath); err == nil || !os.IsNotExist(err) {
+		return fullPath
+	}
+	rel, err := filepath.Rel(root, fullPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fullPath
+	}
+	resolved := root
+	for _, segment := range strings.Split(rel, string(filepath.Separator)) {
+		candidate := filepath.Join(resolved, segment)
+		if _, err := fsys.Lstat(candidate); err == nil {
+			resolved = candidate
+			continue
+		}
+		if norm.NFD.IsNormalString(segment) {
+			// A legacy entry is the NFD spelling, which is the segment itself.
+			return fullPath
+		}
+		match, ok := findSibling(fsys, resolved, segment, false)
+		if !ok {
+			return fullPath
+		}
+		resolved = filepath.Join(resolved, match)
+	}
+	return resolved
+}
+
+// CheckCollision returns ErrCaseCollision when the policy guards case-only
+// collisions and the parent of fullPath already holds a different entry with
+// the same folded name. An existing exact match is not a collision.
+func (p Policy) CheckCollision(fullPath string) error {
+	if !p.CaseInsensitive && !p.NFC {
+		return nil
+	}
+	fsys := p.fs()
+	if _, err := fsys.Lstat(fullPath); err == nil {
+		return nil
+	}
+	if match, ok := findSibling(fsys, filepath.Dir(fullPath), filepath.Base(fullPath), p.CaseInsensitive); ok {
+		return &CollisionError{Path: fullPath, Existing: filepath.Join(filepath.Dir(fullPath), match)}
+	}
+	return nil
+}
+
+// CollisionError reports the existing entry that blocks a new name.
+type CollisionError struct {
+	Path     string
+	Existing string
+}
+
+func (e *CollisionError) Error() string {
+	return ErrCaseCollision.Error() + ": " + filepath.Base(e.Existing)
+}
+
+func (e *CollisionError) Unwrap() error { return ErrCaseCollision }
+
+func findSibling(fsys FS, dir, name string, fold bool) (string, bool) {
+	keyFn := NFC
+	if fold {
+		keyFn = FoldKey
+	}
+	want := keyFn(name)
+	for _, candidate := range listings.lookup(fsys, dir, want, fold) {
+		if candidate != name {
+			return candidate, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,157 @@
+package pathname
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+const (
+	nfcName = "caf\u00e9.txt"  // é as a single code point
+	nfdName = "cafe\u0301.txt" // e + combining acute accent
+)
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNormalizeFollowsPolicy(t *testing.T) {
+	if got := (Policy{}).Normalize("/docs/" + nfdName); got != "/docs/"+nfdName {
+		t.Fatalf("normalization must be off by default, got %q", got)
+	}
+	if got := (Policy{NFC: true}).Normalize("/docs/" + nfdName); got != "/docs/"+nfcName {
+		t.Fatalf("Normalize() = %q, want NFC", got)
+	}
+}
+
+func TestResolveFindsLegacyNFDEntry(t *testing.T) {
+	policy := Policy{NFC: true}
+	root := t.TempDir()
+	legacy := filepath.Join(root, "docs", nfdName)
+	writeTestFile(t, legacy)
+
+	if got := policy.Resolve(root, filepath.Join(root, "docs", nfcName)); got != legacy {
+		t.Fatalf("Resolve() = %q, want legacy %q", got, legacy)
+	}
+	missing := filepath.Join(root, "docs", "other.txt")
+	if got := policy.Resolve(root, missing); got != missing {
+		t.Fatalf("Resolve() of a missing entry = %q, want %q", got, missing)
+	}
+}
+
+func TestCheckCollisionGuardsCaseOnlyNames(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "Report.txt"))
+
+	if err := (Policy{NFC: true}).CheckCollision(filepath.Join(root, "report.txt")); err != nil {
+		t.Fatalf("case guard disabled, got %v", err)
+	}
+
+	policy := Policy{NFC: true, CaseInsensitive: true}
+	err := policy.CheckCollision(filepath.Join(root, "REPORT.txt"))
+	var collision *CollisionError
+	if !errors.Is(err, ErrCaseCollision) || !errors.As(err, &collision) {
+		t.Fatalf("expected collision, got %v", err)
+	}
+	if collision.Existing != filepath.Join(root, "Report.txt") {
+		t.Fatalf("unexpected existing entry %q", collision.Existing)
+	}
+	if err := policy.CheckCollision(filepath.Join(root, "Report.txt")); err != nil {
+		t.Fatalf("exact match must not collide, got %v", err)
+	}
+}
+
+func TestCheckCollisionSeesEntriesAddedAfterListingIsCached(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a.txt"))
+	settled := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(root, settled, settled); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := Policy{CaseInsensitive: true}
+	if err := policy.CheckCollision(filepath.Join(root, "B.txt")); err != nil {
+		t.Fatalf("unexpected collision: %v", err)
+	}
+	writeTestFile(t, filepath.Join(root, "b.txt"))
+	if err := policy.CheckCollision(filepath.Join(root, "B.txt")); !errors.Is(err, ErrCaseCollision) {
+		t.Fatalf("expected the new sibling to collide, got %v", err)
+	}
+}
+
+func TestMigrateRenamesAndReportsConflicts(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "a", nfdName))
+	writeTestFile(t, filepath.Join(root, "b", nfdName))
+	writeTestFile(t, filepath.Join(root, "b", nfcName))
+	writeTestFile(t, filepath.Join(root, "c", "Readme.md"))
+	writeTestFile(t, filepath.Join(root, "c", "README.md"))
+
+	report, err := Migrate(root, MigrateOptions{DryRun: true, CaseInsensitive: true})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(report.Renames) != 1 || report.Renames[0].To != "/a/"+nfcName {
+		t.Fatalf("unexpected planned renames: %#v", report.Renames)
+	}
+	if len(report.Conflicts) != 2 {
+		t.Fatalf("unexpected conflicts: %#v", report.Conflicts)
+	}
+	if _, err := os.Stat(filepath.Join(root, "a", nfdName)); err != nil {
+		t.Fatalf("dry run must not rename: %v", err)
+	}
+
+	if _, err := Migrate(root, MigrateOptions{CaseInsensitive: true, RenameConflicts: true}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	want := map[string][]string{
+		"a": {nfcName},
+		"b": {"caf\u00e9 (conflict 1).txt", nfcName},
+		"c": {"README.md", "Readme (conflict 1).md"},
+	}
+	for dir, names := range want {
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			got = append(got, entry.Name())
+		}
+		sort.Strings(got)
+		if len(got) != len(names) {
+			t.Fatalf("%s: got %q, want %q", dir, got, names)
+		}
+		for i := range names {
+			if got[i] != names[i] {
+				t.Fatalf("%s: got %q, want %q", dir, got, names)
+			}
+		}
+	}
+}
+
+func TestMigrateSkipsExcludedEntries(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, ".recycle", "h1_"+nfdName))
+	writeTestFile(t, filepath.Join(root, "alice", nfdName))
+
+	report, err := Migrate(root, MigrateOptions{Skip: func(rel string) bool { return rel == "/.recycle" }})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(report.Renames) != 1 || report.Renames[0].To != "/alice/"+nfcName {
+		t.Fatalf("unexpected renames: %#v", report.Renames)
+	}
+	if _, err := os.Stat(filepath.Join(root, ".recycle", "h1_"+nfdName)); err != nil {
+		t.Fatalf("skipped entry must keep its name: %v", err)
+	}
+}
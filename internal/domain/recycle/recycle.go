@@ -22,6 +22,7 @@ type RecycleItem struct {
 	Name      string    // 文件名
 	Path      string    // 相对路径（相对于目录根）
 	IsDir     bool      // 是否目录
+	BatchID   string    // 删除批次 ID（同一次 DELETE 删除的项目共享）
 	Size      int64     // 文件大小（字节）
 	DeletedAt time.Time // 删除时间
 	CreatedAt time.Time // 创建时间
@@ -30,15 +31,17 @@ type RecycleItem struct {
 // NewRecycleItem 创建新的回收站项目
 func NewRecycleItem(userID, username, directory, name, path string, isDir bool, size int64) *RecycleItem {
 	now := time.Now()
+	hash := generateHash()
 	return &RecycleItem{
 		ID:        generateID(),
-		Hash:      generateHash(),
+		Hash:      hash,
 		UserID:    userID,
 		Username:  username,
 		Directory: directory,
 		Name:      name,
 		Path:      path,
 		IsDir:     isDir,
+		BatchID:   hash,
 		Size:      size,
 		DeletedAt: now,
 		CreatedAt: now,
@@ -51,6 +54,19 @@ func (r *RecycleItem) GetOriginalPath() string {
 	return r.Path
 }
 
+// DeletionBatch 返回删除批次 ID；旧记录没有批次时以自身 hash 作为单独批次
+func (r *RecycleItem) DeletionBatch() string {
+	if r.BatchID == "" {
+		return r.Hash
+	}
+	return r.BatchID
+}
+
+// NewBatchID 生成删除批次 ID
+func NewBatchID() string {
+	return uuid.NewString()
+}
+
 // generateID 生成内部 ID
 func generateID() string {
 	return uuid.NewString()
@@ -0,0 +1,42 @@
+package share
+
+import "time"
+
+// 访问日志的操作类型
+const (
+	AccessView     = "view"
+	AccessDownload = "download"
+	AccessList     = "list"
+	AccessArchive  = "archive"
+	AccessUnlock   = "unlock"
+)
+
+// 访问日志的结果，由响应状态码归类
+const (
+	AccessResultOK           = "ok"
+	AccessResultUnauthorized = "unauthorized"
+	AccessResultForbidden    = "forbidden"
+	AccessResultNotFound     = "not_found"
+	AccessResultExpired      = "expired"
+	AccessResultThrottled    = "throttled"
+	AccessResultRejected     = "rejected"
+	AccessResultError        = "error"
+)
+
+// AccessLogEntry 公开分享的一次访问记录
+type AccessLogEntry struct {
+	ID            int64
+	ShareID       string
+	Token         string
+	CreatorUserID string
+	Action        string
+	// Path 目录分享内被访问的路径，分享本身为空
+	Path      string
+	IP        string
+	UserAgent string
+	// Bytes 响应输出的字节数
+	Bytes     int64
+	Status    int
+	Result    string
+	CreatedAt time.Time
+}
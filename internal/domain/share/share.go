@@ -12,11 +12,22 @@ var (
 	ErrShareNotFound = errors.New("share item not found")
 	ErrShareExpired  = errors.New("share item expired")
 	ErrInvalidShare  = errors.New("invalid share")
+	// ErrSharePasswordRequired 分享设置了访问密码，且请求未携带有效的访问凭证
+	ErrSharePasswordRequired = errors.New("share password required")
+	ErrSharePasswordMismatch = errors.New("share password mismatch")
+	// ErrShareAccessThrottled 同一分享与来源 IP 的密码错误次数过多
+	ErrShareAccessThrottled = errors.New("too many share password attempts")
+	// ErrShareUploadOnly 上传模式的分享不允许列出或读取内容
+	ErrShareUploadOnly = errors.New("share is upload-only")
+	// ErrShareUploadLimit 上传模式分享的总大小或文件数已达上限
+	ErrShareUploadLimit = errors.New("share upload limit reached")
 )
 
 const (
 	ModeDownload = "download"
 	ModePreview  = "preview"
+	// ModeUpload 文件收集：匿名访客只能向分享目录上传文件，不能列出或下载
+	ModeUpload = "upload"
 )
 
 // ShareItem 文件分享实体
@@ -30,11 +41,52 @@ type ShareItem struct {
 	Username         string
 	Name             string
 	Path             string
+	IsDir            bool
 	Mode             string
 	ExpiresAt        *time.Time
 	ViewCount        int64
 	DownloadCount    int64
-	CreatedAt        time.Time
+	// PasswordHash 访问密码的哈希，为空表示无需密码
+	PasswordHash string
+	CreatedAt    time.Time
+	// Upload 上传模式的单链接限制；UploadedBytes / UploadedFiles 为已收到的累计量
+	Upload        UploadLimits
+	UploadedBytes int64
+	UploadedFiles int64
+	// MaxViews / MaxDownloads 访问与下载次数上限，达到后链接按过期处理，0 表示不限制
+	MaxViews     int64
+	MaxDownloads int64
+}
+
+// UploadLimits 上传模式分享的单链接限制，零值字段表示不限制
+type UploadLimits struct {
+	MaxFileSize       int64    `json:"max_file_size,omitempty"`
+	MaxTotalBytes     int64    `json:"max_total_bytes,omitempty"`
+	MaxFiles          int64    `json:"max_files,omitempty"`
+	AllowedExtensions []string `json:"allowed_extensions,omitempty"`
+}
+
+// Normalized 返回规范化后的副本（扩展名小写并带前导点）
+func (l UploadLimits) Normalized() (UploadLimits, error) {
+	if l.MaxFileSize < 0 || l.MaxTotalBytes < 0 || l.MaxFiles < 0 {
+		return UploadLimits{}, errors.New("upload limits must not be negative")
+	}
+	out := UploadLimits{
+		MaxFileSize:   l.MaxFileSize,
+		MaxTotalBytes: l.MaxTotalBytes,
+		MaxFiles:      l.MaxFiles,
+	}
+	for _, ext := range l.AllowedExtensions {
+		ext = strings.ToLower(strings.TrimSpace(ext))
+		if ext == "" {
+			continue
+		}
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		out.AllowedExtensions = append(out.AllowedExtensions, ext)
+	}
+	return out, nil
 }
 
 func NewResourceDerivedShareItem(ownerUserID, ownerUsername, creatorUserID, sourceResourceID, path, name, mode string, expiresAt *time.Time) *ShareItem {
@@ -78,6 +130,20 @@ func (s *ShareItem) IsExpired() bool {
 	return time.Now().After(*s.ExpiresAt)
 }
 
+// LimitReached 判断访问或下载次数是否已达上限
+func (s *ShareItem) LimitReached() bool {
+	if s == nil {
+		return false
+	}
+	return (s.MaxViews > 0 && s.ViewCount >= s.MaxViews) ||
+		(s.MaxDownloads > 0 && s.DownloadCount >= s.MaxDownloads)
+}
+
+// HasPassword 判断分享是否需要访问密码
+func (s *ShareItem) HasPassword() bool {
+	return s != nil && s.PasswordHash != ""
+}
+
 func (s *ShareItem) IsPreviewMode() bool {
 	if s == nil {
 		return false
@@ -85,12 +151,22 @@ func (s *ShareItem) IsPreviewMode() bool {
 	return normalizeMode(s.Mode) == ModePreview
 }
 
+// IsUploadMode 判断是否为只允许上传的文件收集分享
+func (s *ShareItem) IsUploadMode() bool {
+	if s == nil {
+		return false
+	}
+	return normalizeMode(s.Mode) == ModeUpload
+}
+
 func NormalizeMode(mode string) (string, error) {
 	switch strings.TrimSpace(mode) {
 	case "", ModeDownload:
 		return ModeDownload, nil
 	case ModePreview:
 		return ModePreview, nil
+	case ModeUpload:
+		return ModeUpload, nil
 	default:
 		return "", errors.New("invalid share mode")
 	}
@@ -100,6 +176,8 @@ func normalizeMode(mode string) string {
 	switch mode {
 	case ModePreview:
 		return ModePreview
+	case ModeUpload:
+		return ModeUpload
 	default:
 		return ModeDownload
 	}
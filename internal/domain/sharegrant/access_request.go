@@ -0,0 +1,125 @@
+package sharegrant
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+)
+
+var (
+	ErrAccessRequestNotFound = errors.New("share access request not found")
+	// ErrAccessRequestPending is returned when the requester already waits for
+	// a decision on the same resource.
+	ErrAccessRequestPending = errors.New("share access request already pending")
+)
+
+// Access request states. Only pending requests can be decided or canceled.
+const (
+	RequestStatusPending  = "pending"
+	RequestStatusApproved = "approved"
+	RequestStatusDenied   = "denied"
+	RequestStatusCanceled = "canceled"
+)
+
+// Audit actions recorded for every access request transition.
+const (
+	RequestActionRequested = "requested"
+	RequestActionApproved  = "approved"
+	RequestActionDenied    = "denied"
+	RequestActionCanceled  = "canceled"
+)
+
+// AccessRequest asks the owner of a resource to create or widen the
+// requester's personal grant. The target is kept as owner/path so requests
+// raised from a public link work before the resource has been projected.
+type AccessRequest struct {
+	ID              string
+	RequesterUserID string
+	OwnerUserID     string
+	// ResourceID is empty until the request targets a projected resource.
+	ResourceID string
+	// PublicShareID is set when the request was raised from a public link.
+	PublicShareID  string
+	NormalizedPath string
+	IsDir          bool
+	Permissions    string
+	ExpiresAt      *time.Time
+	Message        string
+	Status         string
+	DeciderUserID  string
+	DecisionNote   string
+	// GrantID is the grant created or widened by the approval.
+	GrantID   string
+	CreatedAt time.Time
+	DecidedAt *time.Time
+	// RequesterUsername / OwnerUsername are filled by queries for display.
+	RequesterUsername string
+	OwnerUsername     string
+}
+
+// AccessRequestEvent is one entry of the audit history shared by both sides.
+type AccessRequestEvent struct {
+	ID            int64
+	RequestID     string
+	ActorUserID   string
+	ActorUsername string
+	Action        string
+	Permissions   string
+	ExpiresAt     *time.Time
+	Note          string
+	CreatedAt     time.Time
+}
+
+// NewAccessRequest creates a pending request for resource on behalf of requesterUserID.
+func NewAccessRequest(requesterUserID string, resource Resource, permissions string, expiresAt *time.Time, message string) *AccessRequest {
+	return &AccessRequest{
+		ID:              uuid.NewString(),
+		RequesterUserID: requesterUserID,
+		OwnerUserID:     resource.OwnerUserID,
+		ResourceID:      resource.ID,
+		NormalizedPath:  NormalizePath(resource.NormalizedPath),
+		IsDir:           resource.IsDir,
+		Permissions:     UnionPermissions(permissions),
+		ExpiresAt:       expiresAt,
+		Message:         strings.TrimSpace(message),
+		Status:          RequestStatusPending,
+		CreatedAt:       time.Now(),
+	}
+}
+
+// IsPending reports whether the request still waits for a decision.
+func (r *AccessRequest) IsPending() bool {
+	return r.Status == RequestStatusPending
+}
+
+// UnionPermissions merges permission strings into canonical CRUD order.
+// Unlike grant evaluation, a blank value contributes nothing.
+func UnionPermissions(values ...string) string {
+	merged := &user.Permissions{}
+	for _, raw := range values {
+		current := user.ParsePermissions(raw)
+		merged.Create = merged.Create || current.Create
+		merged.Read = merged.Read || current.Read
+		merged.Update = merged.Update || current.Update
+		merged.Delete = merged.Delete || current.Delete
+	}
+	return merged.String()
+}
+
+// NormalizePath returns the owner-relative form used as resource identity.
+func NormalizePath(raw string) string {
+	return path.Clean("/" + strings.TrimLeft(strings.TrimSpace(raw), "/"))
+}
+
+// ResourceID derives the stable identifier assigned when a resource is first
+// projected. Resources keep their ID when the owner later moves the path.
+func ResourceID(ownerUserID, normalizedPath string, isDir bool) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t", ownerUserID, normalizedPath, isDir)))
+	return fmt.Sprintf("shr_%x", sum[:20])
+}
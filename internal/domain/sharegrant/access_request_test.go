@@ -0,0 +1,22 @@
+package sharegrant
+
+import "testing"
+
+func TestUnionPermissionsIgnoresBlankValues(t *testing.T) {
+	if got := UnionPermissions("", "ur", "DC"); got != "CRUD" {
+		t.Fatalf("UnionPermissions() = %q, want CRUD", got)
+	}
+	if got := UnionPermissions(""); got != "" {
+		t.Fatalf("blank permissions must not imply read, got %q", got)
+	}
+}
+
+func TestResourceIDIsStableForTheNormalizedPath(t *testing.T) {
+	first := ResourceID("owner-1", NormalizePath("reports/"), true)
+	if first != ResourceID("owner-1", "/reports", true) {
+		t.Fatal("equivalent paths must map to the same resource")
+	}
+	if first == ResourceID("owner-1", "/reports", false) {
+		t.Fatal("files and directories must not share a resource")
+	}
+}
@@ -0,0 +1,51 @@
+package shareuser
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrInviteNotFound = errors.New("share invite not found")
+
+// 邮箱邀请状态
+const (
+	InviteStatusPending  = "pending"
+	InviteStatusAccepted = "accepted"
+	InviteStatusRevoked  = "revoked"
+)
+
+// EmailInvite 定向分享的邮箱邀请：收件人尚无账号时保持待生效，
+// 该邮箱通过验证码登录后转为对应用户的受众
+type EmailInvite struct {
+	ID             string
+	ShareID        string
+	OwnerUserID    string
+	Email          string
+	Status         string
+	AcceptedUserID string
+	CreatedAt      time.Time
+	AcceptedAt     *time.Time
+	// ShareName / SharePath 查询时关联分享记录填充
+	ShareName string
+	SharePath string
+}
+
+// NewEmailInvite 创建待生效的邮箱邀请
+func NewEmailInvite(shareID, ownerUserID, email string) *EmailInvite {
+	return &EmailInvite{
+		ID:          uuid.NewString(),
+		ShareID:     shareID,
+		OwnerUserID: ownerUserID,
+		Email:       strings.ToLower(strings.TrimSpace(email)),
+		Status:      InviteStatusPending,
+		CreatedAt:   time.Now(),
+	}
+}
+
+// IsPending 判断邀请是否仍待生效
+func (i *EmailInvite) IsPending() bool {
+	return i.Status == InviteStatusPending
+}
@@ -0,0 +1,147 @@
+package team
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+)
+
+var (
+	ErrTeamsDisabled        = errors.New("team spaces are disabled")
+	ErrTeamNotFound         = errors.New("team not found")
+	ErrMemberNotFound       = errors.New("team member not found")
+	ErrDuplicateMember      = errors.New("user is already a team member")
+	ErrPermissionDenied     = errors.New("team permission denied")
+	ErrInvalidRole          = errors.New("invalid team role")
+	ErrNotGroupMember       = errors.New("user is not an active member of the team group")
+	ErrOwnerCannotLeave     = errors.New("team owner must transfer ownership first")
+	ErrTeamNotEmpty         = errors.New("team space is not empty")
+	ErrInvalidTransferOwner = errors.New("new owner must be another team member")
+)
+
+const (
+	// RoleOwner 团队所有者：管理成员、转让所有权、读写团队空间
+	RoleOwner = "owner"
+	// RoleEditor 编辑者：读写团队空间
+	RoleEditor = "editor"
+	// RoleViewer 只读成员
+	RoleViewer = "viewer"
+
+	// SpacePrefix 团队空间在 WebDAV / 资产 API 中的路径前缀，与 personal/apps/services 并列
+	SpacePrefix = "/teams"
+	// accountUsernamePrefix 团队存储账号的用户名前缀
+	accountUsernamePrefix = "team-"
+	// directoryRoot 团队目录在 webdav.directory 下的根目录
+	directoryRoot = ".teams"
+)
+
+// Team 分组所有的团队空间；文件与配额挂在独立的存储账号（AccountUserID）上，
+// 成员离开后数据仍留在团队空间
+type Team struct {
+	ID            string
+	GroupID       string
+	GroupName     string
+	GroupOwnerID  string
+	AccountUserID string
+	Name          string
+	CreatedBy     string
+	// Role 当前查看者在团队中的角色，列表接口填充
+	Role      string
+	Quota     int64
+	UsedSpace int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Member 团队成员
+type Member struct {
+	TeamID        string
+	UserID        string
+	Username      string
+	WalletAddress string
+	Role          string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// NewTeam 创建团队空间
+func NewTeam(groupID, name, createdBy string) (*Team, error) {
+	groupID = strings.TrimSpace(groupID)
+	if groupID == "" {
+		return nil, errors.New("group id is required")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, errors.New("team name is required")
+	}
+	now := time.Now()
+	return &Team{
+		ID:        uuid.NewString(),
+		GroupID:   groupID,
+		Name:      name,
+		CreatedBy: createdBy,
+		Role:      RoleOwner,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// AccountUsername 团队存储账号的用户名；账号没有密码、钱包和邮箱，无法登录
+func AccountUsername(teamID string) string {
+	return accountUsernamePrefix + teamID
+}
+
+// Directory 团队存储账号的目录（相对 webdav.directory）
+func Directory(teamID string) string {
+	return path.Join(directoryRoot, teamID)
+}
+
+// NormalizeRole 校验并规范化成员角色
+func NormalizeRole(role string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(role)) {
+	case RoleOwner:
+		return RoleOwner, nil
+	case RoleEditor:
+		return RoleEditor, nil
+	case "", RoleViewer:
+		return RoleViewer, nil
+	default:
+		return "", ErrInvalidRole
+	}
+}
+
+// CanWrite 角色是否可以写入团队空间
+func CanWrite(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+// Permissions 返回角色在团队空间内的文件权限
+func Permissions(role string) *user.Permissions {
+	if CanWrite(role) {
+		return &user.Permissions{Create: true, Read: true, Update: true, Delete: true}
+	}
+	return &user.Permissions{Read: true}
+}
+
+// SplitSpacePath 拆分 /teams/<id>/rest 形式的路径，rest 以 / 开头
+func SplitSpacePath(rawPath string) (teamID, rest string, ok bool) {
+	rawPath = "/" + strings.TrimLeft(strings.TrimSpace(rawPath), "/")
+	if rawPath != SpacePrefix && !strings.HasPrefix(rawPath, SpacePrefix+"/") {
+		return "", "", false
+	}
+	remaining := strings.TrimPrefix(strings.TrimPrefix(rawPath, SpacePrefix), "/")
+	parts := strings.SplitN(remaining, "/", 2)
+	teamID = strings.TrimSpace(parts[0])
+	if teamID == "" || teamID == "." || teamID == ".." {
+		return "", "", true
+	}
+	rest = "/"
+	if len(parts) == 2 {
+		rest = "/" + parts[1]
+	}
+	return teamID, rest, true
+}
@@ -34,3 +34,8 @@ type Repository interface {
 	// UpdateQuota 更新用户配额
 	UpdateQuota(ctx context.Context, username string, quota int64) error
 }
+
+// VolumePlacer 为新用户选择数据卷，并在该卷上创建用户目录
+type VolumePlacer interface {
+	Place(ctx context.Context, u *User) error
+}
@@ -0,0 +1,238 @@
+package user
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// ErrUploadPolicyViolation 上传被上传策略拒绝
+var ErrUploadPolicyViolation = errors.New("upload policy violation")
+
+// 上传策略违规代码，各协议据此映射错误码
+const (
+	UploadPolicyFileTooLarge       = "FILE_TOO_LARGE"
+	UploadPolicyFileTypeNotAllowed = "FILE_TYPE_NOT_ALLOWED"
+	UploadPolicyTooManyFiles       = "TOO_MANY_FILES"
+)
+
+// UploadPolicy 上传策略：单文件大小、扩展名 / MIME 允许与拒绝列表、单目录文件数上限。
+// 零值字段表示不限制；可配置在全局、用户与路径规则三个层级。
+type UploadPolicy struct {
+	MaxFileSize     int64    `json:"max_file_size,omitempty"`
+	AllowExtensions []string `json:"allow_extensions,omitempty"`
+	DenyExtensions  []string `json:"deny_extensions,omitempty"`
+	AllowMIMETypes  []string `json:"allow_mime_types,omitempty"`
+	DenyMIMETypes   []string `json:"deny_mime_types,omitempty"`
+	MaxFilesPerDir  int      `json:"max_files_per_dir,omitempty"`
+}
+
+// UploadCandidate 待校验的上传文件
+type UploadCandidate struct {
+	Name        string
+	Size        int64 // 小于 0 表示大小未知（例如 chunked 上传），跳过大小校验
+	ContentType string
+	// DirEntries 目标目录已有条目数；仅新建文件时填写，小于 0 表示不校验
+	DirEntries int
+}
+
+// UploadPolicyViolation 描述一次策略违规
+type UploadPolicyViolation struct {
+	Code    string
+	Message string
+}
+
+func (v *UploadPolicyViolation) Error() string {
+	return ErrUploadPolicyViolation.Error() + ": " + v.Message
+}
+
+func (v *UploadPolicyViolation) Unwrap() error { return ErrUploadPolicyViolation }
+
+// IsZero 策略是否未设置任何限制
+func (p *UploadPolicy) IsZero() bool {
+	return p == nil || (p.MaxFileSize <= 0 && p.MaxFilesPerDir <= 0 &&
+		len(p.AllowExtensions) == 0 && len(p.DenyExtensions) == 0 &&
+		len(p.AllowMIMETypes) == 0 && len(p.DenyMIMETypes) == 0)
+}
+
+// Normalized 返回规范化后的副本（扩展名小写并带前导点，MIME 小写），未设置任何限制时返回 nil
+func (p *UploadPolicy) Normalized() (*UploadPolicy, error) {
+	if p == nil {
+		return nil, nil
+	}
+	if p.MaxFileSize < 0 || p.MaxFilesPerDir < 0 {
+		return nil, fmt.Errorf("upload policy limits must not be negative")
+	}
+	out := &UploadPolicy{
+		MaxFileSize:     p.MaxFileSize,
+		MaxFilesPerDir:  p.MaxFilesPerDir,
+		AllowExtensions: normalizeExtensions(p.AllowExtensions),
+		DenyExtensions:  normalizeExtensions(p.DenyExtensions),
+		AllowMIMETypes:  normalizeMIMETypes(p.AllowMIMETypes),
+		DenyMIMETypes:   normalizeMIMETypes(p.DenyMIMETypes),
+	}
+	if out.IsZero() {
+		return nil, nil
+	}
+	return out, nil
+}
+
+// ParseUploadPolicy 解析数据库中保存的 JSON 策略，空字符串返回 nil
+func ParseUploadPolicy(raw string) (*UploadPolicy, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	policy := &UploadPolicy{}
+	if err := json.Unmarshal([]byte(raw), policy); err != nil {
+		return nil, err
+	}
+	return policy.Normalized()
+}
+
+// MergeUploadPolicies 按层级（全局、用户、路径规则）合并策略：
+// 后一层的大小 / 数量上限与允许列表覆盖前一层，拒绝列表累加。
+func MergeUploadPolicies(levels ...*UploadPolicy) UploadPolicy {
+	var merged UploadPolicy
+	for _, level := range levels {
+		if level.IsZero() {
+			continue
+		}
+		if level.MaxFileSize > 0 {
+			merged.MaxFileSize = level.MaxFileSize
+		}
+		if level.MaxFilesPerDir > 0 {
+			merged.MaxFilesPerDir = level.MaxFilesPerDir
+		}
+		if len(level.AllowExtensions) > 0 {
+			merged.AllowExtensions = level.AllowExtensions
+		}
+		if len(level.AllowMIMETypes) > 0 {
+			merged.AllowMIMETypes = level.AllowMIMETypes
+		}
+		merged.DenyExtensions = append(merged.DenyExtensions, level.DenyExtensions...)
+		merged.DenyMIMETypes = append(merged.DenyMIMETypes, level.DenyMIMETypes...)
+	}
+	return merged
+}
+
+// EffectiveUploadPolicy 计算 path（与 CanAccess 相同的权限路径）上生效的上传策略：
+// 全局策略 -> 用户策略 -> 第一条匹配且带策略的路径规则
+func (u *User) EffectiveUploadPolicy(global *UploadPolicy, path string) UploadPolicy {
+	levels := []*UploadPolicy{global}
+	if u != nil {
+		levels = append(levels, u.UploadPolicy)
+		for _, rule := range u.Rules {
+			if rule.UploadPolicy != nil && rule.Matches(path) {
+				levels = append(levels, rule.UploadPolicy)
+				break
+			}
+		}
+	}
+	return MergeUploadPolicies(levels...)
+}
+
+// Check 校验上传文件，违规时返回 *UploadPolicyViolation
+func (p UploadPolicy) Check(candidate UploadCandidate) error {
+	if p.MaxFileSize > 0 && candidate.Size > p.MaxFileSize {
+		return &UploadPolicyViolation{
+			Code:    UploadPolicyFileTooLarge,
+			Message: fmt.Sprintf("file size %d exceeds limit %d", candidate.Size, p.MaxFileSize),
+		}
+	}
+	ext := strings.ToLower(path.Ext(candidate.Name))
+	if containsString(p.DenyExtensions, ext) ||
+		(len(p.AllowExtensions) > 0 && !containsString(p.AllowExtensions, ext)) {
+		return &UploadPolicyViolation{
+			Code:    UploadPolicyFileTypeNotAllowed,
+			Message: fmt.Sprintf("file extension %q is not allowed", ext),
+		}
+	}
+	if len(p.AllowMIMETypes) > 0 || len(p.DenyMIMETypes) > 0 {
+		contentType := UploadContentType(candidate.Name, candidate.ContentType)
+		if matchesMIME(p.DenyMIMETypes, contentType) ||
+			(len(p.AllowMIMETypes) > 0 && !matchesMIME(p.AllowMIMETypes, contentType)) {
+			return &UploadPolicyViolation{
+				Code:    UploadPolicyFileTypeNotAllowed,
+				Message: fmt.Sprintf("content type %q is not allowed", contentType),
+			}
+		}
+	}
+	if p.MaxFilesPerDir > 0 && candidate.DirEntries >= p.MaxFilesPerDir {
+		return &UploadPolicyViolation{
+			Code:    UploadPolicyTooManyFiles,
+			Message: fmt.Sprintf("directory already holds %d entries (limit %d)", candidate.DirEntries, p.MaxFilesPerDir),
+		}
+	}
+	return nil
+}
+
+// UploadContentType 返回用于策略匹配的 MIME 类型：优先使用客户端声明的类型，
+// 缺省或为 application/octet-stream 时按扩展名推断
+func UploadContentType(name, declared string) string {
+	if mediaType, _, err := mime.ParseMediaType(declared); err == nil && mediaType != "application/octet-stream" {
+		return strings.ToLower(mediaType)
+	}
+	if byExt := mime.TypeByExtension(strings.ToLower(path.Ext(name))); byExt != "" {
+		if mediaType, _, err := mime.ParseMediaType(byExt); err == nil {
+			return strings.ToLower(mediaType)
+		}
+	}
+	return "application/octet-stream"
+}
+
+func matchesMIME(patterns []string, contentType string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*/*" || pattern == contentType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeExtensions(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		if !strings.HasPrefix(value, ".") {
+			value = "." + value
+		}
+		out = append(out, value)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func normalizeMIMETypes(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value != "" {
+			out = append(out, value)
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
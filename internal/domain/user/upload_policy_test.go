@@ -0,0 +1,83 @@
+package user
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEffectiveUploadPolicyMergesLevels(t *testing.T) {
+	global := &UploadPolicy{MaxFileSize: 100, DenyExtensions: []string{".exe"}}
+	u := &User{
+		Username:     "alice",
+		UploadPolicy: &UploadPolicy{MaxFileSize: 50, DenyExtensions: []string{".bat"}},
+		Rules: []*Rule{
+			{Path: "/alice/apps/demo", UploadPolicy: &UploadPolicy{AllowMIMETypes: []string{"image/*"}}},
+		},
+	}
+
+	policy := u.EffectiveUploadPolicy(global, "/alice/apps/demo/a.png")
+	if policy.MaxFileSize != 50 {
+		t.Fatalf("user limit should override global, got %d", policy.MaxFileSize)
+	}
+	if len(policy.DenyExtensions) != 2 || len(policy.AllowMIMETypes) != 1 {
+		t.Fatalf("unexpected merged policy: %+v", policy)
+	}
+	if other := u.EffectiveUploadPolicy(global, "/alice/docs/a.txt"); len(other.AllowMIMETypes) != 0 {
+		t.Fatalf("rule policy must only apply below its path, got %+v", other)
+	}
+}
+
+func TestUploadPolicyCheck(t *testing.T) {
+	policy, err := (&UploadPolicy{
+		MaxFileSize:    10,
+		DenyExtensions: []string{"EXE"},
+		AllowMIMETypes: []string{"image/*", "text/plain"},
+		MaxFilesPerDir: 2,
+	}).Normalized()
+	if err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+
+	cases := []struct {
+		name      string
+		candidate UploadCandidate
+		code      string
+	}{
+		{"ok", UploadCandidate{Name: "a.png", Size: 5, DirEntries: 1}, ""},
+		{"unknown size", UploadCandidate{Name: "a.txt", Size: -1, DirEntries: -1}, ""},
+		{"too large", UploadCandidate{Name: "a.png", Size: 11, DirEntries: -1}, UploadPolicyFileTooLarge},
+		{"denied extension", UploadCandidate{Name: "setup.Exe", Size: 1, ContentType: "image/png", DirEntries: -1}, UploadPolicyFileTypeNotAllowed},
+		{"mime not allowed", UploadCandidate{Name: "a.pdf", Size: 1, DirEntries: -1}, UploadPolicyFileTypeNotAllowed},
+		{"declared mime wins", UploadCandidate{Name: "blob", Size: 1, ContentType: "image/webp; q=1", DirEntries: -1}, ""},
+		{"directory full", UploadCandidate{Name: "a.png", Size: 1, DirEntries: 2}, UploadPolicyTooManyFiles},
+	}
+	for _, tc := range cases {
+		err := policy.Check(tc.candidate)
+		if tc.code == "" {
+			if err != nil {
+				t.Fatalf("%s: unexpected error %v", tc.name, err)
+			}
+			continue
+		}
+		var violation *UploadPolicyViolation
+		if !errors.As(err, &violation) || violation.Code != tc.code || !errors.Is(err, ErrUploadPolicyViolation) {
+			t.Fatalf("%s: expected %s, got %v", tc.name, tc.code, err)
+		}
+	}
+}
+
+func TestParseUploadPolicy(t *testing.T) {
+	policy, err := ParseUploadPolicy(`{"max_file_size":1024,"allow_extensions":["jpg"," .PNG "]}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if policy.MaxFileSize != 1024 || len(policy.AllowExtensions) != 2 || policy.AllowExtensions[1] != ".png" {
+		t.Fatalf("unexpected policy: %+v", policy)
+	}
+	if empty, err := ParseUploadPolicy(`{}`); err != nil || empty != nil {
+		t.Fatalf("empty policy should parse to nil, got %+v err=%v", empty, err)
+	}
+	if _, err := ParseUploadPolicy(`{"max_file_size":-1}`); err == nil {
+		t.Fatalf("negative limits must be rejected")
+	}
+}
@@ -33,10 +33,17 @@ type User struct {
 	Directory     string
 	Permissions   *Permissions
 	Rules         []*Rule
-	Quota         int64 // 存储配额（字节），0 表示无限制
-	UsedSpace     int64 // 已使用空间（字节）
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	Quota         int64         // 存储配额（字节），0 表示无限制
+	UsedSpace     int64         // 已使用空间（字节）
+	UploadPolicy  *UploadPolicy // 用户级上传策略，nil 表示沿用全局策略
+	// RecycleRetentionDays 回收站保留天数，0 表示沿用全局配置，负数表示永久保留
+	RecycleRetentionDays int
+	// Volume 用户目录所在的数据卷，空字符串表示默认卷（webdav.directory）
+	Volume string
+	// VolumeMoving 用户目录正在迁移到其它卷，迁移完成前拒绝写入
+	VolumeMoving bool
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
 }
 
 // Permissions 权限
@@ -52,9 +59,11 @@ type Rule struct {
 	Path        string
 	Permissions *Permissions
 	Regex       bool
-	regexOnce   sync.Once
-	regex       *regexp.Regexp
-	regexErr    error
+	// UploadPolicy 路径级上传策略，nil 表示不覆盖用户 / 全局策略
+	UploadPolicy *UploadPolicy
+	regexOnce    sync.Once
+	regex        *regexp.Regexp
+	regexErr     error
 }
 
 // NewUser 创建新用户
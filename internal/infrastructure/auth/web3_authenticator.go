@@ -24,6 +24,7 @@ type Web3Authenticator struct {
 	challengeStore    *ChallengeStore
 	ethSigner         *crypto.EthereumSigner
 	assetSpaceManager *assetspace.Manager
+	volumePlacer      user.VolumePlacer
 	logger            *zap.Logger
 	refreshExpiration time.Duration
 	autoCreateOnUCAN  bool
@@ -131,6 +132,11 @@ func (a *Web3Authenticator) EnsureUserByWallet(ctx context.Context, address stri
 	return nil, fmt.Errorf("failed to find user: %w", err)
 }
 
+// SetVolumePlacer 设置新用户的数据卷选择器
+func (a *Web3Authenticator) SetVolumePlacer(placer user.VolumePlacer) {
+	a.volumePlacer = placer
+}
+
 func (a *Web3Authenticator) createUserFromWallet(ctx context.Context, address string) (*user.User, error) {
 	normalizedAddress := strings.ToLower(strings.TrimSpace(address))
 	if normalizedAddress == "" {
@@ -145,6 +151,11 @@ func (a *Web3Authenticator) createUserFromWallet(ctx context.Context, address st
 		}
 		u.Permissions = user.ParsePermissions("CRUD")
 		_ = u.SetQuota(1073741824)
+		if a.volumePlacer != nil {
+			if err := a.volumePlacer.Place(ctx, u); err != nil {
+				return nil, fmt.Errorf("failed to place user: %w", err)
+			}
+		}
 
 		if err := a.userRepo.Save(ctx, u); err != nil {
 			if errors.Is(err, user.ErrDuplicateUsername) {
@@ -0,0 +1,419 @@
+// Package blobstore keeps file contents deduplicated under webdav.directory.
+//
+// Every blob is stored once at <root>/sha256/<aa>/<bb>/<sum>; user trees hold
+// hard links to it, so the link count is the reference count and a blob with
+// no other link is garbage. Files that are modified in place must be detached
+// first so the write does not leak into other references.
+package blobstore
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DirName is the blob store directory under webdav.directory.
+const DirName = ".warehouse-blobs"
+
+const tempPattern = "._blob-*"
+
+var ErrInvalidDigest = errors.New("invalid sha256 digest")
+
+// Store is a SHA-256 keyed, link-counted blob store.
+type Store struct {
+	root    string
+	minSize int64
+}
+
+// IngestResult describes one ingested file.
+type IngestResult struct {
+	SHA256 string
+	Size   int64
+	// Linked reports whether the file now references a blob.
+	Linked bool
+	// Shared reports whether the blob already existed, i.e. bytes were saved.
+	Shared bool
+}
+
+// GCResult summarizes one garbage collection pass.
+type GCResult struct {
+	Scanned      int   `json:"scanned"`
+	Removed      int   `json:"removed"`
+	FreedBytes   int64 `json:"freed_bytes"`
+	TempsRemoved int   `json:"temps_removed"`
+}
+
+// Stats summarizes the blobs currently stored.
+type Stats struct {
+	Blobs int   `json:"blobs"`
+	Bytes int64 `json:"bytes"`
+	// References is the number of links from user trees to blobs.
+	References int64 `json:"references"`
+	// LogicalBytes is what the references would occupy without dedup.
+	LogicalBytes int64 `json:"logical_bytes"`
+}
+
+// New creates a store rooted at <webdavRoot>/.warehouse-blobs. Files smaller
+// than minSize are left alone.
+func New(webdavRoot string, minSize int64) *Store {
+	return &Store{root: filepath.Join(webdavRoot, DirName), minSize: minSize}
+}
+
+func (s *Store) Root() string {
+	return s.root
+}
+
+func (s *Store) MinSize() int64 {
+	return s.minSize
+}
+
+// BlobPath returns where the blob with the given digest is stored.
+func (s *Store) BlobPath(sum string) string {
+	sum = strings.ToLower(sum)
+	if len(sum) < 4 {
+		return filepath.Join(s.root, "sha256", sum)
+	}
+	return filepath.Join(s.root, "sha256", sum[:2], sum[2:4], sum)
+}
+
+// Has reports whether a blob with the digest and size exists.
+func (s *Store) Has(sum string, size int64) bool {
+	if !validDigest(sum) {
+		return false
+	}
+	info, err := os.Stat(s.BlobPath(sum))
+	return err == nil && info.Mode().IsRegular() && info.Size() == size
+}
+
+// Ingest hashes fullPath and makes it reference the matching blob, creating
+// the blob from the file when the content is new.
+func (s *Store) Ingest(fullPath string) (IngestResult, error) {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	if !info.Mode().IsRegular() || info.Size() < s.minSize || info.Size() == 0 {
+		return IngestResult{Size: info.Size()}, nil
+	}
+	sum, err := FileSHA256(fullPath)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	return s.IngestWithDigest(fullPath, sum)
+}
+
+// IngestWithDigest is Ingest for a file whose digest is already known.
+func (s *Store) IngestWithDigest(fullPath, sum string) (IngestResult, error) {
+	if !validDigest(sum) {
+		return IngestResult{}, ErrInvalidDigest
+	}
+	sum = strings.ToLower(sum)
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	result := IngestResult{SHA256: sum, Size: info.Size()}
+	if !info.Mode().IsRegular() || info.Size() < s.minSize || info.Size() == 0 {
+		return result, nil
+	}
+	blobPath := s.BlobPath(sum)
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0o700); err != nil {
+		return result, err
+	}
+	for attempt := 0; attempt < 3; attempt++ {
+		blobInfo, err := os.Stat(blobPath)
+		switch {
+		case err == nil:
+			if os.SameFile(info, blobInfo) {
+				result.Linked = true
+				return result, nil
+			}
+			if blobInfo.Size() != info.Size() {
+				return result, fmt.Errorf("blob %s size mismatch", sum)
+			}
+			if err := replaceWithLink(blobPath, fullPath); err != nil {
+				if os.IsNotExist(err) {
+					// Collected concurrently; store the file itself instead.
+					continue
+				}
+				if errors.Is(err, syscall.EXDEV) {
+					// The file lives on another storage volume.
+					return result, nil
+				}
+				return result, err
+			}
+			result.Linked = true
+			result.Shared = true
+			return result, nil
+		case os.IsNotExist(err):
+			if err := os.Link(fullPath, blobPath); err != nil {
+				if os.IsExist(err) {
+					continue
+				}
+				if errors.Is(err, syscall.EXDEV) {
+					return result, nil
+				}
+				return result, err
+			}
+			result.Linked = true
+			return result, nil
+		default:
+			return result, err
+		}
+	}
+	return result, fmt.Errorf("ingest %s: blob %s kept changing", fullPath, sum)
+}
+
+// IngestTree ingests every regular file below root. It keeps going past
+// per-file failures and returns the first one.
+func (s *Store) IngestTree(root string) error {
+	var firstErr error
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || strings.HasPrefix(d.Name(), "._") {
+			return nil
+		}
+		if _, err := s.Ingest(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return firstErr
+}
+
+// LinkTo materializes target from the blob with the digest. It returns false
+// when the store does not hold that content.
+func (s *Store) LinkTo(sum string, size int64, target string) (bool, error) {
+	if !s.Has(sum, size) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return false, err
+	}
+	if err := replaceWithLink(s.BlobPath(sum), target); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Copy makes dst reference the same blob as src without copying bytes. Files
+// below the size threshold are copied normally.
+func (s *Store) Copy(src, dst string) (IngestResult, error) {
+	result, err := s.Ingest(src)
+	if err != nil {
+		return result, err
+	}
+	if !result.Linked {
+		return result, copyFile(src, dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return result, err
+	}
+	if err := replaceWithLink(s.BlobPath(result.SHA256), dst); err != nil {
+		return result, err
+	}
+	result.Shared = true
+	return result, nil
+}
+
+// GC removes blobs that no user tree references any more, plus temp files
+// left by interrupted writes older than minTempAge.
+func (s *Store) GC(dryRun bool, minTempAge time.Duration) (GCResult, error) {
+	var result GCResult
+	now := time.Now()
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), "._blob-") {
+			if now.Sub(info.ModTime()) >= minTempAge {
+				result.TempsRemoved++
+				if !dryRun {
+					_ = os.Remove(p)
+				}
+			}
+			return nil
+		}
+		result.Scanned++
+		if linkCount(info) > 1 {
+			return nil
+		}
+		result.Removed++
+		result.FreedBytes += info.Size()
+		if dryRun {
+			return nil
+		}
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	return result, err
+}
+
+// Stats walks the store and reports blob and reference totals.
+func (s *Store) Stats() (Stats, error) {
+	var stats Stats
+	err := filepath.WalkDir(s.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), "._blob-") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		refs := int64(linkCount(info)) - 1
+		stats.Blobs++
+		stats.Bytes += info.Size()
+		stats.References += refs
+		stats.LogicalBytes += refs * info.Size()
+		return nil
+	})
+	return stats, err
+}
+
+// Detach gives fullPath its own copy of the content when it shares an inode
+// with other links, so an in-place write cannot modify them. It is a no-op
+// for missing or unshared files and is safe to call with dedup disabled.
+func Detach(fullPath string) error {
+	info, err := os.Lstat(fullPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if !info.Mode().IsRegular() || linkCount(info) <= 1 {
+		return nil
+	}
+	tmp, err := copyToTemp(fullPath, filepath.Dir(fullPath), info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("detach %s: %w", fullPath, err)
+	}
+	if err := os.Chtimes(tmp, info.ModTime(), info.ModTime()); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, fullPath); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// FileSHA256 returns the hex SHA-256 of a file.
+func FileSHA256(fullPath string) (string, error) {
+	f, err := os.Open(fullPath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// replaceWithLink atomically replaces target with a hard link to source.
+func replaceWithLink(source, target string) error {
+	tmp := filepath.Join(filepath.Dir(target), fmt.Sprintf("._blob-%d-%s", time.Now().UnixNano(), filepath.Base(target)))
+	if err := os.Link(source, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	tmp, err := copyToTemp(src, filepath.Dir(dst), info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func copyToTemp(src, dir string, perm os.FileMode) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.CreateTemp(dir, tempPattern)
+	if err != nil {
+		return "", err
+	}
+	tmp := out.Name()
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := out.Chmod(perm); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return "", err
+	}
+	return tmp, nil
+}
+
+func validDigest(sum string) bool {
+	if len(sum) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(sum)
+	return err == nil
+}
@@ -0,0 +1,166 @@
+package blobstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func sameFile(t *testing.T, a, b string) bool {
+	t.Helper()
+	ai, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return os.SameFile(ai, bi)
+}
+
+func TestIngestSharesIdenticalContent(t *testing.T) {
+	root := t.TempDir()
+	store := New(root, 1)
+	a := filepath.Join(root, "alice", "model.bin")
+	b := filepath.Join(root, "bob", "copy.bin")
+	writeFile(t, a, "same bytes")
+	writeFile(t, b, "same bytes")
+
+	first, err := store.Ingest(a)
+	if err != nil || !first.Linked || first.Shared {
+		t.Fatalf("first ingest = %+v, err=%v", first, err)
+	}
+	second, err := store.Ingest(b)
+	if err != nil || !second.Linked || !second.Shared {
+		t.Fatalf("second ingest = %+v, err=%v", second, err)
+	}
+	if !sameFile(t, a, b) {
+		t.Fatalf("identical files must share one blob")
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Blobs != 1 || stats.References != 2 || stats.LogicalBytes != 20 || stats.Bytes != 10 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestDetachKeepsOtherReferencesIntact(t *testing.T) {
+	root := t.TempDir()
+	store := New(root, 1)
+	a := filepath.Join(root, "alice", "a.txt")
+	b := filepath.Join(root, "alice", "b.txt")
+	writeFile(t, a, "shared")
+	if _, err := store.Copy(a, b); err != nil {
+		t.Fatalf("copy: %v", err)
+	}
+	if !sameFile(t, a, b) {
+		t.Fatalf("copy must link the blob")
+	}
+
+	if err := Detach(b); err != nil {
+		t.Fatalf("detach: %v", err)
+	}
+	f, err := os.OpenFile(b, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("SH"), 0); err != nil {
+		t.Fatal(err)
+	}
+	_ = f.Close()
+
+	if got := readFile(t, a); got != "shared" {
+		t.Fatalf("in-place write leaked into another reference: %q", got)
+	}
+	if got := readFile(t, b); got != "SHared" {
+		t.Fatalf("detached file content = %q", got)
+	}
+}
+
+func TestGCRemovesUnreferencedBlobs(t *testing.T) {
+	root := t.TempDir()
+	store := New(root, 1)
+	a := filepath.Join(root, "alice", "a.txt")
+	writeFile(t, a, "gone soon")
+	result, err := store.Ingest(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gc, err := store.GC(false, 0); err != nil || gc.Removed != 0 {
+		t.Fatalf("referenced blob must survive GC: %+v err=%v", gc, err)
+	}
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	gc, err := store.GC(true, 0)
+	if err != nil || gc.Removed != 1 || gc.FreedBytes != 9 {
+		t.Fatalf("dry run = %+v err=%v", gc, err)
+	}
+	if !store.Has(result.SHA256, result.Size) {
+		t.Fatalf("dry run must not delete blobs")
+	}
+	if _, err := store.GC(false, 0); err != nil {
+		t.Fatal(err)
+	}
+	if store.Has(result.SHA256, result.Size) {
+		t.Fatalf("unreferenced blob must be collected")
+	}
+}
+
+func TestLinkToMaterializesKnownContent(t *testing.T) {
+	root := t.TempDir()
+	store := New(root, 1)
+	a := filepath.Join(root, "alice", "a.txt")
+	writeFile(t, a, "payload")
+	result, err := store.Ingest(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := filepath.Join(root, "bob", "nested", "b.txt")
+	linked, err := store.LinkTo(result.SHA256, result.Size, target)
+	if err != nil || !linked {
+		t.Fatalf("link: linked=%v err=%v", linked, err)
+	}
+	if got := readFile(t, target); got != "payload" {
+		t.Fatalf("linked content = %q", got)
+	}
+	if linked, err := store.LinkTo(result.SHA256, result.Size+1, target); err != nil || linked {
+		t.Fatalf("size mismatch must not link: linked=%v err=%v", linked, err)
+	}
+}
+
+func TestIngestSkipsFilesBelowMinSize(t *testing.T) {
+	root := t.TempDir()
+	store := New(root, 1024)
+	a := filepath.Join(root, "alice", "small.txt")
+	writeFile(t, a, "tiny")
+	result, err := store.Ingest(a)
+	if err != nil || result.Linked {
+		t.Fatalf("small file must not be ingested: %+v err=%v", result, err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build unix
+
+package blobstore
+
+import (
+	"os"
+	"syscall"
+)
+
+func linkCount(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Nlink)
+	}
+	return 1
+}
@@ -6,18 +6,28 @@ import (
 
 // Config 应用配置
 type Config struct {
-	Server      ServerConfig      `yaml:"server"`
-	Database    DatabaseConfig    `yaml:"database"` // 新增
-	Node        NodeConfig        `yaml:"node"`
-	Replication ReplicationConfig `yaml:"replication"`
-	Quota       QuotaConfig       `yaml:"quota"`
-	S3          S3Config          `yaml:"s3"`
-	WebDAV      WebDAVConfig      `yaml:"webdav"`
-	Web3        Web3Config        `yaml:"web3"`
-	Email       EmailConfig       `yaml:"email"`
-	Security    SecurityConfig    `yaml:"security"`
-	CORS        CORSConfig        `yaml:"cors"`
-	Log         LogConfig         `yaml:"log"`
+	Server      ServerConfig       `yaml:"server"`
+	Database    DatabaseConfig     `yaml:"database"` // 新增
+	Node        NodeConfig         `yaml:"node"`
+	Replication ReplicationConfig  `yaml:"replication"`
+	Quota       QuotaConfig        `yaml:"quota"`
+	Upload      UploadPolicyConfig `yaml:"upload_policy"`
+	Recycle     RecycleConfig      `yaml:"recycle"`
+	Share       ShareConfig        `yaml:"share"`
+	Teams       TeamsConfig        `yaml:"teams"`
+	Versions    VersionsConfig     `yaml:"versions"`
+	Dedup       DedupConfig        `yaml:"dedup"`
+	Storage     StorageConfig      `yaml:"storage"`
+	Search      SearchConfig       `yaml:"search"`
+	Thumbnails  ThumbnailsConfig   `yaml:"thumbnails"`
+	Jobs        JobsConfig         `yaml:"jobs"`
+	S3          S3Config           `yaml:"s3"`
+	WebDAV      WebDAVConfig       `yaml:"webdav"`
+	Web3        Web3Config         `yaml:"web3"`
+	Email       EmailConfig        `yaml:"email"`
+	Security    SecurityConfig     `yaml:"security"`
+	CORS        CORSConfig         `yaml:"cors"`
+	Log         LogConfig          `yaml:"log"`
 }
 
 // DatabaseConfig 数据库配置
@@ -82,6 +92,145 @@ type QuotaConfig struct {
 	AutoReconcileBatchPause time.Duration `yaml:"auto_reconcile_batch_pause"`
 }
 
+// RecycleConfig 回收站保留与后台清理配置
+type RecycleConfig struct {
+	// RetentionDays 全局保留天数，用户可单独覆盖；0 表示永久保留
+	RetentionDays int `yaml:"retention_days"`
+	// PurgeEnabled 是否开启后台清理；只在非 standby 节点运行
+	PurgeEnabled  bool          `yaml:"purge_enabled"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+	// WarnBefore 清理前多久通过站内消息提醒用户，0 表示不提醒
+	WarnBefore time.Duration `yaml:"warn_before"`
+}
+
+// ShareConfig 分享有效期策略与到期提醒配置，同时作用于公开链接与定向分享
+type ShareConfig struct {
+	// MaxLifetime 新建分享的最长有效期，0 表示不限制；设置后未指定有效期的分享按该值过期
+	MaxLifetime time.Duration `yaml:"max_lifetime"`
+	// ExpiryNotifyEnabled 是否开启到期提醒扫描；只在非 standby 节点运行
+	ExpiryNotifyEnabled  bool          `yaml:"expiry_notify_enabled"`
+	ExpiryNotifyInterval time.Duration `yaml:"expiry_notify_interval"`
+	// WarnBefore 到期前多久提醒所有者与接收方，0 表示只发送已过期通知
+	WarnBefore time.Duration `yaml:"warn_before"`
+	// ExtendBy 一键续期未指定时长时默认延长的时间
+	ExtendBy time.Duration `yaml:"extend_by"`
+}
+
+// TeamsConfig 分组团队空间配置
+type TeamsConfig struct {
+	// Enabled 是否允许创建与访问团队空间（/teams/<id>）
+	Enabled bool `yaml:"enabled"`
+	// DefaultQuota 新建团队空间的默认配额（字节），0 表示不限制；管理员可按团队存储账号单独调整
+	DefaultQuota int64 `yaml:"default_quota"`
+}
+
+// VersionsConfig 文件历史版本配置：覆盖写入前保留旧内容，版本计入用户额度
+type VersionsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxCount 每个文件最多保留的版本数，0 表示不限制
+	MaxCount int `yaml:"max_count"`
+	// MaxAge 版本最长保留时间，0 表示不限制
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// DedupConfig 内容寻址去重存储配置：相同内容只在 webdav.directory/.warehouse-blobs 下保存一份，
+// 用户目录中的文件以硬链接引用；额度仍按每个用户的逻辑大小计算
+type DedupConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MinSize 小于该字节数的文件不参与去重
+	MinSize int64 `yaml:"min_size"`
+	// GCInterval 后台回收无引用 blob 的周期，0 表示只通过命令行回收
+	GCInterval time.Duration `yaml:"gc_interval"`
+}
+
+// StorageConfig 多卷存储配置：webdav.directory 始终是名为 default 的默认卷，并保存回收站、
+// 上传会话、历史版本等隐藏目录；Volumes 追加其它数据卷，用户目录整体落在某一个卷上
+type StorageConfig struct {
+	// Placement 新用户选卷策略：most_free（剩余空间最多）或 weighted（按权重随机）
+	Placement string `yaml:"placement"`
+	// Volumes 数据卷列表；名为 default 且不填 path 的条目用于设置默认卷的容量、权重与只读
+	Volumes []VolumeConfig `yaml:"volumes"`
+}
+
+// VolumeConfig 单个数据卷
+type VolumeConfig struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+	// Capacity 分配给 warehouse 的字节数，0 表示按磁盘剩余空间
+	Capacity int64 `yaml:"capacity"`
+	// Weight weighted 策略下的权重，未设置时为 1
+	Weight int `yaml:"weight"`
+	// ReadOnly 只读卷不放置新用户、不作为迁移目标，卷上用户的写请求被拒绝
+	ReadOnly bool `yaml:"read_only"`
+}
+
+// SearchConfig 文件名与元数据搜索配置：索引保存在数据库 search_entries 表，随写入事件更新
+type SearchConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxResults 单次查询返回条数上限
+	MaxResults int `yaml:"max_results"`
+	// Content 全文内容索引（需同时开启 search）
+	Content SearchContentConfig `yaml:"content"`
+}
+
+// SearchContentConfig 全文内容索引配置：写入后把文件排入 search_content_jobs，
+// 由后台抽取文本写入 search_contents；只索引用户按空间开启的目录
+type SearchContentConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// MaxFileSize 超过该大小的文件不抽取文本（字节）
+	MaxFileSize int64 `yaml:"max_file_size"`
+	// MaxTextBytes 单个文件保留的文本上限（字节），超出部分截断
+	MaxTextBytes int `yaml:"max_text_bytes"`
+	// Workers 并发抽取任务数
+	Workers int `yaml:"workers"`
+	// PollInterval 队列为空时的轮询间隔
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// MaxAttempts 单个任务最多尝试次数，超过后放弃
+	MaxAttempts int `yaml:"max_attempts"`
+}
+
+// ThumbnailsConfig 图片缩略图配置：缩略图缓存在 webdav.directory/.warehouse-thumbnails 下，
+// 按原文件大小与修改时间校验，不计入用户额度
+type ThumbnailsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Sizes 可请求的缩略图边长（像素），缩略图按比例缩放到该边长的正方形内
+	Sizes []int `yaml:"sizes"`
+	// MaxSourceSize 超过该大小的原图不生成缩略图（字节）
+	MaxSourceSize int64 `yaml:"max_source_size"`
+	// MaxPixels 原图像素数（宽×高）上限，避免解码超大图片占满内存
+	MaxPixels int64 `yaml:"max_pixels"`
+	// Quality JPEG 缩略图质量（1-100）
+	Quality int `yaml:"quality"`
+	// Workers 同时生成缩略图的数量
+	Workers int `yaml:"workers"`
+}
+
+// JobsConfig 后台任务队列配置：任务保存在数据库 jobs 表，由非 standby 节点领取执行
+type JobsConfig struct {
+	// Workers 并发执行的任务数
+	Workers int `yaml:"workers"`
+	// PollInterval 队列为空时的轮询间隔
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// MaxAttempts 单个任务最多尝试次数，超过后标记为失败
+	MaxAttempts int `yaml:"max_attempts"`
+	// Retention 已结束任务的保留时间，超过后删除
+	Retention time.Duration `yaml:"retention"`
+}
+
+// UploadPolicyConfig 全局上传策略；用户与路径规则上的策略在此基础上覆盖（拒绝列表累加）
+type UploadPolicyConfig struct {
+	// MaxFileSize 单文件大小上限（字节），0 表示不限制
+	MaxFileSize int64 `yaml:"max_file_size"`
+	// AllowExtensions / DenyExtensions 扩展名允许 / 拒绝列表（如 ".exe"），允许列表为空表示不限制
+	AllowExtensions []string `yaml:"allow_extensions"`
+	DenyExtensions  []string `yaml:"deny_extensions"`
+	// AllowMIMETypes / DenyMIMETypes MIME 允许 / 拒绝列表，支持 "image/*" 通配
+	AllowMIMETypes []string `yaml:"allow_mime_types"`
+	DenyMIMETypes  []string `yaml:"deny_mime_types"`
+	// MaxFilesPerDir 单目录条目数上限，0 表示不限制
+	MaxFilesPerDir int `yaml:"max_files_per_dir"`
+}
+
 // S3Config controls the optional S3-compatible endpoint. Values in the YAML
 // file are loaded first; WAREHOUSE_S3_* environment variables override them.
 type S3Config struct {
@@ -106,6 +255,14 @@ type WebDAVConfig struct {
 	AutoCreateDirectory bool   `yaml:"auto_create_directory"`
 	NoSniff             bool   `yaml:"no_sniff"`
 	Permissions         string `yaml:"permissions"`
+	// ArchiveMaxSize 目录打包下载与在线解压允许的原始文件总字节数，0 表示不限制
+	ArchiveMaxSize int64 `yaml:"archive_max_size"`
+	// NextcloudCompat 暴露 status.php、OCS capabilities 与 chunking v2 上传端点，供 Nextcloud 客户端使用
+	NextcloudCompat bool `yaml:"nextcloud_compat"`
+	// UnicodeNFC 将 WebDAV、S3、资产 API、上传会话与分享路径统一规范化为 Unicode NFC
+	UnicodeNFC bool `yaml:"unicode_nfc"`
+	// CaseInsensitiveGuard 拒绝创建与同目录已有条目仅大小写不同的文件或目录
+	CaseInsensitiveGuard bool `yaml:"case_insensitive_guard"`
 }
 
 // Web3Config Web3 配置
@@ -134,6 +291,8 @@ type EmailConfig struct {
 	AutoCreateOnLogin  bool          `yaml:"auto_create_on_login"`
 	UseTLS             bool          `yaml:"use_tls"`
 	InsecureSkipVerify bool          `yaml:"insecure_skip_verify"`
+	// ShareInviteTemplatePath 定向分享邮箱邀请的邮件模板
+	ShareInviteTemplatePath string `yaml:"share_invite_template_path"`
 }
 
 // UCANConfig UCAN authentication configuration
@@ -165,6 +324,7 @@ type UCANRequiredCapability struct {
 type SecurityConfig struct {
 	NoPassword     bool     `yaml:"no_password"`
 	BehindProxy    bool     `yaml:"behind_proxy"`
+	TrustedProxies []string `yaml:"trusted_proxies"` // 可信反向代理的 IP 或 CIDR，为空时只信任回环地址
 	AdminAddresses []string `yaml:"admin_addresses"`
 }
 
@@ -236,6 +396,62 @@ func DefaultConfig() *Config {
 			AutoReconcileBatchSize:  100,
 			AutoReconcileBatchPause: 0,
 		},
+		Recycle: RecycleConfig{
+			RetentionDays: 30,
+			PurgeEnabled:  false,
+			PurgeInterval: time.Hour,
+			WarnBefore:    72 * time.Hour,
+		},
+		Share: ShareConfig{
+			MaxLifetime:          0,
+			ExpiryNotifyEnabled:  true,
+			ExpiryNotifyInterval: time.Hour,
+			WarnBefore:           72 * time.Hour,
+			ExtendBy:             7 * 24 * time.Hour,
+		},
+		Teams: TeamsConfig{
+			Enabled:      true,
+			DefaultQuota: 10 * 1024 * 1024 * 1024,
+		},
+		Versions: VersionsConfig{
+			Enabled:  false,
+			MaxCount: 10,
+			MaxAge:   30 * 24 * time.Hour,
+		},
+		Dedup: DedupConfig{
+			Enabled:    false,
+			MinSize:    64 * 1024,
+			GCInterval: 6 * time.Hour,
+		},
+		Search: SearchConfig{
+			Enabled:    false,
+			MaxResults: 200,
+			Content: SearchContentConfig{
+				Enabled:      false,
+				MaxFileSize:  20 << 20,
+				MaxTextBytes: 1 << 20,
+				Workers:      1,
+				PollInterval: 5 * time.Second,
+				MaxAttempts:  3,
+			},
+		},
+		Thumbnails: ThumbnailsConfig{
+			Enabled:       false,
+			Sizes:         []int{64, 256, 1024},
+			MaxSourceSize: 50 << 20,
+			MaxPixels:     50_000_000,
+			Quality:       80,
+			Workers:       2,
+		},
+		Jobs: JobsConfig{
+			Workers:      2,
+			PollInterval: 2 * time.Second,
+			MaxAttempts:  3,
+			Retention:    7 * 24 * time.Hour,
+		},
+		Storage: StorageConfig{
+			Placement: "most_free",
+		},
 		S3: S3Config{
 			Enabled:         false,
 			Address:         "127.0.0.1",
@@ -252,6 +468,7 @@ func DefaultConfig() *Config {
 			AutoCreateDirectory: true,
 			NoSniff:             true,
 			Permissions:         "R",
+			ArchiveMaxSize:      10 * 1024 * 1024 * 1024,
 		},
 		Web3: Web3Config{
 			TokenExpiration:        24 * time.Hour,
@@ -279,10 +496,13 @@ func DefaultConfig() *Config {
 			AutoCreateOnLogin:  true,
 			UseTLS:             false,
 			InsecureSkipVerify: false,
+			// 邮箱邀请复用上面的 SMTP 配置
+			ShareInviteTemplatePath: "resources/email/share_invite_mail_template_zh-CN.html",
 		},
 		Security: SecurityConfig{
 			NoPassword:     false,
 			BehindProxy:    false,
+			TrustedProxies: []string{},
 			AdminAddresses: []string{},
 		},
 		CORS: CORSConfig{
@@ -3,8 +3,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net/netip"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -198,6 +200,93 @@ func (l *Loader) overrideFromEnv(config *Config) {
 			config.Quota.AutoReconcileBatchPause = d
 		}
 	}
+	if v := os.Getenv("WEBDAV_RECYCLE_RETENTION_DAYS"); v != "" {
+		if days, err := strconv.Atoi(v); err == nil {
+			config.Recycle.RetentionDays = days
+		}
+	}
+	if v := os.Getenv("WEBDAV_RECYCLE_PURGE_ENABLED"); v != "" {
+		config.Recycle.PurgeEnabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_RECYCLE_PURGE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Recycle.PurgeInterval = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_RECYCLE_WARN_BEFORE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Recycle.WarnBefore = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_SHARE_MAX_LIFETIME"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Share.MaxLifetime = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_SHARE_EXPIRY_NOTIFY_ENABLED"); v != "" {
+		config.Share.ExpiryNotifyEnabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_SHARE_EXPIRY_NOTIFY_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Share.ExpiryNotifyInterval = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_SHARE_WARN_BEFORE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Share.WarnBefore = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_SHARE_EXTEND_BY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Share.ExtendBy = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_TEAMS_ENABLED"); v != "" {
+		config.Teams.Enabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_TEAMS_DEFAULT_QUOTA"); v != "" {
+		if quota, err := strconv.ParseInt(v, 10, 64); err == nil {
+			config.Teams.DefaultQuota = quota
+		}
+	}
+	if v := os.Getenv("WEBDAV_VERSIONS_ENABLED"); v != "" {
+		config.Versions.Enabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_VERSIONS_MAX_COUNT"); v != "" {
+		if count, err := strconv.Atoi(v); err == nil {
+			config.Versions.MaxCount = count
+		}
+	}
+	if v := os.Getenv("WEBDAV_VERSIONS_MAX_AGE"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Versions.MaxAge = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_DEDUP_ENABLED"); v != "" {
+		config.Dedup.Enabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_DEDUP_MIN_SIZE"); v != "" {
+		if size, err := strconv.ParseInt(v, 10, 64); err == nil {
+			config.Dedup.MinSize = size
+		}
+	}
+	if v := os.Getenv("WEBDAV_DEDUP_GC_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			config.Dedup.GCInterval = d
+		}
+	}
+	if v := os.Getenv("WEBDAV_SEARCH_ENABLED"); v != "" {
+		config.Search.Enabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_SEARCH_CONTENT_ENABLED"); v != "" {
+		config.Search.Content.Enabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_THUMBNAILS_ENABLED"); v != "" {
+		config.Thumbnails.Enabled = parseEnvBool(v)
+	}
+	if v := os.Getenv("WAREHOUSE_STORAGE_PLACEMENT"); v != "" {
+		config.Storage.Placement = v
+	}
 	if v := os.Getenv("WAREHOUSE_S3_ENABLED"); v != "" {
 		// Environment variables intentionally override the YAML deployment default.
 		config.S3.Enabled = parseEnvBool(v)
@@ -234,9 +323,26 @@ func (l *Loader) overrideFromEnv(config *Config) {
 	if v := os.Getenv("WEBDAV_AUTO_CREATE_DIRECTORY"); v != "" {
 		config.WebDAV.AutoCreateDirectory = parseEnvBool(v)
 	}
+	if v := os.Getenv("WEBDAV_ARCHIVE_MAX_SIZE"); v != "" {
+		if size, err := strconv.ParseInt(v, 10, 64); err == nil {
+			config.WebDAV.ArchiveMaxSize = size
+		}
+	}
+	if v := os.Getenv("WEBDAV_NEXTCLOUD_COMPAT"); v != "" {
+		config.WebDAV.NextcloudCompat = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_UNICODE_NFC"); v != "" {
+		config.WebDAV.UnicodeNFC = parseEnvBool(v)
+	}
+	if v := os.Getenv("WEBDAV_CASE_INSENSITIVE_GUARD"); v != "" {
+		config.WebDAV.CaseInsensitiveGuard = parseEnvBool(v)
+	}
 	if v := os.Getenv("WEBDAV_BEHIND_PROXY"); v != "" {
 		config.Security.BehindProxy = parseEnvBool(v)
 	}
+	if v := os.Getenv("WEBDAV_TRUSTED_PROXIES"); v != "" {
+		config.Security.TrustedProxies = strings.Split(v, ",")
+	}
 	if v := os.Getenv("WEBDAV_DB_HOST"); v != "" {
 		config.Database.Host = v
 	}
@@ -283,6 +389,22 @@ func (l *Loader) overrideFromEnv(config *Config) {
 	if v := os.Getenv("WEBDAV_ADMIN_ADDRESSES"); v != "" {
 		config.Security.AdminAddresses = strings.Split(v, ",")
 	}
+	if v := os.Getenv("WEBDAV_UPLOAD_MAX_FILE_SIZE"); v != "" {
+		if size, err := strconv.ParseInt(v, 10, 64); err == nil {
+			config.Upload.MaxFileSize = size
+		}
+	}
+	if v := os.Getenv("WEBDAV_UPLOAD_ALLOW_EXTENSIONS"); v != "" {
+		config.Upload.AllowExtensions = strings.Split(v, ",")
+	}
+	if v := os.Getenv("WEBDAV_UPLOAD_DENY_EXTENSIONS"); v != "" {
+		config.Upload.DenyExtensions = strings.Split(v, ",")
+	}
+	if v := os.Getenv("WEBDAV_UPLOAD_MAX_FILES_PER_DIR"); v != "" {
+		if count, err := strconv.Atoi(v); err == nil {
+			config.Upload.MaxFilesPerDir = count
+		}
+	}
 
 	if v := os.Getenv("WEBDAV_EMAIL_ENABLED"); v != "" {
 		config.Email.Enabled = parseEnvBool(v)
@@ -334,6 +456,9 @@ func (l *Loader) overrideFromEnv(config *Config) {
 	if v := os.Getenv("WEBDAV_EMAIL_INSECURE_SKIP_VERIFY"); v != "" {
 		config.Email.InsecureSkipVerify = parseEnvBool(v)
 	}
+	if v := os.Getenv("WEBDAV_EMAIL_SHARE_INVITE_TEMPLATE_PATH"); v != "" {
+		config.Email.ShareInviteTemplatePath = v
+	}
 }
 
 func parseEnvBool(value string) bool {
@@ -352,6 +477,9 @@ func (l *Loader) validate(config *Config) error {
 	if err := l.validateServer(config); err != nil {
 		return fmt.Errorf("server config: %w", err)
 	}
+	if err := l.validateSecurity(config); err != nil {
+		return fmt.Errorf("security config: %w", err)
+	}
 	if err := l.validateNode(config); err != nil {
 		return fmt.Errorf("node config: %w", err)
 	}
@@ -361,12 +489,39 @@ func (l *Loader) validate(config *Config) error {
 	if err := l.validateQuota(config); err != nil {
 		return fmt.Errorf("quota config: %w", err)
 	}
+	if err := l.validateRecycle(config); err != nil {
+		return fmt.Errorf("recycle config: %w", err)
+	}
+	if err := l.validateShare(config); err != nil {
+		return fmt.Errorf("share config: %w", err)
+	}
+	if err := l.validateTeams(config); err != nil {
+		return fmt.Errorf("teams config: %w", err)
+	}
+	if err := l.validateVersions(config); err != nil {
+		return fmt.Errorf("versions config: %w", err)
+	}
+	if err := l.validateDedup(config); err != nil {
+		return fmt.Errorf("dedup config: %w", err)
+	}
+	if err := l.validateSearch(config); err != nil {
+		return fmt.Errorf("search config: %w", err)
+	}
+	if err := l.validateThumbnails(config); err != nil {
+		return fmt.Errorf("thumbnails config: %w", err)
+	}
+	if err := l.validateJobs(config); err != nil {
+		return fmt.Errorf("jobs config: %w", err)
+	}
 	if err := l.validateS3(config); err != nil {
 		return fmt.Errorf("s3 config: %w", err)
 	}
 	if err := l.validateWebDAV(config); err != nil {
 		return fmt.Errorf("webdav config: %w", err)
 	}
+	if err := l.validateStorage(config); err != nil {
+		return fmt.Errorf("storage config: %w", err)
+	}
 	if err := l.validateWeb3(config); err != nil {
 		return fmt.Errorf("web3 config: %w", err)
 	}
@@ -395,6 +550,173 @@ func (l *Loader) validateQuota(config *Config) error {
 	return nil
 }
 
+func (l *Loader) validateRecycle(config *Config) error {
+	if config.Recycle.RetentionDays < 0 {
+		return errors.New("recycle.retention_days must be greater than or equal to zero")
+	}
+	if config.Recycle.WarnBefore < 0 {
+		return errors.New("recycle.warn_before must be greater than or equal to zero")
+	}
+	if config.Recycle.PurgeEnabled && config.Recycle.PurgeInterval <= 0 {
+		return errors.New("recycle.purge_interval must be greater than zero when purge_enabled is true")
+	}
+	return nil
+}
+
+func (l *Loader) validateShare(config *Config) error {
+	if config.Share.MaxLifetime < 0 {
+		return errors.New("share.max_lifetime must be greater than or equal to zero")
+	}
+	if config.Share.WarnBefore < 0 {
+		return errors.New("share.warn_before must be greater than or equal to zero")
+	}
+	if config.Share.ExtendBy < 0 {
+		return errors.New("share.extend_by must be greater than or equal to zero")
+	}
+	if config.Share.ExpiryNotifyEnabled && config.Share.ExpiryNotifyInterval <= 0 {
+		return errors.New("share.expiry_notify_interval must be greater than zero when expiry_notify_enabled is true")
+	}
+	return nil
+}
+
+func (l *Loader) validateTeams(config *Config) error {
+	if config.Teams.DefaultQuota < 0 {
+		return errors.New("teams.default_quota must be greater than or equal to zero")
+	}
+	return nil
+}
+
+func (l *Loader) validateVersions(config *Config) error {
+	if config.Versions.MaxCount < 0 {
+		return errors.New("versions.max_count must be greater than or equal to zero")
+	}
+	if config.Versions.MaxAge < 0 {
+		return errors.New("versions.max_age must be greater than or equal to zero")
+	}
+	return nil
+}
+
+func (l *Loader) validateDedup(config *Config) error {
+	if config.Dedup.MinSize < 0 {
+		return errors.New("dedup.min_size must be greater than or equal to zero")
+	}
+	if config.Dedup.GCInterval < 0 {
+		return errors.New("dedup.gc_interval must be greater than or equal to zero")
+	}
+	return nil
+}
+
+func (l *Loader) validateSearch(config *Config) error {
+	if config.Search.MaxResults < 0 {
+		return errors.New("search.max_results must be greater than or equal to zero")
+	}
+	if config.Search.MaxResults == 0 {
+		config.Search.MaxResults = 200
+	}
+
+	content := &config.Search.Content
+	if content.MaxFileSize < 0 {
+		return errors.New("search.content.max_file_size must be greater than or equal to zero")
+	}
+	if content.MaxTextBytes < 0 {
+		return errors.New("search.content.max_text_bytes must be greater than or equal to zero")
+	}
+	if content.Workers < 0 {
+		return errors.New("search.content.workers must be greater than or equal to zero")
+	}
+	if content.PollInterval < 0 {
+		return errors.New("search.content.poll_interval must be greater than or equal to zero")
+	}
+	if content.MaxAttempts < 0 {
+		return errors.New("search.content.max_attempts must be greater than or equal to zero")
+	}
+	if content.MaxFileSize == 0 {
+		content.MaxFileSize = 20 << 20
+	}
+	if content.MaxTextBytes == 0 {
+		content.MaxTextBytes = 1 << 20
+	}
+	if content.Workers == 0 {
+		content.Workers = 1
+	}
+	if content.PollInterval == 0 {
+		content.PollInterval = 5 * time.Second
+	}
+	if content.MaxAttempts == 0 {
+		content.MaxAttempts = 3
+	}
+	if content.Enabled && !config.Search.Enabled {
+		return errors.New("search.content.enabled requires search.enabled")
+	}
+	return nil
+}
+
+func (l *Loader) validateThumbnails(config *Config) error {
+	thumbnails := &config.Thumbnails
+	for _, size := range thumbnails.Sizes {
+		if size < 16 || size > 4096 {
+			return fmt.Errorf("thumbnails.sizes entry %d must be between 16 and 4096", size)
+		}
+	}
+	if thumbnails.MaxSourceSize < 0 {
+		return errors.New("thumbnails.max_source_size must be greater than or equal to zero")
+	}
+	if thumbnails.MaxPixels < 0 {
+		return errors.New("thumbnails.max_pixels must be greater than or equal to zero")
+	}
+	if thumbnails.Quality < 0 || thumbnails.Quality > 100 {
+		return errors.New("thumbnails.quality must be between 0 and 100")
+	}
+	if thumbnails.Workers < 0 {
+		return errors.New("thumbnails.workers must be greater than or equal to zero")
+	}
+	if len(thumbnails.Sizes) == 0 {
+		thumbnails.Sizes = []int{64, 256, 1024}
+	}
+	if thumbnails.MaxSourceSize == 0 {
+		thumbnails.MaxSourceSize = 50 << 20
+	}
+	if thumbnails.MaxPixels == 0 {
+		thumbnails.MaxPixels = 50_000_000
+	}
+	if thumbnails.Quality == 0 {
+		thumbnails.Quality = 80
+	}
+	if thumbnails.Workers == 0 {
+		thumbnails.Workers = 2
+	}
+	return nil
+}
+
+func (l *Loader) validateJobs(config *Config) error {
+	jobs := &config.Jobs
+	if jobs.Workers < 0 {
+		return errors.New("jobs.workers must be greater than or equal to zero")
+	}
+	if jobs.PollInterval < 0 {
+		return errors.New("jobs.poll_interval must be greater than or equal to zero")
+	}
+	if jobs.MaxAttempts < 0 {
+		return errors.New("jobs.max_attempts must be greater than or equal to zero")
+	}
+	if jobs.Retention < 0 {
+		return errors.New("jobs.retention must be greater than or equal to zero")
+	}
+	if jobs.Workers == 0 {
+		jobs.Workers = 2
+	}
+	if jobs.PollInterval == 0 {
+		jobs.PollInterval = 2 * time.Second
+	}
+	if jobs.MaxAttempts == 0 {
+		jobs.MaxAttempts = 3
+	}
+	if jobs.Retention == 0 {
+		jobs.Retention = 7 * 24 * time.Hour
+	}
+	return nil
+}
+
 func (l *Loader) validateS3(config *Config) error {
 	s3 := &config.S3
 	s3.Address = strings.TrimSpace(s3.Address)
@@ -561,6 +883,87 @@ func (l *Loader) validateWebDAV(config *Config) error {
 	return nil
 }
 
+// validateStorage 校验数据卷：名称唯一，路径为绝对路径且互不嵌套，缺失时按 auto_create_directory 创建
+func (l *Loader) validateStorage(config *Config) error {
+	placement := strings.ToLower(strings.TrimSpace(config.Storage.Placement))
+	switch placement {
+	case "":
+		placement = "most_free"
+	case "most_free", "weighted":
+	default:
+		return fmt.Errorf("unsupported storage.placement %q", config.Storage.Placement)
+	}
+	config.Storage.Placement = placement
+
+	root, err := filepath.Abs(config.WebDAV.Directory)
+	if err != nil {
+		return fmt.Errorf("resolve webdav.directory: %w", err)
+	}
+	seen := map[string]bool{}
+	paths := []string{filepath.Clean(root)}
+	for i := range config.Storage.Volumes {
+		volume := &config.Storage.Volumes[i]
+		volume.Name = strings.TrimSpace(volume.Name)
+		volume.Path = strings.TrimSpace(volume.Path)
+		if volume.Name == "" {
+			return fmt.Errorf("storage.volumes[%d].name is required", i)
+		}
+		if seen[volume.Name] {
+			return fmt.Errorf("duplicate storage volume %q", volume.Name)
+		}
+		seen[volume.Name] = true
+		if volume.Capacity < 0 {
+			return fmt.Errorf("storage volume %q: capacity must be greater than or equal to zero", volume.Name)
+		}
+		if volume.Weight < 0 {
+			return fmt.Errorf("storage volume %q: weight must be greater than or equal to zero", volume.Name)
+		}
+		if volume.Weight == 0 {
+			volume.Weight = 1
+		}
+		if volume.Name == "default" {
+			if volume.Path != "" && filepath.Clean(volume.Path) != filepath.Clean(root) {
+				return errors.New(`storage volume "default" is webdav.directory; leave its path empty`)
+			}
+			volume.Path = ""
+			continue
+		}
+		if !filepath.IsAbs(volume.Path) {
+			return fmt.Errorf("storage volume %q: path must be absolute", volume.Name)
+		}
+		volume.Path = filepath.Clean(volume.Path)
+		for _, other := range paths {
+			if isNestedPath(other, volume.Path) || isNestedPath(volume.Path, other) {
+				return fmt.Errorf("storage volume %q: path %s overlaps %s", volume.Name, volume.Path, other)
+			}
+		}
+		paths = append(paths, volume.Path)
+
+		info, err := os.Stat(volume.Path)
+		if err != nil {
+			if !config.WebDAV.AutoCreateDirectory {
+				return fmt.Errorf("storage volume %q does not exist: %w", volume.Name, err)
+			}
+			if err := os.MkdirAll(volume.Path, 0755); err != nil {
+				return fmt.Errorf("failed to create storage volume %q: %w", volume.Name, err)
+			}
+			info, _ = os.Stat(volume.Path)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("storage volume %q is not a directory", volume.Name)
+		}
+	}
+	return nil
+}
+
+func isNestedPath(parent, child string) bool {
+	rel, err := filepath.Rel(parent, child)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
 // validateWeb3 验证 Web3 配置
 func (l *Loader) validateWeb3(config *Config) error {
 	if config.Web3.JWTSecret == "" {
@@ -605,6 +1008,19 @@ func (l *Loader) validateEmail(config *Config) error {
 	return nil
 }
 
+func (l *Loader) validateSecurity(config *Config) error {
+	for _, raw := range config.Security.TrustedProxies {
+		entry := strings.TrimSpace(raw)
+		if _, err := netip.ParsePrefix(entry); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(entry); err != nil {
+			return fmt.Errorf("security.trusted_proxies entry %q must be an IP address or CIDR", raw)
+		}
+	}
+	return nil
+}
+
 func (l *Loader) normalizeAdminAddresses(config *Config) {
 	if len(config.Security.AdminAddresses) == 0 {
 		return
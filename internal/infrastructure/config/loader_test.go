@@ -166,3 +166,179 @@ func TestValidateQuotaRejectsInvalidAutoReconcileSettings(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateRecycleRejectsInvalidPurgeSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+	}{
+		{
+			name: "retention days",
+			mutate: func(cfg *Config) {
+				cfg.Recycle.RetentionDays = -1
+			},
+		},
+		{
+			name: "warn before",
+			mutate: func(cfg *Config) {
+				cfg.Recycle.WarnBefore = -time.Hour
+			},
+		},
+		{
+			name: "purge interval",
+			mutate: func(cfg *Config) {
+				cfg.Recycle.PurgeEnabled = true
+				cfg.Recycle.PurgeInterval = 0
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loader := NewLoader()
+			cfg := DefaultConfig()
+			tc.mutate(cfg)
+
+			if err := loader.validateRecycle(cfg); err == nil {
+				t.Fatalf("expected invalid recycle setting to be rejected")
+			}
+		})
+	}
+}
+
+func TestValidateShareRejectsInvalidExpirySettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*Config)
+	}{
+		{
+			name: "max lifetime",
+			mutate: func(cfg *Config) {
+				cfg.Share.MaxLifetime = -time.Hour
+			},
+		},
+		{
+			name: "extend by",
+			mutate: func(cfg *Config) {
+				cfg.Share.ExtendBy = -time.Hour
+			},
+		},
+		{
+			name: "notify interval",
+			mutate: func(cfg *Config) {
+				cfg.Share.ExpiryNotifyEnabled = true
+				cfg.Share.ExpiryNotifyInterval = 0
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			loader := NewLoader()
+			cfg := DefaultConfig()
+			tc.mutate(cfg)
+
+			if err := loader.validateShare(cfg); err == nil {
+				t.Fatalf("expected invalid share setting to be rejected")
+			}
+		})
+	}
+}
+
+func TestValidateSecurityTrustedProxies(t *testing.T) {
+	loader := NewLoader()
+	cfg := DefaultConfig()
+	cfg.Security.TrustedProxies = []string{"10.0.0.0/8", " 192.168.1.10 ", "::1"}
+	if err := loader.validateSecurity(cfg); err != nil {
+		t.Fatalf("expected IP and CIDR entries to be accepted: %v", err)
+	}
+	cfg.Security.TrustedProxies = []string{"proxy.internal"}
+	if err := loader.validateSecurity(cfg); err == nil {
+		t.Fatal("expected a host name to be rejected")
+	}
+}
+
+func TestValidateVersionsRejectsNegativeRetention(t *testing.T) {
+	loader := NewLoader()
+	cfg := DefaultConfig()
+	if err := loader.validateVersions(cfg); err != nil {
+		t.Fatalf("expected default versions config to be valid: %v", err)
+	}
+
+	cfg.Versions.MaxCount = -1
+	if err := loader.validateVersions(cfg); err == nil {
+		t.Fatalf("expected negative max_count to be rejected")
+	}
+
+	cfg = DefaultConfig()
+	cfg.Versions.MaxAge = -time.Hour
+	if err := loader.validateVersions(cfg); err == nil {
+		t.Fatalf("expected negative max_age to be rejected")
+	}
+}
+
+func TestValidateDedupRejectsNegativeSettings(t *testing.T) {
+	loader := NewLoader()
+	cfg := DefaultConfig()
+	if err := loader.validateDedup(cfg); err != nil {
+		t.Fatalf("expected default dedup config to be valid: %v", err)
+	}
+
+	cfg.Dedup.MinSize = -1
+	if err := loader.validateDedup(cfg); err == nil {
+		t.Fatalf("expected negative min_size to be rejected")
+	}
+
+	cfg = DefaultConfig()
+	cfg.Dedup.GCInterval = -time.Minute
+	if err := loader.validateDedup(cfg); err == nil {
+		t.Fatalf("expected negative gc_interval to be rejected")
+	}
+}
+
+func TestValidateStorageRejectsInvalidVolumes(t *testing.T) {
+	loader := NewLoader()
+	root := t.TempDir()
+	cfg := DefaultConfig()
+	cfg.WebDAV.Directory = root
+	cfg.Storage.Volumes = []VolumeConfig{
+		{Name: "default", Capacity: 1 << 30},
+		{Name: "hdd1", Path: filepath.Join(t.TempDir(), "hdd1")},
+	}
+	if err := loader.validateStorage(cfg); err != nil {
+		t.Fatalf("expected volumes to be valid: %v", err)
+	}
+	if cfg.Storage.Volumes[1].Weight != 1 {
+		t.Fatalf("expected omitted weight to default to 1, got %d", cfg.Storage.Volumes[1].Weight)
+	}
+	if _, err := os.Stat(cfg.Storage.Volumes[1].Path); err != nil {
+		t.Fatalf("expected volume directory to be created: %v", err)
+	}
+
+	cfg.Storage.Placement = "random"
+	if err := loader.validateStorage(cfg); err == nil {
+		t.Fatalf("expected unsupported placement to be rejected")
+	}
+
+	cfg = DefaultConfig()
+	cfg.WebDAV.Directory = root
+	cfg.Storage.Volumes = []VolumeConfig{{Name: "nested", Path: filepath.Join(root, "nested")}}
+	if err := loader.validateStorage(cfg); err == nil {
+		t.Fatalf("expected volume inside webdav.directory to be rejected")
+	}
+
+	cfg = DefaultConfig()
+	cfg.WebDAV.Directory = root
+	cfg.Storage.Volumes = []VolumeConfig{{Name: "a", Path: "relative"}}
+	if err := loader.validateStorage(cfg); err == nil {
+		t.Fatalf("expected relative volume path to be rejected")
+	}
+
+	cfg = DefaultConfig()
+	cfg.WebDAV.Directory = root
+	dup := t.TempDir()
+	cfg.Storage.Volumes = []VolumeConfig{{Name: "a", Path: dup}, {Name: "a", Path: t.TempDir()}}
+	if err := loader.validateStorage(cfg); err == nil {
+		t.Fatalf("expected duplicate volume names to be rejected")
+	}
+}
@@ -179,6 +179,77 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 			PRIMARY KEY (user_directory, bucket, object_key)
 		)`,
 
+		// 文件名与元数据搜索索引：path 为相对 webdav.directory 的逻辑路径
+		`CREATE TABLE IF NOT EXISTS search_entries (
+			path TEXT PRIMARY KEY,
+			parent_path TEXT NOT NULL,
+			name TEXT NOT NULL,
+			name_lower TEXT NOT NULL,
+			extension VARCHAR(64) NOT NULL DEFAULT '',
+			is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+			size BIGINT NOT NULL DEFAULT 0,
+			content_type VARCHAR(255) NOT NULL DEFAULT '',
+			modified_at TIMESTAMP NOT NULL,
+			tags TEXT[] NOT NULL DEFAULT '{}',
+			indexed_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_entries_path_pattern
+			ON search_entries(path text_pattern_ops)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_entries_parent
+			ON search_entries(parent_path)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_entries_extension
+			ON search_entries(extension)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_entries_tags
+			ON search_entries USING GIN (tags)`,
+		// 名称子串查询使用 pg_trgm；没有安装扩展的权限时退化为顺序扫描
+		`DO $$
+		BEGIN
+			CREATE EXTENSION IF NOT EXISTS pg_trgm;
+		EXCEPTION WHEN OTHERS THEN
+			RAISE NOTICE 'pg_trgm unavailable: %', SQLERRM;
+		END $$`,
+		`DO $$
+		BEGIN
+			IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+				CREATE INDEX IF NOT EXISTS idx_search_entries_name_trgm
+					ON search_entries USING GIN (name_lower gin_trgm_ops);
+			END IF;
+		END $$`,
+		// 全文内容索引：文本随条目移动 / 删除级联；content 中的 CJK 字符以空格分隔
+		`CREATE TABLE IF NOT EXISTS search_contents (
+			path TEXT PRIMARY KEY REFERENCES search_entries(path) ON UPDATE CASCADE ON DELETE CASCADE,
+			source_size BIGINT NOT NULL DEFAULT 0,
+			source_modified_at TIMESTAMP NOT NULL,
+			content TEXT NOT NULL DEFAULT '',
+			content_tsv TSVECTOR NOT NULL,
+			extracted_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_contents_tsv
+			ON search_contents USING GIN (content_tsv)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_contents_path_pattern
+			ON search_contents(path text_pattern_ops)`,
+		// 用户按空间开启内容索引；prefix 为该空间在 search_entries 中的路径
+		`CREATE TABLE IF NOT EXISTS search_content_scopes (
+			user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			space VARCHAR(64) NOT NULL,
+			prefix TEXT NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (user_id, space)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_content_scopes_prefix
+			ON search_content_scopes(prefix)`,
+		// 内容抽取任务队列：同一路径只保留一条，generation 区分重新排队
+		`CREATE TABLE IF NOT EXISTS search_content_jobs (
+			path TEXT PRIMARY KEY,
+			generation BIGINT NOT NULL DEFAULT 1,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			enqueued_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			available_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_search_content_jobs_available
+			ON search_content_jobs(available_at)`,
+
 		// 创建回收站表
 		`CREATE TABLE IF NOT EXISTS recycle_items (
 			id VARCHAR(50) PRIMARY KEY,
@@ -286,6 +357,18 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 			PRIMARY KEY (owner_user_id, member_id)
 		)`,
 
+		// 分组邀请链接：持有邀请码的用户在有效期和次数限制内可直接加入分组
+		`CREATE TABLE IF NOT EXISTS group_invite_links (
+			id VARCHAR(50) PRIMARY KEY,
+			group_id VARCHAR(50) NOT NULL REFERENCES address_groups(id) ON DELETE CASCADE,
+			code VARCHAR(32) NOT NULL,
+			created_by VARCHAR(50) NULL REFERENCES users(id) ON DELETE SET NULL,
+			max_uses INTEGER NOT NULL DEFAULT 0,
+			used_count INTEGER NOT NULL DEFAULT 0,
+			expires_at TIMESTAMP NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+
 		// 复制 outbox：active 记录文件变更，后台异步分发到 standby
 		`CREATE TABLE IF NOT EXISTS replication_outbox (
 			id BIGSERIAL PRIMARY KEY,
@@ -402,6 +485,128 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 			PRIMARY KEY (user_id, type)
 		)`,
 
+		// 后台任务队列：worker 以租约领取，lease_until 过期后可被重新领取
+		`CREATE TABLE IF NOT EXISTS jobs (
+			id VARCHAR(50) PRIMARY KEY,
+			type VARCHAR(64) NOT NULL,
+			owner_user_id VARCHAR(50) NULL REFERENCES users(id) ON DELETE CASCADE,
+			created_by VARCHAR(255) NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'queued',
+			params JSONB NOT NULL DEFAULT '{}',
+			result JSONB NULL,
+			progress_done BIGINT NOT NULL DEFAULT 0,
+			progress_total BIGINT NOT NULL DEFAULT 0,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			max_attempts INTEGER NOT NULL DEFAULT 3,
+			last_error TEXT NOT NULL DEFAULT '',
+			cancel_requested BOOLEAN NOT NULL DEFAULT FALSE,
+			worker VARCHAR(255) NOT NULL DEFAULT '',
+			available_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			lease_until TIMESTAMP NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			started_at TIMESTAMP NULL,
+			finished_at TIMESTAMP NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_claim ON jobs(status, available_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_owner_created ON jobs(owner_user_id, created_at DESC)`,
+
+		// 公开分享访问日志：分享撤销后保留，便于审计
+		`CREATE TABLE IF NOT EXISTS share_access_logs (
+			id BIGSERIAL PRIMARY KEY,
+			share_id VARCHAR(50) NOT NULL,
+			token VARCHAR(50) NOT NULL,
+			creator_user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			action VARCHAR(20) NOT NULL,
+			path TEXT NOT NULL DEFAULT '',
+			ip VARCHAR(64) NOT NULL DEFAULT '',
+			user_agent TEXT NOT NULL DEFAULT '',
+			bytes BIGINT NOT NULL DEFAULT 0,
+			status INTEGER NOT NULL,
+			result VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_access_logs_token_created ON share_access_logs(token, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_access_logs_creator_created ON share_access_logs(creator_user_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_share_access_logs_created ON share_access_logs(created_at DESC)`,
+
+		// 定向分享邮箱邀请：收件人以该邮箱登录后转为 user 受众
+		`CREATE TABLE IF NOT EXISTS internal_share_email_invites (
+			id VARCHAR(50) PRIMARY KEY,
+			share_id VARCHAR(50) NOT NULL REFERENCES internal_share_items(id) ON DELETE CASCADE,
+			owner_user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			email VARCHAR(255) NOT NULL,
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			accepted_user_id VARCHAR(50) NULL REFERENCES users(id) ON DELETE SET NULL,
+			accepted_at TIMESTAMP NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			UNIQUE(share_id, email)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_internal_share_email_invites_email_status ON internal_share_email_invites(email, status)`,
+		`CREATE INDEX IF NOT EXISTS idx_internal_share_email_invites_owner_created ON internal_share_email_invites(owner_user_id, created_at DESC)`,
+
+		// 共享资源访问/升级申请：按 owner + 路径定位资源，公开链接发起时资源可能尚未投影
+		`CREATE TABLE IF NOT EXISTS internal_share_access_requests (
+			id VARCHAR(50) PRIMARY KEY,
+			requester_user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			owner_user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			resource_id VARCHAR(50) NULL REFERENCES internal_shared_resources(id) ON DELETE SET NULL,
+			public_share_id VARCHAR(50) NULL REFERENCES share_items(id) ON DELETE SET NULL,
+			normalized_path TEXT NOT NULL,
+			is_dir BOOLEAN NOT NULL DEFAULT FALSE,
+			permissions VARCHAR(10) NOT NULL,
+			expires_at TIMESTAMP NULL,
+			message TEXT NOT NULL DEFAULT '',
+			status VARCHAR(20) NOT NULL DEFAULT 'pending',
+			decider_user_id VARCHAR(50) NULL REFERENCES users(id) ON DELETE SET NULL,
+			decision_note TEXT NOT NULL DEFAULT '',
+			grant_id VARCHAR(50) NULL REFERENCES internal_share_grants(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			decided_at TIMESTAMP NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_internal_share_access_requests_requester ON internal_share_access_requests(requester_user_id, created_at DESC)`,
+		`CREATE INDEX IF NOT EXISTS idx_internal_share_access_requests_owner ON internal_share_access_requests(owner_user_id, status, created_at DESC)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_internal_share_access_requests_pending
+			ON internal_share_access_requests(requester_user_id, owner_user_id, normalized_path, is_dir)
+			WHERE status = 'pending'`,
+		// 申请的审计记录：申请、批准、拒绝、撤回各一条
+		`CREATE TABLE IF NOT EXISTS internal_share_access_request_events (
+			id BIGSERIAL PRIMARY KEY,
+			request_id VARCHAR(50) NOT NULL REFERENCES internal_share_access_requests(id) ON DELETE CASCADE,
+			actor_user_id VARCHAR(50) NULL REFERENCES users(id) ON DELETE SET NULL,
+			action VARCHAR(20) NOT NULL,
+			permissions VARCHAR(10) NOT NULL DEFAULT '',
+			expires_at TIMESTAMP NULL,
+			note TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_internal_share_access_request_events_request ON internal_share_access_request_events(request_id, id)`,
+
+		// 团队空间：数据与配额挂在独立的团队存储账号上，分组删除后团队空间保留
+		`CREATE TABLE IF NOT EXISTS teams (
+			id VARCHAR(50) PRIMARY KEY,
+			group_id VARCHAR(50) NULL REFERENCES address_groups(id) ON DELETE SET NULL,
+			account_user_id VARCHAR(50) NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+			name VARCHAR(255) NOT NULL,
+			created_by VARCHAR(50) NULL REFERENCES users(id) ON DELETE SET NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_teams_group_id ON teams(group_id)`,
+		// 团队成员角色：owner / editor / viewer，每个团队有且只有一个 owner
+		`CREATE TABLE IF NOT EXISTS team_members (
+			team_id VARCHAR(50) NOT NULL REFERENCES teams(id) ON DELETE CASCADE,
+			user_id VARCHAR(50) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+			role VARCHAR(20) NOT NULL,
+			created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (team_id, user_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_team_members_user_id ON team_members(user_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_team_members_owner ON team_members(team_id) WHERE role = 'owner'`,
+
 		// 补充分享表字段（兼容已存在表）
 		`ALTER TABLE replication_outbox ADD COLUMN IF NOT EXISTS assignment_generation BIGINT NULL`,
 		`ALTER TABLE replication_offsets ADD COLUMN IF NOT EXISTS assignment_generation BIGINT NULL`,
@@ -420,9 +625,29 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 		`ALTER TABLE share_items ALTER COLUMN creator_user_id SET NOT NULL`,
 		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS source_share_id VARCHAR(50) NULL`,
 		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS source_resource_id VARCHAR(50) NULL`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS password_hash VARCHAR(255) NOT NULL DEFAULT ''`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS is_dir BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS upload_limits TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS uploaded_bytes BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS uploaded_files BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS max_views BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS max_downloads BIGINT NOT NULL DEFAULT 0`,
 		`ALTER TABLE internal_share_items ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active'`,
+		// 到期提醒与已过期通知的发送时间，续期时清空以便按新的有效期重新提醒
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS expiry_reminded_at TIMESTAMP NULL`,
+		`ALTER TABLE share_items ADD COLUMN IF NOT EXISTS expiry_notified_at TIMESTAMP NULL`,
+		`ALTER TABLE internal_share_items ADD COLUMN IF NOT EXISTS expiry_reminded_at TIMESTAMP NULL`,
+		`ALTER TABLE internal_share_items ADD COLUMN IF NOT EXISTS expiry_notified_at TIMESTAMP NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_share_items_expires_at ON share_items(expires_at) WHERE expires_at IS NOT NULL`,
+		`CREATE INDEX IF NOT EXISTS idx_internal_share_items_expires_at ON internal_share_items(expires_at) WHERE expires_at IS NOT NULL`,
 		`ALTER TABLE internal_share_audiences ADD COLUMN IF NOT EXISTS grant_id VARCHAR(50) NULL REFERENCES internal_share_grants(id) ON DELETE CASCADE`,
 		`ALTER TABLE recycle_items ADD COLUMN IF NOT EXISTS is_dir BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS upload_policy JSONB NULL`,
+		`ALTER TABLE user_rules ADD COLUMN IF NOT EXISTS upload_policy JSONB NULL`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS recycle_retention_days INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS volume VARCHAR(64) NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN IF NOT EXISTS volume_moving BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE recycle_items ADD COLUMN IF NOT EXISTS batch_id VARCHAR(50) NOT NULL DEFAULT ''`,
 
 		// 创建回收站的哈希索引
 		`CREATE INDEX IF NOT EXISTS idx_recycle_items_hash ON recycle_items(hash)`,
@@ -430,6 +655,9 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 		// 创建回收站的用户ID索引
 		`CREATE INDEX IF NOT EXISTS idx_recycle_items_user_id ON recycle_items(user_id)`,
 
+		// 创建回收站的删除批次索引
+		`CREATE INDEX IF NOT EXISTS idx_recycle_items_batch_id ON recycle_items(user_id, batch_id)`,
+
 		// 创建分享的 token 索引
 		`CREATE INDEX IF NOT EXISTS idx_share_items_token ON share_items(token)`,
 
@@ -468,6 +696,9 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 		// 兼容历史库：旧版 group_members 表缺少审批状态列，必须先补列再执行数据迁移
 		`ALTER TABLE group_members ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active'`,
 
+		// 成员角色：owner / admin / member；owner 以 address_groups.user_id 为准
+		`ALTER TABLE group_members ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'member'`,
+
 		// 兼容历史库：如果旧版成员表存在，则迁移到 group_members
 		`DO $$
 		BEGIN
@@ -505,6 +736,15 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 			)
 		ON CONFLICT DO NOTHING`,
 
+		// 兼容历史库：分组创建者的成员记录标记为 owner
+		`UPDATE group_members m
+		SET role = 'owner'
+		FROM address_groups g
+		JOIN users u ON u.id = g.user_id
+		WHERE m.group_id = g.id
+			AND m.role <> 'owner'
+			AND LOWER(m.wallet_address) = LOWER(u.wallet_address)`,
+
 		// 分组索引
 		`CREATE INDEX IF NOT EXISTS idx_address_groups_user_id ON address_groups(user_id)`,
 		`CREATE UNIQUE INDEX IF NOT EXISTS idx_address_groups_user_name ON address_groups(user_id, name)`,
@@ -517,6 +757,8 @@ func (p *PostgresDB) Migrate(ctx context.Context) error {
 		`CREATE UNIQUE INDEX IF NOT EXISTS idx_group_members_user_group_wallet
 			ON group_members(user_id, group_id, wallet_address)`,
 		`CREATE INDEX IF NOT EXISTS idx_group_member_aliases_member_id ON group_member_aliases(member_id)`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_group_invite_links_code ON group_invite_links(code)`,
+		`CREATE INDEX IF NOT EXISTS idx_group_invite_links_group_id ON group_invite_links(group_id, created_at DESC)`,
 
 		// 复制 outbox 索引
 		`CREATE INDEX IF NOT EXISTS idx_replication_outbox_pair_pending
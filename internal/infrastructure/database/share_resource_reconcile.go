@@ -2,11 +2,10 @@ package database
 
 import (
 	"context"
-	"crypto/sha256"
 	"fmt"
-	"path"
-	"strings"
 	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/sharegrant"
 )
 
 const shareResourceReconcileLockID int64 = 846273910528
@@ -46,8 +45,8 @@ func (p *PostgresDB) ReconcileSharedResources(ctx context.Context) error {
 		return fmt.Errorf("close legacy share rows: %w", err)
 	}
 	for _, item := range items {
-		normalizedPath := normalizeSharedResourcePath(item.resourcePath)
-		resourceID := sharedResourceID(item.ownerUserID, normalizedPath, item.isDir)
+		normalizedPath := sharegrant.NormalizePath(item.resourcePath)
+		resourceID := sharegrant.ResourceID(item.ownerUserID, normalizedPath, item.isDir)
 		if _, err := tx.ExecContext(ctx, `INSERT INTO internal_shared_resources (id, owner_user_id, normalized_path, is_dir, created_at, updated_at) VALUES ($1,$2,$3,$4,$5,$6) ON CONFLICT (owner_user_id, normalized_path, is_dir) DO NOTHING`, resourceID, item.ownerUserID, normalizedPath, item.isDir, item.createdAt, item.updatedAt); err != nil {
 			return fmt.Errorf("upsert shared resource %s: %w", item.id, err)
 		}
@@ -76,12 +75,3 @@ func (p *PostgresDB) ReconcileSharedResources(ctx context.Context) error {
 	}
 	return nil
 }
-
-func normalizeSharedResourcePath(raw string) string {
-	return path.Clean("/" + strings.TrimLeft(strings.TrimSpace(raw), "/"))
-}
-
-func sharedResourceID(ownerUserID, normalizedPath string, isDir bool) string {
-	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%t", ownerUserID, normalizedPath, isDir)))
-	return fmt.Sprintf("shr_%x", sum[:20])
-}
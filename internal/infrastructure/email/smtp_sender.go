@@ -25,6 +25,19 @@ type Sender struct {
 	tpl     *template.Template
 	tplErr  error
 	subject string
+
+	inviteOnce sync.Once
+	inviteTpl  *template.Template
+	inviteErr  error
+}
+
+// ShareInvite 定向分享邀请邮件内容
+type ShareInvite struct {
+	OwnerName string
+	ShareName string
+	// LoginURL 收件人以该邮箱登录的入口
+	LoginURL  string
+	ExpiresAt *time.Time
 }
 
 // NewSender 创建邮件发送器
@@ -53,7 +66,43 @@ func (s *Sender) SendCode(to string, code string, ttl time.Duration) error {
 		return err
 	}
 
-	msg, err := s.buildMessage(to, body)
+	msg, err := s.buildMessage(to, s.subject, body)
+	if err != nil {
+		return err
+	}
+
+	return s.sendSMTP(to, msg)
+}
+
+// SendShareInvite 发送定向分享邀请邮件
+func (s *Sender) SendShareInvite(to string, invite ShareInvite) error {
+	if !s.cfg.Enabled {
+		return errors.New("email is disabled")
+	}
+	if s.cfg.SMTPHost == "" || s.cfg.From == "" {
+		return errors.New("smtp configuration is incomplete")
+	}
+
+	data := map[string]any{
+		"ownerName": invite.OwnerName,
+		"shareName": invite.ShareName,
+		"loginUrl":  invite.LoginURL,
+		"email":     to,
+		"expiresAt": "",
+	}
+	if invite.ExpiresAt != nil {
+		data["expiresAt"] = invite.ExpiresAt.Format("2006-01-02 15:04")
+	}
+	s.inviteOnce.Do(func() {
+		s.inviteTpl, s.inviteErr = parseTemplate(s.cfg.ShareInviteTemplatePath, "share_invite_template_path")
+	})
+	body, err := executeTemplate(s.inviteTpl, s.inviteErr, data)
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("%s 与你分享了「%s」", invite.OwnerName, invite.ShareName)
+	msg, err := s.buildMessage(to, subject, body)
 	if err != nil {
 		return err
 	}
@@ -63,40 +112,40 @@ func (s *Sender) SendCode(to string, code string, ttl time.Duration) error {
 
 func (s *Sender) renderTemplate(data map[string]any) (string, error) {
 	s.tplOnce.Do(func() {
-		if s.cfg.TemplatePath == "" {
-			s.tplErr = errors.New("template_path is empty")
-			return
-		}
-		path := filepath.Clean(s.cfg.TemplatePath)
-		tpl, err := template.ParseFiles(path)
-		if err != nil {
-			s.tplErr = err
-			return
-		}
-		s.tpl = tpl
+		s.tpl, s.tplErr = parseTemplate(s.cfg.TemplatePath, "template_path")
 	})
+	return executeTemplate(s.tpl, s.tplErr, data)
+}
+
+func parseTemplate(path, option string) (*template.Template, error) {
+	if path == "" {
+		return nil, fmt.Errorf("%s is empty", option)
+	}
+	return template.ParseFiles(filepath.Clean(path))
+}
 
-	if s.tplErr != nil {
-		return "", s.tplErr
+func executeTemplate(tpl *template.Template, tplErr error, data map[string]any) (string, error) {
+	if tplErr != nil {
+		return "", tplErr
 	}
-	if s.tpl == nil {
+	if tpl == nil {
 		return "", errors.New("template not loaded")
 	}
 
 	var buf bytes.Buffer
-	if err := s.tpl.Execute(&buf, data); err != nil {
+	if err := tpl.Execute(&buf, data); err != nil {
 		return "", err
 	}
 	return buf.String(), nil
 }
 
-func (s *Sender) buildMessage(to, body string) ([]byte, error) {
+func (s *Sender) buildMessage(to, subject, body string) ([]byte, error) {
 	from := s.cfg.From
 	if strings.TrimSpace(s.cfg.FromName) != "" {
 		encodedName := mime.QEncoding.Encode("UTF-8", s.cfg.FromName)
 		from = fmt.Sprintf("%s <%s>", encodedName, s.cfg.From)
 	}
-	subject := mime.QEncoding.Encode("UTF-8", s.subject)
+	subject = mime.QEncoding.Encode("UTF-8", subject)
 
 	headers := []string{
 		fmt.Sprintf("From: %s", from),
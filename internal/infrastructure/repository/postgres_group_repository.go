@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 	"github.com/yeying-community/warehouse/internal/domain/group"
@@ -27,8 +28,37 @@ type GroupRepository interface {
 	UpdateMemberStatusByWallet(ctx context.Context, walletAddress, memberID, status, name string) error
 	DeleteMember(ctx context.Context, userID, memberID string) error
 	DeleteMemberByWallet(ctx context.Context, walletAddress, memberID string) error
+
+	// UpdateMemberRole 调整 active 成员的角色（admin / member），不能修改 owner
+	UpdateMemberRole(ctx context.Context, groupID, memberID, role string) error
+	// RemoveGroupMember 按分组删除成员记录，权限由调用方校验
+	RemoveGroupMember(ctx context.Context, groupID, memberID string) error
+	// TransferGroupOwnership 把分组转给 toMemberID 对应的用户，原所有者降为 admin
+	TransferGroupOwnership(ctx context.Context, groupID, fromUserID, toUserID, toMemberID string) error
+
+	CreateInviteLink(ctx context.Context, link *group.InviteLink) error
+	ListInviteLinks(ctx context.Context, groupID string) ([]*group.InviteLink, error)
+	DeleteInviteLink(ctx context.Context, groupID, linkID string) error
+	// RedeemInviteLink 校验邀请码并把 member 以 active 状态加入分组：已有 pending 邀请时
+	// 直接激活该记录并回写 member.ID，已是 active 成员时返回 ErrDuplicateMember
+	RedeemInviteLink(ctx context.Context, code string, member *group.Member, now time.Time) (*group.Group, error)
 }
 
+// groupMemberRoleColumn 成员角色：钱包与分组所有者一致的记录始终是 owner
+const groupMemberRoleColumn = `CASE
+			WHEN LOWER(m.wallet_address) = LOWER(COALESCE(owner.wallet_address, '')) THEN 'owner'
+			WHEN m.role = 'admin' THEN 'admin'
+			ELSE 'member'
+		END`
+
+// groupViewerRoleColumn 当前用户在分组中的角色，需要 active_member 连接
+const groupViewerRoleColumn = `CASE
+			WHEN g.user_id = $%d THEN 'owner'
+			WHEN active_member.id IS NULL THEN ''
+			WHEN active_member.role = 'admin' THEN 'admin'
+			ELSE 'member'
+		END`
+
 type PostgresGroupRepository struct {
 	db *sql.DB
 }
@@ -56,8 +86,8 @@ func (r *PostgresGroupRepository) CreateGroup(ctx context.Context, grp *group.Gr
 	}
 	if ownerMember != nil {
 		memberQuery := `
-			INSERT INTO group_members (id, user_id, group_id, name, wallet_address, tags, status, created_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			INSERT INTO group_members (id, user_id, group_id, name, wallet_address, tags, status, role, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		`
 		if _, err := tx.ExecContext(ctx, memberQuery,
 			ownerMember.ID,
@@ -67,6 +97,7 @@ func (r *PostgresGroupRepository) CreateGroup(ctx context.Context, grp *group.Gr
 			ownerMember.WalletAddress,
 			pq.Array([]string{}),
 			group.NormalizeMemberStatus(ownerMember.Status),
+			group.RoleOwner,
 			ownerMember.CreatedAt,
 		); err != nil {
 			if isDuplicateMemberError(err) {
@@ -101,6 +132,7 @@ func (r *PostgresGroupRepository) GetGroupByID(ctx context.Context, userID, grou
 		return nil, fmt.Errorf("failed to get group: %w", err)
 	}
 	grp.CanInvite = true
+	grp.Role = group.RoleOwner
 	return grp, nil
 }
 
@@ -111,6 +143,7 @@ func (r *PostgresGroupRepository) GetVisibleGroupByID(ctx context.Context, userI
 			g.user_id,
 			g.name,
 			(g.user_id = $2 OR active_member.id IS NOT NULL),
+			` + fmt.Sprintf(groupViewerRoleColumn, 2) + `,
 			g.created_at
 		FROM address_groups g
 		LEFT JOIN group_members member
@@ -139,6 +172,7 @@ func (r *PostgresGroupRepository) GetVisibleGroupByID(ctx context.Context, userI
 		&grp.UserID,
 		&grp.Name,
 		&grp.CanInvite,
+		&grp.Role,
 		&grp.CreatedAt,
 	)
 	if err != nil {
@@ -157,6 +191,7 @@ func (r *PostgresGroupRepository) ListVisibleGroups(ctx context.Context, userID,
 			g.user_id,
 			g.name,
 			(g.user_id = $1 OR active_member.id IS NOT NULL),
+			` + fmt.Sprintf(groupViewerRoleColumn, 1) + `,
 			g.created_at
 		FROM address_groups g
 		LEFT JOIN group_members member
@@ -180,7 +215,7 @@ func (r *PostgresGroupRepository) ListVisibleGroups(ctx context.Context, userID,
 	var groups []*group.Group
 	for rows.Next() {
 		grp := &group.Group{}
-		if err := rows.Scan(&grp.ID, &grp.UserID, &grp.Name, &grp.CanInvite, &grp.CreatedAt); err != nil {
+		if err := rows.Scan(&grp.ID, &grp.UserID, &grp.Name, &grp.CanInvite, &grp.Role, &grp.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan group: %w", err)
 		}
 		groups = append(groups, grp)
@@ -227,11 +262,15 @@ func (r *PostgresGroupRepository) DeleteGroup(ctx context.Context, userID, group
 }
 
 func (r *PostgresGroupRepository) CreateMember(ctx context.Context, member *group.Member) error {
+	role, err := group.NormalizeMemberRole(member.Role)
+	if err != nil {
+		return err
+	}
 	query := `
-		INSERT INTO group_members (id, user_id, group_id, name, wallet_address, tags, status, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		INSERT INTO group_members (id, user_id, group_id, name, wallet_address, tags, status, role, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	_, err = r.db.ExecContext(ctx, query,
 		member.ID,
 		member.UserID,
 		member.GroupID,
@@ -239,6 +278,7 @@ func (r *PostgresGroupRepository) CreateMember(ctx context.Context, member *grou
 		member.WalletAddress,
 		pq.Array([]string{}),
 		group.NormalizeMemberStatus(member.Status),
+		role,
 		member.CreatedAt,
 	)
 	if err != nil {
@@ -261,6 +301,7 @@ func (r *PostgresGroupRepository) GetMemberByID(ctx context.Context, userID, mem
 			COALESCE(invited.username, ''),
 			m.wallet_address,
 			m.status,
+			` + groupMemberRoleColumn + `,
 			LOWER(m.wallet_address) = LOWER(COALESCE(owner.wallet_address, '')),
 			m.created_at
 		FROM group_members m
@@ -282,6 +323,7 @@ func (r *PostgresGroupRepository) GetMemberByID(ctx context.Context, userID, mem
 		&member.Username,
 		&member.WalletAddress,
 		&member.Status,
+		&member.Role,
 		&member.IsOwner,
 		&member.CreatedAt,
 	)
@@ -306,6 +348,7 @@ func (r *PostgresGroupRepository) ListVisibleMembers(ctx context.Context, userID
 			COALESCE(invited.username, ''),
 			m.wallet_address,
 			m.status,
+			` + groupMemberRoleColumn + `,
 			LOWER(m.wallet_address) = LOWER(COALESCE(owner.wallet_address, '')),
 			m.created_at
 		FROM group_members m
@@ -321,7 +364,7 @@ func (r *PostgresGroupRepository) ListVisibleMembers(ctx context.Context, userID
 			AND LOWER(current_member.wallet_address) = LOWER($2)
 		WHERE g.user_id = $1
 			OR ($2 <> '' AND LOWER(m.wallet_address) = LOWER($2))
-			OR ($2 <> '' AND current_member.id IS NOT NULL AND m.status = $3)
+			OR ($2 <> '' AND current_member.id IS NOT NULL AND (m.status = $3 OR current_member.role = 'admin'))
 		ORDER BY m.created_at DESC
 	`
 	rows, err := r.db.QueryContext(ctx, query, userID, strings.TrimSpace(walletAddress), group.MemberStatusActive)
@@ -342,6 +385,7 @@ func (r *PostgresGroupRepository) ListVisibleMembers(ctx context.Context, userID
 			&member.Username,
 			&member.WalletAddress,
 			&member.Status,
+			&member.Role,
 			&member.IsOwner,
 			&member.CreatedAt,
 		); err != nil {
@@ -474,6 +518,287 @@ func (r *PostgresGroupRepository) DeleteMemberByWallet(ctx context.Context, wall
 	return nil
 }
 
+func (r *PostgresGroupRepository) UpdateMemberRole(ctx context.Context, groupID, memberID, role string) error {
+	role, err := group.NormalizeMemberRole(role)
+	if err != nil {
+		return err
+	}
+	if role == group.RoleOwner {
+		return group.ErrInvalidMemberRole
+	}
+	query := `
+		UPDATE group_members m
+		SET role = $1
+		FROM address_groups g
+		LEFT JOIN users owner ON owner.id = g.user_id
+		WHERE m.id = $2
+			AND m.group_id = $3
+			AND g.id = m.group_id
+			AND m.status = $4
+			AND LOWER(m.wallet_address) <> LOWER(COALESCE(owner.wallet_address, ''))
+	`
+	result, err := r.db.ExecContext(ctx, query, role, memberID, groupID, group.MemberStatusActive)
+	if err != nil {
+		return fmt.Errorf("failed to update member role: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return group.ErrMemberNotFound
+	}
+	return nil
+}
+
+func (r *PostgresGroupRepository) RemoveGroupMember(ctx context.Context, groupID, memberID string) error {
+	query := `DELETE FROM group_members WHERE id = $1 AND group_id = $2`
+	result, err := r.db.ExecContext(ctx, query, memberID, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to remove group member: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return group.ErrMemberNotFound
+	}
+	return nil
+}
+
+func (r *PostgresGroupRepository) TransferGroupOwnership(ctx context.Context, groupID, fromUserID, toUserID, toMemberID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin ownership transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var currentOwner string
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM address_groups WHERE id = $1 FOR UPDATE`, groupID).Scan(&currentOwner)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return group.ErrGroupNotFound
+		}
+		return fmt.Errorf("failed to lock group: %w", err)
+	}
+	if currentOwner != fromUserID {
+		return group.ErrGroupPermissionDenied
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE group_members
+		SET role = $1
+		WHERE id = $2 AND group_id = $3 AND status = $4
+	`, group.RoleOwner, toMemberID, groupID, group.MemberStatusActive)
+	if err != nil {
+		return fmt.Errorf("failed to promote new owner: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	} else if rows == 0 {
+		return group.ErrInvalidTransferTarget
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE group_members
+		SET role = $1
+		WHERE group_id = $2 AND id <> $3 AND role = $4
+	`, group.RoleAdmin, groupID, toMemberID, group.RoleOwner); err != nil {
+		return fmt.Errorf("failed to demote previous owner: %w", err)
+	}
+	// 成员记录的 user_id 是分组所有者，转让时整体改到新所有者名下
+	if _, err := tx.ExecContext(ctx, `UPDATE group_members SET user_id = $1 WHERE group_id = $2`, toUserID, groupID); err != nil {
+		if isDuplicateMemberError(err) {
+			return group.ErrDuplicateMember
+		}
+		return fmt.Errorf("failed to move group members: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE address_groups SET user_id = $1 WHERE id = $2`, toUserID, groupID); err != nil {
+		if strings.Contains(err.Error(), "idx_address_groups_user_name") {
+			return group.ErrDuplicateGroupName
+		}
+		return fmt.Errorf("failed to transfer group: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit ownership transaction: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresGroupRepository) CreateInviteLink(ctx context.Context, link *group.InviteLink) error {
+	query := `
+		INSERT INTO group_invite_links (id, group_id, code, created_by, max_uses, used_count, expires_at, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8)
+	`
+	if _, err := r.db.ExecContext(ctx, query,
+		link.ID,
+		link.GroupID,
+		link.Code,
+		link.CreatedBy,
+		link.MaxUses,
+		link.UsedCount,
+		link.ExpiresAt,
+		link.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create invite link: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresGroupRepository) ListInviteLinks(ctx context.Context, groupID string) ([]*group.InviteLink, error) {
+	query := `
+		SELECT id, group_id, code, COALESCE(created_by, ''), max_uses, used_count, expires_at, created_at
+		FROM group_invite_links
+		WHERE group_id = $1
+		ORDER BY created_at DESC
+	`
+	rows, err := r.db.QueryContext(ctx, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invite links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []*group.InviteLink
+	for rows.Next() {
+		link, err := scanInviteLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate invite links: %w", err)
+	}
+	return links, nil
+}
+
+func (r *PostgresGroupRepository) DeleteInviteLink(ctx context.Context, groupID, linkID string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM group_invite_links WHERE id = $1 AND group_id = $2`, linkID, groupID)
+	if err != nil {
+		return fmt.Errorf("failed to delete invite link: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return group.ErrInviteLinkNotFound
+	}
+	return nil
+}
+
+func (r *PostgresGroupRepository) RedeemInviteLink(ctx context.Context, code string, member *group.Member, now time.Time) (*group.Group, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin invite transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	link, err := scanInviteLink(tx.QueryRowContext(ctx, `
+		SELECT id, group_id, code, COALESCE(created_by, ''), max_uses, used_count, expires_at, created_at
+		FROM group_invite_links
+		WHERE code = $1
+		FOR UPDATE
+	`, group.NormalizeInviteCode(code)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, group.ErrInviteLinkNotFound
+		}
+		return nil, err
+	}
+	if !link.Usable(now) {
+		return nil, group.ErrInviteLinkExpired
+	}
+	grp := &group.Group{}
+	if err := tx.QueryRowContext(ctx, `SELECT id, user_id, name, created_at FROM address_groups WHERE id = $1`, link.GroupID).Scan(
+		&grp.ID,
+		&grp.UserID,
+		&grp.Name,
+		&grp.CreatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, group.ErrInviteLinkNotFound
+		}
+		return nil, fmt.Errorf("failed to get invite group: %w", err)
+	}
+
+	var existingID, existingStatus string
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, status
+		FROM group_members
+		WHERE group_id = $1 AND LOWER(wallet_address) = LOWER($2)
+		ORDER BY (status = $3) DESC
+		LIMIT 1
+	`, grp.ID, member.WalletAddress, group.MemberStatusActive).Scan(&existingID, &existingStatus)
+	switch {
+	case err == sql.ErrNoRows:
+		member.UserID = grp.UserID
+		member.GroupID = grp.ID
+		member.Status = group.MemberStatusActive
+		member.Role = group.RoleMember
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO group_members (id, user_id, group_id, name, wallet_address, tags, status, role, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		`, member.ID, member.UserID, member.GroupID, member.Name, member.WalletAddress, pq.Array([]string{}), member.Status, member.Role, member.CreatedAt); err != nil {
+			if isDuplicateMemberError(err) {
+				return nil, group.ErrDuplicateMember
+			}
+			return nil, fmt.Errorf("failed to join group: %w", err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("failed to query existing member: %w", err)
+	case group.NormalizeMemberStatus(existingStatus) == group.MemberStatusActive:
+		return nil, group.ErrDuplicateMember
+	default:
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE group_members
+			SET status = $1,
+				name = CASE WHEN TRIM($2) <> '' THEN TRIM($2) ELSE name END
+			WHERE id = $3
+		`, group.MemberStatusActive, member.Name, existingID); err != nil {
+			return nil, fmt.Errorf("failed to activate pending member: %w", err)
+		}
+		member.ID = existingID
+		member.UserID = grp.UserID
+		member.GroupID = grp.ID
+		member.Status = group.MemberStatusActive
+		member.Role = group.RoleMember
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE group_invite_links SET used_count = used_count + 1 WHERE id = $1`, link.ID); err != nil {
+		return nil, fmt.Errorf("failed to update invite link usage: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit invite transaction: %w", err)
+	}
+	grp.CanInvite = true
+	grp.Role = group.RoleMember
+	return grp, nil
+}
+
+type inviteLinkScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanInviteLink(row inviteLinkScanner) (*group.InviteLink, error) {
+	link := &group.InviteLink{}
+	if err := row.Scan(
+		&link.ID,
+		&link.GroupID,
+		&link.Code,
+		&link.CreatedBy,
+		&link.MaxUses,
+		&link.UsedCount,
+		&link.ExpiresAt,
+		&link.CreatedAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan invite link: %w", err)
+	}
+	return link, nil
+}
+
 func isDuplicateMemberError(err error) bool {
 	if err == nil {
 		return false
@@ -0,0 +1,346 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Job statuses. queued and running are live; the others are terminal.
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCanceled  = "canceled"
+)
+
+// Job is one background job. OwnerUserID is empty for jobs submitted by an
+// administrator or the CLI.
+type Job struct {
+	ID              string
+	Type            string
+	OwnerUserID     string
+	CreatedBy       string
+	Status          string
+	Params          json.RawMessage
+	Result          json.RawMessage
+	ProgressDone    int64
+	ProgressTotal   int64
+	Attempts        int
+	MaxAttempts     int
+	LastError       string
+	CancelRequested bool
+	Worker          string
+	AvailableAt     time.Time
+	LeaseUntil      *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	StartedAt       *time.Time
+	FinishedAt      *time.Time
+}
+
+// Terminal reports whether the job will not run again.
+func (j *Job) Terminal() bool {
+	switch j.Status {
+	case JobStatusCompleted, JobStatusFailed, JobStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// JobFilter narrows a job listing; empty fields match everything.
+type JobFilter struct {
+	OwnerUserID string
+	Type        string
+	Statuses    []string
+	Limit       int
+	Offset      int
+}
+
+type JobRepository interface {
+	// Create stores a queued job and sets its timestamps.
+	Create(ctx context.Context, job *Job) error
+	// Get returns nil when the job does not exist.
+	Get(ctx context.Context, id string) (*Job, error)
+	// List returns jobs newest first.
+	List(ctx context.Context, filter JobFilter) ([]*Job, error)
+	// Claim leases up to limit due jobs to worker until now+lease. Queued
+	// jobs and running jobs whose lease expired are due.
+	Claim(ctx context.Context, worker string, limit int, lease time.Duration) ([]*Job, error)
+	// Heartbeat stores progress and extends the lease of a job still held by
+	// worker. It reports whether cancellation was requested, and false for
+	// held when the job was taken over or finished elsewhere.
+	Heartbeat(ctx context.Context, id, worker string, done, total int64, lease time.Duration) (cancelRequested, held bool, err error)
+	// Finish moves a job held by worker to a terminal status.
+	Finish(ctx context.Context, id, worker, status string, result json.RawMessage, lastError string) error
+	// Retry queues a job held by worker again after delay.
+	Retry(ctx context.Context, id, worker, lastError string, delay time.Duration) error
+	// RequestCancel cancels a queued job right away and flags a running one;
+	// the worker stops it at its next heartbeat. Terminal jobs are returned
+	// unchanged.
+	RequestCancel(ctx context.Context, id string) (*Job, error)
+	// Requeue resets a failed or canceled job so it runs again from scratch.
+	// It returns nil when the job is missing or not in such a status.
+	Requeue(ctx context.Context, id string) (*Job, error)
+	// DeleteFinishedOlderThan removes terminal jobs that finished more than
+	// age ago.
+	DeleteFinishedOlderThan(ctx context.Context, age time.Duration) (int64, error)
+}
+
+type PostgresJobRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresJobRepository(db *sql.DB) *PostgresJobRepository {
+	return &PostgresJobRepository{db: db}
+}
+
+const jobColumns = `id, type, COALESCE(owner_user_id, ''), created_by, status, params, result,
+	progress_done, progress_total, attempts, max_attempts, last_error, cancel_requested, worker,
+	available_at, lease_until, created_at, updated_at, started_at, finished_at`
+
+type jobScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row jobScanner) (*Job, error) {
+	job := &Job{}
+	var params, result []byte
+	if err := row.Scan(
+		&job.ID, &job.Type, &job.OwnerUserID, &job.CreatedBy, &job.Status, &params, &result,
+		&job.ProgressDone, &job.ProgressTotal, &job.Attempts, &job.MaxAttempts, &job.LastError, &job.CancelRequested, &job.Worker,
+		&job.AvailableAt, &job.LeaseUntil, &job.CreatedAt, &job.UpdatedAt, &job.StartedAt, &job.FinishedAt,
+	); err != nil {
+		return nil, err
+	}
+	job.Params = json.RawMessage(params)
+	if len(result) > 0 {
+		job.Result = json.RawMessage(result)
+	}
+	return job, nil
+}
+
+func scanJobs(rows *sql.Rows) ([]*Job, error) {
+	defer rows.Close()
+	jobs := []*Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func nullableJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return []byte(raw)
+}
+
+func (r *PostgresJobRepository) Create(ctx context.Context, job *Job) error {
+	params := job.Params
+	if len(params) == 0 {
+		params = json.RawMessage(`{}`)
+	}
+	var owner any
+	if job.OwnerUserID != "" {
+		owner = job.OwnerUserID
+	}
+	// Timestamps come from the database clock, which Claim compares against.
+	if err := r.db.QueryRowContext(ctx, `
+		INSERT INTO jobs (id, type, owner_user_id, created_by, status, params, max_attempts, available_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW(), NOW())
+		RETURNING available_at, created_at, updated_at
+	`, job.ID, job.Type, owner, job.CreatedBy, job.Status, []byte(params), job.MaxAttempts).Scan(
+		&job.AvailableAt, &job.CreatedAt, &job.UpdatedAt,
+	); err != nil {
+		return fmt.Errorf("create job: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresJobRepository) Get(ctx context.Context, id string) (*Job, error) {
+	job, err := scanJob(r.db.QueryRowContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE id = $1`, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get job: %w", err)
+	}
+	return job, nil
+}
+
+func (r *PostgresJobRepository) List(ctx context.Context, filter JobFilter) ([]*Job, error) {
+	where := []string{"TRUE"}
+	args := []any{}
+	if filter.OwnerUserID != "" {
+		args = append(args, filter.OwnerUserID)
+		where = append(where, fmt.Sprintf("owner_user_id = $%d", len(args)))
+	}
+	if filter.Type != "" {
+		args = append(args, filter.Type)
+		where = append(where, fmt.Sprintf("type = $%d", len(args)))
+	}
+	if len(filter.Statuses) > 0 {
+		args = append(args, pq.Array(filter.Statuses))
+		where = append(where, fmt.Sprintf("status = ANY($%d)", len(args)))
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, filter.Offset)
+	rows, err := r.db.QueryContext(ctx, `SELECT `+jobColumns+` FROM jobs WHERE `+strings.Join(where, " AND ")+
+		fmt.Sprintf(` ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d`, len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("list jobs: %w", err)
+	}
+	return scanJobs(rows)
+}
+
+func (r *PostgresJobRepository) Claim(ctx context.Context, worker string, limit int, lease time.Duration) ([]*Job, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE jobs
+		SET status = 'running',
+			worker = $2,
+			attempts = attempts + 1,
+			lease_until = NOW() + $3::double precision * INTERVAL '1 second',
+			started_at = COALESCE(started_at, NOW()),
+			updated_at = NOW()
+		WHERE id IN (
+			SELECT id FROM jobs
+			WHERE (status = 'queued' AND available_at <= NOW())
+				OR (status = 'running' AND lease_until < NOW())
+			ORDER BY available_at, created_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+jobColumns, limit, worker, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim jobs: %w", err)
+	}
+	return scanJobs(rows)
+}
+
+func (r *PostgresJobRepository) Heartbeat(ctx context.Context, id, worker string, done, total int64, lease time.Duration) (bool, bool, error) {
+	var cancelRequested bool
+	err := r.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET progress_done = $3,
+			progress_total = $4,
+			lease_until = NOW() + $5::double precision * INTERVAL '1 second',
+			updated_at = NOW()
+		WHERE id = $1 AND worker = $2 AND status = 'running'
+		RETURNING cancel_requested
+	`, id, worker, done, total, lease.Seconds()).Scan(&cancelRequested)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("job heartbeat: %w", err)
+	}
+	return cancelRequested, true, nil
+}
+
+func (r *PostgresJobRepository) Finish(ctx context.Context, id, worker, status string, result json.RawMessage, lastError string) error {
+	if _, err := r.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = $3,
+			result = $4,
+			last_error = $5,
+			lease_until = NULL,
+			finished_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1 AND worker = $2 AND status = 'running'
+	`, id, worker, status, nullableJSON(result), lastError); err != nil {
+		return fmt.Errorf("finish job: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresJobRepository) Retry(ctx context.Context, id, worker, lastError string, delay time.Duration) error {
+	if _, err := r.db.ExecContext(ctx, `
+		UPDATE jobs
+		SET status = 'queued',
+			last_error = $3,
+			lease_until = NULL,
+			available_at = NOW() + $4::double precision * INTERVAL '1 second',
+			updated_at = NOW()
+		WHERE id = $1 AND worker = $2 AND status = 'running'
+	`, id, worker, lastError, delay.Seconds()); err != nil {
+		return fmt.Errorf("retry job: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresJobRepository) RequestCancel(ctx context.Context, id string) (*Job, error) {
+	job, err := scanJob(r.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status = CASE WHEN status = 'queued' THEN 'canceled' ELSE status END,
+			finished_at = CASE WHEN status = 'queued' THEN NOW() ELSE finished_at END,
+			cancel_requested = TRUE,
+			updated_at = NOW()
+		WHERE id = $1 AND status IN ('queued', 'running')
+		RETURNING `+jobColumns, id))
+	if err == sql.ErrNoRows {
+		return r.Get(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cancel job: %w", err)
+	}
+	return job, nil
+}
+
+func (r *PostgresJobRepository) Requeue(ctx context.Context, id string) (*Job, error) {
+	job, err := scanJob(r.db.QueryRowContext(ctx, `
+		UPDATE jobs
+		SET status = 'queued',
+			attempts = 0,
+			last_error = '',
+			result = NULL,
+			progress_done = 0,
+			progress_total = 0,
+			cancel_requested = FALSE,
+			worker = '',
+			lease_until = NULL,
+			started_at = NULL,
+			finished_at = NULL,
+			available_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1 AND status IN ('failed', 'canceled')
+		RETURNING `+jobColumns, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("requeue job: %w", err)
+	}
+	return job, nil
+}
+
+func (r *PostgresJobRepository) DeleteFinishedOlderThan(ctx context.Context, age time.Duration) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM jobs
+		WHERE status IN ('completed', 'failed', 'canceled')
+			AND finished_at < NOW() - $1::double precision * INTERVAL '1 second'
+	`, age.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("delete finished jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -34,6 +34,11 @@ type RecycleRepository interface {
 	DeleteExpiredItems(ctx context.Context, retentionPeriod time.Duration) (int64, error)
 }
 
+// RecyclePathRepository 更新回收站记录的原始位置（存量文件名迁移后同步路径）
+type RecyclePathRepository interface {
+	UpdateOriginalPath(ctx context.Context, hash, directory, path string) error
+}
+
 // PostgresRecycleRepository PostgreSQL 实现
 type PostgresRecycleRepository struct {
 	db *sql.DB
@@ -47,8 +52,8 @@ func NewPostgresRecycleRepository(db *sql.DB) *PostgresRecycleRepository {
 // Create 创建回收站项目
 func (r *PostgresRecycleRepository) Create(ctx context.Context, item *recycle.RecycleItem) error {
 	query := `
-		INSERT INTO recycle_items (id, hash, user_id, username, directory, name, path, is_dir, size, deleted_at, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		INSERT INTO recycle_items (id, hash, user_id, username, directory, name, path, is_dir, batch_id, size, deleted_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
 	`
 	_, err := r.db.ExecContext(ctx, query,
 		item.ID,
@@ -59,6 +64,7 @@ func (r *PostgresRecycleRepository) Create(ctx context.Context, item *recycle.Re
 		item.Name,
 		item.Path,
 		item.IsDir,
+		item.BatchID,
 		item.Size,
 		item.DeletedAt,
 		item.CreatedAt,
@@ -72,7 +78,7 @@ func (r *PostgresRecycleRepository) Create(ctx context.Context, item *recycle.Re
 // GetByHash 根据哈希获取项目
 func (r *PostgresRecycleRepository) GetByHash(ctx context.Context, hash string) (*recycle.RecycleItem, error) {
 	query := `
-		SELECT id, hash, user_id, username, directory, name, path, is_dir, size, deleted_at, created_at
+		SELECT id, hash, user_id, username, directory, name, path, is_dir, batch_id, size, deleted_at, created_at
 		FROM recycle_items
 		WHERE hash = $1
 	`
@@ -86,6 +92,7 @@ func (r *PostgresRecycleRepository) GetByHash(ctx context.Context, hash string)
 		&item.Name,
 		&item.Path,
 		&item.IsDir,
+		&item.BatchID,
 		&item.Size,
 		&item.DeletedAt,
 		&item.CreatedAt,
@@ -102,7 +109,7 @@ func (r *PostgresRecycleRepository) GetByHash(ctx context.Context, hash string)
 // GetByUserID 获取用户的所有回收站项目
 func (r *PostgresRecycleRepository) GetByUserID(ctx context.Context, userID string) ([]*recycle.RecycleItem, error) {
 	query := `
-		SELECT id, hash, user_id, username, directory, name, path, is_dir, size, deleted_at, created_at
+		SELECT id, hash, user_id, username, directory, name, path, is_dir, batch_id, size, deleted_at, created_at
 		FROM recycle_items
 		WHERE user_id = $1
 		ORDER BY deleted_at DESC
@@ -125,6 +132,7 @@ func (r *PostgresRecycleRepository) GetByUserID(ctx context.Context, userID stri
 			&item.Name,
 			&item.Path,
 			&item.IsDir,
+			&item.BatchID,
 			&item.Size,
 			&item.DeletedAt,
 			&item.CreatedAt,
@@ -166,7 +174,7 @@ func (r *PostgresRecycleRepository) GetByUserIDPaged(ctx context.Context, userID
 	}
 
 	query := fmt.Sprintf(`
-		SELECT id, hash, user_id, username, directory, name, path, is_dir, size, deleted_at, created_at
+		SELECT id, hash, user_id, username, directory, name, path, is_dir, batch_id, size, deleted_at, created_at
 		FROM recycle_items
 		WHERE %s
 		ORDER BY deleted_at DESC
@@ -190,6 +198,7 @@ func (r *PostgresRecycleRepository) GetByUserIDPaged(ctx context.Context, userID
 			&item.Name,
 			&item.Path,
 			&item.IsDir,
+			&item.BatchID,
 			&item.Size,
 			&item.DeletedAt,
 			&item.CreatedAt,
@@ -235,7 +244,7 @@ func (r *PostgresRecycleRepository) DeleteByUserID(ctx context.Context, userID s
 // GetDeletedItemsOlderThan 获取指定时间之前删除的项目
 func (r *PostgresRecycleRepository) GetDeletedItemsOlderThan(ctx context.Context, before time.Time) ([]*recycle.RecycleItem, error) {
 	query := `
-		SELECT id, hash, user_id, username, directory, name, path, is_dir, size, deleted_at, created_at
+		SELECT id, hash, user_id, username, directory, name, path, is_dir, batch_id, size, deleted_at, created_at
 		FROM recycle_items
 		WHERE deleted_at < $1
 		ORDER BY deleted_at ASC
@@ -258,6 +267,7 @@ func (r *PostgresRecycleRepository) GetDeletedItemsOlderThan(ctx context.Context
 			&item.Name,
 			&item.Path,
 			&item.IsDir,
+			&item.BatchID,
 			&item.Size,
 			&item.DeletedAt,
 			&item.CreatedAt,
@@ -274,6 +284,15 @@ func (r *PostgresRecycleRepository) GetDeletedItemsOlderThan(ctx context.Context
 	return items, nil
 }
 
+// UpdateOriginalPath 更新回收站项目的原始目录与路径；文件名是回收站文件的存储键，保持不变
+func (r *PostgresRecycleRepository) UpdateOriginalPath(ctx context.Context, hash, directory, path string) error {
+	query := `UPDATE recycle_items SET directory = $2, path = $3 WHERE hash = $1`
+	if _, err := r.db.ExecContext(ctx, query, hash, directory, path); err != nil {
+		return fmt.Errorf("failed to update recycle item path: %w", err)
+	}
+	return nil
+}
+
 // DeleteExpiredItems 删除过期项目（可配置保留期限）
 func (r *PostgresRecycleRepository) DeleteExpiredItems(ctx context.Context, retentionPeriod time.Duration) (int64, error) {
 	cutoff := time.Now().Add(-retentionPeriod)
@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Content search highlights matches in snippets with these private-use
+// runes, so callers can escape the snippet before turning them into markup.
+const (
+	ContentHighlightStart = "\ue000"
+	ContentHighlightStop  = "\ue001"
+)
+
+// contentHeadlineOptions configures ts_headline for result snippets.
+const contentHeadlineOptions = `MaxFragments=2, MaxWords=24, MinWords=8, FragmentDelimiter=" … ", StartSel=` +
+	ContentHighlightStart + `, StopSel=` + ContentHighlightStop
+
+// ContentDocument is the extracted text of one indexed file. SourceSize and
+// SourceModifiedAt record the file version the text was extracted from.
+type ContentDocument struct {
+	Path             string
+	SourceSize       int64
+	SourceModifiedAt time.Time
+	Content          string
+	ExtractedAt      time.Time
+}
+
+// ContentScope opts one asset space of a user into content indexing.
+type ContentScope struct {
+	UserID    string
+	Space     string
+	Prefix    string
+	CreatedAt time.Time
+}
+
+// ContentJob is a claimed extraction job. Generation changes whenever the
+// path is queued again, so completing a stale claim keeps the newer job.
+type ContentJob struct {
+	Path       string
+	Generation int64
+	Attempts   int
+}
+
+// ContentFilter narrows a full-text search; Query uses websearch syntax.
+type ContentFilter struct {
+	SearchFilter
+	Query string
+}
+
+// ContentMatch is one full-text hit with its snippet.
+type ContentMatch struct {
+	Entry   *SearchEntry
+	Snippet string
+	Rank    float64
+}
+
+type SearchContentRepository interface {
+	// Enqueue queues extraction for files among paths that are inside an
+	// opted-in scope or already have extracted text.
+	Enqueue(ctx context.Context, paths []string) (int64, error)
+	// EnqueueTree does the same for every file at or below prefix.
+	EnqueueTree(ctx context.Context, prefix string) (int64, error)
+	// Claim leases up to limit due jobs until now+lease.
+	Claim(ctx context.Context, limit int, lease time.Duration) ([]*ContentJob, error)
+	// Complete drops a job unless it was queued again after the claim.
+	Complete(ctx context.Context, job *ContentJob) error
+	// Retry makes a job due again after delay.
+	Retry(ctx context.Context, job *ContentJob, lastError string, delay time.Duration) error
+	// Covered reports whether path lies inside an opted-in scope.
+	Covered(ctx context.Context, path string) (bool, error)
+	GetDocument(ctx context.Context, path string) (*ContentDocument, error)
+	// UpsertDocument stores text for a path that exists in search_entries.
+	UpsertDocument(ctx context.Context, doc *ContentDocument) error
+	// DeleteDocuments removes the text of path and everything below it.
+	DeleteDocuments(ctx context.Context, path string) error
+	ListScopes(ctx context.Context, userID string) ([]*ContentScope, error)
+	AddScope(ctx context.Context, scope *ContentScope) error
+	RemoveScope(ctx context.Context, userID, space string) error
+	Search(ctx context.Context, filter ContentFilter) ([]*ContentMatch, error)
+}
+
+type PostgresSearchContentRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSearchContentRepository(db *sql.DB) *PostgresSearchContentRepository {
+	return &PostgresSearchContentRepository{db: db}
+}
+
+// contentEnqueueable selects files that are inside an opted-in scope, or
+// that still have text which may have to be dropped.
+const contentEnqueueable = `NOT e.is_dir AND (
+	EXISTS (
+		SELECT 1 FROM search_content_scopes s
+		WHERE e.path = s.prefix OR left(e.path, length(s.prefix) + 1) = s.prefix || '/'
+	)
+	OR EXISTS (SELECT 1 FROM search_contents c WHERE c.path = e.path)
+)`
+
+const contentEnqueueConflict = `
+	ON CONFLICT (path) DO UPDATE SET
+		generation = search_content_jobs.generation + 1,
+		attempts = 0,
+		last_error = '',
+		enqueued_at = EXCLUDED.enqueued_at,
+		available_at = EXCLUDED.available_at`
+
+func (r *PostgresSearchContentRepository) Enqueue(ctx context.Context, paths []string) (int64, error) {
+	if len(paths) == 0 {
+		return 0, nil
+	}
+	// ON CONFLICT cannot touch the same row twice in one statement.
+	unique := make([]string, 0, len(paths))
+	seen := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		if _, ok := seen[path]; !ok {
+			seen[path] = struct{}{}
+			unique = append(unique, path)
+		}
+	}
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO search_content_jobs (path, enqueued_at, available_at)
+		SELECT e.path, NOW(), NOW()
+		FROM search_entries e
+		WHERE e.path = ANY($1) AND `+contentEnqueueable+contentEnqueueConflict,
+		pq.Array(unique))
+	if err != nil {
+		return 0, fmt.Errorf("enqueue content jobs: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *PostgresSearchContentRepository) EnqueueTree(ctx context.Context, prefix string) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO search_content_jobs (path, enqueued_at, available_at)
+		SELECT e.path, NOW(), NOW()
+		FROM search_entries e
+		WHERE (e.path = $1 OR e.path LIKE $2) AND `+contentEnqueueable+contentEnqueueConflict,
+		prefix, likeTreePattern(prefix))
+	if err != nil {
+		return 0, fmt.Errorf("enqueue content tree: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *PostgresSearchContentRepository) Claim(ctx context.Context, limit int, lease time.Duration) ([]*ContentJob, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	rows, err := r.db.QueryContext(ctx, `
+		UPDATE search_content_jobs
+		SET available_at = NOW() + $2::double precision * INTERVAL '1 second',
+			attempts = attempts + 1
+		WHERE path IN (
+			SELECT path FROM search_content_jobs
+			WHERE available_at <= NOW()
+			ORDER BY available_at, path
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING path, generation, attempts
+	`, limit, lease.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim content jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := make([]*ContentJob, 0, limit)
+	for rows.Next() {
+		job := &ContentJob{}
+		if err := rows.Scan(&job.Path, &job.Generation, &job.Attempts); err != nil {
+			return nil, fmt.Errorf("scan content job: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate content jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+func (r *PostgresSearchContentRepository) Complete(ctx context.Context, job *ContentJob) error {
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM search_content_jobs WHERE path = $1 AND generation = $2
+	`, job.Path, job.Generation); err != nil {
+		return fmt.Errorf("complete content job: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchContentRepository) Retry(ctx context.Context, job *ContentJob, lastError string, delay time.Duration) error {
+	if _, err := r.db.ExecContext(ctx, `
+		UPDATE search_content_jobs
+		SET available_at = NOW() + $3::double precision * INTERVAL '1 second',
+			last_error = $4
+		WHERE path = $1 AND generation = $2
+	`, job.Path, job.Generation, delay.Seconds(), lastError); err != nil {
+		return fmt.Errorf("retry content job: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchContentRepository) Covered(ctx context.Context, path string) (bool, error) {
+	var covered bool
+	if err := r.db.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM search_content_scopes
+			WHERE $1 = prefix OR left($1, length(prefix) + 1) = prefix || '/'
+		)
+	`, path).Scan(&covered); err != nil {
+		return false, fmt.Errorf("check content scope: %w", err)
+	}
+	return covered, nil
+}
+
+func (r *PostgresSearchContentRepository) GetDocument(ctx context.Context, path string) (*ContentDocument, error) {
+	doc := &ContentDocument{}
+	err := r.db.QueryRowContext(ctx, `
+		SELECT path, source_size, source_modified_at, content, extracted_at
+		FROM search_contents WHERE path = $1
+	`, path).Scan(&doc.Path, &doc.SourceSize, &doc.SourceModifiedAt, &doc.Content, &doc.ExtractedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get content document: %w", err)
+	}
+	return doc, nil
+}
+
+func (r *PostgresSearchContentRepository) UpsertDocument(ctx context.Context, doc *ContentDocument) error {
+	extractedAt := doc.ExtractedAt
+	if extractedAt.IsZero() {
+		extractedAt = time.Now()
+	}
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO search_contents (path, source_size, source_modified_at, content, content_tsv, extracted_at)
+		VALUES ($1, $2, $3, $4, to_tsvector('simple', $4), $5)
+		ON CONFLICT (path) DO UPDATE SET
+			source_size = EXCLUDED.source_size,
+			source_modified_at = EXCLUDED.source_modified_at,
+			content = EXCLUDED.content,
+			content_tsv = EXCLUDED.content_tsv,
+			extracted_at = EXCLUDED.extracted_at
+	`, doc.Path, doc.SourceSize, doc.SourceModifiedAt, doc.Content, extractedAt); err != nil {
+		return fmt.Errorf("upsert content document %q: %w", doc.Path, err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchContentRepository) DeleteDocuments(ctx context.Context, path string) error {
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM search_contents
+		WHERE path = $1 OR path LIKE $2
+	`, path, likeTreePattern(path)); err != nil {
+		return fmt.Errorf("delete content documents: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchContentRepository) ListScopes(ctx context.Context, userID string) ([]*ContentScope, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT user_id, space, prefix, created_at
+		FROM search_content_scopes
+		WHERE user_id = $1
+		ORDER BY space
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("list content scopes: %w", err)
+	}
+	defer rows.Close()
+
+	scopes := make([]*ContentScope, 0)
+	for rows.Next() {
+		scope := &ContentScope{}
+		if err := rows.Scan(&scope.UserID, &scope.Space, &scope.Prefix, &scope.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan content scope: %w", err)
+		}
+		scopes = append(scopes, scope)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate content scopes: %w", err)
+	}
+	return scopes, nil
+}
+
+func (r *PostgresSearchContentRepository) AddScope(ctx context.Context, scope *ContentScope) error {
+	createdAt := scope.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	if _, err := r.db.ExecContext(ctx, `
+		INSERT INTO search_content_scopes (user_id, space, prefix, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, space) DO UPDATE SET prefix = EXCLUDED.prefix
+	`, scope.UserID, scope.Space, scope.Prefix, createdAt); err != nil {
+		return fmt.Errorf("add content scope: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchContentRepository) RemoveScope(ctx context.Context, userID, space string) error {
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM search_content_scopes WHERE user_id = $1 AND space = $2
+	`, userID, space); err != nil {
+		return fmt.Errorf("remove content scope: %w", err)
+	}
+	return nil
+}
+
+// Search ranks matches first and only builds headlines for the page that
+// is returned, since ts_headline re-parses the whole text.
+func (r *PostgresSearchContentRepository) Search(ctx context.Context, filter ContentFilter) ([]*ContentMatch, error) {
+	where, args := buildSearchWhere(filter.SearchFilter)
+	args = append(args, filter.Query)
+	queryArg := fmt.Sprintf("$%d", len(args))
+	where = append(where, "content_tsv @@ q")
+
+	inner := `
+		SELECT path, ts_rank_cd(content_tsv, q) AS rank
+		FROM search_entries
+		JOIN search_contents USING (path)
+		CROSS JOIN websearch_to_tsquery('simple', ` + queryArg + `) AS q
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY rank DESC, path`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		inner += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		inner += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+	args = append(args, contentHeadlineOptions)
+	optionsArg := fmt.Sprintf("$%d", len(args))
+
+	columns := strings.Split(searchEntryColumns, ", ")
+	for i, column := range columns {
+		columns[i] = "e." + column
+	}
+	query := `
+		SELECT ` + strings.Join(columns, ", ") + `,
+			ts_headline('simple', c.content, q, ` + optionsArg + `),
+			m.rank
+		FROM (` + inner + `) m
+		JOIN search_entries e ON e.path = m.path
+		JOIN search_contents c ON c.path = m.path
+		CROSS JOIN websearch_to_tsquery('simple', ` + queryArg + `) AS q
+		ORDER BY m.rank DESC, m.path`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search contents: %w", err)
+	}
+	defer rows.Close()
+
+	matches := make([]*ContentMatch, 0)
+	for rows.Next() {
+		match := &ContentMatch{Entry: &SearchEntry{}}
+		var tags pq.StringArray
+		entry := match.Entry
+		if err := rows.Scan(
+			&entry.Path,
+			&entry.ParentPath,
+			&entry.Name,
+			&entry.Extension,
+			&entry.IsDir,
+			&entry.Size,
+			&entry.ContentType,
+			&entry.ModifiedAt,
+			&tags,
+			&entry.IndexedAt,
+			&match.Snippet,
+			&match.Rank,
+		); err != nil {
+			return nil, fmt.Errorf("scan content match: %w", err)
+		}
+		entry.Tags = []string(tags)
+		if entry.Tags == nil {
+			entry.Tags = []string{}
+		}
+		matches = append(matches, match)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate content matches: %w", err)
+	}
+	return matches, nil
+}
@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SearchEntry is one indexed file or directory. Path is the logical path
+// relative to webdav.directory, e.g. "/alice/personal/report.pdf".
+type SearchEntry struct {
+	Path        string
+	ParentPath  string
+	Name        string
+	Extension   string
+	IsDir       bool
+	Size        int64
+	ContentType string
+	ModifiedAt  time.Time
+	Tags        []string
+	IndexedAt   time.Time
+}
+
+// SearchFilter narrows a search. Empty fields do not filter.
+type SearchFilter struct {
+	// Prefixes limits results to these trees (OR); each prefix matches
+	// itself and everything below it.
+	Prefixes []string
+	// ParentPath limits results to the direct children of one directory.
+	ParentPath string
+	// Name matches a substring of the file name, case-insensitively.
+	Name string
+	// NamePattern is a raw LIKE pattern matched against the lowercased name.
+	NamePattern   string
+	Extensions    []string
+	ContentType   string
+	MinSize       *int64
+	MaxSize       *int64
+	ModifiedAfter *time.Time
+	// ModifiedBefore is exclusive.
+	ModifiedBefore *time.Time
+	// Tags must all be present on an entry.
+	Tags   []string
+	IsDir  *bool
+	Limit  int
+	Offset int
+}
+
+type SearchIndexRepository interface {
+	// Upsert writes entries, keeping the tags already stored for a path.
+	Upsert(ctx context.Context, entries []*SearchEntry) error
+	Get(ctx context.Context, path string) (*SearchEntry, error)
+	// DeleteTree removes path and everything below it.
+	DeleteTree(ctx context.Context, path string) error
+	// MoveTree rewrites path and everything below it to the new prefix.
+	MoveTree(ctx context.Context, fromPath, toPath string) error
+	SetTags(ctx context.Context, path string, tags []string) error
+	Search(ctx context.Context, filter SearchFilter) ([]*SearchEntry, error)
+	// DeleteStale removes entries below prefix that were not indexed since before.
+	DeleteStale(ctx context.Context, prefix string, before time.Time) (int64, error)
+}
+
+type PostgresSearchIndexRepository struct {
+	db *sql.DB
+}
+
+func NewPostgresSearchIndexRepository(db *sql.DB) *PostgresSearchIndexRepository {
+	return &PostgresSearchIndexRepository{db: db}
+}
+
+const searchEntryColumns = `path, parent_path, name, extension, is_dir, size, content_type, modified_at, tags, indexed_at`
+
+func (r *PostgresSearchIndexRepository) Upsert(ctx context.Context, entries []*SearchEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin search index upsert: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO search_entries (path, parent_path, name, name_lower, extension, is_dir, size, content_type, modified_at, indexed_at)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		ON CONFLICT (path) DO UPDATE SET
+			parent_path = EXCLUDED.parent_path,
+			name = EXCLUDED.name,
+			name_lower = EXCLUDED.name_lower,
+			extension = EXCLUDED.extension,
+			is_dir = EXCLUDED.is_dir,
+			size = EXCLUDED.size,
+			content_type = EXCLUDED.content_type,
+			modified_at = EXCLUDED.modified_at,
+			indexed_at = EXCLUDED.indexed_at
+	`)
+	if err != nil {
+		return fmt.Errorf("prepare search index upsert: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		// indexed_at comes from the caller's clock so DeleteStale compares
+		// against the same clock that started a reindex.
+		indexedAt := entry.IndexedAt
+		if indexedAt.IsZero() {
+			indexedAt = now
+		}
+		if _, err := stmt.ExecContext(ctx,
+			entry.Path,
+			entry.ParentPath,
+			entry.Name,
+			strings.ToLower(entry.Name),
+			strings.ToLower(entry.Extension),
+			entry.IsDir,
+			entry.Size,
+			entry.ContentType,
+			entry.ModifiedAt,
+			indexedAt,
+		); err != nil {
+			return fmt.Errorf("upsert search entry %q: %w", entry.Path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit search index upsert: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchIndexRepository) Get(ctx context.Context, path string) (*SearchEntry, error) {
+	row := r.db.QueryRowContext(ctx, `SELECT `+searchEntryColumns+` FROM search_entries WHERE path = $1`, path)
+	entry, err := scanSearchEntry(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get search entry: %w", err)
+	}
+	return entry, nil
+}
+
+func (r *PostgresSearchIndexRepository) DeleteTree(ctx context.Context, path string) error {
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM search_entries
+		WHERE path = $1 OR path LIKE $2
+	`, path, likeTreePattern(path)); err != nil {
+		return fmt.Errorf("delete search tree: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchIndexRepository) MoveTree(ctx context.Context, fromPath, toPath string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin search tree move: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// An overwritten destination loses its old entries.
+	if _, err := tx.ExecContext(ctx, `
+		DELETE FROM search_entries
+		WHERE path = $1 OR path LIKE $2
+	`, toPath, likeTreePattern(toPath)); err != nil {
+		return fmt.Errorf("clear search tree destination: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE search_entries
+		SET path = $2 || substr(path, length($1) + 1),
+			parent_path = CASE
+				WHEN path = $1 THEN parent_path
+				ELSE $2 || substr(parent_path, length($1) + 1)
+			END,
+			indexed_at = $4
+		WHERE path = $1 OR path LIKE $3
+	`, fromPath, toPath, likeTreePattern(fromPath), time.Now()); err != nil {
+		return fmt.Errorf("move search tree: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit search tree move: %w", err)
+	}
+	return nil
+}
+
+func (r *PostgresSearchIndexRepository) SetTags(ctx context.Context, path string, tags []string) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	result, err := r.db.ExecContext(ctx, `UPDATE search_entries SET tags = $2 WHERE path = $1`, path, pq.Array(tags))
+	if err != nil {
+		return fmt.Errorf("set search tags: %w", err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *PostgresSearchIndexRepository) Search(ctx context.Context, filter SearchFilter) ([]*SearchEntry, error) {
+	where, args := buildSearchWhere(filter)
+	query := `SELECT ` + searchEntryColumns + ` FROM search_entries`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY name_lower, path`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("search entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*SearchEntry, 0)
+	for rows.Next() {
+		entry, err := scanSearchEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan search entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate search entries: %w", err)
+	}
+	return entries, nil
+}
+
+func (r *PostgresSearchIndexRepository) DeleteStale(ctx context.Context, prefix string, before time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `
+		DELETE FROM search_entries
+		WHERE (path = $1 OR path LIKE $2) AND indexed_at < $3
+	`, prefix, likeTreePattern(prefix), before)
+	if err != nil {
+		return 0, fmt.Errorf("delete stale search entries: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("count stale search entries: %w", err)
+	}
+	return affected, nil
+}
+
+func buildSearchWhere(filter SearchFilter) ([]string, []any) {
+	var (
+		where []string
+		args  []any
+	)
+	next := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(filter.Prefixes) > 0 {
+		clauses := make([]string, 0, len(filter.Prefixes))
+		for _, prefix := range filter.Prefixes {
+			clauses = append(clauses, fmt.Sprintf("(path = %s OR path LIKE %s)", next(prefix), next(likeTreePattern(prefix))))
+		}
+		where = append(where, "("+strings.Join(clauses, " OR ")+")")
+	}
+	if filter.ParentPath != "" {
+		where = append(where, "parent_path = "+next(filter.ParentPath))
+	}
+	if name := strings.TrimSpace(filter.Name); name != "" {
+		where = append(where, "name_lower LIKE "+next("%"+escapeLike(strings.ToLower(name))+"%"))
+	}
+	if pattern := strings.TrimSpace(filter.NamePattern); pattern != "" {
+		where = append(where, "name_lower LIKE "+next(strings.ToLower(pattern)))
+	}
+	if len(filter.Extensions) > 0 {
+		extensions := make([]string, 0, len(filter.Extensions))
+		for _, ext := range filter.Extensions {
+			extensions = append(extensions, strings.ToLower(strings.TrimPrefix(strings.TrimSpace(ext), ".")))
+		}
+		where = append(where, "extension = ANY("+next(pq.Array(extensions))+")")
+	}
+	if contentType := strings.TrimSpace(filter.ContentType); contentType != "" {
+		// "image/*" matches a whole family, anything else is a prefix match.
+		pattern := escapeLike(strings.ToLower(strings.TrimSuffix(contentType, "*"))) + "%"
+		where = append(where, "LOWER(content_type) LIKE "+next(pattern))
+	}
+	if filter.MinSize != nil {
+		where = append(where, "size >= "+next(*filter.MinSize))
+	}
+	if filter.MaxSize != nil {
+		where = append(where, "size <= "+next(*filter.MaxSize))
+	}
+	if filter.ModifiedAfter != nil {
+		where = append(where, "modified_at >= "+next(*filter.ModifiedAfter))
+	}
+	if filter.ModifiedBefore != nil {
+		where = append(where, "modified_at < "+next(*filter.ModifiedBefore))
+	}
+	if len(filter.Tags) > 0 {
+		where = append(where, "tags @> "+next(pq.Array(filter.Tags)))
+	}
+	if filter.IsDir != nil {
+		where = append(where, "is_dir = "+next(*filter.IsDir))
+	}
+	return where, args
+}
+
+type searchEntryScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSearchEntry(row searchEntryScanner) (*SearchEntry, error) {
+	entry := &SearchEntry{}
+	var tags pq.StringArray
+	if err := row.Scan(
+		&entry.Path,
+		&entry.ParentPath,
+		&entry.Name,
+		&entry.Extension,
+		&entry.IsDir,
+		&entry.Size,
+		&entry.ContentType,
+		&entry.ModifiedAt,
+		&tags,
+		&entry.IndexedAt,
+	); err != nil {
+		return nil, err
+	}
+	entry.Tags = []string(tags)
+	if entry.Tags == nil {
+		entry.Tags = []string{}
+	}
+	return entry, nil
+}
+
+func likeTreePattern(path string) string {
+	return escapeLike(strings.TrimSuffix(path, "/")) + "/%"
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
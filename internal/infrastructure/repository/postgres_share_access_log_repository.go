@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/share"
+)
+
+// ShareAccessLogFilter 访问日志查询条件，空字段不过滤
+type ShareAccessLogFilter struct {
+	Token         string
+	CreatorUserID string
+	IP            string
+	Action        string
+	Result        string
+	// Since 包含，Until 不包含
+	Since  *time.Time
+	Until  *time.Time
+	Limit  int
+	Offset int
+}
+
+// ShareAccessLogRepository 公开分享访问日志仓储接口
+type ShareAccessLogRepository interface {
+	Append(ctx context.Context, entry *share.AccessLogEntry) error
+	// List 按时间倒序返回访问日志
+	List(ctx context.Context, filter ShareAccessLogFilter) ([]*share.AccessLogEntry, error)
+}
+
+// PostgresShareAccessLogRepository PostgreSQL 实现
+type PostgresShareAccessLogRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresShareAccessLogRepository 创建 PostgreSQL 访问日志仓储
+func NewPostgresShareAccessLogRepository(db *sql.DB) *PostgresShareAccessLogRepository {
+	return &PostgresShareAccessLogRepository{db: db}
+}
+
+// Append 写入一条访问日志
+func (r *PostgresShareAccessLogRepository) Append(ctx context.Context, entry *share.AccessLogEntry) error {
+	query := `
+		INSERT INTO share_access_logs (share_id, token, creator_user_id, action, path, ip, user_agent, bytes, status, result, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id
+	`
+	if err := r.db.QueryRowContext(ctx, query,
+		entry.ShareID,
+		entry.Token,
+		entry.CreatorUserID,
+		entry.Action,
+		entry.Path,
+		entry.IP,
+		entry.UserAgent,
+		entry.Bytes,
+		entry.Status,
+		entry.Result,
+		entry.CreatedAt,
+	).Scan(&entry.ID); err != nil {
+		return fmt.Errorf("failed to append share access log: %w", err)
+	}
+	return nil
+}
+
+// List 查询访问日志
+func (r *PostgresShareAccessLogRepository) List(ctx context.Context, filter ShareAccessLogFilter) ([]*share.AccessLogEntry, error) {
+	where := []string{"TRUE"}
+	args := []any{}
+	add := func(clause string, value any) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if filter.Token != "" {
+		add("token = $%d", filter.Token)
+	}
+	if filter.CreatorUserID != "" {
+		add("creator_user_id = $%d", filter.CreatorUserID)
+	}
+	if filter.IP != "" {
+		add("ip = $%d", filter.IP)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.Result != "" {
+		add("result = $%d", filter.Result)
+	}
+	if filter.Since != nil {
+		add("created_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		add("created_at < $%d", *filter.Until)
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = 50
+	}
+	args = append(args, limit, filter.Offset)
+	query := `SELECT id, share_id, token, creator_user_id, action, path, ip, user_agent, bytes, status, result, created_at
+		FROM share_access_logs WHERE ` + strings.Join(where, " AND ") +
+		fmt.Sprintf(` ORDER BY created_at DESC, id DESC LIMIT $%d OFFSET $%d`, len(args)-1, len(args))
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share access logs: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*share.AccessLogEntry{}
+	for rows.Next() {
+		entry := &share.AccessLogEntry{}
+		if err := rows.Scan(
+			&entry.ID,
+			&entry.ShareID,
+			&entry.Token,
+			&entry.CreatorUserID,
+			&entry.Action,
+			&entry.Path,
+			&entry.IP,
+			&entry.UserAgent,
+			&entry.Bytes,
+			&entry.Status,
+			&entry.Result,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan share access log: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate share access logs: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,443 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/domain/sharegrant"
+	"github.com/yeying-community/warehouse/internal/domain/shareuser"
+)
+
+// ShareAccessRequestFilter 访问申请查询条件，空字段不过滤
+type ShareAccessRequestFilter struct {
+	RequesterUserID string
+	OwnerUserID     string
+	Status          string
+}
+
+// ShareAccessRequestDecision 所有者对申请的处理
+type ShareAccessRequestDecision struct {
+	RequestID     string
+	DeciderUserID string
+	Note          string
+	DecidedAt     time.Time
+}
+
+// ShareAccessRequestRepository 共享资源访问申请仓储接口
+type ShareAccessRequestRepository interface {
+	// Create 写入申请与 requested 审计记录；同一申请人对同一资源已有待处理申请时返回 ErrAccessRequestPending
+	Create(ctx context.Context, req *sharegrant.AccessRequest) error
+	GetByID(ctx context.Context, id string) (*sharegrant.AccessRequest, error)
+	// List 按创建时间倒序返回申请
+	List(ctx context.Context, filter ShareAccessRequestFilter) ([]*sharegrant.AccessRequest, error)
+	// ListEvents 按时间顺序返回申请的审计记录
+	ListEvents(ctx context.Context, requestID string) ([]sharegrant.AccessRequestEvent, error)
+	// Approve 在同一事务中批准申请并创建或扩展申请人的个人授权，返回授权 ID；
+	// 申请已不是 pending 时返回 ErrAccessRequestNotFound
+	Approve(ctx context.Context, decision ShareAccessRequestDecision) (string, error)
+	// Deny 拒绝待处理申请
+	Deny(ctx context.Context, decision ShareAccessRequestDecision) error
+	// Cancel 申请人撤回待处理申请
+	Cancel(ctx context.Context, id, actorUserID string, canceledAt time.Time) error
+}
+
+// PostgresShareAccessRequestRepository PostgreSQL 实现
+type PostgresShareAccessRequestRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresShareAccessRequestRepository 创建 PostgreSQL 访问申请仓储
+func NewPostgresShareAccessRequestRepository(db *sql.DB) *PostgresShareAccessRequestRepository {
+	return &PostgresShareAccessRequestRepository{db: db}
+}
+
+const shareAccessRequestColumns = `q.id, q.requester_user_id, COALESCE(ru.username, ''), q.owner_user_id, COALESCE(ou.username, ''),
+	COALESCE(q.resource_id, ''), COALESCE(q.public_share_id, ''), q.normalized_path, q.is_dir, q.permissions, q.expires_at,
+	q.message, q.status, COALESCE(q.decider_user_id, ''), q.decision_note, COALESCE(q.grant_id, ''), q.created_at, q.decided_at`
+
+const shareAccessRequestFrom = `FROM internal_share_access_requests q
+	LEFT JOIN users ru ON ru.id = q.requester_user_id
+	LEFT JOIN users ou ON ou.id = q.owner_user_id`
+
+// Create 写入申请
+func (r *PostgresShareAccessRequestRepository) Create(ctx context.Context, req *sharegrant.AccessRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var resourceID, publicShareID any
+	if req.ResourceID != "" {
+		resourceID = req.ResourceID
+	}
+	if req.PublicShareID != "" {
+		publicShareID = req.PublicShareID
+	}
+	// 部分唯一索引兜底并发，这里先排除已有待处理申请以返回明确错误
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO internal_share_access_requests (
+			id, requester_user_id, owner_user_id, resource_id, public_share_id, normalized_path, is_dir,
+			permissions, expires_at, message, status, created_at, updated_at
+		)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 'pending', $11, $11
+		WHERE NOT EXISTS (
+			SELECT 1 FROM internal_share_access_requests
+			WHERE requester_user_id = $2 AND owner_user_id = $3 AND normalized_path = $6 AND is_dir = $7 AND status = 'pending'
+		)
+	`, req.ID, req.RequesterUserID, req.OwnerUserID, resourceID, publicShareID, req.NormalizedPath, req.IsDir,
+		req.Permissions, req.ExpiresAt, req.Message, req.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create share access request: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return sharegrant.ErrAccessRequestPending
+	}
+	if err := insertShareAccessRequestEvent(ctx, tx, req.ID, req.RequesterUserID, sharegrant.RequestActionRequested, req.Permissions, req.ExpiresAt, req.Message, req.CreatedAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// GetByID 查询申请
+func (r *PostgresShareAccessRequestRepository) GetByID(ctx context.Context, id string) (*sharegrant.AccessRequest, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+shareAccessRequestColumns+` `+shareAccessRequestFrom+` WHERE q.id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share access request: %w", err)
+	}
+	defer rows.Close()
+	requests, err := scanShareAccessRequests(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, sharegrant.ErrAccessRequestNotFound
+	}
+	return requests[0], nil
+}
+
+// List 查询申请
+func (r *PostgresShareAccessRequestRepository) List(ctx context.Context, filter ShareAccessRequestFilter) ([]*sharegrant.AccessRequest, error) {
+	where := []string{"1 = 1"}
+	args := []any{}
+	if filter.RequesterUserID != "" {
+		args = append(args, filter.RequesterUserID)
+		where = append(where, fmt.Sprintf("q.requester_user_id = $%d", len(args)))
+	}
+	if filter.OwnerUserID != "" {
+		args = append(args, filter.OwnerUserID)
+		where = append(where, fmt.Sprintf("q.owner_user_id = $%d", len(args)))
+	}
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("q.status = $%d", len(args)))
+	}
+	query := `SELECT ` + shareAccessRequestColumns + ` ` + shareAccessRequestFrom + `
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY q.created_at DESC, q.id ASC`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share access requests: %w", err)
+	}
+	defer rows.Close()
+	return scanShareAccessRequests(rows)
+}
+
+// ListEvents 查询审计记录
+func (r *PostgresShareAccessRequestRepository) ListEvents(ctx context.Context, requestID string) ([]sharegrant.AccessRequestEvent, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT e.id, e.request_id, COALESCE(e.actor_user_id, ''), COALESCE(u.username, ''), e.action, e.permissions, e.expires_at, e.note, e.created_at
+		FROM internal_share_access_request_events e
+		LEFT JOIN users u ON u.id = e.actor_user_id
+		WHERE e.request_id = $1
+		ORDER BY e.id ASC
+	`, requestID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share access request events: %w", err)
+	}
+	defer rows.Close()
+	events := make([]sharegrant.AccessRequestEvent, 0)
+	for rows.Next() {
+		var event sharegrant.AccessRequestEvent
+		var expiresAt sql.NullTime
+		if err := rows.Scan(&event.ID, &event.RequestID, &event.ActorUserID, &event.ActorUsername, &event.Action, &event.Permissions, &expiresAt, &event.Note, &event.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan share access request event: %w", err)
+		}
+		if expiresAt.Valid {
+			event.ExpiresAt = &expiresAt.Time
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate share access request events: %w", err)
+	}
+	return events, nil
+}
+
+// Approve 批准申请：申请人在该资源上已有仅授予其本人的定向分享时，扩展该授权的权限并改用申请的有效期；
+// 否则新建一条只面向申请人的定向分享，同时写入 V3 资源、授权与受众，无需等待下次对账
+func (r *PostgresShareAccessRequestRepository) Approve(ctx context.Context, decision ShareAccessRequestDecision) (string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var (
+		requesterID, ownerID, resourceID, normalizedPath, permissions string
+		isDir                                                         bool
+		expiresAt                                                     *time.Time
+	)
+	err = tx.QueryRowContext(ctx, `
+		UPDATE internal_share_access_requests
+		SET status = 'approved', decider_user_id = $2, decision_note = $3, decided_at = $4, updated_at = $4
+		WHERE id = $1 AND status = 'pending'
+		RETURNING requester_user_id, owner_user_id, COALESCE(resource_id, ''), normalized_path, is_dir, permissions, expires_at
+	`, decision.RequestID, decision.DeciderUserID, decision.Note, decision.DecidedAt).Scan(
+		&requesterID, &ownerID, &resourceID, &normalizedPath, &isDir, &permissions, &expiresAt)
+	if err == sql.ErrNoRows {
+		return "", sharegrant.ErrAccessRequestNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to approve share access request: %w", err)
+	}
+
+	resource, err := resolveAccessRequestResource(ctx, tx, resourceID, ownerID, normalizedPath, isDir, decision.DecidedAt)
+	if err != nil {
+		return "", err
+	}
+
+	var grantID, legacyShareID, currentPermissions string
+	err = tx.QueryRowContext(ctx, `
+		SELECT g.id, g.legacy_share_id, g.permissions
+		FROM internal_share_grants g
+		JOIN internal_share_items i ON i.id = g.legacy_share_id
+		WHERE g.resource_id = $1 AND i.status = 'active'
+		AND EXISTS (
+			SELECT 1 FROM internal_share_audiences a
+			WHERE a.grant_id = g.id AND a.audience_type = 'user' AND a.source_group_id IS NULL AND a.target_user_id = $2
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM internal_share_audiences a
+			WHERE a.share_id = g.legacy_share_id
+			AND NOT (a.audience_type = 'user' AND a.source_group_id IS NULL AND a.target_user_id = $2)
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM internal_share_email_invites v WHERE v.share_id = g.legacy_share_id AND v.status = 'pending'
+		)
+		ORDER BY g.created_at ASC
+		LIMIT 1
+		FOR UPDATE OF g
+	`, resource.ID, requesterID).Scan(&grantID, &legacyShareID, &currentPermissions)
+	switch {
+	case err == sql.ErrNoRows:
+		grantID, err = createRequesterGrant(ctx, tx, resource, requesterID, permissions, expiresAt, decision.DecidedAt)
+		if err != nil {
+			return "", err
+		}
+	case err != nil:
+		return "", fmt.Errorf("failed to find requester grant: %w", err)
+	default:
+		permissions = sharegrant.UnionPermissions(currentPermissions, permissions)
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE internal_share_grants SET permissions = $2, expires_at = $3, status = 'active', updated_at = $4 WHERE id = $1
+		`, grantID, permissions, expiresAt, decision.DecidedAt); err != nil {
+			return "", fmt.Errorf("failed to update share grant: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE internal_share_items SET permissions = $2, expires_at = $3, expiry_reminded_at = NULL, expiry_notified_at = NULL, updated_at = $4 WHERE id = $1
+		`, legacyShareID, permissions, expiresAt, decision.DecidedAt); err != nil {
+			return "", fmt.Errorf("failed to update share item: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE internal_share_access_requests SET resource_id = $2, grant_id = $3 WHERE id = $1
+	`, decision.RequestID, resource.ID, grantID); err != nil {
+		return "", fmt.Errorf("failed to link share access request grant: %w", err)
+	}
+	if err := insertShareAccessRequestEvent(ctx, tx, decision.RequestID, decision.DeciderUserID, sharegrant.RequestActionApproved, permissions, expiresAt, decision.Note, decision.DecidedAt); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return grantID, nil
+}
+
+// resolveAccessRequestResource prefers the resource recorded on the request,
+// which follows owner moves, and otherwise projects the requested path.
+func resolveAccessRequestResource(ctx context.Context, tx *sql.Tx, resourceID, ownerID, normalizedPath string, isDir bool, now time.Time) (*sharegrant.Resource, error) {
+	resource := &sharegrant.Resource{}
+	if resourceID != "" {
+		err := tx.QueryRowContext(ctx, `
+			SELECT id, owner_user_id, normalized_path, is_dir FROM internal_shared_resources WHERE id = $1
+		`, resourceID).Scan(&resource.ID, &resource.OwnerUserID, &resource.NormalizedPath, &resource.IsDir)
+		if err == nil {
+			return resource, nil
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to load shared resource: %w", err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO internal_shared_resources (id, owner_user_id, normalized_path, is_dir, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $5)
+		ON CONFLICT (owner_user_id, normalized_path, is_dir) DO NOTHING
+	`, sharegrant.ResourceID(ownerID, normalizedPath, isDir), ownerID, normalizedPath, isDir, now); err != nil {
+		return nil, fmt.Errorf("failed to upsert shared resource: %w", err)
+	}
+	if err := tx.QueryRowContext(ctx, `
+		SELECT id, owner_user_id, normalized_path, is_dir FROM internal_shared_resources
+		WHERE owner_user_id = $1 AND normalized_path = $2 AND is_dir = $3
+	`, ownerID, normalizedPath, isDir).Scan(&resource.ID, &resource.OwnerUserID, &resource.NormalizedPath, &resource.IsDir); err != nil {
+		return nil, fmt.Errorf("failed to load shared resource: %w", err)
+	}
+	return resource, nil
+}
+
+// createRequesterGrant writes a directed share addressed only to the
+// requester and its V3 projection. Grant IDs follow the reconciler and reuse
+// the legacy share ID.
+func createRequesterGrant(ctx context.Context, tx *sql.Tx, resource *sharegrant.Resource, requesterID, permissions string, expiresAt *time.Time, now time.Time) (string, error) {
+	shareID := uuid.NewString()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO internal_share_items (
+			id, owner_user_id, owner_username, name, path, is_dir, permissions, expires_at, status, created_at, updated_at
+		)
+		SELECT $1, u.id, u.username, $3, $4, $5, $6, $7, 'active', $8, $8 FROM users u WHERE u.id = $2
+	`, shareID, resource.OwnerUserID, path.Base(resource.NormalizedPath), resource.NormalizedPath, resource.IsDir, permissions, expiresAt, now); err != nil {
+		return "", fmt.Errorf("failed to create share item: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO internal_share_grants (id, resource_id, legacy_share_id, permissions, expires_at, status, created_at, updated_at)
+		VALUES ($1, $2, $1, $3, $4, 'active', $5, $5)
+	`, shareID, resource.ID, permissions, expiresAt, now); err != nil {
+		return "", fmt.Errorf("failed to create share grant: %w", err)
+	}
+
+	var wallet sql.NullString
+	if err := tx.QueryRowContext(ctx, `
+		SELECT NULLIF(LOWER(TRIM(COALESCE(wallet_address, ''))), '') FROM users WHERE id = $1
+	`, requesterID).Scan(&wallet); err != nil {
+		return "", fmt.Errorf("failed to load requester: %w", err)
+	}
+	aud := UserShareAudience{
+		AudienceType: shareuser.AudienceTypeUser,
+		TargetUserID: requesterID,
+		TargetWallet: wallet.String,
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO internal_share_audiences (
+			id, share_id, grant_id, audience_type, target_user_id, target_wallet_address, source_group_id, created_at
+		) VALUES ($1, $2, $2, $3, $4, $5, NULL, $6)
+	`, makeAudienceID(shareID, aud), shareID, aud.AudienceType, aud.TargetUserID, wallet, now); err != nil {
+		return "", fmt.Errorf("failed to create share audience: %w", err)
+	}
+	return shareID, nil
+}
+
+// Deny 拒绝申请
+func (r *PostgresShareAccessRequestRepository) Deny(ctx context.Context, decision ShareAccessRequestDecision) error {
+	return r.finish(ctx, decision.RequestID, decision.DeciderUserID, sharegrant.RequestStatusDenied, sharegrant.RequestActionDenied, decision.Note, decision.DecidedAt)
+}
+
+// Cancel 撤回申请
+func (r *PostgresShareAccessRequestRepository) Cancel(ctx context.Context, id, actorUserID string, canceledAt time.Time) error {
+	return r.finish(ctx, id, actorUserID, sharegrant.RequestStatusCanceled, sharegrant.RequestActionCanceled, "", canceledAt)
+}
+
+// finish closes a pending request without touching any grant.
+func (r *PostgresShareAccessRequestRepository) finish(ctx context.Context, id, actorUserID, status, action, note string, at time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE internal_share_access_requests
+		SET status = $2, decider_user_id = $3, decision_note = $4, decided_at = $5, updated_at = $5
+		WHERE id = $1 AND status = 'pending'
+	`, id, status, actorUserID, note, at)
+	if err != nil {
+		return fmt.Errorf("failed to update share access request: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return sharegrant.ErrAccessRequestNotFound
+	}
+	if err := insertShareAccessRequestEvent(ctx, tx, id, actorUserID, action, "", nil, note, at); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func insertShareAccessRequestEvent(ctx context.Context, tx *sql.Tx, requestID, actorUserID, action, permissions string, expiresAt *time.Time, note string, at time.Time) error {
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO internal_share_access_request_events (request_id, actor_user_id, action, permissions, expires_at, note, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, requestID, actorUserID, action, permissions, expiresAt, note, at); err != nil {
+		return fmt.Errorf("failed to record share access request event: %w", err)
+	}
+	return nil
+}
+
+func scanShareAccessRequests(rows *sql.Rows) ([]*sharegrant.AccessRequest, error) {
+	requests := make([]*sharegrant.AccessRequest, 0)
+	for rows.Next() {
+		req := &sharegrant.AccessRequest{}
+		var expiresAt, decidedAt sql.NullTime
+		if err := rows.Scan(
+			&req.ID,
+			&req.RequesterUserID,
+			&req.RequesterUsername,
+			&req.OwnerUserID,
+			&req.OwnerUsername,
+			&req.ResourceID,
+			&req.PublicShareID,
+			&req.NormalizedPath,
+			&req.IsDir,
+			&req.Permissions,
+			&expiresAt,
+			&req.Message,
+			&req.Status,
+			&req.DeciderUserID,
+			&req.DecisionNote,
+			&req.GrantID,
+			&req.CreatedAt,
+			&decidedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan share access request: %w", err)
+		}
+		if expiresAt.Valid {
+			req.ExpiresAt = &expiresAt.Time
+		}
+		if decidedAt.Valid {
+			req.DecidedAt = &decidedAt.Time
+		}
+		requests = append(requests, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate share access requests: %w", err)
+	}
+	return requests, nil
+}
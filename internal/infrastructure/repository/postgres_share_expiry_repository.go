@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	// ShareExpiryKindPublic 公开分享链接（share_items）
+	ShareExpiryKindPublic = "public"
+	// ShareExpiryKindDirected 定向分享（internal_share_items）
+	ShareExpiryKindDirected = "directed"
+
+	// ShareExpiryStageReminder 到期前提醒
+	ShareExpiryStageReminder = "reminder"
+	// ShareExpiryStageExpired 已过期通知
+	ShareExpiryStageExpired = "expired"
+)
+
+// ExpiringShare 需要发送到期提醒或过期通知的分享
+type ExpiringShare struct {
+	Kind string
+	ID   string
+	// OwnerUserID 公开链接为创建者，定向分享为所有者
+	OwnerUserID   string
+	OwnerUsername string
+	Name          string
+	Path          string
+	ExpiresAt     time.Time
+	// RecipientUserIDs 定向分享的接收方：用户受众与分组受众的 active 成员；全员共享不展开
+	RecipientUserIDs []string
+}
+
+// ShareExpiryRepository 分享到期扫描仓储
+type ShareExpiryRepository interface {
+	// ListPending 返回 expires_at 落在 (from, to] 且该阶段尚未通知的分享
+	ListPending(ctx context.Context, stage string, from, to time.Time) ([]*ExpiringShare, error)
+	// MarkNotified 记录该阶段已通知；有效期已被修改（续期）时不做任何变更
+	MarkNotified(ctx context.Context, stage string, item *ExpiringShare, at time.Time) error
+}
+
+// PostgresShareExpiryRepository PostgreSQL 实现
+type PostgresShareExpiryRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresShareExpiryRepository 创建分享到期扫描仓储
+func NewPostgresShareExpiryRepository(db *sql.DB) *PostgresShareExpiryRepository {
+	return &PostgresShareExpiryRepository{db: db}
+}
+
+// ListPending 查询待通知的公开链接与定向分享，定向分享附带当前接收方
+func (r *PostgresShareExpiryRepository) ListPending(ctx context.Context, stage string, from, to time.Time) ([]*ExpiringShare, error) {
+	column, err := shareExpiryStageColumn(stage)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(`
+		SELECT '%[2]s', s.id, s.creator_user_id, COALESCE(u.username, ''), s.name, s.path, s.expires_at
+		FROM share_items s
+		LEFT JOIN users u ON u.id = s.creator_user_id
+		WHERE s.expires_at > $1 AND s.expires_at <= $2 AND s.%[1]s IS NULL
+		UNION ALL
+		SELECT '%[3]s', i.id, i.owner_user_id, i.owner_username, i.name, i.path, i.expires_at
+		FROM internal_share_items i
+		WHERE i.status = 'active' AND i.expires_at > $1 AND i.expires_at <= $2 AND i.%[1]s IS NULL
+		ORDER BY 7 ASC, 2 ASC
+	`, column, ShareExpiryKindPublic, ShareExpiryKindDirected)
+
+	rows, err := r.db.QueryContext(ctx, query, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expiring shares: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*ExpiringShare
+	for rows.Next() {
+		item := &ExpiringShare{}
+		if err := rows.Scan(&item.Kind, &item.ID, &item.OwnerUserID, &item.OwnerUsername, &item.Name, &item.Path, &item.ExpiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan expiring share: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate expiring shares: %w", err)
+	}
+	rows.Close()
+
+	for _, item := range items {
+		if item.Kind != ShareExpiryKindDirected {
+			continue
+		}
+		if item.RecipientUserIDs, err = r.listDirectedRecipients(ctx, item.ID, item.OwnerUserID); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (r *PostgresShareExpiryRepository) listDirectedRecipients(ctx context.Context, shareID, ownerUserID string) ([]string, error) {
+	query := `
+		SELECT a.target_user_id
+		FROM internal_share_audiences a
+		WHERE a.share_id = $1 AND a.audience_type = 'user' AND a.source_group_id IS NULL AND a.target_user_id IS NOT NULL
+		UNION
+		SELECT u.id
+		FROM internal_share_audiences a
+		JOIN group_members m ON m.group_id = a.source_group_id AND m.status <> 'pending'
+		JOIN users u ON LOWER(u.wallet_address) = LOWER(m.wallet_address)
+		WHERE a.share_id = $1 AND a.source_group_id IS NOT NULL
+		ORDER BY 1
+	`
+	rows, err := r.db.QueryContext(ctx, query, shareID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan share recipient: %w", err)
+		}
+		if userID != ownerUserID {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate share recipients: %w", err)
+	}
+	return userIDs, nil
+}
+
+// MarkNotified 按有效期条件更新通知时间，避免覆盖扫描期间发生的续期
+func (r *PostgresShareExpiryRepository) MarkNotified(ctx context.Context, stage string, item *ExpiringShare, at time.Time) error {
+	if item == nil {
+		return nil
+	}
+	column, err := shareExpiryStageColumn(stage)
+	if err != nil {
+		return err
+	}
+	table := "share_items"
+	if item.Kind == ShareExpiryKindDirected {
+		table = "internal_share_items"
+	}
+	query := fmt.Sprintf(`UPDATE %s SET %s = $3 WHERE id = $1 AND expires_at = $2`, table, column)
+	if _, err := r.db.ExecContext(ctx, query, item.ID, item.ExpiresAt, at); err != nil {
+		return fmt.Errorf("failed to mark share expiry notified: %w", err)
+	}
+	return nil
+}
+
+func shareExpiryStageColumn(stage string) (string, error) {
+	switch stage {
+	case ShareExpiryStageReminder:
+		return "expiry_reminded_at", nil
+	case ShareExpiryStageExpired:
+		return "expiry_notified_at", nil
+	default:
+		return "", fmt.Errorf("unsupported share expiry stage: %s", stage)
+	}
+}
@@ -0,0 +1,219 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/shareuser"
+)
+
+// ShareInviteRepository 定向分享邮箱邀请仓储接口
+type ShareInviteRepository interface {
+	Create(ctx context.Context, invite *shareuser.EmailInvite) error
+	GetByID(ctx context.Context, id string) (*shareuser.EmailInvite, error)
+	// ListByOwner 按创建时间倒序返回 owner 发出的邀请，shareID / status 为空时不过滤
+	ListByOwner(ctx context.Context, ownerUserID, shareID, status string) ([]*shareuser.EmailInvite, error)
+	// ListPendingByEmail 返回该邮箱仍有效分享上的待生效邀请
+	ListPendingByEmail(ctx context.Context, email string) ([]*shareuser.EmailInvite, error)
+	// Accept 在同一事务中将邀请标记为已接受并为目标用户写入 user 受众；
+	// 邀请已不是 pending 时返回 ErrInviteNotFound
+	Accept(ctx context.Context, id, targetUserID, targetWallet string, acceptedAt time.Time) error
+	// Revoke 撤销待生效邀请，邀请已不是 pending 时返回 ErrInviteNotFound
+	Revoke(ctx context.Context, id string) error
+}
+
+// PostgresShareInviteRepository PostgreSQL 实现
+type PostgresShareInviteRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresShareInviteRepository 创建 PostgreSQL 邮箱邀请仓储
+func NewPostgresShareInviteRepository(db *sql.DB) *PostgresShareInviteRepository {
+	return &PostgresShareInviteRepository{db: db}
+}
+
+const shareInviteColumns = `v.id, v.share_id, v.owner_user_id, v.email, v.status, v.accepted_user_id, v.created_at, v.accepted_at, i.name, i.path`
+
+// Create 写入邀请
+func (r *PostgresShareInviteRepository) Create(ctx context.Context, invite *shareuser.EmailInvite) error {
+	query := `
+		INSERT INTO internal_share_email_invites (id, share_id, owner_user_id, email, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)
+	`
+	if _, err := r.db.ExecContext(ctx, query,
+		invite.ID,
+		invite.ShareID,
+		invite.OwnerUserID,
+		invite.Email,
+		invite.Status,
+		invite.CreatedAt,
+	); err != nil {
+		return fmt.Errorf("failed to create share invite: %w", err)
+	}
+	return nil
+}
+
+// GetByID 查询邀请
+func (r *PostgresShareInviteRepository) GetByID(ctx context.Context, id string) (*shareuser.EmailInvite, error) {
+	query := `SELECT ` + shareInviteColumns + `
+		FROM internal_share_email_invites v
+		JOIN internal_share_items i ON i.id = v.share_id
+		WHERE v.id = $1`
+	rows, err := r.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share invite: %w", err)
+	}
+	defer rows.Close()
+	invites, err := scanShareInvites(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(invites) == 0 {
+		return nil, shareuser.ErrInviteNotFound
+	}
+	return invites[0], nil
+}
+
+// ListByOwner 查询 owner 发出的邀请
+func (r *PostgresShareInviteRepository) ListByOwner(ctx context.Context, ownerUserID, shareID, status string) ([]*shareuser.EmailInvite, error) {
+	where := []string{"v.owner_user_id = $1"}
+	args := []any{ownerUserID}
+	if shareID != "" {
+		args = append(args, shareID)
+		where = append(where, fmt.Sprintf("v.share_id = $%d", len(args)))
+	}
+	if status != "" {
+		args = append(args, status)
+		where = append(where, fmt.Sprintf("v.status = $%d", len(args)))
+	}
+	query := `SELECT ` + shareInviteColumns + `
+		FROM internal_share_email_invites v
+		JOIN internal_share_items i ON i.id = v.share_id
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY v.created_at DESC, v.id ASC`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query share invites: %w", err)
+	}
+	defer rows.Close()
+	return scanShareInvites(rows)
+}
+
+// ListPendingByEmail 查询邮箱的待生效邀请
+func (r *PostgresShareInviteRepository) ListPendingByEmail(ctx context.Context, email string) ([]*shareuser.EmailInvite, error) {
+	query := `SELECT ` + shareInviteColumns + `
+		FROM internal_share_email_invites v
+		JOIN internal_share_items i ON i.id = v.share_id
+		WHERE v.email = $1 AND v.status = 'pending' AND i.status = 'active'
+		ORDER BY v.created_at ASC, v.id ASC`
+	rows, err := r.db.QueryContext(ctx, query, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending share invites: %w", err)
+	}
+	defer rows.Close()
+	return scanShareInvites(rows)
+}
+
+// Accept 接受邀请并授权目标用户
+func (r *PostgresShareInviteRepository) Accept(ctx context.Context, id, targetUserID, targetWallet string, acceptedAt time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var shareID string
+	err = tx.QueryRowContext(ctx, `
+		UPDATE internal_share_email_invites
+		SET status = 'accepted', accepted_user_id = $2, accepted_at = $3, updated_at = $3
+		WHERE id = $1 AND status = 'pending'
+		RETURNING share_id
+	`, id, targetUserID, acceptedAt).Scan(&shareID)
+	if err == sql.ErrNoRows {
+		return shareuser.ErrInviteNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to accept share invite: %w", err)
+	}
+
+	aud := UserShareAudience{
+		AudienceType: shareuser.AudienceTypeUser,
+		TargetUserID: targetUserID,
+		TargetWallet: strings.ToLower(strings.TrimSpace(targetWallet)),
+	}
+	var wallet any
+	if aud.TargetWallet != "" {
+		wallet = aud.TargetWallet
+	}
+	// 已完成 V3 投影的分享同时挂到对应授权上
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO internal_share_audiences (
+			id, share_id, grant_id, audience_type, target_user_id, target_wallet_address, source_group_id, created_at
+		) VALUES ($1, $2, (SELECT id FROM internal_share_grants WHERE legacy_share_id = $2), $3, $4, $5, NULL, $6)
+		ON CONFLICT (id) DO NOTHING
+	`, makeAudienceID(shareID, aud), shareID, aud.AudienceType, aud.TargetUserID, wallet, acceptedAt); err != nil {
+		return fmt.Errorf("failed to create share audience: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Revoke 撤销邀请
+func (r *PostgresShareInviteRepository) Revoke(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE internal_share_email_invites
+		SET status = 'revoked', updated_at = NOW()
+		WHERE id = $1 AND status = 'pending'
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share invite: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return shareuser.ErrInviteNotFound
+	}
+	return nil
+}
+
+func scanShareInvites(rows *sql.Rows) ([]*shareuser.EmailInvite, error) {
+	invites := make([]*shareuser.EmailInvite, 0)
+	for rows.Next() {
+		invite := &shareuser.EmailInvite{}
+		var acceptedUserID sql.NullString
+		var acceptedAt sql.NullTime
+		if err := rows.Scan(
+			&invite.ID,
+			&invite.ShareID,
+			&invite.OwnerUserID,
+			&invite.Email,
+			&invite.Status,
+			&acceptedUserID,
+			&invite.CreatedAt,
+			&acceptedAt,
+			&invite.ShareName,
+			&invite.SharePath,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan share invite: %w", err)
+		}
+		if acceptedUserID.Valid {
+			invite.AcceptedUserID = acceptedUserID.String
+		}
+		if acceptedAt.Valid {
+			invite.AcceptedAt = &acceptedAt.Time
+		}
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate share invites: %w", err)
+	}
+	return invites, nil
+}
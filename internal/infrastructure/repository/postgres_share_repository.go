@@ -3,8 +3,10 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"path"
+	"time"
 
 	"github.com/yeying-community/warehouse/internal/domain/share"
 )
@@ -15,8 +17,16 @@ type ShareRepository interface {
 	GetByToken(ctx context.Context, token string) (*share.ShareItem, error)
 	GetByUserID(ctx context.Context, userID string) ([]*share.ShareItem, error)
 	DeleteByToken(ctx context.Context, token string) error
+	UpdatePassword(ctx context.Context, token, passwordHash string) error
+	// UpdateExpiry 修改有效期并清空到期提醒状态
+	UpdateExpiry(ctx context.Context, token string, expiresAt *time.Time) error
+	// IncrementView / IncrementDownload 在未达到次数上限时累加计数，已达上限返回 share.ErrShareExpired
 	IncrementView(ctx context.Context, token string) error
 	IncrementDownload(ctx context.Context, token string) error
+	// ReserveUpload 在不超过 limits 总大小与文件数上限时累加上传模式分享的用量，
+	// 超限返回 share.ErrShareUploadLimit
+	ReserveUpload(ctx context.Context, token string, size int64, limits share.UploadLimits) error
+	ReleaseUpload(ctx context.Context, token string, size int64) error
 }
 
 type ShareReferenceRepository interface {
@@ -37,10 +47,14 @@ func NewPostgresShareRepository(db *sql.DB) *PostgresShareRepository {
 // Create 创建分享记录
 func (r *PostgresShareRepository) Create(ctx context.Context, item *share.ShareItem) error {
 	query := `
-		INSERT INTO share_items (id, token, user_id, creator_user_id, source_share_id, source_resource_id, username, name, path, mode, expires_at, view_count, download_count, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		INSERT INTO share_items (id, token, user_id, creator_user_id, source_share_id, source_resource_id, username, name, path, is_dir, mode, expires_at, view_count, download_count, password_hash, created_at, upload_limits, max_views, max_downloads)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)
 	`
-	_, err := r.db.ExecContext(ctx, query,
+	uploadLimits, err := encodeShareUploadLimits(item.Upload)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, query,
 		item.ID,
 		item.Token,
 		item.UserID,
@@ -50,11 +64,16 @@ func (r *PostgresShareRepository) Create(ctx context.Context, item *share.ShareI
 		item.Username,
 		item.Name,
 		item.Path,
+		item.IsDir,
 		item.Mode,
 		item.ExpiresAt,
 		item.ViewCount,
 		item.DownloadCount,
+		item.PasswordHash,
 		item.CreatedAt,
+		uploadLimits,
+		item.MaxViews,
+		item.MaxDownloads,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create share item: %w", err)
@@ -65,12 +84,13 @@ func (r *PostgresShareRepository) Create(ctx context.Context, item *share.ShareI
 // GetByToken 根据 token 获取分享记录
 func (r *PostgresShareRepository) GetByToken(ctx context.Context, token string) (*share.ShareItem, error) {
 	query := `
-		SELECT id, token, user_id, creator_user_id, COALESCE(source_share_id, ''), COALESCE(source_resource_id, ''), username, name, path, mode, expires_at, view_count, download_count, created_at
+		SELECT id, token, user_id, creator_user_id, COALESCE(source_share_id, ''), COALESCE(source_resource_id, ''), username, name, path, is_dir, mode, expires_at, view_count, download_count, password_hash, created_at, upload_limits, uploaded_bytes, uploaded_files, max_views, max_downloads
 		FROM share_items
 		WHERE token = $1
 	`
 	item := &share.ShareItem{}
 	var expiresAt sql.NullTime
+	var uploadLimits string
 	err := r.db.QueryRowContext(ctx, query, token).Scan(
 		&item.ID,
 		&item.Token,
@@ -81,11 +101,18 @@ func (r *PostgresShareRepository) GetByToken(ctx context.Context, token string)
 		&item.Username,
 		&item.Name,
 		&item.Path,
+		&item.IsDir,
 		&item.Mode,
 		&expiresAt,
 		&item.ViewCount,
 		&item.DownloadCount,
+		&item.PasswordHash,
 		&item.CreatedAt,
+		&uploadLimits,
+		&item.UploadedBytes,
+		&item.UploadedFiles,
+		&item.MaxViews,
+		&item.MaxDownloads,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -97,13 +124,14 @@ func (r *PostgresShareRepository) GetByToken(ctx context.Context, token string)
 		item.ExpiresAt = &expiresAt.Time
 	}
 	item.Mode = normalizeLoadedShareMode(item.Mode)
+	item.Upload = decodeShareUploadLimits(uploadLimits)
 	return item, nil
 }
 
 // GetByUserID 获取用户的分享列表
 func (r *PostgresShareRepository) GetByUserID(ctx context.Context, userID string) ([]*share.ShareItem, error) {
 	query := `
-		SELECT id, token, user_id, creator_user_id, COALESCE(source_share_id, ''), COALESCE(source_resource_id, ''), username, name, path, mode, expires_at, view_count, download_count, created_at
+		SELECT id, token, user_id, creator_user_id, COALESCE(source_share_id, ''), COALESCE(source_resource_id, ''), username, name, path, is_dir, mode, expires_at, view_count, download_count, password_hash, created_at, upload_limits, uploaded_bytes, uploaded_files, max_views, max_downloads
 		FROM share_items
 		WHERE creator_user_id = $1
 		ORDER BY created_at DESC
@@ -118,6 +146,7 @@ func (r *PostgresShareRepository) GetByUserID(ctx context.Context, userID string
 	for rows.Next() {
 		item := &share.ShareItem{}
 		var expiresAt sql.NullTime
+		var uploadLimits string
 		if err := rows.Scan(
 			&item.ID,
 			&item.Token,
@@ -128,11 +157,18 @@ func (r *PostgresShareRepository) GetByUserID(ctx context.Context, userID string
 			&item.Username,
 			&item.Name,
 			&item.Path,
+			&item.IsDir,
 			&item.Mode,
 			&expiresAt,
 			&item.ViewCount,
 			&item.DownloadCount,
+			&item.PasswordHash,
 			&item.CreatedAt,
+			&uploadLimits,
+			&item.UploadedBytes,
+			&item.UploadedFiles,
+			&item.MaxViews,
+			&item.MaxDownloads,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan share item: %w", err)
 		}
@@ -140,6 +176,7 @@ func (r *PostgresShareRepository) GetByUserID(ctx context.Context, userID string
 			item.ExpiresAt = &expiresAt.Time
 		}
 		item.Mode = normalizeLoadedShareMode(item.Mode)
+		item.Upload = decodeShareUploadLimits(uploadLimits)
 		items = append(items, item)
 	}
 	if err := rows.Err(); err != nil {
@@ -165,12 +202,12 @@ func (r *PostgresShareRepository) DeleteByToken(ctx context.Context, token strin
 	return nil
 }
 
-// IncrementView 增加访问次数
-func (r *PostgresShareRepository) IncrementView(ctx context.Context, token string) error {
-	query := `UPDATE share_items SET view_count = view_count + 1 WHERE token = $1`
-	result, err := r.db.ExecContext(ctx, query, token)
+// UpdatePassword 更新访问密码哈希，空字符串表示移除密码
+func (r *PostgresShareRepository) UpdatePassword(ctx context.Context, token, passwordHash string) error {
+	query := `UPDATE share_items SET password_hash = $2 WHERE token = $1`
+	result, err := r.db.ExecContext(ctx, query, token, passwordHash)
 	if err != nil {
-		return fmt.Errorf("failed to increment view count: %w", err)
+		return fmt.Errorf("failed to update share password: %w", err)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
@@ -182,19 +219,94 @@ func (r *PostgresShareRepository) IncrementView(ctx context.Context, token strin
 	return nil
 }
 
-// IncrementDownload 增加下载次数
+// UpdateExpiry 修改分享有效期，续期后按新的有效期重新提醒
+func (r *PostgresShareRepository) UpdateExpiry(ctx context.Context, token string, expiresAt *time.Time) error {
+	query := `UPDATE share_items SET expires_at = $2, expiry_reminded_at = NULL, expiry_notified_at = NULL WHERE token = $1`
+	result, err := r.db.ExecContext(ctx, query, token, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to update share expiry: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return share.ErrShareNotFound
+	}
+	return nil
+}
+
+// IncrementView 增加访问次数，条件更新保证并发访问不会越过 max_views
+func (r *PostgresShareRepository) IncrementView(ctx context.Context, token string) error {
+	query := `UPDATE share_items SET view_count = view_count + 1 WHERE token = $1 AND (max_views <= 0 OR view_count < max_views)`
+	result, err := r.db.ExecContext(ctx, query, token)
+	if err != nil {
+		return fmt.Errorf("failed to increment view count: %w", err)
+	}
+	return r.checkCounted(ctx, token, result)
+}
+
+// IncrementDownload 增加下载次数，条件更新保证并发下载不会越过 max_downloads
 func (r *PostgresShareRepository) IncrementDownload(ctx context.Context, token string) error {
-	query := `UPDATE share_items SET download_count = download_count + 1 WHERE token = $1`
+	query := `UPDATE share_items SET download_count = download_count + 1 WHERE token = $1 AND (max_downloads <= 0 OR download_count < max_downloads)`
 	result, err := r.db.ExecContext(ctx, query, token)
 	if err != nil {
 		return fmt.Errorf("failed to increment download count: %w", err)
 	}
+	return r.checkCounted(ctx, token, result)
+}
+
+// checkCounted 区分计数更新未命中的原因：分享不存在，或次数已达上限
+func (r *PostgresShareRepository) checkCounted(ctx context.Context, token string, result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected > 0 {
+		return nil
+	}
+	var exists bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM share_items WHERE token = $1)`, token).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check share item: %w", err)
+	}
+	if exists {
+		return share.ErrShareExpired
+	}
+	return share.ErrShareNotFound
+}
+
+// ReserveUpload 原子地累加上传用量，条件更新保证并发上传不会越过上限
+func (r *PostgresShareRepository) ReserveUpload(ctx context.Context, token string, size int64, limits share.UploadLimits) error {
+	query := `
+		UPDATE share_items
+		SET uploaded_bytes = uploaded_bytes + $2, uploaded_files = uploaded_files + 1
+		WHERE token = $1
+		  AND ($3 <= 0 OR uploaded_bytes + $2 <= $3)
+		  AND ($4 <= 0 OR uploaded_files + 1 <= $4)
+	`
+	result, err := r.db.ExecContext(ctx, query, token, size, limits.MaxTotalBytes, limits.MaxFiles)
+	if err != nil {
+		return fmt.Errorf("failed to reserve share upload: %w", err)
+	}
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return fmt.Errorf("failed to get rows affected: %w", err)
 	}
 	if rowsAffected == 0 {
-		return share.ErrShareNotFound
+		return share.ErrShareUploadLimit
+	}
+	return nil
+}
+
+// ReleaseUpload 撤销一次未完成的 ReserveUpload
+func (r *PostgresShareRepository) ReleaseUpload(ctx context.Context, token string, size int64) error {
+	query := `
+		UPDATE share_items
+		SET uploaded_bytes = GREATEST(uploaded_bytes - $2, 0), uploaded_files = GREATEST(uploaded_files - 1, 0)
+		WHERE token = $1
+	`
+	if _, err := r.db.ExecContext(ctx, query, token, size); err != nil {
+		return fmt.Errorf("failed to release share upload: %w", err)
 	}
 	return nil
 }
@@ -221,6 +333,25 @@ func (r *PostgresShareRepository) DeletePathsForOwner(ctx context.Context, owner
 	return nil
 }
 
+func encodeShareUploadLimits(limits share.UploadLimits) (string, error) {
+	if limits.MaxFileSize == 0 && limits.MaxTotalBytes == 0 && limits.MaxFiles == 0 && len(limits.AllowedExtensions) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(limits)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode share upload limits: %w", err)
+	}
+	return string(data), nil
+}
+
+func decodeShareUploadLimits(raw string) share.UploadLimits {
+	var limits share.UploadLimits
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &limits)
+	}
+	return limits
+}
+
 func normalizeLoadedShareMode(mode string) string {
 	normalized, err := share.NormalizeMode(mode)
 	if err != nil {
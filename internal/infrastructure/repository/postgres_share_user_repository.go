@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	"github.com/yeying-community/warehouse/internal/domain/shareuser"
 )
@@ -28,6 +29,8 @@ type UserShareRepository interface {
 	GetByTargetID(ctx context.Context, targetID string) ([]*shareuser.ShareUserItem, error)
 	UpdatePathsForOwnerMove(ctx context.Context, ownerID, fromPath, toPath string) error
 	DeleteByID(ctx context.Context, id string) error
+	// UpdateExpiry 同时修改共享与对应 V3 授权的有效期，并清空到期提醒状态
+	UpdateExpiry(ctx context.Context, id string, expiresAt *time.Time) error
 	ListAudiencesByShareID(ctx context.Context, shareID string) ([]UserShareAudience, error)
 }
 
@@ -58,10 +61,8 @@ func (r *PostgresUserShareRepository) CreateWithAudiences(ctx context.Context, i
 	if item == nil {
 		return fmt.Errorf("share item is required")
 	}
+	// 仅含邮箱邀请的分享在邀请生效前没有受众
 	normalizedAudiences := normalizeAudiences(audiences)
-	if len(normalizedAudiences) == 0 {
-		return fmt.Errorf("at least one audience is required")
-	}
 
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -341,6 +342,39 @@ func (r *PostgresUserShareRepository) DeleteByID(ctx context.Context, id string)
 	return nil
 }
 
+func (r *PostgresUserShareRepository) UpdateExpiry(ctx context.Context, id string, expiresAt *time.Time) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE internal_share_items
+		SET expires_at = $2, expiry_reminded_at = NULL, expiry_notified_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'active'
+	`, id, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to update share expiry: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return shareuser.ErrShareNotFound
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE internal_share_grants SET expires_at = $2, updated_at = NOW() WHERE legacy_share_id = $1
+	`, id, expiresAt); err != nil {
+		return fmt.Errorf("failed to update share grant expiry: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit share expiry: %w", err)
+	}
+	return nil
+}
+
 func (r *PostgresUserShareRepository) ListAudiencesByShareID(ctx context.Context, shareID string) ([]UserShareAudience, error) {
 	query := `
 		SELECT a.audience_type, a.target_user_id, a.target_wallet_address, a.source_group_id, COALESCE(g.name, '')
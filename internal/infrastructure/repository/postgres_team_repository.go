@@ -0,0 +1,338 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/domain/team"
+)
+
+// TeamRepository 团队空间仓储
+type TeamRepository interface {
+	// Create 创建团队并写入所有者成员；存储账号需事先创建
+	Create(ctx context.Context, t *team.Team, owner *team.Member) error
+	GetByID(ctx context.Context, teamID string) (*team.Team, error)
+	// ListForUser 返回用户有效参与的团队，以及用户作为分组所有者可管理的团队
+	ListForUser(ctx context.Context, userID string) ([]*team.Team, error)
+	Rename(ctx context.Context, teamID, name string) error
+	// Delete 删除团队存储账号，团队与成员随之级联删除
+	Delete(ctx context.Context, teamID string) error
+
+	// FindRole 返回用户在团队中的有效角色；已不在所属分组的成员视为非成员
+	FindRole(ctx context.Context, teamID, userID string) (string, error)
+	// IsGroupMember 判断用户是否为分组所有者或 active 成员
+	IsGroupMember(ctx context.Context, groupID, userID string) (bool, error)
+	ListMembers(ctx context.Context, teamID string) ([]*team.Member, error)
+	AddMember(ctx context.Context, member *team.Member) error
+	UpdateMemberRole(ctx context.Context, teamID, userID, role string) error
+	RemoveMember(ctx context.Context, teamID, userID string) error
+	// TransferOwnership 原所有者降为 editor，新所有者升为 owner（不是成员时直接加入）
+	TransferOwnership(ctx context.Context, teamID, fromUserID, toUserID string) error
+}
+
+// teamGroupMemberClause 判断 %[1]s 列对应的用户是否仍属于团队所在分组：
+// 分组已删除时保留现有成员，否则要求是分组所有者或 active 成员
+const teamGroupMemberClause = `(
+	t.group_id IS NULL
+	OR g.user_id = %[1]s
+	OR EXISTS (
+		SELECT 1
+		FROM group_members gm
+		JOIN users gu ON LOWER(gu.wallet_address) = LOWER(gm.wallet_address)
+		WHERE gm.group_id = t.group_id AND gm.status = 'active' AND gu.id = %[1]s
+	)
+)`
+
+// PostgresTeamRepository PostgreSQL 实现
+type PostgresTeamRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresTeamRepository 创建团队空间仓储
+func NewPostgresTeamRepository(db *sql.DB) *PostgresTeamRepository {
+	return &PostgresTeamRepository{db: db}
+}
+
+// Create 创建团队并写入所有者成员
+func (r *PostgresTeamRepository) Create(ctx context.Context, t *team.Team, owner *team.Member) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin team transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	teamQuery := `
+		INSERT INTO teams (id, group_id, account_user_id, name, created_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`
+	if _, err := tx.ExecContext(ctx, teamQuery, t.ID, nullString(t.GroupID), t.AccountUserID, t.Name, nullString(t.CreatedBy), t.CreatedAt, t.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to create team: %w", err)
+	}
+	if owner != nil {
+		if err := insertTeamMember(ctx, tx, owner); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit team transaction: %w", err)
+	}
+	return nil
+}
+
+// GetByID 根据 ID 获取团队，附带分组信息与存储账号的配额
+func (r *PostgresTeamRepository) GetByID(ctx context.Context, teamID string) (*team.Team, error) {
+	query := `
+		SELECT t.id, COALESCE(t.group_id, ''), COALESCE(g.name, ''), COALESCE(g.user_id, ''),
+			t.account_user_id, t.name, COALESCE(t.created_by, ''), '',
+			a.quota, a.used_space, t.created_at, t.updated_at
+		FROM teams t
+		JOIN users a ON a.id = t.account_user_id
+		LEFT JOIN address_groups g ON g.id = t.group_id
+		WHERE t.id = $1
+	`
+	item, err := scanTeam(r.db.QueryRowContext(ctx, query, teamID))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, team.ErrTeamNotFound
+		}
+		return nil, fmt.Errorf("failed to get team: %w", err)
+	}
+	return item, nil
+}
+
+// ListForUser 列出用户可见的团队
+func (r *PostgresTeamRepository) ListForUser(ctx context.Context, userID string) ([]*team.Team, error) {
+	query := fmt.Sprintf(`
+		SELECT t.id, COALESCE(t.group_id, ''), COALESCE(g.name, ''), COALESCE(g.user_id, ''),
+			t.account_user_id, t.name, COALESCE(t.created_by, ''),
+			CASE WHEN tm.user_id IS NOT NULL AND %s THEN tm.role ELSE '' END,
+			a.quota, a.used_space, t.created_at, t.updated_at
+		FROM teams t
+		JOIN users a ON a.id = t.account_user_id
+		LEFT JOIN address_groups g ON g.id = t.group_id
+		LEFT JOIN team_members tm ON tm.team_id = t.id AND tm.user_id = $1
+		WHERE g.user_id = $1 OR (tm.user_id IS NOT NULL AND %s)
+		ORDER BY t.created_at DESC
+	`, fmt.Sprintf(teamGroupMemberClause, "tm.user_id"), fmt.Sprintf(teamGroupMemberClause, "tm.user_id"))
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query teams: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*team.Team
+	for rows.Next() {
+		item, err := scanTeam(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan team: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate teams: %w", err)
+	}
+	return items, nil
+}
+
+// Rename 修改团队名称
+func (r *PostgresTeamRepository) Rename(ctx context.Context, teamID, name string) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE teams SET name = $2, updated_at = $3 WHERE id = $1`, teamID, name, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to rename team: %w", err)
+	}
+	return requireTeamRowAffected(result, team.ErrTeamNotFound)
+}
+
+// Delete 删除团队存储账号
+func (r *PostgresTeamRepository) Delete(ctx context.Context, teamID string) error {
+	query := `DELETE FROM users WHERE id = (SELECT account_user_id FROM teams WHERE id = $1)`
+	result, err := r.db.ExecContext(ctx, query, teamID)
+	if err != nil {
+		return fmt.Errorf("failed to delete team: %w", err)
+	}
+	return requireTeamRowAffected(result, team.ErrTeamNotFound)
+}
+
+// FindRole 查询用户在团队中的有效角色
+func (r *PostgresTeamRepository) FindRole(ctx context.Context, teamID, userID string) (string, error) {
+	query := fmt.Sprintf(`
+		SELECT tm.role
+		FROM team_members tm
+		JOIN teams t ON t.id = tm.team_id
+		LEFT JOIN address_groups g ON g.id = t.group_id
+		WHERE tm.team_id = $1 AND tm.user_id = $2 AND %s
+	`, fmt.Sprintf(teamGroupMemberClause, "tm.user_id"))
+	var role string
+	if err := r.db.QueryRowContext(ctx, query, teamID, userID).Scan(&role); err != nil {
+		if err == sql.ErrNoRows {
+			return "", team.ErrMemberNotFound
+		}
+		return "", fmt.Errorf("failed to query team role: %w", err)
+	}
+	return role, nil
+}
+
+// IsGroupMember 判断用户是否属于分组
+func (r *PostgresTeamRepository) IsGroupMember(ctx context.Context, groupID, userID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM address_groups g WHERE g.id = $1 AND g.user_id = $2
+		) OR EXISTS (
+			SELECT 1
+			FROM group_members gm
+			JOIN users gu ON LOWER(gu.wallet_address) = LOWER(gm.wallet_address)
+			WHERE gm.group_id = $1 AND gm.status = 'active' AND gu.id = $2
+		)
+	`
+	var ok bool
+	if err := r.db.QueryRowContext(ctx, query, groupID, userID).Scan(&ok); err != nil {
+		return false, fmt.Errorf("failed to query group membership: %w", err)
+	}
+	return ok, nil
+}
+
+// ListMembers 列出团队成员，所有者排在最前
+func (r *PostgresTeamRepository) ListMembers(ctx context.Context, teamID string) ([]*team.Member, error) {
+	query := `
+		SELECT tm.team_id, tm.user_id, u.username, COALESCE(u.wallet_address, ''), tm.role, tm.created_at, tm.updated_at
+		FROM team_members tm
+		JOIN users u ON u.id = tm.user_id
+		WHERE tm.team_id = $1
+		ORDER BY CASE tm.role WHEN 'owner' THEN 0 WHEN 'editor' THEN 1 ELSE 2 END, tm.created_at ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query team members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*team.Member
+	for rows.Next() {
+		member := &team.Member{}
+		if err := rows.Scan(&member.TeamID, &member.UserID, &member.Username, &member.WalletAddress, &member.Role, &member.CreatedAt, &member.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan team member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate team members: %w", err)
+	}
+	return members, nil
+}
+
+// AddMember 添加团队成员
+func (r *PostgresTeamRepository) AddMember(ctx context.Context, member *team.Member) error {
+	return insertTeamMember(ctx, r.db, member)
+}
+
+// UpdateMemberRole 修改成员角色（不用于转让所有权）
+func (r *PostgresTeamRepository) UpdateMemberRole(ctx context.Context, teamID, userID, role string) error {
+	query := `UPDATE team_members SET role = $3, updated_at = $4 WHERE team_id = $1 AND user_id = $2 AND role <> 'owner'`
+	result, err := r.db.ExecContext(ctx, query, teamID, userID, role, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update team member: %w", err)
+	}
+	return requireTeamRowAffected(result, team.ErrMemberNotFound)
+}
+
+// RemoveMember 移除团队成员；所有者需先转让
+func (r *PostgresTeamRepository) RemoveMember(ctx context.Context, teamID, userID string) error {
+	query := `DELETE FROM team_members WHERE team_id = $1 AND user_id = $2 AND role <> 'owner'`
+	result, err := r.db.ExecContext(ctx, query, teamID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove team member: %w", err)
+	}
+	return requireTeamRowAffected(result, team.ErrMemberNotFound)
+}
+
+// TransferOwnership 转让团队所有权
+func (r *PostgresTeamRepository) TransferOwnership(ctx context.Context, teamID, fromUserID, toUserID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin team transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	result, err := tx.ExecContext(ctx,
+		`UPDATE team_members SET role = $3, updated_at = $4 WHERE team_id = $1 AND user_id = $2 AND role = 'owner'`,
+		teamID, fromUserID, team.RoleEditor, now)
+	if err != nil {
+		return fmt.Errorf("failed to demote team owner: %w", err)
+	}
+	if err := requireTeamRowAffected(result, team.ErrMemberNotFound); err != nil {
+		return err
+	}
+	upsert := `
+		INSERT INTO team_members (team_id, user_id, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $4)
+		ON CONFLICT (team_id, user_id) DO UPDATE SET role = EXCLUDED.role, updated_at = EXCLUDED.updated_at
+	`
+	if _, err := tx.ExecContext(ctx, upsert, teamID, toUserID, team.RoleOwner, now); err != nil {
+		return fmt.Errorf("failed to promote team owner: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE teams SET updated_at = $2 WHERE id = $1`, teamID, now); err != nil {
+		return fmt.Errorf("failed to update team: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit team transaction: %w", err)
+	}
+	return nil
+}
+
+type teamExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertTeamMember(ctx context.Context, exec teamExecer, member *team.Member) error {
+	query := `
+		INSERT INTO team_members (team_id, user_id, role, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	if _, err := exec.ExecContext(ctx, query, member.TeamID, member.UserID, member.Role, member.CreatedAt, member.UpdatedAt); err != nil {
+		if strings.Contains(err.Error(), "team_members_pkey") {
+			return team.ErrDuplicateMember
+		}
+		return fmt.Errorf("failed to add team member: %w", err)
+	}
+	return nil
+}
+
+type teamScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTeam(row teamScanner) (*team.Team, error) {
+	item := &team.Team{}
+	if err := row.Scan(
+		&item.ID,
+		&item.GroupID,
+		&item.GroupName,
+		&item.GroupOwnerID,
+		&item.AccountUserID,
+		&item.Name,
+		&item.CreatedBy,
+		&item.Role,
+		&item.Quota,
+		&item.UsedSpace,
+		&item.CreatedAt,
+		&item.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func requireTeamRowAffected(result sql.Result, notFound error) error {
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return notFound
+	}
+	return nil
+}
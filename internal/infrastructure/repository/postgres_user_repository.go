@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"strings"
 
@@ -24,7 +25,8 @@ func NewPostgresUserRepository(db *database.PostgresDB) (*PostgresUserRepository
 func (r *PostgresUserRepository) FindByUsername(ctx context.Context, username string) (*user.User, error) {
 	query := `
 		SELECT id, username, password, wallet_address, email, directory, permissions,
-		       quota, used_space, created_at, updated_at
+		       quota, used_space, upload_policy, recycle_retention_days, volume, volume_moving,
+		       created_at, updated_at
 		FROM users
 		WHERE username = $1
 	`
@@ -34,6 +36,7 @@ func (r *PostgresUserRepository) FindByUsername(ctx context.Context, username st
 	var password sql.NullString
 	var email sql.NullString
 	var permissionsStr string
+	var uploadPolicy sql.NullString
 
 	err := r.db.DB.QueryRowContext(ctx, query, username).Scan(
 		&u.ID,
@@ -45,6 +48,10 @@ func (r *PostgresUserRepository) FindByUsername(ctx context.Context, username st
 		&permissionsStr,
 		&u.Quota,
 		&u.UsedSpace,
+		&uploadPolicy,
+		&u.RecycleRetentionDays,
+		&u.Volume,
+		&u.VolumeMoving,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -60,6 +67,7 @@ func (r *PostgresUserRepository) FindByUsername(ctx context.Context, username st
 	u.WalletAddress = walletAddress.String
 	u.Email = email.String
 	u.Permissions = user.ParsePermissions(permissionsStr)
+	u.UploadPolicy = decodeUploadPolicy(uploadPolicy)
 
 	// 加载用户规则
 	rules, err := r.loadUserRules(ctx, u.ID)
@@ -75,7 +83,8 @@ func (r *PostgresUserRepository) FindByUsername(ctx context.Context, username st
 func (r *PostgresUserRepository) FindByWalletAddress(ctx context.Context, address string) (*user.User, error) {
 	query := `
 		SELECT id, username, password, wallet_address, email, directory, permissions,
-		       quota, used_space, created_at, updated_at
+		       quota, used_space, upload_policy, recycle_retention_days, volume, volume_moving,
+		       created_at, updated_at
 		FROM users
 		WHERE LOWER(wallet_address) = LOWER($1)
 	`
@@ -85,6 +94,7 @@ func (r *PostgresUserRepository) FindByWalletAddress(ctx context.Context, addres
 	var password sql.NullString
 	var email sql.NullString
 	var permissionsStr string
+	var uploadPolicy sql.NullString
 
 	err := r.db.DB.QueryRowContext(ctx, query, address).Scan(
 		&u.ID,
@@ -96,6 +106,10 @@ func (r *PostgresUserRepository) FindByWalletAddress(ctx context.Context, addres
 		&permissionsStr,
 		&u.Quota,
 		&u.UsedSpace,
+		&uploadPolicy,
+		&u.RecycleRetentionDays,
+		&u.Volume,
+		&u.VolumeMoving,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -112,6 +126,7 @@ func (r *PostgresUserRepository) FindByWalletAddress(ctx context.Context, addres
 	u.WalletAddress = walletAddress.String
 	u.Email = email.String
 	u.Permissions = user.ParsePermissions(permissionsStr)
+	u.UploadPolicy = decodeUploadPolicy(uploadPolicy)
 
 	// 加载用户规则
 	rules, err := r.loadUserRules(ctx, u.ID)
@@ -127,7 +142,8 @@ func (r *PostgresUserRepository) FindByWalletAddress(ctx context.Context, addres
 func (r *PostgresUserRepository) FindByEmail(ctx context.Context, emailAddress string) (*user.User, error) {
 	query := `
 		SELECT id, username, password, wallet_address, email, directory, permissions,
-		       quota, used_space, created_at, updated_at
+		       quota, used_space, upload_policy, recycle_retention_days, volume, volume_moving,
+		       created_at, updated_at
 		FROM users
 		WHERE LOWER(email) = LOWER($1)
 	`
@@ -137,6 +153,7 @@ func (r *PostgresUserRepository) FindByEmail(ctx context.Context, emailAddress s
 	var password sql.NullString
 	var email sql.NullString
 	var permissionsStr string
+	var uploadPolicy sql.NullString
 
 	err := r.db.DB.QueryRowContext(ctx, query, emailAddress).Scan(
 		&u.ID,
@@ -148,6 +165,10 @@ func (r *PostgresUserRepository) FindByEmail(ctx context.Context, emailAddress s
 		&permissionsStr,
 		&u.Quota,
 		&u.UsedSpace,
+		&uploadPolicy,
+		&u.RecycleRetentionDays,
+		&u.Volume,
+		&u.VolumeMoving,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -163,6 +184,7 @@ func (r *PostgresUserRepository) FindByEmail(ctx context.Context, emailAddress s
 	u.WalletAddress = walletAddress.String
 	u.Email = email.String
 	u.Permissions = user.ParsePermissions(permissionsStr)
+	u.UploadPolicy = decodeUploadPolicy(uploadPolicy)
 
 	rules, err := r.loadUserRules(ctx, u.ID)
 	if err != nil {
@@ -177,7 +199,8 @@ func (r *PostgresUserRepository) FindByEmail(ctx context.Context, emailAddress s
 func (r *PostgresUserRepository) FindByID(ctx context.Context, id string) (*user.User, error) {
 	query := `
 		SELECT id, username, password, wallet_address, email, directory, permissions,
-		       quota, used_space, created_at, updated_at
+		       quota, used_space, upload_policy, recycle_retention_days, volume, volume_moving,
+		       created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
@@ -187,6 +210,7 @@ func (r *PostgresUserRepository) FindByID(ctx context.Context, id string) (*user
 	var password sql.NullString
 	var email sql.NullString
 	var permissionsStr string
+	var uploadPolicy sql.NullString
 
 	err := r.db.DB.QueryRowContext(ctx, query, id).Scan(
 		&u.ID,
@@ -198,6 +222,10 @@ func (r *PostgresUserRepository) FindByID(ctx context.Context, id string) (*user
 		&permissionsStr,
 		&u.Quota,
 		&u.UsedSpace,
+		&uploadPolicy,
+		&u.RecycleRetentionDays,
+		&u.Volume,
+		&u.VolumeMoving,
 		&u.CreatedAt,
 		&u.UpdatedAt,
 	)
@@ -213,6 +241,7 @@ func (r *PostgresUserRepository) FindByID(ctx context.Context, id string) (*user
 	u.WalletAddress = walletAddress.String
 	u.Email = email.String
 	u.Permissions = user.ParsePermissions(permissionsStr)
+	u.UploadPolicy = decodeUploadPolicy(uploadPolicy)
 
 	// 加载用户规则
 	rules, err := r.loadUserRules(ctx, u.ID)
@@ -254,13 +283,19 @@ func (r *PostgresUserRepository) Save(ctx context.Context, u *user.User) error {
 		password = &u.Password
 	}
 
+	uploadPolicy, err := encodeUploadPolicy(u.UploadPolicy)
+	if err != nil {
+		return err
+	}
+
 	if exists {
 		// 更新用户
 		query := `
 			UPDATE users
 			SET username = $1, password = $2, wallet_address = $3, email = $4, directory = $5,
-			    permissions = $6, quota = $7, used_space = $8
-			WHERE id = $9
+			    permissions = $6, quota = $7, used_space = $8, upload_policy = $9,
+			    recycle_retention_days = $10
+			WHERE id = $11
 		`
 		_, err = tx.ExecContext(ctx, query,
 			u.Username,
@@ -271,13 +306,15 @@ func (r *PostgresUserRepository) Save(ctx context.Context, u *user.User) error {
 			u.Permissions.String(),
 			u.Quota,
 			u.UsedSpace,
+			uploadPolicy,
+			u.RecycleRetentionDays,
 			u.ID,
 		)
 	} else {
 		// 插入新用户
 		query := `
-			INSERT INTO users (id, username, password, wallet_address, email, directory, permissions, quota, used_space, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			INSERT INTO users (id, username, password, wallet_address, email, directory, permissions, quota, used_space, upload_policy, recycle_retention_days, volume, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		`
 		_, err = tx.ExecContext(ctx, query,
 			u.ID,
@@ -289,6 +326,9 @@ func (r *PostgresUserRepository) Save(ctx context.Context, u *user.User) error {
 			u.Permissions.String(),
 			u.Quota,
 			u.UsedSpace,
+			uploadPolicy,
+			u.RecycleRetentionDays,
+			u.Volume,
 			u.CreatedAt,
 			u.UpdatedAt,
 		)
@@ -319,10 +359,14 @@ func (r *PostgresUserRepository) Save(ctx context.Context, u *user.User) error {
 	if len(u.Rules) > 0 {
 		for _, rule := range u.Rules {
 			query := `
-				INSERT INTO user_rules (user_id, path, permissions, regex)
-				VALUES ($1, $2, $3, $4)
+				INSERT INTO user_rules (user_id, path, permissions, regex, upload_policy)
+				VALUES ($1, $2, $3, $4, $5)
 			`
-			_, err = tx.ExecContext(ctx, query, u.ID, rule.Path, rule.Permissions.String(), rule.Regex)
+			rulePolicy, err := encodeUploadPolicy(rule.UploadPolicy)
+			if err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, query, u.ID, rule.Path, rule.Permissions.String(), rule.Regex, rulePolicy)
 			if err != nil {
 				return fmt.Errorf("failed to insert rule: %w", err)
 			}
@@ -360,7 +404,8 @@ func (r *PostgresUserRepository) Delete(ctx context.Context, username string) er
 func (r *PostgresUserRepository) List(ctx context.Context) ([]*user.User, error) {
 	query := `
 		SELECT id, username, password, wallet_address, email, directory, permissions,
-		       quota, used_space, created_at, updated_at
+		       quota, used_space, upload_policy, recycle_retention_days, volume, volume_moving,
+		       created_at, updated_at
 		FROM users
 		ORDER BY created_at DESC
 	`
@@ -379,6 +424,7 @@ func (r *PostgresUserRepository) List(ctx context.Context) ([]*user.User, error)
 		var password sql.NullString
 		var email sql.NullString
 		var permissionsStr string
+		var uploadPolicy sql.NullString
 
 		err := rows.Scan(
 			&u.ID,
@@ -390,6 +436,10 @@ func (r *PostgresUserRepository) List(ctx context.Context) ([]*user.User, error)
 			&permissionsStr,
 			&u.Quota,
 			&u.UsedSpace,
+			&uploadPolicy,
+			&u.RecycleRetentionDays,
+			&u.Volume,
+			&u.VolumeMoving,
 			&u.CreatedAt,
 			&u.UpdatedAt,
 		)
@@ -401,6 +451,7 @@ func (r *PostgresUserRepository) List(ctx context.Context) ([]*user.User, error)
 		u.WalletAddress = walletAddress.String
 		u.Email = email.String
 		u.Permissions = user.ParsePermissions(permissionsStr)
+		u.UploadPolicy = decodeUploadPolicy(uploadPolicy)
 
 		// 加载用户规则
 		rules, err := r.loadUserRules(ctx, u.ID)
@@ -483,6 +534,27 @@ func (r *PostgresUserRepository) ReleaseUsedSpaceDelta(ctx context.Context, user
 	return err
 }
 
+// UpdateVolume 更新用户目录所在卷与迁移状态；Save 不会改动这两列，避免覆盖迁移中的状态
+func (r *PostgresUserRepository) UpdateVolume(ctx context.Context, username, volume string, moving bool) error {
+	query := `
+		UPDATE users
+		SET volume = $1, volume_moving = $2
+		WHERE username = $3
+	`
+	result, err := r.db.DB.ExecContext(ctx, query, volume, moving, username)
+	if err != nil {
+		return fmt.Errorf("failed to update volume: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rows == 0 {
+		return user.ErrUserNotFound
+	}
+	return nil
+}
+
 // UpdateQuota 更新用户配额
 func (r *PostgresUserRepository) UpdateQuota(ctx context.Context, username string, quota int64) error {
 	query := "UPDATE users SET quota = $1 WHERE username = $2"
@@ -505,7 +577,7 @@ func (r *PostgresUserRepository) UpdateQuota(ctx context.Context, username strin
 
 // loadUserRules 加载用户规则
 func (r *PostgresUserRepository) loadUserRules(ctx context.Context, userID string) ([]*user.Rule, error) {
-	query := "SELECT path, permissions, regex FROM user_rules WHERE user_id = $1 ORDER BY id"
+	query := "SELECT path, permissions, regex, upload_policy FROM user_rules WHERE user_id = $1 ORDER BY id"
 
 	rows, err := r.db.DB.QueryContext(ctx, query, userID)
 	if err != nil {
@@ -517,13 +589,15 @@ func (r *PostgresUserRepository) loadUserRules(ctx context.Context, userID strin
 	for rows.Next() {
 		rule := &user.Rule{}
 		var permissionsStr string
+		var uploadPolicy sql.NullString
 
-		err := rows.Scan(&rule.Path, &permissionsStr, &rule.Regex)
+		err := rows.Scan(&rule.Path, &permissionsStr, &rule.Regex, &uploadPolicy)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan rule: %w", err)
 		}
 
 		rule.Permissions = user.ParsePermissions(permissionsStr)
+		rule.UploadPolicy = decodeUploadPolicy(uploadPolicy)
 		rules = append(rules, rule)
 	}
 
@@ -533,3 +607,27 @@ func (r *PostgresUserRepository) loadUserRules(ctx context.Context, userID strin
 
 	return rules, nil
 }
+
+// encodeUploadPolicy 将上传策略序列化为 JSONB，未设置时写入 NULL
+func encodeUploadPolicy(policy *user.UploadPolicy) (any, error) {
+	if policy.IsZero() {
+		return nil, nil
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode upload policy: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeUploadPolicy 解析 JSONB 上传策略，无法解析时视为未设置
+func decodeUploadPolicy(raw sql.NullString) *user.UploadPolicy {
+	if !raw.Valid {
+		return nil
+	}
+	policy, err := user.ParseUploadPolicy(raw.String)
+	if err != nil {
+		return nil
+	}
+	return policy
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package storage
+
+import "errors"
+
+// DiskUsage is not available here; placement then relies on the configured
+// capacities only.
+func DiskUsage(string) (total, free int64, err error) {
+	return 0, 0, errors.ErrUnsupported
+}
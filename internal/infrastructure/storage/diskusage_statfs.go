@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package storage
+
+import "syscall"
+
+// DiskUsage reports the size of the filesystem holding path and the space
+// still available to unprivileged users.
+func DiskUsage(path string) (total, free int64, err error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Blocks) * int64(st.Bsize), int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/atomicfile"
+	"github.com/yeying-community/warehouse/internal/infrastructure/blobstore"
+)
+
+// Local stores files on the host filesystem.
+type Local struct{}
+
+// NewLocal returns the host filesystem backend.
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (*Local) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (*Local) Lstat(name string) (fs.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (*Local) Open(name string) (File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (*Local) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	f, err := os.OpenFile(name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (l *Local) ReadRange(name string, offset, length int64) (io.ReadCloser, error) {
+	return readRange(l, name, offset, length)
+}
+
+func (*Local) CreateAtomic(name string, perm fs.FileMode) (AtomicFile, error) {
+	f, err := atomicfile.Open(name, perm)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Rename moves oldName to newName. Volumes may sit on different filesystems,
+// so a cross-device rename falls back to copying the tree and removing the
+// source; that fallback is not atomic.
+func (*Local) Rename(oldName, newName string) error {
+	err := os.Rename(oldName, newName)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if _, statErr := os.Lstat(newName); statErr == nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrExist}
+	}
+	if err := CopyTree(oldName, newName); err != nil {
+		_ = os.RemoveAll(newName)
+		return err
+	}
+	return os.RemoveAll(oldName)
+}
+
+func (*Local) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (*Local) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (*Local) MkdirAll(name string, perm fs.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (*Local) Chtimes(name string, atime, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (*Local) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (*Local) WalkDir(root string, fn fs.WalkDirFunc) error {
+	return filepath.WalkDir(root, fn)
+}
+
+// Detach breaks the hard links the dedup store shares between files.
+func (*Local) Detach(name string) error {
+	return blobstore.Detach(name)
+}
+
+// CopyTree copies a file or directory tree from src to dst on the host
+// filesystem, keeping permission bits and file modification times. Files are
+// written through a temporary name so a reader never sees a partial copy.
+func CopyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case info.Mode().IsRegular():
+			if err := copyRegularFile(p, target, info); err != nil {
+				return err
+			}
+		default:
+			// Symlinks and special files are not part of user trees.
+			return nil
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+}
+
+// SyncStats counts what one SyncTree pass did.
+type SyncStats struct {
+	Files   int64
+	Bytes   int64
+	Copied  int64
+	Removed int64
+}
+
+// SyncTree makes dst an exact copy of the src tree: files whose size or
+// modification time differ are copied again and entries missing from src are
+// removed. Repeated passes converge while src keeps changing slowly.
+func SyncTree(src, dst string) (SyncStats, error) {
+	var stats SyncStats
+	err := filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p != src {
+				// Removed while walking; the next pass drops it from dst.
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		existing, existingErr := os.Lstat(target)
+		if d.IsDir() {
+			if existingErr == nil && !existing.IsDir() {
+				if err := os.Remove(target); err != nil {
+					return err
+				}
+			}
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		stats.Files++
+		stats.Bytes += info.Size()
+		if existingErr == nil {
+			if existing.Mode().IsRegular() && existing.Size() == info.Size() && existing.ModTime().Equal(info.ModTime()) {
+				return nil
+			}
+			if existing.IsDir() {
+				if err := os.RemoveAll(target); err != nil {
+					return err
+				}
+			}
+		}
+		if err := copyRegularFile(p, target, info); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		stats.Copied++
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	})
+	if err != nil {
+		return stats, err
+	}
+	err = filepath.WalkDir(dst, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dst, p)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(src, rel)); !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		stats.Removed++
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return stats, err
+}
+
+func copyRegularFile(src, dst string, info fs.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := atomicfile.Open(dst, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Abort()
+		return err
+	}
+	return out.Close()
+}
+
+var _ Backend = (*Local)(nil)
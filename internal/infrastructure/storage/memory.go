@@ -0,0 +1,548 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	errIsDir       = errors.New("is a directory")
+	errNotDir      = errors.New("not a directory")
+	errNotEmpty    = errors.New("directory not empty")
+	errBadDescript = errors.New("bad file descriptor")
+)
+
+// Memory keeps files in process memory. It is meant for tests and has no
+// size limit; names are cleaned with filepath.Clean and need not exist on
+// the host.
+type Memory struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode
+}
+
+type memNode struct {
+	dir     bool
+	mode    fs.FileMode
+	modTime time.Time
+	data    []byte
+}
+
+// NewMemory returns an empty in-memory backend.
+func NewMemory() *Memory {
+	return &Memory{nodes: make(map[string]*memNode)}
+}
+
+func (m *Memory) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name = filepath.Clean(name)
+	node, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return node.info(name), nil
+}
+
+func (m *Memory) Lstat(name string) (fs.FileInfo, error) {
+	return m.Stat(name)
+}
+
+func (m *Memory) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (m *Memory) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+	node, err := m.lookup("open", name)
+	switch {
+	case err == nil:
+		if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+		}
+		if node.dir && writable {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+		}
+		if writable && flag&os.O_TRUNC != 0 {
+			node.data = nil
+			node.modTime = time.Now()
+		}
+	case errors.Is(err, fs.ErrNotExist) && flag&os.O_CREATE != 0:
+		if err := m.checkParent("open", name); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: time.Now()}
+		m.nodes[name] = node
+	default:
+		return nil, err
+	}
+	return &memFile{mem: m, name: name, node: node, flag: flag}, nil
+}
+
+func (m *Memory) ReadRange(name string, offset, length int64) (io.ReadCloser, error) {
+	return readRange(m, name, offset, length)
+}
+
+func (m *Memory) CreateAtomic(name string, perm fs.FileMode) (AtomicFile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	name = filepath.Clean(name)
+	if err := m.checkParent("open", name); err != nil {
+		return nil, err
+	}
+	node := &memNode{mode: perm.Perm(), modTime: time.Now()}
+	return &memAtomicFile{memFile: memFile{mem: m, name: name, node: node, flag: os.O_RDWR}}, nil
+}
+
+func (m *Memory) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldName = filepath.Clean(oldName)
+	newName = filepath.Clean(newName)
+	node, err := m.lookup("rename", oldName)
+	if err != nil {
+		return err
+	}
+	if isRoot(oldName) || strings.HasPrefix(newName, oldName+string(filepath.Separator)) {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: fs.ErrInvalid}
+	}
+	if oldName == newName {
+		return nil
+	}
+	if err := m.checkParent("rename", newName); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: errors.Unwrap(err)}
+	}
+	if target, ok := m.nodes[newName]; ok {
+		switch {
+		case node.dir && !target.dir:
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: errNotDir}
+		case !node.dir && target.dir:
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: errIsDir}
+		case target.dir && m.hasChildren(newName):
+			return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: errNotEmpty}
+		}
+	}
+	prefix := oldName + string(filepath.Separator)
+	for key, child := range m.nodes {
+		if strings.HasPrefix(key, prefix) {
+			delete(m.nodes, key)
+			m.nodes[filepath.Join(newName, strings.TrimPrefix(key, prefix))] = child
+		}
+	}
+	delete(m.nodes, oldName)
+	m.nodes[newName] = node
+	return nil
+}
+
+func (m *Memory) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	node, err := m.lookup("remove", name)
+	if err != nil {
+		return err
+	}
+	if isRoot(name) || (node.dir && m.hasChildren(name)) {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *Memory) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	prefix := name + string(filepath.Separator)
+	if isRoot(name) {
+		prefix = name
+	}
+	for key := range m.nodes {
+		if key == name || strings.HasPrefix(key, prefix) {
+			delete(m.nodes, key)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) MkdirAll(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	var missing []string
+	for current := name; !isRoot(current); current = filepath.Dir(current) {
+		node, ok := m.nodes[current]
+		if ok {
+			if !node.dir {
+				return &fs.PathError{Op: "mkdir", Path: current, Err: errNotDir}
+			}
+			break
+		}
+		missing = append(missing, current)
+	}
+	now := time.Now()
+	for i := len(missing) - 1; i >= 0; i-- {
+		m.nodes[missing[i]] = &memNode{dir: true, mode: fs.ModeDir | perm.Perm(), modTime: now}
+	}
+	return nil
+}
+
+func (m *Memory) Chtimes(name string, _, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	node, err := m.lookup("chtimes", name)
+	if err != nil {
+		return err
+	}
+	if !isRoot(name) {
+		node.modTime = mtime
+	}
+	return nil
+}
+
+func (m *Memory) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	infos, err := m.readDirLocked("readdir", filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]fs.DirEntry, 0, len(infos))
+	for _, info := range infos {
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+func (m *Memory) WalkDir(root string, fn fs.WalkDirFunc) error {
+	info, err := m.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = m.walkDir(root, fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+func (m *Memory) walkDir(path string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(path, d, nil); err != nil || !d.IsDir() {
+		if err == filepath.SkipDir && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+	entries, err := m.ReadDir(path)
+	if err != nil {
+		err = fn(path, d, err)
+		if err != nil {
+			if err == filepath.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+	for _, entry := range entries {
+		if err := m.walkDir(filepath.Join(path, entry.Name()), entry, fn); err != nil {
+			if err == filepath.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup must be called with mu held.
+func (m *Memory) lookup(op, name string) (*memNode, error) {
+	if isRoot(name) {
+		return &memNode{dir: true, mode: fs.ModeDir | 0o755}, nil
+	}
+	node, ok := m.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return node, nil
+}
+
+// checkParent must be called with mu held.
+func (m *Memory) checkParent(op, name string) error {
+	parent, err := m.lookup(op, filepath.Dir(name))
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.dir {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+// hasChildren must be called with mu held.
+func (m *Memory) hasChildren(name string) bool {
+	prefix := name + string(filepath.Separator)
+	for key := range m.nodes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDirLocked must be called with mu held.
+func (m *Memory) readDirLocked(op, name string) ([]fs.FileInfo, error) {
+	node, err := m.lookup(op, name)
+	if err != nil {
+		return nil, err
+	}
+	if !node.dir {
+		return nil, &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	var infos []fs.FileInfo
+	for key, child := range m.nodes {
+		if key != name && filepath.Dir(key) == name {
+			infos = append(infos, child.info(key))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func isRoot(name string) bool {
+	return filepath.Dir(name) == name
+}
+
+func (n *memNode) info(name string) fs.FileInfo {
+	return memInfo{
+		name:    filepath.Base(name),
+		size:    int64(len(n.data)),
+		mode:    n.mode,
+		modTime: n.modTime,
+		dir:     n.dir,
+	}
+}
+
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	dir     bool
+}
+
+func (info memInfo) Name() string       { return info.name }
+func (info memInfo) Size() int64        { return info.size }
+func (info memInfo) Mode() fs.FileMode  { return info.mode }
+func (info memInfo) ModTime() time.Time { return info.modTime }
+func (info memInfo) IsDir() bool        { return info.dir }
+func (info memInfo) Sys() any           { return nil }
+
+type memFile struct {
+	mem       *Memory
+	name      string
+	node      *memNode
+	flag      int
+	offset    int64
+	dirOffset int
+	closed    bool
+}
+
+func (f *memFile) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.mem.mu.RLock()
+	defer f.mem.mu.RUnlock()
+	if f.node.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: errIsDir}
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if f.flag&os.O_APPEND != 0 {
+		f.mem.mu.RLock()
+		f.offset = int64(len(f.node.data))
+		f.mem.mu.RUnlock()
+	}
+	n, err := f.WriteAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	end := off + int64(len(p))
+	if end > int64(len(f.node.data)) {
+		grown := make([]byte, end)
+		copy(grown, f.node.data)
+		f.node.data = grown
+	}
+	copy(f.node.data[off:], p)
+	f.node.modTime = time.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek", false); err != nil {
+		return 0, err
+	}
+	f.mem.mu.RLock()
+	size := int64(len(f.node.data))
+	f.mem.mu.RUnlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+func (f *memFile) Readdir(count int) ([]fs.FileInfo, error) {
+	if err := f.check("readdir", false); err != nil {
+		return nil, err
+	}
+	f.mem.mu.RLock()
+	infos, err := f.mem.readDirLocked("readdir", f.name)
+	f.mem.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if f.dirOffset >= len(infos) {
+		infos = nil
+	} else {
+		infos = infos[f.dirOffset:]
+	}
+	if count <= 0 {
+		f.dirOffset += len(infos)
+		return infos, nil
+	}
+	if len(infos) == 0 {
+		return nil, io.EOF
+	}
+	if len(infos) > count {
+		infos = infos[:count]
+	}
+	f.dirOffset += len(infos)
+	return infos, nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.mem.mu.RLock()
+	defer f.mem.mu.RUnlock()
+	return f.node.info(f.name), nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	data := make([]byte, size)
+	copy(data, f.node.data)
+	f.node.data = data
+	f.node.modTime = time.Now()
+	return nil
+}
+
+func (f *memFile) Sync() error {
+	return f.check("sync", false)
+}
+
+func (f *memFile) check(op string, write bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	writable := f.flag&(os.O_WRONLY|os.O_RDWR) != 0
+	readable := f.flag&os.O_WRONLY == 0
+	if (write && !writable) || (!write && op != "seek" && op != "sync" && !readable) {
+		return &fs.PathError{Op: op, Path: f.name, Err: errBadDescript}
+	}
+	return nil
+}
+
+// memAtomicFile buffers a detached node and links it into the tree on Close.
+type memAtomicFile struct {
+	memFile
+}
+
+func (f *memAtomicFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.mem.mu.Lock()
+	defer f.mem.mu.Unlock()
+	if err := f.mem.checkParent("rename", f.name); err != nil {
+		return err
+	}
+	if existing, ok := f.mem.nodes[f.name]; ok && existing.dir {
+		return &fs.PathError{Op: "rename", Path: f.name, Err: errIsDir}
+	}
+	f.node.modTime = time.Now()
+	f.mem.nodes[f.name] = f.node
+	return nil
+}
+
+func (f *memAtomicFile) Abort() {
+	f.closed = true
+}
+
+var _ Backend = (*Memory)(nil)
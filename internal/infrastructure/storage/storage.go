@@ -0,0 +1,152 @@
+// Package storage abstracts where warehouse keeps file contents.
+//
+// Names passed to a Backend are the paths services already build from
+// webdav.directory. The local backend maps them 1:1 onto the host
+// filesystem; other backends treat them as keys in their own namespace.
+// Errors follow the os conventions (*fs.PathError wrapping fs.ErrNotExist,
+// fs.ErrExist, ...), so callers keep using os.IsNotExist and errors.Is.
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// Backend is the set of file operations services need.
+type Backend interface {
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	Open(name string) (File, error)
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+	// ReadRange returns length bytes starting at offset; a negative length
+	// reads to the end of the file.
+	ReadRange(name string, offset, length int64) (io.ReadCloser, error)
+	// CreateAtomic returns a writer whose content replaces name only when it
+	// is closed successfully.
+	CreateAtomic(name string, perm fs.FileMode) (AtomicFile, error)
+	Rename(oldName, newName string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Chtimes(name string, atime, mtime time.Time) error
+	// ReadDir returns the entries of a directory sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+	// WalkDir walks the tree rooted at root in lexical order, like
+	// filepath.WalkDir.
+	WalkDir(root string, fn fs.WalkDirFunc) error
+}
+
+// File is an open file. *os.File satisfies it.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Writer
+	io.WriterAt
+	io.Seeker
+	io.Closer
+	Readdir(count int) ([]fs.FileInfo, error)
+	Stat() (fs.FileInfo, error)
+	Truncate(size int64) error
+	Sync() error
+}
+
+// AtomicFile is a pending write created by Backend.CreateAtomic.
+type AtomicFile interface {
+	io.Reader
+	io.Writer
+	io.Seeker
+	// Close commits the content to the target name.
+	Close() error
+	// Abort discards the content; the target is left untouched.
+	Abort()
+	Stat() (fs.FileInfo, error)
+}
+
+// WriteAll atomically replaces name with the content of src.
+func WriteAll(b Backend, name string, src io.Reader, perm fs.FileMode) error {
+	f, err := b.CreateAtomic(name, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Abort()
+		return err
+	}
+	return f.Close()
+}
+
+// Detacher is implemented by backends whose names can share one copy of the
+// content (the local backend hard-links deduplicated files).
+type Detacher interface {
+	// Detach gives name its own copy of the content so an in-place write
+	// cannot modify the other names.
+	Detach(name string) error
+}
+
+// Detach prepares name for an in-place write. Backends that never share
+// content need nothing.
+func Detach(b Backend, name string) error {
+	if d, ok := b.(Detacher); ok {
+		return d.Detach(name)
+	}
+	return nil
+}
+
+// ReadFile reads the whole file.
+func ReadFile(b Backend, name string) ([]byte, error) {
+	f, err := b.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// WriteFile atomically replaces name with data.
+func WriteFile(b Backend, name string, data []byte, perm fs.FileMode) error {
+	return WriteAll(b, name, bytes.NewReader(data), perm)
+}
+
+// Exists reports whether name exists. Errors other than not-exist are
+// returned so callers do not mistake an unreadable path for a free one.
+func Exists(b Backend, name string) (bool, error) {
+	_, err := b.Lstat(name)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return false, err
+}
+
+// readRange implements Backend.ReadRange on top of Open.
+func readRange(b Backend, name string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrInvalid}
+	}
+	f, err := b.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return &limitedReadCloser{Reader: io.LimitReader(f, length), closer: f}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	closer io.Closer
+}
+
+func (r *limitedReadCloser) Close() error {
+	return r.closer.Close()
+}
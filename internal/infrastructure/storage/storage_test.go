@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// forEachBackend runs the same assertions against every backend so the
+// in-memory one keeps behaving like the host filesystem.
+func forEachBackend(t *testing.T, fn func(t *testing.T, b Backend, root string)) {
+	t.Run("local", func(t *testing.T) {
+		fn(t, NewLocal(), t.TempDir())
+	})
+	t.Run("memory", func(t *testing.T) {
+		b := NewMemory()
+		root := filepath.Join(string(filepath.Separator), "data")
+		if err := b.MkdirAll(root, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		fn(t, b, root)
+	})
+}
+
+func mustWrite(t *testing.T, b Backend, name, content string) {
+	t.Helper()
+	if err := b.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(b, name, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile(%s): %v", name, err)
+	}
+}
+
+func mustRead(t *testing.T, b Backend, name string) string {
+	t.Helper()
+	data, err := ReadFile(b, name)
+	if err != nil {
+		t.Fatalf("ReadFile(%s): %v", name, err)
+	}
+	return string(data)
+}
+
+func TestBackendReadWriteAndRange(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend, root string) {
+		name := filepath.Join(root, "alice", "notes.txt")
+		mustWrite(t, b, name, "0123456789")
+
+		info, err := b.Stat(name)
+		if err != nil || info.Size() != 10 || info.IsDir() {
+			t.Fatalf("Stat = %v, %v", info, err)
+		}
+		rc, err := b.ReadRange(name, 2, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if string(part) != "234" {
+			t.Fatalf("ReadRange = %q", part)
+		}
+		rc, err = b.ReadRange(name, 7, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tail, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		if string(tail) != "789" {
+			t.Fatalf("ReadRange to end = %q", tail)
+		}
+
+		f, err := b.OpenFile(name, os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteAt([]byte("ab"), 8); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteAt([]byte("!"), 12); err != nil {
+			t.Fatal(err)
+		}
+		_ = f.Close()
+		if got := mustRead(t, b, name); got != "01234567ab\x00\x00!" {
+			t.Fatalf("after WriteAt = %q", got)
+		}
+
+		if _, err := b.Open(filepath.Join(root, "missing")); !os.IsNotExist(err) {
+			t.Fatalf("Open missing = %v", err)
+		}
+		if _, err := b.OpenFile(filepath.Join(root, "nodir", "x"), os.O_CREATE|os.O_WRONLY, 0o644); !os.IsNotExist(err) {
+			t.Fatalf("create under missing dir = %v", err)
+		}
+		if _, err := b.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644); !os.IsExist(err) {
+			t.Fatalf("exclusive create of existing file = %v", err)
+		}
+	})
+}
+
+func TestBackendAtomicWriteCommitsOnClose(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend, root string) {
+		name := filepath.Join(root, "report.csv")
+		mustWrite(t, b, name, "old")
+
+		f, err := b.CreateAtomic(name, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte("new content")); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustRead(t, b, name); got != "old" {
+			t.Fatalf("content visible before commit: %q", got)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got := mustRead(t, b, name); got != "new content" {
+			t.Fatalf("after commit = %q", got)
+		}
+
+		f, err = b.CreateAtomic(name, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = f.Write([]byte("discarded"))
+		f.Abort()
+		if got := mustRead(t, b, name); got != "new content" {
+			t.Fatalf("abort must keep the target: %q", got)
+		}
+		entries, err := b.ReadDir(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 1 {
+			t.Fatalf("abort must not leave temp files, got %d entries", len(entries))
+		}
+	})
+}
+
+func TestBackendRenameRemoveAndWalk(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend, root string) {
+		mustWrite(t, b, filepath.Join(root, "src", "a.txt"), "a")
+		mustWrite(t, b, filepath.Join(root, "src", "sub", "b.txt"), "b")
+		mustWrite(t, b, filepath.Join(root, "skip", "c.txt"), "c")
+
+		if err := b.Rename(filepath.Join(root, "src"), filepath.Join(root, "dst")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Stat(filepath.Join(root, "src", "a.txt")); !os.IsNotExist(err) {
+			t.Fatalf("old path must disappear: %v", err)
+		}
+		if got := mustRead(t, b, filepath.Join(root, "dst", "sub", "b.txt")); got != "b" {
+			t.Fatalf("renamed child = %q", got)
+		}
+
+		var visited []string
+		err := b.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && d.Name() == "skip" {
+				return filepath.SkipDir
+			}
+			rel, _ := filepath.Rel(root, path)
+			visited = append(visited, filepath.ToSlash(rel))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(visited, ","); got != ".,dst,dst/a.txt,dst/sub,dst/sub/b.txt" {
+			t.Fatalf("walk order = %s", got)
+		}
+
+		if err := b.Remove(filepath.Join(root, "dst")); err == nil {
+			t.Fatalf("Remove of non-empty directory must fail")
+		}
+		if err := b.RemoveAll(filepath.Join(root, "dst")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Stat(filepath.Join(root, "dst", "sub")); !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("RemoveAll must drop descendants: %v", err)
+		}
+		if err := b.RemoveAll(filepath.Join(root, "dst")); err != nil {
+			t.Fatalf("RemoveAll of missing path = %v", err)
+		}
+
+		mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		name := filepath.Join(root, "skip", "c.txt")
+		if err := b.Chtimes(name, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		if info, err := b.Stat(name); err != nil || !info.ModTime().Equal(mtime) {
+			t.Fatalf("Chtimes = %v, %v", info, err)
+		}
+	})
+}
+
+func TestBackendDirectoryListing(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b Backend, root string) {
+		mustWrite(t, b, filepath.Join(root, "b.txt"), "b")
+		mustWrite(t, b, filepath.Join(root, "a.txt"), "a")
+		if err := b.MkdirAll(filepath.Join(root, "c"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.MkdirAll(filepath.Join(root, "a.txt", "x"), 0o755); err == nil {
+			t.Fatalf("MkdirAll below a file must fail")
+		}
+
+		dir, err := b.Open(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer dir.Close()
+		infos, err := dir.Readdir(-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := make([]string, 0, len(infos))
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		// Readdir order is unspecified on the host filesystem.
+		if len(names) != 3 {
+			t.Fatalf("Readdir = %v", names)
+		}
+		entries, err := b.ReadDir(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entries[0].Name() != "a.txt" || entries[1].Name() != "b.txt" || !entries[2].IsDir() {
+			t.Fatalf("ReadDir must be sorted: %v", entries)
+		}
+	})
+}
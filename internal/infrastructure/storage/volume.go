@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+)
+
+// DefaultVolume is the volume rooted at webdav.directory. It also holds the
+// hidden stores (.recycle, .warehouse-uploads, ...).
+const DefaultVolume = "default"
+
+// MovingDir holds user trees that are being copied onto a volume or retired
+// from it. Nothing below it is ever resolved as a user directory.
+const MovingDir = ".warehouse-moving"
+
+// Volume is one data directory user trees can live on. Every volume mirrors
+// the layout of webdav.directory, so <volume>/<user dir>/<rel> and
+// <webdav.directory>/<user dir>/<rel> name the same logical file.
+type Volume struct {
+	Name string
+	Path string
+	// Capacity is the number of bytes warehouse may use; 0 means the size of
+	// the underlying filesystem.
+	Capacity int64
+	Weight   int
+	ReadOnly bool
+}
+
+// Volumes maps user directories onto volumes. A user tree is found on the
+// volume where its directory exists, so every process sees a move as soon as
+// the directory is renamed into place.
+type Volumes struct {
+	list []Volume
+}
+
+// NewVolumes builds the volume set; the default volume always comes first.
+// An entry named DefaultVolume only overrides the default's attributes.
+func NewVolumes(defaultPath string, configured []Volume) *Volumes {
+	def := Volume{Name: DefaultVolume, Path: filepath.Clean(defaultPath), Weight: 1}
+	list := []Volume{def}
+	for _, volume := range configured {
+		if volume.Weight <= 0 {
+			volume.Weight = 1
+		}
+		if volume.Name == DefaultVolume {
+			volume.Path = def.Path
+			list[0] = volume
+			continue
+		}
+		volume.Path = filepath.Clean(volume.Path)
+		list = append(list, volume)
+	}
+	return &Volumes{list: list}
+}
+
+// VolumesFromConfig builds the volume set described by webdav.directory and
+// storage.volumes.
+func VolumesFromConfig(cfg *config.Config) *Volumes {
+	configured := make([]Volume, 0, len(cfg.Storage.Volumes))
+	for _, volume := range cfg.Storage.Volumes {
+		configured = append(configured, Volume{
+			Name:     volume.Name,
+			Path:     volume.Path,
+			Capacity: volume.Capacity,
+			Weight:   volume.Weight,
+			ReadOnly: volume.ReadOnly,
+		})
+	}
+	return NewVolumes(cfg.WebDAV.Directory, configured)
+}
+
+// List returns every volume, default first.
+func (v *Volumes) List() []Volume {
+	return append([]Volume(nil), v.list...)
+}
+
+// Default returns the volume rooted at webdav.directory.
+func (v *Volumes) Default() Volume {
+	return v.list[0]
+}
+
+// Get looks a volume up by name; an empty name is the default volume.
+func (v *Volumes) Get(name string) (Volume, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = DefaultVolume
+	}
+	for _, volume := range v.list {
+		if volume.Name == name {
+			return volume, true
+		}
+	}
+	return Volume{}, false
+}
+
+// Locate returns the volume userDir currently lives on. Additional volumes
+// are checked before the default one.
+func (v *Volumes) Locate(userDir string) (Volume, bool) {
+	rel, ok := cleanRelative(userDir)
+	if !ok {
+		return Volume{}, false
+	}
+	for i := 1; i <= len(v.list); i++ {
+		volume := v.list[i%len(v.list)]
+		if info, err := os.Stat(filepath.Join(volume.Path, rel)); err == nil && info.IsDir() {
+			return volume, true
+		}
+	}
+	return Volume{}, false
+}
+
+// UserBase returns the volume path userDir should be joined to. The volume
+// recorded for the user wins while the directory exists there; otherwise the
+// directory is looked up on every volume, and a directory that does not exist
+// yet is created on the recorded volume.
+func (v *Volumes) UserBase(volumeName, userDir string) string {
+	recorded, known := v.Get(volumeName)
+	if rel, ok := cleanRelative(userDir); ok && known {
+		if info, err := os.Stat(filepath.Join(recorded.Path, rel)); err == nil && info.IsDir() {
+			return recorded.Path
+		}
+	}
+	if located, ok := v.Locate(userDir); ok {
+		return located.Path
+	}
+	if known {
+		return recorded.Path
+	}
+	return v.Default().Path
+}
+
+// Logical maps a path on any volume to the same path below the default
+// volume. Replication and other cross-node bookkeeping only use logical paths.
+func (v *Volumes) Logical(fullPath string) string {
+	cleaned := filepath.Clean(fullPath)
+	for _, volume := range v.list[1:] {
+		if rel, ok := relativeTo(volume.Path, cleaned); ok {
+			return filepath.Join(v.Default().Path, rel)
+		}
+	}
+	return cleaned
+}
+
+// Physical maps a logical path below the default volume to the volume that
+// holds the deepest existing part of it, so files of a user tree that lives on
+// another volume resolve there even before they exist.
+func (v *Volumes) Physical(fullPath string) string {
+	cleaned := filepath.Clean(fullPath)
+	if len(v.list) == 1 {
+		return cleaned
+	}
+	rel, ok := relativeTo(v.Default().Path, cleaned)
+	if !ok || rel == "." {
+		return cleaned
+	}
+	segments := strings.Split(rel, string(filepath.Separator))
+	if strings.HasPrefix(segments[0], ".") {
+		// Hidden stores only live on the default volume.
+		return cleaned
+	}
+	best, bestDepth := v.Default(), existingDepth(v.Default().Path, segments)
+	for _, volume := range v.list[1:] {
+		if depth := existingDepth(volume.Path, segments); depth > bestDepth {
+			best, bestDepth = volume, depth
+		}
+	}
+	return filepath.Join(best.Path, rel)
+}
+
+func existingDepth(base string, segments []string) int {
+	for depth := len(segments); depth > 0; depth-- {
+		if _, err := os.Lstat(filepath.Join(append([]string{base}, segments[:depth]...)...)); err == nil {
+			return depth
+		}
+	}
+	return 0
+}
+
+func cleanRelative(userDir string) (string, bool) {
+	userDir = strings.TrimSpace(userDir)
+	if userDir == "" || filepath.IsAbs(userDir) {
+		return "", false
+	}
+	rel := filepath.Clean(filepath.FromSlash(userDir))
+	if rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+func relativeTo(base, target string) (string, bool) {
+	rel, err := filepath.Rel(base, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", false
+	}
+	return rel, true
+}
@@ -0,0 +1,135 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestVolumes(t *testing.T) (*Volumes, string, string) {
+	t.Helper()
+	def := t.TempDir()
+	extra := t.TempDir()
+	volumes := NewVolumes(def, []Volume{
+		{Name: DefaultVolume, Capacity: 100, Weight: 3},
+		{Name: "hdd1", Path: extra},
+	})
+	return volumes, def, extra
+}
+
+func TestNewVolumesKeepsDefaultFirst(t *testing.T) {
+	volumes, def, extra := newTestVolumes(t)
+
+	list := volumes.List()
+	if len(list) != 2 || list[0].Name != DefaultVolume || list[0].Path != def || list[1].Path != extra {
+		t.Fatalf("unexpected volumes: %+v", list)
+	}
+	if list[0].Capacity != 100 || list[0].Weight != 3 {
+		t.Fatalf("default attributes not applied: %+v", list[0])
+	}
+	if list[1].Weight != 1 {
+		t.Fatalf("weight = %d, want 1", list[1].Weight)
+	}
+	if got, ok := volumes.Get(""); !ok || got.Name != DefaultVolume {
+		t.Fatalf("empty name should resolve to default, got %+v %v", got, ok)
+	}
+	if _, ok := volumes.Get("missing"); ok {
+		t.Fatal("unknown volume should not resolve")
+	}
+}
+
+func TestVolumesUserBaseFollowsExistingDirectory(t *testing.T) {
+	volumes, def, extra := newTestVolumes(t)
+
+	if got := volumes.UserBase("hdd1", "alice"); got != extra {
+		t.Fatalf("new user should go to recorded volume, got %s", got)
+	}
+	if got := volumes.UserBase("", "alice"); got != def {
+		t.Fatalf("new user without volume should go to default, got %s", got)
+	}
+
+	if err := os.MkdirAll(filepath.Join(extra, "alice"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := volumes.UserBase("", "alice"); got != extra {
+		t.Fatalf("existing directory should win over the record, got %s", got)
+	}
+	if located, ok := volumes.Locate("alice"); !ok || located.Name != "hdd1" {
+		t.Fatalf("Locate = %+v %v", located, ok)
+	}
+	if _, ok := volumes.Locate("../alice"); ok {
+		t.Fatal("escaping directories must not resolve")
+	}
+}
+
+func TestVolumesLogicalAndPhysical(t *testing.T) {
+	volumes, def, extra := newTestVolumes(t)
+	if err := os.MkdirAll(filepath.Join(extra, "alice", "docs"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(def, "bob"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	logical := filepath.Join(def, "alice", "docs", "new.txt")
+	if got := volumes.Physical(logical); got != filepath.Join(extra, "alice", "docs", "new.txt") {
+		t.Fatalf("Physical(%s) = %s", logical, got)
+	}
+	if got := volumes.Logical(filepath.Join(extra, "alice", "docs", "new.txt")); got != logical {
+		t.Fatalf("Logical = %s, want %s", got, logical)
+	}
+	if got := volumes.Physical(filepath.Join(def, "bob", "a.txt")); got != filepath.Join(def, "bob", "a.txt") {
+		t.Fatalf("default user resolved to %s", got)
+	}
+	hidden := filepath.Join(def, ".recycle", "alice", "x")
+	if got := volumes.Physical(hidden); got != hidden {
+		t.Fatalf("hidden store resolved to %s", got)
+	}
+}
+
+func TestSyncTreeMirrorsSource(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "src")
+	dst := filepath.Join(t.TempDir(), "dst")
+	b := NewLocal()
+	mustWrite(t, b, filepath.Join(src, "a.txt"), "hello")
+	mustWrite(t, b, filepath.Join(src, "sub", "b.txt"), "world")
+
+	stats, err := SyncTree(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Files != 2 || stats.Bytes != 10 || stats.Copied != 2 {
+		t.Fatalf("first pass stats = %+v", stats)
+	}
+
+	stats, err = SyncTree(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 0 || stats.Removed != 0 {
+		t.Fatalf("unchanged tree should not be copied again: %+v", stats)
+	}
+
+	if err := os.Remove(filepath.Join(src, "sub", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	mustWrite(t, b, filepath.Join(src, "a.txt"), "hello again")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(src, "a.txt"), later, later); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = SyncTree(src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Copied != 1 || stats.Removed != 1 {
+		t.Fatalf("third pass stats = %+v", stats)
+	}
+	if got := mustRead(t, b, filepath.Join(dst, "a.txt")); got != "hello again" {
+		t.Fatalf("a.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "sub", "b.txt")); !os.IsNotExist(err) {
+		t.Fatalf("removed file still mirrored: %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package textextract
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxXMLPartSize bounds how much of one OOXML part is inflated, so a small
+// archive cannot expand into an unbounded amount of markup.
+const maxXMLPartSize = 64 << 20
+
+// htmlSkippedElements hold no readable text.
+var htmlSkippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+}
+
+// htmlInlineElements do not separate the words around them.
+var htmlInlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "cite": true, "code": true,
+	"data": true, "dfn": true, "em": true, "font": true, "i": true, "kbd": true, "mark": true,
+	"q": true, "s": true, "samp": true, "small": true, "span": true, "strong": true,
+	"sub": true, "sup": true, "time": true, "u": true, "var": true,
+}
+
+func extractHTML(r io.Reader, w *textWriter) error {
+	tokenizer := html.NewTokenizer(r)
+	skipDepth := 0
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); !errors.Is(err, io.EOF) {
+				return err
+			}
+			return nil
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			if htmlSkippedElements[string(name)] {
+				skipDepth++
+			}
+			if !htmlInlineElements[string(name)] {
+				w.Break()
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			if htmlSkippedElements[string(name)] && skipDepth > 0 {
+				skipDepth--
+			}
+			if !htmlInlineElements[string(name)] {
+				w.Break()
+			}
+		case html.SelfClosingTagToken:
+			w.Break()
+		case html.TextToken:
+			if skipDepth > 0 {
+				continue
+			}
+			if err := w.WriteString(strings.ToValidUTF8(string(tokenizer.Text()), "")); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// OOXML parts and the elements that carry their text. Break elements end a
+// paragraph, cell or line.
+var (
+	docxParts  = func(name string) bool { return name == "word/document.xml" || name == "word/footnotes.xml" }
+	docxText   = map[string]bool{"t": true}
+	docxBreaks = map[string]bool{"p": true, "tab": true, "br": true, "cr": true}
+
+	xlsxParts = func(name string) bool {
+		return name == "xl/sharedStrings.xml" || isNumberedPart(name, "xl/worksheets/sheet")
+	}
+	xlsxText   = map[string]bool{"t": true}
+	xlsxBreaks = map[string]bool{"si": true, "is": true, "c": true}
+
+	pptxParts  = func(name string) bool { return isNumberedPart(name, "ppt/slides/slide") }
+	pptxText   = map[string]bool{"t": true}
+	pptxBreaks = map[string]bool{"p": true, "br": true}
+)
+
+// isNumberedPart matches parts such as "ppt/slides/slide12.xml".
+func isNumberedPart(name, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) || path.Ext(name) != ".xml" {
+		return false
+	}
+	_, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".xml"))
+	return err == nil
+}
+
+// extractOOXML reads the text elements of the selected XML parts of an
+// Office Open XML package. Numbered parts (slides, sheets) are read in
+// numeric order.
+func extractOOXML(r io.ReaderAt, size int64, w *textWriter, selectPart func(string) bool, textElements, breakElements map[string]bool) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	var parts []*zip.File
+	for _, file := range archive.File {
+		if selectPart(file.Name) {
+			parts = append(parts, file)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("%w: no text parts", ErrUnsupported)
+	}
+	sort.SliceStable(parts, func(i, j int) bool {
+		return ooxmlPartKey(parts[i].Name) < ooxmlPartKey(parts[j].Name)
+	})
+	for _, part := range parts {
+		if err := extractXMLPart(part, w, textElements, breakElements); err != nil {
+			return err
+		}
+		w.Break()
+	}
+	return nil
+}
+
+// ooxmlPartKey orders "slide2.xml" before "slide10.xml".
+func ooxmlPartKey(name string) string {
+	base := strings.TrimSuffix(name, ".xml")
+	end := len(base)
+	for end > 0 && base[end-1] >= '0' && base[end-1] <= '9' {
+		end--
+	}
+	if end == len(base) {
+		return name
+	}
+	n, _ := strconv.Atoi(base[end:])
+	return fmt.Sprintf("%s%09d", base[:end], n)
+}
+
+func extractXMLPart(part *zip.File, w *textWriter, textElements, breakElements map[string]bool) error {
+	rc, err := part.Open()
+	if err != nil {
+		return fmt.Errorf("%w: open %s: %v", ErrUnsupported, part.Name, err)
+	}
+	defer rc.Close()
+
+	decoder := xml.NewDecoder(io.LimitReader(rc, maxXMLPartSize))
+	inText := 0
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w: parse %s: %v", ErrUnsupported, part.Name, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if textElements[t.Name.Local] {
+				inText++
+			}
+			if breakElements[t.Name.Local] {
+				w.Break()
+			}
+		case xml.EndElement:
+			if textElements[t.Name.Local] && inText > 0 {
+				inText--
+			}
+			if breakElements[t.Name.Local] {
+				w.Break()
+			}
+		case xml.CharData:
+			if inText == 0 {
+				continue
+			}
+			if err := w.WriteString(string(t)); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,878 @@
+package textextract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"unicode/utf16"
+)
+
+// PDF support covers the text layer only: page content streams are decoded
+// (Flate, ASCIIHex, ASCII85), text-showing operators are interpreted and
+// glyph codes are mapped through the font's ToUnicode CMap, or through a
+// Latin-1 approximation of WinAnsi for simple fonts without one. Scanned
+// pages, encrypted files and composite fonts without ToUnicode yield no text.
+
+const (
+	// maxPDFStreamSize bounds one inflated stream.
+	maxPDFStreamSize = 64 << 20
+	// maxPDFResolveDepth bounds reference chains and page tree depth.
+	maxPDFResolveDepth = 32
+	// pdfWordGap is the TJ displacement, in thousandths of an em, treated
+	// as a word break.
+	pdfWordGap = -180
+)
+
+type (
+	pdfName  string
+	pdfRef   int
+	pdfDict  map[string]any
+	pdfArray []any
+	// pdfKeyword is a bare token: an operator in content streams.
+	pdfKeyword string
+)
+
+type pdfObject struct {
+	value  any
+	stream []byte
+}
+
+type pdfDocument struct {
+	data    []byte
+	objects map[int]*pdfObject
+	fonts   map[pdfRef]*pdfFont
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+
+func extractPDF(r io.ReaderAt, size int64, w *textWriter) error {
+	data, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("%PDF-")) {
+		return fmt.Errorf("%w: not a PDF file", ErrUnsupported)
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return fmt.Errorf("%w: encrypted PDF", ErrUnsupported)
+	}
+	doc := &pdfDocument{data: data, objects: make(map[int]*pdfObject), fonts: make(map[pdfRef]*pdfFont)}
+	doc.scanObjects()
+	doc.expandObjectStreams()
+
+	pages := doc.pages()
+	if len(pages) == 0 {
+		return fmt.Errorf("%w: no pages", ErrUnsupported)
+	}
+	for _, page := range pages {
+		if err := doc.extractPage(page, w); err != nil {
+			return err
+		}
+		w.Break()
+	}
+	return nil
+}
+
+// scanObjects indexes every top-level "N G obj" in file order, so objects
+// from incremental updates replace earlier revisions.
+func (d *pdfDocument) scanObjects() {
+	pos := 0
+	for pos < len(d.data) {
+		loc := pdfObjectHeader.FindSubmatchIndex(d.data[pos:])
+		if loc == nil {
+			return
+		}
+		num, _ := strconv.Atoi(string(d.data[pos+loc[2] : pos+loc[3]]))
+		lex := &pdfLexer{data: d.data, pos: pos + loc[1]}
+		value, err := lex.value()
+		if err != nil {
+			pos += loc[1]
+			continue
+		}
+		obj := &pdfObject{value: value}
+		next := lex.pos
+		if dict, ok := value.(pdfDict); ok {
+			if stream, end, ok := d.streamAfter(dict, lex.pos); ok {
+				obj.stream = stream
+				next = end
+			}
+		}
+		d.objects[num] = obj
+		pos = next
+	}
+}
+
+// streamAfter returns the raw stream data following a dictionary that ends
+// at pos, and the offset after "endstream".
+func (d *pdfDocument) streamAfter(dict pdfDict, pos int) ([]byte, int, bool) {
+	lex := &pdfLexer{data: d.data, pos: pos}
+	lex.skipSpace()
+	if !bytes.HasPrefix(d.data[lex.pos:], []byte("stream")) {
+		return nil, 0, false
+	}
+	start := lex.pos + len("stream")
+	if start < len(d.data) && d.data[start] == '\r' {
+		start++
+	}
+	if start < len(d.data) && d.data[start] == '\n' {
+		start++
+	}
+	// Trust a direct /Length when "endstream" follows it, otherwise search.
+	if length, ok := dict["Length"].(float64); ok && length >= 0 {
+		end := start + int(length)
+		if end <= len(d.data) {
+			tail := bytes.TrimLeft(d.data[end:], " \t\r\n")
+			if bytes.HasPrefix(tail, []byte("endstream")) {
+				return d.data[start:end], len(d.data) - len(tail) + len("endstream"), true
+			}
+		}
+	}
+	idx := bytes.Index(d.data[start:], []byte("endstream"))
+	if idx < 0 {
+		return d.data[start:], len(d.data), true
+	}
+	return bytes.TrimRight(d.data[start:start+idx], "\r\n"), start + idx + len("endstream"), true
+}
+
+// expandObjectStreams adds the objects packed into /Type /ObjStm streams.
+func (d *pdfDocument) expandObjectStreams() {
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		obj := d.objects[num]
+		dict, ok := obj.value.(pdfDict)
+		if !ok || obj.stream == nil || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		data, err := d.decodeStream(obj)
+		if err != nil {
+			continue
+		}
+		count, _ := dict["N"].(float64)
+		first, _ := dict["First"].(float64)
+		if int(first) > len(data) {
+			continue
+		}
+		header := &pdfLexer{data: data[:int(first)]}
+		for i := 0; i < int(count); i++ {
+			objNum, err1 := header.value()
+			offset, err2 := header.value()
+			n, ok1 := objNum.(float64)
+			off, ok2 := offset.(float64)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 {
+				break
+			}
+			if _, exists := d.objects[int(n)]; exists {
+				continue
+			}
+			lex := &pdfLexer{data: data, pos: int(first) + int(off)}
+			if value, err := lex.value(); err == nil {
+				d.objects[int(n)] = &pdfObject{value: value}
+			}
+		}
+	}
+}
+
+func (d *pdfDocument) resolve(value any) any {
+	for depth := 0; depth < maxPDFResolveDepth; depth++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		obj := d.objects[int(ref)]
+		if obj == nil {
+			return nil
+		}
+		value = obj.value
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(value any) pdfDict {
+	dict, _ := d.resolve(value).(pdfDict)
+	return dict
+}
+
+// decodeStream applies the stream's filters.
+func (d *pdfDocument) decodeStream(obj *pdfObject) ([]byte, error) {
+	dict, _ := obj.value.(pdfDict)
+	data := obj.stream
+	var filters []any
+	switch filter := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{filter}
+	case pdfArray:
+		filters = filter
+	}
+	for _, filter := range filters {
+		switch d.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// Truncated streams are common; keep what inflated cleanly.
+			inflated, err := io.ReadAll(io.LimitReader(zr, maxPDFStreamSize))
+			if err != nil && len(inflated) == 0 {
+				return nil, err
+			}
+			data = inflated
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = decodePDFHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			trimmed := bytes.TrimSpace(data)
+			trimmed = bytes.TrimPrefix(trimmed, []byte("<~"))
+			trimmed = bytes.TrimSuffix(trimmed, []byte("~>"))
+			decoded := make([]byte, 4*len(trimmed)/5+4)
+			n, _, err := ascii85.Decode(decoded, trimmed, true)
+			if err != nil {
+				return nil, err
+			}
+			data = decoded[:n]
+		default:
+			return nil, fmt.Errorf("unsupported stream filter %v", filter)
+		}
+	}
+	return data, nil
+}
+
+// pages returns the page dictionaries in document order, each with its
+// inherited resources.
+func (d *pdfDocument) pages() []pdfPage {
+	var catalog pdfDict
+	nums := make([]int, 0, len(d.objects))
+	for num := range d.objects {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+	for _, num := range nums {
+		if dict, ok := d.objects[num].value.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			catalog = dict
+		}
+	}
+
+	var pages []pdfPage
+	visited := make(map[pdfRef]bool)
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		if depth > maxPDFResolveDepth {
+			return
+		}
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+		dict := d.dict(node)
+		if dict == nil {
+			return
+		}
+		if own := d.dict(dict["Resources"]); own != nil {
+			resources = own
+		}
+		if kids, ok := d.resolve(dict["Kids"]).(pdfArray); ok {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		pages = append(pages, pdfPage{dict: dict, resources: resources})
+	}
+	if catalog != nil {
+		walk(catalog["Pages"], nil, 0)
+	}
+	if len(pages) > 0 {
+		return pages
+	}
+	// Without a usable page tree fall back to every page object.
+	for _, num := range nums {
+		if dict, ok := d.objects[num].value.(pdfDict); ok && dict["Type"] == pdfName("Page") {
+			pages = append(pages, pdfPage{dict: dict, resources: d.dict(dict["Resources"])})
+		}
+	}
+	return pages
+}
+
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+func (d *pdfDocument) extractPage(page pdfPage, w *textWriter) error {
+	var content []byte
+	var parts []any
+	switch contents := page.dict["Contents"].(type) {
+	case pdfRef:
+		if array, ok := d.resolve(contents).(pdfArray); ok {
+			parts = array
+		} else {
+			parts = []any{contents}
+		}
+	case pdfArray:
+		parts = contents
+	}
+	for _, part := range parts {
+		ref, ok := part.(pdfRef)
+		if !ok || d.objects[int(ref)] == nil {
+			continue
+		}
+		data, err := d.decodeStream(d.objects[int(ref)])
+		if err != nil {
+			continue
+		}
+		content = append(content, data...)
+		content = append(content, '\n')
+	}
+	return d.interpretContent(content, page.resources, w)
+}
+
+// interpretContent runs the text operators of a content stream.
+func (d *pdfDocument) interpretContent(content []byte, resources pdfDict, w *textWriter) error {
+	fonts := d.dict(resources["Font"])
+	var font *pdfFont
+	var operands []any
+	lex := &pdfLexer{data: content}
+	for {
+		token, err := lex.value()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// Skip a malformed token and keep going.
+			lex.pos++
+			operands = operands[:0]
+			continue
+		}
+		op, ok := token.(pdfKeyword)
+		if !ok {
+			operands = append(operands, token)
+			continue
+		}
+		switch op {
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[len(operands)-2].(pdfName); ok && fonts != nil {
+					font = d.font(fonts[string(name)])
+				}
+			}
+		case "Tj", "'", "\"":
+			if len(operands) > 0 {
+				if op != "Tj" {
+					w.Break()
+				}
+				if s, ok := operands[len(operands)-1].(string); ok {
+					if err := w.WriteString(font.decode([]byte(s))); err != nil {
+						return err
+					}
+				}
+			}
+		case "TJ":
+			if len(operands) > 0 {
+				array, _ := operands[len(operands)-1].(pdfArray)
+				for _, item := range array {
+					switch v := item.(type) {
+					case string:
+						if err := w.WriteString(font.decode([]byte(v))); err != nil {
+							return err
+						}
+					case float64:
+						if v < pdfWordGap {
+							w.Break()
+						}
+					}
+				}
+			}
+		case "Td", "TD", "Tm", "T*", "BT", "ET":
+			w.Break()
+		case "BI":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfFont maps glyph codes of one font to text.
+type pdfFont struct {
+	toUnicode map[string]string
+	// codeLengths are the byte lengths of codes, shortest first.
+	codeLengths []int
+	// composite fonts without a ToUnicode map cannot be decoded.
+	composite bool
+}
+
+func (d *pdfDocument) font(value any) *pdfFont {
+	ref, isRef := value.(pdfRef)
+	if isRef {
+		if font, ok := d.fonts[ref]; ok {
+			return font
+		}
+	}
+	dict := d.dict(value)
+	font := &pdfFont{composite: dict["Subtype"] == pdfName("Type0")}
+	if cmapRef, ok := dict["ToUnicode"].(pdfRef); ok {
+		if obj := d.objects[int(cmapRef)]; obj != nil && obj.stream != nil {
+			if data, err := d.decodeStream(obj); err == nil {
+				font.toUnicode, font.codeLengths = parseToUnicode(data)
+			}
+		}
+	}
+	if isRef {
+		d.fonts[ref] = font
+	}
+	return font
+}
+
+func (f *pdfFont) decode(code []byte) string {
+	if f == nil || len(f.toUnicode) == 0 {
+		if f != nil && f.composite {
+			return ""
+		}
+		return decodePDFSimpleText(code)
+	}
+	lengths := f.codeLengths
+	if len(lengths) == 0 {
+		lengths = []int{1, 2}
+	}
+	var out []rune
+	for i := 0; i < len(code); {
+		matched := false
+		for _, n := range lengths {
+			if i+n > len(code) {
+				continue
+			}
+			if text, ok := f.toUnicode[string(code[i:i+n])]; ok {
+				out = append(out, []rune(text)...)
+				i += n
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			// Unmapped codes advance by the shortest code length.
+			i += lengths[0]
+		}
+	}
+	return string(out)
+}
+
+// parseToUnicode reads bfchar and bfrange mappings of a ToUnicode CMap.
+func parseToUnicode(data []byte) (map[string]string, []int) {
+	mapping := make(map[string]string)
+	lengthSet := make(map[int]bool)
+	lex := &pdfLexer{data: data}
+	var operands []any
+	mode := ""
+	for {
+		token, err := lex.value()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			lex.pos++
+			continue
+		}
+		keyword, ok := token.(pdfKeyword)
+		if !ok {
+			if mode != "" {
+				operands = append(operands, token)
+			}
+			continue
+		}
+		switch keyword {
+		case "begincodespacerange", "beginbfchar", "beginbfrange":
+			mode = string(keyword)
+			operands = operands[:0]
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(string); ok && lo != "" {
+					lengthSet[len(lo)] = true
+				}
+			}
+			mode = ""
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(string)
+				dst, ok2 := operands[i+1].(string)
+				if ok1 && ok2 {
+					mapping[src] = decodeUTF16BE([]byte(dst))
+					lengthSet[len(src)] = true
+				}
+			}
+			mode = ""
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(string)
+				hi, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				lengthSet[len(lo)] = true
+				start, end := pdfCode([]byte(lo)), pdfCode([]byte(hi))
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case string:
+					base := utf16.Decode(bytesToUTF16(dst))
+					for code := start; code <= end; code++ {
+						if len(base) == 0 {
+							break
+						}
+						text := append([]rune(nil), base...)
+						text[len(text)-1] += rune(code - start)
+						mapping[string(pdfCodeBytes(code, len(lo)))] = string(text)
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(string); ok && start+uint32(j) <= end {
+							mapping[string(pdfCodeBytes(start+uint32(j), len(lo)))] = decodeUTF16BE([]byte(s))
+						}
+					}
+				}
+			}
+			mode = ""
+		}
+	}
+	lengths := make([]int, 0, len(lengthSet))
+	for n := range lengthSet {
+		lengths = append(lengths, n)
+	}
+	sort.Ints(lengths)
+	return mapping, lengths
+}
+
+func pdfCode(b []byte) uint32 {
+	var code uint32
+	for _, c := range b {
+		code = code<<8 | uint32(c)
+	}
+	return code
+}
+
+func pdfCodeBytes(code uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(code)
+		code >>= 8
+	}
+	return b
+}
+
+func bytesToUTF16(s string) []uint16 {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	return units
+}
+
+func decodeUTF16BE(b []byte) string {
+	return string(utf16.Decode(bytesToUTF16(string(b))))
+}
+
+// decodePDFSimpleText decodes a string shown with a simple font: UTF-16BE
+// with a byte order mark, otherwise Latin-1 with the WinAnsi punctuation.
+func decodePDFSimpleText(b []byte) string {
+	if len(b) >= 2 && b[0] == 0xFE && b[1] == 0xFF {
+		return decodeUTF16BE(b[2:])
+	}
+	out := make([]rune, 0, len(b))
+	for _, c := range b {
+		if r, ok := winAnsiPunctuation[c]; ok {
+			out = append(out, r)
+			continue
+		}
+		out = append(out, rune(c))
+	}
+	return string(out)
+}
+
+var winAnsiPunctuation = map[byte]rune{
+	0x80: '€', 0x85: '…', 0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”',
+	0x95: '•', 0x96: '–', 0x97: '—', 0x99: '™',
+}
+
+func decodePDFHex(data []byte) []byte {
+	digits := make([]byte, 0, len(data))
+	for _, c := range data {
+		if c == '>' {
+			break
+		}
+		if isPDFHexDigit(c) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded := make([]byte, len(digits)/2)
+	n, _ := hex.Decode(decoded, digits)
+	return decoded[:n]
+}
+
+func isPDFHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// pdfLexer parses PDF objects and content stream tokens.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// value reads the next object. Integers followed by "G R" become references.
+func (l *pdfLexer) value() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		return l.name(), nil
+	case c == '(':
+		return l.literalString()
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			return l.dictionary()
+		}
+		return l.hexString()
+	case c == '[':
+		l.pos++
+		var array pdfArray
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return array, nil
+			}
+			item, err := l.value()
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, item)
+		}
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.number()
+	case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+		l.pos++
+		return nil, fmt.Errorf("unexpected %q", c)
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+func (l *pdfLexer) name() pdfName {
+	l.pos++
+	var b []byte
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) && isPDFHexDigit(l.data[l.pos+1]) && isPDFHexDigit(l.data[l.pos+2]) {
+			v, _ := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8)
+			b = append(b, byte(v))
+			l.pos += 3
+			continue
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return pdfName(b)
+}
+
+func (l *pdfLexer) number() (any, error) {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) && (l.data[l.pos] == '.' || (l.data[l.pos] >= '0' && l.data[l.pos] <= '9')) {
+		l.pos++
+	}
+	n, err := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+	if err != nil {
+		return 0.0, nil
+	}
+	// "12 0 R" is a reference.
+	if n >= 0 && n == float64(int(n)) {
+		save := l.pos
+		l.skipSpace()
+		genStart := l.pos
+		for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+			l.pos++
+		}
+		if l.pos > genStart {
+			l.skipSpace()
+			if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+				(l.pos+1 == len(l.data) || isPDFSpace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+				l.pos++
+				return pdfRef(int(n)), nil
+			}
+		}
+		l.pos = save
+	}
+	return n, nil
+}
+
+func (l *pdfLexer) literalString() (any, error) {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(b), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return string(b), nil
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				b = append(b, '\n')
+			case 'r':
+				b = append(b, '\r')
+			case 't':
+				b = append(b, '\t')
+			case 'b':
+				b = append(b, '\b')
+			case 'f':
+				b = append(b, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					b = append(b, byte(v))
+				} else {
+					b = append(b, e)
+				}
+			}
+			continue
+		}
+		b = append(b, c)
+	}
+	return string(b), nil
+}
+
+func (l *pdfLexer) hexString() (any, error) {
+	l.pos++
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	decoded := decodePDFHex(l.data[l.pos : l.pos+end])
+	l.pos += end + 1
+	return string(decoded), nil
+}
+
+func (l *pdfLexer) dictionary() (any, error) {
+	l.pos += 2
+	dict := make(pdfDict)
+	for {
+		l.skipSpace()
+		if l.pos+1 < len(l.data) && l.data[l.pos] == '>' && l.data[l.pos+1] == '>' {
+			l.pos += 2
+			return dict, nil
+		}
+		if l.pos >= len(l.data) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if l.data[l.pos] != '/' {
+			return nil, fmt.Errorf("dictionary key expected at %d", l.pos)
+		}
+		key := l.name()
+		value, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		dict[string(key)] = value
+	}
+}
+
+// skipInlineImage skips the binary data of an inline image up to "EI".
+func (l *pdfLexer) skipInlineImage() {
+	idx := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if idx < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += idx + 2
+	for l.pos < len(l.data) {
+		idx := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + idx
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos == len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
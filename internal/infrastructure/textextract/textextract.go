@@ -0,0 +1,184 @@
+// Package textextract pulls plain text out of documents for full-text
+// indexing. Everything runs in-process with pure-Go parsers: plain text and
+// Markdown are read as is, HTML is tokenized, PDF text layers are decoded
+// from content streams and DOCX/XLSX/PPTX text is read from their XML parts.
+package textextract
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ErrUnsupported is returned for formats or documents that carry no
+// extractable text, e.g. binary files, encrypted PDFs or scanned pages.
+var ErrUnsupported = errors.New("unsupported document")
+
+// binarySniffSize is how much of a plain text file is checked for NUL bytes.
+const binarySniffSize = 8 << 10
+
+type format int
+
+const (
+	formatNone format = iota
+	formatText
+	formatHTML
+	formatPDF
+	formatDOCX
+	formatXLSX
+	formatPPTX
+)
+
+var formatsByExtension = map[string]format{
+	"txt": formatText, "text": formatText, "md": formatText, "markdown": formatText,
+	"rst": formatText, "adoc": formatText, "org": formatText, "tex": formatText,
+	"csv": formatText, "tsv": formatText, "log": formatText, "json": formatText,
+	"yaml": formatText, "yml": formatText, "toml": formatText, "ini": formatText,
+	"conf": formatText, "xml": formatText, "sql": formatText, "sh": formatText,
+	"go": formatText, "py": formatText, "js": formatText, "ts": formatText,
+	"java": formatText, "c": formatText, "h": formatText, "cpp": formatText,
+	"rs": formatText, "rb": formatText, "php": formatText, "css": formatText,
+	"html": formatHTML, "htm": formatHTML, "xhtml": formatHTML,
+	"pdf":  formatPDF,
+	"docx": formatDOCX,
+	"xlsx": formatXLSX,
+	"pptx": formatPPTX,
+}
+
+func formatOf(name string) format {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(name), "."))
+	return formatsByExtension[ext]
+}
+
+// Supported reports whether Extract understands the file name's extension.
+func Supported(name string) bool {
+	return formatOf(name) != formatNone
+}
+
+// Extract returns the text of the document in r, picking the parser from
+// name's extension. Whitespace is collapsed to single spaces and the result
+// is cut at limit bytes on a rune boundary; limit <= 0 means no limit.
+func Extract(r io.ReaderAt, size int64, name string, limit int) (string, error) {
+	w := newTextWriter(limit)
+	var err error
+	switch formatOf(name) {
+	case formatText:
+		err = extractPlain(io.NewSectionReader(r, 0, size), w)
+	case formatHTML:
+		err = extractHTML(io.NewSectionReader(r, 0, size), w)
+	case formatPDF:
+		err = extractPDF(r, size, w)
+	case formatDOCX:
+		err = extractOOXML(r, size, w, docxParts, docxText, docxBreaks)
+	case formatXLSX:
+		err = extractOOXML(r, size, w, xlsxParts, xlsxText, xlsxBreaks)
+	case formatPPTX:
+		err = extractOOXML(r, size, w, pptxParts, pptxText, pptxBreaks)
+	default:
+		return "", ErrUnsupported
+	}
+	if err != nil && !errors.Is(err, errTextFull) {
+		return "", err
+	}
+	return w.String(), nil
+}
+
+// errTextFull stops parsers early once the writer reached its limit.
+var errTextFull = errors.New("text limit reached")
+
+// textWriter accumulates normalized text up to a byte limit.
+type textWriter struct {
+	b            strings.Builder
+	limit        int
+	pendingSpace bool
+	full         bool
+}
+
+func newTextWriter(limit int) *textWriter {
+	return &textWriter{limit: limit}
+}
+
+// WriteString appends s, collapsing whitespace and dropping control
+// characters. It returns errTextFull once the limit is reached.
+func (w *textWriter) WriteString(s string) error {
+	if w.full {
+		return errTextFull
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) || r == 0 {
+			w.pendingSpace = true
+			continue
+		}
+		if r == utf8.RuneError || unicode.IsControl(r) {
+			continue
+		}
+		n := utf8.RuneLen(r)
+		if w.pendingSpace && w.b.Len() > 0 {
+			n++
+		}
+		if w.limit > 0 && w.b.Len()+n > w.limit {
+			w.full = true
+			return errTextFull
+		}
+		if w.pendingSpace && w.b.Len() > 0 {
+			w.b.WriteByte(' ')
+		}
+		w.pendingSpace = false
+		w.b.WriteRune(r)
+	}
+	return nil
+}
+
+// Break separates the text written before and after it.
+func (w *textWriter) Break() {
+	w.pendingSpace = true
+}
+
+func (w *textWriter) String() string {
+	return w.b.String()
+}
+
+func extractPlain(r io.Reader, w *textWriter) error {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(binarySniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return err
+	}
+	for _, b := range head {
+		if b == 0 {
+			return ErrUnsupported
+		}
+	}
+	buf := make([]byte, 32<<10)
+	var carry []byte
+	for {
+		n, err := br.Read(buf)
+		if n > 0 {
+			chunk := append(carry, buf[:n]...)
+			// Keep an incomplete trailing rune for the next read.
+			cut := len(chunk)
+			for i := len(chunk) - 1; i >= 0 && i >= len(chunk)-utf8.UTFMax; i-- {
+				if utf8.RuneStart(chunk[i]) {
+					if !utf8.FullRune(chunk[i:]) {
+						cut = i
+					}
+					break
+				}
+			}
+			if werr := w.WriteString(strings.ToValidUTF8(string(chunk[:cut]), "")); werr != nil {
+				return werr
+			}
+			carry = append(carry[:0], chunk[cut:]...)
+		}
+		if errors.Is(err, io.EOF) {
+			return w.WriteString(strings.ToValidUTF8(string(carry), ""))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package textextract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func extractBytes(t *testing.T, name string, data []byte, limit int) string {
+	t.Helper()
+	text, err := Extract(bytes.NewReader(data), int64(len(data)), name, limit)
+	if err != nil {
+		t.Fatalf("extract %s: %v", name, err)
+	}
+	return text
+}
+
+func TestExtractPlainAndMarkdown(t *testing.T) {
+	text := extractBytes(t, "notes.md", []byte("# Title\n\n  Quarterly   report\r\n数据仓库\n"), 0)
+	if text != "# Title Quarterly report 数据仓库" {
+		t.Fatalf("text = %q", text)
+	}
+
+	if _, err := Extract(bytes.NewReader([]byte("a\x00b")), 3, "data.txt", 0); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("binary err = %v, want ErrUnsupported", err)
+	}
+	if _, err := Extract(bytes.NewReader(nil), 0, "photo.jpg", 0); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("jpg err = %v, want ErrUnsupported", err)
+	}
+	if !Supported("Report.PDF") || Supported("archive.zip") {
+		t.Fatal("unexpected Supported result")
+	}
+}
+
+func TestExtractLimitKeepsRuneBoundary(t *testing.T) {
+	text := extractBytes(t, "a.txt", []byte("ab 数据仓库"), 7)
+	if text != "ab 数" {
+		t.Fatalf("text = %q", text)
+	}
+}
+
+func TestExtractHTMLSkipsScripts(t *testing.T) {
+	page := `<html><head><title>Plan</title><style>p{color:red}</style></head>
+<body><p>Hello <b>wor</b>ld</p><script>var secret = 1;</script><div>Caf&eacute;</div></body></html>`
+	text := extractBytes(t, "index.html", []byte(page), 0)
+	if text != "Plan Hello world Café" {
+		t.Fatalf("text = %q", text)
+	}
+}
+
+func buildZip(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractOfficeDocuments(t *testing.T) {
+	docx := buildZip(t, map[string]string{
+		"[Content_Types].xml": `<Types/>`,
+		"word/document.xml": `<w:document xmlns:w="w"><w:body>
+<w:p><w:r><w:t>Budget</w:t></w:r><w:r><w:t xml:space="preserve"> review</w:t></w:r></w:p>
+<w:p><w:r><w:instrText>PAGE</w:instrText><w:t>Next</w:t></w:r></w:p></w:body></w:document>`,
+	})
+	if text := extractBytes(t, "a.docx", docx, 0); text != "Budget review Next" {
+		t.Fatalf("docx text = %q", text)
+	}
+
+	xlsx := buildZip(t, map[string]string{
+		"xl/sharedStrings.xml":     `<sst><si><t>Revenue</t></si><si><r><t>Cost</t></r><r><t>s</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData><row><c t="s"><v>0</v></c><c t="inlineStr"><is><t>Inline</t></is></c><c><v>42</v></c></row></sheetData></worksheet>`,
+		"xl/styles.xml":            `<styleSheet><t>ignored</t></styleSheet>`,
+	})
+	if text := extractBytes(t, "a.xlsx", xlsx, 0); text != "Revenue Costs Inline" {
+		t.Fatalf("xlsx text = %q", text)
+	}
+
+	pptx := buildZip(t, map[string]string{
+		"ppt/slides/slide10.xml": `<p:sld><a:p><a:r><a:t>Ten</a:t></a:r></a:p></p:sld>`,
+		"ppt/slides/slide2.xml":  `<p:sld><a:p><a:r><a:t>Two</a:t></a:r></a:p></p:sld>`,
+		"ppt/slides/slide1.xml":  `<p:sld><a:p><a:r><a:t>One</a:t></a:r></a:p></p:sld>`,
+	})
+	if text := extractBytes(t, "deck.pptx", pptx, 0); text != "One Two Ten" {
+		t.Fatalf("pptx text = %q", text)
+	}
+
+	if _, err := Extract(bytes.NewReader([]byte("not a zip")), 9, "a.docx", 0); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("broken docx err = %v, want ErrUnsupported", err)
+	}
+}
+
+// buildPDF assembles a PDF whose objects are numbered from 1 in order.
+func buildPDF(objects []string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	for i, body := range objects {
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func pdfStream(dict string, data []byte) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data string) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, _ = zw.Write([]byte(data))
+	_ = zw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractPDFTextLayer(t *testing.T) {
+	cmap := `/CIDInit /ProcSet findresource begin
+begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar
+<0001> <6570>
+<0002> <636E>
+endbfchar
+1 beginbfrange
+<0010> <0012> <0041>
+endbfrange
+endcmap`
+	page1 := "BT /F1 12 Tf 72 700 Td (Hello) Tj T* [(Wor) -20 (ld) -400 (again)] TJ ET"
+	page2 := "BT /F2 10 Tf <00010002> Tj 0 -14 Td <001000110012> Tj ET BT /F1 10 Tf (caf\\351 \\(draft\\)) Tj ET"
+	data := buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R] >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /SimSun /Encoding /Identity-H /ToUnicode 9 0 R >>",
+		pdfStream("/Filter /FlateDecode", deflate(page1)),
+		pdfStream("", []byte(page2)),
+		pdfStream("/Filter /FlateDecode", deflate(cmap)),
+	})
+
+	text := extractBytes(t, "doc.pdf", data, 0)
+	if text != "Hello World again 数据 ABC café (draft)" {
+		t.Fatalf("pdf text = %q", text)
+	}
+}
+
+func TestExtractPDFRejectsEncryptedAndImageOnly(t *testing.T) {
+	encrypted := []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog >>\nendobj\ntrailer << /Encrypt 2 0 R >>\n")
+	if _, err := Extract(bytes.NewReader(encrypted), int64(len(encrypted)), "a.pdf", 0); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("encrypted err = %v", err)
+	}
+
+	scanned := buildPDF([]string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		pdfStream("", []byte("q 612 0 0 792 0 0 cm BI /W 1 /H 1 /BPC 8 /CS /G ID \x00\xffEI Q EI\n Q")),
+	})
+	if text := extractBytes(t, "scan.pdf", scanned, 0); strings.TrimSpace(text) != "" {
+		t.Fatalf("scanned text = %q", text)
+	}
+}
@@ -0,0 +1,278 @@
+// Package thumbnail renders downscaled previews of images using pure-Go
+// decoders only, so no image libraries or helper binaries are needed on the
+// host.
+//
+// JPEG, PNG, GIF (first frame), WebP, BMP and TIFF sources are supported.
+// Opaque results are encoded as JPEG and results with transparency as PNG.
+// JPEG sources are rotated according to their EXIF orientation.
+package thumbnail
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"path"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/tiff"
+	"golang.org/x/image/webp"
+)
+
+var (
+	// ErrUnsupported is returned for files that are not a decodable image.
+	ErrUnsupported = errors.New("unsupported image")
+	// ErrTooLarge is returned when the source exceeds Options.MaxPixels.
+	ErrTooLarge = errors.New("image too large")
+)
+
+const (
+	ContentTypeJPEG = "image/jpeg"
+	ContentTypePNG  = "image/png"
+
+	defaultQuality = 80
+)
+
+// codec decodes one image format.
+type codec struct {
+	decode       func(io.Reader) (image.Image, error)
+	decodeConfig func(io.Reader) (image.Config, error)
+	// exif marks formats whose EXIF orientation is applied.
+	exif bool
+}
+
+var (
+	jpegCodec = codec{decode: jpeg.Decode, decodeConfig: jpeg.DecodeConfig, exif: true}
+	tiffCodec = codec{decode: tiff.Decode, decodeConfig: tiff.DecodeConfig}
+
+	// codecs maps lower-case file extensions to their decoder.
+	codecs = map[string]codec{
+		".jpg":  jpegCodec,
+		".jpeg": jpegCodec,
+		".jpe":  jpegCodec,
+		".jfif": jpegCodec,
+		".png":  {decode: png.Decode, decodeConfig: png.DecodeConfig},
+		".gif":  {decode: gif.Decode, decodeConfig: gif.DecodeConfig},
+		".webp": {decode: webp.Decode, decodeConfig: webp.DecodeConfig},
+		".bmp":  {decode: bmp.Decode, decodeConfig: bmp.DecodeConfig},
+		".tif":  tiffCodec,
+		".tiff": tiffCodec,
+	}
+)
+
+// Options bounds the work done for one thumbnail.
+type Options struct {
+	// MaxPixels rejects sources whose width*height exceeds it; 0 disables
+	// the check.
+	MaxPixels int64
+	// Quality is the JPEG quality (1-100); 0 selects the default.
+	Quality int
+}
+
+// Supported reports whether name has an extension Render can decode.
+func Supported(name string) bool {
+	_, ok := codecs[strings.ToLower(path.Ext(name))]
+	return ok
+}
+
+// Render decodes the image in r, scales it to fit an edge x edge box
+// without upscaling and writes the encoded thumbnail to w. name selects the
+// decoder by extension. It returns the content type that was written.
+func Render(w io.Writer, r io.ReadSeeker, name string, edge int, opts Options) (string, error) {
+	if edge <= 0 {
+		return "", fmt.Errorf("invalid thumbnail edge %d", edge)
+	}
+	format, ok := codecs[strings.ToLower(path.Ext(name))]
+	if !ok {
+		return "", ErrUnsupported
+	}
+
+	cfg, err := format.decodeConfig(bufio.NewReader(r))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return "", ErrUnsupported
+	}
+	if opts.MaxPixels > 0 && int64(cfg.Width)*int64(cfg.Height) > opts.MaxPixels {
+		return "", ErrTooLarge
+	}
+
+	orientation := 1
+	if format.exif {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return "", err
+		}
+		orientation = jpegOrientation(r)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	src, err := format.decode(bufio.NewReader(r))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+
+	dst := orient(scale(src, edge), orientation)
+	if dst.Opaque() {
+		quality := opts.Quality
+		if quality <= 0 || quality > 100 {
+			quality = defaultQuality
+		}
+		if err := jpeg.Encode(w, dst, &jpeg.Options{Quality: quality}); err != nil {
+			return "", err
+		}
+		return ContentTypeJPEG, nil
+	}
+	encoder := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := encoder.Encode(w, dst); err != nil {
+		return "", err
+	}
+	return ContentTypePNG, nil
+}
+
+// scale resamples src to fit an edge x edge box, keeping the aspect ratio.
+func scale(src image.Image, edge int) *image.NRGBA {
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > edge || height > edge {
+		if width >= height {
+			height = max(1, int(int64(height)*int64(edge)/int64(width)))
+			width = edge
+		} else {
+			width = max(1, int(int64(width)*int64(edge)/int64(height)))
+			height = edge
+		}
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	if width == bounds.Dx() && height == bounds.Dy() {
+		draw.Draw(dst, dst.Bounds(), src, bounds.Min, draw.Src)
+		return dst
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, bounds, draw.Src, nil)
+	return dst
+}
+
+// orient applies an EXIF orientation (2-8) to img.
+func orient(img *image.NRGBA, orientation int) *image.NRGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	// Orientations 5-8 swap the axes.
+	outW, outH := width, height
+	if orientation >= 5 {
+		outW, outH = height, width
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, outW, outH))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			dst.SetNRGBA(dx, dy, img.NRGBAAt(x, y))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation returns the EXIF orientation tag of the JPEG in r, or 1
+// when there is none. Only the segments before the image data are read.
+func jpegOrientation(r io.Reader) int {
+	br := bufio.NewReader(r)
+	var marker [2]byte
+	if _, err := io.ReadFull(br, marker[:]); err != nil || marker[0] != 0xFF || marker[1] != 0xD8 {
+		return 1
+	}
+	for {
+		if _, err := io.ReadFull(br, marker[:]); err != nil || marker[0] != 0xFF {
+			return 1
+		}
+		// Start of scan: no metadata follows.
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return 1
+		}
+		var lengthBytes [2]byte
+		if _, err := io.ReadFull(br, lengthBytes[:]); err != nil {
+			return 1
+		}
+		length := (int(lengthBytes[0])<<8 | int(lengthBytes[1])) - 2
+		if length < 0 {
+			return 1
+		}
+		if marker[1] != 0xE1 {
+			if _, err := br.Discard(length); err != nil {
+				return 1
+			}
+			continue
+		}
+		segment := make([]byte, length)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return 1
+		}
+		if orientation, ok := exifOrientation(segment); ok {
+			return orientation
+		}
+	}
+}
+
+// exifOrientation reads tag 0x0112 from IFD0 of an APP1 Exif segment.
+func exifOrientation(segment []byte) (int, bool) {
+	if len(segment) < 14 || string(segment[:6]) != "Exif\x00\x00" {
+		return 0, false
+	}
+	tiffData := segment[6:]
+	var u16 func([]byte) uint16
+	var u32 func([]byte) uint32
+	switch string(tiffData[:2]) {
+	case "II":
+		u16 = func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 }
+		u32 = func(b []byte) uint32 { return uint32(u16(b)) | uint32(u16(b[2:]))<<16 }
+	case "MM":
+		u16 = func(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) }
+		u32 = func(b []byte) uint32 { return uint32(u16(b))<<16 | uint32(u16(b[2:])) }
+	default:
+		return 0, false
+	}
+	offset := int(u32(tiffData[4:]))
+	if offset < 8 || offset+2 > len(tiffData) {
+		return 0, false
+	}
+	count := int(u16(tiffData[offset:]))
+	for i := 0; i < count; i++ {
+		entry := offset + 2 + i*12
+		if entry+12 > len(tiffData) {
+			return 0, false
+		}
+		if u16(tiffData[entry:]) != 0x0112 {
+			continue
+		}
+		value := int(u16(tiffData[entry+8:]))
+		if value < 1 || value > 8 {
+			return 0, false
+		}
+		return value, true
+	}
+	return 0, false
+}
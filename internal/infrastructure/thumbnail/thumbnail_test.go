@@ -0,0 +1,112 @@
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func render(t *testing.T, data []byte, name string, edge int, opts Options) (image.Image, string) {
+	t.Helper()
+	var out bytes.Buffer
+	contentType, err := Render(&out, bytes.NewReader(data), name, edge, opts)
+	if err != nil {
+		t.Fatalf("render %s: %v", name, err)
+	}
+	img, _, err := image.Decode(&out)
+	if err != nil {
+		t.Fatalf("decode thumbnail: %v", err)
+	}
+	return img, contentType
+}
+
+func TestRenderFitsBoxWithoutUpscaling(t *testing.T) {
+	img, contentType := render(t, encodeJPEG(t, 400, 200), "photo.JPG", 100, Options{})
+	if contentType != ContentTypeJPEG {
+		t.Fatalf("content type = %s", contentType)
+	}
+	if got := img.Bounds().Size(); got != image.Pt(100, 50) {
+		t.Fatalf("size = %v, want 100x50", got)
+	}
+
+	img, _ = render(t, encodeJPEG(t, 40, 30), "small.jpeg", 100, Options{})
+	if got := img.Bounds().Size(); got != image.Pt(40, 30) {
+		t.Fatalf("small size = %v, want 40x30", got)
+	}
+}
+
+func TestRenderKeepsTransparencyAsPNG(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	src.SetNRGBA(10, 10, color.NRGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	img, contentType := render(t, buf.Bytes(), "icon.png", 32, Options{})
+	if contentType != ContentTypePNG {
+		t.Fatalf("content type = %s, want png", contentType)
+	}
+	if _, _, _, a := img.At(31, 31).RGBA(); a != 0 {
+		t.Fatalf("corner alpha = %d, want transparent", a)
+	}
+}
+
+// withOrientation inserts an APP1 Exif segment carrying orientation after
+// the SOI marker of a JPEG.
+func withOrientation(data []byte, orientation byte) []byte {
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // big-endian header, IFD0 at 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0, // orientation, SHORT
+		0, 0, 0, 0, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	length := len(payload) + 2
+	segment := append([]byte{0xFF, 0xE1, byte(length >> 8), byte(length)}, payload...)
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func TestRenderAppliesEXIFOrientation(t *testing.T) {
+	rotated := withOrientation(encodeJPEG(t, 200, 100), 6)
+	img, _ := render(t, rotated, "phone.jpg", 100, Options{})
+	if got := img.Bounds().Size(); got != image.Pt(50, 100) {
+		t.Fatalf("rotated size = %v, want 50x100", got)
+	}
+}
+
+func TestRenderRejectsUnsupportedAndOversized(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := Render(&out, bytes.NewReader([]byte("not an image")), "a.png", 64, Options{}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("corrupt err = %v, want ErrUnsupported", err)
+	}
+	if _, err := Render(&out, bytes.NewReader(nil), "notes.txt", 64, Options{}); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("txt err = %v, want ErrUnsupported", err)
+	}
+	if _, err := Render(&out, bytes.NewReader(encodeJPEG(t, 100, 100)), "big.jpg", 64, Options{MaxPixels: 5000}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("oversized err = %v, want ErrTooLarge", err)
+	}
+	if !Supported("x.WebP") || Supported("x.svg") {
+		t.Fatal("unexpected Supported result")
+	}
+}
@@ -3,29 +3,42 @@ package webdavfs
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/yeying-community/warehouse/internal/infrastructure/atomicfile"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"golang.org/x/net/webdav"
 )
 
 // UnicodeFileSystem 包装 webdav.Dir 以正确支持 Unicode 路径
 type UnicodeFileSystem struct {
-	dir           string
-	virtualByDir  map[string][]virtualFileEntry
-	virtualByPath map[string]virtualFileEntry
+	dir              string
+	backend          storage.Backend
+	virtualByDir     map[string][]virtualFileEntry
+	virtualByPath    map[string]virtualFileEntry
+	virtualDirsByDir map[string][]virtualDirEntry
+	virtualDirByPath map[string]virtualDirEntry
+	names            pathname.Policy
 }
 
 // VirtualFile 是不落盘、只读展示在 WebDAV 目录中的文件。
+// 磁盘上不存在的上级目录会以只读虚拟目录的形式展示。
 type VirtualFile struct {
 	Path    string
 	Content []byte
-	ModTime time.Time
-	Mode    os.FileMode
+	// SourcePath 非空时从该磁盘文件读取内容（忽略 Content），Size 为其大小
+	SourcePath string
+	Size       int64
+	ModTime    time.Time
+	Mode       os.FileMode
+	// Dir 为 true 时表示一个（可以为空的）只读虚拟目录，仅使用 Path 与 ModTime
+	Dir bool
 }
 
 // NewUnicodeFileSystem 创建一个支持 Unicode 路径的 FileSystem
@@ -35,33 +48,93 @@ func NewUnicodeFileSystem(dir string) *UnicodeFileSystem {
 
 func NewUnicodeFileSystemWithVirtualFiles(dir string, virtualFiles []VirtualFile) *UnicodeFileSystem {
 	fsys := &UnicodeFileSystem{
-		dir:           dir,
-		virtualByDir:  make(map[string][]virtualFileEntry),
-		virtualByPath: make(map[string]virtualFileEntry),
+		dir:              dir,
+		backend:          storage.NewLocal(),
+		virtualByDir:     make(map[string][]virtualFileEntry),
+		virtualByPath:    make(map[string]virtualFileEntry),
+		virtualDirsByDir: make(map[string][]virtualDirEntry),
+		virtualDirByPath: make(map[string]virtualDirEntry),
 	}
 	for _, item := range virtualFiles {
+		if item.Dir {
+			if dir := normalizeFSPath(item.Path); dir != "/" {
+				modTime := item.ModTime
+				if modTime.IsZero() {
+					modTime = time.Unix(0, 0).UTC()
+				}
+				fsys.addVirtualParents(dir, modTime)
+			}
+			continue
+		}
 		entry, ok := newVirtualFileEntry(item)
 		if !ok {
 			continue
 		}
 		fsys.virtualByPath[entry.path] = entry
 		fsys.virtualByDir[entry.parent] = append(fsys.virtualByDir[entry.parent], entry)
+		fsys.addVirtualParents(entry.parent, entry.modTime)
 	}
 	return fsys
 }
 
+// SetNamePolicy 设置文件名规范化策略（NFC / 大小写冲突保护），默认保持原样
+func (fsys *UnicodeFileSystem) SetNamePolicy(policy pathname.Policy) {
+	fsys.names = policy
+}
+
+// namePolicy 返回在当前存储后端上查找已有条目的文件名策略
+func (fsys *UnicodeFileSystem) namePolicy() pathname.Policy {
+	if fsys.names.FS != nil {
+		return fsys.names
+	}
+	return fsys.names.WithFS(fsys.backend)
+}
+
+// SetBackend 设置文件内容所在的存储后端，默认为本地磁盘
+func (fsys *UnicodeFileSystem) SetBackend(backend storage.Backend) {
+	if backend != nil {
+		fsys.backend = backend
+	}
+}
+
+// addVirtualParents 登记虚拟文件的各级上级目录，目录修改时间取其中最新的文件
+func (fsys *UnicodeFileSystem) addVirtualParents(dir string, modTime time.Time) {
+	for dir != "/" {
+		if existing, ok := fsys.virtualDirByPath[dir]; ok {
+			if modTime.After(existing.modTime) {
+				existing.modTime = modTime
+				fsys.virtualDirByPath[dir] = existing
+				siblings := fsys.virtualDirsByDir[existing.parent]
+				for i := range siblings {
+					if siblings[i].path == dir {
+						siblings[i].modTime = modTime
+					}
+				}
+			}
+		} else {
+			entry := virtualDirEntry{path: dir, parent: path.Dir(dir), name: path.Base(dir), modTime: modTime}
+			fsys.virtualDirByPath[dir] = entry
+			fsys.virtualDirsByDir[entry.parent] = append(fsys.virtualDirsByDir[entry.parent], entry)
+		}
+		dir = path.Dir(dir)
+	}
+}
+
 // Stat 返回文件信息
 func (fsys *UnicodeFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
 	baseName := path.Base(strings.TrimSuffix(filepath.ToSlash(name), "/"))
 	if IsIgnoredName(baseName) {
 		return nil, os.ErrNotExist
 	}
-	fullPath := filepath.Join(fsys.dir, name)
-	info, err := os.Stat(fullPath)
+	fullPath := fsys.resolve(name)
+	info, err := fsys.backend.Stat(fullPath)
 	if err != nil {
 		if entry, ok := fsys.virtualEntryIfNoRealFile(name, err); ok {
 			return entry.fileInfo(), nil
 		}
+		if dir, ok := fsys.virtualDirIfNoRealFile(name, err); ok {
+			return dir.fileInfo(), nil
+		}
 		return nil, err
 	}
 	return &fileInfo{FileInfo: info, name: baseName}, nil
@@ -73,7 +146,8 @@ func (fsys *UnicodeFileSystem) OpenFile(ctx context.Context, name string, flag i
 	if IsIgnoredName(baseName) {
 		return nil, os.ErrNotExist
 	}
-	fullPath := filepath.Join(fsys.dir, name)
+	name = fsys.names.Normalize(name)
+	fullPath := fsys.resolve(name)
 	if entry, ok, err := fsys.virtualEntryForOpen(name, fullPath); ok || err != nil {
 		if err != nil {
 			return nil, err
@@ -81,12 +155,32 @@ func (fsys *UnicodeFileSystem) OpenFile(ctx context.Context, name string, flag i
 		if opensForWrite(flag) {
 			return nil, os.ErrPermission
 		}
-		return entry.open(), nil
+		return entry.open(fsys.backend)
+	}
+	if dir, ok := fsys.virtualDirForOpen(name, fullPath); ok {
+		if opensForWrite(flag) {
+			return nil, os.ErrPermission
+		}
+		return fsys.openVirtualDir(dir), nil
+	}
+	if opensForWrite(flag) && fsys.isUnderVirtualOnlyDir(name) {
+		return nil, os.ErrPermission
+	}
+	if flag&os.O_CREATE != 0 {
+		if err := fsys.namePolicy().CheckCollision(fullPath); err != nil {
+			return nil, err
+		}
 	}
 	if shouldAtomicWrite(flag) {
 		return fsys.openAtomicWriteFile(fullPath, name, perm)
 	}
-	f, err := os.OpenFile(fullPath, flag, perm)
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_TRUNC|os.O_APPEND) != 0 {
+		// 原地写入前与去重存储中的其他引用断开硬链接
+		if err := storage.Detach(fsys.backend, fullPath); err != nil {
+			return nil, err
+		}
+	}
+	f, err := fsys.backend.OpenFile(fullPath, flag, perm)
 	if err != nil {
 		return nil, err
 	}
@@ -94,6 +188,7 @@ func (fsys *UnicodeFileSystem) OpenFile(ctx context.Context, name string, flag i
 		File:           f,
 		name:           filepath.ToSlash(name),
 		virtualEntries: fsys.virtualByDir[normalizeFSPath(name)],
+		virtualDirs:    fsys.virtualDirsByDir[normalizeFSPath(name)],
 	}, nil
 }
 
@@ -108,11 +203,14 @@ func (fsys *UnicodeFileSystem) Mkdir(ctx context.Context, name string, perm os.F
 	if IsIgnoredName(baseName) {
 		return os.ErrNotExist
 	}
-	if fsys.isVirtualOnly(name) {
+	if fsys.isVirtualOnly(name) || fsys.isUnderVirtualOnlyDir(name) {
 		return os.ErrPermission
 	}
-	fullPath := filepath.Join(fsys.dir, name)
-	return os.MkdirAll(fullPath, perm)
+	fullPath := fsys.resolve(name)
+	if err := fsys.namePolicy().CheckCollision(fullPath); err != nil {
+		return err
+	}
+	return fsys.backend.MkdirAll(fullPath, perm)
 }
 
 // Rename 重命名/移动文件
@@ -122,12 +220,19 @@ func (fsys *UnicodeFileSystem) Rename(ctx context.Context, oldName, newName stri
 	if IsIgnoredName(oldBase) || IsIgnoredName(newBase) {
 		return os.ErrNotExist
 	}
-	if fsys.isVirtualOnly(oldName) || fsys.isVirtualOnly(newName) {
+	if fsys.isVirtualOnly(oldName) || fsys.isVirtualOnly(newName) || fsys.isUnderVirtualOnlyDir(newName) {
 		return os.ErrPermission
 	}
-	oldPath := filepath.Join(fsys.dir, oldName)
-	newPath := filepath.Join(fsys.dir, newName)
-	return os.Rename(oldPath, newPath)
+	oldPath := fsys.resolve(oldName)
+	newPath := fsys.resolve(newName)
+	if err := fsys.namePolicy().CheckCollision(newPath); err != nil {
+		// 仅大小写不同的重命名（a.txt -> A.txt）命中的是自身，允许执行
+		var collision *pathname.CollisionError
+		if !errors.As(err, &collision) || collision.Existing != oldPath {
+			return err
+		}
+	}
+	return fsys.backend.Rename(oldPath, newPath)
 }
 
 // RemoveAll 删除文件或目录
@@ -139,15 +244,17 @@ func (fsys *UnicodeFileSystem) RemoveAll(ctx context.Context, name string) error
 	if fsys.isVirtualOnly(name) {
 		return os.ErrPermission
 	}
-	fullPath := filepath.Join(fsys.dir, name)
-	return os.RemoveAll(fullPath)
+	return fsys.backend.RemoveAll(fsys.resolve(name))
 }
 
 // ReadDir 读取目录内容
 func (fsys *UnicodeFileSystem) ReadDir(ctx context.Context, name string) ([]os.FileInfo, error) {
-	fullPath := filepath.Join(fsys.dir, name)
-	entries, err := os.ReadDir(fullPath)
+	fullPath := fsys.resolve(name)
+	entries, err := fsys.backend.ReadDir(fullPath)
 	if err != nil {
+		if _, ok := fsys.virtualDirIfNoRealFile(name, err); ok {
+			return fsys.virtualChildren(name, nil), nil
+		}
 		return nil, err
 	}
 
@@ -164,13 +271,26 @@ func (fsys *UnicodeFileSystem) ReadDir(ctx context.Context, name string) ([]os.F
 		seen[entry.Name()] = struct{}{}
 		infos = append(infos, &fileInfo{FileInfo: info, name: entry.Name()})
 	}
-	for _, entry := range fsys.virtualByDir[normalizeFSPath(name)] {
+	return append(infos, fsys.virtualChildren(name, seen)...), nil
+}
+
+// virtualChildren 返回目录下的虚拟文件与虚拟子目录，跳过 seen 中已有的真实条目
+func (fsys *UnicodeFileSystem) virtualChildren(name string, seen map[string]struct{}) []os.FileInfo {
+	dir := normalizeFSPath(name)
+	var infos []os.FileInfo
+	for _, entry := range fsys.virtualDirsByDir[dir] {
 		if _, ok := seen[entry.name]; ok {
 			continue
 		}
 		infos = append(infos, entry.fileInfo())
 	}
-	return infos, nil
+	for _, entry := range fsys.virtualByDir[dir] {
+		if _, ok := seen[entry.name]; ok {
+			continue
+		}
+		infos = append(infos, entry.fileInfo())
+	}
+	return infos
 }
 
 func (fsys *UnicodeFileSystem) virtualEntryIfNoRealFile(name string, statErr error) (virtualFileEntry, bool) {
@@ -181,12 +301,48 @@ func (fsys *UnicodeFileSystem) virtualEntryIfNoRealFile(name string, statErr err
 	return entry, ok
 }
 
+func (fsys *UnicodeFileSystem) virtualDirIfNoRealFile(name string, statErr error) (virtualDirEntry, bool) {
+	if !os.IsNotExist(statErr) {
+		return virtualDirEntry{}, false
+	}
+	entry, ok := fsys.virtualDirByPath[normalizeFSPath(name)]
+	return entry, ok
+}
+
+func (fsys *UnicodeFileSystem) virtualDirForOpen(name, fullPath string) (virtualDirEntry, bool) {
+	entry, ok := fsys.virtualDirByPath[normalizeFSPath(name)]
+	if !ok {
+		return virtualDirEntry{}, false
+	}
+	if _, err := fsys.backend.Stat(fullPath); !os.IsNotExist(err) {
+		return virtualDirEntry{}, false
+	}
+	return entry, true
+}
+
+func (fsys *UnicodeFileSystem) openVirtualDir(dir virtualDirEntry) webdav.File {
+	return &virtualDirFile{info: dir.fileInfo(), children: fsys.virtualChildren(dir.path, nil)}
+}
+
+// isUnderVirtualOnlyDir 判断 name 是否位于磁盘上不存在的虚拟目录中
+func (fsys *UnicodeFileSystem) isUnderVirtualOnlyDir(name string) bool {
+	if len(fsys.virtualDirByPath) == 0 {
+		return false
+	}
+	for dir := path.Dir(normalizeFSPath(name)); dir != "/"; dir = path.Dir(dir) {
+		if _, ok := fsys.virtualDirForOpen(dir, fsys.resolve(dir)); ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (fsys *UnicodeFileSystem) virtualEntryForOpen(name, fullPath string) (virtualFileEntry, bool, error) {
 	entry, ok := fsys.virtualByPath[normalizeFSPath(name)]
 	if !ok {
 		return virtualFileEntry{}, false, nil
 	}
-	if _, err := os.Stat(fullPath); err == nil {
+	if _, err := fsys.backend.Stat(fullPath); err == nil {
 		return virtualFileEntry{}, false, nil
 	} else if !os.IsNotExist(err) {
 		return virtualFileEntry{}, false, err
@@ -194,8 +350,17 @@ func (fsys *UnicodeFileSystem) virtualEntryForOpen(name, fullPath string) (virtu
 	return entry, true, nil
 }
 
+// resolve 将请求路径规范化（NFC）后映射到磁盘路径，兼容历史遗留的 NFD 文件名
+func (fsys *UnicodeFileSystem) resolve(name string) string {
+	fullPath := filepath.Join(fsys.dir, fsys.names.Normalize(name))
+	return fsys.namePolicy().Resolve(fsys.dir, fullPath)
+}
+
 func (fsys *UnicodeFileSystem) isVirtualOnly(name string) bool {
-	fullPath := filepath.Join(fsys.dir, name)
+	fullPath := fsys.resolve(name)
+	if _, ok := fsys.virtualDirForOpen(name, fullPath); ok {
+		return true
+	}
 	_, ok, err := fsys.virtualEntryForOpen(name, fullPath)
 	return ok && err == nil
 }
@@ -205,12 +370,14 @@ func opensForWrite(flag int) bool {
 }
 
 type virtualFileEntry struct {
-	path    string
-	parent  string
-	name    string
-	content []byte
-	modTime time.Time
-	mode    os.FileMode
+	path       string
+	parent     string
+	name       string
+	content    []byte
+	sourcePath string
+	size       int64
+	modTime    time.Time
+	mode       os.FileMode
 }
 
 func newVirtualFileEntry(item VirtualFile) (virtualFileEntry, bool) {
@@ -230,29 +397,59 @@ func newVirtualFileEntry(item VirtualFile) (virtualFileEntry, bool) {
 	if mode == 0 {
 		mode = 0444
 	}
-	return virtualFileEntry{
+	entry := virtualFileEntry{
 		path:    virtualPath,
 		parent:  path.Dir(virtualPath),
 		name:    name,
-		content: append([]byte(nil), item.Content...),
 		modTime: modTime,
 		mode:    mode,
-	}, true
+	}
+	if item.SourcePath != "" {
+		entry.sourcePath = item.SourcePath
+		entry.size = item.Size
+	} else {
+		entry.content = append([]byte(nil), item.Content...)
+		entry.size = int64(len(entry.content))
+	}
+	return entry, true
 }
 
 func (entry virtualFileEntry) fileInfo() os.FileInfo {
 	return virtualFileInfo{
 		name:    entry.name,
-		size:    int64(len(entry.content)),
+		size:    entry.size,
 		mode:    entry.mode,
 		modTime: entry.modTime,
 	}
 }
 
-func (entry virtualFileEntry) open() webdav.File {
+func (entry virtualFileEntry) open(backend storage.Backend) (webdav.File, error) {
+	if entry.sourcePath != "" {
+		f, err := backend.Open(entry.sourcePath)
+		if err != nil {
+			return nil, err
+		}
+		return &virtualSourceFile{File: f, info: entry.fileInfo()}, nil
+	}
 	return &virtualOpenFile{
 		reader: bytes.NewReader(entry.content),
 		info:   entry.fileInfo(),
+	}, nil
+}
+
+type virtualDirEntry struct {
+	path    string
+	parent  string
+	name    string
+	modTime time.Time
+}
+
+func (entry virtualDirEntry) fileInfo() os.FileInfo {
+	return virtualFileInfo{
+		name:    entry.name,
+		mode:    os.ModeDir | 0555,
+		modTime: entry.modTime,
+		isDir:   true,
 	}
 }
 
@@ -261,13 +458,14 @@ type virtualFileInfo struct {
 	size    int64
 	mode    os.FileMode
 	modTime time.Time
+	isDir   bool
 }
 
 func (info virtualFileInfo) Name() string       { return info.name }
 func (info virtualFileInfo) Size() int64        { return info.size }
 func (info virtualFileInfo) Mode() os.FileMode  { return info.mode }
 func (info virtualFileInfo) ModTime() time.Time { return info.modTime }
-func (info virtualFileInfo) IsDir() bool        { return false }
+func (info virtualFileInfo) IsDir() bool        { return info.isDir }
 func (info virtualFileInfo) Sys() any           { return nil }
 
 type virtualOpenFile struct {
@@ -284,6 +482,44 @@ func (file *virtualOpenFile) Readdir(count int) ([]os.FileInfo, error) { return
 func (file *virtualOpenFile) Stat() (os.FileInfo, error)               { return file.info, nil }
 func (file *virtualOpenFile) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
 
+// virtualSourceFile 以只读方式暴露存储后端中的源文件
+type virtualSourceFile struct {
+	storage.File
+	info os.FileInfo
+}
+
+func (file *virtualSourceFile) Readdir(count int) ([]os.FileInfo, error) { return nil, os.ErrInvalid }
+func (file *virtualSourceFile) Stat() (os.FileInfo, error)               { return file.info, nil }
+func (file *virtualSourceFile) Write(p []byte) (int, error)              { return 0, os.ErrPermission }
+
+// virtualDirFile 是只读虚拟目录
+type virtualDirFile struct {
+	info     os.FileInfo
+	children []os.FileInfo
+	offset   int
+}
+
+func (file *virtualDirFile) Close() error                                 { return nil }
+func (file *virtualDirFile) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (file *virtualDirFile) Seek(offset int64, whence int) (int64, error) { return 0, os.ErrInvalid }
+func (file *virtualDirFile) Stat() (os.FileInfo, error)                   { return file.info, nil }
+func (file *virtualDirFile) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (file *virtualDirFile) Readdir(count int) ([]os.FileInfo, error) {
+	rest := file.children[file.offset:]
+	if count <= 0 {
+		file.offset = len(file.children)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(rest) {
+		count = len(rest)
+	}
+	file.offset += count
+	return rest[:count], nil
+}
+
 func normalizeFSPath(name string) string {
 	name = strings.TrimSpace(filepath.ToSlash(name))
 	if name == "" {
@@ -305,11 +541,12 @@ func (fi *fileInfo) Name() string {
 	return fi.name
 }
 
-// file 包装 os.File
+// file 包装存储后端打开的文件
 type file struct {
-	*os.File
+	storage.File
 	name           string
 	virtualEntries []virtualFileEntry
+	virtualDirs    []virtualDirEntry
 }
 
 func (f *file) Name() string {
@@ -318,7 +555,7 @@ func (f *file) Name() string {
 
 func (f *file) Readdir(count int) ([]os.FileInfo, error) {
 	infos, err := f.File.Readdir(count)
-	if err != nil || count > 0 || len(f.virtualEntries) == 0 {
+	if err != nil || count > 0 || (len(f.virtualEntries) == 0 && len(f.virtualDirs) == 0) {
 		return infos, err
 	}
 
@@ -326,6 +563,12 @@ func (f *file) Readdir(count int) ([]os.FileInfo, error) {
 	for _, info := range infos {
 		seen[info.Name()] = struct{}{}
 	}
+	for _, entry := range f.virtualDirs {
+		if _, ok := seen[entry.name]; ok {
+			continue
+		}
+		infos = append(infos, entry.fileInfo())
+	}
 	for _, entry := range f.virtualEntries {
 		if _, ok := seen[entry.name]; ok {
 			continue
@@ -336,7 +579,7 @@ func (f *file) Readdir(count int) ([]os.FileInfo, error) {
 }
 
 type atomicWriteFile struct {
-	*atomicfile.File
+	storage.AtomicFile
 	name string
 }
 
@@ -344,6 +587,10 @@ func (f *atomicWriteFile) Name() string {
 	return f.name
 }
 
+func (f *atomicWriteFile) Readdir(count int) ([]os.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
 func shouldAtomicWrite(flag int) bool {
 	writeFlags := os.O_WRONLY | os.O_RDWR
 	requiredFlags := os.O_CREATE | os.O_TRUNC
@@ -351,13 +598,13 @@ func shouldAtomicWrite(flag int) bool {
 }
 
 func (fsys *UnicodeFileSystem) openAtomicWriteFile(fullPath, name string, perm os.FileMode) (webdav.File, error) {
-	tempFile, err := atomicfile.Open(fullPath, perm)
+	tempFile, err := fsys.backend.CreateAtomic(fullPath, perm)
 	if err != nil {
 		return nil, err
 	}
 	return &atomicWriteFile{
-		File: tempFile,
-		name: filepath.ToSlash(name),
+		AtomicFile: tempFile,
+		name:       filepath.ToSlash(name),
 	}, nil
 }
 
@@ -11,6 +11,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
+	"github.com/yeying-community/warehouse/internal/infrastructure/atomicfile"
 	xwebdav "golang.org/x/net/webdav"
 )
 
@@ -69,6 +71,84 @@ func TestVirtualFileIsVisibleReadableAndReadOnly(t *testing.T) {
 	}
 }
 
+func TestVirtualSourceFilesFormReadOnlyDirectoryTree(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	source := filepath.Join(t.TempDir(), "blob")
+	if err := os.WriteFile(source, []byte("old content"), 0o644); err != nil {
+		t.Fatalf("write source: %v", err)
+	}
+
+	fsys := NewUnicodeFileSystemWithVirtualFiles(root, []VirtualFile{{
+		Path:       "/.versions/docs/a.txt/v1.txt",
+		SourcePath: source,
+		Size:       int64(len("old content")),
+		ModTime:    time.Unix(20, 0).UTC(),
+	}})
+
+	rootEntries, err := fsys.ReadDir(ctx, "/")
+	if err != nil {
+		t.Fatalf("read root: %v", err)
+	}
+	if !hasFileInfo(rootEntries, ".versions") {
+		t.Fatalf("expected virtual .versions directory in root listing, got %#v", rootEntries)
+	}
+	info, err := fsys.Stat(ctx, "/.versions/docs/a.txt")
+	if err != nil || !info.IsDir() || !info.ModTime().Equal(time.Unix(20, 0).UTC()) {
+		t.Fatalf("unexpected virtual dir info %#v, err=%v", info, err)
+	}
+
+	dir, err := fsys.OpenFile(ctx, "/.versions/docs", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("open virtual dir: %v", err)
+	}
+	entries, err := dir.Readdir(0)
+	if err != nil || !hasFileInfo(entries, "a.txt") {
+		t.Fatalf("unexpected virtual dir entries %#v, err=%v", entries, err)
+	}
+
+	file, err := fsys.OpenFile(ctx, "/.versions/docs/a.txt/v1.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("open virtual source file: %v", err)
+	}
+	content, err := io.ReadAll(file)
+	_ = file.Close()
+	if err != nil || string(content) != "old content" {
+		t.Fatalf("unexpected virtual source content %q, err=%v", content, err)
+	}
+
+	if _, err := fsys.OpenFile(ctx, "/.versions/docs/new.txt", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected create inside virtual dir denied, got %v", err)
+	}
+	if err := fsys.Mkdir(ctx, "/.versions/docs/sub", 0o755); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected mkdir inside virtual dir denied, got %v", err)
+	}
+	if err := fsys.RemoveAll(ctx, "/.versions"); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected remove of virtual dir denied, got %v", err)
+	}
+}
+
+func TestVirtualDirEntryIsListedWithoutFiles(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	fsys := NewUnicodeFileSystemWithVirtualFiles(t.TempDir(), []VirtualFile{{Path: "/.versions", Dir: true}})
+
+	rootEntries, err := fsys.ReadDir(ctx, "/")
+	if err != nil || !hasFileInfo(rootEntries, ".versions") {
+		t.Fatalf("expected virtual .versions directory in root listing, got %#v, err=%v", rootEntries, err)
+	}
+	info, err := fsys.Stat(ctx, "/.versions")
+	if err != nil || !info.IsDir() {
+		t.Fatalf("unexpected virtual dir info %#v, err=%v", info, err)
+	}
+	if err := fsys.Mkdir(ctx, "/.versions/sub", 0o755); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("expected mkdir inside virtual dir denied, got %v", err)
+	}
+}
+
 func TestVirtualFileAppearsInPropfind(t *testing.T) {
 	t.Parallel()
 
@@ -269,8 +349,12 @@ func TestAtomicWriteFileRemovesTempOnCloseWithoutCommit(t *testing.T) {
 		t.Fatalf("write temp file: %v", err)
 	}
 
-	tempPath := af.File.TempPath()
-	if err := af.File.File.Close(); err != nil {
+	tempFile, ok := af.AtomicFile.(*atomicfile.File)
+	if !ok {
+		t.Fatalf("expected local atomic file, got %T", af.AtomicFile)
+	}
+	tempPath := tempFile.TempPath()
+	if err := tempFile.File.Close(); err != nil {
 		t.Fatalf("close underlying file: %v", err)
 	}
 	if err := af.Close(); err == nil {
@@ -314,3 +398,37 @@ func TestAtomicWriteFileSupportsReadBeforeClose(t *testing.T) {
 		t.Fatalf("expected roundtrip content, got %q", string(content))
 	}
 }
+
+func TestUnicodeFileSystemNormalizesNamesAndGuardsCaseCollisions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	root := t.TempDir()
+	legacy := filepath.Join(root, "cafe\u0301.txt")
+	if err := os.WriteFile(legacy, []byte("legacy"), 0o644); err != nil {
+		t.Fatalf("write legacy file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "Report.txt"), []byte("report"), 0o644); err != nil {
+		t.Fatalf("write report: %v", err)
+	}
+	fsys := NewUnicodeFileSystem(root)
+	fsys.SetNamePolicy(pathname.Policy{NFC: true, CaseInsensitive: true})
+
+	// NFC 请求命中历史遗留的 NFD 文件
+	if _, err := fsys.Stat(ctx, "/caf\u00e9.txt"); err != nil {
+		t.Fatalf("stat NFC name of legacy NFD file: %v", err)
+	}
+
+	if _, err := fsys.OpenFile(ctx, "/REPORT.txt", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644); !errors.Is(err, pathname.ErrCaseCollision) {
+		t.Fatalf("expected case collision on create, got %v", err)
+	}
+	if err := fsys.Mkdir(ctx, "/report.TXT", 0o755); !errors.Is(err, pathname.ErrCaseCollision) {
+		t.Fatalf("expected case collision on mkdir, got %v", err)
+	}
+	if err := fsys.Rename(ctx, "/Report.txt", "/report.txt"); err != nil {
+		t.Fatalf("case-only rename of the same entry must succeed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "report.txt")); err != nil {
+		t.Fatalf("renamed file missing: %v", err)
+	}
+}
@@ -0,0 +1,226 @@
+package webdavfs
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+var errInvalidIfHeader = errors.New("webdav: invalid If header")
+
+// ConfirmLocks 按 webdav.Handler 的规则校验 If 头与锁：未携带 If 头时以临时锁探测
+// src / dst 是否被他人锁定；携带时任一条件列表通过即可。prefix 用于剥离带资源标签的 URL。
+// 成功时返回的 release 必须在写入结束后调用。
+func ConfirmLocks(ls webdav.LockSystem, r *http.Request, prefix, src, dst string) (release func(), status int, err error) {
+	hdr := r.Header.Get("If")
+	if hdr == "" {
+		now, srcToken, dstToken := time.Now(), "", ""
+		if src != "" {
+			srcToken, status, err = createProbeLock(ls, now, src)
+			if err != nil {
+				return nil, status, err
+			}
+		}
+		if dst != "" {
+			dstToken, status, err = createProbeLock(ls, now, dst)
+			if err != nil {
+				if srcToken != "" {
+					_ = ls.Unlock(now, srcToken)
+				}
+				return nil, status, err
+			}
+		}
+		return func() {
+			if dstToken != "" {
+				_ = ls.Unlock(now, dstToken)
+			}
+			if srcToken != "" {
+				_ = ls.Unlock(now, srcToken)
+			}
+		}, 0, nil
+	}
+
+	lists, ok := parseIfHeader(hdr)
+	if !ok {
+		return nil, http.StatusBadRequest, errInvalidIfHeader
+	}
+	for _, l := range lists {
+		lsrc := l.resourceTag
+		if lsrc == "" {
+			lsrc = src
+		} else {
+			u, err := url.Parse(lsrc)
+			if err != nil || u.Host != r.Host {
+				continue
+			}
+			stripped := strings.TrimPrefix(u.Path, prefix)
+			if prefix != "" && len(stripped) == len(u.Path) {
+				return nil, http.StatusNotFound, errors.New("webdav: prefix mismatch")
+			}
+			lsrc = stripped
+		}
+		release, err = ls.Confirm(time.Now(), lsrc, dst, l.conditions...)
+		if errors.Is(err, webdav.ErrConfirmationFailed) {
+			continue
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		return release, 0, nil
+	}
+	return nil, http.StatusPreconditionFailed, webdav.ErrLocked
+}
+
+func createProbeLock(ls webdav.LockSystem, now time.Time, root string) (string, int, error) {
+	token, err := ls.Create(now, webdav.LockDetails{
+		Root:      root,
+		Duration:  -1,
+		ZeroDepth: true,
+	})
+	if err != nil {
+		if errors.Is(err, webdav.ErrLocked) {
+			return "", webdav.StatusLocked, err
+		}
+		return "", http.StatusInternalServerError, err
+	}
+	return token, 0, nil
+}
+
+// ifList is one parenthesised condition list of an If header, optionally
+// scoped to a resource tag. The header as a whole is an OR of these lists.
+type ifList struct {
+	resourceTag string
+	conditions  []webdav.Condition
+}
+
+// parseIfHeader parses an RFC 4918 section 10.4 If header the same way
+// golang.org/x/net/webdav does; that parser is not exported.
+func parseIfHeader(header string) ([]ifList, bool) {
+	s := strings.TrimSpace(header)
+	tagged := false
+	switch tokenType, _, _ := lexIf(s); tokenType {
+	case '(':
+	case ifAngleToken:
+		tagged = true
+	default:
+		return nil, false
+	}
+	var lists []ifList
+	resourceTag, n := "", 0
+	for first := true; ; first = false {
+		tokenType, tokenStr, remaining := lexIf(s)
+		switch {
+		case tokenType == ifAngleToken && tagged:
+			if !first && n == 0 {
+				return nil, false
+			}
+			resourceTag, n = tokenStr, 0
+			s = remaining
+		case tokenType == '(':
+			n++
+			l, rest, ok := parseIfList(s)
+			if !ok {
+				return nil, false
+			}
+			l.resourceTag = resourceTag
+			lists = append(lists, l)
+			if rest == "" {
+				return lists, true
+			}
+			s = rest
+		default:
+			return nil, false
+		}
+	}
+}
+
+func parseIfList(s string) (ifList, string, bool) {
+	tokenType, _, s := lexIf(s)
+	if tokenType != '(' {
+		return ifList{}, "", false
+	}
+	var l ifList
+	for {
+		tokenType, _, remaining := lexIf(s)
+		if tokenType == ')' {
+			if len(l.conditions) == 0 {
+				return ifList{}, "", false
+			}
+			return l, remaining, true
+		}
+		c, remaining, ok := parseIfCondition(s)
+		if !ok {
+			return ifList{}, "", false
+		}
+		l.conditions = append(l.conditions, c)
+		s = remaining
+	}
+}
+
+func parseIfCondition(s string) (webdav.Condition, string, bool) {
+	var c webdav.Condition
+	tokenType, tokenStr, s := lexIf(s)
+	if tokenType == ifNotToken {
+		c.Not = true
+		tokenType, tokenStr, s = lexIf(s)
+	}
+	switch tokenType {
+	case ifStrToken, ifAngleToken:
+		c.Token = tokenStr
+	case ifSquareToken:
+		c.ETag = tokenStr
+	default:
+		return webdav.Condition{}, "", false
+	}
+	return c, s, true
+}
+
+const (
+	ifErrToken    = rune(-1)
+	ifEOFToken    = rune(-2)
+	ifStrToken    = rune(-3)
+	ifNotToken    = rune(-4)
+	ifAngleToken  = rune(-5)
+	ifSquareToken = rune(-6)
+)
+
+func lexIf(s string) (tokenType rune, tokenStr string, remaining string) {
+	for len(s) > 0 && (s[0] == '\t' || s[0] == ' ') {
+		s = s[1:]
+	}
+	if len(s) == 0 {
+		return ifEOFToken, "", ""
+	}
+	i := 0
+loop:
+	for ; i < len(s); i++ {
+		switch s[i] {
+		case '\t', ' ', '(', ')', '<', '>', '[', ']':
+			break loop
+		}
+	}
+	if i != 0 {
+		tokenStr, remaining = s[:i], s[i:]
+		if tokenStr == "Not" {
+			return ifNotToken, "", remaining
+		}
+		return ifStrToken, tokenStr, remaining
+	}
+	j := 0
+	switch s[0] {
+	case '<':
+		j, tokenType = strings.IndexByte(s, '>'), ifAngleToken
+	case '[':
+		j, tokenType = strings.IndexByte(s, ']'), ifSquareToken
+	default:
+		return rune(s[0]), "", s[1:]
+	}
+	if j < 0 {
+		return ifErrToken, "", ""
+	}
+	return tokenType, s[1:j], s[j+1:]
+}
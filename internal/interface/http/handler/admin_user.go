@@ -18,6 +18,7 @@ type AdminUserHandler struct {
 	userRepository    user.Repository
 	passwordHasher    *crypto.PasswordHasher
 	assetSpaceManager *assetspace.Manager
+	volumePlacer      user.VolumePlacer
 }
 
 // NewAdminUserHandler creates a new AdminUserHandler.
@@ -30,10 +31,16 @@ func NewAdminUserHandler(logger *zap.Logger, userRepo user.Repository, assetSpac
 	}
 }
 
+// SetVolumePlacer sets the volume placer used for new users.
+func (h *AdminUserHandler) SetVolumePlacer(placer user.VolumePlacer) {
+	h.volumePlacer = placer
+}
+
 type adminRuleRequest struct {
-	Path        string   `json:"path"`
-	Permissions []string `json:"permissions"`
-	Regex       bool     `json:"regex"`
+	Path         string             `json:"path"`
+	Permissions  []string           `json:"permissions"`
+	Regex        bool               `json:"regex"`
+	UploadPolicy *user.UploadPolicy `json:"upload_policy,omitempty"`
 }
 
 type adminUserCreateRequest struct {
@@ -45,6 +52,9 @@ type adminUserCreateRequest struct {
 	Permissions   []string           `json:"permissions,omitempty"`
 	Quota         *int64             `json:"quota,omitempty"`
 	Rules         []adminRuleRequest `json:"rules,omitempty"`
+	UploadPolicy  *user.UploadPolicy `json:"upload_policy,omitempty"`
+	// RecycleRetentionDays 回收站保留天数，0 沿用全局配置，负数表示永久保留
+	RecycleRetentionDays *int `json:"recycle_retention_days,omitempty"`
 }
 
 type adminUserUpdateRequest struct {
@@ -56,6 +66,9 @@ type adminUserUpdateRequest struct {
 	Permissions   []string            `json:"permissions,omitempty"`
 	Quota         *int64              `json:"quota,omitempty"`
 	Rules         *[]adminRuleRequest `json:"rules,omitempty"`
+	// UploadPolicy 传入空对象 {} 表示清除用户级上传策略
+	UploadPolicy         *user.UploadPolicy `json:"upload_policy,omitempty"`
+	RecycleRetentionDays *int               `json:"recycle_retention_days,omitempty"`
 }
 
 type adminUserDeleteRequest struct {
@@ -68,26 +81,29 @@ type adminUserResetPasswordRequest struct {
 }
 
 type adminRuleResponse struct {
-	Path        string   `json:"path"`
-	Permissions []string `json:"permissions"`
-	Regex       bool     `json:"regex"`
+	Path         string             `json:"path"`
+	Permissions  []string           `json:"permissions"`
+	Regex        bool               `json:"regex"`
+	UploadPolicy *user.UploadPolicy `json:"upload_policy,omitempty"`
 }
 
 type adminUserResponse struct {
-	ID                string              `json:"id"`
-	Username          string              `json:"username"`
-	WalletAddress     string              `json:"wallet_address,omitempty"`
-	Email             string              `json:"email,omitempty"`
-	Directory         string              `json:"directory"`
-	Permissions       []string            `json:"permissions"`
-	Quota             int64               `json:"quota"`
-	UsedSpace         int64               `json:"used_space"`
-	QuotaStatus       string              `json:"quota_status"`
-	QuotaUsagePercent *float64            `json:"quota_usage_percent,omitempty"`
-	Rules             []adminRuleResponse `json:"rules,omitempty"`
-	CreatedAt         string              `json:"created_at,omitempty"`
-	UpdatedAt         string              `json:"updated_at,omitempty"`
-	HasPassword       bool                `json:"has_password"`
+	ID                   string              `json:"id"`
+	Username             string              `json:"username"`
+	WalletAddress        string              `json:"wallet_address,omitempty"`
+	Email                string              `json:"email,omitempty"`
+	Directory            string              `json:"directory"`
+	Permissions          []string            `json:"permissions"`
+	Quota                int64               `json:"quota"`
+	UsedSpace            int64               `json:"used_space"`
+	QuotaStatus          string              `json:"quota_status"`
+	QuotaUsagePercent    *float64            `json:"quota_usage_percent,omitempty"`
+	Rules                []adminRuleResponse `json:"rules,omitempty"`
+	UploadPolicy         *user.UploadPolicy  `json:"upload_policy,omitempty"`
+	RecycleRetentionDays int                 `json:"recycle_retention_days"`
+	CreatedAt            string              `json:"created_at,omitempty"`
+	UpdatedAt            string              `json:"updated_at,omitempty"`
+	HasPassword          bool                `json:"has_password"`
 }
 
 // HandleList lists all users.
@@ -202,6 +218,27 @@ func (h *AdminUserHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 		u.Rules = rules
 	}
 
+	if req.UploadPolicy != nil {
+		policy, err := req.UploadPolicy.Normalized()
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		u.UploadPolicy = policy
+	}
+
+	if req.RecycleRetentionDays != nil {
+		u.RecycleRetentionDays = *req.RecycleRetentionDays
+	}
+
+	if h.volumePlacer != nil {
+		if err := h.volumePlacer.Place(r.Context(), u); err != nil {
+			h.logger.Error("failed to place user on a volume", zap.Error(err))
+			h.writeError(w, http.StatusInsufficientStorage, err.Error())
+			return
+		}
+	}
+
 	if err := h.userRepository.Save(r.Context(), u); err != nil {
 		if err == user.ErrDuplicateUsername || err == user.ErrDuplicateAddress || err == user.ErrDuplicateEmail {
 			h.writeError(w, http.StatusConflict, err.Error())
@@ -318,6 +355,19 @@ func (h *AdminUserHandler) HandleUpdate(w http.ResponseWriter, r *http.Request)
 		u.Rules = rules
 	}
 
+	if req.UploadPolicy != nil {
+		policy, err := req.UploadPolicy.Normalized()
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		u.UploadPolicy = policy
+	}
+
+	if req.RecycleRetentionDays != nil {
+		u.RecycleRetentionDays = *req.RecycleRetentionDays
+	}
+
 	if u.Directory == "" {
 		u.Directory = u.Username
 	}
@@ -431,10 +481,15 @@ func buildAdminRules(items []adminRuleRequest) ([]*user.Rule, error) {
 		if err != nil {
 			return nil, err
 		}
+		policy, err := item.UploadPolicy.Normalized()
+		if err != nil {
+			return nil, errInvalidRule(err.Error())
+		}
 		rules = append(rules, &user.Rule{
-			Path:        path,
-			Permissions: perms,
-			Regex:       item.Regex,
+			Path:         path,
+			Permissions:  perms,
+			Regex:        item.Regex,
+			UploadPolicy: policy,
 		})
 	}
 	return rules, nil
@@ -442,15 +497,17 @@ func buildAdminRules(items []adminRuleRequest) ([]*user.Rule, error) {
 
 func buildAdminUserResponse(u *user.User) adminUserResponse {
 	resp := adminUserResponse{
-		ID:          u.ID,
-		Username:    u.Username,
-		Email:       u.Email,
-		Directory:   u.Directory,
-		Permissions: permissionsToStrings(u.Permissions),
-		Quota:       u.Quota,
-		UsedSpace:   u.UsedSpace,
-		HasPassword: u.HasPassword(),
-	}
+		ID:           u.ID,
+		Username:     u.Username,
+		Email:        u.Email,
+		Directory:    u.Directory,
+		Permissions:  permissionsToStrings(u.Permissions),
+		Quota:        u.Quota,
+		UsedSpace:    u.UsedSpace,
+		HasPassword:  u.HasPassword(),
+		UploadPolicy: u.UploadPolicy,
+	}
+	resp.RecycleRetentionDays = u.RecycleRetentionDays
 	resp.WalletAddress = u.WalletAddress
 	resp.QuotaStatus, resp.QuotaUsagePercent = adminQuotaStatus(u)
 
@@ -458,9 +515,10 @@ func buildAdminUserResponse(u *user.User) adminUserResponse {
 		resp.Rules = make([]adminRuleResponse, 0, len(u.Rules))
 		for _, rule := range u.Rules {
 			resp.Rules = append(resp.Rules, adminRuleResponse{
-				Path:        rule.Path,
-				Permissions: permissionsToStrings(rule.Permissions),
-				Regex:       rule.Regex,
+				Path:         rule.Path,
+				Permissions:  permissionsToStrings(rule.Permissions),
+				Regex:        rule.Regex,
+				UploadPolicy: rule.UploadPolicy,
 			})
 		}
 	}
@@ -16,6 +16,9 @@ import (
 
 	"github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/object"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
+	"github.com/yeying-community/warehouse/internal/domain/team"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
@@ -23,9 +26,11 @@ import (
 )
 
 type AssetObjectHandler struct {
-	config  *config.Config
-	objects *service.ObjectService
-	logger  *zap.Logger
+	config   *config.Config
+	objects  *service.ObjectService
+	archives *service.ArchiveService
+	teams    *service.TeamService
+	logger   *zap.Logger
 }
 
 type assetObjectResponse struct {
@@ -50,6 +55,16 @@ func NewAssetObjectHandler(cfg *config.Config, objects *service.ObjectService, l
 	return &AssetObjectHandler{config: cfg, objects: objects, logger: logger}
 }
 
+// SetArchiveService enables directory and multi-path archive downloads on the content endpoint.
+func (h *AssetObjectHandler) SetArchiveService(archives *service.ArchiveService) {
+	h.archives = archives
+}
+
+// SetTeamService enables /teams/<id> paths backed by team storage accounts.
+func (h *AssetObjectHandler) SetTeamService(teams *service.TeamService) {
+	h.teams = teams
+}
+
 func (h *AssetObjectHandler) HandleObject(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
@@ -94,22 +109,26 @@ func (h *AssetObjectHandler) HandleObjects(w http.ResponseWriter, r *http.Reques
 		h.writeScopeError(w, err)
 		return
 	}
+	owner, ok := h.spaceOwner(w, r, u, ref, false)
+	if !ok {
+		return
+	}
 	delimiter := rune(0)
 	if r.URL.Query().Get("delimiter") == "/" {
 		delimiter = '/'
 	}
-	result, err := h.objects.List(r.Context(), u.Directory, ref.Bucket, ref.Key, delimiter)
+	result, err := h.objects.List(r.Context(), owner.Directory, ref.Bucket, ref.Key, delimiter)
 	if err != nil {
 		h.writeObjectError(w, err)
 		return
 	}
 	objects := make([]assetObjectResponse, 0, len(result.Objects))
 	for _, info := range result.Objects {
-		objects = append(objects, h.objectResponse(info, ""))
+		objects = append(objects, h.objectResponse(ref, info, ""))
 	}
 	prefixes := make([]string, 0, len(result.Prefixes))
 	for _, prefix := range result.Prefixes {
-		prefixes = append(prefixes, "/"+ref.Bucket+"/"+prefix)
+		prefixes = append(prefixes, ref.space()+"/"+prefix)
 	}
 	h.writeJSON(w, http.StatusOK, assetObjectListResponse{
 		Prefix:   ref.Path,
@@ -132,7 +151,11 @@ func (h *AssetObjectHandler) handleMetadata(w http.ResponseWriter, r *http.Reque
 		h.writeScopeError(w, err)
 		return
 	}
-	file, info, err := h.objects.Open(r.Context(), u.Directory, ref.Bucket, ref.Key)
+	owner, ok := h.spaceOwner(w, r, u, ref, false)
+	if !ok {
+		return
+	}
+	file, info, err := h.objects.Open(r.Context(), owner.Directory, ref.Bucket, ref.Key)
 	if err != nil {
 		h.writeObjectError(w, err)
 		return
@@ -143,7 +166,7 @@ func (h *AssetObjectHandler) handleMetadata(w http.ResponseWriter, r *http.Reque
 		h.writeObjectError(w, err)
 		return
 	}
-	h.writeJSON(w, http.StatusOK, h.objectResponse(info, checksum))
+	h.writeJSON(w, http.StatusOK, h.objectResponse(ref, info, checksum))
 }
 
 func (h *AssetObjectHandler) handleContentHead(w http.ResponseWriter, r *http.Request) {
@@ -159,6 +182,10 @@ func (h *AssetObjectHandler) serveContent(w http.ResponseWriter, r *http.Request
 	if !ok {
 		return
 	}
+	if h.isArchiveRequest(r, u) {
+		h.serveArchive(w, r, u)
+		return
+	}
 	ref, err := parseAssetPath(r.URL.Query().Get("path"), false)
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "INVALID_PATH", err.Error())
@@ -168,7 +195,11 @@ func (h *AssetObjectHandler) serveContent(w http.ResponseWriter, r *http.Request
 		h.writeScopeError(w, err)
 		return
 	}
-	file, info, err := h.objects.Open(r.Context(), u.Directory, ref.Bucket, ref.Key)
+	owner, ok := h.spaceOwner(w, r, u, ref, false)
+	if !ok {
+		return
+	}
+	file, info, err := h.objects.Open(r.Context(), owner.Directory, ref.Bucket, ref.Key)
 	if err != nil {
 		h.writeObjectError(w, err)
 		return
@@ -191,6 +222,92 @@ func (h *AssetObjectHandler) serveContent(w http.ResponseWriter, r *http.Request
 	http.ServeContent(w, r, path.Base(info.Key), info.ModifiedAt, file)
 }
 
+// isArchiveRequest reports whether the content request selects several paths or a directory.
+func (h *AssetObjectHandler) isArchiveRequest(r *http.Request, u *user.User) bool {
+	if h.archives == nil {
+		return false
+	}
+	paths := r.URL.Query()["path"]
+	if len(paths) > 1 {
+		return true
+	}
+	if len(paths) == 0 {
+		return false
+	}
+	ref, err := parseAssetPath(paths[0], true)
+	if err != nil {
+		return false
+	}
+	if ref.Key == "" {
+		return true
+	}
+	owner := u
+	if ref.TeamID != "" {
+		if owner, _, err = h.teams.ResolvePrincipal(r.Context(), u, ref.TeamID); err != nil {
+			return false
+		}
+	}
+	info, err := h.objects.Stat(r.Context(), owner.Directory, ref.Bucket, ref.Key)
+	return err == nil && info.IsPrefix
+}
+
+func (h *AssetObjectHandler) serveArchive(w http.ResponseWriter, r *http.Request, u *user.User) {
+	var owner *user.User
+	var allow func(logicalPath string, isDir bool) bool
+	paths := r.URL.Query()["path"]
+	sources := make([]service.ArchiveSource, 0, len(paths))
+	for _, raw := range paths {
+		ref, err := parseAssetPath(raw, true)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "INVALID_PATH", err.Error())
+			return
+		}
+		if err := service.EnforceAppScope(r.Context(), h.config, ref.Path, "read"); err != nil {
+			h.writeScopeError(w, err)
+			return
+		}
+		refOwner, ok := h.spaceOwner(w, r, u, ref, false)
+		if !ok {
+			return
+		}
+		if owner == nil {
+			owner = refOwner
+			allow = service.UserArchiveFilter(owner)
+		} else if owner.ID != refOwner.ID {
+			h.writeError(w, http.StatusBadRequest, "INVALID_PATH", "archive paths must belong to one space")
+			return
+		}
+		if !allow(ref.Path, false) {
+			h.writeError(w, http.StatusForbidden, "FORBIDDEN", "forbidden")
+			return
+		}
+		fullPath, err := h.objects.ResolveFullPath(owner.Directory, ref.Bucket, strings.TrimSuffix(ref.Key, "/"))
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "INVALID_PATH", err.Error())
+			return
+		}
+		sources = append(sources, service.ArchiveSource{FullPath: fullPath, Name: path.Base(ref.Path), LogicalPath: ref.Path})
+	}
+	baseName := "download"
+	if len(sources) == 1 {
+		baseName = sources[0].Name
+	}
+	err := h.archives.Serve(w, r, service.ArchiveRequest{
+		Format:  r.URL.Query().Get("format"),
+		Sources: sources,
+		Allow:   allow,
+	}, baseName)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrArchiveTooLarge):
+		h.writeError(w, http.StatusRequestEntityTooLarge, "ARCHIVE_TOO_LARGE", err.Error())
+	case errors.Is(err, service.ErrArchiveInvalid):
+		h.writeError(w, http.StatusBadRequest, "INVALID_ARCHIVE", err.Error())
+	default:
+		h.writeObjectError(w, err)
+	}
+}
+
 func (h *AssetObjectHandler) handleContentPut(w http.ResponseWriter, r *http.Request) {
 	u, ok := h.currentUser(w, r)
 	if !ok {
@@ -205,21 +322,26 @@ func (h *AssetObjectHandler) handleContentPut(w http.ResponseWriter, r *http.Req
 		h.writeScopeError(w, err)
 		return
 	}
+	owner, ok := h.spaceOwner(w, r, u, ref, true)
+	if !ok {
+		return
+	}
 	expectedSHA256, err := normalizeExpectedSHA256(r.Header.Get("X-Warehouse-Checksum-SHA256"))
 	if err != nil {
 		h.writeError(w, http.StatusBadRequest, "INVALID_CHECKSUM", err.Error())
 		return
 	}
 	contentType := strings.TrimSpace(r.Header.Get("Content-Type"))
-	info, err := h.objects.PutForUserWithOptions(r.Context(), u, ref.Bucket, ref.Key, r.Body, service.ObjectWriteOptions{
+	info, err := h.objects.PutForUserWithOptions(r.Context(), owner, ref.Bucket, ref.Key, r.Body, service.ObjectWriteOptions{
 		ExpectedSHA256: expectedSHA256,
 		ContentType:    contentType,
+		KeepVersion:    true,
 	})
 	if err != nil {
 		h.writeObjectError(w, err)
 		return
 	}
-	file, _, err := h.objects.Open(r.Context(), u.Directory, ref.Bucket, ref.Key)
+	file, _, err := h.objects.Open(r.Context(), owner.Directory, ref.Bucket, ref.Key)
 	if err != nil {
 		h.writeObjectError(w, err)
 		return
@@ -230,7 +352,7 @@ func (h *AssetObjectHandler) handleContentPut(w http.ResponseWriter, r *http.Req
 		h.writeObjectError(w, err)
 		return
 	}
-	h.writeJSON(w, http.StatusOK, h.objectResponse(info, checksum))
+	h.writeJSON(w, http.StatusOK, h.objectResponse(ref, info, checksum))
 }
 
 func (h *AssetObjectHandler) writeObjectHeaders(w http.ResponseWriter, info service.ObjectInfo, checksum string) {
@@ -248,11 +370,15 @@ func (h *AssetObjectHandler) writeObjectHeaders(w http.ResponseWriter, info serv
 	setInlineContentDisposition(w, path.Base(info.Key))
 }
 
-func (h *AssetObjectHandler) objectResponse(info service.ObjectInfo, checksum string) assetObjectResponse {
+func (h *AssetObjectHandler) objectResponse(ref assetPathRef, info service.ObjectInfo, checksum string) assetObjectResponse {
+	bucket, key := info.Bucket, info.Key
+	if ref.TeamID != "" {
+		bucket, key = strings.TrimPrefix(team.SpacePrefix, "/"), ref.TeamID+"/"+strings.TrimPrefix(info.Key, "/")
+	}
 	return assetObjectResponse{
-		Path:           "/" + info.Bucket + "/" + strings.TrimPrefix(info.Key, "/"),
-		Bucket:         info.Bucket,
-		Key:            info.Key,
+		Path:           "/" + bucket + "/" + strings.TrimPrefix(key, "/"),
+		Bucket:         bucket,
+		Key:            key,
 		Size:           info.Size,
 		ETag:           info.ETag,
 		ChecksumSHA256: checksum,
@@ -262,6 +388,32 @@ func (h *AssetObjectHandler) objectResponse(info service.ObjectInfo, checksum st
 	}
 }
 
+// spaceOwner returns the account whose tree holds ref: the caller for
+// personal/apps/services, the team storage account for /teams/<id>.
+func (h *AssetObjectHandler) spaceOwner(w http.ResponseWriter, r *http.Request, u *user.User, ref assetPathRef, write bool) (*user.User, bool) {
+	if ref.TeamID == "" {
+		return u, true
+	}
+	principal, _, err := h.teams.ResolvePrincipal(r.Context(), u, ref.TeamID)
+	switch {
+	case err == nil:
+	case errors.Is(err, team.ErrTeamNotFound), errors.Is(err, team.ErrTeamsDisabled):
+		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return nil, false
+	case errors.Is(err, team.ErrPermissionDenied), errors.Is(err, auth.ErrAppScopeRequired), errors.Is(err, auth.ErrAppScopeDenied):
+		h.writeError(w, http.StatusForbidden, "FORBIDDEN", "forbidden")
+		return nil, false
+	default:
+		h.writeObjectError(w, err)
+		return nil, false
+	}
+	if write && !principal.CanAccess(ref.Path, "create") {
+		h.writeError(w, http.StatusForbidden, "FORBIDDEN", "team role is read-only")
+		return nil, false
+	}
+	return principal, true
+}
+
 func (h *AssetObjectHandler) currentUser(w http.ResponseWriter, r *http.Request) (*user.User, bool) {
 	u, ok := middleware.GetUserFromContext(r.Context())
 	if !ok || u == nil {
@@ -286,6 +438,11 @@ func (h *AssetObjectHandler) writeObjectError(w http.ResponseWriter, err error)
 		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
 	case errors.Is(err, user.ErrQuotaExceeded):
 		h.writeError(w, http.StatusRequestEntityTooLarge, "QUOTA_EXCEEDED", "storage quota exceeded")
+	case errors.Is(err, pathname.ErrCaseCollision):
+		h.writeError(w, http.StatusConflict, "NAME_CONFLICT", err.Error())
+	case errors.Is(err, user.ErrUploadPolicyViolation):
+		status, code, _ := service.UploadPolicyStatus(err)
+		h.writeError(w, status, code, err.Error())
 	default:
 		if h.logger != nil {
 			h.logger.Error("asset object request failed", zap.Error(err))
@@ -319,6 +476,16 @@ type assetPathRef struct {
 	Path   string
 	Bucket string
 	Key    string
+	// TeamID is set for /teams/<id> paths; Bucket is then the account root.
+	TeamID string
+}
+
+// space returns the asset space root of the reference.
+func (ref assetPathRef) space() string {
+	if ref.TeamID != "" {
+		return path.Join(team.SpacePrefix, ref.TeamID)
+	}
+	return "/" + ref.Bucket
 }
 
 func parseAssetPath(raw string, allowBucketRoot bool) (assetPathRef, error) {
@@ -337,12 +504,15 @@ func parseAssetPath(raw string, allowBucketRoot bool) (assetPathRef, error) {
 	if clean == "." || clean == "/" {
 		return assetPathRef{}, fmt.Errorf("path must include an asset space")
 	}
+	if teamID, rest, ok := team.SplitSpacePath(clean); ok {
+		return parseTeamAssetPath(value, teamID, rest, allowBucketRoot)
+	}
 	parts := strings.SplitN(strings.TrimPrefix(clean, "/"), "/", 2)
 	bucket := parts[0]
 	switch bucket {
 	case "personal", "apps", "services":
 	default:
-		return assetPathRef{}, fmt.Errorf("path must start with /personal, /apps, or /services")
+		return assetPathRef{}, fmt.Errorf("path must start with /personal, /apps, /services, or /teams/<id>")
 	}
 	key := ""
 	if len(parts) == 2 {
@@ -361,6 +531,24 @@ func parseAssetPath(raw string, allowBucketRoot bool) (assetPathRef, error) {
 	return assetPathRef{Path: refPath, Bucket: bucket, Key: key}, nil
 }
 
+func parseTeamAssetPath(value, teamID, rest string, allowBucketRoot bool) (assetPathRef, error) {
+	if teamID == "" {
+		return assetPathRef{}, fmt.Errorf("path must include a team id")
+	}
+	key := strings.TrimPrefix(rest, "/")
+	if key == "" && !allowBucketRoot {
+		return assetPathRef{}, fmt.Errorf("path must include an object key")
+	}
+	if allowBucketRoot && strings.HasSuffix(value, "/") && key != "" {
+		key += "/"
+	}
+	refPath := path.Join(team.SpacePrefix, teamID)
+	if key != "" {
+		refPath += "/" + key
+	}
+	return assetPathRef{Path: refPath, Bucket: object.RootBucket, Key: key, TeamID: teamID}, nil
+}
+
 func normalizeExpectedSHA256(raw string) (string, error) {
 	value := strings.TrimSpace(raw)
 	if value == "" {
@@ -112,6 +112,34 @@ func TestAssetObjectHandlerRejectsInvalidPath(t *testing.T) {
 	}
 }
 
+func TestParseAssetPathTeamSpace(t *testing.T) {
+	ref, err := parseAssetPath("/teams/t1/docs/", true)
+	if err != nil {
+		t.Fatalf("parse team prefix: %v", err)
+	}
+	if ref.TeamID != "t1" || ref.Bucket != "" || ref.Key != "docs/" || ref.Path != "/teams/t1/docs/" || ref.space() != "/teams/t1" {
+		t.Fatalf("unexpected team ref: %+v", ref)
+	}
+	if _, err := parseAssetPath("/teams/t1", false); err == nil {
+		t.Fatal("expected object key to be required")
+	}
+	if _, err := parseAssetPath("/teams", true); err == nil {
+		t.Fatal("expected team id to be required")
+	}
+}
+
+func TestAssetObjectHandlerHidesTeamSpacesWhenDisabled(t *testing.T) {
+	handler := NewAssetObjectHandler(&config.Config{}, service.NewObjectService(t.TempDir()), zap.NewNop())
+	owner := &user.User{ID: "u1", Username: "alice", Directory: "alice", Quota: 0}
+
+	req := newAssetObjectRequest(t, http.MethodGet, "/api/v1/public/assets/object?path=/teams/t1/data.txt", nil, owner)
+	rec := httptest.NewRecorder()
+	handler.HandleObject(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("status=%d body=%s", rec.Code, rec.Body.String())
+	}
+}
+
 func TestAssetObjectHandlerEnforcesUcanAppScope(t *testing.T) {
 	root := t.TempDir()
 	objects := service.NewObjectService(root)
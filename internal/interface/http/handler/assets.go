@@ -3,9 +3,12 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"path"
 	"time"
 
 	"github.com/yeying-community/warehouse/internal/application/assetspace"
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/team"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
 )
@@ -13,6 +16,7 @@ import (
 // AssetsHandler 提供资产空间元信息接口
 type AssetsHandler struct {
 	assetSpaceManager *assetspace.Manager
+	teams             *service.TeamService
 	logger            *zap.Logger
 }
 
@@ -24,6 +28,11 @@ func NewAssetsHandler(assetSpaceManager *assetspace.Manager, logger *zap.Logger)
 	}
 }
 
+// SetTeamService 在空间列表中追加用户可访问的团队空间
+func (h *AssetsHandler) SetTeamService(teams *service.TeamService) {
+	h.teams = teams
+}
+
 // GetSpaces 获取资产空间信息
 // GET /api/v1/public/assets/spaces
 func (h *AssetsHandler) GetSpaces(w http.ResponseWriter, r *http.Request) {
@@ -60,6 +69,17 @@ func (h *AssetsHandler) GetSpaces(w http.ResponseWriter, r *http.Request) {
 		defaultSpace = h.assetSpaceManager.DefaultSpace()
 		spaces = h.assetSpaceManager.Spaces()
 	}
+	teams, err := h.teams.ListSpaces(r.Context(), u)
+	if err != nil {
+		h.logger.Warn("failed to list team spaces", zap.String("username", u.Username), zap.Error(err))
+	}
+	for _, item := range teams {
+		spaces = append(spaces, assetspace.Space{
+			Key:  assetspace.TeamsSpaceKey,
+			Name: item.Name,
+			Path: path.Join(team.SpacePrefix, item.ID),
+		})
+	}
 
 	h.sendSDKSuccess(w, map[string]interface{}{
 		"defaultSpace": defaultSpace,
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/yeying-community/warehouse/internal/application/assetspace"
+	"github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	infraAuth "github.com/yeying-community/warehouse/internal/infrastructure/auth"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
@@ -23,6 +24,8 @@ type EmailAuthHandler struct {
 	web3Auth          *infraAuth.Web3Authenticator
 	userRepo          user.Repository
 	assetSpaceManager *assetspace.Manager
+	volumePlacer      user.VolumePlacer
+	shareInvites      *service.ShareUserService
 	store             *infraAuth.EmailCodeStore
 	sender            *email.Sender
 	config            config.EmailConfig
@@ -162,6 +165,7 @@ func (h *EmailAuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 		h.sendError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to initialize user spaces")
 		return
 	}
+	h.activateShareInvites(ctx, u)
 
 	accessToken, err := h.web3Auth.GenerateAccessTokenForEmail(emailAddr)
 	if err != nil {
@@ -190,6 +194,28 @@ func (h *EmailAuthHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
 	h.sendSDKSuccess(w, data)
 }
 
+// SetVolumePlacer 设置新用户的数据卷选择器
+func (h *EmailAuthHandler) SetVolumePlacer(placer user.VolumePlacer) {
+	h.volumePlacer = placer
+}
+
+// SetShareUserService 启用定向分享邮箱邀请：登录成功后激活该邮箱的待生效邀请
+func (h *EmailAuthHandler) SetShareUserService(shareUserService *service.ShareUserService) {
+	h.shareInvites = shareUserService
+}
+
+// activateShareInvites 激活失败不影响登录，下次登录时重试
+func (h *EmailAuthHandler) activateShareInvites(ctx context.Context, u *user.User) {
+	if h.shareInvites == nil {
+		return
+	}
+	if _, err := h.shareInvites.ActivateEmailInvites(ctx, u); err != nil {
+		h.logger.Warn("failed to activate share invites",
+			zap.String("username", u.Username),
+			zap.Error(err))
+	}
+}
+
 func (h *EmailAuthHandler) createUserFromEmail(ctx context.Context, emailAddr string) (*user.User, error) {
 	base := sanitizeEmailUsername(emailAddr)
 	if base == "" {
@@ -210,6 +236,11 @@ func (h *EmailAuthHandler) createUserFromEmail(ctx context.Context, emailAddr st
 		}
 		u.Permissions = user.ParsePermissions("CRUD")
 		_ = u.SetQuota(1073741824)
+		if h.volumePlacer != nil {
+			if err := h.volumePlacer.Place(ctx, u); err != nil {
+				return nil, err
+			}
+		}
 
 		if err := h.userRepo.Save(ctx, u); err != nil {
 			if err == user.ErrDuplicateUsername {
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+const extractJobsPrefix = "/api/v1/public/webdav/extract/jobs/"
+
+// ExtractHandler 在线解压处理器
+type ExtractHandler struct {
+	service *service.ExtractService
+	logger  *zap.Logger
+}
+
+type extractJobResponse struct {
+	ID               string  `json:"id"`
+	SourcePath       string  `json:"sourcePath"`
+	TargetPath       string  `json:"targetPath"`
+	Format           string  `json:"format"`
+	Conflict         string  `json:"conflict"`
+	Status           string  `json:"status"`
+	Progress         float64 `json:"progress"`
+	TotalEntries     int     `json:"totalEntries"`
+	TotalBytes       int64   `json:"totalBytes"`
+	ProcessedEntries int     `json:"processedEntries"`
+	ProcessedBytes   int64   `json:"processedBytes"`
+	Created          int     `json:"created"`
+	Overwritten      int     `json:"overwritten"`
+	Renamed          int     `json:"renamed"`
+	Skipped          int     `json:"skipped"`
+	Error            string  `json:"error,omitempty"`
+	CreatedAt        string  `json:"createdAt"`
+	UpdatedAt        string  `json:"updatedAt"`
+}
+
+func NewExtractHandler(extractService *service.ExtractService, logger *zap.Logger) *ExtractHandler {
+	return &ExtractHandler{service: extractService, logger: logger}
+}
+
+// HandleCreate 创建解压任务（异步执行，返回 202）
+func (h *ExtractHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Source   string `json:"source"`
+		Target   string `json:"target"`
+		Conflict string `json:"conflict"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	job, err := h.service.Start(r.Context(), u, service.ExtractInput{
+		SourcePath: req.Source,
+		TargetPath: req.Target,
+		Conflict:   req.Conflict,
+	})
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusAccepted, buildExtractJobResponse(job))
+}
+
+// HandleJobs 查询任务列表 / 单个任务进度，DELETE 取消任务
+func (h *ExtractHandler) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, extractJobsPrefix), "/")
+	if id == "" || r.URL.Path == strings.TrimSuffix(extractJobsPrefix, "/") {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.handleList(w, r, u)
+		return
+	}
+	var (
+		job *service.ExtractJob
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		job, err = h.service.Get(r.Context(), u, id)
+	case http.MethodDelete:
+		job, err = h.service.Cancel(r.Context(), u, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, buildExtractJobResponse(job))
+}
+
+func (h *ExtractHandler) handleList(w http.ResponseWriter, r *http.Request, u *user.User) {
+	jobs, err := h.service.List(r.Context(), u)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	items := make([]extractJobResponse, 0, len(jobs))
+	for _, job := range jobs {
+		items = append(items, buildExtractJobResponse(job))
+	}
+	h.writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+func buildExtractJobResponse(job *service.ExtractJob) extractJobResponse {
+	return extractJobResponse{
+		ID:               job.ID,
+		SourcePath:       job.SourcePath,
+		TargetPath:       job.TargetPath,
+		Format:           job.Format,
+		Conflict:         job.Conflict,
+		Status:           job.Status,
+		Progress:         job.Progress(),
+		TotalEntries:     job.TotalEntries,
+		TotalBytes:       job.TotalBytes,
+		ProcessedEntries: job.ProcessedEntries,
+		ProcessedBytes:   job.ProcessedBytes,
+		Created:          job.Created,
+		Overwritten:      job.Overwritten,
+		Renamed:          job.Renamed,
+		Skipped:          job.Skipped,
+		Error:            job.Error,
+		CreatedAt:        job.CreatedAt.Format(timeLayout),
+		UpdatedAt:        job.UpdatedAt.Format(timeLayout),
+	}
+}
+
+func (h *ExtractHandler) writeJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil && h.logger != nil {
+		h.logger.Error("failed to write extract response", zap.Error(err))
+	}
+}
+
+func (h *ExtractHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrExtractJobNotFound), errors.Is(err, os.ErrNotExist):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrExtractForbidden), errors.Is(err, auth.ErrAppScopeDenied), errors.Is(err, auth.ErrAppScopeRequired):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, service.ErrExtractInvalid), errors.Is(err, service.ErrExtractUnsafeEntry):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		if h.logger != nil {
+			h.logger.Error("extract job error", zap.Error(err))
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -41,22 +41,26 @@ func (h *GroupHandler) HandleGroupList(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	type item struct {
-		ID        string `json:"id"`
-		Name      string `json:"name"`
-		CanManage bool   `json:"canManage"`
-		CanInvite bool   `json:"canInvite"`
-		CreatedAt string `json:"createdAt"`
+		ID               string `json:"id"`
+		Name             string `json:"name"`
+		Role             string `json:"role"`
+		CanManage        bool   `json:"canManage"`
+		CanManageMembers bool   `json:"canManageMembers"`
+		CanInvite        bool   `json:"canInvite"`
+		CreatedAt        string `json:"createdAt"`
 	}
 	resp := struct {
 		Items []item `json:"items"`
 	}{Items: make([]item, 0, len(groups))}
 	for _, g := range groups {
 		resp.Items = append(resp.Items, item{
-			ID:        g.ID,
-			Name:      g.Name,
-			CanManage: g.UserID == u.ID,
-			CanInvite: g.CanInvite,
-			CreatedAt: g.CreatedAt.Format(timeLayout),
+			ID:               g.ID,
+			Name:             g.Name,
+			Role:             g.Role,
+			CanManage:        g.UserID == u.ID,
+			CanManageMembers: group.CanManageMembers(g.Role),
+			CanInvite:        g.CanInvite,
+			CreatedAt:        g.CreatedAt.Format(timeLayout),
 		})
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -91,11 +95,13 @@ func (h *GroupHandler) HandleGroupCreate(w http.ResponseWriter, r *http.Request)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(map[string]any{
-		"id":        createdGroup.ID,
-		"name":      createdGroup.Name,
-		"canManage": true,
-		"canInvite": true,
-		"createdAt": createdGroup.CreatedAt.Format(timeLayout),
+		"id":               createdGroup.ID,
+		"name":             createdGroup.Name,
+		"role":             group.RoleOwner,
+		"canManage":        true,
+		"canManageMembers": true,
+		"canInvite":        true,
+		"createdAt":        createdGroup.CreatedAt.Format(timeLayout),
 	})
 }
 
@@ -184,6 +190,16 @@ func (h *GroupHandler) HandleMemberList(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Failed to list group members", http.StatusInternalServerError)
 		return
 	}
+	groups, err := h.service.ListGroups(r.Context(), u)
+	if err != nil {
+		h.logger.Error("failed to list groups", zap.Error(err))
+		http.Error(w, "Failed to list group members", http.StatusInternalServerError)
+		return
+	}
+	roles := make(map[string]string, len(groups))
+	for _, g := range groups {
+		roles[g.ID] = g.Role
+	}
 	type item struct {
 		ID            string `json:"id"`
 		Name          string `json:"name"`
@@ -191,9 +207,11 @@ func (h *GroupHandler) HandleMemberList(w http.ResponseWriter, r *http.Request)
 		WalletAddress string `json:"walletAddress"`
 		GroupID       string `json:"groupId"`
 		Status        string `json:"status"`
+		Role          string `json:"role"`
 		IsOwner       bool   `json:"isOwner"`
 		IsSelf        bool   `json:"isSelf"`
 		CanManage     bool   `json:"canManage"`
+		CanRemove     bool   `json:"canRemove"`
 		CanRespond    bool   `json:"canRespond"`
 		CreatedAt     string `json:"createdAt"`
 	}
@@ -208,9 +226,11 @@ func (h *GroupHandler) HandleMemberList(w http.ResponseWriter, r *http.Request)
 			WalletAddress: m.WalletAddress,
 			GroupID:       m.GroupID,
 			Status:        m.Status,
+			Role:          m.Role,
 			IsOwner:       m.IsOwner,
 			IsSelf:        isSelfMember(u, m),
 			CanManage:     m.UserID == u.ID,
+			CanRemove:     !isSelfMember(u, m) && group.CanRemove(roles[m.GroupID], m.Role),
 			CanRespond:    canRespondToMemberInvite(u, m),
 			CreatedAt:     m.CreatedAt.Format(timeLayout),
 		})
@@ -469,6 +489,7 @@ func memberPayload(u *user.User, member *group.Member) map[string]any {
 		"walletAddress": member.WalletAddress,
 		"groupId":       member.GroupID,
 		"status":        member.Status,
+		"role":          member.Role,
 		"isOwner":       member.IsOwner,
 		"isSelf":        isSelfMember(u, member),
 		"canManage":     canManageMember(u, member),
@@ -535,6 +556,14 @@ func (h *GroupHandler) HandleMemberDelete(w http.ResponseWriter, r *http.Request
 			http.Error(w, "Member not found", http.StatusNotFound)
 			return
 		}
+		if err == group.ErrGroupPermissionDenied {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		if err == group.ErrOwnerCannotLeave {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
@@ -0,0 +1,309 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/group"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+type inviteLinkResp struct {
+	ID        string `json:"id"`
+	GroupID   string `json:"groupId"`
+	Code      string `json:"code"`
+	MaxUses   int    `json:"maxUses"`
+	UsedCount int    `json:"usedCount"`
+	Usable    bool   `json:"usable"`
+	ExpiresAt string `json:"expiresAt"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func toInviteLinkResp(link *group.InviteLink) inviteLinkResp {
+	return inviteLinkResp{
+		ID:        link.ID,
+		GroupID:   link.GroupID,
+		Code:      link.Code,
+		MaxUses:   link.MaxUses,
+		UsedCount: link.UsedCount,
+		Usable:    link.Usable(time.Now()),
+		ExpiresAt: link.ExpiresAt.Format(timeLayout),
+		CreatedAt: link.CreatedAt.Format(timeLayout),
+	}
+}
+
+// writeGroupError 把分组角色、邀请码相关错误映射为 HTTP 状态码
+func (h *GroupHandler) writeGroupError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, group.ErrGroupNotFound):
+		http.Error(w, "Group not found", http.StatusNotFound)
+	case errors.Is(err, group.ErrMemberNotFound):
+		http.Error(w, "Member not found", http.StatusNotFound)
+	case errors.Is(err, group.ErrInviteLinkNotFound):
+		http.Error(w, "Invite link not found", http.StatusNotFound)
+	case errors.Is(err, group.ErrGroupPermissionDenied):
+		http.Error(w, "permission denied", http.StatusForbidden)
+	case errors.Is(err, group.ErrInviteLinkExpired):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, group.ErrDuplicateMember):
+		http.Error(w, "Member already exists in group", http.StatusConflict)
+	case errors.Is(err, group.ErrDuplicateGroupName):
+		http.Error(w, "Group name already exists", http.StatusConflict)
+	case errors.Is(err, group.ErrOwnerCannotLeave):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// HandleMemberRoleUpdate 调整成员角色（仅 owner）
+func (h *GroupHandler) HandleMemberRoleUpdate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		ID   string `json:"id"`
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.ID) == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	member, err := h.service.UpdateMemberRole(r.Context(), u, req.ID, req.Role)
+	if err != nil {
+		h.writeGroupError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(memberPayload(u, member))
+}
+
+// HandleGroupLeave 当前用户退出分组
+func (h *GroupHandler) HandleGroupLeave(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		GroupID string `json:"groupId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.GroupID) == "" {
+		http.Error(w, "groupId is required", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.LeaveGroup(r.Context(), u, req.GroupID); err != nil {
+		h.writeGroupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleGroupTransfer 把分组所有权转给另一位 active 成员
+func (h *GroupHandler) HandleGroupTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		GroupID  string `json:"groupId"`
+		MemberID string `json:"memberId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.GroupID) == "" || strings.TrimSpace(req.MemberID) == "" {
+		http.Error(w, "groupId and memberId are required", http.StatusBadRequest)
+		return
+	}
+	grp, err := h.service.TransferOwnership(r.Context(), u, req.GroupID, req.MemberID)
+	if err != nil {
+		h.writeGroupError(w, err)
+		return
+	}
+	h.logger.Info("group ownership transferred",
+		zap.String("group_id", grp.ID),
+		zap.String("from_user_id", u.ID),
+		zap.String("to_user_id", grp.UserID))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"id":               grp.ID,
+		"name":             grp.Name,
+		"role":             grp.Role,
+		"canManage":        false,
+		"canManageMembers": group.CanManageMembers(grp.Role),
+		"canInvite":        grp.Role != "",
+		"createdAt":        grp.CreatedAt.Format(timeLayout),
+	})
+}
+
+// HandleInviteLinkList 列出分组邀请码（owner / admin）
+func (h *GroupHandler) HandleInviteLinkList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	groupID := strings.TrimSpace(r.URL.Query().Get("groupId"))
+	if groupID == "" {
+		http.Error(w, "groupId is required", http.StatusBadRequest)
+		return
+	}
+	links, err := h.service.ListInviteLinks(r.Context(), u, groupID)
+	if err != nil {
+		h.writeGroupError(w, err)
+		return
+	}
+	resp := struct {
+		Items []inviteLinkResp `json:"items"`
+	}{Items: make([]inviteLinkResp, 0, len(links))}
+	for _, link := range links {
+		resp.Items = append(resp.Items, toInviteLinkResp(link))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// HandleInviteLinkCreate 创建限时邀请码（owner / admin）
+func (h *GroupHandler) HandleInviteLinkCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		GroupID      string `json:"groupId"`
+		MaxUses      int    `json:"maxUses"`
+		ExpiresIn    int64  `json:"expiresIn"`
+		ExpiresValue int64  `json:"expiresValue"`
+		ExpiresUnit  string `json:"expiresUnit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.GroupID) == "" {
+		http.Error(w, "groupId is required", http.StatusBadRequest)
+		return
+	}
+	link, err := h.service.CreateInviteLink(r.Context(), u, req.GroupID, service.ShareExpiryInput{
+		ExpiresIn:    req.ExpiresIn,
+		ExpiresValue: req.ExpiresValue,
+		ExpiresUnit:  req.ExpiresUnit,
+	}, req.MaxUses)
+	if err != nil {
+		h.writeGroupError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(toInviteLinkResp(link))
+}
+
+// HandleInviteLinkRevoke 撤销邀请码（owner / admin）
+func (h *GroupHandler) HandleInviteLinkRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		GroupID string `json:"groupId"`
+		ID      string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.GroupID) == "" || strings.TrimSpace(req.ID) == "" {
+		http.Error(w, "groupId and id are required", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.RevokeInviteLink(r.Context(), u, req.GroupID, req.ID); err != nil {
+		h.writeGroupError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleInviteJoin 使用邀请码加入分组
+func (h *GroupHandler) HandleInviteJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+	grp, member, err := h.service.JoinByInvite(r.Context(), u, req.Code)
+	if err != nil {
+		h.writeGroupError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"group": map[string]any{
+			"id":               grp.ID,
+			"name":             grp.Name,
+			"role":             grp.Role,
+			"canManage":        false,
+			"canManageMembers": false,
+			"canInvite":        grp.CanInvite,
+			"createdAt":        grp.CreatedAt.Format(timeLayout),
+		},
+		"member": memberPayload(u, member),
+	})
+}
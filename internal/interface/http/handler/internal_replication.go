@@ -14,6 +14,7 @@ import (
 	"github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/domain/cluster"
 	"github.com/yeying-community/warehouse/internal/domain/replication"
+	"github.com/yeying-community/warehouse/internal/infrastructure/blobstore"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
@@ -62,6 +63,7 @@ type InternalReplicationHandler struct {
 	reconcileExecutionSem chan struct{}
 	reconcileBandwidthMu  sync.Mutex
 	reconcileBandwidthAt  time.Time
+	blobs                 *blobstore.Store
 }
 
 // NewInternalReplicationHandler creates a new internal replication handler.
@@ -93,6 +95,12 @@ func NewInternalReplicationHandler(
 	}
 }
 
+// SetBlobStore lets the standby apply files from its own content-addressed
+// store and deduplicate replicated content.
+func (h *InternalReplicationHandler) SetBlobStore(store *blobstore.Store) {
+	h.blobs = store
+}
+
 type internalReplicationStatusResponse struct {
 	Node        internalNodeStatus          `json:"node"`
 	Replication internalReplicationStatus   `json:"replication"`
@@ -18,6 +18,7 @@ import (
 
 	"github.com/yeying-community/warehouse/internal/domain/cluster"
 	"github.com/yeying-community/warehouse/internal/domain/replication"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
 )
@@ -235,7 +236,21 @@ func (h *InternalReplicationHandler) HandleFileApply(w http.ResponseWriter, r *h
 		h.writeError(w, http.StatusInternalServerError, "Failed to compare existing file digest")
 		return
 	}
-	if !alreadyMatches {
+	if !alreadyMatches && strings.TrimSpace(r.Header.Get(middleware.InternalBlobLinkHeader)) != "" {
+		linked, err := h.linkBlob(fullPath, fileSize, expectedHash)
+		if err != nil {
+			h.logger.Error("failed to link replication file from blob store",
+				zap.Int64("outbox_id", outboxID),
+				zap.String("path", storagePath),
+				zap.Error(err))
+			h.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !linked {
+			h.writeError(w, http.StatusPreconditionFailed, "blob not available")
+			return
+		}
+	} else if !alreadyMatches {
 		if err := h.applyFile(fullPath, r.Body, fileSize, expectedHash); err != nil {
 			h.logger.Error("failed to apply replication file",
 				zap.String("source_node_id", sourceNodeID),
@@ -494,9 +509,18 @@ func (h *InternalReplicationHandler) applyCopy(fromPath, toPath string) error {
 		return err
 	}
 	if info.IsDir() {
-		return copyDirectory(sourcePath, targetPath)
+		if err := copyDirectory(sourcePath, targetPath); err != nil {
+			return err
+		}
+	} else if err := copyFile(sourcePath, targetPath, info.Mode()); err != nil {
+		return err
 	}
-	return copyFile(sourcePath, targetPath, info.Mode())
+	if h.blobs != nil {
+		if err := h.blobs.IngestTree(targetPath); err != nil {
+			h.logger.Warn("failed to deduplicate replicated copy", zap.String("path", targetPath), zap.Error(err))
+		}
+	}
+	return nil
 }
 
 func (h *InternalReplicationHandler) applyFile(fullPath string, body io.Reader, fileSize int64, expectedHash string) error {
@@ -532,9 +556,26 @@ func (h *InternalReplicationHandler) applyFile(fullPath string, body io.Reader,
 	if err := os.Rename(tmpPath, fullPath); err != nil {
 		return fmt.Errorf("rename temp file: %w", err)
 	}
+	if h.blobs != nil {
+		if _, err := h.blobs.IngestWithDigest(fullPath, actualHash); err != nil {
+			h.logger.Warn("failed to deduplicate replicated file", zap.String("path", fullPath), zap.Error(err))
+		}
+	}
 	return nil
 }
 
+// linkBlob applies a file from the local blob store; false means the standby
+// does not hold the content and the source must send it.
+func (h *InternalReplicationHandler) linkBlob(fullPath string, fileSize int64, expectedHash string) (bool, error) {
+	if h.blobs == nil || fileSize <= 0 {
+		return false, nil
+	}
+	if fullPath == h.webdavRoot() {
+		return false, fmt.Errorf("refusing to overwrite webdav root")
+	}
+	return h.blobs.LinkTo(expectedHash, fileSize, fullPath)
+}
+
 func fileMatchesDigest(fullPath string, expectedSize int64, expectedHash string) (bool, error) {
 	file, err := os.Open(fullPath)
 	if err != nil {
@@ -567,7 +608,8 @@ func (h *InternalReplicationHandler) resolveReplicaPath(raw string) (string, err
 	if strings.HasPrefix(cleaned, "/..") {
 		return "", fmt.Errorf("invalid path %q", raw)
 	}
-	return filepath.Join(h.webdavRoot(), filepath.FromSlash(strings.TrimPrefix(cleaned, "/"))), nil
+	// 复制路径是逻辑路径，用户目录可能位于本节点的其它数据卷
+	return storage.VolumesFromConfig(h.config).Physical(filepath.Join(h.webdavRoot(), filepath.FromSlash(strings.TrimPrefix(cleaned, "/")))), nil
 }
 
 func (h *InternalReplicationHandler) webdavRoot() string {
@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/yeying-community/warehouse/internal/domain/cluster"
 	"github.com/yeying-community/warehouse/internal/domain/replication"
+	"github.com/yeying-community/warehouse/internal/infrastructure/blobstore"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
@@ -255,3 +257,57 @@ func TestInternalReplicationHandleFSApplyRejectsUninitializedGenerationFence(t *
 		t.Fatalf("unexpected lastAppliedOutboxId: %v", resp["lastAppliedOutboxId"])
 	}
 }
+
+func TestInternalReplicationHandleFileApplyLinksKnownBlob(t *testing.T) {
+	root := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Node.ID = "node-b"
+	cfg.Node.Role = "standby"
+	cfg.Replication.Enabled = true
+	cfg.WebDAV.Directory = root
+
+	handler := NewInternalReplicationHandler(cfg, zap.NewNop(), nil, newMemoryReplicationOffsetStore(), nil, nil, nil)
+	store := blobstore.New(root, 1)
+	handler.SetBlobStore(store)
+	payload := []byte("replicated payload")
+	digest := sha256.Sum256(payload)
+	hashHex := hex.EncodeToString(digest[:])
+	newProbe := func(outboxID int) *http.Request {
+		req := httptest.NewRequest(http.MethodPut, fmt.Sprintf("/api/v1/internal/replication/file?outboxId=%d&path=/alice/file.txt&fileSize=18", outboxID), nil)
+		req.Header.Set(middleware.InternalNodeIDHeader, "node-a")
+		req.Header.Set(middleware.InternalContentSHA256Header, hashHex)
+		req.Header.Set(middleware.InternalAssignmentGenerationHeader, "1")
+		req.Header.Set(middleware.InternalBlobLinkHeader, "1")
+		return req
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.HandleFileApply(recorder, newProbe(1))
+	if recorder.Code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for unknown blob, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	seed := filepath.Join(root, "bob", "seed.txt")
+	if err := os.MkdirAll(filepath.Dir(seed), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(seed, payload, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Ingest(seed); err != nil {
+		t.Fatalf("Ingest: %v", err)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler.HandleFileApply(recorder, newProbe(1))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	content, err := os.ReadFile(filepath.Join(root, "alice", "file.txt"))
+	if err != nil {
+		t.Fatalf("ReadFile: %v", err)
+	}
+	if string(content) != string(payload) {
+		t.Fatalf("unexpected file contents: %q", string(content))
+	}
+}
@@ -18,6 +18,7 @@ import (
 
 	"github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/domain/replication"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
 )
@@ -264,7 +265,7 @@ func (h *InternalReplicationHandler) resolveReconcileLocalPath(storagePath strin
 	if cleaned == "/" || strings.HasPrefix(cleaned, "/..") {
 		return "", fmt.Errorf("invalid storage path %q", storagePath)
 	}
-	return filepath.Join(filepath.Clean(h.config.WebDAV.Directory), filepath.FromSlash(strings.TrimPrefix(cleaned, "/"))), nil
+	return storage.VolumesFromConfig(h.config).Physical(filepath.Join(filepath.Clean(h.config.WebDAV.Directory), filepath.FromSlash(strings.TrimPrefix(cleaned, "/")))), nil
 }
 
 func (h *InternalReplicationHandler) pendingCountSafe(ctx context.Context, jobID int64) int64 {
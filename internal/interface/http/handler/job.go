@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+const jobsPath = "/api/v1/public/jobs"
+
+// JobHandler 后台任务处理器
+type JobHandler struct {
+	service *service.JobService
+	logger  *zap.Logger
+}
+
+type jobSubmitRequest struct {
+	Type   string          `json:"type"`
+	Params json.RawMessage `json:"params"`
+}
+
+type jobIDRequest struct {
+	ID string `json:"id"`
+}
+
+func NewJobHandler(jobService *service.JobService, logger *zap.Logger) *JobHandler {
+	return &JobHandler{service: jobService, logger: logger}
+}
+
+// HandleJobs GET 列出自己的任务，POST 提交任务（异步执行，返回 202）；
+// /jobs/{id} 上 GET 查询进度与结果，DELETE 取消任务
+func (h *JobHandler) HandleJobs(w http.ResponseWriter, r *http.Request) {
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, jobsPath), "/")
+	if id == "" {
+		switch r.Method {
+		case http.MethodGet:
+			page, err := h.service.List(r.Context(), u, parseJobListQuery(r))
+			if err != nil {
+				h.writeError(w, err)
+				return
+			}
+			h.writeJSON(w, http.StatusOK, page)
+		case http.MethodPost:
+			var req jobSubmitRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Invalid request body", http.StatusBadRequest)
+				return
+			}
+			job, err := h.service.Submit(r.Context(), u, req.Type, req.Params)
+			if err != nil {
+				h.writeError(w, err)
+				return
+			}
+			h.writeJSON(w, http.StatusAccepted, job)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	var (
+		job *service.Job
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet:
+		job, err = h.service.Get(r.Context(), u, id)
+	case http.MethodDelete:
+		job, err = h.service.Cancel(r.Context(), u, id)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, job)
+}
+
+// HandleAdminList 列出所有任务，可按 owner（用户 ID）、type、status 过滤
+func (h *JobHandler) HandleAdminList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := parseJobListQuery(r)
+	query.OwnerUserID = strings.TrimSpace(r.URL.Query().Get("owner"))
+	page, err := h.service.AdminList(r.Context(), query)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, page)
+}
+
+// HandleAdminGet 查询任意任务
+func (h *JobHandler) HandleAdminGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	job, err := h.service.AdminGet(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, job)
+}
+
+// HandleAdminCreate 以管理员身份提交任务，可提交仅限管理员的任务类型
+func (h *JobHandler) HandleAdminCreate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req jobSubmitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	createdBy := ""
+	if u, ok := middleware.GetUserFromContext(r.Context()); ok {
+		createdBy = u.Username
+	}
+	job, err := h.service.SubmitAdmin(r.Context(), createdBy, req.Type, req.Params)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusAccepted, job)
+}
+
+// HandleAdminCancel 取消任意任务
+func (h *JobHandler) HandleAdminCancel(w http.ResponseWriter, r *http.Request) {
+	h.handleAdminAction(w, r, h.service.AdminCancel)
+}
+
+// HandleAdminRetry 重新排队失败或已取消的任务
+func (h *JobHandler) HandleAdminRetry(w http.ResponseWriter, r *http.Request) {
+	h.handleAdminAction(w, r, h.service.AdminRetry)
+}
+
+func (h *JobHandler) handleAdminAction(w http.ResponseWriter, r *http.Request, action func(context.Context, string) (*service.Job, error)) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req jobIDRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ID) == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	job, err := action(r.Context(), req.ID)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, job)
+}
+
+func parseJobListQuery(r *http.Request) service.JobListQuery {
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	return service.JobListQuery{
+		Type:   query.Get("type"),
+		Status: query.Get("status"),
+		Limit:  limit,
+		Offset: offset,
+	}
+}
+
+func (h *JobHandler) writeJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil && h.logger != nil {
+		h.logger.Error("failed to write job response", zap.Error(err))
+	}
+}
+
+func (h *JobHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrJobNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrJobForbidden), errors.Is(err, auth.ErrAppScopeDenied), errors.Is(err, auth.ErrAppScopeRequired):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, service.ErrJobInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrJobConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case isRequestCanceled(err):
+	default:
+		if h.logger != nil {
+			h.logger.Error("job request error", zap.Error(err))
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+func TestNextcloudChunkedUploadAssemblesFile(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	handler, owner := newNextcloudTestHandler(t, root)
+	destination := "https://example.com/remote.php/dav/files/alice/personal/movie.bin"
+
+	rec := serveNextcloudUpload(handler, owner, "MKCOL", "/remote.php/dav/uploads/alice/web-file-upload-1", "", map[string]string{
+		"Destination":     destination,
+		"OC-Total-Length": "11",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("MKCOL: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = serveNextcloudUpload(handler, owner, "MKCOL", "/remote.php/dav/uploads/alice/web-file-upload-1", "", map[string]string{"Destination": destination})
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("duplicate MKCOL: expected 405, got %d", rec.Code)
+	}
+	for _, chunk := range []struct{ name, body string }{{"00002", "world"}, {"00001", "hello "}} {
+		rec = serveNextcloudUpload(handler, owner, http.MethodPut, "/remote.php/dav/uploads/alice/web-file-upload-1/"+chunk.name, chunk.body, nil)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("PUT %s: expected 201, got %d: %s", chunk.name, rec.Code, rec.Body.String())
+		}
+	}
+	rec = serveNextcloudUpload(handler, owner, "PROPFIND", "/remote.php/dav/uploads/alice/web-file-upload-1", "", map[string]string{"Depth": "1"})
+	if rec.Code != http.StatusMultiStatus || !strings.Contains(rec.Body.String(), "/remote.php/dav/uploads/alice/web-file-upload-1/2") {
+		t.Fatalf("PROPFIND: expected chunk listing, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = serveNextcloudUpload(handler, owner, "MOVE", "/remote.php/dav/uploads/alice/web-file-upload-1/.file", "", map[string]string{
+		"Destination":     destination,
+		"OC-Total-Length": "11",
+		"X-OC-Mtime":      "1700000000",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("MOVE: expected 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("OC-ETag") == "" || rec.Header().Get("X-OC-MTime") != "accepted" {
+		t.Fatalf("expected etag and mtime headers, got %v", rec.Header())
+	}
+	fullPath := filepath.Join(root, "alice", "personal", "movie.bin")
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello world" {
+		t.Fatalf("unexpected content %q", string(data))
+	}
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ModTime().Unix() != 1700000000 {
+		t.Fatalf("expected mtime to be applied, got %v", info.ModTime())
+	}
+}
+
+func TestNextcloudUploadsRejectOtherUser(t *testing.T) {
+	t.Parallel()
+
+	handler, owner := newNextcloudTestHandler(t, t.TempDir())
+	rec := serveNextcloudUpload(handler, owner, "MKCOL", "/remote.php/dav/uploads/bob/transfer", "", map[string]string{
+		"Destination": "/remote.php/dav/files/bob/personal/file.txt",
+	})
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403, got %d", rec.Code)
+	}
+}
+
+func TestNextcloudDestinationPath(t *testing.T) {
+	t.Parallel()
+
+	handler, owner := newNextcloudTestHandler(t, t.TempDir())
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "https://cloud.example.com/remote.php/dav/files/alice/personal/a%20b.txt", want: "/personal/a b.txt"},
+		{raw: "/remote.php/webdav/personal/file.txt", want: "/personal/file.txt"},
+		{raw: "/dav/personal/file.txt", want: "/personal/file.txt"},
+		{raw: "/remote.php/dav/files/bob/personal/file.txt", wantErr: true},
+		{raw: "/other/personal/file.txt", wantErr: true},
+		{raw: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := handler.destinationPath(tt.raw, owner)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("destinationPath(%q): expected error, got %q", tt.raw, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Fatalf("destinationPath(%q) = %q, %v; want %q", tt.raw, got, err, tt.want)
+		}
+	}
+}
+
+func TestNextcloudMountDAVRewritesPaths(t *testing.T) {
+	t.Parallel()
+
+	handler, _ := newNextcloudTestHandler(t, t.TempDir())
+	var gotPath, gotDestination string
+	mounted := handler.MountDAV(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotDestination = r.URL.Path, r.Header.Get("Destination")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		target, destination string
+		wantCode            int
+		wantPath, wantDest  string
+	}{
+		{target: "/remote.php/webdav", wantCode: http.StatusNoContent, wantPath: "/dav/"},
+		{target: "/remote.php/dav/files/alice/personal/a.txt", destination: "https://cloud.example.com/remote.php/dav/files/alice/personal/b.txt",
+			wantCode: http.StatusNoContent, wantPath: "/dav/personal/a.txt", wantDest: "/dav/personal/b.txt"},
+		{target: "/remote.php/webdav/personal/a.txt", destination: "/remote.php/dav/files/alice/personal/b.txt", wantCode: http.StatusBadGateway},
+		{target: "/remote.php/dav/files/alice/a.txt", destination: "/remote.php/dav/files/bob/a.txt", wantCode: http.StatusBadGateway},
+		{target: "/remote.php/dav/files/", wantCode: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		gotPath, gotDestination = "", ""
+		req := httptest.NewRequest("MOVE", tt.target, nil)
+		if tt.destination != "" {
+			req.Header.Set("Destination", tt.destination)
+		}
+		rec := httptest.NewRecorder()
+		mounted.ServeHTTP(rec, req)
+		if rec.Code != tt.wantCode || gotPath != tt.wantPath || gotDestination != tt.wantDest {
+			t.Fatalf("%s -> %d %q %q; want %d %q %q", tt.target, rec.Code, gotPath, gotDestination, tt.wantCode, tt.wantPath, tt.wantDest)
+		}
+	}
+}
+
+func newNextcloudTestHandler(t *testing.T, root string) (*NextcloudHandler, *user.User) {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Prefix = "/dav"
+	cfg.WebDAV.Directory = root
+	owner := user.NewUser("alice", "alice")
+	owner.ID = "user-alice"
+	if err := os.MkdirAll(filepath.Join(root, "alice", "personal"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	uploads := service.NewUploadSessionService(cfg, nil, nil, nil, nil, nil, zap.NewNop())
+	return NewNextcloudHandler(cfg, uploads, zap.NewNop()), owner
+}
+
+func serveNextcloudUpload(handler *NextcloudHandler, u *user.User, method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, u))
+	rec := httptest.NewRecorder()
+	handler.HandleUploads(rec, req)
+	return rec
+}
@@ -16,6 +16,7 @@ import (
 // RecycleHandler 回收站处理器
 type RecycleHandler struct {
 	recycleService *service.RecycleService
+	jobs           *service.JobService
 	userRepo       user.Repository
 	logger         *zap.Logger
 }
@@ -33,6 +34,11 @@ func NewRecycleHandler(
 	}
 }
 
+// SetJobService 注入后台任务服务，启用 ?async=true 的异步清空
+func (h *RecycleHandler) SetJobService(jobs *service.JobService) {
+	h.jobs = jobs
+}
+
 // HandleList 处理获取回收站列表
 func (h *RecycleHandler) HandleList(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -91,7 +97,12 @@ func (h *RecycleHandler) HandleRecover(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Hash string `json:"hash"`
+		Hash       string   `json:"hash"`
+		Hashes     []string `json:"hashes"`
+		BatchID    string   `json:"batchId"`
+		TargetPath string   `json:"targetPath"`
+		TargetDir  string   `json:"targetDir"`
+		Conflict   string   `json:"conflict"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Warn("invalid request body", zap.Error(err))
@@ -99,12 +110,34 @@ func (h *RecycleHandler) HandleRecover(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.Hash == "" {
-		http.Error(w, "hash is required", http.StatusBadRequest)
+	if req.Hash == "" && len(req.Hashes) == 0 && req.BatchID == "" {
+		http.Error(w, "hash, hashes or batchId is required", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.recycleService.Recover(r.Context(), u, req.Hash); err != nil {
+	opts := service.RecoverOptions{
+		TargetPath: req.TargetPath,
+		TargetDir:  req.TargetDir,
+		Conflict:   req.Conflict,
+	}
+	response := map[string]interface{}{"message": "recovered successfully"}
+	var err error
+	switch {
+	case req.BatchID != "":
+		// 恢复同一次删除的全部项目
+		var results []*service.RecoverResult
+		results, err = h.recycleService.RecoverBatch(r.Context(), u, req.BatchID, opts)
+		response["results"] = results
+	case len(req.Hashes) > 0:
+		var results []*service.RecoverResult
+		results, err = h.recycleService.RecoverMany(r.Context(), u, req.Hashes, opts)
+		response["results"] = results
+	default:
+		var result *service.RecoverResult
+		result, err = h.recycleService.RecoverWithOptions(r.Context(), u, req.Hash, opts)
+		response["result"] = result
+	}
+	if err != nil {
 		if errors.Is(err, auth.ErrAppScopeDenied) || errors.Is(err, auth.ErrAppScopeRequired) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
@@ -112,13 +145,14 @@ func (h *RecycleHandler) HandleRecover(w http.ResponseWriter, r *http.Request) {
 		h.logger.Error("failed to recover file",
 			zap.String("username", u.Username),
 			zap.String("hash", req.Hash),
+			zap.String("batch_id", req.BatchID),
 			zap.Error(err))
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte(`{"message":"recovered successfully"}`)); err != nil {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
 		h.logger.Error("failed to write response", zap.Error(err))
 	}
 }
@@ -184,6 +218,28 @@ func (h *RecycleHandler) HandleClear(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 回收站较大时改为后台任务执行，返回 202 与任务，进度通过 /api/v1/public/jobs/{id} 查询
+	if r.URL.Query().Get("async") == "true" && h.jobs != nil {
+		job, err := h.jobs.Submit(r.Context(), u, service.JobTypeRecycleClear, nil)
+		if err != nil {
+			if errors.Is(err, auth.ErrAppScopeDenied) || errors.Is(err, auth.ErrAppScopeRequired) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			h.logger.Error("failed to submit recycle clear job",
+				zap.String("username", u.Username),
+				zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(job); err != nil {
+			h.logger.Error("failed to encode response", zap.Error(err))
+		}
+		return
+	}
+
 	deleted, err := h.recycleService.Clear(r.Context(), u)
 	if err != nil {
 		if errors.Is(err, auth.ErrAppScopeDenied) || errors.Is(err, auth.ErrAppScopeRequired) {
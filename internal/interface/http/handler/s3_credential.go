@@ -10,7 +10,9 @@ import (
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/domain/s3credential"
+	"github.com/yeying-community/warehouse/internal/domain/team"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
@@ -18,6 +20,7 @@ import (
 
 type S3CredentialHandler struct {
 	repo   repository.S3CredentialRepository
+	teams  *service.TeamService
 	logger *zap.Logger
 }
 
@@ -25,6 +28,11 @@ func NewS3CredentialHandler(repo repository.S3CredentialRepository, logger *zap.
 	return &S3CredentialHandler{repo: repo, logger: logger}
 }
 
+// SetTeamService 允许把凭证绑定到 /teams/<id> 团队空间
+func (h *S3CredentialHandler) SetTeamService(teams *service.TeamService) {
+	h.teams = teams
+}
+
 func (h *S3CredentialHandler) HandleList(w http.ResponseWriter, r *http.Request) {
 	u, ok := middleware.GetUserFromContext(r.Context())
 	if !ok {
@@ -70,8 +78,21 @@ func (h *S3CredentialHandler) HandleCreate(w http.ResponseWriter, r *http.Reques
 		return
 	}
 	rootPath := normalizeS3RootPath(req.RootPath)
-	if !isAllowedS3RootPath(rootPath) {
-		http.Error(w, "rootPath must be under /personal, /apps, or /services", http.StatusBadRequest)
+	if teamID, _, isTeam := team.SplitSpacePath(rootPath); isTeam && h.teams.Enabled() {
+		if teamID == "" {
+			http.Error(w, "rootPath must name a team space", http.StatusBadRequest)
+			return
+		}
+		item, err := h.teams.Get(r.Context(), u, teamID)
+		if err == nil && item.Role == "" {
+			err = team.ErrPermissionDenied
+		}
+		if err != nil {
+			writeTeamError(w, err)
+			return
+		}
+	} else if !isAllowedS3RootPath(rootPath) {
+		http.Error(w, "rootPath must be under /personal, /apps, /services, or /teams/<id>", http.StatusBadRequest)
 		return
 	}
 	secretBytes := make([]byte, 32)
@@ -0,0 +1,343 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// SearchHandler 文件名与元数据搜索处理器
+type SearchHandler struct {
+	service *service.SearchService
+	logger  *zap.Logger
+}
+
+type searchResultResponse struct {
+	Path        string   `json:"path"`
+	Name        string   `json:"name"`
+	IsDir       bool     `json:"isDir"`
+	Size        int64    `json:"size"`
+	ContentType string   `json:"contentType,omitempty"`
+	ModifiedAt  string   `json:"modifiedAt"`
+	Tags        []string `json:"tags"`
+	Space       string   `json:"space"`
+	ResourceID  string   `json:"resourceId,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+}
+
+type contentSearchResultResponse struct {
+	searchResultResponse
+	Snippet string `json:"snippet"`
+}
+
+func NewSearchHandler(searchService *service.SearchService, logger *zap.Logger) *SearchHandler {
+	return &SearchHandler{service: searchService, logger: logger}
+}
+
+// HandleSearch 按名称、路径、扩展名、大小、修改时间、类型与标签搜索
+// 个人 / 应用 / 服务空间以及收到的共享
+func (h *SearchHandler) HandleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query, err := parseSearchQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	page, err := h.service.Search(r.Context(), u, query)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	items := make([]searchResultResponse, 0, len(page.Items))
+	for _, item := range page.Items {
+		items = append(items, buildSearchResultResponse(item))
+	}
+	resp := map[string]any{
+		"items":   items,
+		"hasMore": page.HasMore,
+	}
+	if page.HasMore {
+		resp["nextOffset"] = page.NextOffset
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleSetTags 替换自己空间内某个文件或目录的标签
+func (h *SearchHandler) HandleSetTags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Path string   `json:"path"`
+		Tags []string `json:"tags"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	result, err := h.service.SetTags(r.Context(), u, req.Path, req.Tags)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, buildSearchResultResponse(*result))
+}
+
+// HandleContentSearch 全文内容搜索：q 为查询词（支持 "短语"、-排除、or），
+// 返回带 <mark> 高亮片段的结果；范围与权限规则同文件名搜索
+func (h *SearchHandler) HandleContentSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	values := r.URL.Query()
+	query := service.ContentSearchQuery{
+		Query:      strings.TrimSpace(values.Get("q")),
+		Path:       strings.TrimSpace(values.Get("path")),
+		Space:      strings.TrimSpace(values.Get("space")),
+		Extensions: splitSearchValues(values["ext"]),
+	}
+	if query.Query == "" {
+		http.Error(w, "q is required", http.StatusBadRequest)
+		return
+	}
+	for _, field := range []struct {
+		name   string
+		target *int
+	}{{"limit", &query.Limit}, {"offset", &query.Offset}} {
+		raw := strings.TrimSpace(values.Get(field.name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("invalid %s %q", field.name, raw), http.StatusBadRequest)
+			return
+		}
+		*field.target = n
+	}
+
+	page, err := h.service.SearchContent(r.Context(), u, query)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	items := make([]contentSearchResultResponse, 0, len(page.Items))
+	for _, item := range page.Items {
+		items = append(items, contentSearchResultResponse{
+			searchResultResponse: buildSearchResultResponse(item.SearchResult),
+			Snippet:              item.Snippet,
+		})
+	}
+	resp := map[string]any{
+		"items":   items,
+		"hasMore": page.HasMore,
+	}
+	if page.HasMore {
+		resp["nextOffset"] = page.NextOffset
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+// HandleContentSettings GET 查看各空间是否开启内容索引，PUT {"spaces": [...]} 替换开启的空间
+func (h *SearchHandler) HandleContentSettings(w http.ResponseWriter, r *http.Request) {
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := h.service.ContentSettings(r.Context(), u)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, settings)
+	case http.MethodPut:
+		var req struct {
+			Spaces []string `json:"spaces"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		settings, err := h.service.SetContentSpaces(r.Context(), u, req.Spaces)
+		if err != nil {
+			h.writeError(w, err)
+			return
+		}
+		h.writeJSON(w, http.StatusOK, settings)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parseSearchQuery 解析搜索查询参数；tag 与 ext 可重复或以逗号分隔
+func parseSearchQuery(values url.Values) (service.SearchQuery, error) {
+	query := service.SearchQuery{
+		Name:        strings.TrimSpace(values.Get("q")),
+		Path:        strings.TrimSpace(values.Get("path")),
+		Space:       strings.TrimSpace(values.Get("space")),
+		ContentType: strings.TrimSpace(values.Get("type")),
+		Extensions:  splitSearchValues(values["ext"]),
+		Tags:        splitSearchValues(values["tag"]),
+	}
+
+	var err error
+	if query.MinSize, err = parseSearchInt64(values, "minSize"); err != nil {
+		return query, err
+	}
+	if query.MaxSize, err = parseSearchInt64(values, "maxSize"); err != nil {
+		return query, err
+	}
+	if query.ModifiedAfter, err = parseSearchTime(values, "modifiedAfter"); err != nil {
+		return query, err
+	}
+	if query.ModifiedBefore, err = parseSearchTime(values, "modifiedBefore"); err != nil {
+		return query, err
+	}
+
+	switch kind := strings.ToLower(strings.TrimSpace(values.Get("kind"))); kind {
+	case "", "all":
+	case "file":
+		isDir := false
+		query.IsDir = &isDir
+	case "dir", "folder":
+		isDir := true
+		query.IsDir = &isDir
+	default:
+		return query, fmt.Errorf("invalid kind %q", kind)
+	}
+
+	for _, field := range []struct {
+		name   string
+		target *int
+	}{{"limit", &query.Limit}, {"offset", &query.Offset}} {
+		raw := strings.TrimSpace(values.Get(field.name))
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			return query, fmt.Errorf("invalid %s %q", field.name, raw)
+		}
+		*field.target = n
+	}
+	return query, nil
+}
+
+func splitSearchValues(raw []string) []string {
+	var values []string
+	for _, item := range raw {
+		for _, part := range strings.Split(item, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				values = append(values, part)
+			}
+		}
+	}
+	return values
+}
+
+func parseSearchInt64(values url.Values, name string) (*int64, error) {
+	raw := strings.TrimSpace(values.Get(name))
+	if raw == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid %s %q", name, raw)
+	}
+	return &n, nil
+}
+
+// parseSearchTime 接受 RFC3339 或 YYYY-MM-DD（按 UTC 零点）
+func parseSearchTime(values url.Values, name string) (*time.Time, error) {
+	raw := strings.TrimSpace(values.Get(name))
+	if raw == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s %q", name, raw)
+}
+
+func buildSearchResultResponse(item service.SearchResult) searchResultResponse {
+	tags := item.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return searchResultResponse{
+		Path:        item.Path,
+		Name:        item.Name,
+		IsDir:       item.IsDir,
+		Size:        item.Size,
+		ContentType: item.ContentType,
+		ModifiedAt:  item.ModifiedAt.Format(timeLayout),
+		Tags:        tags,
+		Space:       item.Space,
+		ResourceID:  item.ResourceID,
+		Owner:       item.Owner,
+	}
+}
+
+func (h *SearchHandler) writeJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil && h.logger != nil {
+		h.logger.Error("failed to write search response", zap.Error(err))
+	}
+}
+
+func (h *SearchHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrSearchDisabled):
+		http.Error(w, "Search is disabled", http.StatusNotImplemented)
+	case errors.Is(err, service.ErrContentSearchDisabled):
+		http.Error(w, "Content search is disabled", http.StatusNotImplemented)
+	case errors.Is(err, service.ErrSearchNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrSearchDenied), errors.Is(err, auth.ErrAppScopeDenied), errors.Is(err, auth.ErrAppScopeRequired):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, service.ErrSearchInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		if h.logger != nil {
+			h.logger.Error("search error", zap.Error(err))
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
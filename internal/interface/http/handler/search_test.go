@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	values := url.Values{
+		"q":             {"report"},
+		"ext":           {"pdf,DOCX", "txt"},
+		"tag":           {"work", "2024"},
+		"minSize":       {"10"},
+		"modifiedAfter": {"2024-01-02"},
+		"kind":          {"file"},
+		"space":         {"personal"},
+		"limit":         {"20"},
+		"offset":        {"40"},
+	}
+	query, err := parseSearchQuery(values)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if query.Name != "report" || query.Space != "personal" || query.Limit != 20 || query.Offset != 40 {
+		t.Fatalf("unexpected query: %+v", query)
+	}
+	if len(query.Extensions) != 3 || len(query.Tags) != 2 {
+		t.Fatalf("extensions = %v tags = %v", query.Extensions, query.Tags)
+	}
+	if query.MinSize == nil || *query.MinSize != 10 || query.IsDir == nil || *query.IsDir {
+		t.Fatalf("unexpected filters: %+v", query)
+	}
+	if query.ModifiedAfter == nil || query.ModifiedAfter.Format("2006-01-02") != "2024-01-02" {
+		t.Fatalf("modifiedAfter = %v", query.ModifiedAfter)
+	}
+
+	for _, bad := range []url.Values{
+		{"minSize": {"-1"}},
+		{"modifiedBefore": {"yesterday"}},
+		{"kind": {"link"}},
+		{"limit": {"x"}},
+	} {
+		if _, err := parseSearchQuery(bad); err == nil {
+			t.Fatalf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestHandleContentSearchValidatesRequest(t *testing.T) {
+	h := NewSearchHandler(nil, nil)
+	alice := user.NewUser("alice", "alice")
+
+	resp := httptest.NewRecorder()
+	h.HandleContentSearch(resp, newAssetObjectRequest(t, http.MethodGet, "/api/v1/public/search/content?q=%20", nil, alice))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("empty q: status = %d", resp.Code)
+	}
+	resp = httptest.NewRecorder()
+	h.HandleContentSearch(resp, newAssetObjectRequest(t, http.MethodGet, "/api/v1/public/search/content?q=plan&limit=x", nil, alice))
+	if resp.Code != http.StatusBadRequest {
+		t.Fatalf("bad limit: status = %d", resp.Code)
+	}
+	// A nil service means search is not configured.
+	resp = httptest.NewRecorder()
+	h.HandleContentSearch(resp, newAssetObjectRequest(t, http.MethodGet, "/api/v1/public/search/content?q=plan", nil, alice))
+	if resp.Code != http.StatusNotImplemented {
+		t.Fatalf("disabled: status = %d", resp.Code)
+	}
+}
+
+func TestContentSearchResultResponseIsFlat(t *testing.T) {
+	item := service.ContentSearchResult{
+		SearchResult: service.SearchResult{Path: "/personal/plan.md", Name: "plan.md", Space: "personal", ModifiedAt: time.Unix(0, 0).UTC()},
+		Snippet:      "<mark>plan</mark>",
+	}
+	raw, err := json.Marshal(contentSearchResultResponse{
+		searchResultResponse: buildSearchResultResponse(item.SearchResult),
+		Snippet:              item.Snippet,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["path"] != "/personal/plan.md" || decoded["snippet"] != "<mark>plan</mark>" || decoded["space"] != "personal" {
+		t.Fatalf("response = %s", raw)
+	}
+}
@@ -3,13 +3,18 @@ package handler
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"html"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 	"github.com/yeying-community/warehouse/internal/domain/share"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
@@ -18,6 +23,11 @@ import (
 // ShareHandler 文件分享处理器
 type ShareHandler struct {
 	shareService *service.ShareService
+	thumbnails   *service.ThumbnailService
+	archives     *service.ArchiveService
+	uploads      *service.UploadSessionService
+	clientIPs    *middleware.ClientIPResolver
+	names        pathname.Policy
 	logger       *zap.Logger
 }
 
@@ -29,6 +39,27 @@ func NewShareHandler(shareService *service.ShareService, logger *zap.Logger) *Sh
 	}
 }
 
+// SetThumbnailService 启用分享文件的缩略图
+func (h *ShareHandler) SetThumbnailService(thumbnails *service.ThumbnailService) {
+	h.thumbnails = thumbnails
+}
+
+// SetArchiveService 启用目录分享的打包下载
+func (h *ShareHandler) SetArchiveService(archives *service.ArchiveService) {
+	h.archives = archives
+}
+
+// SetClientIPResolver 设置识别客户端地址的解析器，用于密码错误限流与访问日志；
+// 未设置时使用直连对端地址
+func (h *ShareHandler) SetClientIPResolver(resolver *middleware.ClientIPResolver) {
+	h.clientIPs = resolver
+}
+
+// SetNamePolicy 设置分享内相对路径的文件名规范化策略
+func (h *ShareHandler) SetNamePolicy(policy pathname.Policy) {
+	h.names = policy
+}
+
 // HandleCreate 创建分享链接
 func (h *ShareHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -49,6 +80,16 @@ func (h *ShareHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 		ExpiresIn    int64  `json:"expiresIn"`
 		ExpiresValue int64  `json:"expiresValue"`
 		ExpiresUnit  string `json:"expiresUnit"`
+		Password     string `json:"password"`
+		MaxViews     int64  `json:"maxViews"`
+		MaxDownloads int64  `json:"maxDownloads"`
+		// Upload 上传模式的单链接限制
+		Upload struct {
+			MaxFileSize       int64    `json:"maxFileSize"`
+			MaxTotalBytes     int64    `json:"maxTotalBytes"`
+			MaxFiles          int64    `json:"maxFiles"`
+			AllowedExtensions []string `json:"allowedExtensions"`
+		} `json:"upload"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		h.logger.Warn("invalid request body", zap.Error(err))
@@ -61,7 +102,16 @@ func (h *ShareHandler) HandleCreate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	item, err := h.shareService.Create(r.Context(), u, req.Path, service.ShareCreateInput{
-		Mode: req.Mode,
+		Mode:         req.Mode,
+		Password:     req.Password,
+		MaxViews:     req.MaxViews,
+		MaxDownloads: req.MaxDownloads,
+		Upload: share.UploadLimits{
+			MaxFileSize:       req.Upload.MaxFileSize,
+			MaxTotalBytes:     req.Upload.MaxTotalBytes,
+			MaxFiles:          req.Upload.MaxFiles,
+			AllowedExtensions: req.Upload.AllowedExtensions,
+		},
 		Expiry: service.ShareExpiryInput{
 			ExpiresIn:    req.ExpiresIn,
 			ExpiresValue: req.ExpiresValue,
@@ -90,13 +140,20 @@ func (h *ShareHandler) writeShareCreateResponse(w http.ResponseWriter, r *http.R
 		"name":          item.Name,
 		"path":          item.Path,
 		"mode":          item.Mode,
+		"isDir":         item.IsDir,
 		"url":           h.buildShareURL(r, item.Token, item.Name),
 		"viewCount":     item.ViewCount,
 		"downloadCount": item.DownloadCount,
+		"maxViews":      item.MaxViews,
+		"maxDownloads":  item.MaxDownloads,
+		"hasPassword":   item.HasPassword(),
 	}
 	if item.ExpiresAt != nil {
 		resp["expiresAt"] = item.ExpiresAt.Format(timeLayout)
 	}
+	if item.IsUploadMode() {
+		resp["upload"] = buildShareUploadResponse(item)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -121,12 +178,15 @@ func (h *ShareHandler) HandleCreateFromReceivedResource(w http.ResponseWriter, r
 		Mode         string `json:"mode"`
 		ExpiresValue int64  `json:"expiresValue"`
 		ExpiresUnit  string `json:"expiresUnit"`
+		Password     string `json:"password"`
+		MaxViews     int64  `json:"maxViews"`
+		MaxDownloads int64  `json:"maxDownloads"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.ResourceID) == "" {
 		http.Error(w, "resourceId is required", http.StatusBadRequest)
 		return
 	}
-	item, err := h.shareService.CreateFromReceivedResource(r.Context(), u, req.ResourceID, req.RelativePath, service.ShareCreateInput{Mode: req.Mode, Expiry: service.ShareExpiryInput{ExpiresValue: req.ExpiresValue, ExpiresUnit: req.ExpiresUnit}})
+	item, err := h.shareService.CreateFromReceivedResource(r.Context(), u, req.ResourceID, req.RelativePath, service.ShareCreateInput{Mode: req.Mode, Password: req.Password, MaxViews: req.MaxViews, MaxDownloads: req.MaxDownloads, Expiry: service.ShareExpiryInput{ExpiresValue: req.ExpiresValue, ExpiresUnit: req.ExpiresUnit}})
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -166,11 +226,17 @@ func (h *ShareHandler) HandleList(w http.ResponseWriter, r *http.Request) {
 		Name          string `json:"name"`
 		Path          string `json:"path"`
 		Mode          string `json:"mode"`
+		IsDir         bool   `json:"isDir"`
 		URL           string `json:"url"`
 		ViewCount     int64  `json:"viewCount"`
 		DownloadCount int64  `json:"downloadCount"`
+		MaxViews      int64  `json:"maxViews"`
+		MaxDownloads  int64  `json:"maxDownloads"`
+		HasPassword   bool   `json:"hasPassword"`
 		ExpiresAt     string `json:"expiresAt,omitempty"`
 		CreatedAt     string `json:"createdAt"`
+		// Upload 仅上传模式返回
+		Upload *shareUploadResponse `json:"upload,omitempty"`
 	}
 
 	resp := struct {
@@ -185,10 +251,15 @@ func (h *ShareHandler) HandleList(w http.ResponseWriter, r *http.Request) {
 			Name:          item.Name,
 			Path:          item.Path,
 			Mode:          item.Mode,
+			IsDir:         item.IsDir,
 			URL:           h.buildShareURL(r, item.Token, item.Name),
 			ViewCount:     item.ViewCount,
 			DownloadCount: item.DownloadCount,
+			MaxViews:      item.MaxViews,
+			MaxDownloads:  item.MaxDownloads,
+			HasPassword:   item.HasPassword(),
 			CreatedAt:     item.CreatedAt.Format(timeLayout),
+			Upload:        buildShareUploadResponse(item),
 		}
 		if item.ExpiresAt != nil {
 			rsp.ExpiresAt = item.ExpiresAt.Format(timeLayout)
@@ -249,9 +320,60 @@ func (h *ShareHandler) HandleRevoke(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleAccess 访问分享链接（公开）
+// HandleSetPassword 设置、修改或移除（password 为空）分享的访问密码，链接不变
+func (h *ShareHandler) HandleSetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.shareService.SetPassword(r.Context(), u, req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, auth.ErrAppScopeDenied) || errors.Is(err, auth.ErrAppScopeRequired) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, share.ErrShareNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.logger.Warn("failed to update share password",
+			zap.String("username", u.Username),
+			zap.String("token", req.Token),
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeShareCreateResponse(w, r, item)
+}
+
+// HandleAccess 访问分享链接（公开）。文件分享按分享模式预览或下载，目录分享返回根目录列表，
+// 上传模式分享只返回上传所需的分享信息；设置了访问密码的分享需先 POST 密码（表单或 JSON 的 password 字段），
+// 成功后签发短期访问 Cookie 并重定向回分享链接
 func (h *ShareHandler) HandleAccess(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
@@ -261,24 +383,39 @@ func (h *ShareHandler) HandleAccess(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	action := share.AccessView
+	if r.Method == http.MethodPost {
+		action = share.AccessUnlock
+	}
+	aw := trackShareAccess(w, action)
+	defer h.recordShareAccess(r, aw, token, "")
+	w = aw
 
-	item, file, info, err := h.shareService.Resolve(r.Context(), token)
+	item, fullPath, info, err := h.shareService.ResolveEntry(r.Context(), token, "")
+	if errors.Is(err, share.ErrShareUploadOnly) {
+		h.handleUploadShareAccess(w, r, token)
+		return
+	}
 	if err != nil {
-		if err == share.ErrShareNotFound || err == share.ErrInvalidShare || errors.Is(err, os.ErrNotExist) {
-			http.NotFound(w, r)
-			return
-		}
-		if err == share.ErrShareExpired {
-			http.Error(w, "share expired", http.StatusGone)
+		h.writeResolveError(w, r, err)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if !item.HasPassword() {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
-		h.logger.Error("failed to resolve share", zap.Error(err))
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		h.unlockShare(w, r, item)
+		return
+	}
+	if !h.authorizeShareAccess(w, r, item, true) {
 		return
 	}
-	defer file.Close()
 
 	if !hasFilename {
+		// 规范化链接的跳转不单独记录，跳转后的请求会被记录
+		aw.action = ""
 		location := h.buildShareURL(r, item.Token, item.Name)
 		if r.URL.RawQuery != "" {
 			location += "?" + r.URL.RawQuery
@@ -287,23 +424,397 @@ func (h *ShareHandler) HandleAccess(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if info.IsDir() {
+		aw.action = share.AccessList
+		h.serveShareListing(w, r, item, "")
+		return
+	}
+	aw.action = fileAccessAction(item)
+	h.serveShareFile(w, r, item, fullPath)
+}
+
+// handleUploadShareAccess 上传模式分享的链接：POST 校验访问密码，GET 返回上传信息
+func (h *ShareHandler) handleUploadShareAccess(w http.ResponseWriter, r *http.Request, token string) {
+	item, err := h.shareService.ResolveUpload(r.Context(), token)
+	if err != nil {
+		h.writeResolveError(w, r, err)
+		return
+	}
+	if r.Method == http.MethodPost {
+		if !item.HasPassword() {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h.unlockShare(w, r, item)
+		return
+	}
+	if !h.authorizeShareAccess(w, r, item, true) {
+		return
+	}
+	h.writeUploadShareInfo(w, r, item)
+}
+
+// HandleEntries 目录分享的 JSON 列表（公开）：/api/v1/public/share/entries/{token}?path=sub/dir，
+// path 相对分享根目录，不能离开分享根目录
+func (h *ShareHandler) HandleEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := parseShareTokenPath(r.URL.Path, shareEntriesPath)
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	relPath := r.URL.Query().Get("path")
+	aw := trackShareAccess(w, share.AccessList)
+	defer h.recordShareAccess(r, aw, token, relPath)
+	w = aw
+	item, _, info, err := h.shareService.ResolveEntry(r.Context(), token, relPath)
+	if err != nil {
+		h.writeResolveError(w, r, err)
+		return
+	}
+	if !h.authorizeShareAccess(w, r, item, false) {
+		return
+	}
+	if !info.IsDir() {
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return
+	}
+	h.serveShareListing(w, r, item, relPath)
+}
+
+// HandleDownload 目录分享内的单个文件或子目录（公开）：/api/v1/public/share/download/{token}?path=a/b.pdf。
+// 文件按分享模式内联预览或作为附件下载；目录（含分享根目录）打包为 zip/tar.gz，仅下载模式可用
+func (h *ShareHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := parseShareTokenPath(r.URL.Path, shareDownloadPath)
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	relPath := r.URL.Query().Get("path")
+	aw := trackShareAccess(w, share.AccessDownload)
+	defer h.recordShareAccess(r, aw, token, relPath)
+	w = aw
+	item, fullPath, info, err := h.shareService.ResolveEntry(r.Context(), token, relPath)
+	if err != nil {
+		h.writeResolveError(w, r, err)
+		return
+	}
+	if !h.authorizeShareAccess(w, r, item, false) {
+		return
+	}
+	if !info.IsDir() {
+		aw.action = fileAccessAction(item)
+		h.serveShareFile(w, r, item, fullPath)
+		return
+	}
+	aw.action = share.AccessArchive
+
+	if item.IsPreviewMode() {
+		http.Error(w, "Archive download is not allowed for preview shares", http.StatusForbidden)
+		return
+	}
+	if h.archives == nil {
+		http.Error(w, "Path is a directory", http.StatusBadRequest)
+		return
+	}
+	name := info.Name()
+	plan, err := h.archives.Plan(r.Context(), service.ArchiveRequest{
+		Format:  r.URL.Query().Get("format"),
+		Sources: []service.ArchiveSource{{FullPath: fullPath, Name: name}},
+	})
+	switch {
+	case err == nil:
+		// 与单文件下载一致：先计访问再计下载，已达次数上限的请求按过期处理，
+		// 访问次数用尽时不消耗下载次数
+		if r.Method == http.MethodGet {
+			if err := h.shareService.IncrementView(r.Context(), item.Token); errors.Is(err, share.ErrShareExpired) {
+				h.writeResolveError(w, r, err)
+				return
+			}
+			if err := h.shareService.IncrementDownload(r.Context(), item.Token); errors.Is(err, share.ErrShareExpired) {
+				h.writeResolveError(w, r, err)
+				return
+			}
+		}
+		h.archives.ServePlan(w, r, plan, name)
+	case errors.Is(err, service.ErrArchiveTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, service.ErrArchiveInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case os.IsNotExist(err):
+		http.NotFound(w, r)
+	default:
+		h.logger.Error("failed to build share archive", zap.String("token", item.Token), zap.Error(err))
+		http.Error(w, "Failed to build archive", http.StatusInternalServerError)
+	}
+}
+
+// HandleThumbnail 分享图片的缩略图（公开）：/api/v1/public/share/thumbnail/{token}?size=256，
+// 目录分享以 path 指定目录内的图片；下载与预览模式均可用，不计入访问与下载次数
+func (h *ShareHandler) HandleThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := parseShareTokenPath(r.URL.Path, "/api/v1/public/share/thumbnail/")
+	if token == "" {
+		http.NotFound(w, r)
+		return
+	}
+	size, ok := parseThumbnailSize(w, r)
+	if !ok {
+		return
+	}
+
+	item, fullPath, _, err := h.shareService.ResolveEntry(r.Context(), token, r.URL.Query().Get("path"))
+	if err != nil {
+		h.writeResolveError(w, r, err)
+		return
+	}
+	if err := h.checkShareAccess(r, item); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	f, meta, err := h.thumbnails.OpenFile(r.Context(), fullPath, size)
+	if err != nil {
+		writeThumbnailError(w, h.logger, err)
+		return
+	}
+	defer f.Close()
+	serveThumbnail(w, r, f, meta)
+}
+
+// authorizeShareAccess 校验受密码保护分享的访问 Cookie；prompt 为 true 时浏览器请求返回密码输入页
+func (h *ShareHandler) authorizeShareAccess(w http.ResponseWriter, r *http.Request, item *share.ShareItem, prompt bool) bool {
+	if !item.HasPassword() {
+		return true
+	}
+	if err := h.checkShareAccess(r, item); err != nil {
+		if prompt {
+			h.writePasswordPrompt(w, r, http.StatusUnauthorized, "")
+		} else {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		}
+		return false
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	return true
+}
+
+// serveShareFile 按分享模式输出文件：预览模式内联展示，下载模式作为附件
+func (h *ShareHandler) serveShareFile(w http.ResponseWriter, r *http.Request, item *share.ShareItem, fullPath string) {
+	file, err := h.shareService.Open(fullPath)
+	if err != nil {
+		h.writeResolveError(w, r, err)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
 	if shouldCountAccess(r) {
-		_ = h.shareService.IncrementView(r.Context(), token)
+		// 先计数再输出：次数上限在计数时原子校验，已达上限的请求按过期处理；
+		// 先计访问，访问次数用尽时不消耗下载次数
+		if err := h.shareService.IncrementView(r.Context(), item.Token); errors.Is(err, share.ErrShareExpired) {
+			h.writeResolveError(w, r, err)
+			return
+		}
 		if r.Method == http.MethodGet && !item.IsPreviewMode() {
-			_ = h.shareService.IncrementDownload(r.Context(), token)
+			if err := h.shareService.IncrementDownload(r.Context(), item.Token); errors.Is(err, share.ErrShareExpired) {
+				h.writeResolveError(w, r, err)
+				return
+			}
 		}
 	}
 
 	if item.IsPreviewMode() {
-		setInlineContentDisposition(w, item.Name)
+		setInlineContentDisposition(w, info.Name())
+	} else {
+		setAttachmentContentDisposition(w, info.Name())
+	}
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// serveShareListing 输出目录分享内 relPath 目录的 JSON 列表，根目录的列表计入访问次数
+func (h *ShareHandler) serveShareListing(w http.ResponseWriter, r *http.Request, item *share.ShareItem, relPath string) {
+	_, entries, err := h.shareService.ListEntries(r.Context(), item.Token, relPath)
+	if err != nil {
+		h.writeResolveError(w, r, err)
+		return
+	}
+
+	type entryResp struct {
+		Name        string `json:"name"`
+		Path        string `json:"path"`
+		IsDir       bool   `json:"isDir"`
+		Size        int64  `json:"size"`
+		Modified    string `json:"modified"`
+		DownloadURL string `json:"downloadUrl"`
+	}
+	current := normalizeRelPath(h.names, relPath)
+	resp := struct {
+		Token       string      `json:"token"`
+		Name        string      `json:"name"`
+		Mode        string      `json:"mode"`
+		Path        string      `json:"path"`
+		DownloadURL string      `json:"downloadUrl,omitempty"`
+		Items       []entryResp `json:"items"`
+	}{
+		Token: item.Token,
+		Name:  item.Name,
+		Mode:  item.Mode,
+		Path:  buildShareEntryPath(current, "", true),
+		Items: make([]entryResp, 0, len(entries)),
+	}
+	downloadBase := h.buildShareEndpointURL(r, shareDownloadPath, item.Token)
+	if !item.IsPreviewMode() {
+		resp.DownloadURL = downloadBase + "?path=" + url.QueryEscape(resp.Path)
+	}
+	for _, entry := range entries {
+		rsp := entryResp{
+			Name:     entry.Name,
+			Path:     entry.Path,
+			IsDir:    entry.IsDir,
+			Size:     entry.Size,
+			Modified: entry.ModifiedAt.Format(timeLayout),
+		}
+		if !entry.IsDir || !item.IsPreviewMode() {
+			rsp.DownloadURL = downloadBase + "?path=" + url.QueryEscape(entry.Path)
+		}
+		resp.Items = append(resp.Items, rsp)
+	}
+
+	if r.Method == http.MethodGet && current == "" {
+		if err := h.shareService.IncrementView(r.Context(), item.Token); errors.Is(err, share.ErrShareExpired) {
+			h.writeResolveError(w, r, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+func (h *ShareHandler) writeResolveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, share.ErrShareNotFound), errors.Is(err, share.ErrInvalidShare), errors.Is(err, os.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, share.ErrShareExpired):
+		http.Error(w, "share expired", http.StatusGone)
+	case errors.Is(err, share.ErrShareUploadOnly):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		h.logger.Error("failed to resolve share", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// checkShareAccess 校验请求携带的分享访问 Cookie
+func (h *ShareHandler) checkShareAccess(r *http.Request, item *share.ShareItem) error {
+	value := ""
+	if cookie, err := r.Cookie(service.ShareAccessCookieName(item.Token)); err == nil {
+		value = cookie.Value
+	}
+	return h.shareService.CheckAccess(item, value)
+}
+
+// unlockShare 校验提交的访问密码，成功后写入访问 Cookie 并以 303 重定向到分享链接
+func (h *ShareHandler) unlockShare(w http.ResponseWriter, r *http.Request, item *share.ShareItem) {
+	r.Body = http.MaxBytesReader(w, r.Body, sharePasswordBodyLimit)
+	password := ""
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		password = req.Password
 	} else {
-		setAttachmentContentDisposition(w, item.Name)
+		password = r.PostFormValue("password")
+	}
+
+	value, expiresAt, retryAfter, err := h.shareService.Unlock(item, password, h.clientIP(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, share.ErrShareAccessThrottled):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			h.writePasswordPrompt(w, r, http.StatusTooManyRequests, "Too many attempts, please try again later")
+		case errors.Is(err, share.ErrSharePasswordMismatch):
+			h.writePasswordPrompt(w, r, http.StatusUnauthorized, "Incorrect password")
+		default:
+			h.logger.Error("failed to verify share password", zap.String("token", item.Token), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+		return
 	}
 
-	http.ServeContent(w, r, item.Name, info.ModTime(), file)
+	http.SetCookie(w, &http.Cookie{
+		Name:     service.ShareAccessCookieName(item.Token),
+		Value:    value,
+		Path:     "/api/v1/public/share/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   isSecureRequest(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, h.buildShareURL(r, item.Token, item.Name), http.StatusSeeOther)
+}
+
+// writePasswordPrompt 浏览器请求返回密码输入页，其他客户端返回纯文本错误
+func (h *ShareHandler) writePasswordPrompt(w http.ResponseWriter, r *http.Request, code int, message string) {
+	w.Header().Set("Cache-Control", "no-store")
+	if !strings.Contains(r.Header.Get("Accept"), "text/html") {
+		if message == "" {
+			message = share.ErrSharePasswordRequired.Error()
+		}
+		http.Error(w, message, code)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := fmt.Fprintf(w, sharePasswordPage, html.EscapeString(message)); err != nil {
+		h.logger.Debug("failed to write share password page", zap.Error(err))
+	}
+}
+
+// clientIP 识别限流用的客户端地址。X-Forwarded-For 取最右侧一项，即可信代理
+// 追加的对端地址；更靠左的项由客户端自行填写，不可信
+func (h *ShareHandler) clientIP(r *http.Request) string {
+	return h.clientIPs.ClientIP(r)
+}
+
+func (h *ShareHandler) buildShareEndpointURL(r *http.Request, endpoint, token string) string {
+	return shareBaseURL(r) + endpoint + token
 }
 
 func (h *ShareHandler) buildShareURL(r *http.Request, token, fileName string) string {
+	if strings.TrimSpace(fileName) == "" {
+		return shareBaseURL(r) + "/api/v1/public/share/" + token
+	}
+	return shareBaseURL(r) + "/api/v1/public/share/" + token + "/" + url.PathEscape(fileName)
+}
+
+func shareBaseURL(r *http.Request) string {
 	scheme := "http"
 	if r.TLS != nil {
 		scheme = "https"
@@ -315,14 +826,33 @@ func (h *ShareHandler) buildShareURL(r *http.Request, token, fileName string) st
 	if forwardedHost := r.Header.Get("X-Forwarded-Host"); forwardedHost != "" {
 		host = forwardedHost
 	}
-	if strings.TrimSpace(fileName) == "" {
-		return scheme + "://" + host + "/api/v1/public/share/" + token
-	}
-	return scheme + "://" + host + "/api/v1/public/share/" + token + "/" + url.PathEscape(fileName)
+	return scheme + "://" + host
 }
 
 const timeLayout = "2006-01-02 15:04:05"
 
+const (
+	shareEntriesPath  = "/api/v1/public/share/entries/"
+	shareDownloadPath = "/api/v1/public/share/download/"
+)
+
+// sharePasswordBodyLimit 限制密码提交请求体的大小
+const sharePasswordBodyLimit = 4 << 10
+
+const sharePasswordPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1"><title>Password required</title></head>
+<body>
+<form method="post">
+<p>This share is protected by a password.</p>
+<p style="color:#c00">%s</p>
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`
+
 func shouldCountAccess(r *http.Request) bool {
 	rangeHeader := r.Header.Get("Range")
 	if rangeHeader == "" {
@@ -332,6 +862,14 @@ func shouldCountAccess(r *http.Request) bool {
 	return strings.HasPrefix(rangeHeader, "bytes=0-")
 }
 
+func parseShareTokenPath(requestPath, prefix string) string {
+	token := strings.Trim(strings.TrimPrefix(requestPath, prefix), "/")
+	if strings.Contains(token, "/") {
+		return ""
+	}
+	return token
+}
+
 func parseShareAccessPath(requestPath string) (token string, hasFilename bool) {
 	sharePath := strings.TrimPrefix(requestPath, "/api/v1/public/share/")
 	sharePath = strings.Trim(sharePath, "/")
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// shareAccessLogItem 访问日志条目
+type shareAccessLogItem struct {
+	ID        int64  `json:"id"`
+	ShareID   string `json:"shareId"`
+	Token     string `json:"token"`
+	Action    string `json:"action"`
+	Path      string `json:"path,omitempty"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"userAgent"`
+	Bytes     int64  `json:"bytes"`
+	Status    int    `json:"status"`
+	Result    string `json:"result"`
+	CreatedAt string `json:"createdAt"`
+	// CreatorUserID 仅管理员查询返回
+	CreatorUserID string `json:"creatorUserId,omitempty"`
+}
+
+// shareAccessWriter 记录公开分享响应的状态码与输出字节数，供访问日志使用；
+// action 为空的请求不记录
+type shareAccessWriter struct {
+	http.ResponseWriter
+	action string
+	status int
+	bytes  int64
+}
+
+func (w *shareAccessWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *shareAccessWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *shareAccessWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *shareAccessWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// trackShareAccess 包装 ResponseWriter，请求结束后由 recordShareAccess 写入访问日志
+func trackShareAccess(w http.ResponseWriter, action string) *shareAccessWriter {
+	return &shareAccessWriter{ResponseWriter: w, action: action}
+}
+
+// recordShareAccess 写入一次公开分享访问；HEAD 请求不记录
+func (h *ShareHandler) recordShareAccess(r *http.Request, aw *shareAccessWriter, token, relPath string) {
+	if aw.action == "" || r.Method == http.MethodHead {
+		return
+	}
+	status := aw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	h.shareService.RecordAccess(r.Context(), token, service.ShareAccessRecord{
+		Action:    aw.action,
+		Path:      normalizeRelPath(h.names, relPath),
+		IP:        h.clientIP(r),
+		UserAgent: r.UserAgent(),
+		Bytes:     aw.bytes,
+		Status:    status,
+	})
+}
+
+// fileAccessAction 返回输出分享文件时记录的操作类型
+func fileAccessAction(item *share.ShareItem) string {
+	if item.IsPreviewMode() {
+		return share.AccessView
+	}
+	return share.AccessDownload
+}
+
+// HandleAccessLog 查询当前用户创建的公开分享的访问日志：
+// GET /api/v1/public/share/access-log?token=...&limit=50&offset=0，token 省略时返回全部分享
+func (h *ShareHandler) HandleAccessLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	page, err := h.shareService.ListAccessLog(r.Context(), u, query.Get("token"), limit, offset)
+	if err != nil {
+		h.logger.Error("failed to list share access log",
+			zap.String("username", u.Username),
+			zap.Error(err))
+		http.Error(w, "Failed to list share access log", http.StatusInternalServerError)
+		return
+	}
+	h.writeAccessLogPage(w, page, false)
+}
+
+// HandleAdminAccessLog 管理员按分享、创建者、IP、操作、结果与时间范围查询所有公开分享的访问日志：
+// GET /api/v1/admin/shares/access-log?token=&owner=&ip=&action=&result=&since=&until=&limit=&offset=，
+// since / until 为 RFC 3339 时间
+func (h *ShareHandler) HandleAdminAccessLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+	filter := repository.ShareAccessLogFilter{
+		Token:         strings.TrimSpace(query.Get("token")),
+		CreatorUserID: strings.TrimSpace(query.Get("owner")),
+		IP:            strings.TrimSpace(query.Get("ip")),
+		Action:        strings.TrimSpace(query.Get("action")),
+		Result:        strings.TrimSpace(query.Get("result")),
+		Limit:         limit,
+		Offset:        offset,
+	}
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		raw := strings.TrimSpace(query.Get(bound.name))
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "invalid "+bound.name, http.StatusBadRequest)
+			return
+		}
+		*bound.target = &parsed
+	}
+	page, err := h.shareService.SearchAccessLog(r.Context(), filter)
+	if err != nil {
+		h.logger.Error("failed to search share access log", zap.Error(err))
+		http.Error(w, "Failed to search share access log", http.StatusInternalServerError)
+		return
+	}
+	h.writeAccessLogPage(w, page, true)
+}
+
+func (h *ShareHandler) writeAccessLogPage(w http.ResponseWriter, page *service.ShareAccessLogPage, admin bool) {
+	resp := struct {
+		Items      []shareAccessLogItem `json:"items"`
+		HasMore    bool                 `json:"hasMore"`
+		NextOffset int                  `json:"nextOffset,omitempty"`
+	}{
+		Items:      make([]shareAccessLogItem, 0, len(page.Items)),
+		HasMore:    page.HasMore,
+		NextOffset: page.NextOffset,
+	}
+	for _, entry := range page.Items {
+		item := shareAccessLogItem{
+			ID:        entry.ID,
+			ShareID:   entry.ShareID,
+			Token:     entry.Token,
+			Action:    entry.Action,
+			Path:      entry.Path,
+			IP:        entry.IP,
+			UserAgent: entry.UserAgent,
+			Bytes:     entry.Bytes,
+			Status:    entry.Status,
+			Result:    entry.Result,
+			CreatedAt: entry.CreatedAt.Format(timeLayout),
+		}
+		if admin {
+			item.CreatorUserID = entry.CreatorUserID
+		}
+		resp.Items = append(resp.Items, item)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
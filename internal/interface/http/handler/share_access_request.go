@@ -0,0 +1,415 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/sharegrant"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// SetAccessRequestService 启用共享资源访问/升级申请
+func (h *ShareUserHandler) SetAccessRequestService(requests *service.ShareAccessRequestService) {
+	h.accessRequests = requests
+}
+
+// shareAccessRequestResp 访问申请
+type shareAccessRequestResp struct {
+	ID                string   `json:"id"`
+	ResourceID        string   `json:"resourceId,omitempty"`
+	PublicShareID     string   `json:"publicShareId,omitempty"`
+	Name              string   `json:"name"`
+	Path              string   `json:"path"`
+	IsDir             bool     `json:"isDir"`
+	RequesterUserID   string   `json:"requesterUserId"`
+	RequesterUsername string   `json:"requesterUsername"`
+	OwnerUserID       string   `json:"ownerUserId"`
+	OwnerUsername     string   `json:"ownerUsername"`
+	Permissions       []string `json:"permissions"`
+	ExpiresAt         string   `json:"expiresAt,omitempty"`
+	Message           string   `json:"message,omitempty"`
+	Status            string   `json:"status"`
+	DecisionNote      string   `json:"decisionNote,omitempty"`
+	GrantID           string   `json:"grantId,omitempty"`
+	CreatedAt         string   `json:"createdAt"`
+	DecidedAt         string   `json:"decidedAt,omitempty"`
+}
+
+// shareAccessRequestEventResp 访问申请审计记录
+type shareAccessRequestEventResp struct {
+	Action        string   `json:"action"`
+	ActorUserID   string   `json:"actorUserId,omitempty"`
+	ActorUsername string   `json:"actorUsername,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	ExpiresAt     string   `json:"expiresAt,omitempty"`
+	Note          string   `json:"note,omitempty"`
+	CreatedAt     string   `json:"createdAt"`
+}
+
+func buildShareAccessRequestResp(req *sharegrant.AccessRequest) shareAccessRequestResp {
+	item := shareAccessRequestResp{
+		ID:                req.ID,
+		ResourceID:        req.ResourceID,
+		PublicShareID:     req.PublicShareID,
+		Name:              path.Base(req.NormalizedPath),
+		Path:              req.NormalizedPath,
+		IsDir:             req.IsDir,
+		RequesterUserID:   req.RequesterUserID,
+		RequesterUsername: req.RequesterUsername,
+		OwnerUserID:       req.OwnerUserID,
+		OwnerUsername:     req.OwnerUsername,
+		Permissions:       permissionsToStrings(user.ParsePermissions(req.Permissions)),
+		Message:           req.Message,
+		Status:            req.Status,
+		DecisionNote:      req.DecisionNote,
+		GrantID:           req.GrantID,
+		CreatedAt:         req.CreatedAt.Format(timeLayout),
+	}
+	if req.ExpiresAt != nil {
+		item.ExpiresAt = req.ExpiresAt.Format(timeLayout)
+	}
+	if req.DecidedAt != nil {
+		item.DecidedAt = req.DecidedAt.Format(timeLayout)
+	}
+	return item
+}
+
+func (h *ShareUserHandler) writeAccessRequest(w http.ResponseWriter, req *sharegrant.AccessRequest) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildShareAccessRequestResp(req)); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+func writeShareAccessRequestError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sharegrant.ErrAccessRequestNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, sharegrant.ErrAccessRequestPending):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, share.ErrShareNotFound), errors.Is(err, share.ErrInvalidShare):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, share.ErrShareExpired):
+		http.Error(w, "share expired", http.StatusGone)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// HandleCreateAccessRequest 申请共享资源的访问或权限升级：
+// POST /api/v1/public/share/access-requests/create，resourceId（收到的共享资源）与 shareToken（公开链接）二选一
+func (h *ShareUserHandler) HandleCreateAccessRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.accessRequests == nil {
+		http.Error(w, "access requests are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ResourceID   string   `json:"resourceId"`
+		ShareToken   string   `json:"shareToken"`
+		Permissions  []string `json:"permissions"`
+		ExpiresIn    int64    `json:"expiresIn"`
+		ExpiresValue int64    `json:"expiresValue"`
+		ExpiresUnit  string   `json:"expiresUnit"`
+		Message      string   `json:"message"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	resourceID := strings.TrimSpace(req.ResourceID)
+	token := strings.TrimSpace(req.ShareToken)
+	if (resourceID == "") == (token == "") {
+		http.Error(w, "exactly one of resourceId and shareToken is required", http.StatusBadRequest)
+		return
+	}
+	if countNonEmpty(req.Permissions) == 0 {
+		http.Error(w, "permissions is required", http.StatusBadRequest)
+		return
+	}
+	perms, err := parsePermissionList(req.Permissions)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	input := service.ShareAccessRequestInput{
+		Permissions: perms.String(),
+		Expiry: service.ShareExpiryInput{
+			ExpiresIn:    req.ExpiresIn,
+			ExpiresValue: req.ExpiresValue,
+			ExpiresUnit:  req.ExpiresUnit,
+		},
+		Message: req.Message,
+	}
+	var created *sharegrant.AccessRequest
+	if resourceID != "" {
+		created, err = h.accessRequests.RequestForResource(r.Context(), u, resourceID, input)
+	} else {
+		created, err = h.accessRequests.RequestForPublicShare(r.Context(), u, token, input)
+	}
+	if err != nil {
+		h.logger.Warn("failed to create share access request",
+			zap.String("requester", u.Username),
+			zap.String("resource_id", resourceID),
+			zap.Error(err))
+		writeShareAccessRequestError(w, err)
+		return
+	}
+	h.writeAccessRequest(w, created)
+}
+
+// HandleListAccessRequests 查看访问申请：
+// GET /api/v1/public/share/access-requests?direction=outgoing|incoming&status=pending|approved|denied|canceled
+func (h *ShareUserHandler) HandleListAccessRequests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.accessRequests == nil {
+		http.Error(w, "access requests are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	status := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("status")))
+	switch status {
+	case "", sharegrant.RequestStatusPending, sharegrant.RequestStatusApproved, sharegrant.RequestStatusDenied, sharegrant.RequestStatusCanceled:
+	default:
+		http.Error(w, "invalid status, supported: pending|approved|denied|canceled", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		requests []*sharegrant.AccessRequest
+		err      error
+	)
+	switch strings.TrimSpace(strings.ToLower(r.URL.Query().Get("direction"))) {
+	case "", "outgoing":
+		requests, err = h.accessRequests.ListOutgoing(r.Context(), u, status)
+	case "incoming":
+		requests, err = h.accessRequests.ListIncoming(r.Context(), u, status)
+	default:
+		http.Error(w, "invalid direction, supported: outgoing|incoming", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to list share access requests", zap.String("username", u.Username), zap.Error(err))
+		http.Error(w, "Failed to list access requests", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]shareAccessRequestResp, 0, len(requests))
+	for _, req := range requests {
+		items = append(items, buildShareAccessRequestResp(req))
+	}
+	resp := struct {
+		Items []shareAccessRequestResp `json:"items"`
+	}{
+		Items: items,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleAccessRequestHistory 查看申请及其审计记录（申请人与所有者可见）：
+// GET /api/v1/public/share/access-requests/history?id=
+func (h *ShareUserHandler) HandleAccessRequestHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.accessRequests == nil {
+		http.Error(w, "access requests are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimSpace(r.URL.Query().Get("id"))
+	if id == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+	req, events, err := h.accessRequests.History(r.Context(), u, id)
+	if err != nil {
+		if !errors.Is(err, sharegrant.ErrAccessRequestNotFound) {
+			h.logger.Error("failed to load share access request history", zap.String("request_id", id), zap.Error(err))
+		}
+		writeShareAccessRequestError(w, err)
+		return
+	}
+
+	items := make([]shareAccessRequestEventResp, 0, len(events))
+	for _, event := range events {
+		item := shareAccessRequestEventResp{
+			Action:        event.Action,
+			ActorUserID:   event.ActorUserID,
+			ActorUsername: event.ActorUsername,
+			Note:          event.Note,
+			CreatedAt:     event.CreatedAt.Format(timeLayout),
+		}
+		if event.Permissions != "" {
+			item.Permissions = permissionsToStrings(user.ParsePermissions(event.Permissions))
+		}
+		if event.ExpiresAt != nil {
+			item.ExpiresAt = event.ExpiresAt.Format(timeLayout)
+		}
+		items = append(items, item)
+	}
+	resp := struct {
+		Request shareAccessRequestResp        `json:"request"`
+		Events  []shareAccessRequestEventResp `json:"events"`
+	}{
+		Request: buildShareAccessRequestResp(req),
+		Events:  items,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleApproveAccessRequest 所有者批准申请
+func (h *ShareUserHandler) HandleApproveAccessRequest(w http.ResponseWriter, r *http.Request) {
+	h.handleAccessRequestDecision(w, r, true)
+}
+
+// HandleDenyAccessRequest 所有者拒绝申请
+func (h *ShareUserHandler) HandleDenyAccessRequest(w http.ResponseWriter, r *http.Request) {
+	h.handleAccessRequestDecision(w, r, false)
+}
+
+func (h *ShareUserHandler) handleAccessRequestDecision(w http.ResponseWriter, r *http.Request, approve bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.accessRequests == nil {
+		http.Error(w, "access requests are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ID   string `json:"id"`
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.ID) == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	var (
+		decided *sharegrant.AccessRequest
+		err     error
+	)
+	if approve {
+		decided, err = h.accessRequests.Approve(r.Context(), u, req.ID, req.Note)
+	} else {
+		decided, err = h.accessRequests.Deny(r.Context(), u, req.ID, req.Note)
+	}
+	if err != nil {
+		if !errors.Is(err, sharegrant.ErrAccessRequestNotFound) {
+			h.logger.Error("failed to decide share access request",
+				zap.String("owner", u.Username),
+				zap.String("request_id", req.ID),
+				zap.Bool("approve", approve),
+				zap.Error(err))
+		}
+		writeShareAccessRequestError(w, err)
+		return
+	}
+	h.writeAccessRequest(w, decided)
+}
+
+// HandleCancelAccessRequest 申请人撤回待处理的申请
+func (h *ShareUserHandler) HandleCancelAccessRequest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.accessRequests == nil {
+		http.Error(w, "access requests are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.ID) == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.accessRequests.Cancel(r.Context(), u, req.ID); err != nil {
+		if !errors.Is(err, sharegrant.ErrAccessRequestNotFound) {
+			h.logger.Error("failed to cancel share access request",
+				zap.String("requester", u.Username),
+				zap.String("request_id", req.ID),
+				zap.Error(err))
+		}
+		writeShareAccessRequestError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(`{"message":"canceled successfully"}`)); err != nil {
+		h.logger.Error("failed to write response", zap.Error(err))
+	}
+}
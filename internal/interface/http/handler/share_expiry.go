@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/shareuser"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// shareExtendRequest 续期请求；未指定时长时按 share.extend_by 延长
+type shareExtendRequest struct {
+	Token        string `json:"token"`
+	ID           string `json:"id"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	ExpiresValue int64  `json:"expiresValue"`
+	ExpiresUnit  string `json:"expiresUnit"`
+}
+
+func (req shareExtendRequest) expiry() service.ShareExpiryInput {
+	return service.ShareExpiryInput{
+		ExpiresIn:    req.ExpiresIn,
+		ExpiresValue: req.ExpiresValue,
+		ExpiresUnit:  req.ExpiresUnit,
+	}
+}
+
+// HandleExtend 一键续期公开分享链接（仅创建者）
+func (h *ShareHandler) HandleExtend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req shareExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Token) == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.shareService.Extend(r.Context(), u, req.Token, req.expiry())
+	if err != nil {
+		if errors.Is(err, auth.ErrAppScopeDenied) || errors.Is(err, auth.ErrAppScopeRequired) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, share.ErrShareNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.logger.Warn("failed to extend share",
+			zap.String("username", u.Username),
+			zap.String("token", req.Token),
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.writeShareCreateResponse(w, r, item)
+}
+
+// HandleExtend 一键续期定向分享（仅所有者），同步延长接收方的访问授权
+func (h *ShareUserHandler) HandleExtend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req shareExtendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.ID) == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	item, err := h.shareUserService.Extend(r.Context(), u, req.ID, req.expiry())
+	if err != nil {
+		if errors.Is(err, auth.ErrAppScopeDenied) || errors.Is(err, auth.ErrAppScopeRequired) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, shareuser.ErrShareNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		h.logger.Warn("failed to extend share user",
+			zap.String("owner", u.Username),
+			zap.String("share_id", req.ID),
+			zap.Error(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resp := map[string]any{
+		"id":        item.ID,
+		"name":      item.Name,
+		"path":      item.Path,
+		"isDir":     item.IsDir,
+		"expiresAt": item.ExpiresAt.Format(timeLayout),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
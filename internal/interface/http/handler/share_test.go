@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/infrastructure/config"
+	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+func TestShareClientIPIgnoresForwardedHeadersFromUntrustedPeers(t *testing.T) {
+	t.Parallel()
+
+	h := &ShareHandler{clientIPs: middleware.NewClientIPResolver(true, []string{"10.0.0.0/8"})}
+	r := httptest.NewRequest("POST", "/api/v1/public/share/abc/unlock", nil)
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.7")
+
+	r.RemoteAddr = "10.0.0.2:1234"
+	if got := h.clientIP(r); got != "203.0.113.7" {
+		t.Fatalf("clientIP behind a trusted proxy = %q, want the proxy-appended address", got)
+	}
+	// A client rotating the header cannot dodge the per-client limit.
+	r.RemoteAddr = "192.0.2.1:1234"
+	if got := h.clientIP(r); got != "192.0.2.1" {
+		t.Fatalf("clientIP from an untrusted peer = %q, want the peer address", got)
+	}
+}
+
+func TestShareArchiveRefusedOnceDownloadLimitIsReached(t *testing.T) {
+	t.Parallel()
+
+	h, repo := newShareLimitTestHandler(t)
+	download := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.HandleDownload(rec, httptest.NewRequest(http.MethodGet, shareDownloadPath+repo.item.Token, nil))
+		return rec
+	}
+
+	if rec := download(); rec.Code != http.StatusOK || rec.Body.Len() == 0 {
+		t.Fatalf("first archive = %d (%d bytes)", rec.Code, rec.Body.Len())
+	}
+	if repo.downloads != 1 || repo.views != 1 {
+		t.Fatalf("counts = %d downloads / %d views", repo.downloads, repo.views)
+	}
+
+	// Another client used up the last download between resolving and counting.
+	repo.downloadsExhausted = true
+	rec := download()
+	if rec.Code != http.StatusGone {
+		t.Fatalf("archive at the limit = %d, want %d", rec.Code, http.StatusGone)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct == "application/zip" {
+		t.Fatal("archive must not be streamed once the limit is reached")
+	}
+}
+
+func TestShareArchiveAtViewLimitKeepsDownloadCount(t *testing.T) {
+	t.Parallel()
+
+	h, repo := newShareLimitTestHandler(t)
+	repo.item.MaxViews = 3
+	// Concurrent visitors used up the views after this request resolved the share.
+	repo.views = repo.item.MaxViews
+	rec := httptest.NewRecorder()
+	h.HandleDownload(rec, httptest.NewRequest(http.MethodGet, shareDownloadPath+repo.item.Token, nil))
+	if rec.Code != http.StatusGone {
+		t.Fatalf("archive at the view limit = %d, want %d", rec.Code, http.StatusGone)
+	}
+	if repo.downloads != 0 {
+		t.Fatalf("refused archive consumed %d downloads", repo.downloads)
+	}
+}
+
+func TestShareListingRefusedOnceViewLimitIsReached(t *testing.T) {
+	t.Parallel()
+
+	h, repo := newShareLimitTestHandler(t)
+	repo.viewsExhausted = true
+	rec := httptest.NewRecorder()
+	h.HandleEntries(rec, httptest.NewRequest(http.MethodGet, shareEntriesPath+repo.item.Token, nil))
+	if rec.Code != http.StatusGone {
+		t.Fatalf("listing at the limit = %d, want %d", rec.Code, http.StatusGone)
+	}
+}
+
+func newShareLimitTestHandler(t *testing.T) (*ShareHandler, *shareLimitTestRepo) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.WebDAV.Directory = t.TempDir()
+	docs := filepath.Join(cfg.WebDAV.Directory, "alice", "docs")
+	if err := os.MkdirAll(docs, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(docs, "a.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	owner := &user.User{ID: "u1", Username: "alice", Directory: "alice"}
+	item := share.NewShareItem(owner.ID, owner.Username, "/docs", "docs", share.ModeDownload, nil)
+	item.MaxDownloads = 10
+	repo := &shareLimitTestRepo{item: item}
+	svc := service.NewShareService(repo, shareLimitTestUsers{owner: owner}, cfg, zap.NewNop())
+	h := NewShareHandler(svc, zap.NewNop())
+	h.SetArchiveService(service.NewArchiveService(cfg, zap.NewNop()))
+	return h, repo
+}
+
+// shareLimitTestRepo serves one share; the exhausted flags make the counters
+// report the limit as a concurrent request would.
+type shareLimitTestRepo struct {
+	repository.ShareRepository
+	item               *share.ShareItem
+	views, downloads   int64
+	viewsExhausted     bool
+	downloadsExhausted bool
+}
+
+func (r *shareLimitTestRepo) GetByToken(_ context.Context, token string) (*share.ShareItem, error) {
+	if token != r.item.Token {
+		return nil, share.ErrShareNotFound
+	}
+	clone := *r.item
+	return &clone, nil
+}
+
+func (r *shareLimitTestRepo) IncrementView(context.Context, string) error {
+	if r.viewsExhausted || (r.item.MaxViews > 0 && r.views >= r.item.MaxViews) {
+		return share.ErrShareExpired
+	}
+	r.views++
+	return nil
+}
+
+func (r *shareLimitTestRepo) IncrementDownload(context.Context, string) error {
+	if r.downloadsExhausted {
+		return share.ErrShareExpired
+	}
+	r.downloads++
+	return nil
+}
+
+type shareLimitTestUsers struct {
+	user.Repository
+	owner *user.User
+}
+
+func (u shareLimitTestUsers) FindByID(_ context.Context, id string) (*user.User, error) {
+	if id != u.owner.ID {
+		return nil, user.ErrUserNotFound
+	}
+	return u.owner, nil
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/share"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+const shareUploadPath = "/api/v1/public/share/upload/"
+
+// shareUploadResponse 上传模式分享的限制与已收到的用量，0 表示不限制
+type shareUploadResponse struct {
+	MaxFileSize       int64    `json:"maxFileSize"`
+	MaxTotalBytes     int64    `json:"maxTotalBytes"`
+	MaxFiles          int64    `json:"maxFiles"`
+	AllowedExtensions []string `json:"allowedExtensions"`
+	UploadedBytes     int64    `json:"uploadedBytes"`
+	UploadedFiles     int64    `json:"uploadedFiles"`
+}
+
+// SetUploadSessionService 启用上传模式分享的匿名上传
+func (h *ShareHandler) SetUploadSessionService(uploads *service.UploadSessionService) {
+	h.uploads = uploads
+}
+
+// HandleUpload 上传模式分享的匿名上传（公开），访客不能列出或读取已有内容：
+//
+//	GET    /api/v1/public/share/upload/{token}                          分享名称、限制与已收到的用量
+//	PUT    /api/v1/public/share/upload/{token}/{fileName}               直接上传单个文件
+//	POST   /api/v1/public/share/upload/{token}/sessions                 创建分片上传会话
+//	GET    /api/v1/public/share/upload/{token}/sessions/{id}            查询会话
+//	PUT    /api/v1/public/share/upload/{token}/sessions/{id}/parts/{n}  上传分片
+//	POST   /api/v1/public/share/upload/{token}/sessions/{id}/complete   完成上传
+//	DELETE /api/v1/public/share/upload/{token}/sessions/{id}            取消上传
+//
+// 文件写入分享目录根部，同名时自动重命名为 "name (n).ext"，占用分享所有者的配额
+func (h *ShareHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, shareUploadPath), "/"), "/")
+	token := parts[0]
+	if token == "" || h.uploads == nil {
+		http.NotFound(w, r)
+		return
+	}
+	item, err := h.shareService.ResolveUpload(r.Context(), token)
+	if err != nil {
+		h.writeResolveError(w, r, err)
+		return
+	}
+	if !h.authorizeShareAccess(w, r, item, false) {
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		h.writeUploadShareInfo(w, r, item)
+	case len(parts) == 2 && r.Method == http.MethodPut:
+		h.handleShareUploadFile(w, r, item, parts[1])
+	case len(parts) == 2 && parts[1] == "sessions" && r.Method == http.MethodPost:
+		h.handleShareUploadCreate(w, r, item)
+	case len(parts) == 3 && parts[1] == "sessions" && r.Method == http.MethodGet:
+		session, err := h.uploads.Get(r.Context(), service.PublicShareUploader(item.Token), parts[2])
+		if err != nil {
+			h.writeShareUploadError(w, r, err)
+			return
+		}
+		h.writeShareUploadJSON(w, http.StatusOK, buildUploadSessionResponse(session))
+	case len(parts) == 3 && parts[1] == "sessions" && r.Method == http.MethodDelete:
+		if err := h.uploads.Abort(r.Context(), service.PublicShareUploader(item.Token), parts[2]); err != nil {
+			h.writeShareUploadError(w, r, err)
+			return
+		}
+		h.writeShareUploadJSON(w, http.StatusOK, map[string]bool{"aborted": true})
+	case len(parts) == 4 && parts[1] == "sessions" && parts[3] == "complete" && r.Method == http.MethodPost:
+		session, err := h.uploads.Complete(r.Context(), service.PublicShareUploader(item.Token), parts[2])
+		if err != nil {
+			h.writeShareUploadError(w, r, err)
+			return
+		}
+		h.writeShareUploadJSON(w, http.StatusOK, buildUploadSessionResponse(session))
+	case len(parts) == 5 && parts[1] == "sessions" && parts[3] == "parts" && r.Method == http.MethodPut:
+		partNumber, err := strconv.Atoi(parts[4])
+		if err != nil || partNumber < 1 {
+			http.Error(w, "invalid part number", http.StatusBadRequest)
+			return
+		}
+		h.handleShareUploadPart(w, r, item, parts[2], partNumber)
+	case len(parts) <= 5:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// writeUploadShareInfo 返回上传页所需的分享信息，不包含目录内容
+func (h *ShareHandler) writeUploadShareInfo(w http.ResponseWriter, r *http.Request, item *share.ShareItem) {
+	resp := map[string]any{
+		"token":       item.Token,
+		"name":        item.Name,
+		"mode":        item.Mode,
+		"upload":      buildShareUploadResponse(item),
+		"uploadUrl":   h.buildShareEndpointURL(r, shareUploadPath, item.Token),
+		"hasPassword": item.HasPassword(),
+	}
+	if item.ExpiresAt != nil {
+		resp["expiresAt"] = item.ExpiresAt.Format(timeLayout)
+	}
+	if r.Method == http.MethodHead {
+		w.Header().Set("Content-Type", "application/json")
+		return
+	}
+	h.writeShareUploadJSON(w, http.StatusOK, resp)
+}
+
+// handleShareUploadFile 以一次请求上传单个文件：内部创建单分片会话并立即完成，
+// 超过单分片上限的大文件需使用分片上传会话
+func (h *ShareHandler) handleShareUploadFile(w http.ResponseWriter, r *http.Request, item *share.ShareItem, fileName string) {
+	service.ClearUploadDeadlines(w, h.logger)
+	uploader := service.PublicShareUploader(item.Token)
+	if limit := item.Upload.MaxFileSize; limit > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+	}
+	size := r.ContentLength
+	if size < 0 {
+		size = 0
+	}
+	session, err := h.uploads.Create(r.Context(), uploader, service.UploadSessionCreateInput{
+		ShareToken:    item.Token,
+		FileName:      fileName,
+		Size:          size,
+		ContentType:   r.Header.Get("Content-Type"),
+		VariableParts: true,
+	})
+	if err != nil {
+		h.writeShareUploadError(w, r, err)
+		return
+	}
+	if _, _, err := h.uploads.UploadPart(r.Context(), uploader, session.ID, 1, uploadSessionPartChecksum(r), r.Body); err != nil {
+		_ = h.uploads.Abort(r.Context(), uploader, session.ID)
+		h.writeShareUploadError(w, r, err)
+		return
+	}
+	session, err = h.uploads.Complete(r.Context(), uploader, session.ID)
+	if err != nil {
+		_ = h.uploads.Abort(r.Context(), uploader, session.ID)
+		h.writeShareUploadError(w, r, err)
+		return
+	}
+	h.writeShareUploadJSON(w, http.StatusCreated, buildUploadSessionResponse(session))
+}
+
+func (h *ShareHandler) handleShareUploadCreate(w http.ResponseWriter, r *http.Request, item *share.ShareItem) {
+	var req struct {
+		Size         int64  `json:"size"`
+		ChunkSize    int64  `json:"chunkSize"`
+		FileName     string `json:"fileName"`
+		ContentType  string `json:"contentType"`
+		LastModified int64  `json:"lastModified"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.FileName) == "" {
+		http.Error(w, "fileName is required", http.StatusBadRequest)
+		return
+	}
+	session, err := h.uploads.Create(r.Context(), service.PublicShareUploader(item.Token), service.UploadSessionCreateInput{
+		ShareToken:   item.Token,
+		Size:         req.Size,
+		ChunkSize:    req.ChunkSize,
+		FileName:     req.FileName,
+		ContentType:  req.ContentType,
+		LastModified: req.LastModified,
+	})
+	if err != nil {
+		h.writeShareUploadError(w, r, err)
+		return
+	}
+	h.writeShareUploadJSON(w, http.StatusCreated, buildUploadSessionResponse(session))
+}
+
+func (h *ShareHandler) handleShareUploadPart(w http.ResponseWriter, r *http.Request, item *share.ShareItem, id string, partNumber int) {
+	service.ClearUploadDeadlines(w, h.logger)
+	checksum := uploadSessionPartChecksum(r)
+	if checksum == "" {
+		http.Error(w, "checksum is required", http.StatusBadRequest)
+		return
+	}
+	session, part, err := h.uploads.UploadPart(r.Context(), service.PublicShareUploader(item.Token), id, partNumber, checksum, r.Body)
+	if err != nil {
+		h.writeShareUploadError(w, r, err)
+		return
+	}
+	h.writeShareUploadJSON(w, http.StatusOK, map[string]any{
+		"session": buildUploadSessionResponse(session),
+		"part":    part,
+	})
+}
+
+func (h *ShareHandler) writeShareUploadError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		http.Error(w, service.ErrUploadSessionTooLarge.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, share.ErrShareUploadLimit):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, user.ErrQuotaExceeded):
+		http.Error(w, "Insufficient Storage", http.StatusInsufficientStorage)
+	case errors.Is(err, share.ErrShareNotFound), errors.Is(err, share.ErrInvalidShare), errors.Is(err, share.ErrShareExpired):
+		h.writeResolveError(w, r, err)
+	default:
+		writeUploadSessionError(w, h.logger, err)
+	}
+}
+
+func (h *ShareHandler) writeShareUploadJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		h.logger.Error("failed to write share upload response", zap.Error(err))
+	}
+}
+
+func buildShareUploadResponse(item *share.ShareItem) *shareUploadResponse {
+	if !item.IsUploadMode() {
+		return nil
+	}
+	extensions := item.Upload.AllowedExtensions
+	if extensions == nil {
+		extensions = []string{}
+	}
+	return &shareUploadResponse{
+		MaxFileSize:       item.Upload.MaxFileSize,
+		MaxTotalBytes:     item.Upload.MaxTotalBytes,
+		MaxFiles:          item.Upload.MaxFiles,
+		AllowedExtensions: extensions,
+		UploadedBytes:     item.UploadedBytes,
+		UploadedFiles:     item.UploadedFiles,
+	}
+}
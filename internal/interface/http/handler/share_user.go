@@ -16,10 +16,11 @@ import (
 
 	"github.com/yeying-community/warehouse/internal/application/service"
 	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 	"github.com/yeying-community/warehouse/internal/domain/shareuser"
 	"github.com/yeying-community/warehouse/internal/domain/user"
-	"github.com/yeying-community/warehouse/internal/infrastructure/atomicfile"
 	"github.com/yeying-community/warehouse/internal/infrastructure/repository"
+	"github.com/yeying-community/warehouse/internal/infrastructure/storage"
 	webdavfs "github.com/yeying-community/warehouse/internal/infrastructure/webdav"
 	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
 	"go.uber.org/zap"
@@ -33,6 +34,13 @@ type ShareUserHandler struct {
 	userRepo             user.Repository
 	mutationRecorder     service.MutationRecorder
 	publicShareRepo      repository.ShareRepository
+	archives             *service.ArchiveService
+	thumbnails           *service.ThumbnailService
+	uploadPolicy         *service.UploadPolicyEnforcer
+	versions             *service.VersionService
+	accessRequests       *service.ShareAccessRequestService
+	names                pathname.Policy
+	storage              storage.Backend
 	logger               *zap.Logger
 }
 
@@ -44,6 +52,56 @@ func (h *ShareUserHandler) SetPublicShareRepository(repo repository.ShareReposit
 	h.publicShareRepo = repo
 }
 
+// SetVersionService 设置历史版本服务，分享内的移动 / 删除同步所有者的历史版本
+func (h *ShareUserHandler) SetVersionService(versions *service.VersionService) {
+	h.versions = versions
+}
+
+// SetUploadPolicyEnforcer 设置上传策略，分享上传按资源所有者的策略校验
+func (h *ShareUserHandler) SetUploadPolicyEnforcer(enforcer *service.UploadPolicyEnforcer) {
+	h.uploadPolicy = enforcer
+}
+
+// SetArchiveService 启用分享目录打包下载
+func (h *ShareUserHandler) SetArchiveService(archives *service.ArchiveService) {
+	h.archives = archives
+}
+
+// SetNamePolicy 设置分享内路径的文件名规范化策略（NFC / 大小写冲突保护）
+func (h *ShareUserHandler) SetNamePolicy(policy pathname.Policy) {
+	h.names = policy
+}
+
+// SetThumbnailService 启用分享内图片的缩略图
+func (h *ShareUserHandler) SetThumbnailService(thumbnails *service.ThumbnailService) {
+	h.thumbnails = thumbnails
+}
+
+// serveShareArchive 将分享内的目录打包为 zip/tar.gz 流式下载
+func (h *ShareUserHandler) serveShareArchive(w http.ResponseWriter, r *http.Request, fullPath string) {
+	if h.archives == nil {
+		http.Error(w, "Path is a directory", http.StatusBadRequest)
+		return
+	}
+	name := filepath.Base(fullPath)
+	err := h.archives.Serve(w, r, service.ArchiveRequest{
+		Format:  r.URL.Query().Get("format"),
+		Sources: []service.ArchiveSource{{FullPath: fullPath, Name: name}},
+	}, name)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrArchiveTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, service.ErrArchiveInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case os.IsNotExist(err):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	default:
+		h.logger.Error("failed to build share archive", zap.String("path", fullPath), zap.Error(err))
+		http.Error(w, "Failed to build archive", http.StatusInternalServerError)
+	}
+}
+
 type bufferedResponse struct {
 	header http.Header
 	body   bytes.Buffer
@@ -125,10 +183,18 @@ func NewShareUserHandler(
 		shareUserService: shareUserService,
 		userRepo:         userRepo,
 		mutationRecorder: mutationRecorder,
+		storage:          storage.NewLocal(),
 		logger:           logger,
 	}
 }
 
+// SetStorage 设置被分享文件所在的存储后端，默认为本地磁盘
+func (h *ShareUserHandler) SetStorage(backend storage.Backend) {
+	if backend != nil {
+		h.storage = backend
+	}
+}
+
 // HandleDAV exposes shared content as a WebDAV virtual root:
 // /dav/share/{shareId}/...
 func (h *ShareUserHandler) HandleDAV(w http.ResponseWriter, r *http.Request) {
@@ -145,6 +211,7 @@ func (h *ShareUserHandler) HandleDAV(w http.ResponseWriter, r *http.Request) {
 	}
 
 	h.clearShareDAVDeadlines(w)
+	service.NormalizeRequestPathNames(h.names, r)
 
 	shareID, relPath, davPrefix, err := h.parseDAVSharePath(r.URL.Path)
 	if err != nil {
@@ -173,10 +240,16 @@ func (h *ShareUserHandler) HandleDAV(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
+	if r.Method == http.MethodPut {
+		if err := h.uploadPolicy.CheckOwnerRequest(w, r, owner, targetFull); err != nil {
+			service.WriteUploadPolicyError(w, err)
+			return
+		}
+	}
 
 	if isMutatingShareDAVMethod(r.Method) {
 		targetWasDir := false
-		if info, err := os.Stat(targetFull); err == nil {
+		if info, err := h.storage.Stat(targetFull); err == nil {
 			targetWasDir = info.IsDir()
 		}
 		h.serveMutatingShareDAV(w, r, shareDAVContext{
@@ -247,7 +320,7 @@ func (h *ShareUserHandler) parseDAVSharePath(rawPath string) (shareID, relPath,
 		return "", "", "", fmt.Errorf("shareId is required")
 	}
 	if len(parts) > 1 {
-		relPath = normalizeRelPath(parts[1])
+		relPath = normalizeRelPath(h.names, parts[1])
 	}
 	davPrefix = strings.TrimSuffix(sharePrefix+shareID, "/")
 	return shareID, relPath, davPrefix, nil
@@ -284,7 +357,7 @@ func (h *ShareUserHandler) checkDAVSharePermission(r *http.Request, perms *user.
 			return fmt.Errorf("permission denied")
 		}
 	case http.MethodPut:
-		if _, err := os.Stat(targetFull); err == nil {
+		if _, err := h.storage.Stat(targetFull); err == nil {
 			if !perms.Has("update") {
 				return fmt.Errorf("permission denied")
 			}
@@ -352,9 +425,12 @@ func isMutatingShareDAVMethod(method string) bool {
 }
 
 func (h *ShareUserHandler) serveShareDAV(w http.ResponseWriter, r *http.Request, davPrefix, baseFull string) {
+	fsys := webdavfs.NewUnicodeFileSystem(baseFull)
+	fsys.SetBackend(h.storage)
+	fsys.SetNamePolicy(h.names)
 	handler := &webdav.Handler{
 		Prefix:     davPrefix,
-		FileSystem: webdavfs.NewUnicodeFileSystem(baseFull),
+		FileSystem: fsys,
 		LockSystem: webdav.NewMemLS(),
 		Logger:     h.createShareDAVLogger(),
 	}
@@ -389,13 +465,16 @@ func (h *ShareUserHandler) recordShareDAVMutation(r *http.Request, ctx shareDAVC
 		if err := service.RemoveAllShareReferencesForOwnerPath(r.Context(), h.shareUserService.Repository(), h.publicShareRepo, h.shareUserService.Config(), ctx.owner, ctx.targetFull); err != nil {
 			return err
 		}
+		if err := h.versions.RemovePath(r.Context(), ctx.owner, ctx.targetFull, ctx.targetWasDir); err != nil {
+			return err
+		}
 		return h.mutationRecorder.RemovePath(r.Context(), ctx.targetFull, ctx.targetWasDir)
 	case "MOVE":
 		toFull, err := h.resolveDAVShareDestinationFullPath(r, ctx)
 		if err != nil {
 			return err
 		}
-		info, err := os.Stat(toFull)
+		info, err := h.storage.Stat(toFull)
 		isDir := false
 		if err == nil {
 			isDir = info.IsDir()
@@ -403,6 +482,9 @@ func (h *ShareUserHandler) recordShareDAVMutation(r *http.Request, ctx shareDAVC
 		if err := service.SyncAllSharePathsForOwnerMove(r.Context(), h.shareUserService.Repository(), h.publicShareRepo, h.shareUserService.Config(), ctx.owner, ctx.targetFull, toFull); err != nil {
 			return err
 		}
+		if err := h.versions.MovePath(r.Context(), ctx.owner, ctx.targetFull, toFull, isDir); err != nil {
+			return err
+		}
 		if err := h.mutationRecorder.EnsureDir(r.Context(), filepath.Dir(toFull)); err != nil {
 			return err
 		}
@@ -412,7 +494,7 @@ func (h *ShareUserHandler) recordShareDAVMutation(r *http.Request, ctx shareDAVC
 		if err != nil {
 			return err
 		}
-		info, err := os.Stat(toFull)
+		info, err := h.storage.Stat(toFull)
 		isDir := false
 		if err == nil {
 			isDir = info.IsDir()
@@ -479,6 +561,7 @@ func (h *ShareUserHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		Path            string   `json:"path"`
 		TargetAddresses []string `json:"targetAddresses"`
+		TargetEmails    []string `json:"targetEmails"`
 		TargetMode      string   `json:"targetMode"`
 		GroupIDs        []string `json:"groupIds"`
 		Permissions     []string `json:"permissions"`
@@ -515,6 +598,7 @@ func (h *ShareUserHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 	}
 
 	var item *shareuser.ShareUserItem
+	var invites []*shareuser.EmailInvite
 	switch mode {
 	case "all_users":
 		item, err = h.shareUserService.CreateForAllUsers(r.Context(), u, req.Path, perms.String(), expiry)
@@ -530,8 +614,14 @@ func (h *ShareUserHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 			return
 		}
 		item, err = h.shareUserService.CreateByWallets(r.Context(), u, req.TargetAddresses, req.Path, perms.String(), expiry)
+	case "emails":
+		if countNonEmpty(req.TargetEmails) == 0 {
+			http.Error(w, "targetEmails is required", http.StatusBadRequest)
+			return
+		}
+		item, invites, err = h.shareUserService.CreateByEmails(r.Context(), u, req.TargetEmails, req.Path, perms.String(), expiry, shareBaseURL(r)+"/")
 	default:
-		http.Error(w, "invalid targetMode, supported: addresses|groups|all_users", http.StatusBadRequest)
+		http.Error(w, "invalid targetMode, supported: addresses|groups|emails|all_users", http.StatusBadRequest)
 		return
 	}
 	if err != nil {
@@ -539,6 +629,10 @@ func (h *ShareUserHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
+		if errors.Is(err, service.ErrShareInvitesDisabled) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
 		h.logger.Error("failed to create share user",
 			zap.String("owner", u.Username),
 			zap.String("path", req.Path),
@@ -566,6 +660,9 @@ func (h *ShareUserHandler) HandleCreate(w http.ResponseWriter, r *http.Request)
 	if item.AudienceType == "groups" {
 		resp["targetGroups"] = h.targetGroupsForShare(r.Context(), item.ID)
 	}
+	if mode == "emails" {
+		resp["invites"] = buildShareInviteResps(invites)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(resp); err != nil {
@@ -818,7 +915,7 @@ func (h *ShareUserHandler) HandleEntries(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	info, err := os.Stat(fullPath)
+	info, err := h.storage.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
@@ -843,13 +940,13 @@ func (h *ShareUserHandler) HandleEntries(w http.ResponseWriter, r *http.Request)
 	}
 
 	if info.IsDir() {
-		entries, err := os.ReadDir(fullPath)
+		entries, err := h.storage.ReadDir(fullPath)
 		if err != nil {
 			http.Error(w, "Failed to read directory", http.StatusInternalServerError)
 			return
 		}
 
-		prefix := normalizeRelPath(relPath)
+		prefix := normalizeRelPath(h.names, relPath)
 		for _, entry := range entries {
 			if isIgnoredShareName(entry.Name()) {
 				continue
@@ -923,14 +1020,14 @@ func (h *ShareUserHandler) HandleResourceEntries(w http.ResponseWriter, r *http.
 		http.Error(w, "Server misconfigured", http.StatusInternalServerError)
 		return
 	}
-	root := filepath.Clean(filepath.Join(cfg.WebDAV.Directory, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
-	rel := normalizeRelPath(r.URL.Query().Get("path"))
+	root := filepath.Clean(filepath.Join(service.ResolveUserRoot(cfg, owner), filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
+	rel := normalizeRelPath(h.names, r.URL.Query().Get("path"))
 	fullPath := filepath.Clean(filepath.Join(root, filepath.FromSlash(rel)))
 	if fullPath != root && !strings.HasPrefix(fullPath, root+string(os.PathSeparator)) {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
-	info, err := os.Stat(fullPath)
+	info, err := h.storage.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
@@ -954,7 +1051,7 @@ func (h *ShareUserHandler) HandleResourceEntries(w http.ResponseWriter, r *http.
 		json.NewEncoder(w).Encode(resp)
 		return
 	}
-	entries, err := os.ReadDir(fullPath)
+	entries, err := h.storage.ReadDir(fullPath)
 	if err != nil {
 		http.Error(w, "Failed to read directory", http.StatusInternalServerError)
 		return
@@ -999,21 +1096,79 @@ func (h *ShareUserHandler) HandleResourceDownload(w http.ResponseWriter, r *http
 		return
 	}
 	cfg := h.shareUserService.Config()
-	root := filepath.Clean(filepath.Join(cfg.WebDAV.Directory, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
-	fullPath := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(r.URL.Query().Get("path")))))
+	root := filepath.Clean(filepath.Join(service.ResolveUserRoot(cfg, owner), filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
+	fullPath := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(h.names, r.URL.Query().Get("path")))))
 	if fullPath != root && !strings.HasPrefix(fullPath, root+string(os.PathSeparator)) {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
-	info, err := os.Stat(fullPath)
-	if err != nil || info.IsDir() {
+	info, err := h.storage.Stat(fullPath)
+	if err != nil {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+	if info.IsDir() {
+		if h.archives == nil {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		h.serveShareArchive(w, r, fullPath)
+		return
+	}
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", info.Name()))
 	http.ServeFile(w, r, fullPath)
 }
 
+// HandleResourceThumbnail 共享资源内图片的缩略图（需读权限）
+func (h *ShareUserHandler) HandleResourceThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	resourceID := strings.TrimSpace(r.URL.Query().Get("resourceId"))
+	if resourceID == "" || h.sharedResourceAccess == nil {
+		http.Error(w, "resourceId is required", http.StatusBadRequest)
+		return
+	}
+	size, ok := parseThumbnailSize(w, r)
+	if !ok {
+		return
+	}
+	resource, err := h.sharedResourceAccess.Authorize(r.Context(), resourceID, u.ID, "read", time.Now())
+	if err != nil {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	owner, err := h.userRepo.FindByID(r.Context(), resource.OwnerUserID)
+	if err != nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	cfg := h.shareUserService.Config()
+	root := filepath.Clean(filepath.Join(service.ResolveUserRoot(cfg, owner), filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
+	fullPath := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(h.names, r.URL.Query().Get("path")))))
+	if fullPath != root && !strings.HasPrefix(fullPath, root+string(os.PathSeparator)) {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if isIgnoredSharePath(fullPath) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	f, meta, err := h.thumbnails.OpenFile(r.Context(), fullPath, size)
+	if err != nil {
+		writeThumbnailError(w, h.logger, err)
+		return
+	}
+	defer f.Close()
+	serveThumbnail(w, r, f, meta)
+}
+
 func (h *ShareUserHandler) HandleResourceCreateFolder(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1043,8 +1198,11 @@ func (h *ShareUserHandler) HandleResourceCreateFolder(w http.ResponseWriter, r *
 		return
 	}
 	cfg := h.shareUserService.Config()
-	root := filepath.Clean(filepath.Join(cfg.WebDAV.Directory, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
-	rel := normalizeRelPath(input.Path)
+	if service.WriteVolumeError(w, service.CheckVolumeWritable(cfg, owner)) {
+		return
+	}
+	root := filepath.Clean(filepath.Join(service.ResolveUserRoot(cfg, owner), filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
+	rel := normalizeRelPath(h.names, input.Path)
 	if rel == "" {
 		http.Error(w, "path is required", http.StatusBadRequest)
 		return
@@ -1054,12 +1212,16 @@ func (h *ShareUserHandler) HandleResourceCreateFolder(w http.ResponseWriter, r *
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
-	if err := os.Mkdir(target, 0755); err != nil {
-		if os.IsExist(err) {
-			http.Error(w, "Already exists", http.StatusConflict)
-		} else {
-			http.Error(w, "Failed to create directory", http.StatusInternalServerError)
-		}
+	if _, err := h.storage.Lstat(target); err == nil {
+		http.Error(w, "Already exists", http.StatusConflict)
+		return
+	}
+	if parent, err := h.storage.Stat(filepath.Dir(target)); err != nil || !parent.IsDir() {
+		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
+		return
+	}
+	if err := h.storage.MkdirAll(target, 0755); err != nil {
+		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
 		return
 	}
 	if err := h.mutationRecorder.EnsureDir(r.Context(), target); err != nil {
@@ -1100,18 +1262,21 @@ func (h *ShareUserHandler) HandleResourceRename(w http.ResponseWriter, r *http.R
 		return
 	}
 	cfg := h.shareUserService.Config()
-	root := filepath.Clean(filepath.Join(cfg.WebDAV.Directory, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
-	from := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(input.FromPath))))
-	to := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(input.ToPath))))
+	if service.WriteVolumeError(w, service.CheckVolumeWritable(cfg, owner)) {
+		return
+	}
+	root := filepath.Clean(filepath.Join(service.ResolveUserRoot(cfg, owner), filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
+	from := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(h.names, input.FromPath))))
+	to := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(h.names, input.ToPath))))
 	if from == root || to == root || !strings.HasPrefix(from, root+string(os.PathSeparator)) || !strings.HasPrefix(to, root+string(os.PathSeparator)) {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
-	if _, err := os.Stat(to); err == nil {
+	if _, err := h.storage.Stat(to); err == nil {
 		http.Error(w, "Already exists", http.StatusConflict)
 		return
 	}
-	info, err := os.Stat(from)
+	info, err := h.storage.Stat(from)
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
@@ -1120,7 +1285,7 @@ func (h *ShareUserHandler) HandleResourceRename(w http.ResponseWriter, r *http.R
 		}
 		return
 	}
-	if err := os.Rename(from, to); err != nil {
+	if err := h.storage.Rename(from, to); err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
 		} else {
@@ -1133,7 +1298,12 @@ func (h *ShareUserHandler) HandleResourceRename(w http.ResponseWriter, r *http.R
 		http.Error(w, "Failed to update share references", http.StatusInternalServerError)
 		return
 	}
-	if err := h.sharedResourceAccess.MoveOwnerPaths(r.Context(), owner.ID, resourcePathJoin(resource.NormalizedPath, input.FromPath), resourcePathJoin(resource.NormalizedPath, input.ToPath)); err != nil {
+	if err := h.versions.MovePath(r.Context(), owner, from, to, info.IsDir()); err != nil {
+		h.logger.Error("failed to move file versions after shared resource rename", zap.Error(err))
+		http.Error(w, "Failed to update file versions", http.StatusInternalServerError)
+		return
+	}
+	if err := h.sharedResourceAccess.MoveOwnerPaths(r.Context(), owner.ID, resourcePathJoin(h.names, resource.NormalizedPath, input.FromPath), resourcePathJoin(h.names, resource.NormalizedPath, input.ToPath)); err != nil {
 		h.logger.Error("failed to sync V3 resources after shared resource rename", zap.Error(err))
 		http.Error(w, "Failed to update shared resources", http.StatusInternalServerError)
 		return
@@ -1180,13 +1350,16 @@ func (h *ShareUserHandler) HandleResourceDelete(w http.ResponseWriter, r *http.R
 		return
 	}
 	cfg := h.shareUserService.Config()
-	root := filepath.Clean(filepath.Join(cfg.WebDAV.Directory, owner.Directory, filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
-	target := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(input.Path))))
+	if service.WriteVolumeError(w, service.CheckVolumeWritable(cfg, owner)) {
+		return
+	}
+	root := filepath.Clean(filepath.Join(service.ResolveUserRoot(cfg, owner), filepath.FromSlash(strings.TrimPrefix(resource.NormalizedPath, "/"))))
+	target := filepath.Clean(filepath.Join(root, filepath.FromSlash(normalizeRelPath(h.names, input.Path))))
 	if target == root || !strings.HasPrefix(target, root+string(os.PathSeparator)) {
 		http.Error(w, "Invalid path", http.StatusBadRequest)
 		return
 	}
-	info, err := os.Stat(target)
+	info, err := h.storage.Stat(target)
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
@@ -1195,7 +1368,7 @@ func (h *ShareUserHandler) HandleResourceDelete(w http.ResponseWriter, r *http.R
 		}
 		return
 	}
-	if err := os.RemoveAll(target); err != nil {
+	if err := h.storage.RemoveAll(target); err != nil {
 		http.Error(w, "Delete failed", http.StatusInternalServerError)
 		return
 	}
@@ -1204,7 +1377,12 @@ func (h *ShareUserHandler) HandleResourceDelete(w http.ResponseWriter, r *http.R
 		http.Error(w, "Failed to remove share references", http.StatusInternalServerError)
 		return
 	}
-	if err := h.sharedResourceAccess.DeleteOwnerPaths(r.Context(), owner.ID, resourcePathJoin(resource.NormalizedPath, input.Path)); err != nil {
+	if err := h.versions.RemovePath(r.Context(), owner, target, info.IsDir()); err != nil {
+		h.logger.Error("failed to remove file versions after shared resource delete", zap.Error(err))
+		http.Error(w, "Failed to update file versions", http.StatusInternalServerError)
+		return
+	}
+	if err := h.sharedResourceAccess.DeleteOwnerPaths(r.Context(), owner.ID, resourcePathJoin(h.names, resource.NormalizedPath, input.Path)); err != nil {
 		h.logger.Error("failed to remove V3 resources after shared resource delete", zap.Error(err))
 		http.Error(w, "Failed to remove shared resources", http.StatusInternalServerError)
 		return
@@ -1261,7 +1439,7 @@ func (h *ShareUserHandler) HandleDownload(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	file, err := os.Open(fullPath)
+	file, err := h.storage.Open(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
@@ -1278,7 +1456,7 @@ func (h *ShareUserHandler) HandleDownload(w http.ResponseWriter, r *http.Request
 		return
 	}
 	if info.IsDir() {
-		http.Error(w, "Path is a directory", http.StatusBadRequest)
+		h.serveShareArchive(w, r, fullPath)
 		return
 	}
 
@@ -1292,6 +1470,54 @@ func (h *ShareUserHandler) HandleDownload(w http.ResponseWriter, r *http.Request
 }
 
 // HandleUpload 上传分享目录内文件
+// HandleThumbnail 定向分享内图片的缩略图（需读权限）
+func (h *ShareUserHandler) HandleThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	shareID := r.URL.Query().Get("shareId")
+	if strings.TrimSpace(shareID) == "" {
+		http.Error(w, "shareId is required", http.StatusBadRequest)
+		return
+	}
+	size, ok := parseThumbnailSize(w, r)
+	if !ok {
+		return
+	}
+
+	item, owner, err := h.shareUserService.ResolveForTarget(r.Context(), u, shareID, "read")
+	if err != nil {
+		writeShareUserError(w, err)
+		return
+	}
+	if !permissionsFromStored(item.Permissions).Has("read") {
+		http.Error(w, "permission denied", http.StatusForbidden)
+		return
+	}
+	_, fullPath, err := h.shareUserService.ResolveSharePath(owner, item, r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if isIgnoredSharePath(fullPath) {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	f, meta, err := h.thumbnails.OpenFile(r.Context(), fullPath, size)
+	if err != nil {
+		writeThumbnailError(w, h.logger, err)
+		return
+	}
+	defer f.Close()
+	serveThumbnail(w, r, f, meta)
+}
+
 func (h *ShareUserHandler) HandleUpload(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut && r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1345,7 +1571,7 @@ func (h *ShareUserHandler) HandleUpload(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid upload body", http.StatusBadRequest)
 		return
 	}
-	file, _, err := r.FormFile("file")
+	file, fileHeader, err := r.FormFile("file")
 	if err != nil {
 		h.logger.Warn("shared upload multipart missing file field",
 			zap.String("share_id", shareID),
@@ -1359,12 +1585,17 @@ func (h *ShareUserHandler) HandleUpload(w http.ResponseWriter, r *http.Request)
 	}
 	defer file.Close()
 
-	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+	if err := h.uploadPolicy.CheckOwnerPath(owner, fullPath, fileHeader.Size, fileHeader.Header.Get("Content-Type")); err != nil {
+		service.WriteUploadPolicyError(w, err)
+		return
+	}
+
+	if err := h.storage.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
 		http.Error(w, "Failed to create directory", http.StatusInternalServerError)
 		return
 	}
 
-	if err := atomicfile.WriteAll(fullPath, file, 0o666); err != nil {
+	if err := storage.WriteAll(h.storage, fullPath, file, 0o666); err != nil {
 		http.Error(w, "Failed to write file", http.StatusInternalServerError)
 		return
 	}
@@ -1435,7 +1666,7 @@ func (h *ShareUserHandler) HandleCreateFolder(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if err := os.MkdirAll(fullPath, 0755); err != nil {
+	if err := h.storage.MkdirAll(fullPath, 0755); err != nil {
 		http.Error(w, "Failed to create folder", http.StatusInternalServerError)
 		return
 	}
@@ -1506,13 +1737,13 @@ func (h *ShareUserHandler) HandleRename(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	info, err := os.Stat(fromPath)
+	info, err := h.storage.Stat(fromPath)
 	if err != nil {
 		http.Error(w, "Failed to stat source", http.StatusInternalServerError)
 		return
 	}
 
-	if err := os.Rename(fromPath, toPath); err != nil {
+	if err := h.storage.Rename(fromPath, toPath); err != nil {
 		http.Error(w, "Failed to rename", http.StatusInternalServerError)
 		return
 	}
@@ -1521,6 +1752,11 @@ func (h *ShareUserHandler) HandleRename(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Failed to update share references", http.StatusInternalServerError)
 		return
 	}
+	if err := h.versions.MovePath(r.Context(), owner, fromPath, toPath, info.IsDir()); err != nil {
+		h.logger.Error("failed to move file versions after share rename", zap.Error(err))
+		http.Error(w, "Failed to update file versions", http.StatusInternalServerError)
+		return
+	}
 	if err := h.mutationRecorder.EnsureDir(r.Context(), filepath.Dir(toPath)); err != nil {
 		h.logger.Error("failed to record share rename parent dir mutation", zap.Error(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -1586,7 +1822,7 @@ func (h *ShareUserHandler) HandleDelete(w http.ResponseWriter, r *http.Request)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	info, err := os.Stat(fullPath)
+	info, err := h.storage.Stat(fullPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			http.Error(w, "Not Found", http.StatusNotFound)
@@ -1596,7 +1832,7 @@ func (h *ShareUserHandler) HandleDelete(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := os.RemoveAll(fullPath); err != nil {
+	if err := h.storage.RemoveAll(fullPath); err != nil {
 		http.Error(w, "Failed to delete", http.StatusInternalServerError)
 		return
 	}
@@ -1605,6 +1841,11 @@ func (h *ShareUserHandler) HandleDelete(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Failed to remove share references", http.StatusInternalServerError)
 		return
 	}
+	if err := h.versions.RemovePath(r.Context(), owner, fullPath, info.IsDir()); err != nil {
+		h.logger.Error("failed to remove file versions after share delete", zap.Error(err))
+		http.Error(w, "Failed to update file versions", http.StatusInternalServerError)
+		return
+	}
 	if err := h.mutationRecorder.RemovePath(r.Context(), fullPath, info.IsDir()); err != nil {
 		h.logger.Error("failed to record share delete mutation", zap.Error(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -1617,6 +1858,9 @@ func (h *ShareUserHandler) HandleDelete(w http.ResponseWriter, r *http.Request)
 }
 
 func writeShareUserError(w http.ResponseWriter, err error) {
+	if service.WriteVolumeError(w, err) {
+		return
+	}
 	if errors.Is(err, auth.ErrAppScopeDenied) || errors.Is(err, auth.ErrAppScopeRequired) {
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
@@ -1691,8 +1935,8 @@ func isIgnoredShareName(name string) bool {
 	return webdavfs.IsIgnoredName(strings.TrimSpace(name))
 }
 
-func normalizeRelPath(raw string) string {
-	raw = strings.TrimSpace(raw)
+func normalizeRelPath(names pathname.Policy, raw string) string {
+	raw = strings.TrimSpace(names.Normalize(raw))
 	if raw == "" {
 		return ""
 	}
@@ -1704,8 +1948,8 @@ func normalizeRelPath(raw string) string {
 	return clean
 }
 
-func resourcePathJoin(root, relative string) string {
-	return path.Join("/", strings.TrimPrefix(root, "/"), normalizeRelPath(relative))
+func resourcePathJoin(names pathname.Policy, root, relative string) string {
+	return path.Join("/", strings.TrimPrefix(root, "/"), normalizeRelPath(names, relative))
 }
 
 func buildShareEntryPath(prefix, name string, isDir bool) string {
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/shareuser"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// shareInviteResp 定向分享邮箱邀请
+type shareInviteResp struct {
+	ID             string `json:"id"`
+	ShareID        string `json:"shareId"`
+	ShareName      string `json:"shareName"`
+	SharePath      string `json:"sharePath"`
+	Email          string `json:"email"`
+	Status         string `json:"status"`
+	AcceptedUserID string `json:"acceptedUserId,omitempty"`
+	AcceptedAt     string `json:"acceptedAt,omitempty"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+func buildShareInviteResps(invites []*shareuser.EmailInvite) []shareInviteResp {
+	items := make([]shareInviteResp, 0, len(invites))
+	for _, invite := range invites {
+		item := shareInviteResp{
+			ID:             invite.ID,
+			ShareID:        invite.ShareID,
+			ShareName:      invite.ShareName,
+			SharePath:      invite.SharePath,
+			Email:          invite.Email,
+			Status:         invite.Status,
+			AcceptedUserID: invite.AcceptedUserID,
+			CreatedAt:      invite.CreatedAt.Format(timeLayout),
+		}
+		if invite.AcceptedAt != nil {
+			item.AcceptedAt = invite.AcceptedAt.Format(timeLayout)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// HandleListInvites 查看我发出的邮箱邀请：
+// GET /api/v1/public/share/user/invites?shareId=&status=pending|accepted|revoked，参数均可省略
+func (h *ShareUserHandler) HandleListInvites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	shareID := strings.TrimSpace(r.URL.Query().Get("shareId"))
+	status := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("status")))
+	switch status {
+	case "", shareuser.InviteStatusPending, shareuser.InviteStatusAccepted, shareuser.InviteStatusRevoked:
+	default:
+		http.Error(w, "invalid status, supported: pending|accepted|revoked", http.StatusBadRequest)
+		return
+	}
+
+	invites, err := h.shareUserService.ListInvites(r.Context(), u, shareID, status)
+	if err != nil {
+		if !errors.Is(err, shareuser.ErrShareNotFound) {
+			h.logger.Error("failed to list share invites",
+				zap.String("owner", u.Username),
+				zap.String("share_id", shareID),
+				zap.Error(err))
+		}
+		writeShareUserError(w, err)
+		return
+	}
+
+	resp := struct {
+		Items []shareInviteResp `json:"items"`
+	}{
+		Items: buildShareInviteResps(invites),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleRevokeInvite 撤销待生效的邮箱邀请
+func (h *ShareUserHandler) HandleRevokeInvite(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		h.logger.Error("user not found in context")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Warn("invalid request body", zap.Error(err))
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.ID) == "" {
+		http.Error(w, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.shareUserService.RevokeInvite(r.Context(), u, req.ID); err != nil {
+		if errors.Is(err, shareuser.ErrInviteNotFound) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		h.logger.Error("failed to revoke share invite",
+			zap.String("owner", u.Username),
+			zap.String("invite_id", req.ID),
+			zap.Error(err))
+		http.Error(w, "Failed to revoke invite", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(`{"message":"revoked successfully"}`)); err != nil {
+		h.logger.Error("failed to write response", zap.Error(err))
+	}
+}
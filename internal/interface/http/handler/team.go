@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/team"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// TeamHandler 团队空间与成员管理
+type TeamHandler struct {
+	service *service.TeamService
+	logger  *zap.Logger
+}
+
+// NewTeamHandler 创建团队空间处理器
+func NewTeamHandler(service *service.TeamService, logger *zap.Logger) *TeamHandler {
+	return &TeamHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// teamResp 团队空间
+type teamResp struct {
+	ID        string `json:"id"`
+	GroupID   string `json:"groupId,omitempty"`
+	GroupName string `json:"groupName,omitempty"`
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Role      string `json:"role"`
+	CanManage bool   `json:"canManage"`
+	CanWrite  bool   `json:"canWrite"`
+	Quota     int64  `json:"quota"`
+	UsedSpace int64  `json:"usedSpace"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// teamMemberResp 团队成员
+type teamMemberResp struct {
+	UserID        string `json:"userId"`
+	Username      string `json:"username"`
+	WalletAddress string `json:"walletAddress,omitempty"`
+	Role          string `json:"role"`
+	IsSelf        bool   `json:"isSelf"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+func buildTeamResp(item *team.Team, u *user.User) teamResp {
+	return teamResp{
+		ID:        item.ID,
+		GroupID:   item.GroupID,
+		GroupName: item.GroupName,
+		Name:      item.Name,
+		Path:      path.Join(team.SpacePrefix, item.ID),
+		Role:      item.Role,
+		CanManage: item.Role == team.RoleOwner || item.GroupOwnerID == u.ID,
+		CanWrite:  team.CanWrite(item.Role),
+		Quota:     item.Quota,
+		UsedSpace: item.UsedSpace,
+		CreatedAt: item.CreatedAt.Format(timeLayout),
+		UpdatedAt: item.UpdatedAt.Format(timeLayout),
+	}
+}
+
+func writeTeamError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, team.ErrTeamsDisabled), errors.Is(err, team.ErrTeamNotFound), errors.Is(err, team.ErrMemberNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, team.ErrPermissionDenied), errors.Is(err, team.ErrNotGroupMember):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, team.ErrDuplicateMember), errors.Is(err, team.ErrTeamNotEmpty), errors.Is(err, team.ErrOwnerCannotLeave):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, user.ErrUserNotFound):
+		http.Error(w, "user not found", http.StatusNotFound)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+func (h *TeamHandler) writeTeam(w http.ResponseWriter, item *team.Team, u *user.User) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(buildTeamResp(item, u)); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// requireUser 校验方法、功能开关与登录用户
+func (h *TeamHandler) requireUser(w http.ResponseWriter, r *http.Request, method string) (*user.User, bool) {
+	if r.Method != method {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if !h.service.Enabled() {
+		http.Error(w, "team spaces are not enabled", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	return u, true
+}
+
+// HandleTeamList 列出当前用户可见的团队空间：GET /api/v1/public/webdav/team/teams
+func (h *TeamHandler) HandleTeamList(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+	teams, err := h.service.List(r.Context(), u)
+	if err != nil {
+		h.logger.Error("failed to list teams", zap.String("username", u.Username), zap.Error(err))
+		http.Error(w, "Failed to list teams", http.StatusInternalServerError)
+		return
+	}
+	resp := struct {
+		Items []teamResp `json:"items"`
+	}{Items: make([]teamResp, 0, len(teams))}
+	for _, item := range teams {
+		resp.Items = append(resp.Items, buildTeamResp(item, u))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleTeamCreate 分组所有者为分组创建团队空间：POST /api/v1/public/webdav/team/teams/create
+func (h *TeamHandler) HandleTeamCreate(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+	var req struct {
+		GroupID string `json:"groupId"`
+		Name    string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	created, err := h.service.Create(r.Context(), u, req.GroupID, req.Name)
+	if err != nil {
+		h.logger.Warn("failed to create team", zap.String("username", u.Username), zap.String("group_id", req.GroupID), zap.Error(err))
+		writeTeamError(w, err)
+		return
+	}
+	h.writeTeam(w, created, u)
+}
+
+// HandleTeamDetail 团队详情：GET /api/v1/public/webdav/team/teams/detail?id=
+func (h *TeamHandler) HandleTeamDetail(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+	item, err := h.service.Get(r.Context(), u, r.URL.Query().Get("id"))
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	h.writeTeam(w, item, u)
+}
+
+// HandleTeamUpdate 重命名团队：PUT /api/v1/public/webdav/team/teams/update
+func (h *TeamHandler) HandleTeamUpdate(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodPut)
+	if !ok {
+		return
+	}
+	var req struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	item, err := h.service.Rename(r.Context(), u, req.ID, req.Name)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	h.writeTeam(w, item, u)
+}
+
+// HandleTeamDelete 删除空的团队空间：DELETE /api/v1/public/webdav/team/teams/delete
+func (h *TeamHandler) HandleTeamDelete(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodDelete)
+	if !ok {
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.Delete(r.Context(), u, req.ID); err != nil {
+		h.logger.Warn("failed to delete team", zap.String("username", u.Username), zap.String("team_id", req.ID), zap.Error(err))
+		writeTeamError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleTeamTransfer 转让团队所有权，原所有者降为 editor：POST /api/v1/public/webdav/team/teams/transfer
+func (h *TeamHandler) HandleTeamTransfer(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+	var req struct {
+		ID     string `json:"id"`
+		Target string `json:"target"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	item, err := h.service.TransferOwnership(r.Context(), u, req.ID, req.Target)
+	if err != nil {
+		h.logger.Warn("failed to transfer team ownership", zap.String("username", u.Username), zap.String("team_id", req.ID), zap.Error(err))
+		writeTeamError(w, err)
+		return
+	}
+	h.writeTeam(w, item, u)
+}
+
+// HandleMemberList 团队成员列表：GET /api/v1/public/webdav/team/members?teamId=
+func (h *TeamHandler) HandleMemberList(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodGet)
+	if !ok {
+		return
+	}
+	members, err := h.service.ListMembers(r.Context(), u, r.URL.Query().Get("teamId"))
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	resp := struct {
+		Items []teamMemberResp `json:"items"`
+	}{Items: make([]teamMemberResp, 0, len(members))}
+	for _, member := range members {
+		resp.Items = append(resp.Items, teamMemberResp{
+			UserID:        member.UserID,
+			Username:      member.Username,
+			WalletAddress: member.WalletAddress,
+			Role:          member.Role,
+			IsSelf:        member.UserID == u.ID,
+			CreatedAt:     member.CreatedAt.Format(timeLayout),
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		h.logger.Error("failed to encode response", zap.Error(err))
+	}
+}
+
+// HandleMemberCreate 添加分组成员到团队：POST /api/v1/public/webdav/team/members/create
+func (h *TeamHandler) HandleMemberCreate(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodPost)
+	if !ok {
+		return
+	}
+	var req struct {
+		TeamID string `json:"teamId"`
+		Target string `json:"target"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	member, err := h.service.AddMember(r.Context(), u, req.TeamID, req.Target, req.Role)
+	if err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(teamMemberResp{
+		UserID:        member.UserID,
+		Username:      member.Username,
+		WalletAddress: member.WalletAddress,
+		Role:          member.Role,
+		IsSelf:        member.UserID == u.ID,
+		CreatedAt:     member.CreatedAt.Format(timeLayout),
+	})
+}
+
+// HandleMemberUpdate 修改成员角色（editor/viewer）：PUT /api/v1/public/webdav/team/members/update
+func (h *TeamHandler) HandleMemberUpdate(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodPut)
+	if !ok {
+		return
+	}
+	var req struct {
+		TeamID string `json:"teamId"`
+		UserID string `json:"userId"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := h.service.UpdateMemberRole(r.Context(), u, req.TeamID, req.UserID, req.Role); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// HandleMemberDelete 移除成员；userId 为空或为自己时表示退出团队：DELETE /api/v1/public/webdav/team/members/delete
+func (h *TeamHandler) HandleMemberDelete(w http.ResponseWriter, r *http.Request) {
+	u, ok := h.requireUser(w, r, http.MethodDelete)
+	if !ok {
+		return
+	}
+	var req struct {
+		TeamID string `json:"teamId"`
+		UserID string `json:"userId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	userID := strings.TrimSpace(req.UserID)
+	if userID == "" {
+		userID = u.ID
+	}
+	if err := h.service.RemoveMember(r.Context(), u, req.TeamID, userID); err != nil {
+		writeTeamError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
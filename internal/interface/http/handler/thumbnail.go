@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// ThumbnailHandler 个人文件缩略图处理器
+type ThumbnailHandler struct {
+	thumbnails *service.ThumbnailService
+	logger     *zap.Logger
+}
+
+func NewThumbnailHandler(thumbnails *service.ThumbnailService, logger *zap.Logger) *ThumbnailHandler {
+	return &ThumbnailHandler{thumbnails: thumbnails, logger: logger}
+}
+
+// HandleThumbnail 返回自己空间内图片的缩略图：path 相对用户根目录，size 向上取到配置的边长
+func (h *ThumbnailHandler) HandleThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	size, ok := parseThumbnailSize(w, r)
+	if !ok {
+		return
+	}
+	f, meta, err := h.thumbnails.Open(r.Context(), u, r.URL.Query().Get("path"), size)
+	if err != nil {
+		writeThumbnailError(w, h.logger, err)
+		return
+	}
+	defer f.Close()
+	serveThumbnail(w, r, f, meta)
+}
+
+// parseThumbnailSize 解析 size 参数，未填写时返回 0（使用默认边长）
+func parseThumbnailSize(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := strings.TrimSpace(r.URL.Query().Get("size"))
+	if raw == "" {
+		return 0, true
+	}
+	size, err := strconv.Atoi(raw)
+	if err != nil || size <= 0 {
+		http.Error(w, "size must be a positive integer", http.StatusBadRequest)
+		return 0, false
+	}
+	return size, true
+}
+
+// serveThumbnail 输出缓存的缩略图；ETag 随原图大小与修改时间变化，客户端每次校验后复用
+func serveThumbnail(w http.ResponseWriter, r *http.Request, f io.ReadSeeker, meta *service.Thumbnail) {
+	w.Header().Set("Content-Type", meta.ContentType)
+	w.Header().Set("ETag", meta.ETag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, "", meta.ModTime, f)
+}
+
+func writeThumbnailError(w http.ResponseWriter, logger *zap.Logger, err error) {
+	switch {
+	case errors.Is(err, service.ErrThumbnailDisabled):
+		http.Error(w, "Thumbnails are disabled", http.StatusNotImplemented)
+	case errors.Is(err, service.ErrThumbnailInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrThumbnailNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, service.ErrThumbnailUnavailable):
+		http.Error(w, "Thumbnail not available for this file", http.StatusUnsupportedMediaType)
+	case errors.Is(err, service.ErrThumbnailForbidden),
+		errors.Is(err, auth.ErrAppScopeDenied),
+		errors.Is(err, auth.ErrAppScopeRequired):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		if logger != nil {
+			logger.Error("failed to render thumbnail", zap.Error(err))
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -216,6 +216,15 @@ func uploadSessionPartChecksum(r *http.Request) string {
 }
 
 func (h *UploadSessionHandler) writeError(w http.ResponseWriter, err error) {
+	writeUploadSessionError(w, h.logger, err)
+}
+
+// writeUploadSessionError maps upload session errors to HTTP responses; it is
+// shared with the anonymous uploads of upload-only public shares.
+func writeUploadSessionError(w http.ResponseWriter, logger *zap.Logger, err error) {
+	if service.WriteUploadPolicyError(w, err) || service.WriteVolumeError(w, err) {
+		return
+	}
 	switch {
 	case errors.Is(err, service.ErrUploadSessionNotFound):
 		http.Error(w, "Not found", http.StatusNotFound)
@@ -227,13 +236,15 @@ func (h *UploadSessionHandler) writeError(w http.ResponseWriter, err error) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 	case errors.Is(err, service.ErrUploadSessionInvalid):
 		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, service.ErrUploadSessionConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
 	case errors.Is(err, shareuser.ErrShareNotFound):
 		http.Error(w, "Not found", http.StatusNotFound)
 	case errors.Is(err, shareuser.ErrShareExpired):
 		http.Error(w, "share expired", http.StatusGone)
 	default:
-		if h.logger != nil {
-			h.logger.Error("upload session error", zap.Error(err))
+		if logger != nil {
+			logger.Error("upload session error", zap.Error(err))
 		}
 		http.Error(w, err.Error(), http.StatusBadRequest)
 	}
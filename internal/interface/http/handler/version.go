@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/auth"
+	"github.com/yeying-community/warehouse/internal/interface/http/middleware"
+	"go.uber.org/zap"
+)
+
+// VersionHandler 文件历史版本处理器
+type VersionHandler struct {
+	service *service.VersionService
+	logger  *zap.Logger
+}
+
+type fileVersionResponse struct {
+	ID        string `json:"id"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	ModTime   string `json:"modTime"`
+	CreatedAt string `json:"createdAt"`
+	Source    string `json:"source,omitempty"`
+}
+
+func NewVersionHandler(versionService *service.VersionService, logger *zap.Logger) *VersionHandler {
+	return &VersionHandler{service: versionService, logger: logger}
+}
+
+// HandleList 列出文件的历史版本（新的在前）
+func (h *VersionHandler) HandleList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	filePath := strings.TrimSpace(r.URL.Query().Get("path"))
+	versions, err := h.service.List(r.Context(), u, filePath)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	items := make([]fileVersionResponse, 0, len(versions))
+	for _, version := range versions {
+		items = append(items, buildFileVersionResponse(version))
+	}
+	h.writeJSON(w, http.StatusOK, map[string]any{"path": filePath, "items": items})
+}
+
+// HandleDownload 下载某个历史版本的内容
+func (h *VersionHandler) HandleDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	filePath := strings.TrimSpace(query.Get("path"))
+	f, version, err := h.service.Open(r.Context(), u, filePath, strings.TrimSpace(query.Get("id")))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	defer f.Close()
+
+	name := path.Base("/" + strings.Trim(filePath, "/"))
+	setAttachmentContentDisposition(w, name)
+	w.Header().Set("X-Version-Id", version.ID)
+	if version.SHA256 != "" {
+		w.Header().Set("ETag", `"`+version.SHA256+`"`)
+	}
+	http.ServeContent(w, r, name, version.ModTime, f)
+}
+
+// HandleDiff 比较两个版本（或版本与当前文件）的元数据
+func (h *VersionHandler) HandleDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	query := r.URL.Query()
+	diff, err := h.service.Diff(
+		r.Context(),
+		u,
+		strings.TrimSpace(query.Get("path")),
+		strings.TrimSpace(query.Get("from")),
+		strings.TrimSpace(query.Get("to")),
+	)
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	h.writeJSON(w, http.StatusOK, map[string]any{
+		"path":        diff.Path,
+		"from":        buildFileVersionResponse(diff.From),
+		"to":          buildFileVersionResponse(diff.To),
+		"sizeDelta":   diff.SizeDelta,
+		"sameContent": diff.SameContent,
+	})
+}
+
+// HandleRestore 将文件恢复到指定版本，被替换的当前内容会保留为新版本
+func (h *VersionHandler) HandleRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	u, ok := middleware.GetUserFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var req struct {
+		Path string `json:"path"`
+		ID   string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	previous, err := h.service.Restore(r.Context(), u, req.Path, strings.TrimSpace(req.ID))
+	if err != nil {
+		h.writeError(w, err)
+		return
+	}
+	resp := map[string]any{
+		"message":  "File restored successfully",
+		"path":     req.Path,
+		"restored": req.ID,
+	}
+	if previous != nil {
+		resp["previous"] = buildFileVersionResponse(previous)
+	}
+	h.writeJSON(w, http.StatusOK, resp)
+}
+
+func buildFileVersionResponse(version *service.FileVersion) fileVersionResponse {
+	if version == nil {
+		return fileVersionResponse{}
+	}
+	return fileVersionResponse{
+		ID:        version.ID,
+		Size:      version.Size,
+		SHA256:    version.SHA256,
+		ModTime:   version.ModTime.Format(timeLayout),
+		CreatedAt: version.CreatedAt.Format(timeLayout),
+		Source:    version.Source,
+	}
+}
+
+func (h *VersionHandler) writeJSON(w http.ResponseWriter, code int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil && h.logger != nil {
+		h.logger.Error("failed to write version response", zap.Error(err))
+	}
+}
+
+func (h *VersionHandler) writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrVersionNotFound), errors.Is(err, os.ErrNotExist):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, service.ErrVersionForbidden), errors.Is(err, auth.ErrAppScopeDenied), errors.Is(err, auth.ErrAppScopeRequired):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case errors.Is(err, service.ErrVersionInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		if h.logger != nil {
+			h.logger.Error("file version error", zap.Error(err))
+		}
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -11,6 +11,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// webdavComplianceClasses 声明 WebDAV 1/2 级别以及 sabre/dav 风格的区间更新（PATCH）支持
+const webdavComplianceClasses = "1, 2, sabredav-partialupdate"
+
 // WebDAVHandler WebDAV 处理器
 // 职责：处理 HTTP 层面的逻辑，如请求验证、响应格式化、错误处理等
 type WebDAVHandler struct {
@@ -40,7 +43,7 @@ func (h *WebDAVHandler) Handle(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// 为所有 WebDAV 请求添加必需的响应头
-	w.Header().Set("DAV", "1, 2")
+	w.Header().Set("DAV", webdavComplianceClasses)
 	w.Header().Set("MS-Author-Via", "DAV")
 
 	// 从上下文获取用户信息（用于日志和监控）
@@ -68,15 +71,20 @@ func (h *WebDAVHandler) handleOptions(w http.ResponseWriter, _ *http.Request) {
 	// 允许的方法
 	methods := []string{
 		"OPTIONS",
-		"GET", "HEAD", "POST", "PUT", "DELETE",
+		"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE",
 		"PROPFIND", "PROPPATCH",
 		"MKCOL", "COPY", "MOVE",
 		"LOCK", "UNLOCK",
 	}
+	if h.webdavService.SearchEnabled() {
+		methods = append(methods, "SEARCH")
+		w.Header().Set("DASL", "<DAV:basicsearch>")
+	}
 
 	// 设置响应头
 	w.Header().Set("Allow", strings.Join(methods, ", "))
-	w.Header().Set("DAV", "1, 2")
+	w.Header().Set("DAV", webdavComplianceClasses)
+	w.Header().Set("Accept-Patch", service.PartialUpdateContentType)
 	w.Header().Set("MS-Author-Via", "DAV")
 	w.Header().Set("Accept-Ranges", "bytes")
 
@@ -160,6 +160,9 @@ func isWebDAVRequest(r *http.Request) bool {
 	if r == nil {
 		return false
 	}
+	if isNextcloudCompatPath(r.URL.Path) {
+		return true
+	}
 	method := strings.ToUpper(r.Method)
 	switch method {
 	case "PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK", "REPORT", "SEARCH":
@@ -192,7 +195,15 @@ func isWebDAVPath(rawPath, webdavPrefix string) bool {
 	return path == prefix || strings.HasPrefix(path, prefix+"/")
 }
 
+// isNextcloudCompatPath 识别 Nextcloud 客户端使用的 DAV/OCS 路径，这些客户端只会使用 Basic 认证
+func isNextcloudCompatPath(rawPath string) bool {
+	return strings.HasPrefix(rawPath, "/remote.php/") || strings.HasPrefix(rawPath, "/ocs/")
+}
+
 func isAccessKeyRequestAllowed(r *http.Request, webdavPrefix string) bool {
+	if isNextcloudCompatPath(r.URL.Path) {
+		return true
+	}
 	if !isWebDAVPath(r.URL.Path, webdavPrefix) {
 		return false
 	}
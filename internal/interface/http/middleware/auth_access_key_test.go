@@ -54,6 +54,20 @@ func TestIsAccessKeyRequestAllowed(t *testing.T) {
 			},
 			want: true,
 		},
+		{
+			name:         "nextcloud chunk upload path allowed",
+			method:       http.MethodPut,
+			path:         "/remote.php/dav/uploads/alice/transfer/1",
+			webdavPrefix: "/dav",
+			want:         true,
+		},
+		{
+			name:         "nextcloud ocs path allowed",
+			method:       http.MethodGet,
+			path:         "/ocs/v2.php/cloud/user",
+			webdavPrefix: "/",
+			want:         true,
+		},
 		{
 			name:         "prefix normalization supported",
 			method:       http.MethodGet,
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// defaultTrustedProxies 未配置 trusted_proxies 时只信任本机回环地址上的代理
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128"}
+
+// ClientIPResolver 识别请求的客户端地址。只有 behind_proxy 开启且直连对端属于
+// 受信任的代理时才读取 X-Forwarded-For / X-Real-IP，否则客户端可以通过伪造
+// 请求头冒充任意地址
+type ClientIPResolver struct {
+	behindProxy bool
+	trusted     []netip.Prefix
+}
+
+// NewClientIPResolver 创建客户端地址解析器；trustedProxies 为 IP 或 CIDR，
+// 为空时只信任回环地址，无法解析的条目被忽略（配置加载时已校验）
+func NewClientIPResolver(behindProxy bool, trustedProxies []string) *ClientIPResolver {
+	if len(trustedProxies) == 0 {
+		trustedProxies = defaultTrustedProxies
+	}
+	resolver := &ClientIPResolver{behindProxy: behindProxy}
+	for _, raw := range trustedProxies {
+		if prefix, ok := parseTrustedProxy(raw); ok {
+			resolver.trusted = append(resolver.trusted, prefix)
+		}
+	}
+	return resolver
+}
+
+// parseTrustedProxy parses one trusted proxy entry, an IP or a CIDR.
+func parseTrustedProxy(raw string) (netip.Prefix, bool) {
+	raw = strings.TrimSpace(raw)
+	if strings.Contains(raw, "/") {
+		prefix, err := netip.ParsePrefix(raw)
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		return prefix.Masked(), true
+	}
+	addr, err := netip.ParseAddr(raw)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), true
+}
+
+// ClientIP 返回请求的客户端地址。对端是受信任的代理时，从右向左跳过
+// X-Forwarded-For 中同样受信任的代理，取第一个其他地址；没有该头时取
+// X-Real-IP。nil 解析器直接使用对端地址
+func (c *ClientIPResolver) ClientIP(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if c == nil || !c.behindProxy || !c.isTrusted(peer) {
+		return peer
+	}
+	if entries := forwardedFor(r); len(entries) > 0 {
+		client := peer
+		for i := len(entries) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(entries[i])
+			if err != nil {
+				// A malformed hop cannot be attributed; keep the nearest
+				// address a trusted proxy vouched for.
+				return client
+			}
+			client = addr.Unmap().String()
+			if !c.trustedAddr(addr) {
+				return client
+			}
+		}
+		return client
+	}
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		if addr, err := netip.ParseAddr(xri); err == nil {
+			return addr.Unmap().String()
+		}
+	}
+	return peer
+}
+
+func (c *ClientIPResolver) isTrusted(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	return err == nil && c.trustedAddr(addr)
+}
+
+func (c *ClientIPResolver) trustedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor flattens every X-Forwarded-For header in order.
+func forwardedFor(r *http.Request) []string {
+	var entries []string
+	for _, value := range r.Header.Values("X-Forwarded-For") {
+		for _, entry := range strings.Split(value, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPTrustsForwardedHeadersOnlyFromTrustedProxies(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name        string
+		behindProxy bool
+		trusted     []string
+		remoteAddr  string
+		xff         string
+		realIP      string
+		want        string
+	}{
+		{name: "proxy disabled", trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:1234", xff: "203.0.113.7", want: "10.0.0.2"},
+		{name: "untrusted peer", behindProxy: true, trusted: []string{"10.0.0.0/8"}, remoteAddr: "192.0.2.1:1234", xff: "203.0.113.7", want: "192.0.2.1"},
+		{name: "spoofed leftmost entry", behindProxy: true, trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:1234", xff: "1.1.1.1, 203.0.113.7", want: "203.0.113.7"},
+		{name: "proxy chain", behindProxy: true, trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:1234", xff: "1.1.1.1, 203.0.113.7, 10.0.0.9", want: "203.0.113.7"},
+		{name: "malformed hop", behindProxy: true, trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:1234", xff: "203.0.113.7, junk, 10.0.0.9", want: "10.0.0.9"},
+		{name: "real ip", behindProxy: true, trusted: []string{"10.0.0.2"}, remoteAddr: "10.0.0.2:1234", realIP: "203.0.113.8", want: "203.0.113.8"},
+		{name: "no headers", behindProxy: true, trusted: []string{"10.0.0.0/8"}, remoteAddr: "10.0.0.2:1234", want: "10.0.0.2"},
+		{name: "loopback by default", behindProxy: true, remoteAddr: "127.0.0.1:1234", xff: "203.0.113.7", want: "203.0.113.7"},
+		{name: "default ignores other peers", behindProxy: true, remoteAddr: "192.0.2.1:1234", xff: "203.0.113.7", want: "192.0.2.1"},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.remoteAddr
+			if tc.xff != "" {
+				r.Header.Set("X-Forwarded-For", tc.xff)
+			}
+			if tc.realIP != "" {
+				r.Header.Set("X-Real-IP", tc.realIP)
+			}
+			resolver := NewClientIPResolver(tc.behindProxy, tc.trusted)
+			if got := resolver.ClientIP(r); got != tc.want {
+				t.Fatalf("ClientIP = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestNilClientIPResolverUsesPeerAddress(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	var resolver *ClientIPResolver
+	if got := resolver.ClientIP(r); got != "192.0.2.1" {
+		t.Fatalf("ClientIP = %q, want peer address", got)
+	}
+}
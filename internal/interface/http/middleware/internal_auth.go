@@ -19,6 +19,7 @@ const (
 	InternalSignatureHeader            = "X-Warehouse-Signature"
 	InternalContentSHA256Header        = "X-Warehouse-Content-SHA256"
 	InternalAssignmentGenerationHeader = "X-Warehouse-Assignment-Generation"
+	InternalBlobLinkHeader             = "X-Warehouse-Blob-Link"
 	unsignedPayloadMarker              = "UNSIGNED-PAYLOAD"
 )
 
@@ -9,15 +9,15 @@ import (
 
 // LoggerMiddleware 日志中间件
 type LoggerMiddleware struct {
-	logger      *zap.Logger
-	behindProxy bool
+	logger    *zap.Logger
+	clientIPs *ClientIPResolver
 }
 
 // NewLoggerMiddleware 创建日志中间件
-func NewLoggerMiddleware(logger *zap.Logger, behindProxy bool) *LoggerMiddleware {
+func NewLoggerMiddleware(logger *zap.Logger, clientIPs *ClientIPResolver) *LoggerMiddleware {
 	return &LoggerMiddleware{
-		logger:      logger,
-		behindProxy: behindProxy,
+		logger:    logger,
+		clientIPs: clientIPs,
 	}
 }
 
@@ -43,7 +43,7 @@ func (m *LoggerMiddleware) Handle(next http.Handler) http.Handler {
 			zap.String("timeout", r.Header.Get("Timeout")),
 			zap.Int("status", wrapped.statusCode),
 			zap.Duration("duration", duration),
-			zap.String("remote_addr", m.getRemoteAddr(r)),
+			zap.String("remote_addr", m.clientIPs.ClientIP(r)),
 			zap.String("user_agent", r.UserAgent()),
 		}
 
@@ -56,20 +56,6 @@ func (m *LoggerMiddleware) Handle(next http.Handler) http.Handler {
 	})
 }
 
-// getRemoteAddr 获取远程地址
-func (m *LoggerMiddleware) getRemoteAddr(r *http.Request) string {
-	if m.behindProxy {
-		// 尝试从 X-Forwarded-For 或 X-Real-IP 获取
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			return xff
-		}
-		if xri := r.Header.Get("X-Real-IP"); xri != "" {
-			return xri
-		}
-	}
-	return r.RemoteAddr
-}
-
 // responseWriter 包装 ResponseWriter
 type responseWriter struct {
 	http.ResponseWriter
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// defaultVolumeName is the volume users without a recorded volume live on.
+const defaultVolumeName = "default"
+
+// VolumeMiddleware rejects writes to user trees that live on a read-only
+// volume or are being moved to another volume.
+type VolumeMiddleware struct {
+	readOnly map[string]struct{}
+	logger   *zap.Logger
+}
+
+// NewVolumeMiddleware creates a new volume middleware for the given read-only
+// volume names.
+func NewVolumeMiddleware(readOnlyVolumes []string, logger *zap.Logger) *VolumeMiddleware {
+	readOnly := make(map[string]struct{}, len(readOnlyVolumes))
+	for _, raw := range readOnlyVolumes {
+		name := strings.TrimSpace(raw)
+		if name == "" {
+			continue
+		}
+		readOnly[name] = struct{}{}
+	}
+	return &VolumeMiddleware{
+		readOnly: readOnly,
+		logger:   logger,
+	}
+}
+
+// Handle enforces the volume state of the authenticated user.
+func (m *VolumeMiddleware) Handle(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, ok := GetUserFromContext(r.Context())
+		if !ok || isReadOnlyMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if u.VolumeMoving {
+			m.logger.Info("write rejected: user directory is moving",
+				zap.String("username", u.Username),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path))
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "user directory is moving to another volume", http.StatusServiceUnavailable)
+			return
+		}
+
+		volume := strings.TrimSpace(u.Volume)
+		if volume == "" {
+			volume = defaultVolumeName
+		}
+		if _, readOnly := m.readOnly[volume]; readOnly {
+			m.logger.Info("write rejected: volume is read-only",
+				zap.String("username", u.Username),
+				zap.String("volume", volume),
+				zap.String("method", r.Method))
+			http.Error(w, "storage volume is read-only", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isReadOnlyMethod(method string) bool {
+	switch strings.ToUpper(method) {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "REPORT", "SEARCH":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/yeying-community/warehouse/internal/domain/user"
+	"go.uber.org/zap"
+)
+
+func TestVolumeMiddlewareBlocksWrites(t *testing.T) {
+	handler := NewVolumeMiddleware([]string{"archive"}, zap.NewNop()).Handle(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		name   string
+		method string
+		volume string
+		moving bool
+		want   int
+	}{
+		{name: "write on default volume", method: http.MethodPut, want: http.StatusNoContent},
+		{name: "write on read-only volume", method: http.MethodPut, volume: "archive", want: http.StatusForbidden},
+		{name: "read on read-only volume", method: "PROPFIND", volume: "archive", want: http.StatusNoContent},
+		{name: "write while moving", method: "MKCOL", moving: true, want: http.StatusServiceUnavailable},
+		{name: "read while moving", method: http.MethodGet, moving: true, want: http.StatusNoContent},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			u := user.NewUser("alice", "alice")
+			u.Volume = tc.volume
+			u.VolumeMoving = tc.moving
+			req := httptest.NewRequest(tc.method, "/dav/a.txt", nil)
+			req = req.WithContext(context.WithValue(req.Context(), UserContextKey, u))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tc.want)
+			}
+			if tc.want == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+				t.Fatal("missing Retry-After header")
+			}
+		})
+	}
+}
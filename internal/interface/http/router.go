@@ -30,9 +30,16 @@ type Router struct {
 	shareUserHandler           *handler.ShareUserHandler
 	webdavAccessKeyHandler     *handler.WebDAVAccessKeyHandler
 	groupHandler               *handler.GroupHandler
+	teamHandler                *handler.TeamHandler
 	notificationHandler        *handler.NotificationHandler
 	s3CredentialHandler        *handler.S3CredentialHandler
 	uploadSessionHandler       *handler.UploadSessionHandler
+	nextcloudHandler           *handler.NextcloudHandler
+	extractHandler             *handler.ExtractHandler
+	versionHandler             *handler.VersionHandler
+	searchHandler              *handler.SearchHandler
+	thumbnailHandler           *handler.ThumbnailHandler
+	jobHandler                 *handler.JobHandler
 	logger                     *zap.Logger
 }
 
@@ -55,9 +62,16 @@ func NewRouter(
 	shareUserHandler *handler.ShareUserHandler,
 	webdavAccessKeyHandler *handler.WebDAVAccessKeyHandler,
 	groupHandler *handler.GroupHandler,
+	teamHandler *handler.TeamHandler,
 	notificationHandler *handler.NotificationHandler,
 	s3CredentialHandler *handler.S3CredentialHandler,
 	uploadSessionHandler *handler.UploadSessionHandler,
+	nextcloudHandler *handler.NextcloudHandler,
+	extractHandler *handler.ExtractHandler,
+	versionHandler *handler.VersionHandler,
+	searchHandler *handler.SearchHandler,
+	thumbnailHandler *handler.ThumbnailHandler,
+	jobHandler *handler.JobHandler,
 	logger *zap.Logger,
 ) *Router {
 	return &Router{
@@ -78,9 +92,16 @@ func NewRouter(
 		shareUserHandler:           shareUserHandler,
 		webdavAccessKeyHandler:     webdavAccessKeyHandler,
 		groupHandler:               groupHandler,
+		teamHandler:                teamHandler,
 		notificationHandler:        notificationHandler,
 		s3CredentialHandler:        s3CredentialHandler,
 		uploadSessionHandler:       uploadSessionHandler,
+		nextcloudHandler:           nextcloudHandler,
+		extractHandler:             extractHandler,
+		versionHandler:             versionHandler,
+		searchHandler:              searchHandler,
+		thumbnailHandler:           thumbnailHandler,
+		jobHandler:                 jobHandler,
 		logger:                     logger,
 	}
 }
@@ -117,9 +138,9 @@ func (r *Router) Setup() http.Handler {
 		mux.Handle("/api/v1/public/assets/spaces", r.createAuthenticatedHandler(http.HandlerFunc(r.assetsHandler.GetSpaces)))
 	}
 	if r.assetObjectHandler != nil {
-		mux.Handle("/api/v1/public/assets/object", r.createAuthenticatedHandler(http.HandlerFunc(r.assetObjectHandler.HandleObject)))
-		mux.Handle("/api/v1/public/assets/object/content", r.createAuthenticatedHandler(http.HandlerFunc(r.assetObjectHandler.HandleObjectContent)))
-		mux.Handle("/api/v1/public/assets/objects", r.createAuthenticatedHandler(http.HandlerFunc(r.assetObjectHandler.HandleObjects)))
+		mux.Handle("/api/v1/public/assets/object", r.createStorageHandler(http.HandlerFunc(r.assetObjectHandler.HandleObject)))
+		mux.Handle("/api/v1/public/assets/object/content", r.createStorageHandler(http.HandlerFunc(r.assetObjectHandler.HandleObjectContent)))
+		mux.Handle("/api/v1/public/assets/objects", r.createStorageHandler(http.HandlerFunc(r.assetObjectHandler.HandleObjects)))
 	}
 	mux.Handle("/api/v1/public/webdav/quota", r.createAuthenticatedHandler(http.HandlerFunc(r.quotaHandler.GetUserQuota)))
 	mux.Handle("/api/v1/public/webdav/user/info", r.createAuthenticatedHandler(http.HandlerFunc(r.userHandler.GetUserInfo)))
@@ -140,6 +161,7 @@ func (r *Router) Setup() http.Handler {
 	mux.Handle("/api/v1/admin/users/update", r.createAdminHandler(http.HandlerFunc(r.adminUserHandler.HandleUpdate)))
 	mux.Handle("/api/v1/admin/users/delete", r.createAdminHandler(http.HandlerFunc(r.adminUserHandler.HandleDelete)))
 	mux.Handle("/api/v1/admin/users/reset-password", r.createAdminHandler(http.HandlerFunc(r.adminUserHandler.HandleResetPassword)))
+	mux.Handle("/api/v1/admin/shares/access-log", r.createAdminHandler(http.HandlerFunc(r.shareHandler.HandleAdminAccessLog)))
 	if r.notificationHandler != nil {
 		mux.Handle("/api/v1/admin/notifications/list", r.createAdminHandler(http.HandlerFunc(r.notificationHandler.HandleAdminList)))
 		mux.Handle("/api/v1/admin/notifications/unread-count", r.createAdminHandler(http.HandlerFunc(r.notificationHandler.HandleAdminUnreadCount)))
@@ -151,15 +173,17 @@ func (r *Router) Setup() http.Handler {
 
 	// 回收站路由
 	mux.Handle("/api/v1/public/webdav/recycle/list", r.createAuthenticatedHandler(http.HandlerFunc(r.recycleHandler.HandleList)))
-	mux.Handle("/api/v1/public/webdav/recycle/recover", r.createAuthenticatedHandler(http.HandlerFunc(r.recycleHandler.HandleRecover)))
-	mux.Handle("/api/v1/public/webdav/recycle/permanent", r.createAuthenticatedHandler(http.HandlerFunc(r.recycleHandler.HandleRemove)))
-	mux.Handle("/api/v1/public/webdav/recycle/clear", r.createAuthenticatedHandler(http.HandlerFunc(r.recycleHandler.HandleClear)))
+	mux.Handle("/api/v1/public/webdav/recycle/recover", r.createStorageHandler(http.HandlerFunc(r.recycleHandler.HandleRecover)))
+	mux.Handle("/api/v1/public/webdav/recycle/permanent", r.createStorageHandler(http.HandlerFunc(r.recycleHandler.HandleRemove)))
+	mux.Handle("/api/v1/public/webdav/recycle/clear", r.createStorageHandler(http.HandlerFunc(r.recycleHandler.HandleClear)))
 
 	// 分组管理
 	mux.Handle("/api/v1/public/webdav/group/groups", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleGroupList)))
 	mux.Handle("/api/v1/public/webdav/group/groups/create", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleGroupCreate)))
 	mux.Handle("/api/v1/public/webdav/group/groups/update", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleGroupUpdate)))
 	mux.Handle("/api/v1/public/webdav/group/groups/delete", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleGroupDelete)))
+	mux.Handle("/api/v1/public/webdav/group/groups/leave", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleGroupLeave)))
+	mux.Handle("/api/v1/public/webdav/group/groups/transfer", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleGroupTransfer)))
 	mux.Handle("/api/v1/public/webdav/group/members", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleMemberList)))
 	mux.Handle("/api/v1/public/webdav/group/members/create", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleMemberCreate)))
 	mux.Handle("/api/v1/public/webdav/group/members/update", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleMemberUpdate)))
@@ -168,6 +192,23 @@ func (r *Router) Setup() http.Handler {
 	mux.Handle("/api/v1/public/webdav/group/members/approve", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleMemberApprove)))
 	mux.Handle("/api/v1/public/webdav/group/members/reject", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleMemberReject)))
 	mux.Handle("/api/v1/public/webdav/group/members/delete", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleMemberDelete)))
+	mux.Handle("/api/v1/public/webdav/group/members/role", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleMemberRoleUpdate)))
+	mux.Handle("/api/v1/public/webdav/group/invites", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleInviteLinkList)))
+	mux.Handle("/api/v1/public/webdav/group/invites/create", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleInviteLinkCreate)))
+	mux.Handle("/api/v1/public/webdav/group/invites/revoke", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleInviteLinkRevoke)))
+	mux.Handle("/api/v1/public/webdav/group/invites/join", r.createAuthenticatedHandler(http.HandlerFunc(r.groupHandler.HandleInviteJoin)))
+	if r.teamHandler != nil {
+		mux.Handle("/api/v1/public/webdav/team/teams", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleTeamList)))
+		mux.Handle("/api/v1/public/webdav/team/teams/create", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleTeamCreate)))
+		mux.Handle("/api/v1/public/webdav/team/teams/detail", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleTeamDetail)))
+		mux.Handle("/api/v1/public/webdav/team/teams/update", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleTeamUpdate)))
+		mux.Handle("/api/v1/public/webdav/team/teams/delete", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleTeamDelete)))
+		mux.Handle("/api/v1/public/webdav/team/teams/transfer", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleTeamTransfer)))
+		mux.Handle("/api/v1/public/webdav/team/members", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleMemberList)))
+		mux.Handle("/api/v1/public/webdav/team/members/create", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleMemberCreate)))
+		mux.Handle("/api/v1/public/webdav/team/members/update", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleMemberUpdate)))
+		mux.Handle("/api/v1/public/webdav/team/members/delete", r.createAuthenticatedHandler(http.HandlerFunc(r.teamHandler.HandleMemberDelete)))
+	}
 	if r.webdavAccessKeyHandler != nil {
 		mux.Handle("/api/v1/public/webdav/access-keys/list", r.createAuthenticatedHandler(http.HandlerFunc(r.webdavAccessKeyHandler.HandleList)))
 		mux.Handle("/api/v1/public/webdav/access-keys/create", r.createAuthenticatedHandler(http.HandlerFunc(r.webdavAccessKeyHandler.HandleCreate)))
@@ -182,8 +223,58 @@ func (r *Router) Setup() http.Handler {
 		mux.Handle("/api/v1/public/s3/credentials/delete", r.createAuthenticatedHandler(http.HandlerFunc(r.s3CredentialHandler.HandleDelete)))
 	}
 	if r.uploadSessionHandler != nil {
-		mux.Handle("/api/v1/public/uploads/sessions", r.createAuthenticatedHandler(http.HandlerFunc(r.uploadSessionHandler.HandleCreate)))
-		mux.Handle("/api/v1/public/uploads/sessions/", r.createAuthenticatedHandler(http.HandlerFunc(r.uploadSessionHandler.HandleItem)))
+		mux.Handle("/api/v1/public/uploads/sessions", r.createStorageHandler(http.HandlerFunc(r.uploadSessionHandler.HandleCreate)))
+		mux.Handle("/api/v1/public/uploads/sessions/", r.createStorageHandler(http.HandlerFunc(r.uploadSessionHandler.HandleItem)))
+	}
+
+	if r.extractHandler != nil {
+		mux.Handle("/api/v1/public/webdav/extract", r.createStorageHandler(http.HandlerFunc(r.extractHandler.HandleCreate)))
+		mux.Handle("/api/v1/public/webdav/extract/jobs", r.createAuthenticatedHandler(http.HandlerFunc(r.extractHandler.HandleJobs)))
+		mux.Handle("/api/v1/public/webdav/extract/jobs/", r.createAuthenticatedHandler(http.HandlerFunc(r.extractHandler.HandleJobs)))
+	}
+	if r.versionHandler != nil {
+		mux.Handle("/api/v1/public/webdav/versions", r.createAuthenticatedHandler(http.HandlerFunc(r.versionHandler.HandleList)))
+		mux.Handle("/api/v1/public/webdav/versions/download", r.createAuthenticatedHandler(http.HandlerFunc(r.versionHandler.HandleDownload)))
+		mux.Handle("/api/v1/public/webdav/versions/diff", r.createAuthenticatedHandler(http.HandlerFunc(r.versionHandler.HandleDiff)))
+		mux.Handle("/api/v1/public/webdav/versions/restore", r.createStorageHandler(http.HandlerFunc(r.versionHandler.HandleRestore)))
+	}
+	if r.searchHandler != nil {
+		mux.Handle("/api/v1/public/search", r.createAuthenticatedHandler(http.HandlerFunc(r.searchHandler.HandleSearch)))
+		mux.Handle("/api/v1/public/search/tags", r.createAuthenticatedHandler(http.HandlerFunc(r.searchHandler.HandleSetTags)))
+		mux.Handle("/api/v1/public/search/content", r.createAuthenticatedHandler(http.HandlerFunc(r.searchHandler.HandleContentSearch)))
+		mux.Handle("/api/v1/public/search/content/settings", r.createAuthenticatedHandler(http.HandlerFunc(r.searchHandler.HandleContentSettings)))
+	}
+	// 图片缩略图（thumbnails.enabled）
+	if r.thumbnailHandler != nil {
+		mux.Handle("/api/v1/public/webdav/thumbnail", r.createAuthenticatedHandler(http.HandlerFunc(r.thumbnailHandler.HandleThumbnail)))
+		mux.Handle("/api/v1/public/share/user/thumbnail", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleThumbnail)))
+		mux.Handle("/api/v1/public/share/resource/thumbnail", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleResourceThumbnail)))
+		mux.HandleFunc("/api/v1/public/share/thumbnail/", r.shareHandler.HandleThumbnail)
+	}
+	// 后台任务（批量删除、清空回收站、额度重建等）
+	if r.jobHandler != nil {
+		mux.Handle("/api/v1/public/jobs", r.createAuthenticatedHandler(http.HandlerFunc(r.jobHandler.HandleJobs)))
+		mux.Handle("/api/v1/public/jobs/", r.createAuthenticatedHandler(http.HandlerFunc(r.jobHandler.HandleJobs)))
+		mux.Handle("/api/v1/admin/jobs/list", r.createAdminHandler(http.HandlerFunc(r.jobHandler.HandleAdminList)))
+		mux.Handle("/api/v1/admin/jobs/get", r.createAdminHandler(http.HandlerFunc(r.jobHandler.HandleAdminGet)))
+		mux.Handle("/api/v1/admin/jobs/create", r.createAdminHandler(http.HandlerFunc(r.jobHandler.HandleAdminCreate)))
+		mux.Handle("/api/v1/admin/jobs/cancel", r.createAdminHandler(http.HandlerFunc(r.jobHandler.HandleAdminCancel)))
+		mux.Handle("/api/v1/admin/jobs/retry", r.createAdminHandler(http.HandlerFunc(r.jobHandler.HandleAdminRetry)))
+	}
+
+	// Nextcloud 客户端兼容（status.php / OCS / chunking v2）
+	if r.nextcloudHandler != nil {
+		mux.HandleFunc("/status.php", r.nextcloudHandler.HandleStatus)
+		mux.HandleFunc("/ocs/v1.php/cloud/capabilities", r.nextcloudHandler.HandleCapabilities)
+		mux.HandleFunc("/ocs/v2.php/cloud/capabilities", r.nextcloudHandler.HandleCapabilities)
+		mux.Handle("/ocs/v1.php/cloud/user", r.createAuthenticatedHandler(http.HandlerFunc(r.nextcloudHandler.HandleUser)))
+		mux.Handle("/ocs/v2.php/cloud/user", r.createAuthenticatedHandler(http.HandlerFunc(r.nextcloudHandler.HandleUser)))
+		mux.Handle(handler.NextcloudUploadsPrefix, r.createStorageHandler(http.HandlerFunc(r.nextcloudHandler.HandleUploads)))
+		// 文件浏览与同步：改写到 webdav.prefix 后复用 WebDAV 处理器（认证在改写之后进行）
+		nextcloudDAV := r.nextcloudHandler.MountDAV(r.createStorageHandler(http.HandlerFunc(r.webdavHandler.Handle)))
+		mux.Handle(strings.TrimSuffix(handler.NextcloudLegacyDAVPrefix, "/"), nextcloudDAV)
+		mux.Handle(handler.NextcloudLegacyDAVPrefix, nextcloudDAV)
+		mux.Handle(handler.NextcloudFilesPrefix, nextcloudDAV)
 	}
 
 	// 分享路由
@@ -191,6 +282,12 @@ func (r *Router) Setup() http.Handler {
 	mux.Handle("/api/v1/public/share/create-from-resource", r.createAuthenticatedHandler(http.HandlerFunc(r.shareHandler.HandleCreateFromReceivedResource)))
 	mux.Handle("/api/v1/public/share/list", r.createAuthenticatedHandler(http.HandlerFunc(r.shareHandler.HandleList)))
 	mux.Handle("/api/v1/public/share/revoke", r.createAuthenticatedHandler(http.HandlerFunc(r.shareHandler.HandleRevoke)))
+	mux.Handle("/api/v1/public/share/password", r.createAuthenticatedHandler(http.HandlerFunc(r.shareHandler.HandleSetPassword)))
+	mux.Handle("/api/v1/public/share/extend", r.createAuthenticatedHandler(http.HandlerFunc(r.shareHandler.HandleExtend)))
+	mux.Handle("/api/v1/public/share/access-log", r.createAuthenticatedHandler(http.HandlerFunc(r.shareHandler.HandleAccessLog)))
+	mux.HandleFunc("/api/v1/public/share/entries/", r.shareHandler.HandleEntries)
+	mux.HandleFunc("/api/v1/public/share/download/", r.shareHandler.HandleDownload)
+	mux.HandleFunc("/api/v1/public/share/upload/", r.shareHandler.HandleUpload)
 	mux.HandleFunc("/api/v1/public/share/", r.shareHandler.HandleAccess)
 
 	// 定向分享路由（需要认证）
@@ -198,7 +295,16 @@ func (r *Router) Setup() http.Handler {
 	mux.Handle("/api/v1/public/share/user/list", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleListMine)))
 	mux.Handle("/api/v1/public/share/user/received", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleListReceived)))
 	mux.Handle("/api/v1/public/share/user/revoke", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleRevoke)))
+	mux.Handle("/api/v1/public/share/user/extend", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleExtend)))
 	mux.Handle("/api/v1/public/share/user/audiences", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleListAudiences)))
+	mux.Handle("/api/v1/public/share/user/invites", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleListInvites)))
+	mux.Handle("/api/v1/public/share/user/invites/revoke", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleRevokeInvite)))
+	mux.Handle("/api/v1/public/share/access-requests", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleListAccessRequests)))
+	mux.Handle("/api/v1/public/share/access-requests/create", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleCreateAccessRequest)))
+	mux.Handle("/api/v1/public/share/access-requests/history", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleAccessRequestHistory)))
+	mux.Handle("/api/v1/public/share/access-requests/approve", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleApproveAccessRequest)))
+	mux.Handle("/api/v1/public/share/access-requests/deny", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleDenyAccessRequest)))
+	mux.Handle("/api/v1/public/share/access-requests/cancel", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleCancelAccessRequest)))
 	mux.Handle("/api/v1/public/share/user/entries", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleEntries)))
 	mux.Handle("/api/v1/public/share/resource/entries", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleResourceEntries)))
 	mux.Handle("/api/v1/public/share/resource/download", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleResourceDownload)))
@@ -214,7 +320,7 @@ func (r *Router) Setup() http.Handler {
 	// WebDAV 路由（需要认证）
 	webdavPrefix := r.normalizePrefix(r.config.WebDAV.Prefix)
 	mux.Handle(webdavPrefix+"share/", r.createAuthenticatedHandler(http.HandlerFunc(r.shareUserHandler.HandleDAV)))
-	mux.Handle(webdavPrefix, r.createAuthenticatedHandler(http.HandlerFunc(r.webdavHandler.Handle)))
+	mux.Handle(webdavPrefix, r.createStorageHandler(http.HandlerFunc(r.webdavHandler.Handle)))
 
 	// 应用全局中间件
 	handler := r.applyMiddlewares(mux)
@@ -229,6 +335,19 @@ func (r *Router) createAuthenticatedHandler(handler http.Handler) http.Handler {
 	return authMiddleware.Handle(handler)
 }
 
+// createStorageHandler 创建会写入用户目录的处理器，用户所在卷只读或正在迁移时拒绝写请求
+func (r *Router) createStorageHandler(handler http.Handler) http.Handler {
+	readOnly := make([]string, 0, len(r.config.Storage.Volumes))
+	for _, volume := range r.config.Storage.Volumes {
+		if volume.ReadOnly {
+			readOnly = append(readOnly, volume.Name)
+		}
+	}
+	volumeMiddleware := middleware.NewVolumeMiddleware(readOnly, r.logger)
+	authMiddleware := middleware.NewAuthMiddleware(r.authenticators, true, r.config.WebDAV.Prefix, r.logger)
+	return authMiddleware.Handle(volumeMiddleware.Handle(handler))
+}
+
 // createAdminHandler 创建管理员处理器
 func (r *Router) createAdminHandler(handler http.Handler) http.Handler {
 	adminMiddleware := middleware.NewAdminMiddleware(r.config.Security.AdminAddresses, r.logger)
@@ -249,7 +368,7 @@ func (r *Router) applyMiddlewares(handler http.Handler) http.Handler {
 	handler = recoveryMiddleware.Handle(handler)
 
 	// 2. 日志中间件
-	loggerMiddleware := middleware.NewLoggerMiddleware(r.logger, r.config.Security.BehindProxy)
+	loggerMiddleware := middleware.NewLoggerMiddleware(r.logger, middleware.NewClientIPResolver(r.config.Security.BehindProxy, r.config.Security.TrustedProxies))
 	handler = loggerMiddleware.Handle(handler)
 
 	// 3. CORS 中间件
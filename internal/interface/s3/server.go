@@ -18,8 +18,10 @@ import (
 	"time"
 
 	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/pathname"
 	"github.com/yeying-community/warehouse/internal/domain/s3credential"
 	"github.com/yeying-community/warehouse/internal/domain/s3multipart"
+	"github.com/yeying-community/warehouse/internal/domain/team"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 	"go.uber.org/zap"
@@ -35,6 +37,7 @@ type Server struct {
 	objects    *service.ObjectService
 	users      user.Repository
 	multipart  *service.MultipartService
+	teams      TeamPrincipalResolver
 }
 
 func NewServer(cfg config.S3Config, resolver CredentialResolver, objects *service.ObjectService, users user.Repository, multipart *service.MultipartService, logger *zap.Logger) *Server {
@@ -116,6 +119,8 @@ func visibleS3Buckets(rootPath string) []string {
 		return []string{"apps"}
 	case rootPath == "/services" || strings.HasPrefix(rootPath, "/services/"):
 		return []string{"services"}
+	case strings.HasPrefix(rootPath, team.SpacePrefix+"/"):
+		return []string{teamsBucket}
 	default:
 		return nil
 	}
@@ -193,7 +198,6 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 		s.writeError(w, http.StatusForbidden, "AccessDenied", "credential owner not found")
 		return
 	}
-	userDirectory := owner.Directory
 	query := req.URL.Query()
 	requestedPath := "/" + bucket
 	if key != "" {
@@ -217,24 +221,52 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 		s.writeError(w, http.StatusForbidden, "AccessDenied", "credential is not bound to this path")
 		return
 	}
-	if req.Method == http.MethodPost && query.Has("uploads") {
-		s.handleCreateMultipart(w, req, credential, owner, bucket, key)
-		return
-	}
 	if req.Method == http.MethodPost && query.Has("delete") {
+		// DeleteObjects resolves the target of every key separately.
 		s.handleDeleteObjects(w, req, credential, owner, bucket, key)
 		return
 	}
+	lookupKey := key
+	if key == "" && req.Method == http.MethodGet {
+		lookupKey = query.Get("prefix")
+	} else if key == "" && bucket == teamsBucket {
+		lookupKey = strings.TrimPrefix(path.Clean("/"+credential.RootPath), team.SpacePrefix+"/")
+	}
+	target, err := s.resolveObjectTarget(req.Context(), credential, owner, bucket, lookupKey)
+	if err != nil {
+		s.writeTargetError(w, err)
+		return
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		if !target.canWrite() {
+			s.writeError(w, http.StatusForbidden, "AccessDenied", "team role is read-only")
+			return
+		}
+		if err := s.objects.CheckWritable(target.owner); err != nil {
+			if errors.Is(err, service.ErrVolumeMoving) {
+				w.Header().Set("Retry-After", "30")
+				s.writeError(w, http.StatusServiceUnavailable, "SlowDown", err.Error())
+				return
+			}
+			s.writeError(w, http.StatusForbidden, "AccessDenied", err.Error())
+			return
+		}
+	}
+	userDirectory := target.owner.Directory
+	if req.Method == http.MethodPost && query.Has("uploads") {
+		s.handleCreateMultipart(w, req, credential, target, bucket, key)
+		return
+	}
 	if req.Method == http.MethodPost && query.Get("uploadId") != "" {
-		s.handleCompleteMultipart(w, req, credential, owner, query.Get("uploadId"))
+		s.handleCompleteMultipart(w, req, credential, target, query.Get("uploadId"))
 		return
 	}
 	if req.Method == http.MethodPut && query.Get("uploadId") != "" && query.Get("partNumber") != "" {
-		s.handleUploadPart(w, req, credential, owner, query.Get("uploadId"), query.Get("partNumber"))
+		s.handleUploadPart(w, req, credential, target.owner, query.Get("uploadId"), query.Get("partNumber"))
 		return
 	}
 	if req.Method == http.MethodDelete && query.Get("uploadId") != "" {
-		s.handleAbortMultipart(w, req, owner, query.Get("uploadId"))
+		s.handleAbortMultipart(w, req, target.owner, query.Get("uploadId"))
 		return
 	}
 	switch req.Method {
@@ -244,10 +276,10 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 			return
 		}
 		if key == "" {
-			s.handleList(w, req, credential, userDirectory, bucket)
+			s.handleList(w, req, credential, target, bucket)
 			return
 		}
-		file, info, err := s.objects.Open(req.Context(), userDirectory, bucket, key)
+		file, info, err := s.objects.Open(req.Context(), userDirectory, target.bucket, target.key)
 		if err != nil {
 			s.writeObjectError(w, err)
 			return
@@ -261,14 +293,14 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 			return
 		}
 		if key == "" {
-			if _, err := s.objects.Stat(req.Context(), userDirectory, bucket, ""); err != nil {
+			if _, err := s.objects.Stat(req.Context(), userDirectory, target.bucket, target.key); err != nil {
 				s.writeObjectError(w, err)
 				return
 			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		info, err := s.objects.Stat(req.Context(), userDirectory, bucket, key)
+		info, err := s.objects.Stat(req.Context(), userDirectory, target.bucket, target.key)
 		if err != nil {
 			s.writeObjectError(w, err)
 			return
@@ -276,7 +308,7 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 		setObjectHeaders(w, info)
 	case http.MethodPut:
 		permission := "create"
-		if _, statErr := s.objects.Stat(req.Context(), userDirectory, bucket, key); statErr == nil {
+		if _, statErr := s.objects.Stat(req.Context(), userDirectory, target.bucket, target.key); statErr == nil {
 			permission = "update"
 		}
 		if !hasS3Permission(credential.Permissions, permission) {
@@ -284,14 +316,14 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 			return
 		}
 		if key == "" {
-			if err := s.objects.EnsureBucket(req.Context(), userDirectory, bucket); err != nil {
+			if err := s.objects.EnsureBucket(req.Context(), userDirectory, target.bucket); err != nil {
 				s.writeObjectError(w, err)
 				return
 			}
 			w.WriteHeader(http.StatusOK)
 			return
 		}
-		info, err := s.objects.PutForUserWithOptions(req.Context(), owner, bucket, key, req.Body, service.ObjectWriteOptions{
+		info, err := s.objects.PutForUserWithOptions(req.Context(), target.owner, target.bucket, target.key, req.Body, service.ObjectWriteOptions{
 			ExpectedMD5:    req.Header.Get("Content-MD5"),
 			ExpectedSHA256: req.Header.Get("X-Amz-Checksum-Sha256"),
 			ExpectedCRC32:  req.Header.Get("X-Amz-Checksum-Crc32"),
@@ -308,7 +340,7 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 			s.writeError(w, http.StatusForbidden, "AccessDenied", "delete permission is required")
 			return
 		}
-		if err := s.objects.DeleteForUser(req.Context(), owner, bucket, key); err != nil {
+		if err := s.objects.DeleteForUser(req.Context(), target.owner, target.bucket, target.key); err != nil {
 			s.writeObjectError(w, err)
 			return
 		}
@@ -318,12 +350,12 @@ func (s *Server) handleObject(w http.ResponseWriter, req *http.Request, credenti
 	}
 }
 
-func (s *Server) handleCreateMultipart(w http.ResponseWriter, req *http.Request, credential *s3credential.Credential, owner *user.User, bucket, key string) {
+func (s *Server) handleCreateMultipart(w http.ResponseWriter, req *http.Request, credential *s3credential.Credential, target objectTarget, bucket, key string) {
 	if s.multipart == nil || !hasS3Permission(credential.Permissions, "create") {
 		s.writeError(w, http.StatusForbidden, "AccessDenied", "create permission is required")
 		return
 	}
-	upload, err := s.multipart.Create(req.Context(), owner, bucket, key, req.Header.Get("Content-Type"))
+	upload, err := s.multipart.Create(req.Context(), target.owner, target.bucket, target.key, req.Header.Get("Content-Type"))
 	if err != nil {
 		s.writeObjectError(w, err)
 		return
@@ -389,7 +421,20 @@ func (s *Server) handleDeleteObjects(w http.ResponseWriter, req *http.Request, c
 			result.Errors = append(result.Errors, deleteObjectError{Key: objectKey, Code: "AccessDenied", Message: "credential is not bound to this path"})
 			continue
 		}
-		err := s.objects.DeleteForUser(req.Context(), owner, bucket, objectKey)
+		target, err := s.resolveObjectTarget(req.Context(), credential, owner, bucket, objectKey)
+		if err != nil {
+			result.Errors = append(result.Errors, deleteObjectError{Key: objectKey, Code: "AccessDenied", Message: "credential is not bound to this path"})
+			continue
+		}
+		if !target.canWrite() {
+			result.Errors = append(result.Errors, deleteObjectError{Key: objectKey, Code: "AccessDenied", Message: "team role is read-only"})
+			continue
+		}
+		if err := s.objects.CheckWritable(target.owner); err != nil {
+			result.Errors = append(result.Errors, deleteObjectError{Key: objectKey, Code: "AccessDenied", Message: err.Error()})
+			continue
+		}
+		err = s.objects.DeleteForUser(req.Context(), target.owner, target.bucket, target.key)
 		if err != nil && !os.IsNotExist(err) {
 			result.Errors = append(result.Errors, deleteObjectError{Key: objectKey, Code: "InternalError", Message: err.Error()})
 			continue
@@ -434,7 +479,7 @@ func (s *Server) handleAbortMultipart(w http.ResponseWriter, req *http.Request,
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) handleCompleteMultipart(w http.ResponseWriter, req *http.Request, credential *s3credential.Credential, owner *user.User, uploadID string) {
+func (s *Server) handleCompleteMultipart(w http.ResponseWriter, req *http.Request, credential *s3credential.Credential, target objectTarget, uploadID string) {
 	if s.multipart == nil || !hasS3Permission(credential.Permissions, "create") {
 		s.writeError(w, http.StatusForbidden, "AccessDenied", "create permission is required")
 		return
@@ -453,11 +498,15 @@ func (s *Server) handleCompleteMultipart(w http.ResponseWriter, req *http.Reques
 	for _, part := range request.Parts {
 		parts = append(parts, service.CompletePart{PartNumber: part.PartNumber, ETag: strings.Trim(part.ETag, `"`)})
 	}
-	info, err := s.multipart.Complete(req.Context(), owner, uploadID, parts)
+	info, err := s.multipart.Complete(req.Context(), target.owner, uploadID, parts)
 	if err != nil {
 		s.writeObjectError(w, err)
 		return
 	}
+	bucket, key := info.Bucket, info.Key
+	if target.keyPrefix != "" {
+		bucket, key = teamsBucket, target.responseKey(info.Key)
+	}
 	scheme := "http"
 	if req.TLS != nil || strings.EqualFold(strings.TrimSpace(req.Header.Get("X-Forwarded-Proto")), "https") {
 		scheme = "https"
@@ -469,9 +518,9 @@ func (s *Server) handleCompleteMultipart(w http.ResponseWriter, req *http.Reques
 		Key      string   `xml:"Key"`
 		ETag     string   `xml:"ETag"`
 	}{
-		Location: scheme + "://" + req.Host + "/" + info.Bucket + "/" + info.Key,
-		Bucket:   info.Bucket,
-		Key:      info.Key,
+		Location: scheme + "://" + req.Host + "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
 		ETag:     fmt.Sprintf("%q", info.ETag),
 	}
 	w.Header().Set("Content-Type", "application/xml")
@@ -552,10 +601,10 @@ type commonPrefix struct {
 	Prefix string `xml:"Prefix"`
 }
 
-func (s *Server) handleList(w http.ResponseWriter, req *http.Request, credential *s3credential.Credential, userDirectory, bucket string) {
+func (s *Server) handleList(w http.ResponseWriter, req *http.Request, credential *s3credential.Credential, target objectTarget, bucket string) {
 	query := req.URL.Query()
 	prefix := query.Get("prefix")
-	result, err := s.objects.List(req.Context(), userDirectory, bucket, prefix, 0)
+	result, err := s.objects.List(req.Context(), target.owner.Directory, target.bucket, target.key, 0)
 	if err != nil {
 		s.writeObjectError(w, err)
 		return
@@ -578,7 +627,7 @@ func (s *Server) handleList(w http.ResponseWriter, req *http.Request, credential
 	items := result.Objects
 	if marker != "" {
 		start := 0
-		for start < len(items) && items[start].Key <= marker {
+		for start < len(items) && target.responseKey(items[start].Key) <= marker {
 			start++
 		}
 		items = items[start:]
@@ -590,21 +639,21 @@ func (s *Server) handleList(w http.ResponseWriter, req *http.Request, credential
 	response := listBucketResult{Name: bucket, Prefix: prefix, KeyCount: len(items), MaxKeys: maxKeys, IsTruncated: truncated, Contents: make([]listObject, 0, len(items))}
 	if truncated && len(items) > 0 {
 		if query.Get("list-type") == "2" {
-			next, err := encodeContinuationToken(continuationToken{Bucket: bucket, Prefix: prefix, Key: items[len(items)-1].Key}, credential.Secret)
+			next, err := encodeContinuationToken(continuationToken{Bucket: bucket, Prefix: prefix, Key: target.responseKey(items[len(items)-1].Key)}, credential.Secret)
 			if err != nil {
 				s.writeError(w, http.StatusInternalServerError, "InternalError", "failed to create continuation token")
 				return
 			}
 			response.NextContinuationToken = next
 		} else {
-			response.NextMarker = items[len(items)-1].Key
+			response.NextMarker = target.responseKey(items[len(items)-1].Key)
 		}
 	}
 	for _, item := range items {
-		response.Contents = append(response.Contents, listObject{Key: item.Key, LastModified: item.ModifiedAt.UTC().Format(time.RFC3339), ETag: fmt.Sprintf("%q", item.ETag), Size: item.Size})
+		response.Contents = append(response.Contents, listObject{Key: target.responseKey(item.Key), LastModified: item.ModifiedAt.UTC().Format(time.RFC3339), ETag: fmt.Sprintf("%q", item.ETag), Size: item.Size})
 	}
 	for _, item := range result.Prefixes {
-		response.CommonPrefixes = append(response.CommonPrefixes, commonPrefix{Prefix: item})
+		response.CommonPrefixes = append(response.CommonPrefixes, commonPrefix{Prefix: target.responseKey(item)})
 	}
 	w.Header().Set("Content-Type", "application/xml")
 	_ = xml.NewEncoder(w).Encode(response)
@@ -657,6 +706,19 @@ func (s *Server) writeObjectError(w http.ResponseWriter, err error) {
 		s.writeError(w, http.StatusNotFound, "NoSuchKey", "object not found")
 		return
 	}
+	if errors.Is(err, pathname.ErrCaseCollision) {
+		s.writeError(w, http.StatusConflict, "OperationAborted", err.Error())
+		return
+	}
+	var violation *user.UploadPolicyViolation
+	if errors.As(err, &violation) {
+		if violation.Code == user.UploadPolicyFileTooLarge {
+			s.writeError(w, http.StatusBadRequest, "EntityTooLarge", err.Error())
+			return
+		}
+		s.writeError(w, http.StatusForbidden, "AccessDenied", err.Error())
+		return
+	}
 	s.writeError(w, http.StatusBadRequest, "InvalidRequest", err.Error())
 }
 
@@ -1,6 +1,7 @@
 package s3
 
 import (
+	"context"
 	"encoding/xml"
 	"net/http/httptest"
 	"reflect"
@@ -9,7 +10,9 @@ import (
 	"time"
 
 	"github.com/yeying-community/warehouse/internal/application/service"
+	"github.com/yeying-community/warehouse/internal/domain/object"
 	"github.com/yeying-community/warehouse/internal/domain/s3credential"
+	"github.com/yeying-community/warehouse/internal/domain/team"
 	"github.com/yeying-community/warehouse/internal/domain/user"
 	"github.com/yeying-community/warehouse/internal/infrastructure/config"
 )
@@ -48,6 +51,7 @@ func TestVisibleS3BucketsFollowsCredentialRootPath(t *testing.T) {
 		{name: "apps prefix", rootPath: "/apps/demo", want: []string{"apps"}},
 		{name: "services bucket", rootPath: "/services", want: []string{"services"}},
 		{name: "services prefix", rootPath: "/services/reports", want: []string{"services"}},
+		{name: "team space", rootPath: "/teams/t1/docs", want: []string{"teams"}},
 		{name: "invalid", rootPath: "/other", want: nil},
 	}
 	for _, tt := range tests {
@@ -163,3 +167,74 @@ func TestHandleDeleteObjectsEnforcesCredentialScopePerKey(t *testing.T) {
 		t.Fatalf("unexpected error response: %+v", result.Errors)
 	}
 }
+
+type fakeTeamResolver map[string]*user.User
+
+func (f fakeTeamResolver) ResolvePrincipal(_ context.Context, _ *user.User, teamID string) (*user.User, *team.Team, error) {
+	principal, ok := f[teamID]
+	if !ok {
+		return nil, nil, team.ErrTeamNotFound
+	}
+	return principal, &team.Team{ID: teamID, AccountUserID: principal.ID}, nil
+}
+
+func TestHandleDeleteObjectsMapsTeamKeysToTeamAccount(t *testing.T) {
+	root := t.TempDir()
+	objects := service.NewObjectService(root)
+	owner := user.NewUser("alice", "alice")
+	account := user.NewUser(team.AccountUsername("t1"), team.Directory("t1"))
+	account.Permissions = team.Permissions(team.RoleEditor)
+	if _, err := objects.PutForUser(t.Context(), account, object.RootBucket, "plan.md", strings.NewReader("plan")); err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+
+	server := &Server{objects: objects, teams: fakeTeamResolver{"t1": account}}
+	credential := &s3credential.Credential{OwnerUserID: owner.ID, RootPath: "/teams/t1", Permissions: "delete"}
+	req := httptest.NewRequest("POST", "/teams/?delete=", strings.NewReader(`<Delete><Object><Key>t1/plan.md</Key></Object><Object><Key>t2/other.md</Key></Object></Delete>`))
+	resp := httptest.NewRecorder()
+
+	server.handleDeleteObjects(resp, req, credential, owner, teamsBucket, "")
+
+	if _, err := objects.Stat(t.Context(), account.Directory, object.RootBucket, "plan.md"); err == nil {
+		t.Fatal("expected team object to be deleted")
+	}
+	var result deleteObjectsResult
+	if err := xml.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0].Key != "t1/plan.md" {
+		t.Fatalf("unexpected deleted response: %+v", result.Deleted)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Key != "t2/other.md" || result.Errors[0].Code != "AccessDenied" {
+		t.Fatalf("unexpected error response: %+v", result.Errors)
+	}
+}
+
+func TestHandleDeleteObjectsRejectsTeamViewer(t *testing.T) {
+	root := t.TempDir()
+	objects := service.NewObjectService(root)
+	owner := user.NewUser("bob", "bob")
+	account := user.NewUser(team.AccountUsername("t1"), team.Directory("t1"))
+	if _, err := objects.PutForUser(t.Context(), account, object.RootBucket, "plan.md", strings.NewReader("plan")); err != nil {
+		t.Fatalf("put object: %v", err)
+	}
+	account.Permissions = team.Permissions(team.RoleViewer)
+
+	server := &Server{objects: objects, teams: fakeTeamResolver{"t1": account}}
+	credential := &s3credential.Credential{OwnerUserID: owner.ID, RootPath: "/teams/t1", Permissions: "delete"}
+	req := httptest.NewRequest("POST", "/teams/?delete=", strings.NewReader(`<Delete><Object><Key>t1/plan.md</Key></Object></Delete>`))
+	resp := httptest.NewRecorder()
+
+	server.handleDeleteObjects(resp, req, credential, owner, teamsBucket, "")
+
+	if _, err := objects.Stat(t.Context(), account.Directory, object.RootBucket, "plan.md"); err != nil {
+		t.Fatalf("expected object to remain for viewer: %v", err)
+	}
+	var result deleteObjectsResult
+	if err := xml.Unmarshal(resp.Body.Bytes(), &result); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(result.Deleted) != 0 || len(result.Errors) != 1 || result.Errors[0].Code != "AccessDenied" {
+		t.Fatalf("unexpected response: %+v", result)
+	}
+}
@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/yeying-community/warehouse/internal/domain/object"
+	"github.com/yeying-community/warehouse/internal/domain/s3credential"
+	"github.com/yeying-community/warehouse/internal/domain/team"
+	"github.com/yeying-community/warehouse/internal/domain/user"
+)
+
+// teamsBucket exposes team spaces as keys "<team-id>/..." of one bucket.
+const teamsBucket = "teams"
+
+var errTeamObjectDenied = errors.New("credential cannot access this team space")
+
+// TeamPrincipalResolver resolves the storage account used for a team space.
+type TeamPrincipalResolver interface {
+	ResolvePrincipal(ctx context.Context, u *user.User, teamID string) (*user.User, *team.Team, error)
+}
+
+// SetTeamResolver enables the teams bucket for credentials bound to /teams/<id>.
+func (s *Server) SetTeamResolver(teams TeamPrincipalResolver) {
+	s.teams = teams
+}
+
+// objectTarget is where a requested bucket/key lives. Team keys are stored
+// below the team account root, so keyPrefix is added back in responses.
+type objectTarget struct {
+	owner     *user.User
+	bucket    string
+	key       string
+	keyPrefix string
+}
+
+func (t objectTarget) responseKey(storageKey string) string {
+	return t.keyPrefix + storageKey
+}
+
+func (t objectTarget) canWrite() bool {
+	if t.keyPrefix == "" {
+		return true
+	}
+	return t.owner.Permissions != nil && t.owner.Permissions.Create && t.owner.Permissions.Update && t.owner.Permissions.Delete
+}
+
+// resolveObjectTarget maps teams/<id>/key onto the team account. Team buckets
+// are only reachable through credentials bound below that team's root.
+func (s *Server) resolveObjectTarget(ctx context.Context, credential *s3credential.Credential, owner *user.User, bucket, key string) (objectTarget, error) {
+	if bucket != teamsBucket {
+		return objectTarget{owner: owner, bucket: bucket, key: key}, nil
+	}
+	if s.teams == nil {
+		return objectTarget{}, errTeamObjectDenied
+	}
+	teamID, rest, ok := team.SplitSpacePath(team.SpacePrefix + "/" + key)
+	if !ok || teamID == "" {
+		return objectTarget{}, errTeamObjectDenied
+	}
+	teamRoot := path.Join(team.SpacePrefix, teamID)
+	rootPath := path.Clean("/" + strings.TrimSpace(credential.RootPath))
+	if rootPath != teamRoot && !strings.HasPrefix(rootPath, teamRoot+"/") {
+		return objectTarget{}, errTeamObjectDenied
+	}
+	principal, _, err := s.teams.ResolvePrincipal(ctx, owner, teamID)
+	if err != nil {
+		return objectTarget{}, err
+	}
+	return objectTarget{
+		owner:     principal,
+		bucket:    object.RootBucket,
+		key:       strings.TrimPrefix(rest, "/"),
+		keyPrefix: teamID + "/",
+	}, nil
+}
+
+func (s *Server) writeTargetError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, team.ErrTeamNotFound), errors.Is(err, team.ErrTeamsDisabled):
+		s.writeError(w, http.StatusNotFound, "NoSuchBucket", "team space not found")
+	case errors.Is(err, errTeamObjectDenied), errors.Is(err, team.ErrPermissionDenied):
+		s.writeError(w, http.StatusForbidden, "AccessDenied", "credential is not bound to this path")
+	default:
+		s.writeError(w, http.StatusInternalServerError, "InternalError", "failed to resolve team space")
+	}
+}